@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// What a serve credential may do. A dashboard gets read, a backup job
+// export, and only operators write or admin (compaction, LevelDB stats).
+// Tokens are bound to capability sets with -token-file; -token has every
+// capability and -read-token only read.
+
+type capabilities uint8
+
+const (
+	capRead   capabilities = 1 << iota // List keys and get values
+	capExport                          // Stream the database as NDJSON
+	capWrite                           // Put and delete values
+	capAdmin                           // Compact and read LevelDB stats
+	capAll    = capRead | capExport | capWrite | capAdmin
+)
+
+var capabilityNames = []struct {
+	name string
+	cap  capabilities
+}{{"read", capRead}, {"export", capExport}, {"write", capWrite}, {"admin", capAdmin}}
+
+// Parse a comma-separated list of capability names; "all" grants every one
+func parseCapabilities(list string) (capabilities, error) {
+	var caps capabilities
+	for _, name := range strings.Split(list, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "all" {
+			caps |= capAll
+			continue
+		}
+		found := false
+		for _, c := range capabilityNames {
+			if c.name == name {
+				caps |= c.cap
+				found = true
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("unknown capability %q, want read, export, write, admin or all", name)
+		}
+	}
+	return caps, nil
+}
+
+func (c capabilities) names() []string {
+	names := []string{}
+	for _, n := range capabilityNames {
+		if c&n.cap != 0 {
+			names = append(names, n.name)
+		}
+	}
+	return names
+}
+
+// What cred may do with the open database; no writes when it is read-only
+func (cred *serveCredential) allowed() capabilities {
+	if readOnly {
+		return cred.caps &^ capWrite
+	}
+	return cred.caps
+}
+
+// One entry of a -token-file
+type tokenGrant struct {
+	Name         string   `json:"name"`
+	Token        string   `json:"token"`
+	Capabilities []string `json:"capabilities"`
+}
+
+// Read the tokens of a -token-file into s
+func loadTokenFile(s *apiServer, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var grants []tokenGrant
+	if err := json.Unmarshal(data, &grants); err != nil {
+		return fmt.Errorf("parsing %s: %w", path, err)
+	}
+	for i, grant := range grants {
+		if grant.Token == "" || len(grant.Capabilities) == 0 {
+			return fmt.Errorf("%s: entry %d needs a token and capabilities", path, i+1)
+		}
+		caps, err := parseCapabilities(strings.Join(grant.Capabilities, ","))
+		if err != nil {
+			return fmt.Errorf("%s: entry %d: %w", path, i+1, err)
+		}
+		name := grant.Name
+		if name == "" {
+			name = fmt.Sprintf("token %d", i+1)
+		}
+		s.tokens[grant.Token] = &serveCredential{name: name, caps: caps}
+	}
+	return nil
+}
+
+// Stream the keys (under prefix) as NDJSON export lines
+func (s *apiServer) exportNDJSON(w http.ResponseWriter, r *http.Request, cred *serveCredential) {
+	var rng *util.Range
+	if prefix := r.URL.Query().Get("prefix"); prefix != "" {
+		rng = util.BytesPrefix([]byte(prefix))
+	}
+	shared := s.reads.acquire()
+	defer s.reads.release(shared)
+	iter := shared.snap.NewIterator(rng, scanReadOptions)
+	defer iter.Release()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	out := bufio.NewWriter(w)
+	defer out.Flush()
+	for iter.Next() {
+		if r.Context().Err() != nil {
+			return // The client went away
+		}
+		scanRate.wait(iter.Key(), iter.Value())
+		line, err := ndjsonLine(iter.Key(), iter.Value())
+		if err != nil {
+			return
+		}
+		if _, err := out.Write(line); err != nil {
+			return
+		}
+	}
+}
+
+// Compact the whole database, or the keys under prefix
+func (s *apiServer) compact(w http.ResponseWriter, r *http.Request, cred *serveCredential) {
+	if readOnly {
+		apiError(w, http.StatusForbidden, "the database is open read-only")
+		return
+	}
+	var rng util.Range
+	if prefix := r.URL.Query().Get("prefix"); prefix != "" {
+		rng = *util.BytesPrefix([]byte(prefix))
+	}
+	if err := db.CompactRange(rng); err != nil {
+		apiError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// LevelDB's own statistics properties, and what the levels panel warns of
+func (s *apiServer) stats(w http.ResponseWriter, r *http.Request, cred *serveCredential) {
+	result := make(map[string]string)
+	for _, name := range []string{"leveldb.stats", "leveldb.iostats", "leveldb.writedelay", "leveldb.sstables", "leveldb.blockpool", "leveldb.cachedblock", "leveldb.openedtables", "leveldb.alivesnaps", "leveldb.aliveiters"} {
+		if value, err := db.GetProperty(name); err == nil {
+			result[strings.TrimPrefix(name, "leveldb.")] = value
+		}
+	}
+	if levels, err := readLevelStats(); err == nil {
+		result["warnings"] = strings.Join(levelWarnings(levels), "\n")
+	}
+	writeJSON(w, http.StatusOK, result)
+}
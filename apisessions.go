@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Several people browsing through one serve instance: every read goes to
+// one snapshot shared by all requests, taken at startup and again after each
+// write through the API, so pages and values agree with each other without
+// a snapshot per client. A login session also keeps what its user is
+// browsing (prefix, search, selected key and how far the listing got), so
+// each teammate pages on from where they were, independently of the others.
+
+// A snapshot and the requests still reading it; released when the last of
+// them is done after a newer one replaced it
+type sharedSnapshot struct {
+	snap  snapshotReader
+	taken time.Time
+	refs  int // Requests reading it, plus one while it is current
+}
+
+type readLayer struct {
+	mu      sync.Mutex
+	current *sharedSnapshot
+}
+
+func newReadLayer() (*readLayer, error) {
+	l := &readLayer{}
+	return l, l.refresh()
+}
+
+// The current snapshot, to release when the request is done with it
+func (l *readLayer) acquire() *sharedSnapshot {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.current.refs++
+	return l.current
+}
+
+func (l *readLayer) release(s *sharedSnapshot) {
+	l.mu.Lock()
+	s.refs--
+	done := s.refs == 0
+	l.mu.Unlock()
+	if done {
+		s.snap.Release()
+	}
+}
+
+// Replace the current snapshot with one of the database as it is now
+func (l *readLayer) refresh() error {
+	snap, err := db.snapshot()
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	old := l.current
+	l.current = &sharedSnapshot{snap: snap, taken: time.Now(), refs: 1}
+	l.mu.Unlock()
+	if old != nil {
+		l.release(old)
+	}
+	return nil
+}
+
+// When the current snapshot was taken
+func (l *readLayer) taken() time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.current.taken
+}
+
+// Release the current snapshot when the server stops
+func (l *readLayer) close() {
+	l.mu.Lock()
+	old := l.current
+	l.mu.Unlock()
+	l.release(old)
+}
+
+// Take a new snapshot after a write, so every session sees it
+func (s *apiServer) afterWrite() {
+	if err := s.reads.refresh(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: reads keep the snapshot from before the write: %v\n", err)
+	}
+}
+
+// What a session is browsing; keys are exact bytes, base64 in JSON
+type sessionView struct {
+	Prefix   string `json:"prefix"`
+	Search   string `json:"search"`
+	Selected []byte `json:"selected_b64,omitempty"`
+	After    []byte `json:"after_b64,omitempty"` // Last key listed; the next page starts after it
+}
+
+// Session of the request's cookie; requests with a token or basic auth have none
+func (s *apiServer) sessionOf(r *http.Request) (*serveSession, error) {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return nil, errors.New("browsing state needs a session: POST /api/login first")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[cookie.Value]
+	if !ok {
+		return nil, errors.New("unknown session, log in again")
+	}
+	return session, nil
+}
+
+func (s *apiServer) writeSession(w http.ResponseWriter, session *serveSession) {
+	s.mu.Lock()
+	view := session.view
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]any{
+		"user":           session.cred.name,
+		"view":           view,
+		"snapshot_taken": s.reads.taken().Format(time.RFC3339),
+	})
+}
+
+func (s *apiServer) getSession(w http.ResponseWriter, r *http.Request, cred *serveCredential) {
+	session, err := s.sessionOf(r)
+	if err != nil {
+		apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.writeSession(w, session)
+}
+
+// Change the prefix, search or selected key of the session; a new prefix or
+// search starts the listing again
+func (s *apiServer) updateSession(w http.ResponseWriter, r *http.Request, cred *serveCredential) {
+	session, err := s.sessionOf(r)
+	if err != nil {
+		apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var update struct {
+		Prefix   *string `json:"prefix"`
+		Search   *string `json:"search"`
+		Selected *[]byte `json:"selected_b64"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		apiError(w, http.StatusBadRequest, "body: "+err.Error())
+		return
+	}
+	s.mu.Lock()
+	view := &session.view
+	if update.Prefix != nil && *update.Prefix != view.Prefix || update.Search != nil && *update.Search != view.Search {
+		view.After = nil
+	}
+	if update.Prefix != nil {
+		view.Prefix = *update.Prefix
+	}
+	if update.Search != nil {
+		view.Search = *update.Search
+	}
+	if update.Selected != nil {
+		view.Selected = *update.Selected
+	}
+	s.mu.Unlock()
+	s.writeSession(w, session)
+}
+
+// The next page of the session's listing; ?restart=1 lists from the first key again
+func (s *apiServer) sessionKeys(w http.ResponseWriter, r *http.Request, cred *serveCredential) {
+	session, err := s.sessionOf(r)
+	if err != nil {
+		apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	limit, err := requestLimit(r)
+	if err != nil {
+		apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.mu.Lock()
+	view := session.view
+	s.mu.Unlock()
+	if restart, _ := strconv.ParseBool(r.URL.Query().Get("restart")); restart {
+		view.After = nil
+	}
+
+	keys, more, err := s.keyPage(view.Prefix, view.Search, view.After, limit)
+	if err != nil {
+		apiError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.mu.Lock()
+	if session.view.Prefix == view.Prefix && session.view.Search == view.Search {
+		session.view.After = view.After
+		if len(keys) > 0 {
+			session.view.After = keys[len(keys)-1].bytes
+		}
+	}
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]any{"keys": keys, "more": more})
+}
@@ -0,0 +1,440 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const avroMaxDepth = 64
+
+const avroMaxNulls = 1 << 16 // Null items take no bytes, so the data does not bound how many an array claims
+
+var (
+	avroSchemas  stringList // -avro-schema values: file.avsc, or prefix=file.avsc
+	avroMappings []avroMapping
+)
+
+var errAvroTruncated = errors.New("truncated Avro data")
+
+var avroPrimitive = map[string]bool{"null": true, "boolean": true, "int": true, "long": true, "float": true, "double": true, "bytes": true, "string": true}
+
+// Values of keys starting with prefix are decoded with schema; longest prefix wins
+type avroMapping struct {
+	prefix []byte
+	schema *avroSchema
+}
+
+// Parsed Avro schema; named types are shared through their full names
+type avroSchema struct {
+	kind        string // A primitive name, or record, enum, array, map, fixed or union
+	name        string // Full name of a named type
+	logicalType string
+	scale       int
+	fields      []avroField
+	symbols     []string
+	items       *avroSchema // Array items or map values
+	branches    []*avroSchema
+	size        int
+}
+
+type avroField struct {
+	name   string
+	schema *avroSchema
+}
+
+// Load every -avro-schema file
+func setupAvroSchemas() error {
+	for _, spec := range avroSchemas {
+		prefix, path := "", spec
+		if i := strings.LastIndex(spec, "="); i >= 0 {
+			prefix, path = spec[:i], spec[i+1:]
+		}
+		key, _, err := parseKeyInput(prefix)
+		if err != nil {
+			return fmt.Errorf("-avro-schema %s: %w", spec, err)
+		}
+		schema, err := loadAvroSchema(path)
+		if err != nil {
+			return err
+		}
+		avroMappings = append(avroMappings, avroMapping{prefix: key, schema: schema})
+	}
+	sort.SliceStable(avroMappings, func(i, j int) bool {
+		return len(avroMappings[i].prefix) > len(avroMappings[j].prefix)
+	})
+	return nil
+}
+
+// Read and parse an .avsc schema file
+func loadAvroSchema(path string) (*avroSchema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	schema, err := parseAvroSchema(raw, "", map[string]*avroSchema{})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return schema, nil
+}
+
+// Resolve a schema from its JSON form; namespace is the enclosing one, for
+// names without a dot, and named holds the named types defined so far
+func parseAvroSchema(raw any, namespace string, named map[string]*avroSchema) (*avroSchema, error) {
+	switch v := raw.(type) {
+	case string:
+		if avroPrimitive[v] {
+			return &avroSchema{kind: v}, nil
+		}
+		if s, ok := named[avroFullName(v, namespace)]; ok {
+			return s, nil
+		}
+		if s, ok := named[v]; ok {
+			return s, nil
+		}
+		return nil, fmt.Errorf("unknown type %q", v)
+	case []any:
+		union := &avroSchema{kind: "union"}
+		for _, branch := range v {
+			s, err := parseAvroSchema(branch, namespace, named)
+			if err != nil {
+				return nil, err
+			}
+			union.branches = append(union.branches, s)
+		}
+		return union, nil
+	case map[string]any:
+		kind, ok := v["type"].(string)
+		if !ok || !avroPrimitive[kind] && named[avroFullName(kind, namespace)] != nil {
+			return parseAvroSchema(v["type"], namespace, named) // {"type": <schema>}
+		}
+		s := &avroSchema{kind: kind}
+		s.logicalType, _ = v["logicalType"].(string)
+		if scale, ok := v["scale"].(float64); ok {
+			s.scale = int(scale)
+		}
+		switch kind {
+		case "record", "error", "enum", "fixed":
+			name, _ := v["name"].(string)
+			if name == "" {
+				return nil, fmt.Errorf("%s without a name", kind)
+			}
+			if ns, ok := v["namespace"].(string); ok && !strings.Contains(name, ".") {
+				namespace = ns
+			}
+			s.name = avroFullName(name, namespace)
+			if i := strings.LastIndex(s.name, "."); i >= 0 {
+				namespace = s.name[:i]
+			}
+			named[s.name] = s // Before the fields, which may refer to it
+		}
+		switch kind {
+		case "record", "error":
+			s.kind = "record"
+			fields, _ := v["fields"].([]any)
+			for _, f := range fields {
+				field, _ := f.(map[string]any)
+				name, _ := field["name"].(string)
+				fs, err := parseAvroSchema(field["type"], namespace, named)
+				if err != nil {
+					return nil, fmt.Errorf("field %s: %w", name, err)
+				}
+				s.fields = append(s.fields, avroField{name: name, schema: fs})
+			}
+		case "enum":
+			symbols, _ := v["symbols"].([]any)
+			for _, sym := range symbols {
+				name, _ := sym.(string)
+				s.symbols = append(s.symbols, name)
+			}
+		case "fixed":
+			size, _ := v["size"].(float64)
+			s.size = int(size)
+		case "array", "map":
+			key := "items"
+			if kind == "map" {
+				key = "values"
+			}
+			items, err := parseAvroSchema(v[key], namespace, named)
+			if err != nil {
+				return nil, err
+			}
+			s.items = items
+		default:
+			if !avroPrimitive[kind] {
+				return nil, fmt.Errorf("unknown type %q", kind)
+			}
+		}
+		return s, nil
+	}
+	return nil, fmt.Errorf("bad schema %v", raw)
+}
+
+func avroFullName(name, namespace string) string {
+	if strings.Contains(name, ".") || namespace == "" {
+		return name
+	}
+	return namespace + "." + name
+}
+
+// Schema mapped to key, or nil
+func avroSchemaFor(key []byte) *avroSchema {
+	for _, m := range avroMappings {
+		if bytes.HasPrefix(key, m.prefix) {
+			return m.schema
+		}
+	}
+	return nil
+}
+
+// JSON-like rendering of value if key is mapped to an Avro schema and the
+// value decodes with it
+func decodeAvroValue(key, value []byte) (string, bool) {
+	schema := avroSchemaFor(key)
+	if schema == nil {
+		return "", false
+	}
+	return decodeAvroAs(schema, value)
+}
+
+// JSON-like rendering of value decoded with schema to its last byte. Values
+// in single-object encoding have their header skipped.
+func decodeAvroAs(schema *avroSchema, value []byte) (string, bool) {
+	if len(value) >= 10 && value[0] == 0xc3 && value[1] == 0x01 { // Marker and schema fingerprint
+		value = value[10:]
+	}
+	r := &avroReader{buf: value}
+	var out strings.Builder
+	if err := r.render(&out, schema, "", 0); err != nil || r.pos != len(value) {
+		return "", false
+	}
+	return out.String(), true
+}
+
+type avroReader struct {
+	buf []byte
+	pos int
+}
+
+func (r *avroReader) take(n int64) ([]byte, error) {
+	if n < 0 || n > int64(len(r.buf)-r.pos) {
+		return nil, errAvroTruncated
+	}
+	b := r.buf[r.pos : r.pos+int(n)]
+	r.pos += int(n)
+	return b, nil
+}
+
+// Zigzag-encoded variable-length int or long
+func (r *avroReader) long() (int64, error) {
+	v, n := binary.Uvarint(r.buf[r.pos:])
+	if n <= 0 {
+		return 0, errAvroTruncated
+	}
+	r.pos += n
+	return int64(v>>1) ^ -int64(v&1), nil
+}
+
+func (r *avroReader) bytes() ([]byte, error) {
+	n, err := r.long()
+	if err != nil {
+		return nil, err
+	}
+	return r.take(n)
+}
+
+func (r *avroReader) render(out *strings.Builder, s *avroSchema, indent string, depth int) error {
+	if depth > avroMaxDepth {
+		return errors.New("nesting too deep")
+	}
+	switch s.kind {
+	case "null":
+		out.WriteString("null")
+	case "boolean":
+		b, err := r.take(1)
+		if err != nil {
+			return err
+		}
+		out.WriteString(strconv.FormatBool(b[0] != 0))
+	case "int", "long":
+		v, err := r.long()
+		if err != nil {
+			return err
+		}
+		out.WriteString(formatAvroNumber(s.logicalType, v))
+	case "float":
+		b, err := r.take(4)
+		if err != nil {
+			return err
+		}
+		out.WriteString(strconv.FormatFloat(float64(math.Float32frombits(binary.LittleEndian.Uint32(b))), 'g', -1, 32))
+	case "double":
+		b, err := r.take(8)
+		if err != nil {
+			return err
+		}
+		out.WriteString(strconv.FormatFloat(math.Float64frombits(binary.LittleEndian.Uint64(b)), 'g', -1, 64))
+	case "string":
+		b, err := r.bytes()
+		if err != nil {
+			return err
+		}
+		out.WriteString(quoteJSONString(string(b)))
+	case "bytes", "fixed":
+		var b []byte
+		var err error
+		if s.kind == "fixed" {
+			b, err = r.take(int64(s.size))
+		} else {
+			b, err = r.bytes()
+		}
+		if err != nil {
+			return err
+		}
+		if s.logicalType == "decimal" {
+			out.WriteString(formatAvroDecimal(b, s.scale))
+		} else {
+			out.WriteString("[b64:" + base64.RawStdEncoding.EncodeToString(b) + "]")
+		}
+	case "enum":
+		i, err := r.long()
+		if err != nil {
+			return err
+		}
+		if i < 0 || i >= int64(len(s.symbols)) {
+			return fmt.Errorf("enum index %d out of range", i)
+		}
+		out.WriteString(quoteJSONString(s.symbols[i]))
+	case "union":
+		i, err := r.long()
+		if err != nil {
+			return err
+		}
+		if i < 0 || i >= int64(len(s.branches)) {
+			return fmt.Errorf("union branch %d out of range", i)
+		}
+		return r.render(out, s.branches[i], indent, depth+1)
+	case "record":
+		if len(s.fields) == 0 {
+			out.WriteString("{}")
+			return nil
+		}
+		out.WriteString("{")
+		for i, f := range s.fields {
+			out.WriteString("\n" + indent + "  " + quoteJSONString(f.name) + ": ")
+			if err := r.render(out, f.schema, indent+"  ", depth+1); err != nil {
+				return fmt.Errorf("%s: %w", f.name, err)
+			}
+			if i < len(s.fields)-1 {
+				out.WriteString(",")
+			}
+		}
+		out.WriteString("\n" + indent + "}")
+	case "array", "map":
+		return r.renderBlocks(out, s, indent, depth)
+	}
+	return nil
+}
+
+// Array items or map entries, written as a series of counted blocks ending
+// in an empty one; a negative count is followed by the block's byte size
+func (r *avroReader) renderBlocks(out *strings.Builder, s *avroSchema, indent string, depth int) error {
+	open, close := "[", "]"
+	if s.kind == "map" {
+		open, close = "{", "}"
+	}
+	out.WriteString(open)
+	count := 0
+	for {
+		n, err := r.long()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			break
+		}
+		if n < 0 {
+			n = -n
+			if _, err := r.long(); err != nil {
+				return err
+			}
+		}
+		if n > int64(len(r.buf)-r.pos) && (s.items.kind != "null" || int64(count)+n > avroMaxNulls) { // Items take at least a byte each
+			return errAvroTruncated
+		}
+		for ; n > 0; n-- {
+			if count > 0 {
+				out.WriteString(",")
+			}
+			out.WriteString("\n" + indent + "  ")
+			if s.kind == "map" {
+				key, err := r.bytes()
+				if err != nil {
+					return err
+				}
+				out.WriteString(quoteJSONString(string(key)) + ": ")
+			}
+			if err := r.render(out, s.items, indent+"  ", depth+1); err != nil {
+				return err
+			}
+			count++
+		}
+	}
+	if count > 0 {
+		out.WriteString("\n" + indent)
+	}
+	out.WriteString(close)
+	return nil
+}
+
+// int or long, as a date or time when its logical type says so
+func formatAvroNumber(logicalType string, v int64) string {
+	var t time.Time
+	switch logicalType {
+	case "date":
+		return quoteJSONString(time.Unix(v*86400, 0).UTC().Format(time.DateOnly))
+	case "timestamp-millis", "local-timestamp-millis":
+		t = time.UnixMilli(v)
+	case "timestamp-micros", "local-timestamp-micros":
+		t = time.UnixMicro(v)
+	case "timestamp-nanos", "local-timestamp-nanos":
+		t = time.Unix(0, v)
+	default:
+		return strconv.FormatInt(v, 10)
+	}
+	return quoteJSONString(t.UTC().Format(time.RFC3339Nano))
+}
+
+// Big-endian two's-complement unscaled value with scale decimal places
+func formatAvroDecimal(b []byte, scale int) string {
+	v := new(big.Int).SetBytes(b)
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		v.Sub(v, new(big.Int).Lsh(big.NewInt(1), uint(8*len(b))))
+	}
+	digits, sign := v.String(), ""
+	if strings.HasPrefix(digits, "-") {
+		digits, sign = digits[1:], "-"
+	}
+	if scale <= 0 {
+		return sign + digits
+	}
+	if len(digits) <= scale {
+		digits = strings.Repeat("0", scale-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-scale] + "." + digits[len(digits)-scale:]
+}
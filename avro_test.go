@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func mustAvroSchema(t *testing.T, text string) *avroSchema {
+	t.Helper()
+	var raw any
+	if err := json.Unmarshal([]byte(text), &raw); err != nil {
+		t.Fatal(err)
+	}
+	schema, err := parseAvroSchema(raw, "", map[string]*avroSchema{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return schema
+}
+
+// Zigzag varint, as Avro writes int and long
+func avroLong(v int64) string { return string(binary.AppendUvarint(nil, uint64(v<<1^v>>63))) }
+
+func avroString(s string) string { return avroLong(int64(len(s))) + s }
+
+const avroUserSchema = `{"type": "record", "name": "User", "namespace": "test", "fields": [
+	{"name": "name", "type": "string"},
+	{"name": "email", "type": ["null", "string"]},
+	{"name": "next", "type": ["null", "test.User"]}
+]}`
+
+func TestDecodeAvro(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		value  string
+		want   string
+	}{
+		{"null", `"null"`, "", "null"},
+		{"boolean", `"boolean"`, "\x01", "true"},
+		{"negative long", `"long"`, avroLong(-64), "-64"},
+		{"large long", `"long"`, avroLong(1 << 40), "1099511627776"},
+		{"float", `"float"`, "\x00\x00\xc0\x3f", "1.5"},
+		{"double", `"double"`, "\x00\x00\x00\x00\x00\x00\x04\x40", "2.5"},
+		{"string", `"string"`, avroString(`a"b`), `"a\"b"`},
+		{"bytes", `"bytes"`, avroLong(3) + "\x00\x01\x02", "[b64:AAEC]"},
+		{"fixed", `{"type": "fixed", "name": "Id", "size": 2}`, "\xab\xcd", "[b64:q80]"},
+		{"enum", `{"type": "enum", "name": "Kind", "symbols": ["A", "B"]}`, avroLong(1), `"B"`},
+		{"union", `["null", "string"]`, avroLong(1) + avroString("x"), `"x"`},
+		{"empty array", `{"type": "array", "items": "int"}`, "\x00", "[]"},
+		{"array", `{"type": "array", "items": "int"}`, avroLong(2) + avroLong(1) + avroLong(-1) + "\x00", "[\n  1,\n  -1\n]"},
+		{"array in blocks with sizes", `{"type": "array", "items": "int"}`, avroLong(-1) + avroLong(1) + avroLong(5) + avroLong(1) + avroLong(6) + "\x00", "[\n  5,\n  6\n]"},
+		{"array of nulls", `{"type": "array", "items": "null"}`, avroLong(3) + "\x00", "[\n  null,\n  null,\n  null\n]"},
+		{"map", `{"type": "map", "values": "long"}`, avroLong(1) + avroString("a") + avroLong(7) + "\x00", "{\n  \"a\": 7\n}"},
+		{"date", `{"type": "int", "logicalType": "date"}`, avroLong(19000), `"2022-01-08"`},
+		{"timestamp millis", `{"type": "long", "logicalType": "timestamp-millis"}`, avroLong(1500), `"1970-01-01T00:00:01.5Z"`},
+		{"timestamp micros", `{"type": "long", "logicalType": "timestamp-micros"}`, avroLong(1), `"1970-01-01T00:00:00.000001Z"`},
+		{"decimal", `{"type": "bytes", "logicalType": "decimal", "precision": 9, "scale": 2}`, avroLong(2) + "\x30\x39", "123.45"},
+		{"negative decimal", `{"type": "bytes", "logicalType": "decimal", "precision": 9, "scale": 3}`, avroLong(1) + "\xff", "-0.001"},
+		{"fixed decimal", `{"type": "fixed", "name": "D", "size": 2, "logicalType": "decimal", "scale": 0}`, "\x01\x00", "256"},
+		{"recursive record", avroUserSchema, avroString("a") + avroLong(0) + avroLong(1) + avroString("b") + avroLong(1) + avroString("e") + avroLong(0),
+			"{\n  \"name\": \"a\",\n  \"email\": null,\n  \"next\": {\n    \"name\": \"b\",\n    \"email\": \"e\",\n    \"next\": null\n  }\n}"},
+		{"single-object encoding", `"string"`, "\xc3\x01\x01\x02\x03\x04\x05\x06\x07\x08" + avroString("hi"), `"hi"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := decodeAvroAs(mustAvroSchema(t, tt.schema), []byte(tt.value))
+			if !ok {
+				t.Fatalf("decodeAvroAs(%x) failed", tt.value)
+			}
+			if got != tt.want {
+				t.Errorf("decodeAvroAs(%x) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeAvroMalformed(t *testing.T) {
+	deep := ""
+	for i := 0; i <= avroMaxDepth; i++ {
+		deep += avroString("a") + avroLong(0) + avroLong(1)
+	}
+	tests := []struct {
+		name   string
+		schema string
+		value  string
+		want   string
+	}{
+		{"empty", `"int"`, "", "truncated"},
+		{"truncated varint", `"long"`, "\x80", "truncated"},
+		{"truncated double", `"double"`, "\x00\x01", "truncated"},
+		{"string past end", `"string"`, avroLong(5) + "ab", "truncated"},
+		{"negative length", `"bytes"`, avroLong(-1), "truncated"},
+		{"huge length", `"string"`, avroLong(1 << 62), "truncated"},
+		{"enum out of range", `{"type": "enum", "name": "Kind", "symbols": ["A"]}`, avroLong(1), "enum index 1 out of range"},
+		{"negative enum", `{"type": "enum", "name": "Kind", "symbols": ["A"]}`, avroLong(-1), "enum index -1 out of range"},
+		{"union branch out of range", `["null", "int"]`, avroLong(2), "union branch 2 out of range"},
+		{"array count past end", `{"type": "array", "items": "int"}`, avroLong(100) + "\x02", "truncated"},
+		{"huge array of nulls", `{"type": "array", "items": "null"}`, avroLong(1<<62) + "\x00", "truncated"},
+		{"nulls over many blocks", `{"type": "array", "items": "null"}`, strings.Repeat(avroLong(avroMaxNulls/2), 3) + "\x00", "truncated"},
+		{"unterminated array", `{"type": "array", "items": "int"}`, avroLong(1) + avroLong(1), "truncated"},
+		{"record field", avroUserSchema, avroString("a") + avroLong(5), "email: union branch"},
+		{"nesting too deep", avroUserSchema, deep, "too deep"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &avroReader{buf: []byte(tt.value)}
+			var out strings.Builder
+			err := r.render(&out, mustAvroSchema(t, tt.schema), "", 0)
+			if err == nil {
+				t.Fatalf("rendered %x as %q, want an error containing %q", tt.value, out.String(), tt.want)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error %q, want one containing %q", err, tt.want)
+			}
+			if _, ok := decodeAvroAs(mustAvroSchema(t, tt.schema), []byte(tt.value)); ok {
+				t.Errorf("decodeAvroAs(%x) succeeded", tt.value)
+			}
+		})
+	}
+}
+
+// A value decoding with bytes left over is not taken as Avro
+func TestDecodeAvroTrailingBytes(t *testing.T) {
+	if got, ok := decodeAvroAs(mustAvroSchema(t, `"int"`), []byte("\x02\x02")); ok {
+		t.Errorf("decodeAvroAs = %q, want a failure for the extra byte", got)
+	}
+}
+
+func TestLoadAvroSchema(t *testing.T) {
+	tests := []struct {
+		name    string
+		schema  string
+		wantErr string
+	}{
+		{"record", avroUserSchema, ""},
+		{"named type in namespace", `{"type": "record", "name": "R", "namespace": "n", "fields": [
+			{"name": "a", "type": {"type": "fixed", "name": "F", "size": 4}},
+			{"name": "b", "type": "F"},
+			{"name": "c", "type": "n.F"}]}`, ""},
+		{"wrapped type", `{"type": {"type": "array", "items": "int"}}`, ""},
+		{"not json", `{"type":`, "parsing"},
+		{"unknown type", `"uint"`, `unknown type "uint"`},
+		{"unknown field type", `{"type": "record", "name": "R", "fields": [{"name": "a", "type": "Missing"}]}`, `field a: unknown type "Missing"`},
+		{"record without a name", `{"type": "record", "fields": []}`, "record without a name"},
+		{"unknown complex type", `{"type": "tuple"}`, `unknown type "tuple"`},
+		{"bad schema", `42`, "bad schema"},
+		{"array without items", `{"type": "array"}`, "bad schema"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "schema.avsc")
+			if err := os.WriteFile(path, []byte(tt.schema), 0644); err != nil {
+				t.Fatal(err)
+			}
+			schema, err := loadAvroSchema(path)
+			if tt.wantErr == "" {
+				if err != nil || schema == nil {
+					t.Fatalf("loadAvroSchema = %v, %v", schema, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
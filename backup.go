@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// Consistent copies of a live database: copying its directory while it is
+// written to can catch a table file half written or a manifest that names
+// files not copied yet. backup instead reads every entry from one snapshot
+// and writes it into a new database, so the copy holds exactly the state
+// at the moment the snapshot was taken, whatever is written meanwhile.
+
+// Stream every entry of snap into target in batches of batchSize. Keys in
+// several shards are written once, with the value a lookup returns.
+func backupSnapshot(snap snapshotReader, target engineWriter, batchSize int, progress func(string)) (int, error) {
+	iter := snap.NewIterator(nil, scanReadOptions)
+	defer iter.Release()
+
+	var records []archiveRecord
+	var last []byte
+	count := 0
+	for iter.Next() {
+		if err := interrupted(); err != nil {
+			return count, err
+		}
+		scanRate.wait(iter.Key(), iter.Value())
+		if last != nil && bytes.Equal(iter.Key(), last) {
+			continue // The same key in a later shard
+		}
+		record := archiveRecord{
+			key:   append([]byte{}, iter.Key()...),
+			value: append([]byte{}, iter.Value()...),
+		}
+		records = append(records, record)
+		last = record.key
+		if len(records) == batchSize {
+			if err := target.writeBatch(records); err != nil {
+				return count, err
+			}
+			count += len(records)
+			records = records[:0]
+			progress(fmt.Sprintf("%d keys backed up", count))
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return count, fmt.Errorf("iterator error: %w", err)
+	}
+	if len(records) > 0 {
+		if err := target.writeBatch(records); err != nil {
+			return count, err
+		}
+		count += len(records)
+		progress(fmt.Sprintf("%d keys backed up", count))
+	}
+	return count, nil
+}
+
+// Walker over a snapshot, the source side of a backup check
+func snapshotWalker(snap snapshotReader) recordWalker {
+	return func(fn func(key, value []byte) error) error {
+		iter := snap.NewIterator(nil, scanReadOptions)
+		defer iter.Release()
+		var last []byte
+		for iter.Next() {
+			if last != nil && bytes.Equal(iter.Key(), last) {
+				continue
+			}
+			last = append(last[:0], iter.Key()...)
+			if err := fn(iter.Key(), iter.Value()); err != nil {
+				return err
+			}
+		}
+		return iter.Error()
+	}
+}
+
+func cmdBackup(args []string) int {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	compression := fs.String("compression", "snappy", "Compression of the backup's tables: snappy or none")
+	batchSize := fs.Int("batch", 1000, "Entries written per batch")
+	verify := fs.Bool("verify", false, "Re-read the snapshot and the backup and compare digests, writing a .verify.json report")
+	fs.Parse(args)
+	if fs.NArg() != 1 || *batchSize < 1 {
+		return commandError("backup")
+	}
+	if indexedDB {
+		fmt.Fprintln(os.Stderr, "Error: backup writes keys in byte order and cannot be combined with -indexeddb")
+		return 2
+	}
+
+	handleShutdownSignals(func() {})
+	out := fs.Arg(0)
+	target, err := createLevelDBTarget(out, map[string]string{"compression": *compression})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating %s: %v\n", out, err)
+		return 2
+	}
+	defer target.Close()
+
+	snap, err := db.snapshot()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	defer snap.Release()
+
+	count, err := backupSnapshot(snap, target, *batchSize, func(detail string) {
+		fmt.Fprintf(os.Stderr, "\r%s", detail)
+	})
+	if count > 0 {
+		fmt.Fprintln(os.Stderr)
+	}
+	if errors.Is(err, errInterrupted) {
+		target.Close()
+		os.RemoveAll(out)
+		fmt.Fprintf(os.Stderr, "Interrupted after %d keys; removed the partial backup\n", count)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error after %d keys: %v\n", count, err)
+		return 2
+	}
+	fmt.Printf("Backed up %d keys to %s\n", count, out)
+	if !*verify {
+		return 0
+	}
+
+	report, err := verifyCopy(dbPath, out, snapshotWalker(snap), target.walk())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error verifying: %v\n", err)
+		return 2
+	}
+	reportPath, err := writeVerifyReport(report, out)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing report: %v\n", err)
+		return 2
+	}
+	fmt.Printf("%s; report in %s\n", report.summary(), reportPath)
+	if !report.ok() {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Minecraft Bedrock Edition keeps a world's chunks in its db directory
+// under packed binary keys: the chunk's X and Z as little-endian int32s,
+// the dimension as another int32 outside the overworld, a record tag and,
+// for subchunks, their vertical index. -bedrock shows such keys as labels,
+// lists the other records of a key's chunk in the value header and decodes
+// the little-endian NBT most other values are stored as.
+var bedrockWorld bool // -bedrock
+
+// Names of the chunk record tags
+var bedrockTags = map[byte]string{
+	43: "Data3D", 44: "Version", 45: "Data2D", 46: "Data2DLegacy", 47: "SubChunkPrefix",
+	48: "LegacyTerrain", 49: "BlockEntity", 50: "Entity", 51: "PendingTicks", 52: "LegacyBlockExtraData",
+	53: "BiomeState", 54: "FinalizedState", 55: "ConversionData", 56: "BorderBlocks", 57: "HardcodedSpawners",
+	58: "RandomTicks", 59: "CheckSums", 60: "GenerationSeed", 61: "GeneratedPreCavesAndCliffsBlending",
+	62: "BlendingBiomeHeight", 63: "MetaDataHash", 64: "BlendingData", 65: "ActorDigestVersion", 118: "LegacyVersion",
+}
+
+var bedrockDimensions = []string{"overworld", "nether", "the end"}
+
+const bedrockSubChunk = 47
+
+type bedrockChunkKey struct {
+	x, z      int32
+	dimension int32
+	tag       byte
+	subChunk  int8 // Only for SubChunkPrefix records
+}
+
+// Chunk position of a key: X and Z, then the dimension unless it is the
+// overworld; 8 or 12 bytes
+func parseBedrockChunk(b []byte) (k bedrockChunkKey, ok bool) {
+	if len(b) != 8 && len(b) != 12 {
+		return k, false
+	}
+	k.x = int32(binary.LittleEndian.Uint32(b))
+	k.z = int32(binary.LittleEndian.Uint32(b[4:]))
+	if len(b) == 12 {
+		k.dimension = int32(binary.LittleEndian.Uint32(b[8:]))
+		if k.dimension < 1 || k.dimension >= int32(len(bedrockDimensions)) {
+			return k, false
+		}
+	}
+	return k, true
+}
+
+// Parse a chunk record key: the chunk position, the tag and, for
+// subchunks, their index
+func parseBedrockChunkKey(key []byte) (k bedrockChunkKey, ok bool) {
+	var rest []byte
+	switch len(key) {
+	case 9, 10:
+		k, ok = parseBedrockChunk(key[:8])
+		rest = key[8:]
+	case 13, 14:
+		k, ok = parseBedrockChunk(key[:12])
+		rest = key[12:]
+	}
+	if !ok {
+		return k, false
+	}
+	k.tag = rest[0]
+	if _, known := bedrockTags[k.tag]; !known || (len(rest) == 2) != (k.tag == bedrockSubChunk) {
+		return k, false
+	}
+	if len(rest) == 2 {
+		k.subChunk = int8(rest[1])
+	}
+	return k, true
+}
+
+// Key bytes shared by every record of the chunk
+func (k bedrockChunkKey) chunkPrefix() []byte {
+	prefix := binary.LittleEndian.AppendUint32(nil, uint32(k.x))
+	prefix = binary.LittleEndian.AppendUint32(prefix, uint32(k.z))
+	if k.dimension != 0 {
+		prefix = binary.LittleEndian.AppendUint32(prefix, uint32(k.dimension))
+	}
+	return prefix
+}
+
+func (k bedrockChunkKey) chunk() string {
+	return fmt.Sprintf("%s chunk %d,%d", bedrockDimensions[k.dimension], k.x, k.z)
+}
+
+// Record name, with the block heights of a subchunk
+func (k bedrockChunkKey) record() string {
+	if k.tag == bedrockSubChunk {
+		return fmt.Sprintf("SubChunkPrefix %d (y %d..%d)", k.subChunk, int(k.subChunk)*16, int(k.subChunk)*16+15)
+	}
+	return bedrockTags[k.tag]
+}
+
+// Label of a chunk record, actor or actor digest key
+func formatBedrockKey(key []byte) (string, bool) {
+	if k, ok := parseBedrockChunkKey(key); ok {
+		return k.chunk() + ": " + k.record(), true
+	}
+	if id, ok := strings.CutPrefix(string(key), "actorprefix"); ok && len(id) == 8 {
+		return fmt.Sprintf("actor %d", int64(binary.LittleEndian.Uint64([]byte(id)))), true
+	}
+	if chunk, ok := strings.CutPrefix(string(key), "digp"); ok {
+		if k, ok := parseBedrockChunk([]byte(chunk)); ok {
+			return k.chunk() + ": actor digest", true
+		}
+	}
+	return "", false
+}
+
+// Value header line listing the records stored for the key's chunk
+func bedrockHeaderNote(key []byte) string {
+	k, ok := parseBedrockChunkKey(key)
+	if !bedrockWorld || !ok {
+		return ""
+	}
+	iter := browseReader().NewIterator(util.BytesPrefix(k.chunkPrefix()), nil)
+	defer iter.Release()
+	counts := make(map[byte]int)
+	var subChunks []int
+	total := 0
+	for iter.Next() && total < 1000 {
+		other, ok := parseBedrockChunkKey(iter.Key())
+		if !ok || other.dimension != k.dimension {
+			continue
+		}
+		total++
+		counts[other.tag]++
+		if other.tag == bedrockSubChunk {
+			subChunks = append(subChunks, int(other.subChunk))
+		}
+	}
+	tags := make([]int, 0, len(counts))
+	for tag := range counts {
+		tags = append(tags, int(tag))
+	}
+	sort.Ints(tags)
+	var parts []string
+	for _, tag := range tags {
+		switch {
+		case tag == bedrockSubChunk:
+			sort.Ints(subChunks)
+			parts = append(parts, fmt.Sprintf("%d subchunks (%d to %d)", len(subChunks), subChunks[0], subChunks[len(subChunks)-1]))
+		case counts[byte(tag)] > 1:
+			parts = append(parts, fmt.Sprintf("%s ×%d", bedrockTags[byte(tag)], counts[byte(tag)]))
+		default:
+			parts = append(parts, bedrockTags[byte(tag)])
+		}
+	}
+	return fmt.Sprintf("[gray](%s has %d records: %s)[-]", k.chunk(), total, strings.Join(parts, ", "))
+}
+
+// Actor digests list the IDs of the actors stored in the chunk
+func decodeBedrockDigest(key, value []byte) (string, bool) {
+	if !bedrockWorld || !strings.HasPrefix(string(key), "digp") || len(value)%8 != 0 {
+		return "", false
+	}
+	ids := make([]string, len(value)/8)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("actor %d", int64(binary.LittleEndian.Uint64(value[8*i:])))
+	}
+	return strings.Join(ids, "\n"), true
+}
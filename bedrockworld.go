@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/golang/snappy"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/journal"
+)
+
+// Bedrock's LevelDB fork compresses table blocks with zlib (compression
+// type 2) or raw deflate (type 4), which goleveldb cannot read. -bedrock
+// reads the world's tables and logs itself and copies the live entries
+// into a temporary database, which the viewer opens instead.
+
+const tableMagic = "\x57\xfb\x80\x8b\x24\x75\x47\xdb"
+
+// The world's database directory: path itself, or its db directory when
+// path is the world folder holding level.dat
+func bedrockDBDir(path string) string {
+	if info, err := os.Stat(filepath.Join(path, "db")); err == nil && info.IsDir() {
+		return filepath.Join(path, "db")
+	}
+	return path
+}
+
+// Copy the newest entry of every key of the database in dir into a new
+// temporary database, leaving out deleted keys
+func copyBedrockWorld(dir string) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	tmp, err := os.MkdirTemp("", "leveldb-viewer-bedrock-")
+	if err != nil {
+		return "", err
+	}
+	out, err := leveldb.OpenFile(tmp, nil)
+	if err != nil {
+		os.RemoveAll(tmp)
+		return "", err
+	}
+	seqs := make(map[string]uint64)
+	apply := func(key []byte, seq uint64, value []byte, deleted bool) error {
+		if newest, ok := seqs[string(key)]; ok && newest >= seq {
+			return nil
+		}
+		seqs[string(key)] = seq
+		if deleted {
+			return out.Delete(key, nil)
+		}
+		return out.Put(key, value, nil)
+	}
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		switch filepath.Ext(entry.Name()) {
+		case ".ldb", ".sst":
+			err = readBedrockTable(path, apply)
+		case ".log":
+			err = readBedrockLog(path, apply)
+		default:
+			continue
+		}
+		if err != nil {
+			out.Close()
+			os.RemoveAll(tmp)
+			return "", fmt.Errorf("%s: %w", entry.Name(), err)
+		}
+	}
+	if err := out.Close(); err != nil {
+		os.RemoveAll(tmp)
+		return "", err
+	}
+	return tmp, nil
+}
+
+// Pass every entry of a table file to apply
+func readBedrockTable(path string, apply func(key []byte, seq uint64, value []byte, deleted bool) error) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if len(data) < 48 || string(data[len(data)-8:]) != tableMagic {
+		return errors.New("not a LevelDB table")
+	}
+	footer := data[len(data)-48:]
+	for i := 0; i < 2; i++ { // Skip the metaindex handle
+		_, n := binary.Uvarint(footer)
+		if n <= 0 {
+			return errors.New("bad table footer")
+		}
+		footer = footer[n:]
+	}
+	index, err := readTableBlock(data, footer)
+	if err != nil {
+		return fmt.Errorf("index block: %w", err)
+	}
+	return walkTableBlock(index, func(_, handle []byte) error {
+		block, err := readTableBlock(data, handle)
+		if err != nil {
+			return err
+		}
+		return walkTableBlock(block, func(ikey, value []byte) error {
+			if len(ikey) < 8 {
+				return errors.New("bad internal key")
+			}
+			trailer := binary.LittleEndian.Uint64(ikey[len(ikey)-8:])
+			return apply(ikey[:len(ikey)-8], trailer>>8, value, trailer&0xff == 0)
+		})
+	})
+}
+
+// Contents of the block a handle (offset and size varints) points at
+func readTableBlock(data, handle []byte) ([]byte, error) {
+	offset, n := binary.Uvarint(handle)
+	size, m := binary.Uvarint(handle[max(n, 0):])
+	if n <= 0 || m <= 0 || offset > uint64(len(data)) || size+5 > uint64(len(data))-offset {
+		return nil, errors.New("bad block handle")
+	}
+	block := data[offset : offset+size]
+	switch kind := data[offset+size]; kind {
+	case 0:
+		return block, nil
+	case 1:
+		return snappy.Decode(nil, block)
+	case 2:
+		r, err := zlib.NewReader(bytes.NewReader(block))
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(r)
+	case 4:
+		return io.ReadAll(flate.NewReader(bytes.NewReader(block)))
+	default:
+		return nil, fmt.Errorf("unknown compression type %d", kind)
+	}
+}
+
+// Pass every key and value of a block to fn; keys are only valid during the call
+func walkTableBlock(block []byte, fn func(key, value []byte) error) error {
+	if len(block) < 4 {
+		return errors.New("block too short")
+	}
+	restarts := uint64(binary.LittleEndian.Uint32(block[len(block)-4:]))
+	if 4+4*restarts > uint64(len(block)) {
+		return errors.New("bad block restarts")
+	}
+	entries := block[:uint64(len(block))-4-4*restarts]
+	var key []byte
+	for len(entries) > 0 {
+		var lengths [3]uint64 // Shared key bytes, unshared key bytes, value bytes
+		for i := range lengths {
+			v, n := binary.Uvarint(entries)
+			if n <= 0 {
+				return errors.New("bad block entry")
+			}
+			lengths[i], entries = v, entries[n:]
+		}
+		if lengths[0] > uint64(len(key)) || lengths[1]+lengths[2] > uint64(len(entries)) {
+			return errors.New("bad block entry")
+		}
+		key = append(key[:lengths[0]], entries[:lengths[1]]...)
+		value := entries[lengths[1] : lengths[1]+lengths[2]]
+		entries = entries[lengths[1]+lengths[2]:]
+		if err := fn(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Pass every write of a log file's batches to apply; a torn tail is skipped
+func readBedrockLog(path string, apply func(key []byte, seq uint64, value []byte, deleted bool) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	reader := journal.NewReader(f, nil, false, true)
+	for {
+		record, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		batch, err := io.ReadAll(record)
+		if err != nil || len(batch) < 12 {
+			continue // Damaged records are dropped, as LevelDB drops them on recovery
+		}
+		seq, count := binary.LittleEndian.Uint64(batch), binary.LittleEndian.Uint32(batch[8:])
+		rest := batch[12:]
+		for i := uint64(0); i < uint64(count); i++ {
+			if len(rest) == 0 {
+				return fmt.Errorf("batch at sequence %d is truncated", seq)
+			}
+			kind := rest[0]
+			var key, value []byte
+			var ok bool
+			key, rest, ok = cutLengthPrefixed(rest[1:])
+			if ok && kind == 1 {
+				value, rest, ok = cutLengthPrefixed(rest)
+			}
+			if !ok {
+				return fmt.Errorf("batch at sequence %d is truncated", seq)
+			}
+			if err := apply(key, seq+i, value, kind == 0); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Split a varint-length-prefixed field off b
+func cutLengthPrefixed(b []byte) (field, rest []byte, ok bool) {
+	n, size := binary.Uvarint(b)
+	if size <= 0 || n > uint64(len(b)-size) {
+		return nil, nil, false
+	}
+	return b[size : size+int(n)], b[size+int(n):], true
+}
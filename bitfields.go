@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Flags field of binary values from the "bit_fields" section of the config
+// file, shown in the value header as the names of its set bits
+type bitFieldConfig struct {
+	Prefix string            `json:"prefix"` // Values of keys starting with this (0x hex and b64: allowed)
+	Name   string            `json:"name"`
+	Offset int               `json:"offset"` // Of the field's first byte in the value
+	Type   string            `json:"type"`   // uint8 (default), uint16be/le, uint32be/le or uint64be/le
+	Bits   map[string]string `json:"bits"`   // Names by bit number from 0 (least significant), or by range "lo-hi" for a number
+}
+
+type bitField struct {
+	prefix []byte
+	name   string
+	offset int
+	size   int
+	little bool
+	bits   []bitName // By lowest bit
+}
+
+type bitName struct {
+	lo, hi int
+	name   string
+}
+
+var bitFields []bitField
+
+// Check the configured bit fields and make them active
+func setupBitFields(configs []bitFieldConfig) error {
+	bitFields = nil
+	for i, c := range configs {
+		prefix, _, err := parseKeyInput(c.Prefix)
+		if err != nil {
+			return fmt.Errorf("bit field %d: %w", i+1, err)
+		}
+		typ := c.Type
+		if typ == "" {
+			typ = "uint8"
+		}
+		size, ok := keyPartSizes[typ]
+		if !ok || !strings.HasPrefix(typ, "uint") {
+			return fmt.Errorf("bit field %d: unknown type %q, want uint8, uint16be, uint16le, uint32be, uint32le, uint64be or uint64le", i+1, c.Type)
+		}
+		if c.Name == "" || c.Offset < 0 {
+			return fmt.Errorf("bit field %d: needs a name and an offset of 0 or more", i+1)
+		}
+		field := bitField{prefix: prefix, name: c.Name, offset: c.Offset, size: size, little: strings.HasSuffix(typ, "le")}
+		for bits, name := range c.Bits {
+			lo, hi, err := parseBitRange(bits, size*8)
+			if err != nil {
+				return fmt.Errorf("bit field %s: %w", c.Name, err)
+			}
+			field.bits = append(field.bits, bitName{lo: lo, hi: hi, name: name})
+		}
+		sort.Slice(field.bits, func(a, b int) bool { return field.bits[a].lo < field.bits[b].lo })
+		bitFields = append(bitFields, field)
+	}
+	return nil
+}
+
+// "3" or "4-6", within a field of width bits
+func parseBitRange(s string, width int) (lo, hi int, err error) {
+	loText, hiText, isRange := strings.Cut(s, "-")
+	lo, err = strconv.Atoi(loText)
+	hi = lo
+	if err == nil && isRange {
+		hi, err = strconv.Atoi(hiText)
+	}
+	if err != nil || lo < 0 || hi < lo || hi >= width {
+		return 0, 0, fmt.Errorf("bad bit %q, want a number or range from 0 to %d", s, width-1)
+	}
+	return lo, hi, nil
+}
+
+// Header lines for the bit fields of key's value, one per field the value is long enough for
+func bitFieldHeaderNotes(key, value []byte) []string {
+	var notes []string
+	for _, f := range bitFields {
+		if !bytes.HasPrefix(key, f.prefix) || f.offset+f.size > len(value) {
+			continue
+		}
+		v := f.read(value[f.offset : f.offset+f.size])
+		notes = append(notes, fmt.Sprintf("[gray](%s at byte %d, 0x%0*x: %s)[-]", sanitizeForDisplay(f.name), f.offset, f.size*2, v, sanitizeForDisplay(f.describe(v))))
+	}
+	return notes
+}
+
+func (f bitField) read(b []byte) uint64 {
+	var v uint64
+	for i := range b {
+		if f.little {
+			v = v<<8 | uint64(b[len(b)-1-i])
+		} else {
+			v = v<<8 | uint64(b[i])
+		}
+	}
+	return v
+}
+
+// Names of the set bits, name=value for ranges, and "bit n" for set bits without a name
+func (f bitField) describe(v uint64) string {
+	var parts []string
+	named := uint64(0)
+	for _, b := range f.bits {
+		width := b.hi - b.lo + 1
+		mask := uint64(1)<<width - 1
+		if width == 64 {
+			mask = ^uint64(0)
+		}
+		named |= mask << b.lo
+		switch n := v >> b.lo & mask; {
+		case b.lo != b.hi:
+			parts = append(parts, fmt.Sprintf("%s=%d", b.name, n))
+		case n != 0:
+			parts = append(parts, b.name)
+		}
+	}
+	for bit := 0; bit < f.size*8; bit++ {
+		if v&^named&(1<<bit) != 0 {
+			parts = append(parts, fmt.Sprintf("bit %d", bit))
+		}
+	}
+	if len(parts) == 0 {
+		return "none set"
+	}
+	return strings.Join(parts, " | ")
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// A bookmark URI names a database, one of its keys and a value rendering,
+// e.g. ldbv:///srv/app/db?key=dXNlcjo0Mg&format=hex. Given in place of
+// -db, it opens the database with that record selected and shown.
+const bookmarkScheme = "ldbv://"
+
+// URI for key of the database at path; format is left out when it is "auto"
+func bookmarkURI(path string, key []byte, format string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	query := url.Values{"key": {base64.RawURLEncoding.EncodeToString(key)}}
+	if format != "" && format != "auto" {
+		query.Set("format", format)
+	}
+	return bookmarkScheme + (&url.URL{Path: filepath.ToSlash(path)}).EscapedPath() + "?" + query.Encode()
+}
+
+// Split a bookmark URI into its database path, key and format
+func parseBookmarkURI(uri string) (path string, key []byte, format string, err error) {
+	rest, ok := strings.CutPrefix(uri, bookmarkScheme)
+	if !ok {
+		return "", nil, "", fmt.Errorf("bookmark %q does not start with %s", uri, bookmarkScheme)
+	}
+	rest, rawQuery, _ := strings.Cut(rest, "?")
+	if path, err = url.PathUnescape(rest); err != nil {
+		return "", nil, "", fmt.Errorf("bad bookmark path: %w", err)
+	}
+	if path == "" {
+		return "", nil, "", fmt.Errorf("bookmark %q names no database", uri)
+	}
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return "", nil, "", fmt.Errorf("bad bookmark query: %w", err)
+	}
+	if encoded := query.Get("key"); encoded != "" {
+		// A + of standard base64 arrives as a space when the link was not escaped
+		if key, _, err = parseKeyInput("b64:" + strings.ReplaceAll(encoded, " ", "+")); err != nil {
+			return "", nil, "", err
+		}
+	}
+	return filepath.FromSlash(path), key, query.Get("format"), nil
+}
+
+// Open the bookmarked database, then select and show its record by
+// running the bookmark as -cmd steps ahead of any given ones
+func applyBookmark(uri string) error {
+	path, key, format, err := parseBookmarkURI(uri)
+	if err != nil {
+		return err
+	}
+	dbPath = path
+	var steps []string
+	if format != "" {
+		if err := setViewFormat(format); err != nil {
+			return err
+		}
+		steps = append(steps, "format "+format)
+	}
+	if key != nil {
+		steps = append(steps, "seek b64:"+base64.RawURLEncoding.EncodeToString(key), "open-value")
+	}
+	if startupScript != "" {
+		steps = append(steps, startupScript)
+	}
+	startupScript = strings.Join(steps, "; ")
+	return nil
+}
+
+// Put text on the system clipboard with the platform's copy command
+func copyToClipboard(text string) error {
+	var candidates [][]string
+	switch runtime.GOOS {
+	case "darwin":
+		candidates = [][]string{{"pbcopy"}}
+	case "windows":
+		candidates = [][]string{{"clip"}}
+	default:
+		candidates = [][]string{{"wl-copy"}, {"xclip", "-selection", "clipboard"}, {"xsel", "--clipboard", "--input"}}
+	}
+	for _, args := range candidates {
+		if _, err := exec.LookPath(args[0]); err != nil {
+			continue
+		}
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Stdin = strings.NewReader(text)
+		return cmd.Run()
+	}
+	return fmt.Errorf("no clipboard command found")
+}
+
+// Copy a bookmark URI of the selected key and show it for copying by hand
+func copyBookmark() {
+	if refuseHostAccess() {
+		return
+	}
+	if currentKey == nil {
+		setStatus("[red]No key selected")
+		return
+	}
+	uri := bookmarkURI(dbPath, currentKey, viewFormats[viewFormat].name)
+	note := "[green]Copied to the clipboard[-]; Enter or Esc to close"
+	if err := copyToClipboard(uri); err != nil {
+		note = fmt.Sprintf("[yellow]Not copied (%v)[-], select it to copy; Enter or Esc to close", err)
+	}
+
+	input := newDialogInput("")
+	input.SetText(uri)
+	result := tview.NewTextView().SetDynamicColors(true)
+	result.SetBackgroundColor(tcell.ColorReset)
+	result.SetText(note)
+
+	layout := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(input, 1, 0, true).
+		AddItem(result, 1, 0, false)
+	layout.SetBorder(true).SetTitle(" Bookmark URI ")
+	layout.SetTitleAlign(tview.AlignLeft)
+	layout.SetTitleColor(tcell.ColorYellow)
+	layout.SetBackgroundColor(tcell.ColorReset)
+
+	input.SetDoneFunc(func(tcell.Key) { closeDialog("bookmark") })
+	showDialog("bookmark", layout, min(max(len(uri)+4, 70), 120), 4)
+}
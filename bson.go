@@ -0,0 +1,357 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const bsonMaxDepth = 64
+
+// Reader over one BSON document (bsonspec.org)
+type bsonReader struct {
+	buf []byte
+	pos int
+}
+
+var errBSONTruncated = errors.New("truncated BSON data")
+
+// Pretty-prints BSON documents as JSON-like text; the value view's "bson" format
+type bsonFormatter struct{}
+
+func (bsonFormatter) format(value []byte) string {
+	text, err := decodeBSON(value)
+	if err != nil {
+		return fmt.Sprintf("(not BSON: %v)\n\n%s", err, mixedContentDisplay(value))
+	}
+	return text
+}
+
+// Render value, which must hold exactly one BSON document
+func decodeBSON(value []byte) (string, error) {
+	r := &bsonReader{buf: value}
+	var out strings.Builder
+	if err := r.renderDocument(&out, false, "", 0); err != nil {
+		return "", err
+	}
+	if r.pos != len(value) {
+		return "", fmt.Errorf("%d bytes after the document", len(value)-r.pos)
+	}
+	return out.String(), nil
+}
+
+// Whether value looks like a BSON document: its length prefix matches the
+// value, it ends in a zero byte and it parses to the end
+func looksLikeBSON(value []byte) bool {
+	if len(value) < 5 || value[len(value)-1] != 0 || binary.LittleEndian.Uint32(value) != uint32(len(value)) {
+		return false
+	}
+	_, err := decodeBSON(value)
+	return err == nil
+}
+
+func (r *bsonReader) take(n int) ([]byte, error) {
+	if n < 0 || n > len(r.buf)-r.pos {
+		return nil, errBSONTruncated
+	}
+	b := r.buf[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+func (r *bsonReader) int32() (int32, error) {
+	b, err := r.take(4)
+	if err != nil {
+		return 0, err
+	}
+	return int32(binary.LittleEndian.Uint32(b)), nil
+}
+
+func (r *bsonReader) uint64() (uint64, error) {
+	b, err := r.take(8)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(b), nil
+}
+
+// Zero-terminated string, used for element names and regular expressions
+func (r *bsonReader) cstring() (string, error) {
+	for i := r.pos; i < len(r.buf); i++ {
+		if r.buf[i] == 0 {
+			s := string(r.buf[r.pos:i])
+			r.pos = i + 1
+			return s, nil
+		}
+	}
+	return "", errBSONTruncated
+}
+
+// Length-prefixed, zero-terminated string
+func (r *bsonReader) string() (string, error) {
+	n, err := r.int32()
+	if err != nil {
+		return "", err
+	}
+	if n < 1 {
+		return "", fmt.Errorf("bad string length %d", n)
+	}
+	b, err := r.take(int(n))
+	if err != nil {
+		return "", err
+	}
+	if b[n-1] != 0 {
+		return "", errors.New("string without terminating zero")
+	}
+	return string(b[:n-1]), nil
+}
+
+// Write a document as an object, or an array document as an array
+// (its element names are just the indexes)
+func (r *bsonReader) renderDocument(out *strings.Builder, array bool, indent string, depth int) error {
+	if depth > bsonMaxDepth {
+		return errors.New("nesting too deep")
+	}
+	start := r.pos
+	n, err := r.int32()
+	if err != nil {
+		return err
+	}
+	if n < 5 || int(n) > len(r.buf)-start {
+		return fmt.Errorf("bad document length %d", n)
+	}
+	end := start + int(n)
+	open, close := "{", "}"
+	if array {
+		open, close = "[", "]"
+	}
+	out.WriteString(open)
+	count := 0
+	for {
+		if r.pos >= end {
+			return errors.New("document runs past its length")
+		}
+		kind := r.buf[r.pos]
+		r.pos++
+		if kind == 0 {
+			break
+		}
+		name, err := r.cstring()
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			out.WriteString(",")
+		}
+		out.WriteString("\n" + indent + "  ")
+		if !array {
+			out.WriteString(quoteJSONString(name) + ": ")
+		}
+		if err := r.renderElement(out, kind, indent+"  ", depth); err != nil {
+			return err
+		}
+		count++
+	}
+	if r.pos != end {
+		return errors.New("document ends before its length")
+	}
+	if count > 0 {
+		out.WriteString("\n" + indent)
+	}
+	out.WriteString(close)
+	return nil
+}
+
+// Write the value of an element of the given type. Types without a JSON
+// equivalent are shown as in the mongo shell, e.g. ObjectId("...").
+func (r *bsonReader) renderElement(out *strings.Builder, kind byte, indent string, depth int) error {
+	switch kind {
+	case 0x01: // Double
+		v, err := r.uint64()
+		if err != nil {
+			return err
+		}
+		out.WriteString(strconv.FormatFloat(math.Float64frombits(v), 'g', -1, 64))
+	case 0x02, 0x0e: // String, symbol
+		s, err := r.string()
+		if err != nil {
+			return err
+		}
+		out.WriteString(quoteJSONString(s))
+	case 0x03:
+		return r.renderDocument(out, false, indent, depth+1)
+	case 0x04:
+		return r.renderDocument(out, true, indent, depth+1)
+	case 0x05:
+		return r.renderBinary(out)
+	case 0x06:
+		out.WriteString("undefined")
+	case 0x07:
+		id, err := r.take(12)
+		if err != nil {
+			return err
+		}
+		out.WriteString(`ObjectId("` + hex.EncodeToString(id) + `")`)
+	case 0x08:
+		b, err := r.take(1)
+		if err != nil {
+			return err
+		}
+		switch b[0] {
+		case 0:
+			out.WriteString("false")
+		case 1:
+			out.WriteString("true")
+		default:
+			return fmt.Errorf("bad boolean byte 0x%02x", b[0])
+		}
+	case 0x09: // UTC datetime in milliseconds
+		v, err := r.uint64()
+		if err != nil {
+			return err
+		}
+		out.WriteString(quoteJSONString(time.UnixMilli(int64(v)).UTC().Format(time.RFC3339Nano)))
+	case 0x0a:
+		out.WriteString("null")
+	case 0x0b:
+		pattern, err := r.cstring()
+		if err != nil {
+			return err
+		}
+		options, err := r.cstring()
+		if err != nil {
+			return err
+		}
+		out.WriteString("/" + pattern + "/" + options)
+	case 0x0c: // DBPointer
+		ns, err := r.string()
+		if err != nil {
+			return err
+		}
+		id, err := r.take(12)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, `DBPointer(%s, ObjectId("%s"))`, quoteJSONString(ns), hex.EncodeToString(id))
+	case 0x0d:
+		code, err := r.string()
+		if err != nil {
+			return err
+		}
+		out.WriteString("Code(" + quoteJSONString(code) + ")")
+	case 0x0f: // Code with scope
+		if _, err := r.int32(); err != nil {
+			return err
+		}
+		code, err := r.string()
+		if err != nil {
+			return err
+		}
+		out.WriteString("Code(" + quoteJSONString(code) + ", ")
+		if err := r.renderDocument(out, false, indent, depth+1); err != nil {
+			return err
+		}
+		out.WriteString(")")
+	case 0x10:
+		v, err := r.int32()
+		if err != nil {
+			return err
+		}
+		out.WriteString(strconv.Itoa(int(v)))
+	case 0x11: // Replication timestamp: seconds in the high half, increment in the low
+		v, err := r.uint64()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Timestamp(%d, %d)", v>>32, uint32(v))
+	case 0x12:
+		v, err := r.uint64()
+		if err != nil {
+			return err
+		}
+		out.WriteString(strconv.FormatInt(int64(v), 10))
+	case 0x13:
+		low, err := r.uint64()
+		if err != nil {
+			return err
+		}
+		high, err := r.uint64()
+		if err != nil {
+			return err
+		}
+		out.WriteString(`NumberDecimal("` + formatDecimal128(high, low) + `")`)
+	case 0xff:
+		out.WriteString("MinKey")
+	case 0x7f:
+		out.WriteString("MaxKey")
+	default:
+		return fmt.Errorf("unknown element type 0x%02x", kind)
+	}
+	return nil
+}
+
+// Binary data: UUIDs (subtypes 3 and 4) as such, other subtypes as base64
+func (r *bsonReader) renderBinary(out *strings.Builder) error {
+	n, err := r.int32()
+	if err != nil {
+		return err
+	}
+	head, err := r.take(1)
+	if err != nil {
+		return err
+	}
+	data, err := r.take(int(n))
+	if err != nil {
+		return err
+	}
+	switch subtype := head[0]; {
+	case (subtype == 3 || subtype == 4) && len(data) == 16:
+		h := hex.EncodeToString(data)
+		out.WriteString(`UUID("` + h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:] + `")`)
+	case subtype == 0:
+		out.WriteString("[b64:" + base64.RawStdEncoding.EncodeToString(data) + "]")
+	default:
+		fmt.Fprintf(out, "Binary(%d, [b64:%s])", subtype, base64.RawStdEncoding.EncodeToString(data))
+	}
+	return nil
+}
+
+// IEEE 754-2008 decimal128 in binary integer decimal encoding
+func formatDecimal128(high, low uint64) string {
+	sign := ""
+	if high>>63 != 0 {
+		sign = "-"
+	}
+	switch high >> 58 & 0x1f {
+	case 0x1e:
+		return sign + "Infinity"
+	case 0x1f:
+		return "NaN"
+	}
+	var exp int
+	coefficient := new(big.Int)
+	if high>>61&3 == 3 { // Coefficient would exceed 34 digits; non-canonical, so zero
+		exp = int(high>>47&0x3fff) - 6176
+	} else {
+		exp = int(high>>49&0x3fff) - 6176
+		coefficient.SetUint64(high & (1<<49 - 1))
+		coefficient.Lsh(coefficient, 64).Or(coefficient, new(big.Int).SetUint64(low))
+	}
+	digits := coefficient.String()
+	switch {
+	case exp == 0:
+		return sign + digits
+	case exp < 0 && -exp < len(digits):
+		return sign + digits[:len(digits)+exp] + "." + digits[len(digits)+exp:]
+	case exp < 0 && -exp-len(digits) <= 6:
+		return sign + "0." + strings.Repeat("0", -exp-len(digits)) + digits
+	}
+	return sign + digits + "E" + strconv.Itoa(exp)
+}
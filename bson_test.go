@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// BSON builders for test documents
+func bsonDoc(elements ...string) string {
+	body := strings.Join(elements, "") + "\x00"
+	return string(binary.LittleEndian.AppendUint32(nil, uint32(4+len(body)))) + body
+}
+
+func bsonElem(kind byte, name, payload string) string {
+	return string([]byte{kind}) + name + "\x00" + payload
+}
+
+func bsonStr(s string) string {
+	return string(binary.LittleEndian.AppendUint32(nil, uint32(len(s)+1))) + s + "\x00"
+}
+
+func le32(v uint32) string { return string(binary.LittleEndian.AppendUint32(nil, v)) }
+
+func le64(v uint64) string { return string(binary.LittleEndian.AppendUint64(nil, v)) }
+
+func TestDecodeBSON(t *testing.T) {
+	uuid := "\x12\x34\x56\x78\x9a\xbc\xde\xf0\x12\x34\x56\x78\x9a\xbc\xde\xf0"
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{"empty document", bsonDoc(), "{}"},
+		{"string and int32", bsonDoc(bsonElem(0x02, "name", bsonStr("ada")), bsonElem(0x10, "age", le32(36))),
+			"{\n  \"name\": \"ada\",\n  \"age\": 36\n}"},
+		{"double and int64", bsonDoc(bsonElem(0x01, "d", le64(0x3ff8000000000000)), bsonElem(0x12, "n", le64(1<<64-2))),
+			"{\n  \"d\": 1.5,\n  \"n\": -2\n}"},
+		{"array", bsonDoc(bsonElem(0x04, "tags", bsonDoc(bsonElem(0x02, "0", bsonStr("a")), bsonElem(0x08, "1", "\x01")))),
+			"{\n  \"tags\": [\n    \"a\",\n    true\n  ]\n}"},
+		{"nested document", bsonDoc(bsonElem(0x03, "a", bsonDoc(bsonElem(0x0a, "b", "")))),
+			"{\n  \"a\": {\n    \"b\": null\n  }\n}"},
+		{"object id", bsonDoc(bsonElem(0x07, "_id", "\x65\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x01")),
+			"{\n  \"_id\": ObjectId(\"650000000000000000000001\")\n}"},
+		{"datetime", bsonDoc(bsonElem(0x09, "at", le64(1500))), "{\n  \"at\": \"1970-01-01T00:00:01.5Z\"\n}"},
+		{"regex", bsonDoc(bsonElem(0x0b, "re", "^a\x00i\x00")), "{\n  \"re\": /^a/i\n}"},
+		{"timestamp", bsonDoc(bsonElem(0x11, "ts", le64(7<<32|3))), "{\n  \"ts\": Timestamp(7, 3)\n}"},
+		{"uuid", bsonDoc(bsonElem(0x05, "u", le32(16)+"\x04"+uuid)),
+			"{\n  \"u\": UUID(\"12345678-9abc-def0-1234-56789abcdef0\")\n}"},
+		{"generic binary", bsonDoc(bsonElem(0x05, "b", le32(3)+"\x00\x00\x01\x02")), "{\n  \"b\": [b64:AAEC]\n}"},
+		{"user binary", bsonDoc(bsonElem(0x05, "b", le32(1)+"\x80\xff")), "{\n  \"b\": Binary(128, [b64:/w])\n}"},
+		{"code with scope", bsonDoc(bsonElem(0x0f, "c", le32(0)+bsonStr("f()")+bsonDoc())), "{\n  \"c\": Code(\"f()\", {})\n}"},
+		{"decimal128", bsonDoc(bsonElem(0x13, "p", le64(15)+le64(6175<<49))), "{\n  \"p\": NumberDecimal(\"1.5\")\n}"},
+		{"min and max key", bsonDoc(bsonElem(0xff, "lo", ""), bsonElem(0x7f, "hi", "")), "{\n  \"lo\": MinKey,\n  \"hi\": MaxKey\n}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeBSON([]byte(tt.value))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("decodeBSON(%x) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeBSONMalformed(t *testing.T) {
+	deep := bsonDoc()
+	for i := 0; i <= bsonMaxDepth+1; i++ {
+		deep = bsonDoc(bsonElem(0x03, "a", deep))
+	}
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{"empty", "", "truncated"},
+		{"length too small", "\x04\x00\x00\x00", "bad document length 4"},
+		{"length past end", "\x10\x00\x00\x00\x00", "bad document length 16"},
+		{"negative length", "\xff\xff\xff\xff\x00", "bad document length -1"},
+		{"missing terminator", "\x05\x00\x00\x00\x10", "truncated"},
+		{"ends before its length", "\x06\x00\x00\x00\x00\x00", "ends before its length"},
+		{"unterminated name", "\x08\x00\x00\x00\x10abc", "truncated"},
+		{"unknown element type", bsonDoc(bsonElem(0x42, "x", "")), "unknown element type 0x42"},
+		{"bad boolean", bsonDoc(bsonElem(0x08, "b", "\x02")), "bad boolean byte 0x02"},
+		{"string length zero", bsonDoc(bsonElem(0x02, "s", le32(0))), "bad string length 0"},
+		{"huge string length", bsonDoc(bsonElem(0x02, "s", le32(0x7fffffff)+"a\x00")), "truncated"},
+		{"string without zero", bsonDoc(bsonElem(0x02, "s", le32(2)+"ab")), "without terminating zero"},
+		{"negative binary length", bsonDoc(bsonElem(0x05, "b", le32(0xffffffff)+"\x00")), "truncated"},
+		{"truncated int64", bsonDoc(bsonElem(0x12, "n", "\x01\x02")), "truncated"},
+		{"trailing bytes", bsonDoc() + "\x00", "1 bytes after the document"},
+		{"nesting too deep", deep, "too deep"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeBSON([]byte(tt.value))
+			if err == nil {
+				t.Fatalf("decodeBSON(%x) = %q, want an error containing %q", tt.value, got, tt.want)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error %q, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLooksLikeBSON(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  bool
+	}{
+		{"document", bsonDoc(bsonElem(0x10, "a", le32(1))), true},
+		{"empty document", bsonDoc(), true},
+		{"text", "hello", false},
+		{"length mismatch", bsonDoc() + "\x00", false},
+		{"bad element", bsonDoc(bsonElem(0x42, "x", "")), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := looksLikeBSON([]byte(tt.value)); got != tt.want {
+				t.Errorf("looksLikeBSON(%x) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatDecimal128(t *testing.T) {
+	tests := []struct {
+		name      string
+		high, low uint64
+		want      string
+	}{
+		{"zero", 6176 << 49, 0, "0"},
+		{"integer", 6176 << 49, 42, "42"},
+		{"fraction", 6175 << 49, 15, "1.5"},
+		{"small fraction", 6172 << 49, 15, "0.0015"},
+		{"negative", 1<<63 | 6174<<49, 1234, "-12.34"},
+		{"large exponent", 6180 << 49, 7, "7E4"},
+		{"tiny", 6160 << 49, 1, "1E-16"},
+		{"infinity", 0x1e << 58, 0, "Infinity"},
+		{"negative infinity", 1<<63 | 0x1e<<58, 0, "-Infinity"},
+		{"nan", 0x1f << 58, 0, "NaN"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatDecimal128(tt.high, tt.low); got != tt.want {
+				t.Errorf("formatDecimal128(%#x, %#x) = %q, want %q", tt.high, tt.low, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,415 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/storage"
+)
+
+// Databases shipped as archives: -db can name a .zip, .tar, .tar.gz or .tgz
+// holding a LevelDB directory, at its root or in a folder, and the viewer
+// opens it read-only without unpacking it by hand. A plain tar, and a zip
+// whose database files are stored uncompressed, are read in place; from
+// compressed archives the files are extracted to a temporary directory,
+// removed on exit. When an archive holds several databases, one is picked
+// with a #, as in profile.zip#Default/Local Storage/leveldb.
+
+var bundleSuffixes = []string{".zip", ".tar", ".tar.gz", ".tgz"}
+
+// The archive of a -db path and the database directory named after its #, if any
+func splitBundlePath(p string) (archive, inner string) {
+	if i := strings.LastIndex(p, "#"); i > 0 {
+		if _, err := os.Stat(p); err != nil {
+			return p[:i], strings.Trim(path.Clean("/"+filepath.ToSlash(p[i+1:])), "/")
+		}
+	}
+	return p, ""
+}
+
+// Whether p names an archive file to open as a database
+func isBundle(p string) bool {
+	archive, _ := splitBundlePath(p)
+	lower := strings.ToLower(archive)
+	for _, suffix := range bundleSuffixes {
+		if strings.HasSuffix(lower, suffix) {
+			info, err := os.Stat(archive)
+			return err == nil && info.Mode().IsRegular()
+		}
+	}
+	return false
+}
+
+// Open the database in the archive p read-only; the temporary directory it
+// was extracted to is returned for the caller to remove, "" when read in place
+func openBundle(p string, options *opt.Options) (database, string, error) {
+	o := *options
+	o.ReadOnly = true
+	archive, inner := splitBundlePath(p)
+	lower := strings.ToLower(archive)
+	var opened database
+	var tmp string
+	var err error
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		opened, tmp, err = openZipBundle(archive, inner, &o)
+	case strings.HasSuffix(lower, ".tar"):
+		opened, err = openTarBundle(archive, inner, &o)
+	default:
+		opened, tmp, err = openTarGzBundle(archive, inner, &o)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", archive, err)
+	}
+	return opened, tmp, nil
+}
+
+// Clean slash-separated path of an archive entry, without a way out of the
+// directory it is extracted to
+func bundleEntryPath(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+// The directory of the database to open among the archive's files: the one
+// named, or the only directory holding a CURRENT file ("." for the root)
+func pickBundleDir(names []string, inner string) (string, error) {
+	var dirs []string
+	for _, name := range names {
+		if path.Base(name) == "CURRENT" {
+			dirs = append(dirs, path.Dir(name))
+		}
+	}
+	sort.Strings(dirs)
+	if inner != "" {
+		for _, dir := range dirs {
+			if dir == inner {
+				return dir, nil
+			}
+		}
+		return "", fmt.Errorf("no LevelDB database in %s; the archive holds %s", inner, listBundleDirs(dirs))
+	}
+	switch len(dirs) {
+	case 0:
+		return "", errors.New("holds no LevelDB database (no CURRENT file)")
+	case 1:
+		return dirs[0], nil
+	}
+	return "", fmt.Errorf("holds several databases; pick one as <archive>#<directory>: %s", listBundleDirs(dirs))
+}
+
+func listBundleDirs(dirs []string) string {
+	if len(dirs) == 0 {
+		return "none"
+	}
+	return strings.Join(dirs, ", ")
+}
+
+func openZipBundle(archive, inner string, options *opt.Options) (database, string, error) {
+	zr, err := zip.OpenReader(archive)
+	if err != nil {
+		return nil, "", err
+	}
+	defer zr.Close()
+	var names []string
+	for _, f := range zr.File {
+		if f.Mode().IsRegular() {
+			names = append(names, bundleEntryPath(f.Name))
+		}
+	}
+	dir, err := pickBundleDir(names, inner)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var files []*zip.File
+	sections := make(map[string]bundleSection)
+	inPlace := true
+	for _, f := range zr.File {
+		name := bundleEntryPath(f.Name)
+		if !f.Mode().IsRegular() || path.Dir(name) != dir {
+			continue
+		}
+		files = append(files, f)
+		offset, err := f.DataOffset()
+		if f.Method != zip.Store || err != nil {
+			inPlace = false
+			continue
+		}
+		sections[path.Base(name)] = bundleSection{offset, int64(f.UncompressedSize64)}
+	}
+	if inPlace {
+		opened, err := openBundleInPlace(archive, sections, options)
+		return opened, "", err
+	}
+
+	fmt.Fprintf(os.Stderr, "Extracting %s...\n", archive)
+	tmp, err := os.MkdirTemp("", "leveldb-viewer-bundle-")
+	if err != nil {
+		return nil, "", err
+	}
+	for _, f := range files {
+		if err := extractZipFile(f, filepath.Join(tmp, path.Base(bundleEntryPath(f.Name)))); err != nil {
+			os.RemoveAll(tmp)
+			return nil, "", fmt.Errorf("extracting %s: %w", f.Name, err)
+		}
+	}
+	opened, err := leveldb.OpenFile(tmp, options)
+	if err != nil {
+		os.RemoveAll(tmp)
+		return nil, "", err
+	}
+	return singleDB{opened}, tmp, nil
+}
+
+func extractZipFile(f *zip.File, dst string) error {
+	in, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	return writeBundleFile(in, dst)
+}
+
+func writeBundleFile(in io.Reader, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// A plain tar stores every file as it is, so its database is always read in place
+func openTarBundle(archive, inner string, options *opt.Options) (database, error) {
+	file, err := os.Open(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	all := make(map[string]bundleSection)
+	var names []string
+	tr := tar.NewReader(file)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		offset, err := file.Seek(0, io.SeekCurrent) // Next leaves the file at the entry's data
+		if err != nil {
+			return nil, err
+		}
+		name := bundleEntryPath(header.Name)
+		names = append(names, name)
+		all[name] = bundleSection{offset, header.Size}
+	}
+	dir, err := pickBundleDir(names, inner)
+	if err != nil {
+		return nil, err
+	}
+	sections := make(map[string]bundleSection)
+	for name, section := range all {
+		if path.Dir(name) == dir {
+			sections[path.Base(name)] = section
+		}
+	}
+	return openBundleInPlace(archive, sections, options)
+}
+
+// A gzipped tar cannot be read at offsets: its files are extracted, keeping
+// their directories, before the database among them is picked
+func openTarGzBundle(archive, inner string, options *opt.Options) (database, string, error) {
+	file, err := os.Open(archive)
+	if err != nil {
+		return nil, "", err
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, "", err
+	}
+	fmt.Fprintf(os.Stderr, "Extracting %s...\n", archive)
+	tmp, err := os.MkdirTemp("", "leveldb-viewer-bundle-")
+	if err != nil {
+		return nil, "", err
+	}
+	fail := func(err error) (database, string, error) {
+		os.RemoveAll(tmp)
+		return nil, "", err
+	}
+	var names []string
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fail(err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := bundleEntryPath(header.Name)
+		if err := writeBundleFile(tr, filepath.Join(tmp, filepath.FromSlash(name))); err != nil {
+			return fail(fmt.Errorf("extracting %s: %w", header.Name, err))
+		}
+		names = append(names, name)
+	}
+	dir, err := pickBundleDir(names, inner)
+	if err != nil {
+		return fail(err)
+	}
+	opened, err := leveldb.OpenFile(filepath.Join(tmp, filepath.FromSlash(dir)), options)
+	if err != nil {
+		return fail(err)
+	}
+	return singleDB{opened}, tmp, nil
+}
+
+// Where a file's bytes lie in the archive
+type bundleSection struct{ offset, size int64 }
+
+// Open the database whose files lie uncompressed in archive at sections
+func openBundleInPlace(archive string, sections map[string]bundleSection, options *opt.Options) (database, error) {
+	file, err := os.Open(archive)
+	if err != nil {
+		return nil, err
+	}
+	stor := &bundleStorage{file: file, files: sections}
+	opened, err := leveldb.Open(stor, options)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return bundleDB{singleDB{opened}, stor}, nil
+}
+
+// A database read in place from an archive; closing it closes the archive too
+type bundleDB struct {
+	singleDB
+	stor *bundleStorage
+}
+
+func (d bundleDB) Close() error {
+	err := d.singleDB.Close()
+	d.stor.Close()
+	return err
+}
+
+var errBundleReadOnly = errors.New("a database read in place from an archive cannot be written")
+
+// Read-only LevelDB storage over the database files in an archive, by name
+type bundleStorage struct {
+	file  *os.File
+	files map[string]bundleSection
+}
+
+type bundleLock struct{}
+
+func (bundleLock) Unlock() {}
+
+// A file of the archive; closing it leaves the archive open for the others
+type bundleReader struct{ *io.SectionReader }
+
+func (bundleReader) Close() error { return nil }
+
+func (s *bundleStorage) Lock() (storage.Locker, error) { return bundleLock{}, nil }
+func (s *bundleStorage) Log(string)                    {}
+func (s *bundleStorage) SetMeta(storage.FileDesc) error {
+	return errBundleReadOnly
+}
+
+// The manifest CURRENT names
+func (s *bundleStorage) GetMeta() (storage.FileDesc, error) {
+	section, ok := s.files["CURRENT"]
+	if !ok {
+		return storage.FileDesc{}, os.ErrNotExist
+	}
+	data, err := io.ReadAll(io.NewSectionReader(s.file, section.offset, section.size))
+	if err != nil {
+		return storage.FileDesc{}, err
+	}
+	name := strings.TrimSpace(string(data))
+	if fd, ok := parseStorageName(name); ok && fd.Type == storage.TypeManifest {
+		return fd, nil
+	}
+	return storage.FileDesc{}, fmt.Errorf("CURRENT names %q, not a manifest", name)
+}
+
+func (s *bundleStorage) List(ft storage.FileType) ([]storage.FileDesc, error) {
+	var fds []storage.FileDesc
+	for name := range s.files {
+		if fd, ok := parseStorageName(name); ok && fd.Type&ft != 0 {
+			fds = append(fds, fd)
+		}
+	}
+	return fds, nil
+}
+
+func (s *bundleStorage) Open(fd storage.FileDesc) (storage.Reader, error) {
+	section, ok := s.files[fd.String()]
+	if !ok && fd.Type == storage.TypeTable {
+		section, ok = s.files[fmt.Sprintf("%06d.sst", fd.Num)] // Written by the C++ LevelDB
+	}
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return bundleReader{io.NewSectionReader(s.file, section.offset, section.size)}, nil
+}
+
+func (s *bundleStorage) Create(storage.FileDesc) (storage.Writer, error) {
+	return nil, errBundleReadOnly
+}
+func (s *bundleStorage) Remove(storage.FileDesc) error              { return errBundleReadOnly }
+func (s *bundleStorage) Rename(oldfd, newfd storage.FileDesc) error { return errBundleReadOnly }
+func (s *bundleStorage) Close() error                               { return s.file.Close() }
+
+// The file a LevelDB file name stands for: MANIFEST-000005, 000007.log,
+// 000008.ldb or .sst, 000009.tmp
+func parseStorageName(name string) (storage.FileDesc, bool) {
+	if number, ok := strings.CutPrefix(name, "MANIFEST-"); ok {
+		num, err := strconv.ParseInt(number, 10, 64)
+		return storage.FileDesc{Type: storage.TypeManifest, Num: num}, err == nil && num >= 0
+	}
+	number, ext, ok := strings.Cut(name, ".")
+	if !ok {
+		return storage.FileDesc{}, false
+	}
+	num, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || num < 0 {
+		return storage.FileDesc{}, false
+	}
+	switch ext {
+	case "log":
+		return storage.FileDesc{Type: storage.TypeJournal, Num: num}, true
+	case "ldb", "sst":
+		return storage.FileDesc{Type: storage.TypeTable, Num: num}, true
+	case "tmp":
+		return storage.FileDesc{Type: storage.TypeTemp, Num: num}, true
+	}
+	return storage.FileDesc{}, false
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/storage"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// The files of a small database holding key=value, by name
+func bundleTestFiles(t *testing.T) map[string][]byte {
+	t.Helper()
+	dir := t.TempDir()
+	db, err := leveldb.OpenFile(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put([]byte("key"), []byte("value"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CompactRange(util.Range{}); err != nil { // A table file as well as the journal
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string][]byte)
+	for _, e := range entries {
+		if data, err := os.ReadFile(filepath.Join(dir, e.Name())); err == nil && e.Name() != "LOCK" {
+			files[e.Name()] = data
+		}
+	}
+	return files
+}
+
+// Archive entries: the database's files under each of dirs ("" for the root)
+func bundleEntries(files map[string][]byte, dirs ...string) map[string][]byte {
+	entries := make(map[string][]byte)
+	for _, dir := range dirs {
+		for name, data := range files {
+			entries[strings.TrimPrefix(dir+"/"+name, "/")] = data
+		}
+	}
+	return entries
+}
+
+func writeZipBundle(t *testing.T, path string, entries map[string][]byte, method uint16) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for name, data := range entries {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: method})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeTarBundle(t *testing.T, path string, entries map[string][]byte, gzipped bool) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var w io.Writer = f
+	var gz *gzip.Writer
+	if gzipped {
+		gz = gzip.NewWriter(f)
+		w = gz
+	}
+	tw := tar.NewWriter(w)
+	for name, data := range entries {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeBundle(t *testing.T, path string, entries map[string][]byte) {
+	t.Helper()
+	switch {
+	case strings.HasSuffix(path, ".stored.zip"):
+		writeZipBundle(t, path, entries, zip.Store)
+	case strings.HasSuffix(path, ".zip"):
+		writeZipBundle(t, path, entries, zip.Deflate)
+	case strings.HasSuffix(path, ".tar"):
+		writeTarBundle(t, path, entries, false)
+	default:
+		writeTarBundle(t, path, entries, true)
+	}
+}
+
+func TestOpenBundle(t *testing.T) {
+	files := bundleTestFiles(t)
+	tests := []struct {
+		name    string
+		archive string
+		dirs    []string
+		inner   string
+		inPlace bool
+	}{
+		{"stored zip at the root", "db.stored.zip", []string{""}, "", true},
+		{"deflated zip in a folder", "db.zip", []string{"profile/leveldb"}, "", false},
+		{"tar in a folder", "db.tar", []string{"leveldb"}, "", true},
+		{"tar.gz", "db.tar.gz", []string{""}, "", false},
+		{"tgz with a directory picked", "db.tgz", []string{"a", "b/c"}, "b/c", false},
+		{"zip with a directory picked", "db.stored.zip", []string{"a", "b"}, "a", true},
+		{"tar with a slashed directory picked", "db.tar", []string{"a", "b"}, "/b/", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			archive := filepath.Join(t.TempDir(), tt.archive)
+			writeBundle(t, archive, bundleEntries(files, tt.dirs...))
+			p := archive
+			if tt.inner != "" {
+				p += "#" + tt.inner
+			}
+			if !isBundle(p) {
+				t.Fatalf("isBundle(%q) = false", p)
+			}
+			opened, tmp, err := openBundle(p, &opt.Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(tmp)
+			defer opened.Close()
+			if (tmp == "") != tt.inPlace {
+				t.Errorf("temporary directory %q, want read in place %v", tmp, tt.inPlace)
+			}
+			value, err := opened.Get([]byte("key"), nil)
+			if err != nil || string(value) != "value" {
+				t.Errorf("Get = %q, %v, want \"value\"", value, err)
+			}
+			if err := opened.Put([]byte("k"), []byte("v"), nil); err == nil {
+				t.Error("wrote to a database in an archive")
+			}
+		})
+	}
+}
+
+func TestOpenBundleMalformed(t *testing.T) {
+	files := bundleTestFiles(t)
+	badCurrent := bundleEntries(files, "")
+	badCurrent["CURRENT"] = []byte("000005.log\n")
+	tests := []struct {
+		name    string
+		archive string
+		entries map[string][]byte
+		raw     string // Written as the archive instead of entries
+		inner   string
+		want    string
+	}{
+		{"no database", "db.zip", map[string][]byte{"readme.txt": []byte("hi")}, "", "", "holds no LevelDB database"},
+		{"several databases", "db.tar", bundleEntries(files, "a", "b"), "", "", "holds several databases; pick one as <archive>#<directory>: a, b"},
+		{"missing directory", "db.tgz", bundleEntries(files, "a"), "", "b", "no LevelDB database in b; the archive holds a"},
+		{"current not a manifest", "db.tar", badCurrent, "", "", "not a manifest"},
+		{"not a zip", "db.zip", nil, "not a zip file", "", "zip"},
+		{"not gzip", "db.tar.gz", nil, "not gzip", "", "gzip"},
+		{"truncated tar", "db.tar", nil, strings.Repeat("x", 100), "", "unexpected EOF"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			archive := filepath.Join(t.TempDir(), tt.archive)
+			if tt.entries != nil {
+				writeBundle(t, archive, tt.entries)
+			} else if err := os.WriteFile(archive, []byte(tt.raw), 0644); err != nil {
+				t.Fatal(err)
+			}
+			p := archive
+			if tt.inner != "" {
+				p += "#" + tt.inner
+			}
+			opened, tmp, err := openBundle(p, &opt.Options{})
+			if err == nil {
+				opened.Close()
+				os.RemoveAll(tmp)
+				t.Fatalf("opened %s, want an error containing %q", tt.name, tt.want)
+			}
+			if tmp != "" {
+				t.Errorf("temporary directory %q left after an error", tmp)
+			}
+			if !strings.Contains(err.Error(), tt.want) || !strings.HasPrefix(err.Error(), archive+": ") {
+				t.Errorf("error %q, want one naming the archive and containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitBundlePath(t *testing.T) {
+	tests := []struct {
+		path, archive, inner string
+	}{
+		{"db.zip", "db.zip", ""},
+		{"db.zip#Default/leveldb", "db.zip", "Default/leveldb"},
+		{"db.zip#/a/../b/", "db.zip", "b"},
+		{"db.zip#../../etc", "db.zip", "etc"},
+		{"#db.zip", "#db.zip", ""},
+		{"a#b.zip#c", "a#b.zip", "c"},
+	}
+	for _, tt := range tests {
+		if archive, inner := splitBundlePath(tt.path); archive != tt.archive || inner != tt.inner {
+			t.Errorf("splitBundlePath(%q) = %q, %q, want %q, %q", tt.path, archive, inner, tt.archive, tt.inner)
+		}
+	}
+}
+
+func TestBundleEntryPath(t *testing.T) {
+	tests := []struct{ name, want string }{
+		{"db/CURRENT", "db/CURRENT"},
+		{"./db//CURRENT", "db/CURRENT"},
+		{"/abs/CURRENT", "abs/CURRENT"},
+		{"../../etc/passwd", "etc/passwd"},
+		{"a/../../b", "b"},
+	}
+	for _, tt := range tests {
+		if got := bundleEntryPath(tt.name); got != tt.want {
+			t.Errorf("bundleEntryPath(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseStorageName(t *testing.T) {
+	tests := []struct {
+		name string
+		want storage.FileDesc
+		ok   bool
+	}{
+		{"MANIFEST-000005", storage.FileDesc{Type: storage.TypeManifest, Num: 5}, true},
+		{"000007.log", storage.FileDesc{Type: storage.TypeJournal, Num: 7}, true},
+		{"000008.ldb", storage.FileDesc{Type: storage.TypeTable, Num: 8}, true},
+		{"000008.sst", storage.FileDesc{Type: storage.TypeTable, Num: 8}, true},
+		{"000009.tmp", storage.FileDesc{Type: storage.TypeTemp, Num: 9}, true},
+		{"CURRENT", storage.FileDesc{}, false},
+		{"LOG", storage.FileDesc{}, false},
+		{"MANIFEST-x", storage.FileDesc{Type: storage.TypeManifest}, false},
+		{"-1.log", storage.FileDesc{}, false},
+		{"000001.txt", storage.FileDesc{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseStorageName(tt.name)
+			if ok != tt.ok || ok && got != tt.want {
+				t.Errorf("parseStorageName(%q) = %v, %v, want %v, %v", tt.name, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+)
+
+const (
+	prefetchRadius  = 8        // Keys prefetched on each side of the selection
+	cacheMaxEntries = 1024     // LRU limit on cached values
+	cacheMaxBytes   = 32 << 20 // LRU limit on total cached value size
+)
+
+// LRU cache of raw values, shared by the UI and the prefetch worker
+type valueCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	maxBytes   int
+	size       int
+	entries    map[string]*list.Element
+	order      *list.List // Front is most recently used
+}
+
+type cacheEntry struct {
+	key   string
+	value []byte
+}
+
+var (
+	valueLRU         = newValueCache(cacheMaxEntries, cacheMaxBytes)
+	prefetchRequests = make(chan [][]byte, 1) // Latest neighbourhood to prefetch; stale requests are dropped
+)
+
+func newValueCache(maxEntries, maxBytes int) *valueCache {
+	return &valueCache{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+	}
+}
+
+func (c *valueCache) get(key []byte) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[string(key)]; ok {
+		c.order.MoveToFront(elem)
+		return elem.Value.(*cacheEntry).value, true
+	}
+	return nil, false
+}
+
+func (c *valueCache) add(key, value []byte) {
+	if len(value) > c.maxBytes/4 {
+		// A single huge value would evict everything else
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[string(key)]; ok {
+		entry := elem.Value.(*cacheEntry)
+		c.size += len(value) - len(entry.value)
+		entry.value = value
+		c.order.MoveToFront(elem)
+	} else {
+		c.entries[string(key)] = c.order.PushFront(&cacheEntry{key: string(key), value: value})
+		c.size += len(value)
+	}
+
+	for c.order.Len() > c.maxEntries || c.size > c.maxBytes {
+		oldest := c.order.Back()
+		entry := oldest.Value.(*cacheEntry)
+		c.order.Remove(oldest)
+		delete(c.entries, entry.key)
+		c.size -= len(entry.value)
+	}
+}
+
+func (c *valueCache) remove(key []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[string(key)]; ok {
+		c.size -= len(elem.Value.(*cacheEntry).value)
+		c.order.Remove(elem)
+		delete(c.entries, string(key))
+	}
+}
+
+// Change the size limit, evicting the least recently used values beyond it
+func (c *valueCache) resize(maxBytes int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maxBytes = maxBytes
+	for c.size > c.maxBytes {
+		oldest := c.order.Back()
+		entry := oldest.Value.(*cacheEntry)
+		c.order.Remove(oldest)
+		delete(c.entries, entry.key)
+		c.size -= len(entry.value)
+	}
+}
+
+func (c *valueCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]*list.Element)
+	c.order.Init()
+	c.size = 0
+}
+
+// Read-through lookup: serve from the cache, otherwise read the database and remember the result
+func getValue(key []byte) ([]byte, error) {
+	if value, ok := valueLRU.get(key); ok {
+		return value, nil
+	}
+	value, err := browseReader().Get(key, nil)
+	if err != nil {
+		return nil, err
+	}
+	valueLRU.add(key, value)
+	return value, nil
+}
+
+// Ask the prefetch worker to load the keys around index, replacing any request it hasn't started
+func prefetchAround(index int) {
+	start := max(index-prefetchRadius, 0)
+	end := min(index+prefetchRadius+1, len(displayedKeys))
+	if start >= end {
+		return
+	}
+	keys := append([][]byte{}, displayedKeys[start:end]...)
+
+	select {
+	case <-prefetchRequests:
+	default:
+	}
+	select {
+	case prefetchRequests <- keys:
+	default:
+	}
+}
+
+// Background worker filling the cache with neighbouring values; started once from main
+func runPrefetcher() {
+	for keys := range prefetchRequests {
+		for _, key := range keys {
+			if _, ok := valueLRU.get(key); ok {
+				continue
+			}
+			if value, err := browseReader().Get(key, nil); err == nil {
+				valueLRU.add(key, value)
+			}
+		}
+	}
+}
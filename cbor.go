@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const cborMaxDepth = 64
+
+// Reader over one CBOR-encoded value (RFC 8949)
+type cborReader struct {
+	buf []byte
+	pos int
+}
+
+var (
+	errCBORTruncated = errors.New("truncated CBOR data")
+	errCBORBreak     = errors.New("unexpected break")
+)
+
+// Pretty-prints CBOR values as JSON-like text; the value view's "cbor" format
+type cborFormatter struct{}
+
+func (cborFormatter) format(value []byte) string {
+	text, err := decodeCBOR(value)
+	if err != nil {
+		return fmt.Sprintf("(not CBOR: %v)\n\n%s", err, mixedContentDisplay(value))
+	}
+	return text
+}
+
+// Render value, which must hold exactly one CBOR data item
+func decodeCBOR(value []byte) (string, error) {
+	r := &cborReader{buf: value}
+	var out strings.Builder
+	if err := r.render(&out, "", 0); err != nil {
+		return "", err
+	}
+	if r.pos != len(value) {
+		return "", fmt.Errorf("%d bytes after the value", len(value)-r.pos)
+	}
+	return out.String(), nil
+}
+
+// Whether value looks like a CBOR map, array or tagged item: binary, with
+// such a head and parsing to the last byte
+func looksLikeCBOR(value []byte) bool {
+	if len(value) < 2 || isPrintableText(value) {
+		return false
+	}
+	if major := value[0] >> 5; major != 4 && major != 5 && major != 6 {
+		return false
+	}
+	_, err := decodeCBOR(value)
+	return err == nil
+}
+
+func (r *cborReader) take(n uint64) ([]byte, error) {
+	if n > uint64(len(r.buf)-r.pos) {
+		return nil, errCBORTruncated
+	}
+	b := r.buf[r.pos : r.pos+int(n)]
+	r.pos += int(n)
+	return b, nil
+}
+
+// Major type and argument of the next item; indefinite is set for
+// additional information 31, which has no argument
+func (r *cborReader) head() (major byte, arg uint64, indefinite bool, err error) {
+	b, err := r.take(1)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	major, info := b[0]>>5, b[0]&0x1f
+	switch {
+	case info < 24:
+		return major, uint64(info), false, nil
+	case info <= 27:
+		data, err := r.take(1 << (info - 24))
+		if err != nil {
+			return 0, 0, false, err
+		}
+		for _, c := range data {
+			arg = arg<<8 | uint64(c)
+		}
+		return major, arg, false, nil
+	case info == 31:
+		return major, 0, true, nil
+	}
+	return 0, 0, false, fmt.Errorf("reserved additional information %d", info)
+}
+
+// Write the next data item, indenting nested maps and arrays like JSON
+func (r *cborReader) render(out *strings.Builder, indent string, depth int) error {
+	if depth > cborMaxDepth {
+		return errors.New("nesting too deep")
+	}
+	start := r.pos
+	major, arg, indefinite, err := r.head()
+	if err != nil {
+		return err
+	}
+	if indefinite && (major < 2 || major == 6) {
+		return fmt.Errorf("indefinite length on major type %d", major)
+	}
+
+	switch major {
+	case 0:
+		out.WriteString(strconv.FormatUint(arg, 10))
+	case 1:
+		out.WriteString(new(big.Int).Sub(big.NewInt(-1), new(big.Int).SetUint64(arg)).String())
+	case 2, 3:
+		data, err := r.readString(major, arg, indefinite)
+		if err != nil {
+			return err
+		}
+		if major == 2 {
+			out.WriteString("[b64:" + base64.RawStdEncoding.EncodeToString(data) + "]")
+		} else {
+			out.WriteString(quoteJSONString(string(data)))
+		}
+	case 4:
+		return r.renderItems(out, arg, indefinite, false, indent, depth)
+	case 5:
+		return r.renderItems(out, arg, indefinite, true, indent, depth)
+	case 6:
+		return r.renderTag(out, arg, indent, depth)
+	case 7:
+		return r.renderSimple(out, r.buf[start], arg)
+	}
+	return nil
+}
+
+// Byte or text string, joining the chunks of an indefinite-length one
+func (r *cborReader) readString(major byte, length uint64, indefinite bool) ([]byte, error) {
+	if !indefinite {
+		return r.take(length)
+	}
+	var data []byte
+	for {
+		if r.pos < len(r.buf) && r.buf[r.pos] == 0xff {
+			r.pos++
+			return data, nil
+		}
+		chunkMajor, n, chunkIndefinite, err := r.head()
+		if err != nil {
+			return nil, err
+		}
+		if chunkMajor != major || chunkIndefinite {
+			return nil, errors.New("bad chunk in indefinite-length string")
+		}
+		chunk, err := r.take(n)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, chunk...)
+	}
+}
+
+// Array items or map pairs; an indefinite-length container ends at a break byte
+func (r *cborReader) renderItems(out *strings.Builder, n uint64, indefinite, isMap bool, indent string, depth int) error {
+	open, close := "[", "]"
+	if isMap {
+		open, close = "{", "}"
+	}
+	if !indefinite && n > uint64(len(r.buf)-r.pos) { // Every item takes at least one byte
+		return errCBORTruncated
+	}
+	out.WriteString(open)
+	count := uint64(0)
+	for ; indefinite || count < n; count++ {
+		if indefinite {
+			if r.pos >= len(r.buf) {
+				return errCBORTruncated
+			}
+			if r.buf[r.pos] == 0xff {
+				r.pos++
+				break
+			}
+		}
+		if count > 0 {
+			out.WriteString(",")
+		}
+		out.WriteString("\n" + indent + "  ")
+		if err := r.render(out, indent+"  ", depth+1); err != nil {
+			return err
+		}
+		if isMap {
+			out.WriteString(": ")
+			if err := r.render(out, indent+"  ", depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	if count > 0 {
+		out.WriteString("\n" + indent)
+	}
+	out.WriteString(close)
+	return nil
+}
+
+// Tagged item: dates and bignums are shown as such, other tags by number
+func (r *cborReader) renderTag(out *strings.Builder, tag uint64, indent string, depth int) error {
+	switch tag {
+	case 55799: // Self-described CBOR marker
+		return r.render(out, indent, depth+1)
+	case 1: // Epoch time
+		var inner strings.Builder
+		if err := r.render(&inner, indent, depth+1); err != nil {
+			return err
+		}
+		if seconds, err := strconv.ParseFloat(inner.String(), 64); err == nil {
+			whole, frac := math.Modf(seconds)
+			t := time.Unix(int64(whole), int64(frac*1e9)).UTC()
+			out.WriteString(quoteJSONString(t.Format(time.RFC3339Nano)))
+			return nil
+		}
+		out.WriteString("tag(1, " + inner.String() + ")")
+		return nil
+	case 2, 3: // Bignums
+		major, n, indefinite, err := r.head()
+		if err != nil {
+			return err
+		}
+		if major != 2 {
+			return errors.New("bignum tag on a non-byte-string")
+		}
+		data, err := r.readString(major, n, indefinite)
+		if err != nil {
+			return err
+		}
+		v := new(big.Int).SetBytes(data)
+		if tag == 3 {
+			v.Sub(big.NewInt(-1), v)
+		}
+		out.WriteString(v.String())
+		return nil
+	case 42: // IPLD link: a CID after a 0x00 multibase prefix, shown as dag-json does
+		major, n, indefinite, err := r.head()
+		if err != nil {
+			return err
+		}
+		if major != 2 {
+			return errors.New("CID tag on a non-byte-string")
+		}
+		data, err := r.readString(major, n, indefinite)
+		if err != nil {
+			return err
+		}
+		if cid, ok := formatCID(bytes.TrimPrefix(data, []byte{0})); ok && len(data) > 0 && data[0] == 0 {
+			out.WriteString(`{"/": ` + quoteJSONString(cid) + "}")
+			return nil
+		}
+		out.WriteString("tag(42, " + quoteJSONString("0x"+hex.EncodeToString(data)) + ")")
+		return nil
+	}
+	fmt.Fprintf(out, "tag(%d, ", tag)
+	if err := r.render(out, indent, depth+1); err != nil {
+		return err
+	}
+	out.WriteString(")")
+	return nil
+}
+
+// Major type 7: booleans, null, undefined, floats and other simple values
+func (r *cborReader) renderSimple(out *strings.Builder, initial byte, arg uint64) error {
+	switch info := initial & 0x1f; {
+	case info == 25:
+		out.WriteString(strconv.FormatFloat(halfToFloat(uint16(arg)), 'g', -1, 32))
+	case info == 26:
+		out.WriteString(strconv.FormatFloat(float64(math.Float32frombits(uint32(arg))), 'g', -1, 32))
+	case info == 27:
+		out.WriteString(strconv.FormatFloat(math.Float64frombits(arg), 'g', -1, 64))
+	case info == 31:
+		return errCBORBreak
+	case arg == 20:
+		out.WriteString("false")
+	case arg == 21:
+		out.WriteString("true")
+	case arg == 22:
+		out.WriteString("null")
+	case arg == 23:
+		out.WriteString("undefined")
+	default:
+		fmt.Fprintf(out, "simple(%d)", arg)
+	}
+	return nil
+}
+
+// IEEE 754 half-precision float
+func halfToFloat(h uint16) float64 {
+	exp, mant := int(h>>10&0x1f), float64(h&0x3ff)
+	var v float64
+	switch exp {
+	case 0:
+		v = math.Ldexp(mant, -24)
+	case 31:
+		v = math.Inf(1)
+		if mant != 0 {
+			v = math.NaN()
+		}
+	default:
+		v = math.Ldexp(mant+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		v = -v
+	}
+	return v
+}
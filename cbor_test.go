@@ -0,0 +1,116 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDecodeCBOR(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{"small uint", "\x17", "23"},
+		{"uint64", "\x1b\xff\xff\xff\xff\xff\xff\xff\xff", "18446744073709551615"},
+		{"negative", "\x38\x63", "-100"},
+		{"most negative", "\x3b\xff\xff\xff\xff\xff\xff\xff\xff", "-18446744073709551616"},
+		{"byte string", "\x43\x00\x01\x02", "[b64:AAEC]"},
+		{"text string", "\x63a\"b", `"a\"b"`},
+		{"indefinite text", "\x7f\x62ab\x61c\xff", `"abc"`},
+		{"array", "\x83\x01\x02\x03", "[\n  1,\n  2,\n  3\n]"},
+		{"empty containers", "\x82\x80\xa0", "[\n  [],\n  {}\n]"},
+		{"map", "\xa2\x61a\x01\x61b\x82\x02\x03", "{\n  \"a\": 1,\n  \"b\": [\n    2,\n    3\n  ]\n}"},
+		{"indefinite array", "\x9f\x01\x02\xff", "[\n  1,\n  2\n]"},
+		{"indefinite map", "\xbf\x61a\xf5\xff", "{\n  \"a\": true\n}"},
+		{"simple values", "\x84\xf4\xf5\xf6\xf7", "[\n  false,\n  true,\n  null,\n  undefined\n]"},
+		{"other simple value", "\xf8\x20", "simple(32)"},
+		{"half float", "\xf9\x3e\x00", "1.5"},
+		{"half infinity", "\xf9\x7c\x00", "+Inf"},
+		{"float32", "\xfa\x47\xc3\x50\x00", "100000"},
+		{"float64", "\xfb\x3f\xf1\x99\x99\x99\x99\x99\x9a", "1.1"},
+		{"epoch time", "\xc1\x1a\x51\x4b\x67\xb0", `"2013-03-21T20:04:00Z"`},
+		{"epoch time as float", "\xc1\xfb\x41\xd4\x52\xd9\xec\x20\x00\x00", `"2013-03-21T20:04:00.5Z"`},
+		{"bignum", "\xc2\x49\x01\x00\x00\x00\x00\x00\x00\x00\x00", "18446744073709551616"},
+		{"negative bignum", "\xc3\x49\x01\x00\x00\x00\x00\x00\x00\x00\x00", "-18446744073709551617"},
+		{"self-described", "\xd9\xd9\xf7\x01", "1"},
+		{"other tag", "\xd8\x20\x63abc", `tag(32, "abc")`},
+		{"cid tag without multibase prefix", "\xd8\x2a\x42\x01\x02", `tag(42, "0x0102")`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeCBOR([]byte(tt.value))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("decodeCBOR(%x) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeCBORMalformed(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{"empty", "", "truncated"},
+		{"reserved additional information", "\x1c", "reserved additional information 28"},
+		{"truncated argument", "\x19\x01", "truncated"},
+		{"truncated string", "\x65ab", "truncated"},
+		{"huge string", "\x5b\xff\xff\xff\xff\xff\xff\xff\xff", "truncated"},
+		{"huge array", "\x9b\xff\xff\xff\xff\xff\xff\xff\xff\x01", "truncated"},
+		{"huge map", "\xbb\x7f\xff\xff\xff\xff\xff\xff\xff\x01", "truncated"},
+		{"indefinite integer", "\x1f", "indefinite length on major type 0"},
+		{"indefinite tag", "\xdf\x01", "indefinite length on major type 6"},
+		{"unterminated indefinite array", "\x9f\x01", "truncated"},
+		{"unterminated indefinite string", "\x7f\x61a", "truncated"},
+		{"bad string chunk", "\x7f\x01\xff", "bad chunk"},
+		{"nested indefinite chunk", "\x5f\x5f\xff\xff", "bad chunk"},
+		{"stray break", "\xff", "unexpected break"},
+		{"break as map value", "\xbf\x61a\xff", "unexpected break"},
+		{"bignum on integer", "\xc2\x01", "non-byte-string"},
+		{"cid on integer", "\xd8\x2a\x01", "non-byte-string"},
+		{"map missing value", "\xa1\x01", "truncated"},
+		{"trailing bytes", "\x01\x02", "1 bytes after the value"},
+		{"nesting too deep", strings.Repeat("\x81", cborMaxDepth+2) + "\x01", "too deep"},
+		{"tags too deep", strings.Repeat("\xd8\x20", cborMaxDepth+2) + "\x01", "too deep"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeCBOR([]byte(tt.value))
+			if err == nil {
+				t.Fatalf("decodeCBOR(%x) = %q, want an error containing %q", tt.value, got, tt.want)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error %q, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLooksLikeCBOR(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  bool
+	}{
+		{"map", "\xa1\x61a\x01", true},
+		{"array", "\x82\x01\x02", true},
+		{"tagged", "\xc1\x1a\x51\x4b\x67\xb0", true},
+		{"integer", "\x19\x01\x02", false},
+		{"text", "hello", false},
+		{"too short", "\x80", false},
+		{"truncated array", "\x83\x01\x02", false},
+		{"trailing bytes", "\x81\x01\x02", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := looksLikeCBOR([]byte(tt.value)); got != tt.want {
+				t.Errorf("looksLikeCBOR(%x) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// Text stored in a legacy charset is not UTF-8, so it renders as base64
+// runs. The charset picked with -charset or $ is tried on such values by
+// the decoder chain, and "charset:<name>" mappings in the config file
+// decode the values of some keys with one charset.
+
+var charsets = []struct {
+	name string
+	enc  encoding.Encoding
+}{
+	{"shift-jis", japanese.ShiftJIS},
+	{"gbk", simplifiedchinese.GBK},
+	{"windows-1251", charmap.Windows1251},
+	{"latin-1", charmap.ISO8859_1},
+}
+
+var valueCharset string // -charset, cycled with $: tried on values that are not UTF-8, "" for none
+
+func lookupCharset(name string) (encoding.Encoding, error) {
+	names := make([]string, len(charsets))
+	for i, c := range charsets {
+		if strings.EqualFold(c.name, name) {
+			return c.enc, nil
+		}
+		names[i] = c.name
+	}
+	return nil, fmt.Errorf("unknown charset %q, want one of %s", name, strings.Join(names, ", "))
+}
+
+// Value converted to UTF-8 text; ok is false when it has bytes the charset
+// does not map or control characters, as binary data would
+func decodeCharset(enc encoding.Encoding, value []byte) (text []byte, ok bool) {
+	text, err := enc.NewDecoder().Bytes(value)
+	if err != nil {
+		return nil, false
+	}
+	return text, !bytes.ContainsRune(text, utf8.RuneError) && isPrintableText(text)
+}
+
+// Values that are not UTF-8 but are clean text in the picked charset
+func decodeCharsetStage(key, value []byte) (string, int) {
+	if valueCharset == "" || utf8.Valid(value) {
+		return "", 0
+	}
+	enc, err := lookupCharset(valueCharset)
+	if err != nil {
+		return "", 0
+	}
+	if text, ok := decodeCharset(enc, value); ok {
+		return defaultFormatter{}.format(text), 75
+	}
+	return "", 0
+}
+
+// Cycle the charset tried on values that are not UTF-8 between none and
+// each charset, and redraw the selection
+func cycleCharset() {
+	next := 0
+	for i, c := range charsets {
+		if c.name == valueCharset {
+			next = i + 1
+		}
+	}
+	valueCharset = ""
+	if next < len(charsets) {
+		valueCharset = charsets[next].name
+	}
+	if currentKey != nil {
+		showKeyValue(currentKey)
+	}
+	if valueCharset == "" {
+		setStatus("[green]Charset: none (values that are not UTF-8 are shown as base64)")
+		return
+	}
+	setStatus(fmt.Sprintf("[green]Charset: %s [gray](tried by the auto value format on values that are not UTF-8)[-]", valueCharset))
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"strings"
+)
+
+// Content identifiers, multihashes and multiaddrs of IPFS and libp2p.
+// CIDv0 (a bare SHA-256 multihash) is shown in base58btc as Qm..., CIDv1
+// in lower-case base32 as b..., and peer IDs in base58btc.
+
+var base32Lower = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+var errBadMultihash = errors.New("bad multihash")
+
+// Names of multihash functions, for labels
+var multihashNames = map[uint64]string{
+	0x00: "identity", 0x11: "sha1", 0x12: "sha2-256", 0x13: "sha2-512", 0x14: "sha3-512", 0x16: "sha3-256",
+	0x1b: "keccak-256", 0x1e: "blake3", 0xb220: "blake2b-256", 0xb260: "blake2s-256",
+}
+
+// Names of the IPLD codecs of CIDv1
+var cidCodecNames = map[uint64]string{
+	0x55: "raw", 0x70: "dag-pb", 0x71: "dag-cbor", 0x72: "libp2p-key", 0x78: "git-raw",
+	0x90: "eth-block", 0x0129: "dag-json", 0x0200: "json",
+}
+
+// Split a multihash off b: its function code and digest
+func cutMultihash(b []byte) (code uint64, digest, rest []byte, err error) {
+	code, n := binary.Uvarint(b)
+	if n <= 0 {
+		return 0, nil, nil, errBadMultihash
+	}
+	size, m := binary.Uvarint(b[n:])
+	if m <= 0 || size > uint64(len(b)-n-m) {
+		return 0, nil, nil, errBadMultihash
+	}
+	start := n + m
+	return code, b[start : start+int(size)], b[start+int(size):], nil
+}
+
+// Whether b is exactly one multihash whose digest fits its function
+func isMultihash(b []byte) bool {
+	code, digest, rest, err := cutMultihash(b)
+	if err != nil || len(rest) > 0 {
+		return false
+	}
+	switch code {
+	case 0x12, 0x16, 0x1b, 0xb220, 0xb260:
+		return len(digest) == 32
+	case 0x13, 0x14:
+		return len(digest) == 64
+	case 0x11:
+		return len(digest) == 20
+	}
+	_, known := multihashNames[code]
+	return known
+}
+
+// Text form of a binary CID; false when b is not one
+func formatCID(b []byte) (string, bool) {
+	if len(b) == 34 && b[0] == 0x12 && b[1] == 0x20 {
+		return base58Encode(b), true // CIDv0
+	}
+	version, n := binary.Uvarint(b)
+	if n <= 0 || version != 1 {
+		return "", false
+	}
+	_, m := binary.Uvarint(b[n:])
+	if m <= 0 || !isMultihash(b[n+m:]) {
+		return "", false
+	}
+	return "b" + base32Lower.EncodeToString(b), true
+}
+
+// CIDv1 of a block stored by its multihash alone, as raw data, which is
+// how Kubo lists the blocks it holds
+func rawBlockCID(multihash []byte) string {
+	return "b" + base32Lower.EncodeToString(append([]byte{0x01, 0x55}, multihash...))
+}
+
+// Peer IDs are multihashes of the peer's public key, shown in base58btc
+func formatPeerID(b []byte) string {
+	return base58Encode(b)
+}
+
+func base58Encode(b []byte) string {
+	const alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+	n := new(big.Int).SetBytes(b)
+	radix, mod := big.NewInt(58), new(big.Int)
+	var out []byte
+	for n.Sign() > 0 {
+		n.DivMod(n, radix, mod)
+		out = append(out, alphabet[mod.Int64()])
+	}
+	for _, c := range b {
+		if c != 0 {
+			break
+		}
+		out = append(out, '1')
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
+
+// Multiaddr protocols: name and address size in bytes, -1 when the
+// address is length-prefixed, 0 when there is none
+var multiaddrProtocols = map[uint64]struct {
+	name string
+	size int
+}{
+	4: {"ip4", 4}, 6: {"tcp", 2}, 33: {"dccp", 2}, 41: {"ip6", 16}, 42: {"ip6zone", -1}, 53: {"dns", -1},
+	54: {"dns4", -1}, 55: {"dns6", -1}, 56: {"dnsaddr", -1}, 132: {"sctp", 2}, 273: {"udp", 2},
+	280: {"webrtc-direct", 0}, 281: {"webrtc", 0}, 290: {"p2p-circuit", 0}, 400: {"unix", -1}, 421: {"p2p", -1},
+	443: {"https", 0}, 445: {"onion3", 37}, 448: {"tls", 0}, 449: {"sni", -1}, 454: {"noise", 0}, 460: {"quic", 0},
+	461: {"quic-v1", 0}, 465: {"webtransport", 0}, 466: {"certhash", -1}, 477: {"ws", 0}, 478: {"wss", 0}, 480: {"http", 0},
+}
+
+// Text form of a binary multiaddr, e.g. /ip4/127.0.0.1/tcp/4001
+func formatMultiaddr(b []byte) (string, error) {
+	var out strings.Builder
+	for len(b) > 0 {
+		code, n := binary.Uvarint(b)
+		if n <= 0 {
+			return "", errors.New("bad multiaddr")
+		}
+		b = b[n:]
+		proto, ok := multiaddrProtocols[code]
+		if !ok {
+			return "", fmt.Errorf("unknown multiaddr protocol %d", code)
+		}
+		out.WriteString("/" + proto.name)
+		size := proto.size
+		if size < 0 {
+			length, m := binary.Uvarint(b)
+			if m <= 0 || length > uint64(len(b)-m) {
+				return "", errors.New("truncated multiaddr")
+			}
+			size, b = int(length), b[m:]
+		}
+		if size > len(b) {
+			return "", errors.New("truncated multiaddr")
+		}
+		addr := b[:size]
+		b = b[size:]
+		switch proto.name {
+		case "ip4", "ip6":
+			out.WriteString("/" + net.IP(addr).String())
+		case "tcp", "udp", "dccp", "sctp":
+			fmt.Fprintf(&out, "/%d", binary.BigEndian.Uint16(addr))
+		case "p2p":
+			out.WriteString("/" + formatPeerID(addr))
+		case "certhash":
+			out.WriteString("/u" + base64.RawURLEncoding.EncodeToString(addr))
+		case "onion3":
+			fmt.Fprintf(&out, "/%s:%d", base32Lower.EncodeToString(addr[:35]), binary.BigEndian.Uint16(addr[35:]))
+		default:
+			if size > 0 {
+				out.WriteString("/" + string(addr))
+			}
+		}
+	}
+	return out.String(), nil
+}
@@ -0,0 +1,1045 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+const deleteBatchSize = 10000 // Deletes per write batch
+
+// Repeatable string flag
+type stringList []string
+
+func (l *stringList) String() string     { return strings.Join(*l, ",") }
+func (l *stringList) Set(v string) error { *l = append(*l, v); return nil }
+
+// Commands that open the -db database themselves, given only its path
+var selfOpeningCommands = map[string]bool{"replicate": true}
+
+// Commands that need no database
+var databaselessCommands = map[string]bool{"version": true, "self-update": true}
+
+// Headless subcommands, run as: leveldb-viewer -db <path> <command> [args].
+// Each returns the process exit code.
+//
+// A command returning continueToViewer goes on to run the viewer, as serve -tui does.
+const continueToViewer = -1
+
+var commands = map[string]func(args []string) int{
+	"exists":       cmdExists,
+	"export":       cmdExport,
+	"import":       cmdImport,
+	"convert":      cmdConvert,
+	"backup":       cmdBackup,
+	"mget":         cmdMget,
+	"restore":      cmdRestore,
+	"delete-range": cmdDeleteRange,
+	"replay":       cmdReplay,
+	"report":       cmdReport,
+	"render":       cmdRender,
+	"schedule":     cmdSchedule,
+	"get":          cmdGet,
+	"put":          cmdPut,
+	"del":          cmdDel,
+	"diff":         cmdDiff,
+	"merge3":       cmdMerge3,
+	"merge":        cmdMerge,
+	"serve":        cmdServe,
+	"replicate":    cmdReplicate,
+	"scan":         cmdScan,
+	"search":       cmdSearch,
+	"timeline":     cmdTimeline,
+	"version":      cmdVersion,
+	"self-update":  cmdSelfUpdate,
+}
+
+// Arguments and description of each subcommand, printed by -h
+var commandUsage = map[string][2]string{
+	"exists":       {"[-q] <key>", "Exit 0 if the key exists, 1 if not; prints its value size"},
+	"export":       {"[-dir d] [-format text|ndjson|dedup|csv|resp] [-csv-delimiter c] [-csv-escape quote|backslash] [-csv-values] [-csv-sizes] [-split-prefix sep] [-max-size MB] [-search text] [-transform-cmd cmd] [-no-transform] [-verify]", "Export all keys or those matching a search, optionally sharded, transformed and verified"},
+	"import":       {"[-format ndjson|dedup|csv|rdb|aof|resp] [-batch n] [-namespace p] [-redis-db n] [-keep-expired] [-conflicts] [-dir d] [-csv-delimiter c] [-csv-escape quote|backslash] <file|manifest>...", "Write the records of NDJSON or CSV exports, or Redis string keys, into the database in batches"},
+	"backup":       {"[-compression snappy|none] [-batch n] [-verify] <out>", "Copy the database as of one snapshot into a new database, consistent even while it is written to"},
+	"convert":      {"[-from leveldb] [-to engine] [-option k=v]... [-batch n] [-verify] <out>", "Stream the database into a new database of another engine"},
+	"mget":         {"[key...]", "Look up many keys (or one per stdin line) as NDJSON"},
+	"restore":      {"-from <archive> [-key k]... [-prefix p]... [-all] [-dry-run] [-verify]", "Restore selected keys, or rebuild the whole database with -all, from a backup or export, previewing changes"},
+	"delete-range": {"-start <key> -end <key> [-compact] [-dry-run]", "Delete keys in [start, end) and report what was removed"},
+	"replay":       {"<session.json>", "Re-run a session recorded with -record against this database"},
+	"report":       {"[-format md|html] [-dir d] [-key k]...", "Write a findings report of noted keys and the given keys"},
+	"render":       {"[-format html|md] [-dir d] [-view format] <key>", "Write a key's value, decoded as the viewer shows it, to a standalone HTML or Markdown file"},
+	"schedule":     {"[-now]", "Run the exports and stats snapshots of the config file's schedule until interrupted"},
+	"get":          {"[-pretty] [-b64] <key>", "Print a value; exit 1 if the key does not exist"},
+	"put":          {"[-b64] <key> [value]", "Write a value, read from stdin when not given"},
+	"del":          {"<key>...", "Delete keys"},
+	"replicate":    {"[-interval d] [-once] [-fast] [-workers n] <target db>", "Keep a target database in sync with this one, applying what changed every interval until interrupted; reads a copy when the source is locked"},
+	"merge3":       {"-base <export|backup> [-apply] [-dir d] <theirs db>", "Three-way merge another database that drifted from the same base into this one; writes a plan listing conflicts, exit 1 when there are any"},
+	"serve":        {"[-addr host:port] [-token t] [-read-token t] [-token-file f] [-basic-auth user:pass[:caps]] [-tls-cert f -tls-key f] [-idle-timeout d] [-export-dir d] [-export-keep d] [-tui [-tui-host-access] [-xterm-cdn url]]", "Serve a JSON API over the database to authenticated clients, each with its capabilities, until interrupted; -tui also runs the viewer in the browser at /tui"},
+	"merge":        {"[-on-conflict skip|overwrite|fail] [-dry-run] [-values] <source db>", "Write the keys of another database into this one; keys with different values are conflicts, kept, overwritten or failing the merge (the default); exit 1 on conflicts with -dry-run or fail"},
+	"diff":         {"[-fast] [-workers n] [-limit n] [-values] <other db>", "List keys only in this database (-), only in the other (+) or with different values (~); exit 1 on any difference"},
+	"scan":         {"[-prefix p] [-start k] [-end k] [-query q] [-limit n] [-keys-only] [-json]", "Print keys and values in order, one per line"},
+	"search":       {"[-in db]... [-limit n] <text>", "Search keys in this and other databases concurrently, grouped by database"},
+	"timeline":     {"[-bucket auto|hour|day|week|month] [-width n] [-local] [search]", "Chart how many matching keys were written per hour, day, week or month, by the timestamp in each key"},
+	"version":      {"[-json]", "Print the version, commit and Go version of this build; needs no -db"},
+	"self-update":  {"[-check] [-version tag] [-force] [-repo owner/name] [-api url] [-send-token]", "Replace this binary with the latest GitHub release built for this OS and architecture, checked against the release's checksums; needs no -db"},
+}
+
+func printUsage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s -db <path> [command] [args]\n\n", os.Args[0])
+	fmt.Fprintln(out, "Without a command the interactive viewer starts.")
+	fmt.Fprintln(out, "\nFlags:")
+	flag.PrintDefaults()
+	fmt.Fprintln(out, "\nCommands:")
+	names := make([]string, 0, len(commandUsage))
+	for name := range commandUsage {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(out, "  %s %s\n    \t%s\n", name, commandUsage[name][0], commandUsage[name][1])
+	}
+}
+
+// Print a subcommand's synopsis after an argument error
+func commandError(name string) int {
+	db := "-db <path> "
+	if databaselessCommands[name] {
+		db = ""
+	}
+	fmt.Fprintf(os.Stderr, "usage: %s %s%s %s\n", os.Args[0], db, name, commandUsage[name][0])
+	return 2
+}
+
+// Report whether key exists and the size of its value, without copying the value;
+// the viewer reads its pinned snapshot
+func probeKey(key []byte) (found bool, size int, err error) {
+	iter := browseReader().NewIterator(nil, nil)
+	defer iter.Release()
+
+	if iter.Seek(key) && bytes.Equal(iter.Key(), key) {
+		return true, len(iter.Value()), iter.Error()
+	}
+	return false, 0, iter.Error()
+}
+
+func cmdExists(args []string) int {
+	fs := flag.NewFlagSet("exists", flag.ExitOnError)
+	quiet := fs.Bool("q", false, "Print nothing, only set the exit code")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return commandError("exists")
+	}
+	key := []byte(fs.Arg(0))
+
+	found, size, err := probeKey(key)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	if !found {
+		if !*quiet {
+			fmt.Printf("%s: not found\n", fs.Arg(0))
+		}
+		return 1
+	}
+	if !*quiet {
+		fmt.Printf("%s: found (%d bytes)\n", fs.Arg(0), size)
+	}
+	return 0
+}
+
+// One NDJSON line of mget output
+type mgetResult struct {
+	Key      string `json:"key"`
+	KeyB64   string `json:"key_b64,omitempty"` // Exact key bytes, from scan when the key is not valid UTF-8
+	Found    bool   `json:"found"`
+	Size     int    `json:"size,omitempty"`
+	Value    string `json:"value,omitempty"`     // Best-effort text rendering
+	ValueB64 string `json:"value_b64,omitempty"` // Exact bytes
+	Error    string `json:"error,omitempty"`
+}
+
+func cmdMget(args []string) int {
+	fs := flag.NewFlagSet("mget", flag.ExitOnError)
+	fs.Parse(args)
+
+	keys := fs.Args()
+	if len(keys) == 0 {
+		scanner := bufio.NewScanner(os.Stdin)
+		scanner.Buffer(make([]byte, 64*1024), 16<<20)
+		for scanner.Scan() {
+			if line := scanner.Text(); line != "" {
+				keys = append(keys, line)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading stdin: %v\n", err)
+			return 2
+		}
+	}
+
+	// One snapshot so every key is read at the same point in time
+	snap, err := db.snapshot()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	defer snap.Release()
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	encoder := json.NewEncoder(out)
+
+	code := 0
+	for _, key := range keys {
+		result := mgetResult{Key: key}
+		value, err := snap.Get([]byte(key), nil)
+		switch {
+		case err == leveldb.ErrNotFound:
+			code = max(code, 1)
+		case err != nil:
+			result.Error = err.Error()
+			code = 2
+		default:
+			result.Found = true
+			result.Size = len(value)
+			result.Value = mixedContentDisplay(value)
+			result.ValueB64 = base64.StdEncoding.EncodeToString(value)
+		}
+		if err := encoder.Encode(result); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 2
+		}
+	}
+	return code
+}
+
+func cmdDeleteRange(args []string) int {
+	fs := flag.NewFlagSet("delete-range", flag.ExitOnError)
+	start := fs.String("start", "", "First key to delete (inclusive); empty means the beginning")
+	end := fs.String("end", "", "Key to stop at (exclusive); empty means the end")
+	compact := fs.Bool("compact", false, "Compact the range afterwards to reclaim disk space")
+	dryRun := fs.Bool("dry-run", false, "Only report what would be deleted")
+	fs.Parse(args)
+	if readOnly && !*dryRun {
+		fmt.Fprintln(os.Stderr, "Database is open read-only: use -dry-run")
+		return 2
+	}
+	if *start == "" && *end == "" {
+		fmt.Fprintln(os.Stderr, "Refusing to delete the whole database: give -start and/or -end")
+		return 2
+	}
+
+	r := util.Range{}
+	if *start != "" {
+		r.Start = []byte(*start)
+	}
+	if *end != "" {
+		r.Limit = []byte(*end)
+	}
+
+	sizes, err := db.SizeOf([]util.Range{r})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+
+	deleted, logical, err := deleteRange(&r, *dryRun)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error after %d keys: %v\n", deleted, err)
+		return 2
+	}
+
+	verb := "Deleted"
+	if *dryRun {
+		verb = "Would delete"
+	}
+	fmt.Printf("%s %d keys (%d bytes of keys and values, ~%d bytes on disk)\n", verb, deleted, logical, sizes.Sum())
+
+	if *compact && !*dryRun && deleted > 0 {
+		fmt.Println("Compacting range...")
+		if err := db.CompactRange(r); err != nil {
+			fmt.Fprintf(os.Stderr, "Error compacting: %v\n", err)
+			return 2
+		}
+		after, err := db.SizeOf([]util.Range{r})
+		if err == nil {
+			fmt.Printf("Compaction finished, range now ~%d bytes on disk\n", after.Sum())
+		}
+	}
+	return 0
+}
+
+// Delete every key in r with batched writes, returning the number of keys and their key+value bytes
+func deleteRange(r *util.Range, dryRun bool) (int, int64, error) {
+	iter := db.NewIterator(r, scanReadOptions)
+	defer iter.Release()
+
+	batch := new(leveldb.Batch)
+	count := 0
+	var logical int64
+	for iter.Next() {
+		count++
+		logical += int64(len(iter.Key()) + len(iter.Value()))
+		if dryRun {
+			continue
+		}
+		batch.Delete(iter.Key())
+		if batch.Len() >= deleteBatchSize {
+			if err := db.Write(batch, nil); err != nil {
+				return count - batch.Len(), logical, err
+			}
+			batch.Reset()
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return count, logical, err
+	}
+	if batch.Len() > 0 {
+		if err := db.Write(batch, nil); err != nil {
+			return count - batch.Len(), logical, err
+		}
+	}
+	return count, logical, nil
+}
+
+func cmdExport(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	dir := fs.String("dir", dumpDir, "Output directory")
+	splitPrefix := fs.String("split-prefix", "", "Write one file per key prefix ending at this separator, e.g. \":\"")
+	maxSize := fs.Int64("max-size", 0, "Start a new file after this many MB")
+	transformCmd := fs.String("transform-cmd", "", "Filter every record through this command (see readme)")
+	noTransform := fs.Bool("no-transform", false, "Ignore transforms from the config file")
+	format := fs.String("format", "text", "Output format: text, ndjson (one JSON object per key with exact base64 bytes), dedup (each distinct value once, keys naming its SHA-256), csv or resp (Redis SET commands for redis-cli --pipe)")
+	csvDelimiter := fs.String("csv-delimiter", cfg.Export.CSV.Delimiter, "CSV field delimiter, one character or \\t (default \",\")")
+	csvEscape := fs.String("csv-escape", cfg.Export.CSV.Escape, "CSV escaping: quote (RFC 4180) or backslash")
+	csvValues := fs.Bool("csv-values", cfg.Export.CSV.Values, "Add a value column to CSV exports")
+	csvSizes := fs.Bool("csv-sizes", cfg.Export.CSV.Sizes, "Add a value size column to CSV exports")
+	verify := fs.Bool("verify", false, "Re-read the export and the database and compare digests, writing a .verify.json report")
+	search := fs.String("search", "", "Only export keys matching this search (case-insensitive, keys and notes, or re:<regular expression>), as in the viewer")
+	fs.Parse(args)
+	if *verify && *format == "csv" {
+		fmt.Fprintln(os.Stderr, "CSV exports cannot be verified, use text or NDJSON")
+		return 2
+	}
+
+	opts := exportOptions{
+		dir:              *dir,
+		splitPrefix:      *splitPrefix,
+		maxFileSize:      *maxSize << 20,
+		transformCommand: *transformCmd,
+		noTransform:      *noTransform,
+		format:           *format,
+		search:           *search,
+		csv:              csvConfig{Delimiter: *csvDelimiter, Escape: *csvEscape, Values: *csvValues, Sizes: *csvSizes},
+	}
+	handleShutdownSignals(func() {})
+	path, count, err := exportDatabase(opts, func(detail string) {
+		fmt.Fprintf(os.Stderr, "\r%s", detail)
+	})
+	if count >= 10000 {
+		fmt.Fprintln(os.Stderr)
+	}
+	if errors.Is(err, errInterrupted) {
+		fmt.Fprintf(os.Stderr, "Interrupted after %d keys; removed the partial export\n", count)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	fmt.Printf("Exported %d keys to %s\n", count, path)
+	if !*verify {
+		return 0
+	}
+
+	report, err := verifyExport(path, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error verifying: %v\n", err)
+		return 2
+	}
+	reportPath, err := writeVerifyReport(report, path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing report: %v\n", err)
+		return 2
+	}
+	fmt.Printf("%s; report in %s\n", report.summary(), reportPath)
+	if !report.ok() {
+		return 1
+	}
+	return 0
+}
+
+func cmdImport(args []string) int {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	format := fs.String("format", "", "Input format: ndjson, dedup, csv, rdb, aof or resp (default: from the file extension)")
+	batchSize := fs.Int("batch", 1000, "Records written per batch")
+	csvDelimiter := fs.String("csv-delimiter", cfg.Export.CSV.Delimiter, "CSV field delimiter, one character or \\t (default \",\")")
+	csvEscape := fs.String("csv-escape", cfg.Export.CSV.Escape, "CSV escaping: quote (RFC 4180) or backslash")
+	namespace := fs.String("namespace", "", "Prefix added to every imported key, e.g. \"redis:\"")
+	redisDB := fs.Int("redis-db", -1, "Only import this Redis database number from RDB/AOF files (default: all)")
+	keepExpired := fs.Bool("keep-expired", false, "Also import RDB keys whose TTL has already passed")
+	conflicts := fs.Bool("conflicts", false, "Leave existing keys whose value would change as they are and write them to a merge plan to resolve in the viewer")
+	dir := fs.String("dir", dumpDir, "Directory for the merge plan of -conflicts")
+	fs.Parse(args)
+	if fs.NArg() == 0 || *batchSize < 1 {
+		return commandError("import")
+	}
+	if readOnly {
+		fmt.Fprintln(os.Stderr, "Database is open read-only")
+		return 2
+	}
+
+	opts := importOptions{
+		format:    *format,
+		csv:       csvConfig{Delimiter: *csvDelimiter, Escape: *csvEscape},
+		batchSize: *batchSize,
+
+		namespace:   *namespace,
+		redisDB:     *redisDB,
+		keepExpired: *keepExpired,
+		redis:       &redisStats{},
+	}
+	var held []mergeEntry
+	if *conflicts {
+		opts.conflicts = &held
+	}
+	count, err := importFiles(fs.Args(), opts, func(detail string) {
+		fmt.Fprintf(os.Stderr, "\r%s", detail)
+	})
+	if count > 0 {
+		fmt.Fprintln(os.Stderr)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error after %d keys: %v\n", count, err)
+		return 2
+	}
+	fmt.Printf("Imported %d keys\n", count)
+	if stats := opts.redis; stats.strings > 0 || stats.deletes > 0 || stats.expired > 0 || len(stats.skipped) > 0 {
+		fmt.Printf("Redis: %d string keys, %d deletes, %d expired keys left out\n", stats.strings, stats.deletes, stats.expired)
+		if len(stats.skipped) > 0 {
+			fmt.Printf("Skipped (only strings are imported): %s\n", stats.skippedSummary())
+		}
+	}
+	if len(held) > 0 {
+		plan := &mergePlan{Created: time.Now(), Ours: dbPath, Theirs: strings.Join(fs.Args(), ", "), Conflicts: held}
+		path, err := writeMergePlan(plan, *dir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 2
+		}
+		fmt.Printf("Left %d existing keys unchanged as conflicts; resolve them with: %s -db %s -cmd 'conflicts %s'\n", len(held), os.Args[0], dbPath, path)
+		return 1
+	}
+	return 0
+}
+
+func cmdConvert(args []string) int {
+	fs := flag.NewFlagSet("convert", flag.ExitOnError)
+	from := fs.String("from", "leveldb", "Engine of the -db database")
+	to := fs.String("to", "leveldb", "Engine to write: "+engineNames())
+	var options stringList
+	fs.Var(&options, "option", "Target engine option as key=value (repeatable), e.g. compression=none for leveldb")
+	batchSize := fs.Int("batch", 1000, "Records written per batch")
+	verify := fs.Bool("verify", false, "Re-read both databases and compare digests, writing a .verify.json report")
+	fs.Parse(args)
+	if fs.NArg() != 1 || *batchSize < 1 {
+		return commandError("convert")
+	}
+	if *from != "leveldb" {
+		fmt.Fprintf(os.Stderr, "Reading %s databases is not supported; -db is always opened as leveldb\n", *from)
+		return 2
+	}
+	create, ok := engines[*to]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Error: engine %q not supported (supported: %s)\n", *to, engineNames())
+		return 2
+	}
+	targetOptions := make(map[string]string)
+	for _, option := range options {
+		key, value, found := strings.Cut(option, "=")
+		if !found {
+			fmt.Fprintf(os.Stderr, "Bad option %q, want key=value\n", option)
+			return 2
+		}
+		targetOptions[key] = value
+	}
+
+	out := fs.Arg(0)
+	target, err := create(out, targetOptions)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating %s: %v\n", out, err)
+		return 2
+	}
+	defer target.Close()
+
+	count, err := convertDatabase(target, *batchSize, func(detail string) {
+		fmt.Fprintf(os.Stderr, "\r%s", detail)
+	})
+	if count > 0 {
+		fmt.Fprintln(os.Stderr)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error after %d keys: %v\n", count, err)
+		return 2
+	}
+	fmt.Printf("Converted %d keys from %s to %s at %s\n", count, *from, *to, out)
+	if !*verify {
+		return 0
+	}
+
+	report, err := verifyCopy(dbPath, out, databaseWalker, target.walk())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error verifying: %v\n", err)
+		return 2
+	}
+	reportPath, err := writeVerifyReport(report, out)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing report: %v\n", err)
+		return 2
+	}
+	fmt.Printf("%s; report in %s\n", report.summary(), reportPath)
+	if !report.ok() {
+		return 1
+	}
+	return 0
+}
+
+func cmdRestore(args []string) int {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	from := fs.String("from", "", "Backup database directory, export file or export manifest")
+	var keys, prefixes stringList
+	fs.Var(&keys, "key", "Key to restore (repeatable)")
+	fs.Var(&prefixes, "prefix", "Restore every key with this prefix (repeatable)")
+	all := fs.Bool("all", false, "Restore every key in the archive into an empty database")
+	dryRun := fs.Bool("dry-run", false, "Only show what would change")
+	verify := fs.Bool("verify", false, "Compare the archive with the keys the database holds under the restored keys and prefixes (all of it with -all), counts and digests, writing a .verify.json report")
+	fs.Parse(args)
+	if *from == "" || (len(keys) == 0 && len(prefixes) == 0 && !*all) {
+		return commandError("restore")
+	}
+	if readOnly && !*dryRun {
+		fmt.Fprintln(os.Stderr, "Database is open read-only: use -dry-run")
+		return 2
+	}
+
+	keep := selectorFilter(keys, prefixes)
+	if *all {
+		keep = func([]byte) bool { return true }
+		if !*dryRun {
+			iter := db.NewIterator(nil, nil)
+			empty := !iter.First()
+			iter.Release()
+			if !empty {
+				fmt.Fprintln(os.Stderr, "Error: -all rebuilds a database from the archive and needs an empty one; restore into a new -db, or pick keys with -key and -prefix")
+				return 2
+			}
+		}
+	}
+	if want, ok := manifestKeyCount(*from); ok && *all {
+		// Counted before writing anything, without holding the records
+		held := 0
+		if err := scanArchive(*from, keep, func(archiveRecord) error { held++; return nil }); err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading archive: %v\n", err)
+			return 2
+		}
+		if held != want {
+			fmt.Fprintf(os.Stderr, "Error: the manifest lists %d keys but its shards hold %d\n", want, held)
+			return 2
+		}
+	}
+
+	handleShutdownSignals(func() {})
+	counts := map[byte]int{}
+	written, err := restoreArchive(*from, keep, *dryRun, func(change restoreChange) {
+		counts[change.state]++
+		switch change.state {
+		case '+':
+			fmt.Printf("+ %s (new, %d bytes)\n", change.key, len(change.value))
+		case '~':
+			fmt.Printf("~ %s (%d -> %d bytes)\n", change.key, change.currentSize, len(change.value))
+		default:
+			fmt.Printf("= %s (unchanged)\n", change.key)
+		}
+	})
+	fmt.Printf("%d new, %d changed, %d unchanged\n", counts['+'], counts['~'], counts['='])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error after writing %d keys: %v\n", written, err)
+		return 2
+	}
+	if *dryRun {
+		return 0
+	}
+	fmt.Printf("Restored %d keys\n", written)
+	if !*verify {
+		return 0
+	}
+
+	report, err := verifyRestore(*from, keep, keys, prefixes, *all)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error verifying: %v\n", err)
+		return 2
+	}
+	reportPath, err := writeVerifyReport(report, dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing report: %v\n", err)
+		return 2
+	}
+	fmt.Printf("%s; report in %s\n", report.summary(), reportPath)
+	if !report.ok() {
+		return 1
+	}
+	return 0
+}
+
+func cmdReplay(args []string) int {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return commandError("replay")
+	}
+
+	recorded, err := loadSession(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	fmt.Printf("Replaying %d actions recorded on %s at %s\n", len(recorded.Actions), recorded.Database, recorded.Started.Format(time.RFC3339))
+	if failed := replaySession(recorded, os.Stdout); failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d actions failed\n", failed)
+		return 1
+	}
+	return 0
+}
+
+func cmdReport(args []string) int {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	format := fs.String("format", "md", "Report format: md or html")
+	dir := fs.String("dir", dumpDir, "Output directory")
+	var keys stringList
+	fs.Var(&keys, "key", "Also include this key (repeatable)")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		return commandError("report")
+	}
+
+	if err := loadNotes(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	for _, key := range keys {
+		markedKeys[key] = true
+	}
+	selected := bookmarkedKeys()
+	if len(selected) == 0 {
+		fmt.Fprintln(os.Stderr, "No keys to report: add notes in the viewer or pass -key")
+		return 1
+	}
+
+	path, err := writeFindingsReport(selected, *format, *dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	fmt.Printf("Wrote report of %d keys to %s\n", len(selected), path)
+	return 0
+}
+
+func cmdRender(args []string) int {
+	fs := flag.NewFlagSet("render", flag.ExitOnError)
+	format := fs.String("format", "html", "Document format: html or md")
+	dir := fs.String("dir", dumpDir, "Output directory")
+	view := fs.String("view", "auto", "Value format, as cycled with f in the viewer")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return commandError("render")
+	}
+	if err := setViewFormat(*view); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	if err := loadNotes(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+
+	key := []byte(fs.Arg(0))
+	path, err := writeValueDocument(key, *format, *dir)
+	if err == leveldb.ErrNotFound {
+		fmt.Fprintf(os.Stderr, "%s: not found\n", fs.Arg(0))
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	fmt.Printf("Wrote %s\n", path)
+	return 0
+}
+
+func cmdGet(args []string) int {
+	fs := flag.NewFlagSet("get", flag.ExitOnError)
+	pretty := fs.Bool("pretty", false, "Format the value as the viewer shows it")
+	b64 := fs.Bool("b64", false, "Print the value base64-encoded")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return commandError("get")
+	}
+
+	key := []byte(fs.Arg(0))
+	value, err := db.Get(key, nil)
+	if err == leveldb.ErrNotFound {
+		fmt.Fprintf(os.Stderr, "%s: not found\n", fs.Arg(0))
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+
+	switch {
+	case *b64:
+		fmt.Println(base64.StdEncoding.EncodeToString(value))
+	case *pretty:
+		fmt.Println(formatKeyValue(key, value))
+	default:
+		os.Stdout.Write(value)
+	}
+	return 0
+}
+
+func cmdPut(args []string) int {
+	fs := flag.NewFlagSet("put", flag.ExitOnError)
+	b64 := fs.Bool("b64", false, "The value is base64-encoded")
+	fs.Parse(args)
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		return commandError("put")
+	}
+	if readOnly {
+		fmt.Fprintln(os.Stderr, "Database is open read-only")
+		return 2
+	}
+
+	var value []byte
+	if fs.NArg() == 2 {
+		value = []byte(fs.Arg(1))
+	} else {
+		var err error
+		if value, err = io.ReadAll(os.Stdin); err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading stdin: %v\n", err)
+			return 2
+		}
+	}
+	if *b64 {
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(value)))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error decoding value: %v\n", err)
+			return 2
+		}
+		value = decoded
+	}
+
+	if err := db.Put([]byte(fs.Arg(0)), value, nil); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	return 0
+}
+
+func cmdDel(args []string) int {
+	fs := flag.NewFlagSet("del", flag.ExitOnError)
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		return commandError("del")
+	}
+	if readOnly {
+		fmt.Fprintln(os.Stderr, "Database is open read-only")
+		return 2
+	}
+
+	batch := new(leveldb.Batch)
+	for _, key := range fs.Args() {
+		batch.Delete([]byte(key))
+	}
+	if err := db.Write(batch, nil); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	return 0
+}
+
+func cmdDiff(args []string) int {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	fast := fs.Bool("fast", false, "Hash ranges of both databases in parallel and only walk the ranges that differ")
+	workers := fs.Int("workers", runtime.NumCPU(), "Ranges hashed at once with -fast")
+	limit := fs.Int("limit", 0, "Stop after this many differences; 0 means no limit")
+	values := fs.Bool("values", false, "Also print the values of keys that differ")
+	fs.Parse(args)
+	if fs.NArg() != 1 || *workers < 1 {
+		return commandError("diff")
+	}
+	if indexedDB {
+		fmt.Fprintln(os.Stderr, "Error: diff compares keys in byte order and cannot be combined with -indexeddb")
+		return 2
+	}
+
+	opened, err := leveldb.OpenFile(fs.Arg(0), &opt.Options{ReadOnly: true})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	other := singleDB{opened}
+	defer other.Close()
+
+	var diffs diffSpill // Spills to disk past the -max-memory share
+	defer diffs.close()
+	if *fast {
+		var boundaries [][]byte
+		var found []keyDiff
+		if boundaries, err = diffBoundaries(db, *workers*8); err == nil {
+			found, err = parallelDiff(db, other, boundaries, *workers, *limit, func(done, identical, total int) {
+				fmt.Fprintf(os.Stderr, "\rCompared %d/%d ranges, %d identical", done, total, identical)
+			})
+			fmt.Fprintln(os.Stderr)
+		}
+		diffs.held, diffs.count = found, len(found)
+	} else {
+		var spillErr error
+		err = diffRange(db, other, nil, func(d keyDiff) bool {
+			if spillErr = diffs.add(d); spillErr != nil {
+				return false
+			}
+			return *limit <= 0 || diffs.len() < *limit
+		})
+		if err == nil {
+			err = spillErr
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	printed := 0
+	err = diffs.each(func(d keyDiff) bool {
+		if *limit > 0 && printed >= *limit {
+			return false
+		}
+		printed++
+		fmt.Fprintln(out, formatKeyDiff(other, d, *values))
+		return true
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	if diffs.len() > 0 {
+		return 1
+	}
+	return 0
+}
+
+func cmdMerge3(args []string) int {
+	fs := flag.NewFlagSet("merge3", flag.ExitOnError)
+	basePath := fs.String("base", "", "Export (NDJSON, RESP or text) or backup directory of the common ancestor")
+	apply := fs.Bool("apply", false, "Write the keys changed only in theirs into this database")
+	dir := fs.String("dir", dumpDir, "Directory for the merge plan")
+	fs.Parse(args)
+	if fs.NArg() != 1 || *basePath == "" {
+		return commandError("merge3")
+	}
+	if *apply && readOnly {
+		fmt.Fprintln(os.Stderr, "Database is open read-only")
+		return 2
+	}
+	if indexedDB {
+		fmt.Fprintln(os.Stderr, "Error: merge3 compares keys in byte order and cannot be combined with -indexeddb")
+		return 2
+	}
+
+	base, err := readArchive(*basePath, func([]byte) bool { return true })
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading base: %v\n", err)
+		return 2
+	}
+	opened, err := leveldb.OpenFile(fs.Arg(0), &opt.Options{ReadOnly: true})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	defer opened.Close()
+
+	plan, err := planThreeWayMerge(*basePath, base, fs.Arg(0), opened)
+	if err == nil && *apply {
+		_, err = applyMergeEntries(plan.Auto, func(e *mergeEntry) mergeVersion { return e.Theirs })
+		plan.Applied = err == nil
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	path, err := writeMergePlan(plan, *dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+
+	verb := "to take"
+	if plan.Applied {
+		verb = "took"
+	}
+	fmt.Printf("%s %d keys changed only in theirs, kept %d changed only here, %d unchanged, %d conflicts\n",
+		verb, len(plan.Auto), plan.KeptOurs, plan.Unchanged, len(plan.Conflicts))
+	fmt.Printf("Wrote merge plan to %s\n", path)
+	if len(plan.Conflicts) > 0 {
+		fmt.Printf("Review the conflicts with: %s -db %s -cmd 'conflicts %s'\n", os.Args[0], dbPath, path)
+		return 1
+	}
+	return 0
+}
+
+func cmdScan(args []string) int {
+	fs := flag.NewFlagSet("scan", flag.ExitOnError)
+	prefix := fs.String("prefix", "", "Only keys with this prefix")
+	start := fs.String("start", "", "First key (inclusive)")
+	end := fs.String("end", "", "Key to stop at (exclusive)")
+	limit := fs.Int("limit", 0, "Stop after this many keys; 0 means no limit")
+	keysOnly := fs.Bool("keys-only", false, "Print only keys")
+	asJSON := fs.Bool("json", false, "Print one JSON object per key, as mget does")
+	query := fs.String("query", "", `Only keys and values matching this query, e.g. 'key~"^user:" AND value.json.status == "active"'`)
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		return commandError("scan")
+	}
+	var q *queryNode
+	if *query != "" {
+		var err error
+		if q, err = parseQuery(*query); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 2
+		}
+	}
+
+	r := &util.Range{}
+	if *prefix != "" {
+		r = util.BytesPrefix([]byte(*prefix))
+	}
+	if *start != "" && bytes.Compare([]byte(*start), r.Start) > 0 {
+		r.Start = []byte(*start)
+	}
+	if *end != "" && (r.Limit == nil || bytes.Compare([]byte(*end), r.Limit) < 0) {
+		r.Limit = []byte(*end)
+	}
+
+	if q != nil {
+		r = intersectRanges(r, q.keyRange())
+	}
+
+	iter := db.NewIterator(r, scanReadOptions)
+	defer iter.Release()
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	encoder := json.NewEncoder(out)
+
+	count := 0
+	for iter.Next() && (*limit == 0 || count < *limit) {
+		scanRate.wait(iter.Key(), iter.Value())
+		key, value := iter.Key(), iter.Value()
+		if q != nil && !q.match(&queryRow{key: key, value: value}) {
+			continue
+		}
+		count++
+		switch {
+		case *asJSON:
+			result := mgetResult{Key: string(key), Found: true, Size: len(value)}
+			if !utf8.Valid(key) {
+				result.KeyB64 = base64.StdEncoding.EncodeToString(key)
+			}
+			if !*keysOnly {
+				result.Value = mixedContentDisplay(value)
+				result.ValueB64 = base64.StdEncoding.EncodeToString(value)
+			}
+			if err := encoder.Encode(result); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				return 2
+			}
+		case *keysOnly:
+			// Control characters become [b64:...] runs so every key stays on one line
+			fmt.Fprintln(out, mixedContentDisplay(key))
+		default:
+			fmt.Fprintf(out, "%s\t%s\n", mixedContentDisplay(key), mixedContentDisplay(value))
+		}
+	}
+	if err := iter.Error(); err != nil {
+		out.Flush()
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	return 0
+}
+
+func cmdSearch(args []string) int {
+	fs := flag.NewFlagSet("search", flag.ExitOnError)
+	var others stringList
+	fs.Var(&others, "in", "Also search this database, opened read-only (repeatable)")
+	limit := fs.Int("limit", 100, "Matches listed per database; 0 means no limit")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return commandError("search")
+	}
+	if err := checkSearch(fs.Arg(0)); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+
+	targets, opened, err := openSearchTargets(others)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	defer func() {
+		for _, o := range opened {
+			o.Close()
+		}
+	}()
+	targets = append([]searchTarget{{name: dbPath, src: db}}, targets...)
+
+	code := 1
+	for _, result := range searchDatabases(targets, fs.Arg(0), *limit) {
+		switch {
+		case result.err != nil:
+			fmt.Printf("== %s: error: %v\n", result.database, result.err)
+			code = 2
+			continue
+		case result.more:
+			fmt.Printf("== %s: first %d matches\n", result.database, len(result.keys))
+		default:
+			fmt.Printf("== %s: %d matches\n", result.database, len(result.keys))
+		}
+		for _, key := range result.keys {
+			fmt.Println(mixedContentDisplay(key))
+		}
+		if len(result.keys) > 0 && code == 1 {
+			code = 0
+		}
+	}
+	return code
+}
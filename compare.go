@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// Above this many line pairs the LCS table gets too big, so lines are compared positionally
+const maxDiffCells = 4_000_000
+
+var compareLines = 0 // Number of aligned lines in the current comparison
+
+var pinnedDB database // Database the pinned key was pinned in, which may be another tab's
+
+// Diff operation on a single line: ' ' unchanged, '-' only in the pinned value, '+' only in the selected value
+type diffOp struct {
+	kind byte
+	text string
+}
+
+// Pin the selected key on the left, or unpin it if a key is already pinned
+func togglePinnedKey() {
+	if pinnedKey != nil {
+		recordAction("unpin", nil, "")
+		pinnedKey, pinnedDB = nil, nil
+		valuePane.Clear().AddItem(valueView, 0, 1, false)
+		valueView.SetWrap(true).SetTitle(" Value ")
+		if currentKey != nil {
+			showKeyValue(currentKey)
+		}
+		setStatus("[green]Unpinned key")
+		return
+	}
+
+	currentIndex := keyList.GetCurrentItem()
+	if currentIndex < 0 || currentIndex >= len(displayedKeys) {
+		setStatus("[red]Invalid selection")
+		return
+	}
+
+	pinKey(displayedKeys[currentIndex])
+}
+
+// Pin key on the left of the comparison view
+func pinKey(key []byte) {
+	pinnedKey, pinnedDB = key, db
+	recordAction("pin", pinnedKey, "")
+	valuePane.Clear().
+		AddItem(pinnedView, 0, 1, false).
+		AddItem(valueView, 0, 1, false)
+	valueView.SetWrap(false).SetTitle(" Selected ")
+	showKeyValue(pinnedKey)
+	setStatus(fmt.Sprintf("[green]Pinned %s, select another key to compare", displayKey(pinnedKey)))
+}
+
+// Render the pinned and selected values side by side with aligned, highlighted differences
+func showComparison(left, right []byte) {
+	var leftValue []byte
+	var err error
+	if pinnedDB != nil && pinnedDB != db {
+		leftValue, err = pinnedDB.Get(left, nil) // Pinned in another tab
+	} else {
+		leftValue, err = getValue(left)
+	}
+	if err != nil {
+		pinnedView.SetText(fmt.Sprintf("[red]Error: %v", err))
+		return
+	}
+	rightValue, err := getValue(right)
+	if err != nil {
+		valueView.SetText(fmt.Sprintf("[red]Error: %v", err))
+		return
+	}
+
+	ops := diffLines(strings.Split(formatForView(left, leftValue), "\n"), strings.Split(formatForView(right, rightValue), "\n"))
+
+	var leftText, rightText strings.Builder
+	if pinnedDB != nil && pinnedDB != db {
+		fmt.Fprintf(&leftText, "[white]Key[::-]: %s [yellow](in %s)[-]\n\n", displayKey(left), sanitizeForDisplay(tabNameOf(pinnedDB)))
+	} else {
+		fmt.Fprintf(&leftText, "[white]Key[::-]: %s\n\n", displayKey(left))
+	}
+	fmt.Fprintf(&rightText, "[white]Key[::-]: %s\n\n", displayKey(right))
+
+	changed := writeAlignedDiff(ops, &leftText, &rightText)
+	compareLines = len(ops) + 2
+
+	row, col := valueView.GetScrollOffset()
+	pinnedView.SetText(leftText.String()).ScrollTo(row, col)
+	valueView.SetText(rightText.String()).ScrollTo(row, col)
+
+	if changed == 0 {
+		valueView.SetTitle(" Selected (identical) ")
+	} else {
+		valueView.SetTitle(fmt.Sprintf(" Selected (%d lines differ) ", changed))
+	}
+}
+
+// Write the lines of ops to two panes, blank lines standing in for the
+// other side's changes so equal lines stay aligned; returns the changed lines
+func writeAlignedDiff(ops []diffOp, leftText, rightText *strings.Builder) int {
+	changed := 0
+	for _, op := range ops {
+		line := sanitizeForDisplay(op.text)
+		switch op.kind {
+		case '-':
+			leftText.WriteString("[red]- " + line + "[-]\n")
+			rightText.WriteString("\n")
+			changed++
+		case '+':
+			leftText.WriteString("\n")
+			rightText.WriteString("[green]+ " + line + "[-]\n")
+			changed++
+		default:
+			leftText.WriteString("  " + line + "\n")
+			rightText.WriteString("  " + line + "\n")
+		}
+	}
+	return changed
+}
+
+// Scroll both comparison panes together so aligned lines stay side by side
+func scrollComparison(event *tcell.EventKey) *tcell.EventKey {
+	row, col := valueView.GetScrollOffset()
+	_, _, _, height := valueView.GetInnerRect()
+
+	switch event.Key() {
+	case tcell.KeyDown:
+		row++
+	case tcell.KeyUp:
+		row--
+	case tcell.KeyPgDn:
+		row += height
+	case tcell.KeyPgUp:
+		row -= height
+	case tcell.KeyHome:
+		row = 0
+	case tcell.KeyEnd:
+		row = compareLines - height
+	case tcell.KeyRight:
+		col++
+	case tcell.KeyLeft:
+		col--
+	default:
+		return event
+	}
+
+	row = min(row, compareLines-height)
+	row = max(row, 0)
+	col = max(col, 0)
+	valueView.ScrollTo(row, col)
+	pinnedView.ScrollTo(row, col)
+	return nil
+}
+
+// Line diff based on the longest common subsequence of the two inputs
+func diffLines(a, b []string) []diffOp {
+	if len(a)*len(b) > maxDiffCells {
+		return diffLinesPositional(a, b)
+	}
+
+	// lcs[i][j] is the LCS length of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	ops := make([]diffOp, 0, max(len(a), len(b)))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, diffOp{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, diffOp{'+', b[j]})
+	}
+	return ops
+}
+
+// Cheap fallback for huge values: compare line N with line N
+func diffLinesPositional(a, b []string) []diffOp {
+	ops := make([]diffOp, 0, max(len(a), len(b)))
+	for i := 0; i < len(a) || i < len(b); i++ {
+		switch {
+		case i >= len(a):
+			ops = append(ops, diffOp{'+', b[i]})
+		case i >= len(b):
+			ops = append(ops, diffOp{'-', a[i]})
+		case a[i] == b[i]:
+			ops = append(ops, diffOp{' ', a[i]})
+		default:
+			ops = append(ops, diffOp{'-', a[i]}, diffOp{'+', b[i]})
+		}
+	}
+	return ops
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+const maxDecompressedBytes = 64 << 20 // Compressed values expanding beyond this are shown as stored
+
+var snappyStreamMagic = []byte("\xff\x06\x00\x00sNaPpY")
+
+// Shared zstd decoder; DecodeAll is safe for concurrent use. Frames using a
+// dictionary fail to decode and are shown as stored
+var zstdDecoder, _ = zstd.NewReader(nil, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(maxDecompressedBytes))
+
+// Decompress a value stored compressed with the first codec of the decoder
+// chain's decompress stage that recognises it
+func decompressValue(value []byte) (data []byte, codec string, ok bool) {
+	for _, d := range decompressChain {
+		if data, ok := d.decompress(value); ok {
+			return data, d.name, true
+		}
+	}
+	return nil, "", false
+}
+
+func gunzip(value []byte) ([]byte, bool) {
+	if !bytes.HasPrefix(value, []byte{0x1f, 0x8b, 0x08}) {
+		return nil, false
+	}
+	r, err := gzip.NewReader(bytes.NewReader(value))
+	if err != nil {
+		return nil, false
+	}
+	data, err := readAllLimited(r)
+	return data, err == nil
+}
+
+func unzstd(value []byte) ([]byte, bool) {
+	if !bytes.HasPrefix(value, []byte{0x28, 0xb5, 0x2f, 0xfd}) {
+		return nil, false
+	}
+	data, err := zstdDecoder.DecodeAll(value, nil)
+	return data, err == nil
+}
+
+// Framed Snappy is recognised by its magic bytes; raw Snappy blocks have
+// none, so only binary values that expand to text or to more bytes count
+func unsnappy(value []byte) ([]byte, bool) {
+	if bytes.HasPrefix(value, snappyStreamMagic) {
+		data, err := readAllLimited(snappy.NewReader(bytes.NewReader(value)))
+		return data, err == nil
+	}
+	if isPrintableText(value) {
+		return nil, false
+	}
+	n, err := snappy.DecodedLen(value)
+	if err != nil || n == 0 || n > maxDecompressedBytes || n > 32*len(value) { // No tag expands more than 64/3 times
+		return nil, false
+	}
+	data, err := snappy.Decode(nil, value)
+	if err != nil || !(n > len(value) || n >= 8 && isPrintableText(data)) {
+		return nil, false
+	}
+	return data, true
+}
+
+func readAllLimited(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxDecompressedBytes+1))
+	if err == nil && len(data) > maxDecompressedBytes {
+		err = fmt.Errorf("content larger than %d bytes", maxDecompressedBytes)
+	}
+	return data, err
+}
+
+// Value header line naming the codec a value was decompressed from
+func compressionHeaderNote(codec string, stored, decompressed int) string {
+	return fmt.Sprintf("[gray](%s-compressed: %d bytes stored, %d bytes decompressed)[-]", codec, stored, decompressed)
+}
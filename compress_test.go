@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+func gzipped(t *testing.T, data string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func zstdCompressed(t *testing.T, data string, options ...zstd.EOption) string {
+	t.Helper()
+	w, err := zstd.NewWriter(nil, options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	return string(w.EncodeAll([]byte(data), nil))
+}
+
+// A zstd frame written as a stream, without its content size in the header
+func zstdStreamed(t *testing.T, data string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := zstd.NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func snappyFramed(t *testing.T, data string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	w := snappy.NewBufferedWriter(&buf)
+	if _, err := w.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestDecompressValue(t *testing.T) {
+	text := strings.Repeat("hello, world ", 20)
+	tests := []struct {
+		name  string
+		value string
+		codec string
+		want  string
+	}{
+		{"gzip", gzipped(t, text), "gzip", text},
+		{"empty gzip", gzipped(t, ""), "gzip", ""},
+		{"zstd", zstdCompressed(t, text), "zstd", text},
+		{"zstd with checksum", zstdCompressed(t, text, zstd.WithEncoderCRC(true)), "zstd", text},
+		{"zstd stream", zstdStreamed(t, text), "zstd", text},
+		{"two zstd frames", zstdCompressed(t, "ab") + zstdCompressed(t, "cd"), "zstd", "abcd"},
+		{"skippable zstd frame", zstdCompressed(t, "ab") + "\x50\x2a\x4d\x18\x02\x00\x00\x00xy", "zstd", "ab"},
+		{"framed snappy", snappyFramed(t, text), "snappy", text},
+		{"raw snappy", string(snappy.Encode(nil, []byte(text))), "snappy", text},
+		{"short raw snappy text", string(snappy.Encode(nil, []byte("abcdefgh"))), "snappy", "abcdefgh"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, codec, ok := decompressValue([]byte(tt.value))
+			if !ok {
+				t.Fatalf("decompressValue(%x) failed", tt.value)
+			}
+			if codec != tt.codec || string(data) != tt.want {
+				t.Errorf("decompressValue(%x) = %q, %s, want %q, %s", tt.value, data, codec, tt.want, tt.codec)
+			}
+		})
+	}
+}
+
+func TestDecompressValueMalformed(t *testing.T) {
+	huge := strings.Repeat("\x00", maxDecompressedBytes+1)
+	valid := zstdCompressed(t, "hello")
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"empty", ""},
+		{"plain text", "hello, world"},
+		{"gzip header only", "\x1f\x8b\x08"},
+		{"truncated gzip", gzipped(t, "hello, world")[:15]},
+		{"gzip bomb", gzipped(t, huge)},
+		{"zstd magic only", "\x28\xb5\x2f\xfd"},
+		{"truncated zstd", valid[:len(valid)-2]},
+		{"corrupt zstd", valid[:5] + "\xff\xff\xff" + valid[8:]},
+		{"zstd trailing garbage", valid + "\x01\x02\x03"},
+		{"zstd bomb", zstdCompressed(t, huge)},
+		{"streamed zstd bomb", zstdStreamed(t, huge)},
+		{"zstd with a dictionary", "\x28\xb5\x2f\xfd\x01\x01\x01\x00\x00"},
+		{"truncated skippable zstd frame", valid + "\x50\x2a\x4d\x18\x10\x00\x00\x00xy"},
+		{"truncated framed snappy", snappyFramed(t, "hello, world")[:14]},
+		{"raw snappy claiming too much", "\x80\x80\x80\x80\x08\x00"},
+		{"raw snappy that shrinks", string(snappy.Encode(nil, []byte{0, 1, 2}))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if data, codec, ok := decompressValue([]byte(tt.value)); ok {
+				t.Errorf("decompressValue(%.32x) = %d bytes of %s, want it shown as stored", tt.value, len(data), codec)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Settings read from the JSON config file
+type config struct {
+	Export      exportConfig       `json:"export"`
+	SoftDelete  softDeleteConfig   `json:"soft_delete"`
+	Schedule    []scheduledJob     `json:"schedule"`     // Recurring exports and stats snapshots
+	KeyDecoders []keyDecoderConfig `json:"key_decoders"` // Layouts of binary keys by prefix
+	Protobuf    protobufConfig     `json:"protobuf"`     // Message types of values by key prefix
+	Decoders    decodersConfig     `json:"decoders"`     // Decompressors and decoders of the auto value format
+	BitFields   []bitFieldConfig   `json:"bit_fields"`   // Named flag bits of binary values by key prefix
+	Reads       readsConfig        `json:"reads"`        // Read options of scans and exports
+}
+
+type exportConfig struct {
+	Transforms []transformRule `json:"transforms"` // Applied to every exported record, in order
+	Command    string          `json:"command"`    // External filter, see commandTransform
+	CSV        csvConfig       `json:"csv"`        // Layout of CSV exports
+}
+
+var cfg config // Loaded once at startup
+
+// Per-user directory for the config file and saved state; empty if the OS has none
+func configDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "leveldb-viewer")
+}
+
+// Config used when -config is not given, if it exists
+func defaultConfigPath() string {
+	dir := configDir()
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, "config.json")
+}
+
+// Read the config file. A missing default config is not an error.
+func loadConfig(path string) error {
+	explicit := path != ""
+	if !explicit {
+		if path = defaultConfigPath(); path == "" {
+			return nil
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) && !explicit {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if _, err := parseScheduledJobs(cfg.Schedule); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if err := setupKeyDecoders(cfg.KeyDecoders); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if err := setupDecoderChain(cfg.Decoders); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if err := setupBitFields(cfg.BitFields); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if desc := cfg.Protobuf.DescriptorSet; desc != "" && !filepath.IsAbs(desc) {
+		cfg.Protobuf.DescriptorSet = filepath.Join(filepath.Dir(path), desc)
+	}
+	for i, m := range cfg.Decoders.Mappings {
+		if schema, ok := strings.CutPrefix(m.Decoder, "avro:"); ok && !filepath.IsAbs(schema) {
+			cfg.Decoders.Mappings[i].Decoder = "avro:" + filepath.Join(filepath.Dir(path), schema)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// Resolving the conflicts of a merge plan, written by merge3 or by
+// import -conflicts: each conflicting key is shown with our value on the
+// left and theirs on the right, and is settled by keeping one of them or
+// an edited value. A choice can be repeated for every similar conflict,
+// those under the same key prefix that conflict the same way. Resolved
+// keys are written at once and dropped from the plan file.
+
+// How a key conflicts
+func conflictKind(e *mergeEntry) string {
+	switch {
+	case !e.Ours.Found:
+		return "deleted here, changed there"
+	case !e.Theirs.Found:
+		return "changed here, deleted there"
+	case !e.Base.Found:
+		return "added on both sides"
+	}
+	return "changed on both sides"
+}
+
+// Conflicts under the same key prefix (as the heatmap groups keys) that conflict the same way
+func similarConflicts(a, b *mergeEntry) bool {
+	return heatPrefix(a.key()) == heatPrefix(b.key()) && conflictKind(a) == conflictKind(b)
+}
+
+// A version as text for a conflict pane
+func formatMergeVersion(v mergeVersion) string {
+	if !v.Found {
+		return "(absent)"
+	}
+	return formatValue(v.Value)
+}
+
+// Whether the browsed database still holds our version of the entry's key,
+// as a key written since the plan was made must be looked at again
+func oursUnchanged(e *mergeEntry) (bool, error) {
+	value, err := browseReader().Get(e.key(), nil)
+	if err == leveldb.ErrNotFound {
+		return !e.Ours.Found, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return e.Ours.Found && bytes.Equal(value, e.Ours.Value), nil
+}
+
+// Open the conflicts of a merge plan in the resolver, from -cmd 'conflicts <plan>'
+func showMergePlan(path string) error {
+	plan, err := readMergePlan(path)
+	if err != nil {
+		return err
+	}
+	if len(plan.Conflicts) == 0 {
+		setStatus(fmt.Sprintf("[green]No conflicts in %s", path))
+		return nil
+	}
+	showConflictView(plan, path)
+	return nil
+}
+
+// List the conflicts of plan, saved at path, and resolve them one by one or by similarity
+func showConflictView(plan *mergePlan, path string) {
+	written := 0
+
+	list := tview.NewList().SetWrapAround(false).ShowSecondaryText(false)
+	list.SetBorder(true)
+	list.SetTitleAlign(tview.AlignLeft)
+	list.SetTitleColor(tcell.ColorYellow)
+	list.SetBackgroundColor(tcell.ColorReset)
+	list.SetSelectedBackgroundColor(tcell.ColorWhite)
+	list.SetHighlightFullLine(true)
+
+	newPane := func() *tview.TextView {
+		pane := tview.NewTextView()
+		pane.SetDynamicColors(true).SetBorder(true)
+		pane.SetTitleColor(tcell.ColorYellow)
+		pane.SetTitleAlign(tview.AlignLeft)
+		pane.SetScrollable(true).SetWrap(false)
+		pane.SetBackgroundColor(tcell.ColorReset)
+		pane.SetTextColor(tcell.ColorWhite)
+		return pane
+	}
+	oursPane, theirsPane := newPane(), newPane()
+	oursPane.SetTitle(fmt.Sprintf(" Ours: %s ", tview.Escape(plan.Ours)))
+	theirsPane.SetTitle(fmt.Sprintf(" Theirs: %s ", tview.Escape(plan.Theirs)))
+
+	info := tview.NewTextView().SetDynamicColors(true).SetWrap(false)
+	info.SetBackgroundColor(tcell.ColorReset)
+	info.SetTextColor(tcell.ColorWhite)
+
+	// Conflicts similar to the one at index, including it
+	similar := func(index int) []int {
+		var indexes []int
+		for i := range plan.Conflicts {
+			if similarConflicts(&plan.Conflicts[i], &plan.Conflicts[index]) {
+				indexes = append(indexes, i)
+			}
+		}
+		return indexes
+	}
+
+	showConflict := func(index int) {
+		if index < 0 || index >= len(plan.Conflicts) {
+			oursPane.Clear()
+			theirsPane.Clear()
+			info.Clear()
+			return
+		}
+		c := &plan.Conflicts[index]
+		ops := diffLines(strings.Split(formatMergeVersion(c.Ours), "\n"), strings.Split(formatMergeVersion(c.Theirs), "\n"))
+		var oursText, theirsText strings.Builder
+		writeAlignedDiff(ops, &oursText, &theirsText)
+		oursPane.SetText(oursText.String()).ScrollToBeginning()
+		theirsPane.SetText(theirsText.String()).ScrollToBeginning()
+
+		base := "(absent)"
+		if c.Base.Found {
+			base, _, _ = strings.Cut(formatValue(c.Base.Value), "\n")
+		}
+		info.SetText(fmt.Sprintf("[yellow]%s[-], %d similar  [white]Base[::-]: %s",
+			conflictKind(c), len(similar(index))-1, sanitizeForDisplay(base)))
+	}
+
+	refresh := func() {
+		current := list.GetCurrentItem()
+		list.Clear()
+		for i := range plan.Conflicts {
+			list.AddItem(displayKey(plan.Conflicts[i].key()), "", 0, nil)
+		}
+		list.SetTitle(fmt.Sprintf(" Conflicts: %d (o/t: keep ours/theirs, O/T: for all similar, e: edit, Enter: go to key, Esc: close) ", len(plan.Conflicts)))
+		if current >= len(plan.Conflicts) {
+			current = len(plan.Conflicts) - 1
+		}
+		if current >= 0 {
+			list.SetCurrentItem(current)
+		}
+		showConflict(list.GetCurrentItem())
+	}
+
+	// Write the picked version of the conflicts at indexes and drop them from the plan
+	resolve := func(indexes []int, pick func(*mergeEntry) mergeVersion) {
+		if refuseWrite() {
+			return
+		}
+		done := make(map[int]bool)
+		var entries []mergeEntry
+		stale := 0
+		for _, i := range indexes {
+			unchanged, err := oursUnchanged(&plan.Conflicts[i])
+			if err != nil {
+				setStatus(fmt.Sprintf("[red]Error: %v", err))
+				return
+			}
+			if !unchanged {
+				stale++
+				continue
+			}
+			done[i] = true
+			entries = append(entries, plan.Conflicts[i])
+		}
+		if _, err := applyMergeEntries(entries, pick); err != nil {
+			setStatus(fmt.Sprintf("[red]Error writing: %v", err))
+			return
+		}
+		written += len(entries)
+
+		remaining := plan.Conflicts[:0]
+		for i := range plan.Conflicts {
+			if !done[i] {
+				remaining = append(remaining, plan.Conflicts[i])
+			}
+		}
+		plan.Conflicts = remaining
+		refresh()
+
+		status := fmt.Sprintf("[green]Resolved %d conflicts", len(entries))
+		if err := saveMergePlan(plan, path); err != nil {
+			status = fmt.Sprintf("[red]Resolved %d conflicts but could not update %s: %v", len(entries), path, err)
+		}
+		if stale > 0 {
+			status += fmt.Sprintf(" [yellow](%d skipped: changed here since the plan was made)", stale)
+		}
+		setStatus(status)
+	}
+
+	closeView := func() {
+		pages.RemovePage("conflicts")
+		app.SetFocus(keyList)
+		if written > 0 {
+			loadInitialKeys()
+		}
+	}
+
+	// Edit the value to keep for the conflict at index, starting from theirs
+	editResolution := func(index int) {
+		if refuseWrite() {
+			return
+		}
+		c := plan.Conflicts[index]
+		start := c.Theirs
+		if !start.Found {
+			start = c.Ours
+		}
+		plain := isPlainText(start.Value)
+		text, title := string(start.Value), "Resolve"
+		if !plain {
+			text, title = hexEditText(start.Value), "Resolve (hex)"
+		}
+
+		editor := tview.NewTextArea()
+		editor.SetText(text, false)
+		editor.SetBorder(true).SetTitle(fmt.Sprintf(" %s %s (Ctrl+S: keep this value, Esc: cancel) ", title, displayKey(c.key())))
+		editor.SetTitleAlign(tview.AlignLeft)
+		editor.SetTitleColor(tcell.ColorYellow)
+		editor.SetBackgroundColor(tcell.ColorReset)
+		editor.SetTextStyle(tcell.StyleDefault.Foreground(tcell.ColorWhite).Background(tcell.ColorReset))
+
+		closeEditor := func() {
+			pages.RemovePage("conflict-edit")
+			app.SetFocus(list)
+		}
+		editor.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+			switch event.Key() {
+			case tcell.KeyEsc:
+				closeEditor()
+				return nil
+			case tcell.KeyCtrlS:
+				value := []byte(editor.GetText())
+				if editor.GetText() == text {
+					value = start.Value
+				} else if !plain {
+					var err error
+					if value, err = parseHexEditText(editor.GetText()); err != nil {
+						setStatus(fmt.Sprintf("[red]Error: %v", err))
+						return nil
+					}
+				}
+				closeEditor()
+				resolve([]int{index}, func(*mergeEntry) mergeVersion { return mergeVersion{true, value} })
+				return nil
+			}
+			return event
+		})
+		pages.AddPage("conflict-edit", editor, true, true)
+		app.SetFocus(editor)
+	}
+
+	pickOurs := func(e *mergeEntry) mergeVersion { return e.Ours }
+	pickTheirs := func(e *mergeEntry) mergeVersion { return e.Theirs }
+
+	list.SetChangedFunc(func(index int, mainText string, secondaryText string, shortcut rune) {
+		showConflict(index)
+	})
+	list.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		i := list.GetCurrentItem()
+		if event.Key() == tcell.KeyEsc {
+			closeView()
+			return nil
+		}
+		if i < 0 || i >= len(plan.Conflicts) {
+			return event
+		}
+		switch {
+		case event.Key() == tcell.KeyEnter:
+			key := plan.Conflicts[i].key()
+			closeView()
+			if err := seekToKey(key); err != nil {
+				setStatus(fmt.Sprintf("[red]Error: %v", err))
+			}
+		case event.Rune() == 'o':
+			resolve([]int{i}, pickOurs)
+		case event.Rune() == 't':
+			resolve([]int{i}, pickTheirs)
+		case event.Rune() == 'O':
+			resolve(similar(i), pickOurs)
+		case event.Rune() == 'T':
+			resolve(similar(i), pickTheirs)
+		case event.Rune() == 'e' || event.Rune() == 'E':
+			editResolution(i)
+		default:
+			return event
+		}
+		return nil
+	})
+
+	layout := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(list, 0, 1, true).
+		AddItem(tview.NewFlex().
+			AddItem(oursPane, 0, 1, false).
+			AddItem(theirsPane, 0, 1, false), 0, 2, false).
+		AddItem(info, 1, 0, false)
+
+	pages.AddPage("conflicts", layout, true, true)
+	app.SetFocus(list)
+	refresh()
+}
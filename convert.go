@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+// Destination of a conversion: takes batches of records in key order
+type engineWriter interface {
+	writeBatch(records []archiveRecord) error
+	walk() recordWalker // Re-reads the written data for verification
+	Close() error
+}
+
+// Storage engines convert can write. Only LevelDB is built in; other engines
+// register here once their packages are vendored.
+var engines = map[string]func(path string, options map[string]string) (engineWriter, error){
+	"leveldb": createLevelDBTarget,
+}
+
+func engineNames() string {
+	names := make([]string, 0, len(engines))
+	for name := range engines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+type levelDBTarget struct {
+	*leveldb.DB
+}
+
+// New LevelDB at path, which must not hold anything yet. Options: compression=snappy|none
+func createLevelDBTarget(path string, options map[string]string) (engineWriter, error) {
+	if entries, err := os.ReadDir(path); err == nil && len(entries) > 0 {
+		return nil, fmt.Errorf("%s is not empty", path)
+	} else if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	o := &opt.Options{ErrorIfExist: true}
+	switch options["compression"] {
+	case "", "snappy":
+	case "none":
+		o.Compression = opt.NoCompression
+	default:
+		return nil, fmt.Errorf("unknown compression %q, want snappy or none", options["compression"])
+	}
+	target, err := leveldb.OpenFile(path, o)
+	if err != nil {
+		return nil, err
+	}
+	return levelDBTarget{target}, nil
+}
+
+func (t levelDBTarget) writeBatch(records []archiveRecord) error {
+	batch := new(leveldb.Batch)
+	for _, record := range records {
+		batch.Put(record.key, record.value)
+	}
+	return t.Write(batch, nil)
+}
+
+func (t levelDBTarget) walk() recordWalker {
+	return func(fn func(key, value []byte) error) error {
+		iter := t.NewIterator(nil, nil)
+		defer iter.Release()
+		for iter.Next() {
+			if err := fn(iter.Key(), iter.Value()); err != nil {
+				return err
+			}
+		}
+		return iter.Error()
+	}
+}
+
+// Stream every record of the open database into target in batches of batchSize
+func convertDatabase(target engineWriter, batchSize int, progress func(string)) (int, error) {
+	iter := db.NewIterator(nil, scanReadOptions)
+	defer iter.Release()
+
+	var records []archiveRecord
+	count := 0
+	for iter.Next() {
+		if err := interrupted(); err != nil {
+			return count, err
+		}
+		scanRate.wait(iter.Key(), iter.Value())
+		records = append(records, archiveRecord{
+			key:   append([]byte{}, iter.Key()...),
+			value: append([]byte{}, iter.Value()...),
+		})
+		if len(records) == batchSize {
+			if err := target.writeBatch(records); err != nil {
+				return count, err
+			}
+			count += len(records)
+			records = records[:0]
+			progress(fmt.Sprintf("%d keys converted", count))
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return count, fmt.Errorf("iterator error: %w", err)
+	}
+	if len(records) > 0 {
+		if err := target.writeBatch(records); err != nil {
+			return count, err
+		}
+		count += len(records)
+		progress(fmt.Sprintf("%d keys converted", count))
+	}
+	return count, nil
+}
+
+// Walker over the open database, the source side of a conversion check
+func databaseWalker(fn func(key, value []byte) error) error {
+	iter := db.NewIterator(nil, scanReadOptions)
+	defer iter.Release()
+	for iter.Next() {
+		scanRate.wait(iter.Key(), iter.Value())
+		if err := fn(iter.Key(), iter.Value()); err != nil {
+			return err
+		}
+	}
+	return iter.Error()
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// Copying or moving the marked keys (or the selected one) into the
+// database of another tab, in batches, with a summary of what was
+// written and which existing values were replaced.
+
+const copyBatchSize = 1000 // Keys written to the target per batch
+
+// Keys picked for copying: the marked keys, or the selected one when none are marked
+func keysToCopy() [][]byte {
+	var keys [][]byte
+	for key := range markedKeys {
+		keys = append(keys, []byte(key))
+	}
+	if len(keys) == 0 {
+		if i := keyList.GetCurrentItem(); i >= 0 && i < len(displayedKeys) {
+			keys = [][]byte{displayedKeys[i]}
+		}
+	}
+	return keys
+}
+
+// Write the values keys have in the open database (its pinned snapshot in the viewer) to target in batches.
+// Returns the keys written and how many of them replaced an existing value.
+func copyKeysTo(target database, keys [][]byte) (int, int, error) {
+	batch := new(leveldb.Batch)
+	written, replaced := 0, 0
+	flush := func() error {
+		if err := target.Write(batch, nil); err != nil {
+			return err
+		}
+		written += batch.Len()
+		batch.Reset()
+		return nil
+	}
+	source := browseReader()
+	for _, key := range keys {
+		value, err := source.Get(key, nil)
+		if err == leveldb.ErrNotFound {
+			continue // Deleted since it was marked
+		}
+		if err != nil {
+			return written, replaced, err
+		}
+		if _, err := target.Get(key, nil); err == nil {
+			replaced++
+		}
+		batch.Put(key, value)
+		if batch.Len() >= copyBatchSize {
+			if err := flush(); err != nil {
+				return written, replaced, err
+			}
+		}
+	}
+	return written, replaced, flush()
+}
+
+// Ask which tab to copy the picked keys to, then whether to copy or move them
+func showCopyDialog() {
+	if len(tabs) < 2 {
+		setStatus("[yellow]Open another database with a second -db to copy keys into it")
+		return
+	}
+	if len(pendingChanges) > 0 {
+		setStatus("[red]Commit or discard the staged changes before copying keys")
+		return
+	}
+	keys := keysToCopy()
+	if len(keys) == 0 {
+		setStatus("[red]Invalid selection")
+		return
+	}
+
+	var others []*dbTab
+	for i, t := range tabs {
+		if i != activeTab {
+			others = append(others, t)
+		}
+	}
+	if len(others) == 1 {
+		confirmCopy(keys, others[0])
+		return
+	}
+
+	list := tview.NewList().SetWrapAround(false).ShowSecondaryText(false)
+	list.SetBorder(true).SetTitle(fmt.Sprintf(" Copy %d keys to (Enter: pick, Esc: cancel) ", len(keys)))
+	list.SetTitleAlign(tview.AlignLeft)
+	list.SetTitleColor(tcell.ColorYellow)
+	list.SetBackgroundColor(tcell.ColorReset)
+	list.SetSelectedBackgroundColor(tcell.ColorWhite)
+	list.SetHighlightFullLine(true)
+	for _, t := range others {
+		t := t
+		list.AddItem(sanitizeForDisplay(tabName(t)), "", 0, func() {
+			closeDialog("copy-target")
+			confirmCopy(keys, t)
+		})
+	}
+	list.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyEsc {
+			closeDialog("copy-target")
+			return nil
+		}
+		return event
+	})
+	showDialog("copy-target", list, 60, min(len(others)+2, 12))
+}
+
+func confirmCopy(keys [][]byte, target *dbTab) {
+	if target.readOnly {
+		setStatus(fmt.Sprintf("[red]%s is open read-only", tview.Escape(tabName(target))))
+		return
+	}
+	text := fmt.Sprintf("Copy %s to %s?", displayKey(keys[0]), tabName(target))
+	if len(keys) > 1 {
+		text = fmt.Sprintf("Copy %d keys to %s?", len(keys), tabName(target))
+	}
+	modal := tview.NewModal().
+		SetText(text + "\nMove also deletes them here.").
+		AddButtons([]string{"Copy", "Move", "Cancel"}).
+		SetDoneFunc(func(index int, label string) {
+			closeDialog("copy")
+			if label == "Copy" || label == "Move" {
+				transferKeys(keys, target, label == "Move")
+			}
+		})
+	modal.SetFocus(2) // Default to Cancel
+	pages.AddPage("copy", modal, true, true)
+	app.SetFocus(modal)
+}
+
+func transferKeys(keys [][]byte, target *dbTab, move bool) {
+	if move && refuseWrite() {
+		return
+	}
+	written, replaced, err := copyKeysTo(target.db, keys)
+	target.keys = nil // Its key list is read again when it is shown, from a new snapshot
+	if target.snap != nil {
+		target.snap.Release()
+		target.snap = nil
+	}
+	if err != nil {
+		setStatus(fmt.Sprintf("[red]Error after copying %d keys: %v", written, err))
+		return
+	}
+
+	verb := "Copied"
+	if move {
+		if err := deleteKeys(keys); err != nil {
+			setStatus(fmt.Sprintf("[red]Copied %d keys but could not delete them here: %v", written, err))
+			return
+		}
+		removeFromKeyList(keys)
+		verb = "Moved"
+	} else {
+		for _, key := range keys {
+			delete(markedKeys, string(key))
+		}
+		rebuildKeyList(keyList.GetCurrentItem())
+	}
+	setStatus(fmt.Sprintf("[green]%s %d keys to %s (%d new, %d replaced)",
+		verb, written, tview.Escape(tabName(target)), written-replaced, replaced))
+}
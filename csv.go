@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// CSV export settings from the "csv" section of the export config
+type csvConfig struct {
+	Delimiter string `json:"delimiter"` // Single character; "\t" for tabs. Default ","
+	Escape    string `json:"escape"`    // "quote" (RFC 4180, default) or "backslash"
+	Values    bool   `json:"values"`    // Add a value column
+	Sizes     bool   `json:"sizes"`     // Add a value size column
+}
+
+// Validated CSV layout used by the export
+type csvLayout struct {
+	delimiter rune
+	backslash bool
+	values    bool
+	sizes     bool
+}
+
+func newCSVLayout(c csvConfig) (csvLayout, error) {
+	layout := csvLayout{delimiter: ',', values: c.Values, sizes: c.Sizes}
+	if c.Delimiter != "" {
+		delimiter := c.Delimiter
+		if delimiter == `\t` || delimiter == "tab" {
+			delimiter = "\t"
+		}
+		r, size := utf8.DecodeRuneInString(delimiter)
+		if size != len(delimiter) || r == '"' || r == '\\' || r == '\r' || r == '\n' || r == utf8.RuneError {
+			return layout, fmt.Errorf("invalid CSV delimiter %q", c.Delimiter)
+		}
+		layout.delimiter = r
+	}
+	switch c.Escape {
+	case "", "quote":
+	case "backslash":
+		layout.backslash = true
+	default:
+		return layout, fmt.Errorf("unknown CSV escape %q, want quote or backslash", c.Escape)
+	}
+	return layout, nil
+}
+
+// Column names for the first line of every CSV file
+func (l csvLayout) header() []byte {
+	fields := []string{"key"}
+	if l.sizes {
+		fields = append(fields, "size")
+	}
+	if l.values {
+		fields = append(fields, "value")
+	}
+	return l.line(fields)
+}
+
+// One CSV line for key. Binary bytes are shown as [b64:...] runs, as in the value view.
+func (l csvLayout) record(key, value []byte) []byte {
+	fields := []string{mixedContentDisplay(key)}
+	if l.sizes {
+		fields = append(fields, strconv.Itoa(len(value)))
+	}
+	if l.values {
+		fields = append(fields, mixedContentDisplay(value))
+	}
+	return l.line(fields)
+}
+
+func (l csvLayout) line(fields []string) []byte {
+	if l.backslash {
+		escaped := make([]string, len(fields))
+		for i, field := range fields {
+			escaped[i] = l.escapeBackslash(field)
+		}
+		return []byte(strings.Join(escaped, string(l.delimiter)) + "\n")
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Comma = l.delimiter
+	w.Write(fields) // Writes to a buffer cannot fail
+	w.Flush()
+	return buf.Bytes()
+}
+
+// Escape backslashes, line breaks, tabs and the delimiter with a backslash instead of quoting
+func (l csvLayout) escapeBackslash(field string) string {
+	var out strings.Builder
+	for _, r := range field {
+		switch r {
+		case '\\':
+			out.WriteString(`\\`)
+		case '\n':
+			out.WriteString(`\n`)
+		case '\r':
+			out.WriteString(`\r`)
+		case '\t':
+			out.WriteString(`\t`)
+		case l.delimiter:
+			out.WriteRune('\\')
+			out.WriteRune(r)
+		default:
+			out.WriteRune(r)
+		}
+	}
+	return out.String()
+}
+
+// Call fn with the key and value of every line of a CSV export written with
+// this layout. The file needs the header row and a value column.
+func (l csvLayout) scanFile(path string, fn func(key, value []byte) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var next func() ([]string, error)
+	if l.backslash {
+		next = l.backslashReader(file)
+	} else {
+		next = l.quotedReader(file)
+	}
+
+	header, err := next()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	keyColumn, valueColumn := -1, -1
+	for i, name := range header {
+		switch name {
+		case "key":
+			keyColumn = i
+		case "value":
+			valueColumn = i
+		}
+	}
+	if keyColumn < 0 || valueColumn < 0 {
+		return fmt.Errorf("%s: needs key and value columns (export with -csv-values)", path)
+	}
+
+	for line := 2; ; line++ {
+		fields, err := next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if len(fields) <= max(keyColumn, valueColumn) {
+			return fmt.Errorf("%s line %d: %d fields, want %d", path, line, len(fields), len(header))
+		}
+		if err := fn(decodeBinaryRuns(fields[keyColumn]), decodeBinaryRuns(fields[valueColumn])); err != nil {
+			return err
+		}
+	}
+}
+
+func (l csvLayout) quotedReader(r io.Reader) func() ([]string, error) {
+	reader := csv.NewReader(r)
+	reader.Comma = l.delimiter
+	reader.FieldsPerRecord = -1
+	return reader.Read
+}
+
+// Lines split at unescaped delimiters, undoing escapeBackslash
+func (l csvLayout) backslashReader(r io.Reader) func() ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1<<30)
+	return func() ([]string, error) {
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return nil, err
+			}
+			return nil, io.EOF
+		}
+		var fields []string
+		var field strings.Builder
+		escaped := false
+		for _, r := range scanner.Text() {
+			switch {
+			case escaped:
+				escaped = false
+				switch r {
+				case 'n':
+					field.WriteByte('\n')
+				case 'r':
+					field.WriteByte('\r')
+				case 't':
+					field.WriteByte('\t')
+				default:
+					field.WriteRune(r)
+				}
+			case r == '\\':
+				escaped = true
+			case r == l.delimiter:
+				fields = append(fields, field.String())
+				field.Reset()
+			default:
+				field.WriteRune(r)
+			}
+		}
+		if escaped {
+			return nil, errors.New("line ends in a lone backslash")
+		}
+		return append(fields, field.String()), nil
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// The open database: one LevelDB directory, or a shard set read as one keyspace
+type database interface {
+	keySource
+	Get(key []byte, ro *opt.ReadOptions) ([]byte, error)
+	Put(key, value []byte, wo *opt.WriteOptions) error
+	Write(batch *leveldb.Batch, wo *opt.WriteOptions) error
+	SizeOf(ranges []util.Range) (leveldb.Sizes, error)
+	CompactRange(r util.Range) error
+	GetProperty(name string) (string, error)
+	Close() error
+
+	snapshot() (snapshotReader, error)
+}
+
+// Consistent point-in-time view, as returned by GetSnapshot
+type snapshotReader interface {
+	Get(key []byte, ro *opt.ReadOptions) ([]byte, error)
+	NewIterator(slice *util.Range, ro *opt.ReadOptions) iterator.Iterator
+	Release()
+}
+
+// A single LevelDB directory
+type singleDB struct {
+	*leveldb.DB
+}
+
+func (d singleDB) snapshot() (snapshotReader, error) {
+	snap, err := d.GetSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+// Writes are counted in the hot-key heatmap
+func (d singleDB) Put(key, value []byte, wo *opt.WriteOptions) error {
+	if err := d.DB.Put(key, value, wo); err != nil {
+		return err
+	}
+	heat.record(key, false)
+	return nil
+}
+
+func (d singleDB) Write(batch *leveldb.Batch, wo *opt.WriteOptions) error {
+	if err := d.DB.Write(batch, wo); err != nil {
+		return err
+	}
+	return batch.Replay(heat)
+}
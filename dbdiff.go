@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"sync"
+
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Comparing the open database against another, key by key. The fast mode
+// splits the keyspace into ranges of similar size on disk and has workers
+// hash each range of both databases in parallel; only ranges whose hashes
+// differ are walked again to find the keys, and values are only fetched
+// for the keys that differ.
+
+// One difference: '-' only in the open database, '+' only in the other, '~' different values
+type keyDiff struct {
+	kind byte
+	key  []byte
+}
+
+const maxSplitPrefix = 16 // Longest key prefix measured when splitting the keyspace
+
+// Walk both sides of r in key order, passing each difference to fn until it returns false
+func diffRange(a, b keySource, r *util.Range, fn func(keyDiff) bool) error {
+	left, right := a.NewIterator(r, scanReadOptions), b.NewIterator(r, scanReadOptions)
+	defer left.Release()
+	defer right.Release()
+	hasLeft, hasRight := left.Next(), right.Next()
+	for hasLeft || hasRight {
+		if err := interrupted(); err != nil {
+			return err
+		}
+		var d keyDiff
+		switch c := bytes.Compare(left.Key(), right.Key()); {
+		case !hasRight || hasLeft && c < 0:
+			d = keyDiff{'-', append([]byte{}, left.Key()...)}
+			hasLeft = left.Next()
+		case !hasLeft || c > 0:
+			d = keyDiff{'+', append([]byte{}, right.Key()...)}
+			hasRight = right.Next()
+		default:
+			scanRate.wait(left.Key(), left.Value())
+			if !bytes.Equal(left.Value(), right.Value()) {
+				d = keyDiff{'~', append([]byte{}, left.Key()...)}
+			}
+			hasLeft, hasRight = left.Next(), right.Next()
+		}
+		if d.kind != 0 && !fn(d) {
+			break
+		}
+	}
+	if err := left.Error(); err != nil {
+		return err
+	}
+	return right.Error()
+}
+
+// SHA-256 over the length-prefixed keys and values of r
+func rangeHash(src keySource, r *util.Range) ([sha256.Size]byte, error) {
+	var sum [sha256.Size]byte
+	h := sha256.New()
+	iter := src.NewIterator(r, scanReadOptions)
+	defer iter.Release()
+	for iter.Next() {
+		scanRate.wait(iter.Key(), iter.Value())
+		writeLengthPrefixed(h, iter.Key())
+		writeLengthPrefixed(h, iter.Value())
+	}
+	h.Sum(sum[:0])
+	return sum, iter.Error()
+}
+
+func writeLengthPrefixed(h hash.Hash, b []byte) {
+	var n [binary.MaxVarintLen64]byte
+	h.Write(n[:binary.PutUvarint(n[:], uint64(len(b)))])
+	h.Write(b)
+}
+
+// Sizes on disk of the ranges of each prefix+byte; the last one ends where
+// the keyspace does, which SizeOf cannot measure without a limit
+func childSizes(src database, prefix []byte) ([]int64, error) {
+	ranges := make([]util.Range, 256)
+	for b := range ranges {
+		child := append(append([]byte{}, prefix...), byte(b))
+		ranges[b] = *util.BytesPrefix(child)
+		if ranges[b].Limit == nil {
+			ranges[b].Limit = append(child, bytes.Repeat([]byte{0xff}, 16)...)
+		}
+	}
+	sizes, err := src.SizeOf(ranges)
+	if err != nil {
+		return nil, err
+	}
+	return sizes, nil
+}
+
+// Keys splitting the keyspace of src into about parts ranges of similar size on
+// disk, found by measuring ever longer prefixes of the larger ranges
+func diffBoundaries(src database, parts int) ([][]byte, error) {
+	type leaf struct {
+		start []byte
+		size  int64
+	}
+	var leaves []leaf
+	var target int64
+	var expand func(prefix []byte, sizes []int64) error
+	expand = func(prefix []byte, sizes []int64) error {
+		for b, size := range sizes {
+			start := append(append([]byte{}, prefix...), byte(b))
+			if size <= target || len(start) >= maxSplitPrefix {
+				leaves = append(leaves, leaf{start, size})
+				continue
+			}
+			children, err := childSizes(src, start)
+			if err != nil {
+				return err
+			}
+			leaves = append(leaves, leaf{start, 0}) // Keys equal to start sort before its children
+			if err := expand(start, children); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	top, err := childSizes(src, nil)
+	if err != nil {
+		return nil, err
+	}
+	var total int64
+	for _, size := range top {
+		total += size
+	}
+	target = total / int64(parts)
+	if err := expand(nil, top); err != nil {
+		return nil, err
+	}
+
+	var boundaries [][]byte
+	var acc int64
+	for _, l := range leaves {
+		if acc > 0 && acc+l.size > target {
+			boundaries = append(boundaries, l.start)
+			acc = 0
+		}
+		acc += l.size
+	}
+	return boundaries, nil
+}
+
+// Compare src and other in the ranges between boundaries with workers goroutines, hashing
+// both sides of each range at once. Differences are returned in key order,
+// at most limit of them per range when limit is above 0.
+func parallelDiff(src, other database, boundaries [][]byte, workers, limit int, progress func(done, identical, total int)) ([]keyDiff, error) {
+	ranges := make([]*util.Range, len(boundaries)+1)
+	for i := range ranges {
+		ranges[i] = &util.Range{}
+		if i > 0 {
+			ranges[i].Start = boundaries[i-1]
+		}
+		if i < len(boundaries) {
+			ranges[i].Limit = boundaries[i]
+		}
+	}
+
+	results := make([][]keyDiff, len(ranges))
+	errs := make([]error, len(ranges))
+	jobs := make(chan int)
+	var mu sync.Mutex
+	done, identical := 0, 0
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				same, err := rangesEqual(src, other, ranges[i])
+				if err == nil && !same {
+					err = diffRange(src, other, ranges[i], func(d keyDiff) bool {
+						results[i] = append(results[i], d)
+						return limit <= 0 || len(results[i]) < limit
+					})
+				}
+				errs[i] = err
+				mu.Lock()
+				done++
+				if same {
+					identical++
+				}
+				progress(done, identical, len(ranges))
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := range ranges {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	var diffs []keyDiff
+	for i := range ranges {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		diffs = append(diffs, results[i]...)
+	}
+	return diffs, nil
+}
+
+// Hash r in both databases concurrently
+func rangesEqual(a, b keySource, r *util.Range) (bool, error) {
+	var hashB [sha256.Size]byte
+	var errB error
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		hashB, errB = rangeHash(b, r)
+	}()
+	hashA, errA := rangeHash(a, r)
+	wg.Wait()
+	if errA != nil {
+		return false, errA
+	}
+	if errB != nil {
+		return false, errB
+	}
+	return hashA == hashB, nil
+}
+
+// Text of a difference, with both values when withValues is set; values
+// are only read here, for the keys that differ
+func formatKeyDiff(other database, d keyDiff, withValues bool) string {
+	line := fmt.Sprintf("%c %s", d.kind, mixedContentDisplay(d.key))
+	if !withValues {
+		return line
+	}
+	if d.kind != '+' {
+		if value, err := browseReader().Get(d.key, nil); err == nil {
+			line += "\n  - " + mixedContentDisplay(value)
+		}
+	}
+	if d.kind != '-' {
+		if value, err := other.Get(d.key, nil); err == nil {
+			line += "\n  + " + mixedContentDisplay(value)
+		}
+	}
+	return line
+}
@@ -0,0 +1,434 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// The auto value format runs a value through a chain of decoders: the
+// decompress stage undoes a compression, then every decoder of the decode
+// stage tries the result and says how confident it is that the value is in
+// its encoding, and the most confident rendering wins, earlier decoders
+// winning ties. Values no decoder claims are pretty-printed by formatValue.
+// The "decoders" section of the config file picks and orders both stages,
+// and can map keys to one decoder outright.
+
+type valueDecompressor struct {
+	name       string
+	decompress func(value []byte) ([]byte, bool)
+}
+
+type valueDecoder struct {
+	name string
+	// Rendering of value and confidence from 1 to 100; 0 when value is not in this encoding
+	decode func(key, value []byte) (string, int)
+}
+
+var decompressors = []valueDecompressor{
+	{"gzip", gunzip},
+	{"zstd", unzstd},
+	{"snappy", unsnappy},
+}
+
+var decoders = []valueDecoder{
+	{"localstorage", decodeLocalStorageStage},
+	{"avro", decodeAvroStage},
+	{"protobuf", decodeProtoStage},
+	{"v8", decodeV8Stage},
+	{"bedrock", decodeBedrockStage},
+	{"geth", decodeGethStage},
+	{"ipfs", decodeIPFSStage},
+	{"uuid", decodeIDStage},
+	{"charset", decodeCharsetStage},
+	{"bson", decodeBSONStage},
+	{"json", decodeJSONStage},
+	{"msgpack", decodeMsgpackStage},
+	{"cbor", decodeCBORStage},
+}
+
+var (
+	decompressChain = decompressors
+	decodeChain     = decoders
+	decoderOverride = "" // Decoder picked with @ for the auto format; "" for the best match
+
+	viewDecoder    string // Decoder of the value shown in auto format, "" when none matched
+	viewConfidence int
+)
+
+type decodersConfig struct {
+	Decompress []string         `json:"decompress"` // Codecs tried in order; default gzip, zstd, snappy
+	Decode     []string         `json:"decode"`     // Decoders tried; the order breaks confidence ties
+	Mappings   []decoderMapping `json:"mappings"`   // Keys decoded with one decoder; the first match wins
+}
+
+// Keys starting with Prefix and matching Regex (either may be left out) are
+// decoded with Decoder: a value format or decoder name, protobuf:<message>,
+// avro:<schema file> or charset:<name>
+type decoderMapping struct {
+	Prefix  string `json:"prefix"` // Written like keys (0x hex and b64: allowed)
+	Regex   string `json:"regex"`  // Matched against the raw key bytes
+	Decoder string `json:"decoder"`
+}
+
+// A mapping resolved by setupDecoderMappings
+type decoderRoute struct {
+	prefix []byte
+	regex  *regexp.Regexp
+	name   string
+	decode func(key, value []byte) (string, int)
+}
+
+var decoderRoutes []decoderRoute
+
+// Build the chain from the config file's decoders section; an absent list
+// keeps every decoder in the default order
+func setupDecoderChain(c decodersConfig) error {
+	if c.Decompress != nil {
+		decompressChain = nil
+	next:
+		for _, name := range c.Decompress {
+			for _, d := range decompressors {
+				if d.name == name {
+					decompressChain = append(decompressChain, d)
+					continue next
+				}
+			}
+			names := make([]string, len(decompressors))
+			for i, d := range decompressors {
+				names[i] = d.name
+			}
+			return fmt.Errorf("decoders: unknown decompressor %q, want one of %s", name, strings.Join(names, ", "))
+		}
+	}
+	if c.Decode != nil {
+		decodeChain = nil
+	nextDecoder:
+		for _, name := range c.Decode {
+			for _, d := range decoders {
+				if d.name == name {
+					decodeChain = append(decodeChain, d)
+					continue nextDecoder
+				}
+			}
+			return fmt.Errorf("decoders: unknown decoder %q, want one of %s", name, strings.Join(decoderNames(decoders), ", "))
+		}
+	}
+	return nil
+}
+
+// Whether a decoder mapping of the config file names a decoder of kind, like "protobuf"
+func decoderMappingsUse(kind string) bool {
+	for _, m := range cfg.Decoders.Mappings {
+		if strings.HasPrefix(m.Decoder, kind+":") {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve the config file's decoder mappings; protobuf message types need
+// the descriptor set, so this runs after setupProtoTypes
+func setupDecoderMappings() error {
+	for _, m := range cfg.Decoders.Mappings {
+		route := decoderRoute{name: m.Decoder}
+		var err error
+		if route.prefix, _, err = parseKeyInput(m.Prefix); err != nil {
+			return fmt.Errorf("decoder mapping %s: %w", m.Decoder, err)
+		}
+		if m.Regex != "" {
+			if route.regex, err = regexp.Compile(m.Regex); err != nil {
+				return fmt.Errorf("decoder mapping %s: %w", m.Decoder, err)
+			}
+		}
+		if route.decode, err = mappedDecoder(m.Decoder); err != nil {
+			return fmt.Errorf("decoder mapping: %w", err)
+		}
+		decoderRoutes = append(decoderRoutes, route)
+	}
+	return nil
+}
+
+// Decode function for a mapping's decoder. Value formats always render, so
+// a mapped value is shown the way the viewer shows it after pressing f.
+func mappedDecoder(name string) (func(key, value []byte) (string, int), error) {
+	kind, arg, _ := strings.Cut(name, ":")
+	switch kind {
+	case "protobuf":
+		if arg == "" {
+			break
+		}
+		if protoTypeRegistry == nil {
+			return nil, fmt.Errorf("%s needs a descriptor set (-proto-desc or protobuf.descriptor_set in the config file)", name)
+		}
+		msg, ok := protoTypeRegistry.messages[strings.TrimPrefix(arg, ".")]
+		if !ok {
+			return nil, fmt.Errorf("message type %q is not in the descriptor set", arg)
+		}
+		return func(key, value []byte) (string, int) {
+			text, ok := decodeProtoAs(msg, value)
+			return text, protoConfidence(text, ok)
+		}, nil
+	case "charset":
+		enc, err := lookupCharset(arg)
+		if err != nil {
+			return nil, err
+		}
+		return func(key, value []byte) (string, int) {
+			if text, _ := decodeCharset(enc, value); text != nil {
+				return defaultFormatter{}.format(text), 100
+			}
+			return "", 0
+		}, nil
+	case "avro":
+		schema, err := loadAvroSchema(arg)
+		if err != nil {
+			return nil, err
+		}
+		return func(key, value []byte) (string, int) {
+			if text, ok := decodeAvroAs(schema, value); ok {
+				return text, 95
+			}
+			return "", 0
+		}, nil
+	}
+	for _, f := range viewFormats {
+		if f.name != name || f.formatter == nil {
+			continue
+		}
+		formatter := f.formatter
+		return func(key, value []byte) (string, int) {
+			if kf, ok := formatter.(keyValueFormatter); ok {
+				return kf.formatKey(key, value), 100
+			}
+			return formatter.format(value), 100
+		}, nil
+	}
+	for _, d := range decoders {
+		if d.name == name {
+			return d.decode, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown decoder %q, want protobuf:<message>, avro:<schema file>, charset:<name> or one of %s", name, strings.Join(mappableNames(), ", "))
+}
+
+func mappableNames() []string {
+	var names []string
+	for _, f := range viewFormats {
+		if f.formatter != nil {
+			names = append(names, f.name)
+		}
+	}
+	for _, d := range decoders {
+		if !slices.Contains(names, d.name) {
+			names = append(names, d.name)
+		}
+	}
+	return names
+}
+
+// Mapping for key, or nil
+func decoderRouteFor(key []byte) *decoderRoute {
+	for i, r := range decoderRoutes {
+		if bytes.HasPrefix(key, r.prefix) && (r.regex == nil || r.regex.Match(key)) {
+			return &decoderRoutes[i]
+		}
+	}
+	return nil
+}
+
+func decoderNames(chain []valueDecoder) []string {
+	names := make([]string, len(chain))
+	for i, d := range chain {
+		names[i] = d.name
+	}
+	return names
+}
+
+// Decompress value and render it with the decoder its key is mapped to, or
+// else with the most confident decoder of the chain, or with the decoder
+// picked with @; decoder is "" when none matched
+func decodeValue(key, value []byte) (text, decoder string, confidence int) {
+	if data, _, ok := decompressValue(value); ok {
+		value = data
+	}
+	if route := decoderRouteFor(key); route != nil && decoderOverride == "" {
+		if text, confidence := route.decode(key, value); confidence > 0 {
+			return text, route.name, confidence
+		}
+	}
+	return decodeWithChain(key, value)
+}
+
+// Render value with the most confident decoder of the chain, or with the
+// decoder picked with @
+func decodeWithChain(key, value []byte) (text, decoder string, confidence int) {
+	for _, d := range decodeChain {
+		if decoderOverride != "" && d.name != decoderOverride {
+			continue
+		}
+		if t, c := d.decode(key, value); c > confidence {
+			text, decoder, confidence = t, d.name, c
+		}
+	}
+	if decoder == "" {
+		text = formatValue(value)
+	}
+	return text, decoder, confidence
+}
+
+// Confidences: a key mapping plus a clean decode beats structure alone, and
+// self-describing structure (length prefixes, magic) beats loose parses
+
+func decodeLocalStorageStage(key, value []byte) (string, int) {
+	if text, ok := decodeLocalStorageValue(key, value); ok {
+		return formatValue([]byte(text)), 100
+	}
+	return "", 0
+}
+
+func decodeAvroStage(key, value []byte) (string, int) {
+	if text, ok := decodeAvroValue(key, value); ok {
+		return text, 95
+	}
+	return "", 0
+}
+
+// A value that decodes as its mapped message type, then one that does not
+// but is still wire format, then wire format under unmapped keys
+func decodeProtoStage(key, value []byte) (string, int) {
+	text, ok := decodeProtoValue(key, value)
+	if ok && protoTypeFor(key) == nil {
+		return text, 20
+	}
+	return text, protoConfidence(text, ok)
+}
+
+func protoConfidence(text string, ok bool) int {
+	switch {
+	case !ok:
+		return 0
+	case strings.HasPrefix(text, "# Not a valid "):
+		return 85
+	}
+	return 95
+}
+
+func decodeIDStage(key, value []byte) (string, int) {
+	if len(value) == 16 && !isPrintableText(value) {
+		return formatID(value), 82
+	}
+	return "", 0
+}
+
+// Records of IndexedDB object stores in -indexeddb mode, or values with a
+// V8 serialization header
+func decodeV8Stage(key, value []byte) (string, int) {
+	if text, ok := decodeIndexedDBValue(key, value); ok {
+		return text, 90
+	}
+	if len(value) > 2 && value[0] == 0xff {
+		if text, err := decodeV8Value(value); err == nil {
+			return text, 40
+		}
+	}
+	return "", 0
+}
+
+// Actor digests and NBT records of Minecraft Bedrock worlds in -bedrock mode
+func decodeBedrockStage(key, value []byte) (string, int) {
+	if !bedrockWorld {
+		return "", 0
+	}
+	if text, ok := decodeBedrockDigest(key, value); ok {
+		return text, 100
+	}
+	if text, ok := decodeNBTValue(value); ok {
+		return text, 90
+	}
+	return "", 0
+}
+
+// RLP values of recognised go-ethereum keys in -geth mode
+func decodeGethStage(key, value []byte) (string, int) {
+	if text, ok := decodeGethValue(key, value); ok {
+		return text, 95
+	}
+	return "", 0
+}
+
+// dag-pb blocks, IPNS and address book records of recognised IPFS keys in -ipfs mode
+func decodeIPFSStage(key, value []byte) (string, int) {
+	if text, ok := decodeIPFSValue(key, value); ok {
+		return text, 95
+	}
+	return "", 0
+}
+
+func decodeBSONStage(key, value []byte) (string, int) {
+	if looksLikeBSON(value) {
+		return bsonFormatter{}.format(value), 80
+	}
+	return "", 0
+}
+
+func decodeJSONStage(key, value []byte) (string, int) {
+	if json.Valid(value) {
+		return formatValue(value), 70
+	}
+	return "", 0
+}
+
+func decodeMsgpackStage(key, value []byte) (string, int) {
+	if looksLikeMsgpack(value) {
+		return msgpackFormatter{}.format(value), 60
+	}
+	return "", 0
+}
+
+func decodeCBORStage(key, value []byte) (string, int) {
+	if looksLikeCBOR(value) {
+		return cborFormatter{}.format(value), 55
+	}
+	return "", 0
+}
+
+// Cycle the decoder of the auto format between the best match and each
+// decoder of the chain, and redraw the selection
+func cycleDecoder() {
+	names := append([]string{""}, decoderNames(decodeChain)...)
+	next := 0
+	for i, name := range names {
+		if name == decoderOverride {
+			next = (i + 1) % len(names)
+		}
+	}
+	decoderOverride = names[next]
+	if currentKey != nil {
+		showKeyValue(currentKey)
+	}
+	status := "[green]Decoder: best match"
+	if decoderOverride != "" {
+		status = "[green]Decoder: " + decoderOverride
+	}
+	if viewFormats[viewFormat].formatter != nil {
+		status += " [gray](used by the auto value format)[-]"
+	}
+	setStatus(status)
+}
+
+// Value header line naming the decoder of the value shown in auto format
+func decoderHeaderNote() string {
+	switch {
+	case viewDecoder == "charset":
+		return fmt.Sprintf("[gray](decoded as %s text, confidence %d; $ picks the charset, @ the decoder)[-]", valueCharset, viewConfidence)
+	case viewDecoder != "":
+		return fmt.Sprintf("[gray](decoded as %s, confidence %d; @ picks the decoder)[-]", viewDecoder, viewConfidence)
+	case decoderOverride != "":
+		return fmt.Sprintf("[yellow](not %s; @ picks the decoder)[-]", decoderOverride)
+	}
+	return ""
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Content-addressed exports (.dedup): every distinct value is written once,
+// as a line with its SHA-256 and bytes, and every key as a line naming the
+// hash of its value. Databases where many keys share a few values (flags,
+// empty objects, repeated blobs) shrink to little more than their keys.
+// A value line always comes before the first key line that refers to it,
+// so the file is read in one pass.
+
+// One line of a dedup export: a value when ValueB64 is set, otherwise a key
+type dedupRecord struct {
+	Key      string  `json:"key,omitempty"`
+	KeyB64   string  `json:"key_b64,omitempty"`
+	SHA256   string  `json:"sha256"`
+	ValueB64 *string `json:"value_b64,omitempty"`
+}
+
+// Hashes of the values written so far
+type dedupWriter struct {
+	seen map[[sha256.Size]byte]bool
+}
+
+func newDedupWriter() *dedupWriter {
+	return &dedupWriter{seen: make(map[[sha256.Size]byte]bool)}
+}
+
+// Lines for key: its value's line the first time the value is seen, then the key's
+func (w *dedupWriter) record(key, value []byte) ([]byte, error) {
+	sum := sha256.Sum256(value)
+	hash := hex.EncodeToString(sum[:])
+	var out []byte
+	if !w.seen[sum] {
+		w.seen[sum] = true
+		encoded := base64.StdEncoding.EncodeToString(value)
+		line, err := json.Marshal(dedupRecord{SHA256: hash, ValueB64: &encoded})
+		if err != nil {
+			return nil, err
+		}
+		out = append(line, '\n')
+	}
+	line, err := json.Marshal(dedupRecord{
+		Key:    mixedContentDisplay(key),
+		KeyB64: base64.StdEncoding.EncodeToString(key),
+		SHA256: hash,
+	})
+	return append(append(out, line...), '\n'), err
+}
+
+// Call fn with the exact key and value of every key line of a dedup export
+// until it returns false. The distinct values are held in memory.
+func scanDedupExport(path string, fn func(key, value []byte) bool) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	values := make(map[string][]byte)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1<<30)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var record dedupRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return fmt.Errorf("%s line %d: %w", path, line, err)
+		}
+		if record.ValueB64 != nil {
+			value, err := base64.StdEncoding.DecodeString(*record.ValueB64)
+			if err != nil {
+				return fmt.Errorf("%s line %d: value_b64: %w", path, line, err)
+			}
+			if sum := sha256.Sum256(value); hex.EncodeToString(sum[:]) != record.SHA256 {
+				return fmt.Errorf("%s line %d: value does not match its sha256", path, line)
+			}
+			values[record.SHA256] = value
+			continue
+		}
+		key, err := base64.StdEncoding.DecodeString(record.KeyB64)
+		if err != nil {
+			return fmt.Errorf("%s line %d: key_b64: %w", path, line, err)
+		}
+		value, ok := values[record.SHA256]
+		if !ok {
+			return fmt.Errorf("%s line %d: no value with sha256 %s before this key", path, line, record.SHA256)
+		}
+		if !fn(key, value) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+var markedKeys = make(map[string]bool) // Keys marked with space for multi-delete
+
+// Key list entry, with markers for keys picked for multi-delete, staged changes, tombstones and notes
+func listItemText(i int) string {
+	key := displayedKeys[i]
+	text := listKeyText(i)
+	if isListedSoftDeleted(key) {
+		text = "[gray]" + text + "[-]"
+	}
+	if watchMarks[string(key)] == '-' {
+		text = "[::s]" + text + "[::-]"
+	}
+	text += shardLabel(key) + watchLabel(key)
+	if _, ok := noteFor(key); ok {
+		text += " [yellow](note)[-]"
+	}
+	text = pendingMarker(key) + text
+	if markedKeys[string(key)] {
+		return "[yellow]*[-] " + text
+	}
+	return text
+}
+
+// Redraw row i of the key list, unless the list was replaced meanwhile and is shorter
+func refreshListItem(i int) {
+	if i < len(displayedKeys) {
+		keyList.SetItemText(i, listItemText(i), "")
+	}
+}
+
+// Mark or unmark the selected key and move to the next one
+func toggleMark() {
+	currentIndex := keyList.GetCurrentItem()
+	if currentIndex < 0 || currentIndex >= len(displayedKeys) {
+		return
+	}
+	key := displayedKeys[currentIndex]
+	if markedKeys[string(key)] {
+		delete(markedKeys, string(key))
+	} else {
+		markedKeys[string(key)] = true
+	}
+	refreshListItem(currentIndex)
+	if currentIndex+1 < keyList.GetItemCount() {
+		keyList.SetCurrentItem(currentIndex + 1)
+	}
+	setStatus(fmt.Sprintf("[green]%d keys marked", len(markedKeys)))
+}
+
+// Delete the marked keys, or the selected key when none are marked, after confirmation.
+// While staging the deletes are staged instead, without asking.
+func confirmDelete() {
+	if refuseWrite() {
+		return
+	}
+	var keys [][]byte
+	for key := range markedKeys {
+		keys = append(keys, []byte(key))
+	}
+	if len(keys) == 0 {
+		currentIndex := keyList.GetCurrentItem()
+		if currentIndex < 0 || currentIndex >= len(displayedKeys) {
+			setStatus("[red]Invalid selection")
+			return
+		}
+		keys = [][]byte{displayedKeys[currentIndex]}
+	}
+
+	if stagingMode {
+		for _, key := range keys {
+			stageDelete(key)
+			delete(markedKeys, string(key))
+		}
+		rebuildKeyList(keyList.GetCurrentItem())
+		setStatus(fmt.Sprintf("[green]Staged %d deletes", len(keys)))
+		return
+	}
+
+	text := fmt.Sprintf("Delete %s?", displayKey(keys[0]))
+	if len(keys) > 1 {
+		text = fmt.Sprintf("Delete %d marked keys?", len(keys))
+	}
+	showConfirm("delete", text, "Delete", func() {
+		if err := deleteKeys(keys); err != nil {
+			setStatus(fmt.Sprintf("[red]Error deleting: %v", err))
+			return
+		}
+		removeFromKeyList(keys)
+		setStatus(fmt.Sprintf("[green]Deleted %d keys", len(keys)))
+	})
+}
+
+// Delete keys in one batch
+func deleteKeys(keys [][]byte) error {
+	batch := new(leveldb.Batch)
+	for _, key := range keys {
+		batch.Delete(key)
+	}
+	if err := db.Write(batch, nil); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		recordAction("delete", key, "")
+		valueLRU.remove(key)
+		delete(markedKeys, string(key))
+	}
+	repinSnapshot()
+	return nil
+}
+
+// Drop deleted keys from the list, keeping the selection on the entry that followed them
+func removeFromKeyList(keys [][]byte) {
+	deleted := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		deleted[string(key)] = true
+	}
+	if pinnedKey != nil && deleted[string(pinnedKey)] {
+		togglePinnedKey()
+	}
+
+	currentIndex := keyList.GetCurrentItem()
+	remaining := make([][]byte, 0, len(displayedKeys))
+	selected := 0
+	for i, key := range displayedKeys {
+		if deleted[string(key)] {
+			continue
+		}
+		if i < currentIndex {
+			selected++
+		}
+		remaining = append(remaining, key)
+	}
+
+	if len(remaining) == 0 {
+		loadInitialKeys()
+		return
+	}
+	displayedKeys = remaining
+	rebuildKeyList(selected)
+}
+
+// Redraw every list entry from displayedKeys and select the entry at index
+func rebuildKeyList(index int) {
+	keyList.Clear()
+	for i := range displayedKeys {
+		keyList.AddItem(listItemText(i), "", 0, nil)
+	}
+	if len(displayedKeys) == 0 {
+		updateKeyListTitle()
+		return
+	}
+	keyList.SetCurrentItem(min(index, len(displayedKeys)-1))
+	currentKey = displayedKeys[keyList.GetCurrentItem()]
+	showKeyValue(currentKey)
+	updateKeyListTitle()
+}
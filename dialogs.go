@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// Show p as a centered dialog page over the main layout
+func showDialog(name string, p tview.Primitive, width, height int) {
+	centered := tview.NewFlex().
+		AddItem(nil, 0, 1, false).
+		AddItem(tview.NewFlex().SetDirection(tview.FlexRow).
+			AddItem(nil, 0, 1, false).
+			AddItem(p, height, 0, true).
+			AddItem(nil, 0, 1, false), width, 0, true).
+		AddItem(nil, 0, 1, false)
+	pages.AddPage(name, centered, true, true)
+	app.SetFocus(p)
+}
+
+// Remove a dialog page and return focus to the key list
+func closeDialog(name string) {
+	pages.RemovePage(name)
+	app.SetFocus(keyList)
+}
+
+// Ask a yes/no question in a modal; onConfirm runs only when the confirm button is chosen
+func showConfirm(name, text, button string, onConfirm func()) {
+	modal := tview.NewModal().
+		SetText(text).
+		AddButtons([]string{button, "Cancel"}).
+		SetDoneFunc(func(index int, label string) {
+			closeDialog(name)
+			if label == button {
+				onConfirm()
+			}
+		})
+	modal.SetFocus(1) // Default to Cancel
+	pages.AddPage(name, modal, true, true)
+	app.SetFocus(modal)
+}
+
+// Styled single-line input used by the dialogs
+func newDialogInput(label string) *tview.InputField {
+	input := tview.NewInputField().SetLabel(label)
+	input.SetLabelStyle(tcell.StyleDefault.Foreground(tcell.ColorWhite).Background(tcell.ColorReset))
+	input.SetFieldStyle(tcell.StyleDefault.Foreground(tcell.ColorWhite).Background(tcell.ColorReset))
+	input.SetBackgroundColor(tcell.ColorReset)
+	return input
+}
+
+// Quick existence check for a typed key, without loading its value
+func showExistsDialog() {
+	input := newDialogInput(" Key: ")
+	result := tview.NewTextView().SetDynamicColors(true)
+	result.SetBackgroundColor(tcell.ColorReset)
+	result.SetText("[white]Enter a key and press Enter, Esc to close")
+
+	layout := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(input, 1, 0, true).
+		AddItem(result, 1, 0, false)
+	layout.SetBorder(true).SetTitle(" Key exists? ")
+	layout.SetTitleAlign(tview.AlignLeft)
+	layout.SetTitleColor(tcell.ColorYellow)
+	layout.SetBackgroundColor(tcell.ColorReset)
+
+	input.SetDoneFunc(func(key tcell.Key) {
+		if key == tcell.KeyEsc {
+			closeDialog("exists")
+			return
+		}
+		if key != tcell.KeyEnter || input.GetText() == "" {
+			return
+		}
+
+		typed, _, err := parseKeyInput(input.GetText())
+		if err != nil {
+			result.SetText(fmt.Sprintf("[red]%v", err))
+			return
+		}
+		recordAction("exists", typed, "")
+		found, size, err := probeKey(typed)
+		switch {
+		case err != nil:
+			result.SetText(fmt.Sprintf("[red]Error: %v", err))
+		case found:
+			result.SetText(fmt.Sprintf("[green]Found[-], value is %d bytes", size))
+		default:
+			result.SetText("[red]Not found")
+		}
+	})
+
+	showDialog("exists", layout, 60, 4)
+}
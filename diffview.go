@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+// The diff command in the viewer: = (or -cmd 'diff <path>') compares the
+// open database with another in the background and lists the keys only
+// here, only there or with different values; selecting one shows both
+// values side by side with the changed lines highlighted.
+
+const maxViewDiffs = 100000 // Differences listed before the comparison stops
+
+// Ask for the database to compare with, offering the next tab's
+func showDiffDialog() {
+	if refuseHostAccess() {
+		return
+	}
+	input := newDialogInput(" Compare with database: ")
+	if len(tabs) > 1 {
+		input.SetText(tabs[(activeTab+1)%len(tabs)].path)
+	}
+	input.SetDoneFunc(func(key tcell.Key) {
+		closeDialog("diff")
+		if key != tcell.KeyEnter || strings.TrimSpace(input.GetText()) == "" {
+			return
+		}
+		if err := startDatabaseDiff(strings.TrimSpace(input.GetText())); err != nil {
+			setStatus(fmt.Sprintf("[red]Error: %v", err))
+		}
+	})
+	showDialog("diff", input, 80, 3)
+}
+
+// Compare the open database with the one at path in the background, then list the differences
+func startDatabaseDiff(path string) error {
+	mine := db
+	var other database
+	closeOther := func() {}
+	for _, t := range tabs {
+		if sameFile(t.path, path) {
+			other = t.db
+		}
+	}
+	if other == mine {
+		return fmt.Errorf("%s is the open database", path)
+	}
+	if other == nil {
+		opened, err := leveldb.OpenFile(path, budgetOptions(&opt.Options{ReadOnly: true}))
+		if err != nil {
+			return openErrorHint(err)
+		}
+		other = singleDB{opened}
+		closeOther = func() { other.Close() }
+	}
+
+	enqueueTask("Diff with "+filepath.Base(path), func(progress func(string)) (string, error) {
+		var diffs []keyDiff
+		size := 0
+		err := diffRange(mine, other, nil, func(d keyDiff) bool {
+			diffs = append(diffs, d)
+			size += len(d.key)
+			if len(diffs)%1000 == 0 {
+				progress(fmt.Sprintf("%d differences", len(diffs)))
+			}
+			return len(diffs) < maxViewDiffs && (resultBudget() == 0 || size < resultBudget())
+		})
+		if err != nil {
+			closeOther()
+			return "", err
+		}
+		app.QueueUpdateDraw(func() { showDiffView(mine, other, path, diffs, closeOther) })
+		return fmt.Sprintf("%d differences with %s", len(diffs), path), nil
+	})
+	return nil
+}
+
+// Total size of the keys of diffs
+func diffKeyBytes(diffs []keyDiff) int {
+	size := 0
+	for _, d := range diffs {
+		size += len(d.key)
+	}
+	return size
+}
+
+// Whether two paths name the same file or directory
+func sameFile(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
+
+// Value of key in d for a diff pane
+func diffPaneVersion(d database, key []byte) mergeVersion {
+	value, err := d.Get(key, nil)
+	if err != nil {
+		return mergeVersion{}
+	}
+	return mergeVersion{true, value}
+}
+
+func showDiffView(mine, other database, path string, diffs []keyDiff, closeOther func()) {
+	counts := map[byte]int{}
+	for _, d := range diffs {
+		counts[d.kind]++
+	}
+
+	list := tview.NewList().SetWrapAround(false).ShowSecondaryText(false)
+	list.SetBorder(true)
+	title := fmt.Sprintf(" Diff with %s: %d only here, %d only there, %d differ", tview.Escape(path), counts['-'], counts['+'], counts['~'])
+	if len(diffs) >= maxViewDiffs {
+		title += fmt.Sprintf(" (first %d)", maxViewDiffs)
+	} else if size := diffKeyBytes(diffs); resultBudget() != 0 && size >= resultBudget() {
+		title += fmt.Sprintf(" (first %d, -max-memory reached)", len(diffs))
+	}
+	list.SetTitle(title + " (Enter: go to key, Esc: close) ")
+	list.SetTitleAlign(tview.AlignLeft)
+	list.SetTitleColor(tcell.ColorYellow)
+	list.SetBackgroundColor(tcell.ColorReset)
+	list.SetSelectedBackgroundColor(tcell.ColorWhite)
+	list.SetHighlightFullLine(true)
+
+	newPane := func(title string) *tview.TextView {
+		pane := tview.NewTextView()
+		pane.SetDynamicColors(true).SetBorder(true).SetTitle(title)
+		pane.SetTitleColor(tcell.ColorYellow)
+		pane.SetTitleAlign(tview.AlignLeft)
+		pane.SetScrollable(true).SetWrap(false)
+		pane.SetBackgroundColor(tcell.ColorReset)
+		pane.SetTextColor(tcell.ColorWhite)
+		return pane
+	}
+	herePane := newPane(" Here ")
+	therePane := newPane(fmt.Sprintf(" %s ", tview.Escape(path)))
+
+	colors := map[byte]string{'-': "red", '+': "green", '~': "yellow"}
+	for _, d := range diffs {
+		list.AddItem(fmt.Sprintf("[%s]%c[-] %s", colors[d.kind], d.kind, displayKey(d.key)), "", 0, nil)
+	}
+
+	showDiff := func(index int) {
+		if index < 0 || index >= len(diffs) {
+			return
+		}
+		key := diffs[index].key
+		here, there := diffPaneVersion(mine, key), diffPaneVersion(other, key)
+		ops := diffLines(strings.Split(formatMergeVersion(here), "\n"), strings.Split(formatMergeVersion(there), "\n"))
+		var hereText, thereText strings.Builder
+		writeAlignedDiff(ops, &hereText, &thereText)
+		herePane.SetText(hereText.String()).ScrollToBeginning()
+		therePane.SetText(thereText.String()).ScrollToBeginning()
+	}
+	list.SetChangedFunc(func(index int, mainText string, secondaryText string, shortcut rune) {
+		showDiff(index)
+	})
+
+	closeView := func() {
+		pages.RemovePage("dbdiff")
+		app.SetFocus(keyList)
+		closeOther()
+	}
+	list.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyEsc:
+			closeView()
+			return nil
+		case tcell.KeyEnter:
+			i := list.GetCurrentItem()
+			if i < 0 || i >= len(diffs) || diffs[i].kind == '+' || mine != db {
+				return nil // Only keys of the open database can be shown in its list
+			}
+			closeView()
+			if err := seekToKey(diffs[i].key); err != nil {
+				setStatus(fmt.Sprintf("[red]Error: %v", err))
+			}
+			return nil
+		}
+		return event
+	})
+
+	layout := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(list, 0, 1, true).
+		AddItem(tview.NewFlex().
+			AddItem(herePane, 0, 1, false).
+			AddItem(therePane, 0, 1, false), 0, 2, false)
+	pages.AddPage("dbdiff", layout, true, true)
+	app.SetFocus(list)
+	showDiff(0)
+}
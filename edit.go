@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// Values that can be edited as they are: valid UTF-8 with no control
+// characters other than line breaks and tabs
+func isPlainText(value []byte) bool {
+	if !utf8.Valid(value) {
+		return false
+	}
+	for _, r := range string(value) {
+		if unicode.IsControl(r) && r != '\n' && r != '\r' && r != '\t' {
+			return false
+		}
+	}
+	return true
+}
+
+// Binary values are edited as hex, 16 bytes per line: unlike the [b64:...]
+// runs of the value view, it cannot be confused with text inside the value
+const hexEditWidth = 16
+
+func hexEditText(value []byte) string {
+	var text strings.Builder
+	for i := 0; i < len(value); i += hexEditWidth {
+		if i > 0 {
+			text.WriteByte('\n')
+		}
+		line := value[i:min(i+hexEditWidth, len(value))]
+		for j, b := range line {
+			if j > 0 {
+				text.WriteByte(' ')
+			}
+			fmt.Fprintf(&text, "%02x", b)
+		}
+	}
+	return text.String()
+}
+
+// Bytes of hex edit text; whitespace between digits is ignored
+func parseHexEditText(text string) ([]byte, error) {
+	digits := strings.Join(strings.Fields(text), "")
+	value, err := hex.DecodeString(digits)
+	if err != nil {
+		return nil, fmt.Errorf("not hex: %w", err)
+	}
+	return value, nil
+}
+
+// Open the selected key's value in a text area and write the result back with db.Put.
+// Values that are not plain text are edited as hex.
+func editCurrentKey() {
+	if refuseWrite() {
+		return
+	}
+	currentIndex := keyList.GetCurrentItem()
+	if currentIndex < 0 || currentIndex >= len(displayedKeys) {
+		setStatus("[red]Invalid selection")
+		return
+	}
+	key := displayedKeys[currentIndex]
+
+	value, staged := stagedValue(key)
+	if !staged {
+		var err error
+		if value, err = browseReader().Get(key, nil); err != nil {
+			setStatus(fmt.Sprintf("[red]Error: %v", err))
+			return
+		}
+	}
+	plain := isPlainText(value)
+	text, title := string(value), "Edit"
+	if !plain {
+		text, title = hexEditText(value), "Edit (hex)"
+	}
+
+	editor := tview.NewTextArea()
+	editor.SetText(text, false)
+	editor.SetBorder(true).SetTitle(fmt.Sprintf(" %s %s (Ctrl+S: save, Esc: cancel) ", title, displayKey(key)))
+	editor.SetTitleAlign(tview.AlignLeft)
+	editor.SetTitleColor(tcell.ColorYellow)
+	editor.SetBackgroundColor(tcell.ColorReset)
+	editor.SetTextStyle(tcell.StyleDefault.Foreground(tcell.ColorWhite).Background(tcell.ColorReset))
+
+	closeEditor := func() {
+		pages.RemovePage("edit")
+		app.SetFocus(keyList)
+	}
+
+	editor.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyEsc:
+			closeEditor()
+			setStatus("[white]Edit cancelled")
+			return nil
+		case tcell.KeyCtrlS:
+			if editor.GetText() == text {
+				closeEditor()
+				setStatus("[white]No changes")
+				return nil
+			}
+			newValue := []byte(editor.GetText())
+			if !plain {
+				var err error
+				if newValue, err = parseHexEditText(editor.GetText()); err != nil {
+					setStatus(fmt.Sprintf("[red]Error: %v", err))
+					return nil
+				}
+			}
+			if bytes.Equal(newValue, value) {
+				closeEditor()
+				setStatus("[white]No changes")
+				return nil
+			}
+			if stagingMode {
+				stagePut(key, newValue)
+				refreshListItem(currentIndex)
+				closeEditor()
+				showKeyValue(key)
+				setStatus(fmt.Sprintf("[green]Staged %d bytes for %s", len(newValue), displayKey(key)))
+				return nil
+			}
+			if err := db.Put(key, newValue, nil); err != nil {
+				setStatus(fmt.Sprintf("[red]Error writing value: %v", err))
+				return nil
+			}
+			recordAction("edit", key, "")
+			valueLRU.remove(key)
+			repinSnapshot()
+			noteSoftDeleted(key, newValue)
+			refreshListItem(currentIndex)
+			closeEditor()
+			showKeyValue(key)
+			setStatus(fmt.Sprintf("[green]Saved %d bytes to %s", len(newValue), displayKey(key)))
+			return nil
+		}
+		return event
+	})
+
+	pages.AddPage("edit", editor, true, true)
+	app.SetFocus(editor)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestHexEditRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		value []byte
+	}{
+		{"empty", []byte{}},
+		{"one byte", []byte{0x00}},
+		{"literal binary run text", []byte("a\x00 literal [b64:QUJD] text")},
+		{"exactly one line", bytes.Repeat([]byte{0xab}, hexEditWidth)},
+		{"several lines", bytes.Repeat([]byte{0x00, 0xff, 0x10}, 20)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text := hexEditText(tt.value)
+			got, err := parseHexEditText(text)
+			if err != nil {
+				t.Fatalf("parseHexEditText(%q): %v", text, err)
+			}
+			if !bytes.Equal(got, tt.value) {
+				t.Errorf("round trip gave %q, want %q", got, tt.value)
+			}
+		})
+	}
+}
+
+func TestParseHexEditText(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		want    []byte
+		wantErr bool
+	}{
+		{"spaces and lines", "00 01\n02\t03 ", []byte{0, 1, 2, 3}, false},
+		{"upper case", "AB cd", []byte{0xab, 0xcd}, false},
+		{"odd digits", "abc", nil, true},
+		{"not hex", "zz", nil, true},
+		{"digit pair split by space", "a b", []byte{0xab}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseHexEditText(tt.text)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !bytes.Equal(got, tt.want) {
+				t.Errorf("got %x, want %x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsPlainText(t *testing.T) {
+	tests := []struct {
+		value []byte
+		want  bool
+	}{
+		{[]byte(""), true},
+		{[]byte("line\nbreaks\tand tabs\r\n"), true},
+		{[]byte("a\x00b"), false},
+		{[]byte("caf\xc3"), false},
+		{[]byte("[b64:QUJD]"), true},
+	}
+	for _, tt := range tests {
+		if got := isPlainText(tt.value); got != tt.want {
+			t.Errorf("isPlainText(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,470 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+const maxOpenShards = 32 // Prefix shards kept open at once; others are reopened for append
+
+// How a full export is written
+type exportOptions struct {
+	dir         string
+	splitPrefix string // Shard by key component before this separator; empty disables
+	maxFileSize int64  // Start a new shard file after this many bytes; 0 disables
+
+	transformCommand string // External filter overriding the configured one
+	noTransform      bool   // Skip configured transforms
+
+	search string // Only export keys matching this search, as in the key list; empty exports everything
+	prefix []byte // Only export keys starting with this, like the namespace the viewer is scoped to
+
+	format string    // "text" (default), "ndjson", "csv", "resp" or "dedup"
+	csv    csvConfig // Delimiter, escaping and columns for "csv"
+}
+
+// One output file listed in the export manifest
+type shardInfo struct {
+	File     string `json:"file"`
+	Prefix   string `json:"prefix,omitempty"`
+	Keys     int    `json:"keys"`
+	Bytes    int64  `json:"bytes"`
+	FirstKey string `json:"first_key"`
+	LastKey  string `json:"last_key"`
+}
+
+// Index written next to sharded exports
+type exportManifest struct {
+	Created  time.Time    `json:"created"`
+	Database string       `json:"database"`
+	Format   string       `json:"format"`
+	Keys     int          `json:"keys"`
+	Search   string       `json:"search,omitempty"`
+	Prefix   string       `json:"prefix,omitempty"`
+	SplitBy  string       `json:"split_by,omitempty"`
+	MaxBytes int64        `json:"max_bytes,omitempty"`
+	Shards   []*shardInfo `json:"shards"`
+}
+
+// Output file currently receiving records
+type openShard struct {
+	info   *shardInfo
+	file   *os.File
+	writer *bufio.Writer
+}
+
+// Routes export records to shard files and tracks what went where
+type shardWriter struct {
+	opts   exportOptions
+	base   string // File name without shard suffix or extension
+	ext    string
+	header []byte // Written at the start of every new file
+	shards []*shardInfo
+	open   map[string]*openShard // By prefix ("" when not splitting by prefix)
+	parts  map[string]int        // Size-split part counter per prefix
+	names  map[string]bool       // File names already used, to keep sanitized prefixes apart
+}
+
+func newShardWriter(opts exportOptions, base, ext string) *shardWriter {
+	return &shardWriter{
+		opts:  opts,
+		base:  base,
+		ext:   ext,
+		open:  make(map[string]*openShard),
+		parts: make(map[string]int),
+		names: make(map[string]bool),
+	}
+}
+
+// Append one formatted record for key to the right shard
+func (w *shardWriter) write(key []byte, record []byte) error {
+	prefix := ""
+	if w.opts.splitPrefix != "" {
+		// Keys without the separator share one "other" shard
+		if before, _, found := strings.Cut(string(key), w.opts.splitPrefix); found {
+			prefix = before
+		}
+	}
+
+	shard := w.open[prefix]
+	full := shard != nil && w.opts.maxFileSize > 0 && shard.info.Keys > 0 &&
+		shard.info.Bytes+int64(len(record)) > w.opts.maxFileSize
+	if full {
+		if err := w.closeShard(prefix); err != nil {
+			return err
+		}
+	}
+	if shard == nil || full {
+		var err error
+		if shard, err = w.openShard(prefix, full); err != nil {
+			return err
+		}
+	}
+
+	if _, err := shard.writer.Write(record); err != nil {
+		return err
+	}
+	if shard.info.Keys == 0 {
+		shard.info.FirstKey = string(key)
+	}
+	shard.info.LastKey = string(key)
+	shard.info.Keys++
+	shard.info.Bytes += int64(len(record))
+	return nil
+}
+
+// Open a new shard file for prefix, or unless fresh is set reopen the last one
+// if it was only closed to save file handles
+func (w *shardWriter) openShard(prefix string, fresh bool) (*openShard, error) {
+	if len(w.open) >= maxOpenShards {
+		for p := range w.open {
+			if err := w.closeShard(p); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Reopen the latest shard for this prefix
+	for i := len(w.shards) - 1; i >= 0 && !fresh && w.opts.splitPrefix != ""; i-- {
+		info := w.shards[i]
+		if info.Prefix != prefix {
+			continue
+		}
+		file, err := os.OpenFile(filepath.Join(w.opts.dir, info.File), os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, err
+		}
+		shard := &openShard{info: info, file: file, writer: bufio.NewWriter(file)}
+		w.open[prefix] = shard
+		return shard, nil
+	}
+
+	name := w.base
+	if w.opts.splitPrefix != "" && prefix == "" {
+		name += "_other"
+	} else if w.opts.splitPrefix != "" {
+		name += "_" + safeFileName(prefix)
+	}
+	if w.opts.maxFileSize > 0 {
+		w.parts[prefix]++
+		name += fmt.Sprintf("_%04d", w.parts[prefix])
+	}
+	for unique, n := name, 2; ; n++ {
+		if !w.names[unique+w.ext] {
+			name = unique + w.ext
+			break
+		}
+		unique = fmt.Sprintf("%s~%d", name, n)
+	}
+	w.names[name] = true
+
+	file, err := os.Create(filepath.Join(w.opts.dir, name))
+	if err != nil {
+		return nil, err
+	}
+	info := &shardInfo{File: name}
+	if w.opts.splitPrefix != "" {
+		info.Prefix = prefix
+	}
+	w.shards = append(w.shards, info)
+	shard := &openShard{info: info, file: file, writer: bufio.NewWriter(file)}
+	if _, err := shard.writer.Write(w.header); err != nil {
+		file.Close()
+		return nil, err
+	}
+	info.Bytes = int64(len(w.header))
+	w.open[prefix] = shard
+	return shard, nil
+}
+
+func (w *shardWriter) closeShard(prefix string) error {
+	shard := w.open[prefix]
+	delete(w.open, prefix)
+	if err := shard.writer.Flush(); err != nil {
+		shard.file.Close()
+		return err
+	}
+	return shard.file.Close()
+}
+
+// Close and delete the files written so far, for an export that did not finish
+func (w *shardWriter) discard() {
+	for prefix, shard := range w.open {
+		shard.file.Close()
+		delete(w.open, prefix)
+	}
+	for _, info := range w.shards {
+		os.Remove(filepath.Join(w.opts.dir, info.File))
+	}
+}
+
+// Flush and close every shard; with sharding enabled also write the manifest
+func (w *shardWriter) close(format string, total int) (string, error) {
+	var firstErr error
+	for prefix := range w.open {
+		if err := w.closeShard(prefix); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if firstErr != nil {
+		return "", firstErr
+	}
+
+	if w.opts.splitPrefix == "" && w.opts.maxFileSize == 0 {
+		if len(w.shards) == 0 {
+			// Empty database: still leave an empty export behind
+			name := w.base + w.ext
+			if err := os.WriteFile(filepath.Join(w.opts.dir, name), w.header, 0644); err != nil {
+				return "", err
+			}
+			return filepath.Join(w.opts.dir, name), nil
+		}
+		return filepath.Join(w.opts.dir, w.shards[0].File), nil
+	}
+
+	manifest := exportManifest{
+		Created:  time.Now(),
+		Database: dbPath,
+		Format:   format,
+		Keys:     total,
+		Search:   w.opts.search,
+		Prefix:   string(w.opts.prefix),
+		SplitBy:  w.opts.splitPrefix,
+		MaxBytes: w.opts.maxFileSize,
+		Shards:   w.shards,
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(w.opts.dir, w.base+".manifest.json")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		os.Remove(path) // A half-written manifest would describe an export that discard removes
+		return "", err
+	}
+	return path, nil
+}
+
+// Text record in the format used by the d and a dumps
+func textRecord(key, value []byte) []byte {
+	var record bytes.Buffer
+	fmt.Fprintf(&record, "Key: %s\n\nValue: %s\n\n%s\n", key, formatValue(value), strings.Repeat("-", 80))
+	return record.Bytes()
+}
+
+// One line of an NDJSON export: exact bytes as base64 plus a best-effort text rendering
+type ndjsonRecord struct {
+	Key      string `json:"key"`
+	KeyB64   string `json:"key_b64"`
+	Value    string `json:"value"`
+	ValueB64 string `json:"value_b64"`
+}
+
+func ndjsonLine(key, value []byte) ([]byte, error) {
+	line, err := json.Marshal(ndjsonRecord{
+		Key:      mixedContentDisplay(key),
+		KeyB64:   base64.StdEncoding.EncodeToString(key),
+		Value:    mixedContentDisplay(value),
+		ValueB64: base64.StdEncoding.EncodeToString(value),
+	})
+	return append(line, '\n'), err
+}
+
+// Call fn with the exact key and value of every line of an NDJSON export until it returns false
+func scanNDJSONExport(path string, fn func(key, value []byte) bool) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1<<30)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var record ndjsonRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return fmt.Errorf("%s line %d: %w", path, line, err)
+		}
+		key, err := base64.StdEncoding.DecodeString(record.KeyB64)
+		if err != nil {
+			return fmt.Errorf("%s line %d: key_b64: %w", path, line, err)
+		}
+		value, err := base64.StdEncoding.DecodeString(record.ValueB64)
+		if err != nil {
+			return fmt.Errorf("%s line %d: value_b64: %w", path, line, err)
+		}
+		if !fn(key, value) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+// Export every key, sharded according to opts. Returns the export file (or manifest) path and the key count.
+func exportDatabase(opts exportOptions, progress func(string)) (string, int, error) {
+	if err := checkSearch(opts.search); err != nil {
+		return "", 0, err
+	}
+	if err := os.MkdirAll(opts.dir, 0755); err != nil {
+		return "", 0, fmt.Errorf("creating directory: %w", err)
+	}
+
+	var transform recordTransform
+	if !opts.noTransform {
+		var err error
+		if transform, err = newExportTransform(opts.transformCommand); err != nil {
+			return "", 0, err
+		}
+	}
+
+	if opts.format == "" {
+		opts.format = "text"
+	}
+	ext := ".txt"
+	var layout csvLayout
+	switch opts.format {
+	case "text":
+	case "ndjson":
+		ext = ".ndjson"
+	case "resp":
+		ext = ".resp"
+	case "dedup":
+		// A value is written once, before the first key using it, which shards would break up
+		if opts.splitPrefix != "" || opts.maxFileSize > 0 {
+			return "", 0, fmt.Errorf("dedup exports cannot be split into shards")
+		}
+		ext = ".dedup"
+	case "csv":
+		ext = ".csv"
+		var err error
+		if layout, err = newCSVLayout(opts.csv); err != nil {
+			return "", 0, err
+		}
+	default:
+		return "", 0, fmt.Errorf("unknown export format %q", opts.format)
+	}
+
+	// Timestamped so earlier exports are kept for the key history view. Partial
+	// exports get another name so the history and restore views skip them.
+	base := "all_keys_"
+	if opts.search != "" || opts.prefix != nil {
+		base = "search_keys_"
+	}
+	writer := newShardWriter(opts, base+time.Now().Format(exportTimeLayout), ext)
+	if opts.format == "csv" {
+		writer.header = layout.header()
+	}
+
+	dedup := newDedupWriter()
+	filter := newKeyFilter(opts.search)
+	var r *util.Range
+	if opts.prefix != nil {
+		r = util.BytesPrefix(opts.prefix)
+	}
+	iter := db.NewIterator(intersectRanges(r, searchRange(opts.search)), scanReadOptions)
+	defer iter.Release()
+
+	count := 0
+	for iter.Next() {
+		if err := interrupted(); err != nil {
+			if transform != nil {
+				transform.close()
+			}
+			writer.discard()
+			return "", count, err
+		}
+		key, value := iter.Key(), iter.Value()
+		scanRate.wait(key, value)
+		if !filter(key, value) {
+			continue
+		}
+		if transform != nil {
+			var keep bool
+			var err error
+			if key, value, keep, err = transform.apply(key, value); err != nil {
+				transform.close()
+				writer.discard()
+				return "", count, fmt.Errorf("transforming key %q: %w", iter.Key(), err)
+			}
+			if !keep {
+				continue
+			}
+		}
+
+		var record []byte
+		var err error
+		switch opts.format {
+		case "text":
+			record = textRecord(key, value)
+		case "csv":
+			record = layout.record(key, value)
+		case "resp":
+			record = respSet(key, value)
+		case "dedup":
+			record, err = dedup.record(key, value)
+		case "ndjson":
+			record, err = ndjsonLine(key, value)
+		}
+		if err != nil {
+			if transform != nil {
+				transform.close()
+			}
+			writer.discard()
+			return "", count, fmt.Errorf("encoding key: %w", err)
+		}
+		if err := writer.write(key, record); err != nil {
+			if transform != nil {
+				transform.close()
+			}
+			writer.discard()
+			return "", count, fmt.Errorf("writing key: %w", err)
+		}
+
+		count++
+		if count%10000 == 0 {
+			progress(fmt.Sprintf("%d keys written", count))
+		}
+	}
+
+	if transform != nil {
+		if err := transform.close(); err != nil {
+			writer.discard()
+			return "", count, fmt.Errorf("transform: %w", err)
+		}
+	}
+
+	if err := iter.Error(); err != nil {
+		writer.discard()
+		return "", count, fmt.Errorf("iterator error: %w", err)
+	}
+
+	path, err := writer.close(opts.format, count)
+	if err != nil {
+		writer.discard()
+		return "", count, err
+	}
+	return path, count, nil
+}
+
+// Replace characters that are not allowed in file names
+func safeFileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 32 || r == '/' || r == '\\' || r == ':' || r == '*' ||
+			r == '?' || r == '"' || r == '<' || r == '>' || r == '|' {
+			return '_'
+		}
+		return r
+	}, name)
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Exports as server-side jobs: instead of one response streaming the whole
+// database, which a flaky connection cuts off hours in, POST /api/exports
+// writes the export to a file on the server and GET /api/exports/{id}
+// reports its progress. The finished file is downloaded with Range
+// requests, so curl -C - or a browser picks up where a broken download
+// stopped. Jobs run one at a time and their files are deleted
+// -export-keep after they finish, or with DELETE.
+
+// States of an export job
+const (
+	jobQueued  = "queued"
+	jobRunning = "running"
+	jobDone    = "done"
+	jobFailed  = "failed"
+)
+
+type exportJob struct {
+	ID       string     `json:"id"`
+	Owner    string     `json:"owner"` // Name of the credential that started it
+	Format   string     `json:"format"`
+	Prefix   string     `json:"prefix,omitempty"`
+	Search   string     `json:"search,omitempty"`
+	State    string     `json:"state"`
+	Progress string     `json:"progress,omitempty"`
+	Keys     int        `json:"keys"`
+	Bytes    int64      `json:"bytes,omitempty"` // Size of the finished file
+	Error    string     `json:"error,omitempty"`
+	Created  time.Time  `json:"created"`
+	Finished *time.Time `json:"finished,omitempty"`
+	Download string     `json:"download,omitempty"` // URL of the finished file
+
+	dir  string // Directory of this job's file
+	path string // The finished file
+}
+
+type exportJobs struct {
+	dir  string        // Job directories go here
+	keep time.Duration // Finished jobs are deleted after this long
+	slot chan struct{} // Held by the running job
+	mu   sync.Mutex    // Guards jobs and their fields
+	jobs map[string]*exportJob
+}
+
+func newExportJobs(dir string, keep time.Duration) *exportJobs {
+	return &exportJobs{dir: dir, keep: keep, slot: make(chan struct{}, 1), jobs: make(map[string]*exportJob)}
+}
+
+// Copy of the job, safe to encode while it runs
+func (e *exportJobs) snapshotOf(job *exportJob) exportJob {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return *job
+}
+
+// Run an export of the open database into the job's directory once no other job runs
+func (e *exportJobs) run(job *exportJob) {
+	e.slot <- struct{}{}
+	defer func() { <-e.slot }()
+	e.mu.Lock()
+	job.State = jobRunning
+	e.mu.Unlock()
+
+	opts := exportOptions{dir: job.dir, format: job.Format, search: job.Search, csv: cfg.Export.CSV}
+	if job.Prefix != "" {
+		opts.prefix = []byte(job.Prefix)
+	}
+	path, count, err := exportDatabase(opts, func(detail string) {
+		e.mu.Lock()
+		job.Progress = detail
+		e.mu.Unlock()
+	})
+	var size int64
+	if err == nil {
+		var info os.FileInfo
+		if info, err = os.Stat(path); err == nil {
+			size = info.Size()
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	now := time.Now()
+	job.Keys, job.Finished = count, &now
+	if err != nil {
+		job.State, job.Error = jobFailed, err.Error()
+		os.RemoveAll(job.dir)
+		return
+	}
+	job.State, job.path, job.Bytes = jobDone, path, size
+	job.Progress = fmt.Sprintf("%d keys written", count)
+	job.Download = "/api/exports/" + job.ID + "/download"
+}
+
+// Delete the jobs finished longer than keep ago, every minute
+func (e *exportJobs) expire(stop <-chan struct{}) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			e.mu.Lock()
+			for id, job := range e.jobs {
+				if job.Finished != nil && time.Since(*job.Finished) > e.keep {
+					os.RemoveAll(job.dir)
+					delete(e.jobs, id)
+				}
+			}
+			e.mu.Unlock()
+		}
+	}
+}
+
+// Remove the files of every job when the server stops; jobs do not outlive it
+func (e *exportJobs) close() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, job := range e.jobs {
+		os.RemoveAll(job.dir)
+	}
+}
+
+// Start an export job: ?format= (ndjson by default, or text, csv, resp, dedup), prefix= and search=
+func (s *apiServer) startExport(w http.ResponseWriter, r *http.Request, cred *serveCredential) {
+	query := r.URL.Query()
+	format := query.Get("format")
+	if format == "" {
+		format = "ndjson"
+	}
+	switch format {
+	case "ndjson", "text", "csv", "resp", "dedup":
+	default:
+		apiError(w, http.StatusBadRequest, fmt.Sprintf("unknown format %q, want ndjson, text, csv, resp or dedup", format))
+		return
+	}
+	id, err := randomToken()
+	if err != nil {
+		apiError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	id = id[:16]
+	job := &exportJob{
+		ID:      id,
+		Owner:   cred.name,
+		Format:  format,
+		Prefix:  query.Get("prefix"),
+		Search:  query.Get("search"),
+		State:   jobQueued,
+		Created: time.Now(),
+		dir:     filepath.Join(s.exports.dir, id),
+	}
+	s.exports.mu.Lock()
+	s.exports.jobs[id] = job
+	s.exports.mu.Unlock()
+	go s.exports.run(job)
+
+	w.Header().Set("Location", "/api/exports/"+id)
+	writeJSON(w, http.StatusAccepted, s.exports.snapshotOf(job))
+}
+
+func (s *apiServer) listExports(w http.ResponseWriter, r *http.Request, cred *serveCredential) {
+	s.exports.mu.Lock()
+	jobs := make([]exportJob, 0, len(s.exports.jobs))
+	for _, job := range s.exports.jobs {
+		jobs = append(jobs, *job)
+	}
+	s.exports.mu.Unlock()
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Created.Before(jobs[j].Created) })
+	writeJSON(w, http.StatusOK, map[string]any{"jobs": jobs})
+}
+
+// The job of the {id} in the request's path
+func (s *apiServer) exportJob(w http.ResponseWriter, r *http.Request) (*exportJob, bool) {
+	s.exports.mu.Lock()
+	job, ok := s.exports.jobs[r.PathValue("id")]
+	s.exports.mu.Unlock()
+	if !ok {
+		apiError(w, http.StatusNotFound, "no such export job; finished jobs are deleted after -export-keep")
+	}
+	return job, ok
+}
+
+func (s *apiServer) getExport(w http.ResponseWriter, r *http.Request, cred *serveCredential) {
+	if job, ok := s.exportJob(w, r); ok {
+		writeJSON(w, http.StatusOK, s.exports.snapshotOf(job))
+	}
+}
+
+// The finished file; Range and If-Range requests resume a broken download
+func (s *apiServer) downloadExport(w http.ResponseWriter, r *http.Request, cred *serveCredential) {
+	job, ok := s.exportJob(w, r)
+	if !ok {
+		return
+	}
+	state := s.exports.snapshotOf(job)
+	if state.State != jobDone {
+		apiError(w, http.StatusConflict, "the export is "+state.State)
+		return
+	}
+	file, err := os.Open(state.path)
+	if err != nil {
+		apiError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer file.Close()
+	w.Header().Set("ETag", `"`+state.ID+`"`)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filepath.Base(state.path)))
+	http.ServeContent(w, r, filepath.Base(state.path), *state.Finished, file)
+}
+
+// Delete a finished job and its file
+func (s *apiServer) deleteExport(w http.ResponseWriter, r *http.Request, cred *serveCredential) {
+	job, ok := s.exportJob(w, r)
+	if !ok {
+		return
+	}
+	s.exports.mu.Lock()
+	defer s.exports.mu.Unlock()
+	if job.Finished == nil {
+		apiError(w, http.StatusConflict, "the export is "+job.State+"; delete it once it finished")
+		return
+	}
+	if err := os.RemoveAll(job.dir); err != nil && !errors.Is(err, os.ErrNotExist) {
+		apiError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	delete(s.exports.jobs, job.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
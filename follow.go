@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Following the end of a key range, like tail -f: for databases used as
+// queues or logs, whose keys grow (timestamps, sequence numbers), + shows
+// the last keys under a prefix and then every key written after them as it
+// appears. It reads the database as it is, not the snapshot the key list
+// shows; keys written before the last one shown are not picked up.
+
+const (
+	followInterval = time.Second
+	followBacklog  = 20   // Keys from the end of the range shown when following starts
+	followMaxLines = 1000 // Lines kept in the view; older ones scroll away
+	followBatch    = 500  // Keys read per poll at most, so a burst does not stall the UI
+	followPreview  = 120  // Characters of a value shown
+)
+
+type follower struct {
+	rng    *util.Range
+	label  string
+	last   []byte // Newest key shown
+	lines  []string
+	seen   int // Keys that appeared since following started
+	paused bool
+	view   *tview.TextView
+}
+
+// Ask for the prefix to follow, offering the current search
+func showFollowDialog() {
+	input := newDialogInput(" Follow keys starting with: ")
+	input.SetText(strings.TrimPrefix(currentPrefix, "^"))
+	input.SetDoneFunc(func(key tcell.Key) {
+		closeDialog("follow")
+		if key != tcell.KeyEnter {
+			return
+		}
+		prefix, _, err := parseKeyInput(input.GetText())
+		if err != nil {
+			setStatus(fmt.Sprintf("[red]Error: %v", err))
+			return
+		}
+		followKeys(prefix)
+	})
+	showDialog("follow", input, 70, 3)
+}
+
+// Open the follow view for the keys under prefix (within the namespace)
+func followKeys(prefix []byte) {
+	full := append(append([]byte{}, namespace...), prefix...)
+	f := &follower{label: "all keys"}
+	if len(full) > 0 {
+		f.rng = util.BytesPrefix(full)
+		f.label = displayKey(prefix)
+	}
+	recordAction("follow", prefix, "")
+
+	f.view = tview.NewTextView()
+	f.view.SetDynamicColors(true).SetScrollable(true).SetBorder(true)
+	f.view.SetTitleAlign(tview.AlignLeft)
+	f.view.SetTitleColor(tcell.ColorYellow)
+	f.view.SetBackgroundColor(tcell.ColorReset)
+	f.view.SetTextColor(tcell.ColorWhite)
+
+	if err := f.backlog(); err != nil {
+		setStatus(fmt.Sprintf("[red]Error: %v", err))
+		return
+	}
+	f.show()
+
+	stop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(followInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				app.QueueUpdateDraw(f.poll)
+			}
+		}
+	}()
+
+	f.view.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch {
+		case event.Key() == tcell.KeyEsc:
+			close(stop)
+			pages.RemovePage("follow-view")
+			app.SetFocus(keyList)
+			return nil
+		case event.Rune() == ' ':
+			f.paused = !f.paused
+			if !f.paused {
+				f.poll() // Catch up on what appeared while paused
+			}
+			f.show()
+			return nil
+		}
+		return event
+	})
+
+	pages.AddPage("follow-view", f.view, true, true)
+	app.SetFocus(f.view)
+}
+
+// Show the last keys of the range, oldest first
+func (f *follower) backlog() error {
+	iter := db.NewIterator(f.rng, nil)
+	defer iter.Release()
+	var keys, values [][]byte
+	for ok := iter.Last(); ok && len(keys) < followBacklog; ok = iter.Prev() {
+		keys = append(keys, append([]byte{}, iter.Key()...))
+		values = append(values, append([]byte{}, iter.Value()...))
+	}
+	for i := len(keys) - 1; i >= 0; i-- {
+		f.add(keys[i], values[i], false)
+	}
+	f.lines = append(f.lines, "[gray]── following ──[-]")
+	return iter.Error()
+}
+
+// Add the keys written after the last one shown
+func (f *follower) poll() {
+	if f.paused {
+		return
+	}
+	iter := db.NewIterator(f.rng, nil)
+	defer iter.Release()
+	ok := f.seekPast(iter)
+	added := 0
+	for ; ok && added < followBatch; ok = iter.Next() {
+		f.add(iter.Key(), iter.Value(), true)
+		f.seen++
+		added++
+	}
+	if err := iter.Error(); err != nil {
+		f.lines = append(f.lines, fmt.Sprintf("[red]Error: %v[-]", err))
+	}
+	if added > 0 || iter.Error() != nil {
+		f.show()
+	}
+}
+
+// Position iter on the first key after the last one shown
+func (f *follower) seekPast(iter iterator.Iterator) bool {
+	if f.last == nil {
+		return iter.First()
+	}
+	ok := iter.Seek(f.last)
+	if ok && bytes.Equal(iter.Key(), f.last) {
+		ok = iter.Next()
+	}
+	return ok
+}
+
+// Add a line for key; fresh keys appeared while following and show when they did
+func (f *follower) add(key, value []byte, fresh bool) {
+	f.last = append(f.last[:0], key...)
+	preview := strings.ReplaceAll(mixedContentDisplay(value), "\n", " ")
+	if runes := []rune(preview); len(runes) > followPreview {
+		preview = string(runes[:followPreview]) + "…"
+	}
+	line := fmt.Sprintf("%s [gray]=[-] %s", displayKey(key), sanitizeForDisplay(preview))
+	if fresh {
+		line = "[green]" + time.Now().Format("15:04:05") + "[-] " + line
+	} else {
+		line = strings.Repeat(" ", 9) + line // Written before following started
+	}
+	f.lines = append(f.lines, line)
+	if len(f.lines) > followMaxLines {
+		f.lines = f.lines[len(f.lines)-followMaxLines:]
+	}
+}
+
+func (f *follower) show() {
+	state := "Space pauses"
+	if f.paused {
+		state = "[red]paused[yellow], Space resumes"
+	}
+	f.view.SetTitle(fmt.Sprintf(" Following %s: %d new keys (%s, Esc closes) ", tview.Escape(f.label), f.seen, state))
+	f.view.SetText(strings.Join(f.lines, "\n"))
+	if !f.paused {
+		f.view.ScrollToEnd()
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Turns raw value bytes into display text. Everything that renders a value
+// goes through activeFormatter, so tests can inject a fake.
+type valueFormatter interface {
+	format(value []byte) string
+}
+
+// A formatter whose rendering depends on the key too, like the decoder chain's key mappings
+type keyValueFormatter interface {
+	formatKey(key, value []byte) string
+}
+
+// Pretty-prints JSON, otherwise shows text with binary runs as base64
+type defaultFormatter struct{}
+
+var activeFormatter valueFormatter = defaultFormatter{}
+
+func formatValue(value []byte) string {
+	return activeFormatter.format(value)
+}
+
+func (defaultFormatter) format(value []byte) string {
+	if json.Valid(value) {
+		var prettyJSON bytes.Buffer
+		if err := json.Indent(&prettyJSON, value, "", "  "); err == nil {
+			return prettyJSON.String()
+		}
+	}
+	return mixedContentDisplay(value)
+}
+
+// Like formatValue, but through the decoder chain: compressed values are
+// decompressed first and binary encodings are decoded: Chromium Local
+// Storage strings, Avro records with the schema the key is mapped to with
+// -avro-schema, protobuf as the message type the key is mapped to with
+// -proto-type, UUIDs and ULIDs, BSON documents, MessagePack and CBOR maps and
+// arrays, and other protobuf as raw wire format
+func formatKeyValue(key, value []byte) string {
+	text, _, _ := decodeValue(key, value)
+	return text
+}
+
+// Text with binary runs as base64, JSON left as stored
+type textFormatter struct{}
+
+func (textFormatter) format(value []byte) string { return mixedContentDisplay(value) }
+
+// Offset, hex bytes and ASCII columns like hexdump -C
+type hexFormatter struct{}
+
+func (hexFormatter) format(value []byte) string { return strings.TrimSuffix(hex.Dump(value), "\n") }
+
+type base64Formatter struct{}
+
+func (base64Formatter) format(value []byte) string { return base64.StdEncoding.EncodeToString(value) }
+
+// Renderings for the value view only, cycled with f; exports keep using activeFormatter
+var viewFormats = []struct {
+	name      string
+	formatter valueFormatter
+}{
+	{"auto", nil},
+	{"expanded", expandedFormatter{}},
+	{"msgpack", msgpackFormatter{}},
+	{"cbor", cborFormatter{}},
+	{"bson", bsonFormatter{}},
+	{"thrift", thriftFormatter{}},
+	{"records", recordsFormatter{}},
+	{"text", textFormatter{}},
+	{"hex", hexFormatter{}},
+	{"base64", base64Formatter{}},
+}
+
+var viewFormat = 0 // Index into viewFormats
+
+// Format key's value for the value view in the chosen rendering
+func formatForView(key, value []byte) string {
+	switch f := viewFormats[viewFormat].formatter.(type) {
+	case nil:
+		return formatKeyValue(key, value)
+	case keyValueFormatter:
+		return f.formatKey(key, value)
+	default:
+		return f.format(value)
+	}
+}
+
+// Switch the value view rendering by name
+func setViewFormat(name string) error {
+	for i, f := range viewFormats {
+		if f.name == name {
+			viewFormat = i
+			return nil
+		}
+	}
+	names := make([]string, len(viewFormats))
+	for i, f := range viewFormats {
+		names[i] = f.name
+	}
+	return fmt.Errorf("unknown format %q, want one of %s", name, strings.Join(names, ", "))
+}
+
+// Move to the next value view rendering and redraw the selection
+func cycleViewFormat() {
+	viewFormat = (viewFormat + 1) % len(viewFormats)
+	if currentKey != nil {
+		showKeyValue(currentKey)
+	}
+	setStatus(fmt.Sprintf("[green]Value format: %s", viewFormats[viewFormat].name))
+}
+
+func mixedContentDisplay(value []byte) string {
+	var result strings.Builder
+	pos := 0
+	var binaryBuffer []byte
+
+	flushBinary := func() {
+		if len(binaryBuffer) > 0 {
+			result.WriteString("[b64:")
+			result.WriteString(base64.RawStdEncoding.EncodeToString(binaryBuffer))
+			result.WriteString("]")
+			binaryBuffer = nil
+		}
+	}
+
+	for pos < len(value) {
+		r, size := utf8.DecodeRune(value[pos:])
+		if r == utf8.RuneError && size == 1 {
+			// Invalid UTF-8 byte
+			binaryBuffer = append(binaryBuffer, value[pos])
+			pos++
+		} else if unicode.IsControl(r) {
+			// Control character, collect its bytes
+			binaryBuffer = append(binaryBuffer, value[pos:pos+size]...)
+			pos += size
+		} else {
+			// Flush any pending binary data
+			flushBinary()
+
+			// Write printable rune
+			result.WriteRune(r)
+			pos += size
+		}
+	}
+
+	// Flush any remaining binary data
+	flushBinary()
+
+	return result.String()
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/rivo/tview"
+)
+
+// Records what it was asked to format
+type fakeFormatter struct {
+	seen [][]byte
+}
+
+func (f *fakeFormatter) format(value []byte) string {
+	f.seen = append(f.seen, value)
+	return "fake:" + string(value)
+}
+
+func TestFormatValueUsesActiveFormatter(t *testing.T) {
+	fake := &fakeFormatter{}
+	saved := activeFormatter
+	activeFormatter = fake
+	defer func() { activeFormatter = saved }()
+
+	if got := formatValue([]byte("v")); got != "fake:v" {
+		t.Fatalf("formatValue = %q, want %q", got, "fake:v")
+	}
+	if len(fake.seen) != 1 || string(fake.seen[0]) != "v" {
+		t.Fatalf("formatter saw %q, want one call with \"v\"", fake.seen)
+	}
+}
+
+func TestDefaultFormatter(t *testing.T) {
+	tests := []struct {
+		name  string
+		value []byte
+		want  string
+	}{
+		{"empty", []byte{}, ""},
+		{"nil", nil, ""},
+		{"text", []byte("hello"), "hello"},
+		{"json", []byte(`{"a":1}`), "{\n  \"a\": 1\n}"},
+		{"invalid utf-8", []byte("ok\xff\xfe"), "ok[b64://4]"},
+		{"truncated rune", []byte("caf\xc3"), "caf[b64:ww]"},
+		{"control run", []byte("a\x00\x01b"), "a[b64:AAE]b"},
+		{"only binary", []byte{0x00}, "[b64:AA]"},
+		{"color tags kept as text", []byte("[red]x[-]"), "[red]x[-]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (defaultFormatter{}).format(tt.value); got != tt.want {
+				t.Errorf("format(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBinaryRunsRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		value []byte
+	}{
+		{"empty", []byte{}},
+		{"invalid utf-8", []byte("\xff\xfe\xfd")},
+		{"mixed", []byte("key=\x00\x01\x02;name=caf\xc3\xa9\xff")},
+		{"all bytes", func() []byte {
+			b := make([]byte, 256)
+			for i := range b {
+				b[i] = byte(i)
+			}
+			return b
+		}()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shown := mixedContentDisplay(tt.value)
+			if !utf8.ValidString(shown) {
+				t.Fatalf("display %q is not valid UTF-8", shown)
+			}
+			if got := decodeBinaryRuns(shown); !bytes.Equal(got, tt.value) {
+				t.Errorf("decodeBinaryRuns(%q) = %q, want %q", shown, got, tt.value)
+			}
+		})
+	}
+}
+
+func TestFormattersOnEmptyValue(t *testing.T) {
+	tests := []struct {
+		name      string
+		formatter valueFormatter
+	}{
+		{"default", defaultFormatter{}},
+		{"text", textFormatter{}},
+		{"hex", hexFormatter{}},
+		{"base64", base64Formatter{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.formatter.format(nil); got != "" {
+				t.Errorf("format(nil) = %q, want empty", got)
+			}
+		})
+	}
+}
+
+func TestSanitizeForDisplay(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string // Before tview.Escape, which sanitizeForDisplay applies last
+	}{
+		{"empty", "", ""},
+		{"color tags", "[red]boom[::b]", "[red]boom[::b]"},
+		{"region tag", `["a"]x[""]`, `["a"]x[""]`},
+		{"nested brackets", "[[red]]", "[[red]]"},
+		{"terminal escape", "\x1b[31mred\x1b[0m", "red"},
+		{"control", "a\x07b", "a\ufffdb"},
+		{"bidi override", "a\u202eb", "a\ufffdb"},
+		{"invalid utf-8", "a\xffb", "a\ufffdb"},
+		{"combining flood", "e" + strings.Repeat("\u0301", 10), "e" + strings.Repeat("\u0301", maxCombining)},
+		{"tab and newline kept", "a\tb\nc", "a\tb\nc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, want := sanitizeForDisplay(tt.text), tview.Escape(tt.want); got != want {
+				t.Errorf("sanitizeForDisplay(%q) = %q, want %q", tt.text, got, want)
+			}
+		})
+	}
+}
+
+func TestSanitizeForDisplayHugeValues(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  []byte
+		marker string
+	}{
+		{"long line", bytes.Repeat([]byte("x"), 3*maxLineRunes), "… (line truncated)"},
+		{"many lines", []byte("[" + strings.Repeat(`"abc",`, maxRenderBytes/4) + `"abc"]`), "more bytes not shown"},
+		{"huge binary", bytes.Repeat([]byte{0xff, 0x00}, maxRenderBytes), "… (line truncated)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := sanitizeForDisplay((defaultFormatter{}).format(tt.value))
+			if !strings.Contains(got, tt.marker) {
+				t.Errorf("output of %d bytes lacks %q", len(got), tt.marker)
+			}
+			if len(got) > maxRenderBytes+maxLineRunes*utf8.UTFMax+100 {
+				t.Errorf("output is %d bytes, want at most about %d", len(got), maxRenderBytes)
+			}
+			for i, line := range strings.Split(got, "\n") {
+				if n := utf8.RuneCountInString(line); n > maxLineRunes+len("… (line truncated)") {
+					t.Fatalf("line %d has %d runes, want at most %d", i, n, maxLineRunes)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// go-ethereum (geth) keeps chain data under one-letter key prefixes
+// followed by block numbers and hashes, and most values in RLP. -geth
+// names those keys and decodes their values with the matching RLP schema.
+// Blocks moved to the freezer (the ancient directory) are not in LevelDB.
+var gethMode bool // -geth
+
+// A recognised key: its label and how its value is stored
+type gethKey struct {
+	label string
+	kind  string // A schema of rlpSchemas, "[]<schema>", "uint", "number" (big-endian bytes), "hash", "trienode", "bytes" or "" for the decoder chain
+}
+
+// Keys holding the hash of a chain head
+var gethHeadKeys = map[string]string{
+	"LastHeader": "hash of the latest header", "LastBlock": "hash of the latest block", "LastFast": "hash of the latest snap-synced block",
+	"LastFinalized": "hash of the latest finalized block", "SnapshotRoot": "state root of the snapshot",
+}
+
+func parseGethKey(key []byte) (gethKey, bool) {
+	if label, ok := gethHeadKeys[string(key)]; ok {
+		return gethKey{label: label, kind: "hash"}, true
+	}
+	hash := func(b []byte) string { return "0x" + hex.EncodeToString(b) }
+	number := func(b []byte) uint64 { return binary.BigEndian.Uint64(b) }
+	switch {
+	case string(key) == "DatabaseVersion":
+		return gethKey{"database version", "uint"}, true
+	case len(key) == 32:
+		return gethKey{"trie node " + hash(key), "trienode"}, true
+	case len(key) == 41 && key[0] == 'h':
+		return gethKey{fmt.Sprintf("header #%d %s", number(key[1:9]), hash(key[9:])), "header"}, true
+	case len(key) == 42 && key[0] == 'h' && key[41] == 't':
+		return gethKey{fmt.Sprintf("total difficulty #%d %s", number(key[1:9]), hash(key[9:41])), "uint"}, true
+	case len(key) == 10 && key[0] == 'h' && key[9] == 'n':
+		return gethKey{fmt.Sprintf("canonical hash #%d", number(key[1:9])), "hash"}, true
+	case len(key) == 33 && key[0] == 'H':
+		return gethKey{"block number of " + hash(key[1:]), "number"}, true
+	case len(key) == 41 && key[0] == 'b':
+		return gethKey{fmt.Sprintf("body #%d %s", number(key[1:9]), hash(key[9:])), "body"}, true
+	case len(key) == 41 && key[0] == 'r':
+		return gethKey{fmt.Sprintf("receipts #%d %s", number(key[1:9]), hash(key[9:])), "[]receipt"}, true
+	case len(key) == 33 && key[0] == 'l':
+		return gethKey{"transaction lookup " + hash(key[1:]), "number"}, true
+	case len(key) == 33 && key[0] == 'a':
+		return gethKey{"snapshot account " + hash(key[1:]), "account"}, true
+	case len(key) == 65 && key[0] == 'o':
+		return gethKey{fmt.Sprintf("snapshot storage %s slot %s", hash(key[1:33]), hash(key[33:])), ""}, true
+	case len(key) == 33 && key[0] == 'c':
+		return gethKey{"code " + hash(key[1:]), "bytes"}, true
+	case key[0] == 'A' && len(key) <= 65 && isNibbles(key[1:]):
+		return gethKey{"account trie node at path " + gethPath(key[1:]), "trienode"}, true
+	case key[0] == 'O' && len(key) >= 33 && len(key) <= 97 && isNibbles(key[33:]):
+		return gethKey{fmt.Sprintf("storage trie node of %s at path %s", hash(key[1:33]), gethPath(key[33:])), "trienode"}, true
+	case len(key) == 43 && key[0] == 'B':
+		return gethKey{fmt.Sprintf("bloom bits %d, section %d, %s", binary.BigEndian.Uint16(key[1:3]), number(key[3:11]), hash(key[11:])), "bytes"}, true
+	case bytes.HasPrefix(key, []byte("secure-key-")) && len(key) == 43:
+		return gethKey{"preimage of " + hash(key[11:]), "bytes"}, true
+	case bytes.HasPrefix(key, []byte("ethereum-config-")) && len(key) == 48:
+		return gethKey{"chain config of genesis " + hash(key[16:]), ""}, true
+	}
+	return gethKey{}, false
+}
+
+// Trie paths are stored one nibble per byte
+func isNibbles(b []byte) bool {
+	for _, n := range b {
+		if n > 15 {
+			return false
+		}
+	}
+	return true
+}
+
+func gethPath(nibbles []byte) string {
+	if len(nibbles) == 0 {
+		return "(root)"
+	}
+	var path strings.Builder
+	for _, n := range nibbles {
+		path.WriteByte("0123456789abcdef"[n])
+	}
+	return path.String()
+}
+
+// Label of a geth key, for the key list
+func formatGethKey(key []byte) (string, bool) {
+	if len(key) == 0 {
+		return "", false
+	}
+	k, ok := parseGethKey(key)
+	return k.label, ok
+}
+
+// Value of a recognised geth key decoded by the key's kind
+func decodeGethValue(key, value []byte) (string, bool) {
+	if !gethMode || len(key) == 0 {
+		return "", false
+	}
+	k, ok := parseGethKey(key)
+	if !ok || k.kind == "" {
+		return "", false
+	}
+	switch k.kind {
+	case "hash", "bytes":
+		return "0x" + hex.EncodeToString(value), true
+	case "number":
+		if len(value) > 8 { // Old lookups stored RLP entries
+			break
+		}
+		return new(big.Int).SetBytes(value).String(), true
+	}
+	item, err := parseRLPValue(value)
+	if err != nil {
+		return "", false
+	}
+	if k.kind == "trienode" {
+		return renderTrieNode(item), true
+	}
+	var out strings.Builder
+	renderRLP(&out, item, k.kind, "")
+	return out.String(), true
+}
+
+// Branch nodes have 16 children and a value; short nodes a hex-prefix
+// encoded path and then a child (extension) or a value (leaf)
+func renderTrieNode(item rlpItem) string {
+	var out strings.Builder
+	switch {
+	case item.isList && len(item.items) == 17:
+		out.WriteString("// branch node\n{")
+		first := true
+		for i, child := range item.items {
+			if !child.isList && len(child.data) == 0 {
+				continue
+			}
+			if !first {
+				out.WriteString(",")
+			}
+			first = false
+			name := "value"
+			if i < 16 {
+				name = string("0123456789abcdef"[i])
+			}
+			out.WriteString("\n  " + quoteJSONString(name) + ": ")
+			renderRLP(&out, child, "", "  ")
+		}
+		out.WriteString("\n}")
+	case item.isList && len(item.items) == 2 && !item.items[0].isList && len(item.items[0].data) > 0:
+		encoded := item.items[0].data
+		flag := encoded[0] >> 4
+		path := hex.EncodeToString(encoded)[2:]
+		if flag&1 != 0 {
+			path = hex.EncodeToString(encoded)[1:]
+		}
+		if flag >= 2 {
+			out.WriteString("// leaf node\n{\n  \"path\": " + quoteJSONString(path) + ",\n  \"value\": ")
+			value := item.items[1]
+			if inner, err := parseRLPValue(value.data); !value.isList && err == nil && inner.isList && len(inner.items) == 4 {
+				renderRLP(&out, inner, "account", "  ") // Leaves of the account trie
+			} else {
+				renderRLP(&out, value, "", "  ")
+			}
+		} else {
+			out.WriteString("// extension node\n{\n  \"path\": " + quoteJSONString(path) + ",\n  \"child\": ")
+			renderRLP(&out, item.items[1], "", "  ")
+		}
+		out.WriteString("\n}")
+	default:
+		renderRLP(&out, item, "", "")
+	}
+	return out.String()
+}
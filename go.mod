@@ -3,18 +3,19 @@ module github.com/arkantos1482/leveldb-viewer
 go 1.22.6
 
 require (
+	github.com/gdamore/tcell/v2 v2.7.1
+	github.com/golang/snappy v0.0.0-20180518054509-2e65f85255db
+	github.com/klauspost/compress v1.18.0
 	github.com/rivo/tview v0.0.0-20240818110301-fd649dbf1223
 	github.com/syndtr/goleveldb v1.0.0
+	golang.org/x/text v0.14.0
 )
 
 require (
 	github.com/gdamore/encoding v1.0.0 // indirect
-	github.com/gdamore/tcell/v2 v2.7.1 // indirect
-	github.com/golang/snappy v0.0.0-20180518054509-2e65f85255db // indirect
 	github.com/lucasb-eyer/go-colorful v1.2.0 // indirect
 	github.com/mattn/go-runewidth v0.0.15 // indirect
 	github.com/rivo/uniseg v0.4.7 // indirect
 	golang.org/x/sys v0.17.0 // indirect
 	golang.org/x/term v0.17.0 // indirect
-	golang.org/x/text v0.14.0 // indirect
 )
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rivo/tview"
+)
+
+const (
+	heatWindow   = 60 // Seconds of writes the ranking covers
+	heatRows     = 20 // Prefixes shown in the panel
+	heatBarWidth = 30
+)
+
+// Writes to one key prefix, in one-second buckets over the last heatWindow seconds
+type prefixHeat struct {
+	buckets [heatWindow]int
+	stamps  [heatWindow]int64 // Unix second each bucket was last used for
+	deletes int               // Deletes among all writes, for the d/w ratio
+	total   int               // All writes since the viewer started
+}
+
+func (h *prefixHeat) add(now int64) {
+	slot := now % heatWindow
+	if h.stamps[slot] != now {
+		h.stamps[slot], h.buckets[slot] = now, 0
+	}
+	h.buckets[slot]++
+	h.total++
+}
+
+// Writes within the window ending at now
+func (h *prefixHeat) recent(now int64) int {
+	sum := 0
+	for i, stamp := range h.stamps {
+		if now-stamp < heatWindow {
+			sum += h.buckets[i]
+		}
+	}
+	return sum
+}
+
+// Hot-key heatmap: which prefixes receive the most writes. Implements
+// leveldb.BatchReplay so a written batch can be fed to it directly.
+type heatmap struct {
+	mu       sync.Mutex
+	prefixes map[string]*prefixHeat
+}
+
+var (
+	heat     = &heatmap{prefixes: make(map[string]*prefixHeat)}
+	heatView *tview.TextView // Ranked prefix panel, toggled with g
+	showHeat = false
+	heatStop chan struct{} // Closed when the panel is hidden, ending its refresh loop
+)
+
+// Key prefix up to and including the first ':', '/', '|' or '#'; keys without one share a row
+func heatPrefix(key []byte) string {
+	if i := bytes.IndexAny(key, ":/|#"); i >= 0 {
+		return string(key[:i+1])
+	}
+	return ""
+}
+
+func (m *heatmap) record(key []byte, deleted bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	prefix := heatPrefix(key)
+	h := m.prefixes[prefix]
+	if h == nil {
+		h = &prefixHeat{}
+		m.prefixes[prefix] = h
+	}
+	h.add(time.Now().Unix())
+	if deleted {
+		h.deletes++
+	}
+}
+
+func (m *heatmap) Put(key, value []byte) { m.record(key, false) }
+func (m *heatmap) Delete(key []byte)     { m.record(key, true) }
+
+// One ranked row of the heatmap
+type heatRow struct {
+	prefix  string
+	recent  int
+	total   int
+	deletes int
+}
+
+// Prefixes ordered by writes in the last window, then by all-time writes
+func (m *heatmap) ranking() []heatRow {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now().Unix()
+	rows := make([]heatRow, 0, len(m.prefixes))
+	for prefix, h := range m.prefixes {
+		rows = append(rows, heatRow{prefix: prefix, recent: h.recent(now), total: h.total, deletes: h.deletes})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].recent != rows[j].recent {
+			return rows[i].recent > rows[j].recent
+		}
+		if rows[i].total != rows[j].total {
+			return rows[i].total > rows[j].total
+		}
+		return rows[i].prefix < rows[j].prefix
+	})
+	return rows
+}
+
+// Bar colour by share of the hottest prefix: blue (no recent writes), green, yellow, red
+func heatColor(share float64) string {
+	switch {
+	case share > 0.66:
+		return "red"
+	case share > 0.33:
+		return "yellow"
+	case share > 0:
+		return "green"
+	}
+	return "blue"
+}
+
+func refreshHeatView() {
+	if heatView == nil || !showHeat {
+		return
+	}
+	rows := heat.ranking()
+	var text strings.Builder
+	if len(rows) == 0 {
+		text.WriteString("[gray]No writes seen yet")
+	}
+	hottest := 0
+	if len(rows) > 0 {
+		hottest = rows[0].recent
+	}
+	for i, row := range rows {
+		if i == heatRows {
+			fmt.Fprintf(&text, "[gray]… %d more prefixes", len(rows)-heatRows)
+			break
+		}
+		share := 0.0
+		if hottest > 0 {
+			share = float64(row.recent) / float64(hottest)
+		}
+		width := int(share * heatBarWidth)
+		if row.recent > 0 {
+			width = max(width, 1)
+		}
+		label := row.prefix
+		if label == "" {
+			label = "(no prefix)"
+		}
+		fmt.Fprintf(&text, "[%s]%-*s[-] %6d/min %8d total %5.1f%% deletes  %s\n",
+			heatColor(share), heatBarWidth, strings.Repeat("█", width),
+			row.recent, row.total, 100*float64(row.deletes)/float64(row.total), tview.Escape(sanitizeForDisplay(label)))
+	}
+	heatView.SetText(text.String())
+}
+
+// Show or hide the heatmap panel; while shown it is redrawn every second
+func toggleHeatPanel() {
+	showHeat = !showHeat
+	if !showHeat {
+		mainLayout.RemoveItem(heatView)
+		close(heatStop)
+		return
+	}
+	mainLayout.AddItem(heatView, 12, 0, false)
+	refreshHeatView()
+	heatStop = make(chan struct{})
+	go func(stop chan struct{}) {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				app.QueueUpdateDraw(refreshHeatView)
+			}
+		}
+	}(heatStop)
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+const exportTimeLayout = "20060102-150405" // Timestamp embedded in export file names
+
+// One version of a key's value, taken from the database or from an export file
+type keyVersion struct {
+	label string
+	date  time.Time
+	value string
+	found bool
+}
+
+// Show every exported version of the selected key, newest first, with a diff against the next older one
+func showKeyHistory() {
+	if refuseHostAccess() {
+		return
+	}
+	currentIndex := keyList.GetCurrentItem()
+	if currentIndex < 0 || currentIndex >= len(displayedKeys) {
+		setStatus("[red]Invalid selection")
+		return
+	}
+	key := displayedKeys[currentIndex]
+	recordAction("history", key, "")
+
+	// Exports can be large; read them off the UI goroutine
+	setStatus("[yellow]Reading exports...")
+	go func() {
+		versions, err := collectKeyVersions(key)
+		app.QueueUpdateDraw(func() {
+			if err != nil {
+				setStatus(fmt.Sprintf("[red]Error reading exports: %v", err))
+				return
+			}
+			if len(versions) < 2 {
+				setStatus(fmt.Sprintf("[yellow]No exports found in %s, press a to create one", dumpDir))
+				return
+			}
+			setStatus("")
+			showHistoryView(versions)
+		})
+	}()
+}
+
+// List the versions of a key with a diff pane
+func showHistoryView(versions []keyVersion) {
+	list := tview.NewList().SetWrapAround(false).ShowSecondaryText(false)
+	list.SetBorder(true).SetTitle(" History ")
+	list.SetTitleAlign(tview.AlignLeft)
+	list.SetTitleColor(tcell.ColorYellow)
+	list.SetBackgroundColor(tcell.ColorReset)
+	list.SetSelectedBackgroundColor(tcell.ColorWhite)
+	list.SetHighlightFullLine(true)
+
+	diffView := tview.NewTextView()
+	diffView.SetDynamicColors(true).SetBorder(true)
+	diffView.SetTitleColor(tcell.ColorYellow)
+	diffView.SetTitleAlign(tview.AlignLeft)
+	diffView.SetScrollable(true)
+	diffView.SetBackgroundColor(tcell.ColorReset)
+	diffView.SetTextColor(tcell.ColorWhite)
+
+	for _, v := range versions {
+		label := v.label
+		if !v.found {
+			label += " (absent)"
+		}
+		list.AddItem(label, "", 0, nil)
+	}
+
+	list.SetChangedFunc(func(index int, mainText string, secondaryText string, shortcut rune) {
+		showVersionDiff(diffView, versions, index)
+	})
+
+	layout := tview.NewFlex().
+		AddItem(list, 0, 1, true).
+		AddItem(diffView, 0, 3, false)
+
+	closeHistory := func() {
+		pages.RemovePage("history")
+		app.SetFocus(keyList)
+	}
+	layout.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyEsc:
+			closeHistory()
+			return nil
+		case tcell.KeyTab:
+			if list.HasFocus() {
+				app.SetFocus(diffView)
+			} else {
+				app.SetFocus(list)
+			}
+			return nil
+		}
+		return event
+	})
+
+	pages.AddPage("history", layout, true, true)
+	app.SetFocus(list)
+	showVersionDiff(diffView, versions, 0)
+}
+
+// Render the diff between version index and the next older version
+func showVersionDiff(view *tview.TextView, versions []keyVersion, index int) {
+	if index < 0 || index >= len(versions) {
+		return
+	}
+	current := versions[index]
+	if index == len(versions)-1 {
+		view.SetTitle(fmt.Sprintf(" %s (oldest) ", current.label))
+		view.SetText(sanitizeForDisplay(current.value))
+		view.ScrollToBeginning()
+		return
+	}
+	previous := versions[index+1]
+	view.SetTitle(fmt.Sprintf(" %s vs %s ", previous.label, current.label))
+
+	if !current.found && !previous.found {
+		view.SetText("[white]Key absent in both versions")
+		return
+	}
+
+	var text strings.Builder
+	for _, op := range diffLines(strings.Split(previous.value, "\n"), strings.Split(current.value, "\n")) {
+		line := sanitizeForDisplay(op.text)
+		switch op.kind {
+		case '-':
+			text.WriteString("[red]- " + line + "[-]\n")
+		case '+':
+			text.WriteString("[green]+ " + line + "[-]\n")
+		default:
+			text.WriteString("  " + line + "\n")
+		}
+	}
+	view.SetText(text.String())
+	view.ScrollToBeginning()
+}
+
+// Collect the current value followed by the value from every dump-all export, newest first
+func collectKeyVersions(key []byte) ([]keyVersion, error) {
+	versions := []keyVersion{{label: "current", date: time.Now()}}
+	if value, err := browseReader().Get(key, nil); err == nil {
+		versions[0].value = formatValue(value)
+		versions[0].found = true
+	}
+
+	files, err := filepath.Glob(filepath.Join(dumpDir, "all_keys_*"))
+	if err != nil {
+		return nil, err
+	}
+
+	// Sharded exports share one timestamp across several files
+	groups := make(map[string][]string)
+	for _, file := range files {
+		if !isArchiveFile(file) {
+			continue
+		}
+		stamp := strings.TrimPrefix(filepath.Base(file), "all_keys_")
+		if len(stamp) > len(exportTimeLayout) {
+			stamp = stamp[:len(exportTimeLayout)]
+		}
+		groups[stamp] = append(groups[stamp], file)
+	}
+
+	var exports []keyVersion
+	for stamp, group := range groups {
+		info, err := os.Stat(group[0])
+		if err != nil {
+			return nil, err
+		}
+		date := info.ModTime()
+		if parsed, err := time.ParseInLocation(exportTimeLayout, stamp, time.Local); err == nil {
+			date = parsed
+		}
+
+		version := keyVersion{label: date.Format("2006-01-02 15:04:05"), date: date}
+		for _, file := range group {
+			err := scanArchiveFile(file, func(k, v []byte) bool {
+				if bytes.Equal(k, key) {
+					version.value, version.found = formatValue(v), true
+					return false
+				}
+				return true
+			})
+			if err != nil {
+				return nil, err
+			}
+			if version.found {
+				break
+			}
+		}
+		exports = append(exports, version)
+	}
+
+	sort.Slice(exports, func(i, j int) bool { return exports[i].date.After(exports[j].date) })
+	return append(versions, exports...), nil
+}
+
+// Export files the record readers understand: not CSV, and not the manifest of a sharded export
+func isArchiveFile(file string) bool {
+	for _, ext := range []string{".txt", ".ndjson", ".dedup", ".resp"} {
+		if strings.HasSuffix(file, ext) {
+			return true
+		}
+	}
+	return false
+}
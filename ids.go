@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// UUIDs and ULIDs, stored either as 16 raw bytes or as canonical text.
+// Binary ones are shown as uuid:... or ulid:..., which key input accepts back.
+
+const crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+func formatUUID(id []byte) string {
+	h := hex.EncodeToString(id)
+	return h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
+
+// 26 characters of Crockford base32; the first holds only the top 3 bits
+func formatULID(id []byte) string {
+	hi, lo := binary.BigEndian.Uint64(id), binary.BigEndian.Uint64(id[8:])
+	out := make([]byte, 26)
+	for i := 25; i >= 0; i-- {
+		out[i] = crockfordAlphabet[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out)
+}
+
+// Parse canonical UUID text (8-4-4-4-12 hex digits) or a ULID, in either case
+func parseIDText(text string) ([]byte, bool) {
+	switch len(text) {
+	case 36:
+		if text[8] != '-' || text[13] != '-' || text[18] != '-' || text[23] != '-' {
+			return nil, false
+		}
+		id, err := hex.DecodeString(strings.ReplaceAll(text, "-", ""))
+		return id, err == nil && len(id) == 16
+	case 26:
+		if text[0] > '7' {
+			return nil, false // Would overflow 128 bits
+		}
+		var hi, lo uint64
+		for _, c := range strings.ToUpper(text) {
+			v := strings.IndexRune(crockfordAlphabet, c)
+			if v < 0 {
+				return nil, false
+			}
+			hi = hi<<5 | lo>>59
+			lo = lo<<5 | uint64(v)
+		}
+		id := make([]byte, 16)
+		binary.BigEndian.PutUint64(id, hi)
+		binary.BigEndian.PutUint64(id[8:], lo)
+		return id, true
+	}
+	return nil, false
+}
+
+// Whether 16 bytes carry the RFC 9562 variant and a defined UUID version;
+// other 16-byte IDs are taken for ULIDs
+func isUUID(id []byte) bool {
+	version := id[6] >> 4
+	return id[8]&0xc0 == 0x80 && version >= 1 && version <= 8
+}
+
+// uuid:... or ulid:... form of 16 raw bytes
+func formatID(id []byte) string {
+	if isUUID(id) {
+		return "uuid:" + formatUUID(id)
+	}
+	return "ulid:" + formatULID(id)
+}
+
+// Creation time held in a ULID or a version 7 UUID: milliseconds since the
+// Unix epoch in the first 48 bits
+func idTimestamp(id []byte, ulid bool) (time.Time, bool) {
+	if !ulid && (!isUUID(id) || id[6]>>4 != 7) {
+		return time.Time{}, false
+	}
+	ms := int64(binary.BigEndian.Uint64(append([]byte{0, 0}, id[:6]...)))
+	return time.UnixMilli(ms).UTC(), true
+}
+
+// Key or value ending in a binary ID after printable text (or nothing)
+func splitTrailingID(data []byte) (head, id []byte, ok bool) {
+	if len(data) < 16 {
+		return nil, nil, false
+	}
+	head, id = data[:len(data)-16], data[len(data)-16:]
+	if isPrintableText(id) || !isPrintableText(head) {
+		return nil, nil, false
+	}
+	return head, id, true
+}
+
+// ID at the end of data, as 16 raw bytes or as canonical text after a
+// separator; ulid tells which kind it is
+func trailingID(data []byte) (id []byte, ulid, ok bool) {
+	if _, id, ok := splitTrailingID(data); ok {
+		return id, !isUUID(id), true
+	}
+	text := bytes.Trim(bytes.TrimSpace(data), `"`)
+	for _, size := range []int{36, 26} {
+		start := len(text) - size
+		if start < 0 || start > 0 && isAlphanumeric(text[start-1]) {
+			continue
+		}
+		if id, ok := parseIDText(string(text[start:])); ok {
+			return id, size == 26, true
+		}
+	}
+	return nil, false, false
+}
+
+// Key typed as displayKey shows one ending in a binary ID: text, then uuid:... or ulid:...
+func parseTrailingIDInput(text string) ([]byte, bool) {
+	for _, marker := range []string{"uuid:", "ulid:"} {
+		i := strings.LastIndex(text, marker)
+		if i < 0 {
+			continue
+		}
+		if id, ok := parseIDText(text[i+len(marker):]); ok {
+			return append([]byte(text[:i]), id...), true
+		}
+	}
+	return nil, false
+}
+
+func isAlphanumeric(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// Note for the value header giving the creation time of a ULID or version 7
+// UUID at the end of the key or value
+func idHeaderNote(key, value []byte) string {
+	var notes []string
+	for _, part := range []struct {
+		name string
+		data []byte
+	}{{"key", key}, {"value", value}} {
+		if part.name == "value" && len(bytes.TrimSpace(part.data)) > 38 {
+			continue // Only values that are an ID and nothing else
+		}
+		id, ulid, ok := trailingID(part.data)
+		if !ok {
+			continue
+		}
+		if t, ok := idTimestamp(id, ulid); ok {
+			kind := "UUIDv7"
+			if ulid {
+				kind = "ULID"
+			}
+			notes = append(notes, part.name+" "+kind+" created "+t.Format(time.RFC3339Nano))
+		}
+	}
+	if len(notes) == 0 {
+		return ""
+	}
+	return "[gray](" + strings.Join(notes, "; ") + ")[-]"
+}
+
+// Key filter for a search naming one ID, as uuid:/ulid: or bare canonical
+// text: matches keys holding it in raw bytes, as UUID text or as ULID text
+func idKeyFilter(search string) (keyFilter, bool) {
+	text := strings.TrimPrefix(strings.TrimPrefix(search, "uuid:"), "ulid:")
+	id, ok := parseIDText(text)
+	if !ok {
+		return nil, false
+	}
+	uuidText, ulidText := []byte(formatUUID(id)), []byte(formatULID(id))
+	return func(key, _ []byte) bool {
+		return bytes.Contains(key, id) || containsFold(key, uuidText) || containsFold(key, ulidText)
+	}, true
+}
+
+func containsFold(data, sub []byte) bool {
+	return bytes.Contains(bytes.ToLower(data), bytes.ToLower(sub))
+}
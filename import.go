@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// Where import records come from and how to read them
+type importOptions struct {
+	format    string // "ndjson", "dedup", "csv", "rdb", "aof", "resp", or "" to go by the file extension
+	csv       csvConfig
+	batchSize int // Records per leveldb.Batch
+
+	namespace   string      // Prepended to every imported key
+	redisDB     int         // Only this Redis database from RDB and AOF files; -1 for all
+	keepExpired bool        // Import RDB keys whose TTL has passed
+	redis       *redisStats // Filled in for RDB and AOF files
+
+	conflicts *[]mergeEntry // When set, existing keys that would change are left alone and listed here
+}
+
+// Write every record of NDJSON or CSV exports (or the shards of an export
+// manifest), or the string keys of Redis RDB and AOF files, into the database
+// in batches. Returns the number of keys written or deleted.
+func importFiles(paths []string, opts importOptions, progress func(string)) (int, error) {
+	var files []string
+	for _, path := range paths {
+		if strings.HasSuffix(path, ".manifest.json") {
+			shards, err := manifestFiles(path)
+			if err != nil {
+				return 0, err
+			}
+			files = append(files, shards...)
+		} else {
+			files = append(files, path)
+		}
+	}
+
+	batch := new(leveldb.Batch)
+	count := 0
+	flush := func() error {
+		if batch.Len() == 0 {
+			return nil
+		}
+		if err := db.Write(batch, nil); err != nil {
+			return err
+		}
+		count += batch.Len()
+		batch.Reset()
+		progress(fmt.Sprintf("%d keys written", count))
+		return nil
+	}
+	// Whether writing value to key (deleting it when !found) is held back as a conflict
+	conflict := func(key, value []byte, found bool) (bool, error) {
+		if opts.conflicts == nil {
+			return false, nil
+		}
+		current, err := db.Get(key, nil)
+		if err == leveldb.ErrNotFound || err == nil && found && bytes.Equal(current, value) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		entry := mergeEntry{Key: string(key), KeyB64: key, Ours: mergeVersion{true, current}}
+		if found {
+			entry.Theirs = mergeVersion{true, append([]byte{}, value...)}
+		}
+		*opts.conflicts = append(*opts.conflicts, entry)
+		return true, nil
+	}
+	add := func(key, value []byte) error {
+		key = append([]byte(opts.namespace), key...)
+		if held, err := conflict(key, value, true); held || err != nil {
+			return err
+		}
+		batch.Put(key, value)
+		valueLRU.remove(key)
+		if batch.Len() >= opts.batchSize {
+			return flush()
+		}
+		return nil
+	}
+
+	for _, file := range files {
+		format := opts.format
+		if format == "" {
+			format = strings.TrimPrefix(filepath.Ext(file), ".")
+		}
+		var err error
+		switch format {
+		case "ndjson", "dedup":
+			scan := scanNDJSONExport
+			if format == "dedup" {
+				scan = scanDedupExport
+			}
+			var writeErr error
+			err = scan(file, func(key, value []byte) bool {
+				writeErr = add(key, value)
+				return writeErr == nil
+			})
+			if err == nil {
+				err = writeErr
+			}
+		case "csv":
+			var layout csvLayout
+			if layout, err = newCSVLayout(opts.csv); err == nil {
+				err = layout.scanFile(file, add)
+			}
+		case "rdb", "aof", "resp":
+			if opts.redis == nil {
+				opts.redis = &redisStats{}
+			}
+			err = readRedisFile(file, opts.keepExpired, opts.redis, func(redisDB int, key, value []byte) error {
+				if opts.redisDB >= 0 && redisDB != opts.redisDB {
+					return nil
+				}
+				if value == nil {
+					opts.redis.deletes++
+					key = append([]byte(opts.namespace), key...)
+					if held, err := conflict(key, nil, false); held || err != nil {
+						return err
+					}
+					batch.Delete(key)
+					valueLRU.remove(key)
+					if batch.Len() >= opts.batchSize {
+						return flush()
+					}
+					return nil
+				}
+				opts.redis.strings++
+				return add(key, value)
+			})
+		default:
+			return count, fmt.Errorf("%s: unknown import format %q, want ndjson, dedup, csv, rdb, aof or resp", file, format)
+		}
+		if err != nil {
+			return count, err
+		}
+	}
+	return count, flush()
+}
@@ -0,0 +1,687 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// Chromium keeps an origin's IndexedDB databases in one LevelDB directory
+// (<origin>.indexeddb.leveldb). Every key starts with a prefix naming the
+// database, object store and index by number, and keys are ordered by
+// Chromium's own comparator, "idb_cmp1". -indexeddb opens such a directory
+// with that comparator, shows keys by their parts with the names from the
+// metadata, and decodes records serialized by V8.
+var indexedDB bool // -indexeddb
+
+// Key kinds, by the prefix's IDs
+const (
+	idbGlobalMeta = iota
+	idbDatabaseMeta
+	idbRecord
+	idbExists
+	idbBlob
+	idbIndex
+	idbInvalid
+)
+
+// Encoded IndexedDB key types
+const (
+	idbKeyNull   = 0
+	idbKeyString = 1
+	idbKeyDate   = 2
+	idbKeyNumber = 3
+	idbKeyArray  = 4
+	idbKeyMin    = 5
+	idbKeyBinary = 6
+)
+
+const idbMaxDepth = 64
+
+var errIDBTruncated = errors.New("truncated IndexedDB key")
+
+type idbPrefix struct {
+	database, objectStore, index int64
+}
+
+// The prefix's first byte holds the byte lengths of the three IDs that
+// follow it, each little-endian
+func decodeIDBPrefix(key []byte) (p idbPrefix, rest []byte, ok bool) {
+	if len(key) == 0 {
+		return p, nil, false
+	}
+	sizes := [3]int{int(key[0]>>5&7) + 1, int(key[0]>>2&7) + 1, int(key[0]&3) + 1}
+	ids := [3]*int64{&p.database, &p.objectStore, &p.index}
+	rest = key[1:]
+	for i, n := range sizes {
+		if len(rest) < n {
+			return p, nil, false
+		}
+		for j := n - 1; j >= 0; j-- {
+			*ids[i] = *ids[i]<<8 | int64(rest[j])
+		}
+		rest = rest[n:]
+	}
+	return p, rest, true
+}
+
+func encodeIDBPrefix(p idbPrefix) []byte {
+	var ids [3][]byte
+	for i, id := range []int64{p.database, p.objectStore, p.index} {
+		ids[i] = []byte{byte(id)}
+		for id >>= 8; id > 0; id >>= 8 {
+			ids[i] = append(ids[i], byte(id))
+		}
+	}
+	key := []byte{byte(len(ids[0])-1)<<5 | byte(len(ids[1])-1)<<2 | byte(len(ids[2])-1)}
+	for _, id := range ids {
+		key = append(key, id...)
+	}
+	return key
+}
+
+func (p idbPrefix) kind() int {
+	switch {
+	case p.database == 0:
+		return idbGlobalMeta
+	case p.objectStore == 0:
+		return idbDatabaseMeta
+	case p.index == 1:
+		return idbRecord
+	case p.index == 2:
+		return idbExists
+	case p.index == 3:
+		return idbBlob
+	case p.index >= 30:
+		return idbIndex
+	}
+	return idbInvalid
+}
+
+// Reader over the parts of a key after its prefix
+type idbReader struct{ buf []byte }
+
+func (r *idbReader) byte() (byte, error) {
+	if len(r.buf) == 0 {
+		return 0, errIDBTruncated
+	}
+	b := r.buf[0]
+	r.buf = r.buf[1:]
+	return b, nil
+}
+
+func (r *idbReader) varint() (int64, error) {
+	v, n := binary.Uvarint(r.buf)
+	if n <= 0 {
+		return 0, errIDBTruncated
+	}
+	r.buf = r.buf[n:]
+	return int64(v), nil
+}
+
+// A varint, or a single byte
+func (r *idbReader) number(single bool) (int64, error) {
+	if !single {
+		return r.varint()
+	}
+	b, err := r.byte()
+	return int64(b), err
+}
+
+func (r *idbReader) take(n int64) ([]byte, error) {
+	if n < 0 || n > int64(len(r.buf)) {
+		return nil, errIDBTruncated
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b, nil
+}
+
+// UTF-16BE string behind its length in code units
+func (r *idbReader) stringWithLength() ([]byte, error) {
+	n, err := r.varint()
+	if err != nil {
+		return nil, err
+	}
+	return r.take(2 * n)
+}
+
+func (r *idbReader) binary() ([]byte, error) {
+	n, err := r.varint()
+	if err != nil {
+		return nil, err
+	}
+	return r.take(n)
+}
+
+func (r *idbReader) double() (float64, error) {
+	b, err := r.take(8)
+	if err != nil {
+		return 0, err
+	}
+	return math.Float64frombits(binary.LittleEndian.Uint64(b)), nil
+}
+
+func decodeUTF16BE(b []byte) string {
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		units[i] = binary.BigEndian.Uint16(b[2*i:])
+	}
+	return string(utf16.Decode(units))
+}
+
+// Chromium's "idb_cmp1" key order
+type idbComparer struct{}
+
+func (idbComparer) Name() string                      { return "idb_cmp1" }
+func (idbComparer) Separator(dst, a, b []byte) []byte { return nil }
+func (idbComparer) Successor(dst, b []byte) []byte    { return nil }
+
+// Keys that do not follow the layout fall back to byte order
+func (idbComparer) Compare(a, b []byte) int {
+	if c, err := compareIDBKeys(a, b); err == nil {
+		return c
+	}
+	return bytes.Compare(a, b)
+}
+
+func cmpInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compareIDBKeys(a, b []byte) (int, error) {
+	pa, restA, okA := decodeIDBPrefix(a)
+	pb, restB, okB := decodeIDBPrefix(b)
+	if !okA || !okB {
+		return 0, errIDBTruncated
+	}
+	for _, c := range []int{cmpInt(pa.database, pb.database), cmpInt(pa.objectStore, pb.objectStore), cmpInt(pa.index, pb.index)} {
+		if c != 0 {
+			return c, nil
+		}
+	}
+	ra, rb := &idbReader{restA}, &idbReader{restB}
+	kind := pa.kind()
+	switch kind {
+	case idbGlobalMeta, idbDatabaseMeta:
+		if len(restA) == 0 || len(restB) == 0 {
+			return cmpInt(int64(len(restA)), int64(len(restB))), nil
+		}
+		ta, _ := ra.byte()
+		tb, _ := rb.byte()
+		if ta != tb {
+			return cmpInt(int64(ta), int64(tb)), nil
+		}
+		if kind == idbGlobalMeta {
+			return compareIDBGlobalMeta(ta, ra, rb)
+		}
+		return compareIDBDatabaseMeta(ta, ra, rb)
+	case idbRecord, idbExists, idbBlob:
+		if len(restA) == 0 || len(restB) == 0 {
+			return cmpInt(int64(len(restA)), int64(len(restB))), nil
+		}
+		return compareEncodedIDBKeys(ra, rb, 0)
+	case idbIndex:
+		if len(restA) == 0 || len(restB) == 0 {
+			return cmpInt(int64(len(restA)), int64(len(restB))), nil
+		}
+		if c, err := compareEncodedIDBKeys(ra, rb, 0); c != 0 || err != nil {
+			return c, err
+		}
+		seqA, seqB := int64(-1), int64(-1)
+		var err error
+		if len(ra.buf) > 0 {
+			if seqA, err = ra.varint(); err != nil {
+				return 0, err
+			}
+		}
+		if len(rb.buf) > 0 {
+			if seqB, err = rb.varint(); err != nil {
+				return 0, err
+			}
+		}
+		if len(ra.buf) == 0 || len(rb.buf) == 0 {
+			return cmpInt(int64(len(ra.buf)), int64(len(rb.buf))), nil
+		}
+		if c, err := compareEncodedIDBKeys(ra, rb, 0); c != 0 || err != nil {
+			return c, err
+		}
+		return cmpInt(seqA, seqB), nil
+	}
+	return 0, errors.New("invalid IndexedDB key prefix")
+}
+
+// Global metadata after the type byte: simple entries have nothing more
+func compareIDBGlobalMeta(typ byte, ra, rb *idbReader) (int, error) {
+	switch {
+	case typ < 7:
+		return 0, nil
+	case typ == 50: // Scopes
+		return bytes.Compare(ra.buf, rb.buf), nil
+	case typ == 100: // Database free list
+		return compareIDBParts(ra, rb, "v")
+	case typ == 201: // Database name: origin, then name
+		return compareIDBParts(ra, rb, "ss")
+	}
+	return 0, fmt.Errorf("unknown global metadata type %d", typ)
+}
+
+func compareIDBDatabaseMeta(typ byte, ra, rb *idbReader) (int, error) {
+	switch {
+	case typ < 6:
+		return 0, nil
+	case typ == 50: // Object store metadata
+		return compareIDBParts(ra, rb, "vb")
+	case typ == 100: // Index metadata
+		return compareIDBParts(ra, rb, "vvb")
+	case typ == 150: // Object store free list
+		return compareIDBParts(ra, rb, "v")
+	case typ == 151: // Index free list
+		return compareIDBParts(ra, rb, "vv")
+	case typ == 200: // Object store names
+		return compareIDBParts(ra, rb, "s")
+	case typ == 201: // Index names
+		return compareIDBParts(ra, rb, "vs")
+	}
+	return 0, fmt.Errorf("unknown database metadata type %d", typ)
+}
+
+// Compare parts in turn: v a varint, b a byte, s a string with its length
+func compareIDBParts(ra, rb *idbReader, parts string) (int, error) {
+	for _, part := range parts {
+		var c int
+		switch part {
+		case 'v', 'b':
+			x, err := ra.number(part == 'b')
+			if err != nil {
+				return 0, err
+			}
+			y, err := rb.number(part == 'b')
+			if err != nil {
+				return 0, err
+			}
+			c = cmpInt(x, y)
+		case 's':
+			x, err := ra.stringWithLength()
+			if err != nil {
+				return 0, err
+			}
+			y, err := rb.stringWithLength()
+			if err != nil {
+				return 0, err
+			}
+			c = bytes.Compare(x, y) // Big-endian code units sort like their bytes
+		}
+		if c != 0 {
+			return c, nil
+		}
+	}
+	return 0, nil
+}
+
+// Rank of a key type in IndexedDB order: numbers < dates < strings < binary < arrays
+var idbKeyTypeRank = map[byte]int{idbKeyMin: 0, idbKeyNumber: 1, idbKeyDate: 2, idbKeyString: 3, idbKeyBinary: 4, idbKeyArray: 5, idbKeyNull: 6}
+
+func compareEncodedIDBKeys(ra, rb *idbReader, depth int) (int, error) {
+	if depth > idbMaxDepth {
+		return 0, errors.New("key nesting too deep")
+	}
+	ta, err := ra.byte()
+	if err != nil {
+		return 0, err
+	}
+	tb, err := rb.byte()
+	if err != nil {
+		return 0, err
+	}
+	rankA, okA := idbKeyTypeRank[ta]
+	rankB, okB := idbKeyTypeRank[tb]
+	if !okA || !okB {
+		return 0, fmt.Errorf("unknown key type %d", max(ta, tb))
+	}
+	if rankA != rankB {
+		return cmpInt(int64(rankA), int64(rankB)), nil
+	}
+	switch ta {
+	case idbKeyArray:
+		na, err := ra.varint()
+		if err != nil {
+			return 0, err
+		}
+		nb, err := rb.varint()
+		if err != nil {
+			return 0, err
+		}
+		for i := int64(0); i < min(na, nb); i++ {
+			if c, err := compareEncodedIDBKeys(ra, rb, depth+1); c != 0 || err != nil {
+				return c, err
+			}
+		}
+		return cmpInt(na, nb), nil
+	case idbKeyBinary, idbKeyString:
+		read := (*idbReader).binary
+		if ta == idbKeyString {
+			read = (*idbReader).stringWithLength
+		}
+		x, err := read(ra)
+		if err != nil {
+			return 0, err
+		}
+		y, err := read(rb)
+		if err != nil {
+			return 0, err
+		}
+		return bytes.Compare(x, y), nil
+	case idbKeyDate, idbKeyNumber:
+		x, err := ra.double()
+		if err != nil {
+			return 0, err
+		}
+		y, err := rb.double()
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case x < y:
+			return -1, nil
+		case x > y:
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+// Write an encoded key as JavaScript would show it
+func formatEncodedIDBKey(out *strings.Builder, r *idbReader, depth int) error {
+	if depth > idbMaxDepth {
+		return errors.New("key nesting too deep")
+	}
+	typ, err := r.byte()
+	if err != nil {
+		return err
+	}
+	switch typ {
+	case idbKeyNull:
+		out.WriteString("null")
+	case idbKeyMin:
+		out.WriteString("-Infinity")
+	case idbKeyNumber, idbKeyDate:
+		v, err := r.double()
+		if err != nil {
+			return err
+		}
+		if typ == idbKeyDate {
+			out.WriteString("Date(" + time.UnixMilli(int64(v)).UTC().Format(time.RFC3339Nano) + ")")
+		} else {
+			out.WriteString(strconv.FormatFloat(v, 'g', -1, 64))
+		}
+	case idbKeyString:
+		s, err := r.stringWithLength()
+		if err != nil {
+			return err
+		}
+		out.WriteString(quoteJSONString(decodeUTF16BE(s)))
+	case idbKeyBinary:
+		b, err := r.binary()
+		if err != nil {
+			return err
+		}
+		out.WriteString("[b64:" + base64.RawStdEncoding.EncodeToString(b) + "]")
+	case idbKeyArray:
+		n, err := r.varint()
+		if err != nil {
+			return err
+		}
+		out.WriteString("[")
+		for i := int64(0); i < n; i++ {
+			if i > 0 {
+				out.WriteString(", ")
+			}
+			if err := formatEncodedIDBKey(out, r, depth+1); err != nil {
+				return err
+			}
+		}
+		out.WriteString("]")
+	default:
+		return fmt.Errorf("unknown key type %d", typ)
+	}
+	return nil
+}
+
+// Names of databases, object stores and indexes from the metadata, read
+// when the database is opened
+var (
+	idbDatabaseNames    = map[int64]string{}
+	idbObjectStoreNames = map[[2]int64]string{}
+	idbIndexNames       = map[[3]int64]string{}
+)
+
+var idbGlobalMetaNames = []string{"schema version", "max database id", "data version", "recovery blob journal", "active blob journal", "earliest sweep time", "earliest compaction time"}
+var idbDatabaseMetaNames = []string{"origin", "name", "user string version", "max object store id", "version", "blob key generator"}
+var idbObjectStoreMetaNames = []string{"name", "key path", "auto increment", "evictable", "last version", "max index id", "has key path", "key generator"}
+var idbIndexMetaNames = []string{"name", "unique", "key path", "multi entry"}
+
+func metaName(names []string, typ int64) string {
+	if typ >= 0 && typ < int64(len(names)) {
+		return names[typ]
+	}
+	return fmt.Sprintf("type %d", typ)
+}
+
+func idbDatabaseName(id int64) string {
+	if name, ok := idbDatabaseNames[id]; ok {
+		return name
+	}
+	return fmt.Sprintf("db%d", id)
+}
+
+func idbObjectStoreName(db, id int64) string {
+	if name, ok := idbObjectStoreNames[[2]int64{db, id}]; ok {
+		return name
+	}
+	return fmt.Sprintf("store%d", id)
+}
+
+func idbIndexName(db, store, id int64) string {
+	if name, ok := idbIndexNames[[3]int64{db, store, id}]; ok {
+		return name
+	}
+	return fmt.Sprintf("index%d", id)
+}
+
+// Key as database/store[/index] followed by its IndexedDB key, or as the
+// metadata entry it is
+func formatIDBKey(key []byte) (string, bool) {
+	p, rest, ok := decodeIDBPrefix(key)
+	if !ok {
+		return "", false
+	}
+	r := &idbReader{rest}
+	var out strings.Builder
+	var err error
+	switch p.kind() {
+	case idbGlobalMeta:
+		err = formatIDBGlobalMeta(&out, r)
+	case idbDatabaseMeta:
+		out.WriteString(idbDatabaseName(p.database) + " (meta) ")
+		err = formatIDBDatabaseMeta(&out, p.database, r)
+	case idbRecord, idbExists, idbBlob:
+		out.WriteString(idbDatabaseName(p.database) + "/" + idbObjectStoreName(p.database, p.objectStore))
+		out.WriteString(map[int]string{idbRecord: "", idbExists: " (exists)", idbBlob: " (blob)"}[p.kind()] + ": ")
+		err = formatEncodedIDBKey(&out, r, 0)
+	case idbIndex:
+		out.WriteString(idbDatabaseName(p.database) + "/" + idbObjectStoreName(p.database, p.objectStore) + "/" + idbIndexName(p.database, p.objectStore, p.index) + ": ")
+		if err = formatEncodedIDBKey(&out, r, 0); err == nil && len(r.buf) > 0 {
+			if _, err = r.varint(); err == nil && len(r.buf) > 0 { // Sequence number
+				out.WriteString(" → ")
+				err = formatEncodedIDBKey(&out, r, 0)
+			}
+		}
+	default:
+		return "", false
+	}
+	if err != nil || len(r.buf) > 0 {
+		return "", false
+	}
+	return out.String(), true
+}
+
+func formatIDBGlobalMeta(out *strings.Builder, r *idbReader) error {
+	typ, err := r.byte()
+	if err != nil {
+		return err
+	}
+	out.WriteString("(global) ")
+	switch {
+	case typ < 7:
+		out.WriteString(idbGlobalMetaNames[typ])
+	case typ == 50:
+		out.WriteString("scopes " + base64.RawStdEncoding.EncodeToString(r.buf))
+		r.buf = nil
+	case typ == 100:
+		id, err := r.varint()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "database free list %d", id)
+	case typ == 201:
+		origin, err := r.stringWithLength()
+		if err != nil {
+			return err
+		}
+		name, err := r.stringWithLength()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "database name %s %s", quoteJSONString(decodeUTF16BE(origin)), quoteJSONString(decodeUTF16BE(name)))
+	default:
+		return fmt.Errorf("unknown global metadata type %d", typ)
+	}
+	return nil
+}
+
+func formatIDBDatabaseMeta(out *strings.Builder, db int64, r *idbReader) error {
+	typ, err := r.byte()
+	if err != nil {
+		return err
+	}
+	// IDs and metadata type after the type byte: v a varint, b a byte
+	layouts := map[byte]string{50: "vb", 100: "vvb", 150: "v", 151: "vv", 201: "v"}
+	var ids []int64
+	for _, part := range layouts[typ] {
+		id, err := r.number(part == 'b')
+		if err != nil {
+			return err
+		}
+		ids = append(ids, id)
+	}
+	switch {
+	case typ < 6:
+		out.WriteString(idbDatabaseMetaNames[typ])
+	case typ == 50:
+		fmt.Fprintf(out, "object store %s %s", idbObjectStoreName(db, ids[0]), metaName(idbObjectStoreMetaNames, ids[1]))
+	case typ == 100:
+		fmt.Fprintf(out, "index %s/%s %s", idbObjectStoreName(db, ids[0]), idbIndexName(db, ids[0], ids[1]), metaName(idbIndexMetaNames, ids[2]))
+	case typ == 150:
+		fmt.Fprintf(out, "object store free list %d", ids[0])
+	case typ == 151:
+		fmt.Fprintf(out, "index free list %d/%d", ids[0], ids[1])
+	case typ == 200, typ == 201:
+		name, err := r.stringWithLength()
+		if err != nil {
+			return err
+		}
+		if typ == 200 {
+			fmt.Fprintf(out, "object store id of %s", quoteJSONString(decodeUTF16BE(name)))
+		} else {
+			fmt.Fprintf(out, "index id of %s in %s", quoteJSONString(decodeUTF16BE(name)), idbObjectStoreName(db, ids[0]))
+		}
+	default:
+		return fmt.Errorf("unknown database metadata type %d", typ)
+	}
+	return nil
+}
+
+// Read the database, object store and index names from the metadata
+func loadIndexedDBNames() error {
+	iter := db.NewIterator(nil, nil)
+	defer iter.Release()
+	globalNames := append(encodeIDBPrefix(idbPrefix{}), 201)
+	for ok := iter.Seek(globalNames); ok && bytes.HasPrefix(iter.Key(), globalNames); ok = iter.Next() {
+		r := &idbReader{iter.Key()[len(globalNames):]}
+		if _, err := r.stringWithLength(); err != nil {
+			continue
+		}
+		name, err := r.stringWithLength()
+		if err != nil {
+			continue
+		}
+		id := int64(0) // Little-endian, in as few bytes as it takes
+		for i := len(iter.Value()) - 1; i >= 0; i-- {
+			id = id<<8 | int64(iter.Value()[i])
+		}
+		idbDatabaseNames[id] = decodeUTF16BE(name)
+	}
+	for id := range idbDatabaseNames {
+		storeMeta := append(encodeIDBPrefix(idbPrefix{database: id}), 50)
+		for ok := iter.Seek(storeMeta); ok && bytes.HasPrefix(iter.Key(), storeMeta); ok = iter.Next() {
+			r := &idbReader{iter.Key()[len(storeMeta):]}
+			store, err := r.varint()
+			if typ, _ := r.byte(); err == nil && typ == 0 && len(r.buf) == 0 {
+				idbObjectStoreNames[[2]int64{id, store}] = decodeUTF16BE(iter.Value())
+			}
+		}
+		indexMeta := append(encodeIDBPrefix(idbPrefix{database: id}), 100)
+		for ok := iter.Seek(indexMeta); ok && bytes.HasPrefix(iter.Key(), indexMeta); ok = iter.Next() {
+			r := &idbReader{iter.Key()[len(indexMeta):]}
+			store, err := r.varint()
+			index, err2 := r.varint()
+			if typ, _ := r.byte(); err == nil && err2 == nil && typ == 0 && len(r.buf) == 0 {
+				idbIndexNames[[3]int64{id, store, index}] = decodeUTF16BE(iter.Value())
+			}
+		}
+	}
+	return iter.Error()
+}
+
+// Value of an object store record: a version varint, then the value as V8
+// serialized it. Other IndexedDB values are small integers or strings.
+func decodeIndexedDBValue(key, value []byte) (string, bool) {
+	p, _, ok := decodeIDBPrefix(key)
+	if !indexedDB || !ok || p.kind() != idbRecord {
+		return "", false
+	}
+	version, n := binary.Uvarint(value)
+	if n <= 0 {
+		return "", false
+	}
+	text, err := decodeV8Value(value[n:])
+	if err != nil {
+		return "", false
+	}
+	return fmt.Sprintf("// version %d\n%s", version, text), true
+}
+
+// Point at -indexeddb when a database was created with Chromium's comparator
+func openErrorHint(err error) error {
+	if !indexedDB && strings.Contains(err.Error(), "idb_cmp1") {
+		return fmt.Errorf("%w (an IndexedDB database: open it with -indexeddb)", err)
+	}
+	if isLockError(err) {
+		return fmt.Errorf("%w (locked by another process: quit it, or open a copy with -copy-locked)", err)
+	}
+	return err
+}
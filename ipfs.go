@@ -0,0 +1,452 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// IPFS nodes (Kubo) and libp2p keep their datastore in LevelDB under
+// path-like keys: blocks and peers named by base32 multihashes, provider
+// records, IPNS records and pins. -ipfs names those keys with CIDs and
+// peer IDs, and decodes dag-pb blocks, IPNS and address book records.
+// Blocks usually live in the flatfs blockstore next to it, not in LevelDB.
+var ipfsMode bool // -ipfs
+
+// Datastore keys encode binary names in unpadded upper-case base32
+var datastoreBase32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// A recognised key: its label and how its value is stored
+type ipfsKey struct {
+	label string
+	kind  string // "block", "cid", "provider", "addrs", "ipns", "pubkey" or "" for the decoder chain
+}
+
+// The repository's LevelDB datastore: path itself, or its datastore
+// directory when path is the repository holding it
+func ipfsDatastoreDir(path string) string {
+	if _, err := os.Stat(filepath.Join(path, "datastore", "CURRENT")); err == nil {
+		return filepath.Join(path, "datastore")
+	}
+	return path
+}
+
+func parseIPFSKey(key []byte) (ipfsKey, bool) {
+	parts := strings.Split(string(key), "/")
+	if len(parts) < 2 || parts[0] != "" {
+		return ipfsKey{}, false
+	}
+	// Decode the base32 name of part i, nil when it is not one
+	name := func(i int) []byte {
+		if i >= len(parts) {
+			return nil
+		}
+		b, err := datastoreBase32.DecodeString(parts[i])
+		if err != nil || len(b) == 0 {
+			return nil
+		}
+		return b
+	}
+	path := strings.Join(parts[:min(len(parts), 3)], "/")
+	switch {
+	case parts[1] == "blocks" && len(parts) == 3 && isMultihash(name(2)):
+		return ipfsKey{"block " + rawBlockCID(name(2)), "block"}, true
+	case parts[1] == "providers" && len(parts) == 4 && name(2) != nil && name(3) != nil:
+		target := fmt.Sprintf("multihash 0x%x", name(2))
+		if isMultihash(name(2)) {
+			target = rawBlockCID(name(2))
+		} else if cid, ok := formatCID(name(2)); ok {
+			target = cid
+		}
+		return ipfsKey{fmt.Sprintf("provider %s of %s", formatPeerID(name(3)), target), "provider"}, true
+	case path == "/peers/addrs" && len(parts) == 4 && name(3) != nil:
+		return ipfsKey{"addresses of peer " + formatPeerID(name(3)), "addrs"}, true
+	case path == "/peers/keys" && len(parts) == 5 && name(3) != nil:
+		kind := ""
+		if parts[4] == "pub" {
+			kind = "pubkey"
+		}
+		return ipfsKey{fmt.Sprintf("%s key of peer %s", parts[4], formatPeerID(name(3))), kind}, true
+	case path == "/peers/metadata" && len(parts) >= 5 && name(3) != nil:
+		return ipfsKey{fmt.Sprintf("metadata %s of peer %s", strings.Join(parts[4:], "/"), formatPeerID(name(3))), ""}, true
+	case parts[1] == "ipns" && len(parts) == 3 && name(2) != nil:
+		routing := name(2)
+		if id, ok := bytes.CutPrefix(routing, []byte("/ipns/")); ok {
+			return ipfsKey{"IPNS record of " + formatPeerID(id), "ipns"}, true
+		}
+		return ipfsKey{"IPNS record " + displayKey(routing), "ipns"}, true
+	case string(key) == "/local/filesroot":
+		return ipfsKey{"MFS root", "cid"}, true
+	case path == "/pins/pin" && len(parts) == 4:
+		return ipfsKey{"pin " + parts[3], ""}, true
+	case path == "/pins/index" && len(parts) >= 4:
+		return ipfsKey{"pin index " + strings.Join(parts[3:], "/"), ""}, true
+	}
+	return ipfsKey{}, false
+}
+
+// Label of an IPFS datastore key, for the key list
+func formatIPFSKey(key []byte) (string, bool) {
+	k, ok := parseIPFSKey(key)
+	return k.label, ok
+}
+
+// Value of a recognised IPFS key decoded by the key's kind
+func decodeIPFSValue(key, value []byte) (string, bool) {
+	if !ipfsMode {
+		return "", false
+	}
+	k, ok := parseIPFSKey(key)
+	if !ok {
+		return "", false
+	}
+	switch k.kind {
+	case "block":
+		return decodeDagPB(value)
+	case "cid":
+		return formatCID(value)
+	case "provider":
+		if nanos, n := binary.Uvarint(value); n == len(value) {
+			return time.Unix(0, int64(nanos)).UTC().Format(time.RFC3339Nano), true
+		}
+	case "ipns":
+		return decodeIPNSRecord(value)
+	case "addrs":
+		return decodePeerAddrs(value)
+	case "pubkey":
+		return decodeLibp2pKey(value)
+	}
+	return "", false
+}
+
+// Indented JSON of v without HTML escaping
+func renderJSONValue(v any) (string, bool) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return "", false
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), true
+}
+
+// Bytes as text when printable, else as base64
+func ipfsBytes(b []byte) string {
+	if isPrintableText(b) {
+		return string(b)
+	}
+	return "base64:" + base64.StdEncoding.EncodeToString(b)
+}
+
+// Walk the fields of a protobuf message, failing on wire types fn does not expect
+func walkProtoFields(b []byte, fn func(r *protoReader, num, wire int) error) error {
+	r := &protoReader{buf: b}
+	for !r.done() {
+		num, wire, err := r.tag()
+		if err != nil {
+			return err
+		}
+		if err := fn(r, num, wire); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var errUnexpectedField = errors.New("unexpected field")
+
+type dagPBLink struct {
+	Hash  string  `json:"Hash"`
+	Name  *string `json:"Name,omitempty"`
+	Tsize *uint64 `json:"Tsize,omitempty"`
+}
+
+type unixFSData struct {
+	Type       string   `json:"Type"`
+	Data       string   `json:"Data,omitempty"`
+	Filesize   *uint64  `json:"filesize,omitempty"`
+	Blocksizes []uint64 `json:"blocksizes,omitempty"`
+	HashType   *uint64  `json:"hashType,omitempty"`
+	Fanout     *uint64  `json:"fanout,omitempty"`
+	Mode       string   `json:"mode,omitempty"`
+}
+
+var unixFSTypes = []string{"Raw", "Directory", "File", "Metadata", "Symlink", "HAMTShard"}
+
+// A dag-pb node (links, then data), its data decoded as UnixFS when it is
+func decodeDagPB(value []byte) (string, bool) {
+	node := struct {
+		Links []dagPBLink `json:"Links"`
+		Data  any         `json:"Data,omitempty"`
+	}{Links: []dagPBLink{}}
+	var data []byte
+	hasData := false
+	err := walkProtoFields(value, func(r *protoReader, num, wire int) error {
+		switch {
+		case num == 2 && wire == wireBytes && !hasData: // Links come before the data
+			b, err := r.bytes()
+			if err != nil {
+				return err
+			}
+			link, err := decodeDagPBLink(b)
+			node.Links = append(node.Links, link)
+			return err
+		case num == 1 && wire == wireBytes && !hasData:
+			var err error
+			data, err = r.bytes()
+			hasData = true
+			return err
+		}
+		return errUnexpectedField
+	})
+	if err != nil || (len(node.Links) == 0 && !hasData) {
+		return "", false
+	}
+	if hasData {
+		if fs, ok := decodeUnixFSData(data); ok {
+			node.Data = fs
+		} else {
+			node.Data = ipfsBytes(data)
+		}
+	}
+	return renderJSONValue(node)
+}
+
+func decodeDagPBLink(b []byte) (dagPBLink, error) {
+	var link dagPBLink
+	err := walkProtoFields(b, func(r *protoReader, num, wire int) error {
+		switch {
+		case num == 1 && wire == wireBytes:
+			hash, err := r.bytes()
+			if err != nil {
+				return err
+			}
+			cid, ok := formatCID(hash)
+			if !ok {
+				return errors.New("bad link CID")
+			}
+			link.Hash = cid
+		case num == 2 && wire == wireBytes:
+			name, err := r.bytes()
+			text := string(name)
+			link.Name = &text
+			return err
+		case num == 3 && wire == wireVarint:
+			size, err := r.varint()
+			link.Tsize = &size
+			return err
+		default:
+			return errUnexpectedField
+		}
+		return nil
+	})
+	if err == nil && link.Hash == "" {
+		err = errors.New("link without a CID")
+	}
+	return link, err
+}
+
+func decodeUnixFSData(b []byte) (*unixFSData, bool) {
+	var fs unixFSData
+	hasType := false
+	err := walkProtoFields(b, func(r *protoReader, num, wire int) error {
+		if num == 2 && wire == wireBytes {
+			data, err := r.bytes()
+			fs.Data = ipfsBytes(data)
+			return err
+		}
+		if wire != wireVarint || num < 1 || num > 7 {
+			return errUnexpectedField
+		}
+		v, err := r.varint()
+		switch num {
+		case 1:
+			if v >= uint64(len(unixFSTypes)) {
+				return errUnexpectedField
+			}
+			fs.Type, hasType = unixFSTypes[v], true
+		case 3:
+			fs.Filesize = &v
+		case 4:
+			fs.Blocksizes = append(fs.Blocksizes, v)
+		case 5:
+			fs.HashType = &v
+		case 6:
+			fs.Fanout = &v
+		case 7:
+			fs.Mode = fmt.Sprintf("%04o", v)
+		}
+		return err
+	})
+	return &fs, err == nil && hasType
+}
+
+// IPNS records: the path a name points at, its validity and signatures
+func decodeIPNSRecord(value []byte) (string, bool) {
+	var record struct {
+		Value        string  `json:"value,omitempty"`
+		ValidityType *uint64 `json:"validityType,omitempty"`
+		Validity     string  `json:"validity,omitempty"`
+		Sequence     *uint64 `json:"sequence,omitempty"`
+		TTL          string  `json:"ttl,omitempty"`
+		PubKey       any     `json:"pubKey,omitempty"`
+		SignatureV1  string  `json:"signatureV1,omitempty"`
+		SignatureV2  string  `json:"signatureV2,omitempty"`
+		Data         any     `json:"data,omitempty"`
+	}
+	err := walkProtoFields(value, func(r *protoReader, num, wire int) error {
+		if wire == wireVarint && (num == 3 || num == 5 || num == 6) {
+			v, err := r.varint()
+			switch num {
+			case 3:
+				record.ValidityType = &v
+			case 5:
+				record.Sequence = &v
+			case 6:
+				record.TTL = time.Duration(v).String()
+			}
+			return err
+		}
+		if wire != wireBytes || num < 1 || num > 9 {
+			return errUnexpectedField
+		}
+		b, err := r.bytes()
+		switch num {
+		case 1:
+			record.Value = ipfsBytes(b)
+		case 2:
+			record.SignatureV1 = fmt.Sprintf("%d bytes", len(b))
+		case 4:
+			record.Validity = ipfsBytes(b)
+		case 7:
+			if key, ok := libp2pKey(b); ok {
+				record.PubKey = key
+			} else {
+				record.PubKey = ipfsBytes(b)
+			}
+		case 8:
+			record.SignatureV2 = fmt.Sprintf("%d bytes", len(b))
+		case 9:
+			if text, err := decodeCBOR(b); err == nil {
+				record.Data = json.RawMessage(text)
+			} else {
+				record.Data = ipfsBytes(b)
+			}
+		default:
+			return errUnexpectedField
+		}
+		return err
+	})
+	if err != nil || record.Value == "" {
+		return "", false
+	}
+	return renderJSONValue(record)
+}
+
+type addrBookAddr struct {
+	Addr   string `json:"addr"`
+	Expiry string `json:"expiry,omitempty"`
+	TTL    string `json:"ttl,omitempty"`
+}
+
+// libp2p address book records: a peer's multiaddrs and when they expire
+func decodePeerAddrs(value []byte) (string, bool) {
+	record := struct {
+		ID              string         `json:"id,omitempty"`
+		Addrs           []addrBookAddr `json:"addrs"`
+		CertifiedRecord string         `json:"certifiedRecord,omitempty"`
+	}{Addrs: []addrBookAddr{}}
+	err := walkProtoFields(value, func(r *protoReader, num, wire int) error {
+		if wire != wireBytes || num < 1 || num > 3 {
+			return errUnexpectedField
+		}
+		b, err := r.bytes()
+		if err != nil {
+			return err
+		}
+		switch num {
+		case 1:
+			record.ID = formatPeerID(b)
+		case 2:
+			addr, err := decodeAddrBookAddr(b)
+			record.Addrs = append(record.Addrs, addr)
+			return err
+		case 3:
+			record.CertifiedRecord = fmt.Sprintf("%d bytes", len(b))
+		}
+		return nil
+	})
+	if err != nil {
+		return "", false
+	}
+	return renderJSONValue(record)
+}
+
+func decodeAddrBookAddr(b []byte) (addrBookAddr, error) {
+	var addr addrBookAddr
+	err := walkProtoFields(b, func(r *protoReader, num, wire int) error {
+		switch {
+		case num == 1 && wire == wireBytes:
+			raw, err := r.bytes()
+			if err != nil {
+				return err
+			}
+			addr.Addr, err = formatMultiaddr(raw)
+			return err
+		case (num == 2 || num == 3) && wire == wireVarint:
+			v, err := r.varint()
+			if num == 2 {
+				addr.Expiry = time.Unix(int64(v), 0).UTC().Format(time.RFC3339)
+			} else {
+				addr.TTL = time.Duration(v).String()
+			}
+			return err
+		}
+		return errUnexpectedField
+	})
+	return addr, err
+}
+
+var libp2pKeyTypes = []string{"RSA", "Ed25519", "Secp256k1", "ECDSA"}
+
+// A libp2p public or private key: its type and key bytes
+func libp2pKey(b []byte) (any, bool) {
+	key := struct {
+		Type string `json:"Type"`
+		Data string `json:"Data"`
+	}{}
+	err := walkProtoFields(b, func(r *protoReader, num, wire int) error {
+		switch {
+		case num == 1 && wire == wireVarint:
+			v, err := r.varint()
+			if err == nil && v >= uint64(len(libp2pKeyTypes)) {
+				return errUnexpectedField
+			}
+			key.Type = libp2pKeyTypes[v]
+			return err
+		case num == 2 && wire == wireBytes:
+			data, err := r.bytes()
+			key.Data = base64.StdEncoding.EncodeToString(data)
+			return err
+		}
+		return errUnexpectedField
+	})
+	return key, err == nil && key.Type != ""
+}
+
+func decodeLibp2pKey(value []byte) (string, bool) {
+	key, ok := libp2pKey(value)
+	if !ok {
+		return "", false
+	}
+	return renderJSONValue(key)
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+)
+
+const jsonExpandDepth = 16 // Levels of encoding unwrapped inside one value
+
+// JSON value parsed with its object keys in stored order
+type jsonNode struct {
+	keys    []string // Object keys; nil for arrays and scalars
+	items   []*jsonNode
+	object  bool
+	array   bool
+	scalar  string  // JSON text of a scalar
+	str     *string // Decoded string scalar, for spotting embedded JSON
+	decoded string  // How this node was found inside a string, if it was
+}
+
+// Pretty-prints JSON with string values holding JSON, or base64 of JSON,
+// expanded in place; the value view's "expanded" format
+type expandedFormatter struct{}
+
+func (expandedFormatter) format(value []byte) string {
+	node, _ := expandJSONValue(value)
+	if node == nil {
+		return defaultFormatter{}.format(value)
+	}
+	var out strings.Builder
+	node.write(&out, "")
+	return out.String()
+}
+
+// Parse value, as JSON or as base64 of JSON, and expand every embedded
+// JSON document it holds. Returns nil when value is neither; count is the
+// number of documents found inside strings.
+func expandJSONValue(value []byte) (*jsonNode, int) {
+	node, err := parseJSONNode(value)
+	if err != nil || node.str != nil {
+		if err == nil {
+			value = []byte(*node.str) // The whole value may be double-encoded
+		}
+		text, how := decodeEmbeddedJSON(string(value))
+		if text == nil {
+			return node, 0
+		}
+		if node, err = parseJSONNode(text); err != nil {
+			return nil, 0
+		}
+		node.decoded = how
+	}
+	count := node.expand(0)
+	if node.decoded != "" {
+		count++
+	}
+	return node, count
+}
+
+// Number of embedded JSON documents in value, for the hint in the value header
+func countEmbeddedJSON(value []byte) int {
+	if len(value) > maxRenderBytes {
+		return 0
+	}
+	_, count := expandJSONValue(value)
+	return count
+}
+
+func parseJSONNode(data []byte) (*jsonNode, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	node, err := readJSONNode(dec)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("trailing data after JSON value")
+	}
+	return node, nil
+}
+
+func readJSONNode(dec *json.Decoder) (*jsonNode, error) {
+	token, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	node := &jsonNode{}
+	switch t := token.(type) {
+	case json.Delim:
+		node.object, node.array = t == '{', t == '['
+		for dec.More() {
+			if node.object {
+				keyToken, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				node.keys = append(node.keys, keyToken.(string))
+			}
+			item, err := readJSONNode(dec)
+			if err != nil {
+				return nil, err
+			}
+			node.items = append(node.items, item)
+		}
+		if _, err := dec.Token(); err != nil { // Closing delimiter
+			return nil, err
+		}
+	case string:
+		node.str = &t
+		node.scalar = quoteJSONString(t)
+	case json.Number:
+		node.scalar = t.String()
+	case bool:
+		node.scalar = "false"
+		if t {
+			node.scalar = "true"
+		}
+	default:
+		node.scalar = "null"
+	}
+	return node, nil
+}
+
+func quoteJSONString(s string) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// Replace string values holding JSON documents with the parsed documents,
+// recursively; returns how many were replaced
+func (n *jsonNode) expand(depth int) int {
+	if depth >= jsonExpandDepth {
+		return 0
+	}
+	count := 0
+	for i, item := range n.items {
+		if item.str != nil {
+			if text, how := decodeEmbeddedJSON(*item.str); text != nil {
+				if inner, err := parseJSONNode(text); err == nil {
+					inner.decoded = how
+					n.items[i], item = inner, inner
+					count++
+				}
+			}
+		}
+		count += item.expand(depth + 1)
+	}
+	return count
+}
+
+// JSON object or array text held in s, directly or base64-encoded
+func decodeEmbeddedJSON(s string) ([]byte, string) {
+	if isJSONDocument([]byte(s)) {
+		return []byte(s), "JSON string"
+	}
+	s = strings.TrimSpace(s)
+	if len(s) < 8 || strings.Trim(s, base64Alphabet) != "" {
+		return nil, ""
+	}
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		if data, err := enc.DecodeString(s); err == nil && isJSONDocument(data) {
+			return data, "base64"
+		}
+	}
+	return nil, ""
+}
+
+const base64Alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/-_="
+
+// An object or array; bare numbers and strings are left as they are
+func isJSONDocument(data []byte) bool {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) < 2 || (trimmed[0] != '{' && trimmed[0] != '[') {
+		return false
+	}
+	return json.Valid(trimmed)
+}
+
+// Indented like json.Indent, with a comment on each expanded document
+func (n *jsonNode) write(out *strings.Builder, indent string) {
+	if !n.object && !n.array {
+		out.WriteString(n.scalar)
+		return
+	}
+	open, close := "[", "]"
+	if n.object {
+		open, close = "{", "}"
+	}
+	out.WriteString(open)
+	if n.decoded != "" {
+		out.WriteString("  // decoded from " + n.decoded)
+	}
+	if len(n.items) == 0 {
+		if n.decoded != "" {
+			out.WriteString("\n" + indent)
+		}
+		out.WriteString(close)
+		return
+	}
+	for i, item := range n.items {
+		out.WriteString("\n" + indent + "  ")
+		if n.object {
+			out.WriteString(quoteJSONString(n.keys[i]) + ": ")
+		}
+		item.write(out, indent+"  ")
+		if i < len(n.items)-1 {
+			out.WriteString(",")
+		}
+	}
+	out.WriteString("\n" + indent + close)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// Build a key from its parts with one of the configured key decoders, or
+// show the parts of the selected key. The key can then be sought, looked up
+// or written.
+func showKeyBuilder() {
+	if len(keyDecoders) == 0 {
+		setStatus("[red]No key decoders configured; add key_decoders to the config file")
+		return
+	}
+	layout, values := 0, []string(nil)
+	for i, d := range keyDecoders {
+		if !bytes.HasPrefix(currentKey, d.prefix) {
+			continue
+		}
+		if parsed, ok := d.decode(currentKey[len(d.prefix):]); ok {
+			layout, values = i, parsed
+			break
+		}
+	}
+	showKeyBuilderForm(layout, values)
+}
+
+func showKeyBuilderForm(layout int, values []string) {
+	d := keyDecoders[layout]
+	inputs := make([]string, len(d.parts))
+	copy(inputs, values)
+
+	form := tview.NewForm()
+	preview := tview.NewTextView().SetDynamicColors(true)
+	preview.SetBackgroundColor(tcell.ColorReset)
+
+	// Key from the filled-in parts, stopping at the first empty one
+	build := func() ([]byte, bool, error) {
+		key := append([]byte{}, d.prefix...)
+		for i, part := range d.parts {
+			if inputs[i] == "" {
+				return key, false, nil
+			}
+			encoded, err := part.encode(inputs[i])
+			if err != nil {
+				return nil, false, fmt.Errorf("%s: %w", part.Name, err)
+			}
+			key = append(key, encoded...)
+		}
+		return key, true, nil
+	}
+	refresh := func() {
+		key, complete, err := build()
+		switch {
+		case err != nil:
+			preview.SetText(fmt.Sprintf("[red]%s", tview.Escape(err.Error())))
+		case complete:
+			preview.SetText("[green]Key[-] 0x" + hex.EncodeToString(key))
+		default:
+			preview.SetText("[yellow]Prefix[-] 0x" + hex.EncodeToString(key) + " [gray](fill every part for Get and Put)[-]")
+		}
+	}
+
+	prefixes := make([]string, len(keyDecoders))
+	for i, other := range keyDecoders {
+		prefixes[i] = displayKey(other.prefix)
+	}
+	form.AddDropDown("Layout", prefixes, layout, func(option string, index int) {
+		if index != layout && index >= 0 {
+			closeDialog("key-builder")
+			showKeyBuilderForm(index, nil)
+		}
+	})
+	for i, part := range d.parts {
+		label := fmt.Sprintf("%s (%s)", part.Name, part.Type)
+		form.AddInputField(label, inputs[i], 48, nil, func(text string) {
+			inputs[i] = text
+			refresh()
+		})
+	}
+
+	form.AddButton("Seek", func() {
+		key, _, err := build()
+		if err != nil {
+			setStatus(fmt.Sprintf("[red]Error: %v", err))
+			return
+		}
+		closeDialog("key-builder")
+		if err := seekToKey(key); err != nil {
+			setStatus(fmt.Sprintf("[red]Error: %v", err))
+		}
+	})
+	form.AddButton("Get", func() {
+		key, complete, err := build()
+		if err != nil {
+			setStatus(fmt.Sprintf("[red]Error: %v", err))
+			return
+		}
+		if !complete {
+			setStatus("[red]Fill in every part to look up a key")
+			return
+		}
+		found, _, err := probeKey(key)
+		switch {
+		case err != nil:
+			setStatus(fmt.Sprintf("[red]Error: %v", err))
+		case !found:
+			setStatus(fmt.Sprintf("[red]%s not found", displayKey(key)))
+		default:
+			closeDialog("key-builder")
+			if err := seekToKey(key); err != nil {
+				setStatus(fmt.Sprintf("[red]Error: %v", err))
+			}
+		}
+	})
+	form.AddButton("Put", func() {
+		key, complete, err := build()
+		if err != nil {
+			setStatus(fmt.Sprintf("[red]Error: %v", err))
+			return
+		}
+		if !complete {
+			setStatus("[red]Fill in every part to write a key")
+			return
+		}
+		closeDialog("key-builder")
+		showInsertDialog(key)
+	})
+	form.AddButton("Cancel", func() { closeDialog("key-builder") })
+	form.SetCancelFunc(func() { closeDialog("key-builder") })
+
+	box := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(form, 0, 1, true).
+		AddItem(preview, 1, 0, false)
+	box.SetBorder(true).SetTitle(" Build key ")
+	box.SetTitleAlign(tview.AlignLeft)
+	box.SetTitleColor(tcell.ColorYellow)
+	box.SetBackgroundColor(tcell.ColorReset)
+	form.SetBackgroundColor(tcell.ColorReset)
+
+	refresh()
+	showDialog("key-builder", box, 76, 2*len(d.parts)+8)
+}
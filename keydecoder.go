@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Structured key layout from the "key_decoders" section of the config file
+type keyDecoderConfig struct {
+	Prefix string          `json:"prefix"` // Keys starting with this (0x hex and b64: allowed) use the layout
+	Parts  []keyPartConfig `json:"parts"`  // Components after the prefix, in order
+}
+
+type keyPartConfig struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`   // See keyPartSizes, plus string and hex
+	Length int    `json:"length"` // Bytes of a string or hex part; 0 takes the rest of the key
+	Unit   string `json:"unit"`   // Of a timestamp: s, ms (default), us or ns since the Unix epoch
+}
+
+// Fixed sizes of the numeric and UUID part types
+var keyPartSizes = map[string]int{
+	"uint8": 1, "uint16be": 2, "uint16le": 2, "uint32be": 4, "uint32le": 4,
+	"uint64be": 8, "uint64le": 8, "int32be": 4, "int64be": 8, "uuid": 16, "timestamp": 8,
+}
+
+// Length of one tick of a timestamp part, by unit
+var timestampUnits = map[string]time.Duration{
+	"s": time.Second, "ms": time.Millisecond, "": time.Millisecond, "us": time.Microsecond, "ns": time.Nanosecond,
+}
+
+type keyDecoder struct {
+	prefix []byte
+	parts  []keyPartConfig
+}
+
+var keyDecoders []keyDecoder // Longest prefix first
+
+// Check the configured key layouts and make them active
+func setupKeyDecoders(configs []keyDecoderConfig) error {
+	keyDecoders = nil
+	for i, c := range configs {
+		prefix, _, err := parseKeyInput(c.Prefix)
+		if err != nil {
+			return fmt.Errorf("key decoder %d: %w", i+1, err)
+		}
+		if len(c.Parts) == 0 {
+			return fmt.Errorf("key decoder %d: no parts", i+1)
+		}
+		for j, part := range c.Parts {
+			_, fixed := keyPartSizes[part.Type]
+			switch {
+			case part.Name == "":
+				return fmt.Errorf("key decoder %d: part %d has no name", i+1, j+1)
+			case !fixed && part.Type != "string" && part.Type != "hex":
+				return fmt.Errorf("key decoder %d: unknown part type %q", i+1, part.Type)
+			case !fixed && part.Length == 0 && j < len(c.Parts)-1:
+				return fmt.Errorf("key decoder %d: only the last part can take the rest of the key", i+1)
+			case part.Type == "timestamp" && timestampUnits[part.Unit] == 0:
+				return fmt.Errorf("key decoder %d: unknown timestamp unit %q, want s, ms, us or ns", i+1, part.Unit)
+			}
+		}
+		keyDecoders = append(keyDecoders, keyDecoder{prefix: prefix, parts: c.Parts})
+	}
+	for i := 1; i < len(keyDecoders); i++ { // Insertion sort keeps config order among equal prefixes
+		for j := i; j > 0 && len(keyDecoders[j].prefix) > len(keyDecoders[j-1].prefix); j-- {
+			keyDecoders[j], keyDecoders[j-1] = keyDecoders[j-1], keyDecoders[j]
+		}
+	}
+	return nil
+}
+
+func (p keyPartConfig) size() int {
+	if size, ok := keyPartSizes[p.Type]; ok {
+		return size
+	}
+	return p.Length
+}
+
+// Key as prefix{name=value ...} if a configured layout fits it exactly
+func decodeKey(key []byte) (string, bool) {
+	d, values, ok := decodeKeyParts(key)
+	if !ok {
+		return "", false
+	}
+	return string(keyDecoders[d].prefix) + "{" + keyDecoders[d].joinParts(values, 0) + "}", true
+}
+
+// The layout fitting key exactly, as an index into keyDecoders, and the text of its parts
+func decodeKeyParts(key []byte) (int, []string, bool) {
+	for i, d := range keyDecoders {
+		if !bytes.HasPrefix(key, d.prefix) {
+			continue
+		}
+		if values, ok := d.decode(key[len(d.prefix):]); ok {
+			return i, values, true
+		}
+	}
+	return 0, nil, false
+}
+
+// name=value of each part from the first on
+func (d keyDecoder) joinParts(values []string, first int) string {
+	parts := make([]string, 0, len(values)-first)
+	for i := first; i < len(values); i++ {
+		parts = append(parts, d.parts[i].Name+"="+values[i])
+	}
+	return strings.Join(parts, " ")
+}
+
+// Key as a branch under prev in the tree key rendering: when both fit the
+// same layout, the leading parts they share are left out and the rest is
+// indented a step per shared part
+func treeKeyText(prev, key []byte) (string, bool) {
+	d, values, ok := decodeKeyParts(key)
+	if !ok {
+		return "", false
+	}
+	prevD, prevValues, ok := decodeKeyParts(prev)
+	if !ok || prevD != d {
+		return "", false
+	}
+	shared := 0
+	for shared < len(values)-1 && values[shared] == prevValues[shared] {
+		shared++
+	}
+	if shared == 0 {
+		return "", false
+	}
+	return strings.Repeat("  ", shared) + "└ " + keyDecoders[d].joinParts(values, shared), true
+}
+
+// Text of each part of a key's remainder after the prefix, if it fits the layout exactly
+func (d keyDecoder) decode(rest []byte) ([]string, bool) {
+	values := make([]string, len(d.parts))
+	for i, part := range d.parts {
+		size := part.size()
+		if size == 0 {
+			size = len(rest)
+		}
+		if size > len(rest) {
+			return nil, false
+		}
+		field := rest[:size]
+		rest = rest[size:]
+
+		var text string
+		switch part.Type {
+		case "uint8":
+			text = strconv.Itoa(int(field[0]))
+		case "uint16be":
+			text = strconv.Itoa(int(binary.BigEndian.Uint16(field)))
+		case "uint16le":
+			text = strconv.Itoa(int(binary.LittleEndian.Uint16(field)))
+		case "uint32be":
+			text = strconv.FormatUint(uint64(binary.BigEndian.Uint32(field)), 10)
+		case "uint32le":
+			text = strconv.FormatUint(uint64(binary.LittleEndian.Uint32(field)), 10)
+		case "uint64be":
+			text = strconv.FormatUint(binary.BigEndian.Uint64(field), 10)
+		case "uint64le":
+			text = strconv.FormatUint(binary.LittleEndian.Uint64(field), 10)
+		case "int32be":
+			text = strconv.Itoa(int(int32(binary.BigEndian.Uint32(field))))
+		case "int64be":
+			text = strconv.FormatInt(int64(binary.BigEndian.Uint64(field)), 10)
+		case "uuid":
+			h := hex.EncodeToString(field)
+			text = h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+		case "string":
+			if !isPrintableText(field) || bytes.ContainsAny(field, " {}") {
+				return nil, false
+			}
+			text = string(field)
+		case "hex":
+			text = hex.EncodeToString(field)
+		case "timestamp":
+			unit := timestampUnits[part.Unit]
+			ticks := int64(binary.BigEndian.Uint64(field))
+			text = time.Unix(0, 0).Add(time.Duration(ticks) * unit).UTC().Format(time.RFC3339Nano)
+			if ticks > math.MaxInt64/int64(unit) || ticks < math.MinInt64/int64(unit) {
+				text = strconv.FormatInt(ticks, 10) // Beyond what time.Duration can hold
+			}
+		}
+		values[i] = text
+	}
+	return values, len(rest) == 0
+}
+
+// Encode prefix{name=value ...}, as decodeKey shows keys, back into bytes.
+// Parts may be left out from the end, giving a prefix to seek or search for.
+func encodeDecodedKey(text string) ([]byte, bool, error) {
+	for _, d := range keyDecoders {
+		rest, found := strings.CutPrefix(text, string(d.prefix))
+		if !found || !strings.HasPrefix(rest, "{") || !strings.HasSuffix(rest, "}") {
+			continue
+		}
+		values := make(map[string]string)
+		for _, field := range strings.Fields(rest[1 : len(rest)-1]) {
+			name, value, ok := strings.Cut(field, "=")
+			if !ok {
+				return nil, true, fmt.Errorf("bad key part %q, want name=value", field)
+			}
+			values[name] = value
+		}
+		key := append([]byte{}, d.prefix...)
+		for _, part := range d.parts {
+			value, ok := values[part.Name]
+			if !ok {
+				break
+			}
+			delete(values, part.Name)
+			encoded, err := part.encode(value)
+			if err != nil {
+				return nil, true, fmt.Errorf("key part %s: %w", part.Name, err)
+			}
+			key = append(key, encoded...)
+		}
+		for name := range values {
+			return nil, true, fmt.Errorf("key part %s is not in the layout, or comes after a missing part", name)
+		}
+		return key, true, nil
+	}
+	return nil, false, nil
+}
+
+func (p keyPartConfig) encode(value string) ([]byte, error) {
+	size := keyPartSizes[p.Type]
+	buf := make([]byte, 8)
+	switch p.Type {
+	case "uuid":
+		data, err := hex.DecodeString(strings.ReplaceAll(value, "-", ""))
+		if err != nil || len(data) != 16 {
+			return nil, fmt.Errorf("bad UUID %q", value)
+		}
+		return data, nil
+	case "string", "hex":
+		data := []byte(value)
+		if p.Type == "hex" {
+			var err error
+			if data, err = hex.DecodeString(value); err != nil {
+				return nil, err
+			}
+		}
+		if p.Length > 0 && len(data) != p.Length {
+			return nil, fmt.Errorf("want %d bytes, got %d", p.Length, len(data))
+		}
+		return data, nil
+	case "timestamp":
+		unit := timestampUnits[p.Unit]
+		var ticks int64
+		if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+			ticks = t.UnixNano() / int64(unit)
+		} else if ticks, err = strconv.ParseInt(value, 10, 64); err != nil {
+			return nil, fmt.Errorf("bad timestamp %q, want RFC 3339 or a Unix time in %s", value, strings.TrimPrefix(unit.String(), "1"))
+		}
+		binary.BigEndian.PutUint64(buf, uint64(ticks))
+		return buf, nil
+	case "int32be", "int64be":
+		v, err := strconv.ParseInt(value, 10, 8*size)
+		if err != nil {
+			return nil, err
+		}
+		binary.BigEndian.PutUint64(buf, uint64(v))
+		return buf[8-size:], nil
+	}
+	v, err := strconv.ParseUint(value, 10, 8*size)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasSuffix(p.Type, "le") {
+		binary.LittleEndian.PutUint64(buf, v)
+		return buf[:size], nil
+	}
+	binary.BigEndian.PutUint64(buf, v)
+	return buf[8-size:], nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestTreeKeyText(t *testing.T) {
+	err := setupKeyDecoders([]keyDecoderConfig{{Prefix: "o:", Parts: []keyPartConfig{
+		{Name: "id", Type: "uint16be"}, {Name: "kind", Type: "uint8"}, {Name: "name", Type: "string"},
+	}}, {Prefix: "u:", Parts: []keyPartConfig{{Name: "id", Type: "uint16be"}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer setupKeyDecoders(nil)
+	tests := []struct {
+		name      string
+		prev, key string
+		want      string
+	}{
+		{"same id", "o:\x00\x2a\x01a", "o:\x00\x2a\x02b", "  └ kind=2 name=b"},
+		{"same id and kind", "o:\x00\x2a\x01a", "o:\x00\x2a\x01b", "    └ name=b"},
+		{"other id", "o:\x00\x2a\x01a", "o:\x00\x2b\x01a", ""},
+		{"other layout", "u:\x00\x2a", "o:\x00\x2a\x01a", ""},
+		{"previous key not decoded", "other", "o:\x00\x2a\x01a", ""},
+		{"key not decoded", "o:\x00\x2a\x01a", "o:\x00", ""},
+		{"single part", "u:\x00\x2a", "u:\x00\x2b", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := treeKeyText([]byte(tt.prev), []byte(tt.key))
+			if ok != (tt.want != "") || got != tt.want {
+				t.Errorf("treeKeyText(%q, %q) = %q, %v, want %q", tt.prev, tt.key, got, ok, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Typed key or search text. "0x..." is hex and "b64:..." is base64 (standard
+// or URL alphabet, padding optional) for binary keys; a leading backslash
+// makes the rest literal text, e.g. \0x1 searches for "0x1". Keys with a
+// configured layout can be typed as shown, prefix{name=value ...}, and so can
+// keys ending in a binary UUID or ULID, text followed by uuid:... or ulid:....
+func parseKeyInput(text string) (key []byte, raw bool, err error) {
+	if key, ok, err := encodeDecodedKey(text); ok {
+		return key, true, err
+	}
+	switch {
+	case strings.HasPrefix(text, `\`):
+		return []byte(text[1:]), false, nil
+	case strings.HasPrefix(text, "0x"), strings.HasPrefix(text, "0X"):
+		key, err = hex.DecodeString(text[2:])
+		if err != nil {
+			return nil, true, fmt.Errorf("bad hex key: %w", err)
+		}
+		return key, true, nil
+	case strings.HasPrefix(text, "b64:"):
+		encoded := strings.TrimRight(text[4:], "=")
+		encoding := base64.RawStdEncoding
+		if strings.ContainsAny(encoded, "-_") {
+			encoding = base64.RawURLEncoding
+		}
+		key, err = encoding.DecodeString(encoded)
+		if err != nil {
+			return nil, true, fmt.Errorf("bad base64 key: %w", err)
+		}
+		return key, true, nil
+	}
+	if key, ok := parseTrailingIDInput(text); ok {
+		return key, true, nil
+	}
+	return []byte(text), false, nil
+}
+
+// Like parseKeyInput, but forgiving of input still being typed: a trailing
+// odd hex digit or base64 character, or the closing brace of a structured key, may be missing
+func parsePartialKeyInput(text string) ([]byte, bool, error) {
+	switch {
+	case strings.Contains(text, "{") && !strings.HasSuffix(text, "}"):
+		if key, ok, err := encodeDecodedKey(text + "}"); ok {
+			return key, true, err
+		}
+	case strings.HasPrefix(text, "0x"), strings.HasPrefix(text, "0X"):
+		if len(text)%2 == 1 {
+			text = text[:len(text)-1]
+		}
+	case strings.HasPrefix(text, "b64:"):
+		if encoded := strings.TrimRight(text[4:], "="); len(encoded)%4 == 1 {
+			text = "b64:" + encoded[:len(encoded)-1]
+		}
+	}
+	return parseKeyInput(text)
+}
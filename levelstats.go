@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rivo/tview"
+)
+
+// The levels panel (|) reads LevelDB's table list and write-delay counters
+// every few seconds and says what they mean: how many level-0 files there
+// are against the limits at which writes slow down and pause, which levels
+// hold more than their compaction target, how old the tables are, and
+// whether writes were held up. Shard sets get a section per shard.
+
+const levelStatsInterval = 2 * time.Second
+
+var (
+	levelView      *tview.TextView // Toggled with |
+	showLevels     bool
+	levelStatsStop chan struct{}
+)
+
+type levelInfo struct {
+	tables int
+	size   int64
+	oldest time.Time // Modification times of its table files; zero when none could be read
+	newest time.Time
+}
+
+// Tables and write delays of one database (or shard)
+type levelStats struct {
+	name   string // Shard name; empty for a single database
+	levels []levelInfo
+	delayN int
+	delay  time.Duration
+	paused bool
+}
+
+// Split a property of a shard set into its shards; a single database gives one unnamed section
+func propertySections(value string) (names, bodies []string) {
+	if !strings.HasPrefix(value, "=== ") {
+		return []string{""}, []string{value}
+	}
+	for _, line := range strings.SplitAfter(value, "\n") {
+		if name, ok := strings.CutPrefix(strings.TrimSuffix(line, "\n"), "=== "); ok && strings.HasSuffix(name, " ===") {
+			names = append(names, strings.TrimSuffix(name, " ==="))
+			bodies = append(bodies, "")
+			continue
+		}
+		if len(bodies) > 0 {
+			bodies[len(bodies)-1] += line
+		}
+	}
+	return names, bodies
+}
+
+// Read the level statistics of the open database
+func readLevelStats() ([]levelStats, error) {
+	tables, err := db.GetProperty("leveldb.sstables")
+	if err != nil {
+		return nil, err
+	}
+	delays, err := db.GetProperty("leveldb.writedelay")
+	if err != nil {
+		return nil, err
+	}
+	names, bodies := propertySections(tables)
+	_, delayBodies := propertySections(delays)
+	all := make([]levelStats, len(names))
+	for i, name := range names {
+		dirs := []string{dbPath, tempCopy}
+		if name != "" {
+			dirs = []string{filepath.Join(filepath.Dir(shardPattern), name)} // Shards are named by their directory
+		}
+		all[i] = parseLevelTables(bodies[i], dirs)
+		all[i].name = name
+		if i < len(delayBodies) {
+			parseWriteDelay(delayBodies[i], &all[i])
+		}
+	}
+	return all, nil
+}
+
+// Parse leveldb.sstables: a "--- level N ---" line, then num:size[min .. max] per table
+func parseLevelTables(value string, dirs []string) levelStats {
+	var stats levelStats
+	scanner := bufio.NewScanner(strings.NewReader(value))
+	scanner.Buffer(nil, 1<<20) // Lines hold the table's smallest and largest keys
+	for scanner.Scan() {
+		line := scanner.Text()
+		if _, err := fmt.Sscanf(line, "--- level %d ---", new(int)); err == nil {
+			stats.levels = append(stats.levels, levelInfo{})
+			continue
+		}
+		numText, rest, ok := strings.Cut(line, ":")
+		sizeText, _, _ := strings.Cut(rest, "[")
+		num, err1 := strconv.ParseInt(numText, 10, 64)
+		size, err2 := strconv.ParseInt(sizeText, 10, 64)
+		if !ok || err1 != nil || err2 != nil || len(stats.levels) == 0 {
+			continue
+		}
+		level := &stats.levels[len(stats.levels)-1]
+		level.tables++
+		level.size += size
+		if modified, ok := tableModTime(dirs, num); ok {
+			if level.oldest.IsZero() || modified.Before(level.oldest) {
+				level.oldest = modified
+			}
+			if modified.After(level.newest) {
+				level.newest = modified
+			}
+		}
+	}
+	return stats
+}
+
+// Modification time of table file num, looked up in the first directory holding it
+func tableModTime(dirs []string, num int64) (time.Time, bool) {
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		for _, ext := range []string{".ldb", ".sst"} {
+			if info, err := os.Stat(filepath.Join(dir, fmt.Sprintf("%06d%s", num, ext))); err == nil {
+				return info.ModTime(), true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// Parse leveldb.writedelay: DelayN:3 Delay:12ms Paused:false
+func parseWriteDelay(value string, stats *levelStats) {
+	for _, field := range strings.Fields(value) {
+		name, text, _ := strings.Cut(field, ":")
+		switch name {
+		case "DelayN":
+			stats.delayN, _ = strconv.Atoi(text)
+		case "Delay":
+			stats.delay, _ = time.ParseDuration(text)
+		case "Paused":
+			stats.paused = text == "true"
+		}
+	}
+}
+
+// What the statistics mean, worst first; red lines need attention now, yellow ones soon
+func (s levelStats) warnings() (red, yellow []string) {
+	l0 := 0
+	if len(s.levels) > 0 {
+		l0 = s.levels[0].tables
+	}
+	trigger := openOptions.GetCompactionL0Trigger()
+	slowdown := openOptions.GetWriteL0SlowdownTrigger()
+	pause := openOptions.GetWriteL0PauseTrigger()
+
+	switch {
+	case s.paused:
+		red = append(red, fmt.Sprintf("Writes are paused right now: L0 has %d files, at the limit of %d; they resume once compaction merges L0 into L1", l0, pause))
+	case l0 >= pause:
+		red = append(red, fmt.Sprintf("L0 has %d files, at the limit of %d; writes are paused until compaction catches up", l0, pause))
+	case l0 >= slowdown:
+		yellow = append(yellow, fmt.Sprintf("L0 has %d files; writes are likely stalling (each write waits 1ms once L0 has %d files, and all writes pause at %d)", l0, slowdown, pause))
+	case l0 >= trigger:
+		yellow = append(yellow, fmt.Sprintf("L0 has %d files; a compaction into L1 is due (from %d files), and reads check every L0 file until it runs", l0, trigger))
+	}
+	if l0 >= trigger && readOnly {
+		yellow = append(yellow, "The viewer opened the database read-only and does not compact it; the application writing it will, next time it writes")
+	} else if l0 >= trigger && !s.levels[0].oldest.IsZero() && time.Since(s.levels[0].oldest) > time.Hour {
+		yellow = append(yellow, fmt.Sprintf("The oldest L0 table was written %s ago and nothing has compacted it since; m compacts the database", formatAge(s.levels[0].oldest)))
+	}
+
+	for level := 1; level < len(s.levels); level++ {
+		target := openOptions.GetCompactionTotalSize(level)
+		if size := s.levels[level].size; size > 2*target {
+			yellow = append(yellow, fmt.Sprintf("L%d holds %s, %.1fx its %s target; compaction is falling behind, so reads and disk use grow", level, formatBytes(size), float64(size)/float64(target), formatBytes(target)))
+		}
+	}
+	if s.delayN > 0 {
+		yellow = append(yellow, fmt.Sprintf("This viewer's writes were delayed %d times, %s in total, waiting for compaction", s.delayN, s.delay.Round(time.Millisecond)))
+	}
+	return red, yellow
+}
+
+// Plain warnings of every section, for the API
+func levelWarnings(all []levelStats) []string {
+	var lines []string
+	for _, s := range all {
+		red, yellow := s.warnings()
+		for _, line := range append(red, yellow...) {
+			if s.name != "" {
+				line = s.name + ": " + line
+			}
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// How long ago t was, in its largest unit
+func formatAge(t time.Time) string {
+	age := time.Since(t)
+	switch {
+	case age < time.Minute:
+		return fmt.Sprintf("%ds", int(age.Seconds()))
+	case age < time.Hour:
+		return fmt.Sprintf("%dm", int(age.Minutes()))
+	case age < 48*time.Hour:
+		return fmt.Sprintf("%dh", int(age.Hours()))
+	}
+	return fmt.Sprintf("%dd", int(age.Hours()/24))
+}
+
+func refreshLevelView() {
+	if levelView == nil || !showLevels {
+		return
+	}
+	all, err := readLevelStats()
+	if err != nil {
+		levelView.SetText(fmt.Sprintf("[red]Error: %v[-]", err))
+		return
+	}
+	var text strings.Builder
+	for _, s := range all {
+		if s.name != "" {
+			fmt.Fprintf(&text, "[::b]%s[::-]\n", tview.Escape(s.name))
+		}
+		text.WriteString("[gray]Level  Tables        Size      Target  Oldest  Newest[-]\n")
+		for level, info := range s.levels {
+			if info.tables == 0 {
+				continue
+			}
+			target, oldest, newest := "-", "-", "-"
+			if level > 0 {
+				target = formatBytes(openOptions.GetCompactionTotalSize(level))
+			}
+			if !info.oldest.IsZero() {
+				oldest, newest = formatAge(info.oldest), formatAge(info.newest)
+			}
+			fmt.Fprintf(&text, "  L%d  %7d  %10s  %10s  %6s  %6s\n", level, info.tables, formatBytes(info.size), target, oldest, newest)
+		}
+		red, yellow := s.warnings()
+		for _, line := range red {
+			fmt.Fprintf(&text, "[red]! %s[-]\n", line)
+		}
+		for _, line := range yellow {
+			fmt.Fprintf(&text, "[yellow]! %s[-]\n", line)
+		}
+		if len(red)+len(yellow) == 0 {
+			text.WriteString("[green]No stalls or compaction backlog[-]\n")
+		}
+	}
+	levelView.SetText(text.String())
+}
+
+func toggleLevelPanel() {
+	showLevels = !showLevels
+	if !showLevels {
+		mainLayout.RemoveItem(levelView)
+		close(levelStatsStop)
+		return
+	}
+	mainLayout.AddItem(levelView, 12, 0, false)
+	refreshLevelView()
+	levelStatsStop = make(chan struct{})
+	go func(stop chan struct{}) {
+		ticker := time.NewTicker(levelStatsInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				app.QueueUpdateDraw(refreshLevelView)
+			}
+		}
+	}(levelStatsStop)
+}
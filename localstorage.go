@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"unicode/utf16"
+)
+
+// Chromium keeps a site's localStorage in LevelDB under keys of the form
+// "_" + origin + "\x00" + name, and stores names and values as strings with a
+// format byte in front: 0 for UTF-16LE, 1 for Latin-1.
+var chromiumLocalStorage bool // -chromium-localstorage: decode every value with a format byte, whatever its key
+
+const (
+	localStorageUTF16  = 0
+	localStorageLatin1 = 1
+)
+
+// Text of a string with a Local Storage format byte
+func decodeLocalStorageString(data []byte) (string, bool) {
+	if len(data) == 0 {
+		return "", false
+	}
+	switch data[0] {
+	case localStorageUTF16:
+		if len(data)%2 == 0 {
+			return "", false
+		}
+		units := make([]uint16, (len(data)-1)/2)
+		for i := range units {
+			units[i] = binary.LittleEndian.Uint16(data[1+2*i:])
+		}
+		return string(utf16.Decode(units)), true
+	case localStorageLatin1:
+		runes := make([]rune, len(data)-1)
+		for i, b := range data[1:] {
+			runes[i] = rune(b)
+		}
+		return string(runes), true
+	}
+	return "", false
+}
+
+// Origin and item name of a Local Storage key
+func splitLocalStorageKey(key []byte) (origin, name string, ok bool) {
+	if len(key) < 3 || key[0] != '_' {
+		return "", "", false
+	}
+	i := bytes.IndexByte(key, 0)
+	if i < 0 {
+		return "", "", false
+	}
+	if name, ok = decodeLocalStorageString(key[i+1:]); !ok {
+		return "", "", false
+	}
+	return string(key[1:i]), name, true
+}
+
+// Value of a Local Storage item as text; only under Local Storage keys
+// unless -chromium-localstorage is given. UTF-16 text must decode to
+// printable characters, so other binary values are left alone.
+func decodeLocalStorageValue(key, value []byte) (string, bool) {
+	if _, _, ok := splitLocalStorageKey(key); !ok && !chromiumLocalStorage {
+		return "", false
+	}
+	text, ok := decodeLocalStorageString(value)
+	if !ok || !isPrintableText([]byte(text)) {
+		return "", false
+	}
+	return text, true
+}
+
+// Note for the value header naming the origin and item of a Local Storage key
+func localStorageHeaderNote(key []byte) string {
+	origin, name, ok := splitLocalStorageKey(key)
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("[gray](Local Storage of %s, item %s)[-]", sanitizeForDisplay(origin), sanitizeForDisplay(quoteJSONString(name)))
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// LevelDB allows one process per database, so opening the database of a
+// running browser or Electron app fails on its LOCK file. The viewer can
+// then copy the directory and open the copy read-only instead: it shows the
+// data as of the copy, and what the app had not yet written to disk is missing.
+
+var copyLocked bool // -copy-locked: copy a locked database without asking
+
+var tempCopy string // Temporary copy the viewer opened instead of the database, "" when none
+
+func removeTempCopy() {
+	if tempCopy != "" {
+		os.RemoveAll(tempCopy)
+	}
+}
+
+// Whether opening failed because another process holds the database's lock
+func isLockError(err error) bool {
+	if errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.EWOULDBLOCK) {
+		return true
+	}
+	text := strings.ToLower(err.Error())
+	return strings.Contains(text, "resource temporarily unavailable") ||
+		strings.Contains(text, "being used by another process") ||
+		strings.Contains(text, "locked a portion of the file")
+}
+
+// Ask on the terminal whether to open a copy of the locked database at
+// path; without a terminal only -copy-locked says yes
+func confirmLockedCopy(path string) bool {
+	if copyLocked {
+		return true
+	}
+	if info, err := os.Stdin.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	fmt.Fprintf(os.Stderr, "%s is locked by another process (is the app using it still running?).\n", path)
+	fmt.Fprint(os.Stderr, "Open a read-only temporary copy instead? [y/N] ")
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// Copy the files of the database in dir, except its lock, to a new
+// temporary directory. Files deleted by a compaction while copying are
+// skipped, as the manifest copied before them no longer lists them.
+func copyDatabaseDir(dir string) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	tmp, err := os.MkdirTemp("", "leveldb-viewer-copy-")
+	if err != nil {
+		return "", err
+	}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || entry.Name() == "LOCK" {
+			continue
+		}
+		err := copyFile(filepath.Join(dir, entry.Name()), filepath.Join(tmp, entry.Name()))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			os.RemoveAll(tmp)
+			return "", fmt.Errorf("copying %s: %w", entry.Name(), err)
+		}
+	}
+	return tmp, nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -1,31 +1,30 @@
 package main
 
 import (
-	"bytes"
-	"encoding/base64"
-	"encoding/json"
 	"flag"
 	"fmt"
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
 	"github.com/syndtr/goleveldb/leveldb"
-	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/opt"
 	"log"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
-	"unicode"
-	"unicode/utf8"
 )
 
+const dumpDir = "leveldb_dump" // Directory for dumps and exports
+
 var (
 	pageSize         = 100    // Number of keys per page
 	currentPosition  = 0      // Current scroll position in the list
 	displayedKeys    [][]byte // Currently displayed keys
 	currentPrefix    string   // Current prefix filter
 	showHelp         = false  // Show/hide help window
-	db               *leveldb.DB
+	db               database
+	dbPath           string // Path given with -db
 	statusMessage    = ""   // Status bar message
 	statusExpiration time.Time
 	statusBar        *tview.TextView
@@ -37,20 +36,270 @@ var (
 	helpWindow       *tview.TextView
 	hasMoreKeys      = true // Indicates if more keys can be loaded
 	searchBox        *tview.InputField // Make searchBox global for focus check
+	valuePane        *tview.Flex       // Holds the value view and, when comparing, the pinned view
+	pinnedView       *tview.TextView
+	pinnedKey        []byte // Key pinned on the left for comparison
+	pages            *tview.Pages // Root container; dialogs are added as pages over "main"
+	queueView        *tview.TextView // Background task queue panel
+	mainLayout       *tview.Flex     // Key list and value pane above the search box, status bar and optional panels
 )
 
 func main() {
 	// Command-line flags
-	dbPath := flag.String("db", "", "Path to the LevelDB database")
+	flag.Var(dbPathFlag{}, "db", "Path to the LevelDB database; give it again to open more databases in tabs")
+	flag.StringVar(&traceReadsPath, "trace-reads", "", "Debug: log every Get and iteration with the table files and levels it read to this file (disables the block cache)")
+	flag.StringVar(&scanDir, "scan-dir", "", "Find the LevelDB databases under a directory (e.g. a Chrome or Electron profile) and pick one to open from a list")
+	flag.StringVar(&shardPattern, "shards", "", "Open every directory matching a glob (e.g. 'data/db-*') read-only as one merged keyspace")
+	flag.StringVar(&protoDescPath, "proto-desc", "", "Compiled protobuf FileDescriptorSet (protoc --include_imports --descriptor_set_out) for -proto-type")
+	flag.Var(&protoTypes, "proto-type", "Decode values as this protobuf message, e.g. pkg.User, or only under a key prefix, e.g. user:=pkg.User (repeatable)")
+	flag.Var(&avroSchemas, "avro-schema", "Decode values as Avro with this schema file (.avsc), or only under a key prefix, e.g. event:=event.avsc (repeatable)")
+	flag.StringVar(&valueFilter, "value-filter", "", "Show values piped through this shell command (raw value on stdin, stdout shown), e.g. 'jq .' or 'protoc --decode=pkg.User app.proto'; ! changes it in the viewer")
+	flag.StringVar(&valueCharset, "charset", "", "Decode values that are not UTF-8 as text in this charset (shift-jis, gbk, windows-1251 or latin-1); $ changes it in the viewer")
+	flag.BoolVar(&chromiumLocalStorage, "chromium-localstorage", false, "Decode values starting with a Chromium Local Storage format byte (UTF-16LE or Latin-1) as text under any key, not only under _origin keys")
+	flag.IntVar(&valuePageSize, "value-page", valuePageSize, "Elements of a long JSON array or repeated protobuf field shown per page in the value view (0 shows all)")
+	flag.Var(&maxMemory, "max-memory", "Keep the viewer's caches and result buffers within this much memory (e.g. 512MB), spilling large diffs to a temporary file")
+	flag.Var(&dontFillCacheFlag, "dont-fill-cache", "Keep exports, searches, counts, diffs and verifies out of the block cache (default true; -dont-fill-cache=false lets them fill it)")
+	flag.StringVar(&strictReadsFlag, "strict-reads", "", "Read strictness of exports, searches, counts, diffs and verifies: checksum, reader, all or none (comma-separated)")
+	flag.Var(&scanRate, "scan-rate", "Limit exports, verifies and searches to N keys/s (e.g. 5000/s) or bytes/s (e.g. 10MB/s)")
+	flag.BoolVar(&indexedDB, "indexeddb", false, "Open a Chromium IndexedDB database (*.indexeddb.leveldb) read-only with its key order, showing keys as database/store: key and record values deserialized from V8")
+	flag.BoolVar(&bedrockWorld, "bedrock", false, "Open a Minecraft Bedrock world (its folder or db directory), reading its zlib-compressed tables into a temporary read-only copy; chunk keys are shown as labels and NBT values decoded")
+	flag.BoolVar(&gethMode, "geth", false, "Name go-ethereum (geth) chain data keys (headers, bodies, receipts, trie nodes...) and decode their RLP values")
+	flag.BoolVar(&ipfsMode, "ipfs", false, "Name IPFS/libp2p datastore keys (blocks, providers, peers, IPNS) with CIDs and peer IDs and decode dag-pb blocks, IPNS and address book records; a repository path opens its datastore")
+	flag.BoolVar(&copyLocked, "copy-locked", false, "When another process holds the database's lock, open a read-only temporary copy without asking")
+	flag.Var(watchFlag{}, "watch", "Reload the keys and value shown when the database's files change, marking keys added, changed or removed; -watch=500ms sets how often it looks (default 2s)")
+	flag.BoolVar(&readOnly, "read-only", false, "Open the database read-only and disable every command that writes to it")
+	namespaceFlag := flag.String("namespace", "", "Scope the viewer to the keys starting with this prefix, e.g. 0x05 for a column family emulated with a first key byte; % picks one")
+	flag.StringVar(&startupScript, "cmd", "", "Commands run after the viewer starts, separated by ';': seek <key>, search <text>, open-value, format <auto|expanded|msgpack|cbor|bson|thrift|records|text|hex|base64>, keys <raw|escaped|hex|base64|uint-le|uint-be>, pin, dump, conflicts <merge plan>, diff <other db>")
+	flag.StringVar(&workspaceName, "workspace", "", "Open a saved workspace by name (database, search, pinned and selected keys, layout); saved again on quit")
+	recordPath := flag.String("record", "", "Record the commands and navigation of this session to a JSON file for the replay command")
+	configPath := flag.String("config", "", "Path to the JSON config file (default: leveldb-viewer/config.json in the user config directory)")
+	showVersion := flag.Bool("version", false, "Print the version of this build and exit")
+	flag.Usage = printUsage
 	flag.Parse()
+	if *showVersion {
+		fmt.Println(currentBuild())
+		return
+	}
+
+	if err := loadConfig(*configPath); err != nil {
+		log.Fatal(err)
+	}
+	applyMemoryBudget()
+	if err := setupReadOptions(); err != nil {
+		log.Fatal(err)
+	}
+	if valueCharset != "" {
+		if _, err := lookupCharset(valueCharset); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := setupProtoTypes(); err != nil {
+		log.Fatal(err)
+	}
+	if err := setupAvroSchemas(); err != nil {
+		log.Fatal(err)
+	}
+	if err := setupDecoderMappings(); err != nil {
+		log.Fatal(err)
+	}
+	args := flag.Args()
+	if len(args) > 0 && strings.HasPrefix(args[0], bookmarkScheme) {
+		if dbPath != "" {
+			log.Fatal("a bookmark URI cannot be combined with -db")
+		}
+		dbPath, args = args[0], args[1:]
+	}
+	if strings.HasPrefix(dbPath, bookmarkScheme) {
+		if err := applyBookmark(dbPath); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *namespaceFlag != "" {
+		prefix, _, err := parseKeyInput(*namespaceFlag)
+		if err != nil {
+			log.Fatal(fmt.Errorf("-namespace: %w", err))
+		}
+		namespace = prefix
+	}
+	if _, err := parseStartupScript(startupScript); err != nil {
+		log.Fatal(err)
+	}
+	if workspaceName != "" {
+		var err error
+		if openWorkspace, err = loadWorkspace(workspaceName); err != nil {
+			log.Fatal(err)
+		}
+		if openWorkspace != nil && dbPath == "" {
+			dbPath = openWorkspace.Database
+		}
+	}
+
+	// Validate the subcommand before touching the database
+	var command func(args []string) int
+	if len(args) > 0 {
+		var ok bool
+		if command, ok = commands[args[0]]; !ok {
+			fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", args[0])
+			printUsage()
+			os.Exit(2)
+		}
+		if databaselessCommands[args[0]] {
+			os.Exit(command(args[1:]))
+		}
+	}
+	if len(extraDBPaths) > 0 && (command != nil || shardPattern != "" || indexedDB || bedrockWorld || ipfsMode || traceReadsPath != "" || scanDir != "") {
+		log.Fatal("several -db open tabs in the viewer and cannot be combined with a command, -shards, -indexeddb, -bedrock, -ipfs, -trace-reads or -scan-dir")
+	}
+	if scanDir != "" {
+		if dbPath != "" || shardPattern != "" || command != nil {
+			log.Fatal("-scan-dir picks a database in the viewer and cannot be combined with -db, -shards or a command")
+		}
+		picked, err := pickDatabase(scanDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if picked == "" {
+			return
+		}
+		dbPath = picked
+		if databaseKind(picked) == "IndexedDB" && !bedrockWorld {
+			indexedDB = true // Its key order cannot be read without Chromium's comparator
+		}
+	}
+
+	if dbPath == "" && shardPattern == "" {
+		if command != nil {
+			log.Fatal("-db is required with a command")
+		}
+		picked, err := pickRecentDatabase()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if picked == "" {
+			return
+		}
+		dbPath = picked
+	}
+	requestedPath := dbPath // Remembered as opened, before modes resolve it to the directory read
+	if command != nil && selfOpeningCommands[args[0]] {
+		os.Exit(command(args[1:]))
+	}
 
 	// Open the LevelDB database
-	var err error
-	db, err = leveldb.OpenFile(*dbPath, nil)
-	if err != nil {
+	if shardPattern != "" && traceReadsPath != "" {
+		log.Fatal("-trace-reads cannot be combined with -shards")
+	}
+	if shardPattern != "" && indexedDB {
+		log.Fatal("-indexeddb cannot be combined with -shards")
+	}
+	if shardPattern != "" && watchInterval > 0 {
+		log.Fatal("-watch cannot be combined with -shards, whose databases are opened read-only and do not change")
+	}
+	if bedrockWorld && (shardPattern != "" || traceReadsPath != "" || indexedDB) {
+		log.Fatal("-bedrock cannot be combined with -shards, -trace-reads or -indexeddb")
+	}
+	bundle := shardPattern == "" && isBundle(dbPath)
+	if bundle && (bedrockWorld || ipfsMode || traceReadsPath != "" || watchInterval > 0) {
+		log.Fatal("a database in an archive cannot be combined with -bedrock, -ipfs, -trace-reads or -watch")
+	}
+	if bundle {
+		readOnly = true // Writes would only reach an extracted copy, if any
+	}
+	options := budgetOptions(&opt.Options{ReadOnly: readOnly})
+	openPath := dbPath
+	if indexedDB {
+		readOnly = true // Chromium's own writes must not be mixed with ours
+		options = budgetOptions(&opt.Options{ReadOnly: true, Comparer: idbComparer{}})
+	}
+	if ipfsMode {
+		dbPath = ipfsDatastoreDir(dbPath)
+		openPath = dbPath
+	}
+	if bedrockWorld {
+		readOnly = true // Writes would only reach the copy
+		dbPath = bedrockDBDir(dbPath)
+		fmt.Fprintf(os.Stderr, "Reading the world's database %s...\n", dbPath)
+		var err error
+		if tempCopy, err = copyBedrockWorld(dbPath); err != nil {
+			log.Fatal(err)
+		}
+		openPath = tempCopy
+		options = budgetOptions(&opt.Options{ReadOnly: true})
+	}
+	if shardPattern != "" {
+		set, err := openShardSet(shardPattern)
+		if err != nil {
+			log.Fatal(err)
+		}
+		db, dbPath, readOnly = set, shardPattern, true
+	} else if bundle {
+		var err error
+		if db, tempCopy, err = openBundle(dbPath, options); err != nil {
+			log.Fatal(openErrorHint(err))
+		}
+	} else if traceReadsPath != "" {
+		opened, err := openTraced(dbPath, traceReadsPath, options)
+		if err != nil {
+			log.Fatal(openErrorHint(err))
+		}
+		db = tracedDB{singleDB{opened}}
+	} else {
+		opened, err := leveldb.OpenFile(openPath, options)
+		if err != nil && isLockError(err) && tempCopy == "" && confirmLockedCopy(openPath) {
+			fmt.Fprintf(os.Stderr, "Copying %s...\n", openPath)
+			if tempCopy, err = copyDatabaseDir(openPath); err != nil {
+				log.Fatal(err)
+			}
+			readOnly, options.ReadOnly = true, true
+			opened, err = leveldb.OpenFile(tempCopy, options)
+		}
+		if err != nil {
+			removeTempCopy()
+			log.Fatal(openErrorHint(err))
+		}
+		db = singleDB{opened}
+	}
+	openOptions = options
+	defer removeTempCopy()
+	defer func() { db.Close() }() // -watch may have swapped in a fresher copy
+	if indexedDB {
+		if err := loadIndexedDBNames(); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if command != nil {
+		if code := command(args[1:]); code != continueToViewer {
+			db.Close()
+			removeTempCopy()
+			os.Exit(code)
+		}
+	}
+
+	if err := openTabs(); err != nil {
+		log.Fatal(openErrorHint(err))
+	}
+	defer closeTabs()
+	if err := pinSnapshot(); err != nil {
+		log.Fatal(err)
+	}
+	defer releaseSnapshots()
+
+	if shardPattern == "" {
+		if err := rememberDatabase(requestedPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: could not update the recent databases: %v\n", err)
+		}
+	}
+
+	if err := loadNotes(); err != nil {
 		log.Fatal(err)
 	}
-	defer db.Close()
+
+	if *recordPath != "" {
+		if err := startRecording(*recordPath); err != nil {
+			log.Fatal(err)
+		}
+	}
 
 	// Initialize tview application
 	app = tview.NewApplication()
@@ -73,6 +322,17 @@ func main() {
 	valueView.SetBackgroundColor(tcell.ColorReset)
 	valueView.SetTextColor(tcell.ColorWhite)
 
+	pinnedView = tview.NewTextView()
+	pinnedView.SetDynamicColors(true).SetBorder(true).SetTitle(" Pinned ")
+	pinnedView.SetTitleColor(tcell.ColorYellow)
+	pinnedView.SetTitleAlign(tview.AlignLeft)
+	pinnedView.SetScrollable(true)
+	pinnedView.SetWrap(false)
+	pinnedView.SetBackgroundColor(tcell.ColorReset)
+	pinnedView.SetTextColor(tcell.ColorWhite)
+
+	valuePane = tview.NewFlex().AddItem(valueView, 0, 1, false)
+
 	statusBar = tview.NewTextView()
 	statusBar.SetDynamicColors(true).SetTextAlign(tview.AlignCenter)
 	statusBar.SetBackgroundColor(tcell.ColorReset)
@@ -89,18 +349,17 @@ func main() {
 	// Search box field style
 	searchBox.SetFieldStyle(tcell.StyleDefault.Foreground(tcell.ColorWhite).Background(tcell.ColorReset))
 	
-	searchBox.SetChangedFunc(func(text string) {
-		currentPrefix = text
-		loadInitialKeys()
-	})
+	searchBox.SetChangedFunc(onSearchChanged)
 
 	searchBox.SetDoneFunc(func(key tcell.Key) {
+		recordAction("search", nil, currentPrefix)
 		app.SetFocus(keyList)
 	})
 
 	// Esc key support in search box
 	searchBox.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
 		if event.Key() == tcell.KeyEsc {
+			recordAction("search", nil, currentPrefix)
 			app.SetFocus(keyList)
 			return nil
 		}
@@ -112,12 +371,50 @@ func main() {
 	[white]Enter[::-]:       Show selected key's value
 	[white]d[::-]:           Dump key/value to file
 	[white]a[::-]:           Dump all keys to file
-	[white]/[::-]:           Focus search box
+	[white]j[::-]:           Export all keys as NDJSON
+	[white]l[::-]:           Export the key list as CSV
+	[white]e[::-]:           Edit value and write it back
+	[white]f[::-]:           Cycle value format (auto, expanded, msgpack, cbor, bson, thrift, records, text, hex, base64)
+	[white]@[::-]:           Cycle the auto format's decoder (best match, or one decoder of the chain)
+	[white]%[::-]:           Scope the viewer to a namespace (keys sharing a first byte), or back to every key
+	[white]$[::-]:           Cycle the charset tried on values that are not UTF-8 (none, shift-jis, gbk, windows-1251, latin-1)
+	[white]&[::-]:           Copy a bookmark URI (ldbv://) that opens the selected key in the current format
+	[white]![::-]:           Pipe shown values through a shell command (e.g. jq .), or turn that off
+	[white]y[::-]:           Cycle key rendering (raw, escaped, hex, base64, uint-le, uint-be, tree of decoded keys)
+	[white]#[::-]:           Cycle key order (bytes, numeric little-endian, numeric big-endian)
+	[white]Space[::-]:       Mark/unmark key for multi-delete
+	[white]x, Delete[::-]:   Delete marked keys, or the selected key (asks first)
+	[white]o[::-]:           Insert a new key
+	[white]z[::-]:           Build a key from its parts, or show the selected key's parts
+	[white]b[::-]:           Start staging changes / commit or discard them
+	[white]p[::-]:           Pin/unpin key for comparison
+	[white]v[::-]:           Show key history across exports
+	[white]c[::-]:           Count keys matching search
+	[white]i[::-]:           Verify database checksums
+	[white]m[::-]:           Compact database
+	[white]t[::-]:           Toggle task queue panel
+	[white]g[::-]:           Toggle write heatmap of the busiest key prefixes
+	[white]|[::-]:           Toggle LevelDB levels panel: files per level, table ages and write stall warnings
+	[white]k[::-]:           Check whether a key exists
+	[white]u[::-]:           Restore selected keys from a backup or export
+	[white]/[::-]:           Focus search box (0x<hex> or b64:<base64> match raw key bytes)
+	[white]=[::-]:           Compare with another database, listing keys only here, only there or different
+	[white]^[::-]:           Copy or move the marked keys, or the selected key, to another tab's database
+	[white]< and >[::-]:    Switch to the previous / next database tab (-db given more than once)
+	[white]?[::-]:           Search every open database tab at once, with the matches grouped per database
+	[white]+[::-]:           Follow the newest keys under a prefix as they are written, like tail -f
+	[white]*[::-]:           Chart when the keys matching the search were written, by their timestamps
+	[white]~[::-]:           Refresh: browse the database as it is now instead of the snapshot taken at open
+	[white]n[::-]:           Add/edit a note on the selected key
+	[white]r[::-]:           Write a findings report of noted and marked keys
+	[white]s[::-]:           Show/hide soft-deleted keys
+	[white]w[::-]:           Save workspace
 	[white]h[::-]:           Toggle help window
 	[white]q[::-]:           Quit application
 
 	[::b]IN VALUE VIEW[::-]
-	[white]Arrow Keys[::-]: Scroll value content
+	[white]Arrow Keys[::-]: Scroll value content (both panes when pinned)
+	[white][ and ][::-]:    Previous/next page of a long array or repeated field
 	[white]Esc[::-]:        Return to key list`
 
 	helpWindow = tview.NewTextView().SetText(helpText)
@@ -127,13 +424,49 @@ func main() {
 	helpWindow.SetBackgroundColor(tcell.ColorReset)
 	helpWindow.SetTextColor(tcell.ColorWhite)
 
+	queueView = tview.NewTextView()
+	queueView.SetDynamicColors(true).SetBorder(true).SetTitle(" Tasks ")
+	queueView.SetTitleAlign(tview.AlignLeft)
+	queueView.SetTitleColor(tcell.ColorYellow)
+	queueView.SetScrollable(true)
+	queueView.SetBackgroundColor(tcell.ColorReset)
+	queueView.SetTextColor(tcell.ColorWhite)
+	refreshQueueView()
+
+	heatView = tview.NewTextView()
+	heatView.SetDynamicColors(true).SetBorder(true).SetTitle(" Write heatmap (last minute) ")
+	heatView.SetTitleAlign(tview.AlignLeft)
+	heatView.SetTitleColor(tcell.ColorYellow)
+	heatView.SetBackgroundColor(tcell.ColorReset)
+	heatView.SetTextColor(tcell.ColorWhite)
+
+	levelView = tview.NewTextView()
+	levelView.SetDynamicColors(true).SetScrollable(true).SetBorder(true).SetTitle(" Levels and write stalls ")
+	levelView.SetTitleAlign(tview.AlignLeft)
+	levelView.SetTitleColor(tcell.ColorYellow)
+	levelView.SetBackgroundColor(tcell.ColorReset)
+	levelView.SetTextColor(tcell.ColorWhite)
+
+	pendingView = tview.NewTextView()
+	pendingView.SetDynamicColors(true).SetBorder(true)
+	pendingView.SetTitleAlign(tview.AlignLeft)
+	pendingView.SetTitleColor(tcell.ColorYellow)
+	pendingView.SetScrollable(true)
+	pendingView.SetBackgroundColor(tcell.ColorReset)
+	pendingView.SetTextColor(tcell.ColorWhite)
+
 	// Layout
-	flex := tview.NewFlex().SetDirection(tview.FlexRow)
-	flex.AddItem(tview.NewFlex().
+	mainLayout = tview.NewFlex().SetDirection(tview.FlexRow)
+	if len(tabs) > 1 {
+		mainLayout.AddItem(newTabBar(), 1, 0, false)
+	}
+	mainLayout.AddItem(tview.NewFlex().
 		AddItem(keyList, 0, 1, true).
-		AddItem(valueView, 0, 2, false), 0, 1, true)
-	flex.AddItem(searchBox, 1, 1, false)
-	flex.AddItem(statusBar, 1, 1, false)
+		AddItem(valuePane, 0, 2, false), 0, 1, true)
+	mainLayout.AddItem(searchBox, 1, 1, false)
+	mainLayout.AddItem(statusBar, 1, 1, false)
+
+	pages = tview.NewPages().AddPage("main", mainLayout, true, true)
 
 	// Key handling
 	app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
@@ -142,6 +475,11 @@ func main() {
 			return event
 		}
 
+		if name, _ := pages.GetFrontPage(); name != "main" {
+			// Dialogs handle their own keys
+			return event
+		}
+
 		if currentMode == "value" {
 			if event.Key() == tcell.KeyEsc {
 				app.SetFocus(keyList)
@@ -157,19 +495,138 @@ func main() {
 			dumpCurrentKey()
 			return nil
 		case 'a', 'A':
-			dumpAllKeys()
+			dumpAllKeys("text")
+			return nil
+		case 'j', 'J':
+			dumpAllKeys("ndjson")
+			return nil
+		case 'l', 'L':
+			dumpAllKeys("csv")
+			return nil
+		case 'p', 'P':
+			togglePinnedKey()
+			return nil
+		case 'v', 'V':
+			showKeyHistory()
+			return nil
+		case 'c', 'C':
+			countKeys()
+			return nil
+		case 'i', 'I':
+			verifyDatabase()
+			return nil
+		case 'm', 'M':
+			compactDatabase()
+			return nil
+		case 'e', 'E':
+			editCurrentKey()
+			return nil
+		case 'f', 'F':
+			cycleViewFormat()
+			return nil
+		case ' ':
+			toggleMark()
+			return nil
+		case 'x', 'X':
+			confirmDelete()
+			return nil
+		case 'o', 'O':
+			showInsertDialog(nil)
+			return nil
+		case 'z', 'Z':
+			showKeyBuilder()
+			return nil
+		case 'b', 'B':
+			toggleStaging()
+			return nil
+		case 'n', 'N':
+			showNoteDialog()
+			return nil
+		case 'r', 'R':
+			exportFindingsReport()
+			return nil
+		case 's', 'S':
+			toggleSoftDeleted()
+			return nil
+		case 'w', 'W':
+			showSaveWorkspaceDialog()
+			return nil
+		case 'k', 'K':
+			showExistsDialog()
+			return nil
+		case 'u', 'U':
+			showRestoreDialog()
+			return nil
+		case 'y', 'Y':
+			cycleKeyRendering()
+			return nil
+		case 'g', 'G':
+			toggleHeatPanel()
+			return nil
+		case '#':
+			cycleNumericSort()
+			return nil
+		case '@':
+			cycleDecoder()
+			return nil
+		case '$':
+			cycleCharset()
+			return nil
+		case '%':
+			showNamespacePicker()
+			return nil
+		case '&':
+			copyBookmark()
+			return nil
+		case '!':
+			showValueFilterDialog()
+			return nil
+		case 't', 'T':
+			toggleQueuePanel()
 			return nil
 		case 'h', 'H':
-			showHelp = !showHelp
-			if showHelp {
-				flex.AddItem(helpWindow, 0, 1, false)
-			} else {
-				flex.RemoveItem(helpWindow)
-			}
+			toggleHelpWindow()
+		case '[':
+			turnValuePage(-1)
+			return nil
+		case ']':
+			turnValuePage(1)
+			return nil
 		case '/':
 			app.SetFocus(searchBox)
 			return nil
+		case '=':
+			showDiffDialog()
+			return nil
+		case '^':
+			showCopyDialog()
+			return nil
+		case '<':
+			cycleTab(-1)
+			return nil
+		case '>':
+			cycleTab(1)
+			return nil
+		case '~':
+			refreshSnapshot()
+			return nil
+		case '+':
+			showFollowDialog()
+			return nil
+		case '*':
+			showTimeline()
+			return nil
+		case '|':
+			toggleLevelPanel()
+			return nil
+		case '?':
+			showGlobalSearchDialog()
+			return nil
 		case 'q', 'Q':
+			if len(pendingChanges) > 0 {
+				showConfirm("quit", fmt.Sprintf("Quit and discard %d staged changes?", len(pendingChanges)), "Quit", app.Stop)
+				return nil
+			}
 			app.Stop()
 		}
 
@@ -177,6 +634,9 @@ func main() {
 		case tcell.KeyEnter:
 			showSelectedKeyValue()
 			return nil
+		case tcell.KeyDelete:
+			confirmDelete()
+			return nil
 		case tcell.KeyDown:
 			handleScroll(event)
 		}
@@ -186,6 +646,17 @@ func main() {
 
 	// Value view input capture
 	valueView.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if pinnedKey != nil {
+			return scrollComparison(event)
+		}
+		switch event.Rune() {
+		case '[':
+			turnValuePage(-1)
+			return nil
+		case ']':
+			turnValuePage(1)
+			return nil
+		}
 		switch event.Key() {
 		case tcell.KeyDown:
 			valueView.ScrollToEnd()
@@ -199,24 +670,81 @@ func main() {
 	keyList.SetChangedFunc(func(index int, mainText string, secondaryText string, shortcut rune) {
 		if index >= 0 && index < len(displayedKeys) {
 			currentKey = displayedKeys[index]
+			recordAction("select", currentKey, "")
 			showKeyValue(currentKey)
 			updateKeyListTitle()
+			prefetchAround(index)
 		}
 	})
 
-	loadInitialKeys()
+	loadInitialKeysAsync()
+
+	// Heavy operations run one at a time in the background
+	go runTaskQueue()
+	go runPrefetcher()
+	startScheduledJobs()
+	startMemoryMonitor()
+	startWatch()
 
 	// Start application
-	if err := app.SetRoot(flex, true).SetFocus(keyList).Run(); err != nil {
+	handleShutdownSignals(app.Stop)
+	if webTerm != nil {
+		defer webTerm.shutdown()
+		screen, err := webTerm.firstScreen()
+		if err != nil {
+			return // Interrupted before a browser connected
+		}
+		app.SetScreen(screen)
+	}
+	if err := app.SetRoot(pages, true).SetFocus(keyList).Run(); err != nil {
     	log.Fatal(err)
 	}
+
+	// Let a running task stop at its next key before the databases close
+	shuttingDown.Store(true)
+	if !waitForTasks(10 * time.Second) {
+		fmt.Fprintln(os.Stderr, "A background task did not stop; closing the database anyway")
+	}
+	if len(pendingChanges) > 0 {
+		fmt.Fprintf(os.Stderr, "Discarded %d staged changes that were not committed\n", len(pendingChanges))
+	}
+
+	if workspaceName != "" {
+		if err := saveWorkspace(workspaceName); err != nil {
+			log.Printf("Error saving workspace: %v", err)
+		}
+	}
+}
+
+func toggleQueuePanel() {
+	showQueue = !showQueue
+	if showQueue {
+		mainLayout.AddItem(queueView, 8, 0, false)
+	} else {
+		mainLayout.RemoveItem(queueView)
+	}
+}
+
+func toggleHelpWindow() {
+	showHelp = !showHelp
+	if showHelp {
+		mainLayout.AddItem(helpWindow, 0, 1, false)
+	} else {
+		mainLayout.RemoveItem(helpWindow)
+	}
 }
 
 func updateStatusBar() {
 	if currentMode == "value" {
-		statusBar.SetText("[white]Value View[::-] | [white]↑/↓[::-]: Scroll | [white]Esc[::-]: Back to keys")
+		statusBar.SetText("[white]Value View[::-] | [white]↑/↓[::-]: Scroll | [white]Esc[::-]: Back to keys" + memoryLabel())
+	} else if readOnly {
+		label := "READ-ONLY"
+		if tempCopy != "" {
+			label = "READ-ONLY COPY" // Changes the app makes after the copy are not shown
+		}
+		statusBar.SetText("[red]" + label + "[-] | [white]↑/↓[::-]: Navigate | [white]Enter[::-]: Focus Value | [white]d[::-]: Dump Key | [white]a[::-]: Dump All | [white]p[::-]: Pin | [white]v[::-]: History | [white]t[::-]: Tasks | [white]/[::-]: Search | [white]h[::-]: Help | [white]q[::-]: Quit" + snapshotLabel() + memoryLabel())
 	} else {
-		statusBar.SetText("[white]↑/↓[::-]: Navigate | [white]Enter[::-]: Focus Value | [white]d[::-]: Dump Key | [white]a[::-]: Dump All | [white]/[::-]: Search | [white]h[::-]: Help | [white]q[::-]: Quit")
+		statusBar.SetText("[white]↑/↓[::-]: Navigate | [white]Enter[::-]: Focus Value | [white]d[::-]: Dump Key | [white]a[::-]: Dump All | [white]e[::-]: Edit | [white]x[::-]: Delete | [white]p[::-]: Pin | [white]v[::-]: History | [white]t[::-]: Tasks | [white]/[::-]: Search | [white]h[::-]: Help | [white]q[::-]: Quit" + snapshotLabel() + memoryLabel())
 	}
 }
 
@@ -224,71 +752,74 @@ func showSelectedKeyValue() {
 	currentIndex := keyList.GetCurrentItem()
 	if currentIndex >= 0 && currentIndex < len(displayedKeys) {
 		currentKey = displayedKeys[currentIndex]
+		recordAction("view", currentKey, "")
 		app.SetFocus(valueView)
 		currentMode = "value"
 		updateStatusBar()
 	}
 }
 
+// Search the keys again as the search box changes
+func onSearchChanged(text string) {
+	currentPrefix = text
+	loadInitialKeys()
+	if err := checkSearch(text); err != nil {
+		setStatus(fmt.Sprintf("[red]Error: %v", err))
+	}
+}
+
 // Load the initial page of keys based on the current prefix
 func loadInitialKeys() {
+	keys, more, err := scanFirstPage(currentPrefix)
+	showInitialKeys(keys, more, err)
+}
+
+// Startup fast path: draw the UI with a placeholder first and scan once the first frame is on screen
+func loadInitialKeysAsync() {
 	keyList.Clear()
-	currentPosition = 0
-	displayedKeys = [][]byte{}
-	hasMoreKeys = true
+	keyList.AddItem("[::d]loading…", "", 0, nil)
+	keyList.SetTitle(" Keys (loading…) ")
 
-	iter := db.NewIterator(nil, nil)
-	defer iter.Release()
+	search := currentPrefix
+	var once sync.Once
+	app.SetAfterDrawFunc(func(screen tcell.Screen) {
+		once.Do(func() {
+			go func() {
+				keys, more, err := scanFirstPage(search)
+				app.QueueUpdateDraw(func() {
+					// If the user already searched, that result replaced the placeholder
+					if currentPrefix == search {
+						showInitialKeys(keys, more, err)
+					}
+					applyWorkspace()
+					runStartupScript()
+				})
+			}()
+		})
+	})
+}
 
-	// Convert search term to lowercase once
-	searchLower := strings.ToLower(currentPrefix)
-	
-	for iter.Next() {
-		key := iter.Key()
-		keyStr := string(key)
-		
-		// Case-insensitive substring search
-		if currentPrefix == "" || strings.Contains(strings.ToLower(keyStr), searchLower) {
-			keyCopy := append([]byte{}, key...)
-			displayedKeys = append(displayedKeys, keyCopy)
-			keyList.AddItem(keyStr, "", 0, nil)
-			
-			// Stop when we have a full page
-			if len(displayedKeys) >= pageSize {
-				break
-			}
-		}
-	}
-	
-	// Check if there are more keys
-	hasMoreKeys = iter.Next()
-	if err := iter.Error(); err != nil {
-		setStatus(fmt.Sprintf("[red]Error: %v", err))
-	}
-	
-	updateKeyListTitle()
+// Collect the first page of keys matching search; safe to call off the UI goroutine
+func scanFirstPage(search string) ([][]byte, bool, error) {
+	return scanPage(listSource(search), listFilter(search), nil, pageSize)
 }
 
-// Load a page of keys from the iterator
-func loadPage(iter iterator.Iterator) {
-	searchLower := strings.ToLower(currentPrefix)
-	
-	for i := 0; i < pageSize && iter.Next(); {
-		key := iter.Key()
-		keyStr := string(key)
-		
-		// Case-insensitive substring search
-		if currentPrefix == "" || strings.Contains(strings.ToLower(keyStr), searchLower) {
-			keyCopy := append([]byte{}, key...)
-			displayedKeys = append(displayedKeys, keyCopy)
-			keyList.AddItem(keyStr, "", 0, nil)
-			i++
-		}
-	}
-	hasMoreKeys = iter.Next() // Check if there are more keys
-	if err := iter.Error(); err != nil {
+// Replace the key list with a freshly scanned first page
+func showInitialKeys(keys [][]byte, more bool, err error) {
+	keyList.Clear()
+	currentPosition = 0
+	displayedKeys = keys
+	hasMoreKeys = more
+	valueLRU.clear() // Drop values that may have changed since they were cached
+
+	for i := range keys {
+		keyList.AddItem(listItemText(i), "", 0, nil)
+	}
+	if err != nil {
 		setStatus(fmt.Sprintf("[red]Error: %v", err))
 	}
+
+	updateKeyListTitle()
 }
 
 // Load the next page of keys when scrolling down
@@ -297,35 +828,19 @@ func loadNextPage() bool {
 		return false
 	}
 
-	// Start from the last key we loaded
+	// Continue after the last key we loaded
 	lastKey := displayedKeys[len(displayedKeys)-1]
-	iter := db.NewIterator(nil, nil)
-	defer iter.Release()
+	keys, more, err := scanPage(listSource(currentPrefix), listFilter(currentPrefix), lastKey, pageSize)
+	if err != nil {
+		setStatus(fmt.Sprintf("[red]Error: %v", err))
+	}
+	hasMoreKeys = more
 
-	searchLower := strings.ToLower(currentPrefix)
-	
-	// Seek to the last loaded key
-	if iter.Seek(lastKey) {
-		iter.Next()
-		
-		// Load next page of keys
-		count := 0
-		for ; iter.Valid() && count < pageSize; iter.Next() {
-			key := iter.Key()
-			keyStr := string(key)
-			
-			// Case-insensitive substring search
-			if currentPrefix == "" || strings.Contains(strings.ToLower(keyStr), searchLower) {
-				keyCopy := append([]byte{}, key...)
-				displayedKeys = append(displayedKeys, keyCopy)
-				keyList.AddItem(keyStr, "", 0, nil)
-				count++
-			}
-		}
-		hasMoreKeys = iter.Valid()
-		return count > 0
+	for _, key := range keys {
+		displayedKeys = append(displayedKeys, key)
+		keyList.AddItem(listItemText(len(displayedKeys)-1), "", 0, nil)
 	}
-	return false
+	return len(keys) > 0
 }
 
 // Handle scroll events to load more keys
@@ -346,33 +861,87 @@ func handleScroll(event *tcell.EventKey) {
 
 // Show key value in detail view
 func showKeyValue(key []byte) {
-	value, err := db.Get(key, nil)
-	if err != nil {
-		valueView.SetText(fmt.Sprintf("[red]Error: %v", err))
+	if pinnedKey != nil {
+		showComparison(pinnedKey, key)
 		return
 	}
+
+	value, staged := stagedValue(key)
+	if !staged {
+		var err error
+		if value, err = getValue(key); err != nil {
+			valueView.SetText(fmt.Sprintf("[red]Error: %v", err))
+			return
+		}
+	}
 	
 	if len(value) == 0 {
-		valueView.SetText(fmt.Sprintf("[white]Key[::-]: %s\n\n[white]Value[::-]: (empty)", key))
+		valueView.SetText(fmt.Sprintf("%s\n\n[white]Value[::-]: (empty)", valueHeader(key, value)))
 		return
 	}
 	
-	displayStr := formatValue(value)
-	valueView.SetText(fmt.Sprintf("[white]Key[::-]: %s\n\n[white]Value[::-]: %s", key, displayStr))
+	header := valueHeader(key, value)
+	for _, note := range bitFieldHeaderNotes(key, value) {
+		header += "\n" + note
+	}
+	if valueFilter != "" {
+		showFilteredValue(key, value, header)
+		return
+	}
+	header, displayStr := decodeForView(key, value, header)
+	valueView.SetText(fmt.Sprintf("%s\n\n[white]Value[::-]: %s", header, sanitizeForDisplay(displayStr)))
 }
 
-func formatValue(value []byte) string {
-	if json.Valid(value) {
-		var prettyJSON bytes.Buffer
-		if err := json.Indent(&prettyJSON, value, "", "  "); err == nil {
-			return prettyJSON.String()
+// Decode a non-empty value as the value view shows it, adding the
+// decoder's notes to header
+func decodeForView(key, value []byte, header string) (string, string) {
+	if data, codec, ok := decompressValue(value); ok {
+		header += "\n" + compressionHeaderNote(codec, len(value), len(data))
+		value = data
+	}
+	displayStr, pageLine := formatPageForView(key, value)
+	if pageLine != "" {
+		header += "\n" + pageLine
+	}
+	if viewFormats[viewFormat].formatter == nil {
+		if note := decoderHeaderNote(); note != "" {
+			header += "\n" + note
 		}
+		if n := countEmbeddedJSON(value); n > 0 {
+			header += fmt.Sprintf("\n[gray](embedded JSON documents: %d; f expands them)[-]", n)
+		}
+	}
+	if note := idHeaderNote(key, value); note != "" {
+		header += "\n" + note
+	}
+	if note := localStorageHeaderNote(key); note != "" {
+		header += "\n" + note
+	}
+	if note := bedrockHeaderNote(key); note != "" {
+		header += "\n" + note
 	}
-	return mixedContentDisplay(value)
+	return header, displayStr
+}
+
+// Key line above a value, flagging tombstones and showing the key's note
+func valueHeader(key, value []byte) string {
+	header := fmt.Sprintf("[white]Key[::-]: %s", displayKey(key)) + shardLabel(key)
+	if softDeleteEnabled() && isSoftDeleted(value) {
+		header += " [gray](soft-deleted)[-]"
+	}
+	if change := pendingFor(key); change != nil && change.delete {
+		header += " [red](staged delete)[-]"
+	} else if change != nil {
+		header += " [yellow](staged)[-]"
+	}
+	return header + noteHeader(key)
 }
 
 // Dump current key to file
 func dumpCurrentKey() {
+	if refuseHostAccess() {
+		return
+	}
 	currentIndex := keyList.GetCurrentItem()
 	if currentIndex < 0 || currentIndex >= len(displayedKeys) {
 		setStatus("[red]Invalid selection")
@@ -380,119 +949,85 @@ func dumpCurrentKey() {
 	}
 
 	key := displayedKeys[currentIndex]
-	value, err := db.Get(key, nil)
+	recordAction("dump", key, "")
+	filePath, err := dumpKey(key)
 	if err != nil {
 		setStatus(fmt.Sprintf("[red]Error: %v", err))
 		return
 	}
 
-	dir := "leveldb_dump"
+	setStatus(fmt.Sprintf("[green]Dumped to %s", sanitizeForDisplay(filePath)))
+}
+
+// Write one key and its formatted value to the dump directory, returning the file path
+func dumpKey(key []byte) (string, error) {
+	value, err := browseReader().Get(key, nil)
+	if err != nil {
+		return "", err
+	}
+
+	dir := dumpDir
 	if err := os.MkdirAll(dir, 0755); err != nil {
-		setStatus(fmt.Sprintf("[red]Error creating directory: %v", err))
-		return
+		return "", fmt.Errorf("creating directory: %w", err)
 	}
 
-	filename := strings.Map(func(r rune) rune {
-		if r < 32 || r == '/' || r == '\\' || r == ':' || r == '*' ||
-			r == '?' || r == '"' || r == '<' || r == '>' || r == '|' {
-			return '_'
-		}
-		return r
-	}, string(key))
+	filename := safeFileName(string(key))
 
 	filePath := filepath.Join(dir, filename+".txt")
 	
 	// Format value the same way it's displayed in UI
-	formattedValue := formatValue(value)
+	formattedValue := formatKeyValue(key, value)
 	content := fmt.Sprintf("Key: %s\n\nValue: %s", key, formattedValue)
 	
 	if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
-		setStatus(fmt.Sprintf("[red]Error writing file: %v", err))
-		return
+		return "", fmt.Errorf("writing file: %w", err)
 	}
-
-	setStatus(fmt.Sprintf("[green]Dumped to %s", filePath))
+	return filePath, nil
 }
 
-func dumpAllKeys() {
-	dir := "leveldb_dump"
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		setStatus(fmt.Sprintf("[red]Error creating directory: %v", err))
+// Export in the given format. With a search active, ask whether to export
+// only the matching keys or the whole database.
+func dumpAllKeys(format string) {
+	if refuseHostAccess() {
 		return
 	}
-
-	filePath := filepath.Join(dir, "all_keys.txt")
-	file, err := os.Create(filePath)
-	if err != nil {
-		setStatus(fmt.Sprintf("[red]Error creating file: %v", err))
-		return
-	}
-	defer file.Close()
-
-	iter := db.NewIterator(nil, nil)
-	defer iter.Release()
-
-	count := 0
-	for iter.Next() {
-		key := iter.Key()
-		value := iter.Value()
-		formattedValue := formatValue(value)
-		content := fmt.Sprintf("Key: %s\n\nValue: %s\n\n%s\n", key, formattedValue, strings.Repeat("-", 80))
-		
-		if _, err := file.WriteString(content); err != nil {
-			setStatus(fmt.Sprintf("[red]Error writing key: %v", err))
-			return
-		}
-
-		count++
-	}
-
-	if err := iter.Error(); err != nil {
-		setStatus(fmt.Sprintf("[red]Iterator error: %v", err))
+	if currentPrefix == "" {
+		exportKeys(format, "")
 		return
 	}
-
-	setStatus(fmt.Sprintf("[green]Dumped %d keys to %s", count, filePath))
+	search := currentPrefix
+	modal := tview.NewModal().
+		SetText(fmt.Sprintf("Export only the keys matching %q, or the whole database?", search)).
+		AddButtons([]string{"Matching keys", "Whole database", "Cancel"}).
+		SetDoneFunc(func(index int, label string) {
+			closeDialog("export-scope")
+			switch label {
+			case "Matching keys":
+				exportKeys(format, search)
+			case "Whole database":
+				exportKeys(format, "")
+			}
+		})
+	pages.AddPage("export-scope", modal, true, true)
+	app.SetFocus(modal)
 }
 
-func mixedContentDisplay(value []byte) string {
-	var result strings.Builder
-	pos := 0
-	var binaryBuffer []byte
-
-	flushBinary := func() {
-		if len(binaryBuffer) > 0 {
-			result.WriteString("[b64:")
-			result.WriteString(base64.RawStdEncoding.EncodeToString(binaryBuffer))
-			result.WriteString("]")
-			binaryBuffer = nil
-		}
-	}
-
-	for pos < len(value) {
-		r, size := utf8.DecodeRune(value[pos:])
-		if r == utf8.RuneError && size == 1 {
-			// Invalid UTF-8 byte
-			binaryBuffer = append(binaryBuffer, value[pos])
-			pos++
-		} else if unicode.IsControl(r) {
-			// Control character, collect its bytes
-			binaryBuffer = append(binaryBuffer, value[pos:pos+size]...)
-			pos += size
-		} else {
-			// Flush any pending binary data
-			flushBinary()
-			
-			// Write printable rune
-			result.WriteRune(r)
-			pos += size
-		}
+func exportKeys(format, search string) {
+	name := "Export all keys"
+	if search == "" {
+		recordAction("export", nil, format)
+	} else {
+		recordAction("export-search", nil, format+":"+search)
+		name = fmt.Sprintf("Export keys matching %q", search)
 	}
-	
-	// Flush any remaining binary data
-	flushBinary()
-	
-	return result.String()
+	enqueueTask(name, func(progress func(string)) (string, error) {
+		opts := exportOptions{dir: dumpDir, format: format, csv: cfg.Export.CSV, search: search, prefix: namespace}
+		path, count, err := exportDatabase(opts, progress)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Dumped %d keys to %s", count, path), nil
+	})
 }
 
 // Set status message with expiration
@@ -511,10 +1046,17 @@ func setStatus(message string) {
 
 // Update the Keys title with current position
 func updateKeyListTitle() {
+	order := ""
+	if namespace != nil {
+		order = " in " + namespaceLabel(namespace)
+	}
+	if numericSort != "" {
+		order += " by uint-" + numericSort
+	}
 	if len(displayedKeys) == 0 {
-		keyList.SetTitle(" Keys ")
+		keyList.SetTitle(" Keys" + order + " ")
 	} else {
 		currentIndex := keyList.GetCurrentItem()
-		keyList.SetTitle(fmt.Sprintf(" Keys (%d/%d) ", currentIndex+1, len(displayedKeys)))
+		keyList.SetTitle(fmt.Sprintf(" Keys%s (%d/%d) ", order, currentIndex+1, len(displayedKeys)))
 	}
 }
\ No newline at end of file
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+// The viewer's own memory: the status bar shows its heap and resident size,
+// and -max-memory sets a budget the caches and result buffers keep within.
+// The value cache and LevelDB's block cache are sized from it, Go collects
+// harder as the heap nears it, diff results past their share spill to a
+// temporary file, and the value cache is emptied when the heap still
+// reaches the budget.
+
+var maxMemory byteSize // -max-memory; 0 means no budget
+
+// A size in bytes given as e.g. 512MB, 2GB or 65536
+type byteSize int64
+
+func (s *byteSize) Set(value string) error {
+	spec := strings.TrimSpace(value)
+	number, multiplier := spec, 1.0
+	upper := strings.ToUpper(spec)
+	for _, unit := range []struct {
+		suffix string
+		scale  float64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(upper, unit.suffix) {
+			number, multiplier = spec[:len(spec)-len(unit.suffix)], unit.scale
+			break
+		}
+	}
+	size, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+	if err != nil || size <= 0 {
+		return fmt.Errorf("invalid size %q, want e.g. 512MB or 2GB", value)
+	}
+	*s = byteSize(size * multiplier)
+	return nil
+}
+
+func (s *byteSize) String() string {
+	if s == nil || *s == 0 {
+		return ""
+	}
+	return formatBytes(int64(*s))
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
+
+// Size the caches from the budget and tell the Go runtime about it
+func applyMemoryBudget() {
+	if maxMemory == 0 {
+		return
+	}
+	debug.SetMemoryLimit(int64(maxMemory))
+	valueLRU.resize(min(cacheMaxBytes, int(maxMemory/8)))
+}
+
+// Open options with the block cache sized to the budget
+func budgetOptions(o *opt.Options) *opt.Options {
+	if maxMemory == 0 {
+		return o
+	}
+	if o == nil {
+		o = &opt.Options{}
+	}
+	o.BlockCacheCapacity = max(1<<20, min(opt.DefaultBlockCacheCapacity, int(maxMemory/16)))
+	return o
+}
+
+// Bytes of results (such as diffs) held in memory before the rest spills to disk; 0 means no limit
+func resultBudget() int {
+	return int(maxMemory / 4)
+}
+
+// Go heap in use and resident set size of the process; RSS falls back to
+// the memory obtained from the OS where /proc is not available
+func memoryUsage() (heap, rss uint64) {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	heap, rss = stats.HeapAlloc, stats.Sys
+	if data, err := os.ReadFile("/proc/self/statm"); err == nil {
+		if fields := strings.Fields(string(data)); len(fields) > 1 {
+			if pages, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+				rss = pages * uint64(os.Getpagesize())
+			}
+		}
+	}
+	return heap, rss
+}
+
+// Memory readout appended to the status bar
+func memoryLabel() string {
+	heap, rss := memoryUsage()
+	label := fmt.Sprintf(" | [gray]heap %s, RSS %s", formatBytes(int64(heap)), formatBytes(int64(rss)))
+	if maxMemory != 0 {
+		label += " of " + maxMemory.String()
+	}
+	return label + "[-]"
+}
+
+// Refresh the memory readout every few seconds, and empty the value cache
+// when the heap reaches the budget despite the runtime's memory limit
+func startMemoryMonitor() {
+	go func() {
+		ticker := time.NewTicker(3 * time.Second)
+		defer ticker.Stop()
+		for range ticker.C {
+			if maxMemory != 0 {
+				if heap, _ := memoryUsage(); heap >= uint64(maxMemory)*9/10 {
+					valueLRU.clear()
+					debug.FreeOSMemory()
+				}
+			}
+			if time.Now().After(statusExpiration) {
+				app.QueueUpdateDraw(updateStatusBar)
+			}
+		}
+	}()
+}
+
+// Diff results kept in memory up to resultBudget bytes and appended to a
+// temporary file after that, read back in order by each
+type diffSpill struct {
+	held  []keyDiff
+	size  int
+	file  *os.File
+	out   *bufio.Writer
+	count int
+}
+
+func (s *diffSpill) add(d keyDiff) error {
+	s.count++
+	if s.file == nil && (resultBudget() == 0 || s.size+len(d.key)+32 <= resultBudget()) {
+		s.held = append(s.held, d)
+		s.size += len(d.key) + 32 // The key and the slice header around it
+		return nil
+	}
+	if s.file == nil {
+		file, err := os.CreateTemp("", "leveldb-viewer-diff-*")
+		if err != nil {
+			return err
+		}
+		s.file, s.out = file, bufio.NewWriter(file)
+	}
+	var header [1 + binary.MaxVarintLen64]byte
+	header[0] = d.kind
+	n := binary.PutUvarint(header[1:], uint64(len(d.key)))
+	if _, err := s.out.Write(header[:1+n]); err != nil {
+		return err
+	}
+	_, err := s.out.Write(d.key)
+	return err
+}
+
+func (s *diffSpill) len() int {
+	return s.count
+}
+
+// Call fn with every result in the order added until it returns false
+func (s *diffSpill) each(fn func(keyDiff) bool) error {
+	for _, d := range s.held {
+		if !fn(d) {
+			return nil
+		}
+	}
+	if s.file == nil {
+		return nil
+	}
+	if err := s.out.Flush(); err != nil {
+		return err
+	}
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	in := bufio.NewReader(s.file)
+	for {
+		kind, err := in.ReadByte()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		length, err := binary.ReadUvarint(in)
+		if err != nil {
+			return err
+		}
+		key := make([]byte, length)
+		if _, err := io.ReadFull(in, key); err != nil {
+			return err
+		}
+		if !fn(keyDiff{kind, key}) {
+			return nil
+		}
+	}
+}
+
+// Remove the temporary file
+func (s *diffSpill) close() {
+	if s.file != nil {
+		s.file.Close()
+		os.Remove(s.file.Name())
+	}
+}
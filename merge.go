@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// Merging another database into the open one: keys only in the source are
+// added, and keys in both with different values are conflicts, settled by
+// the policy: skip keeps this database's value, overwrite takes the
+// source's, and fail writes nothing when there is any conflict.
+
+var mergePolicies = map[string]bool{"skip": true, "overwrite": true, "fail": true}
+
+// What a merge found and wrote
+type mergeResult struct {
+	added     int
+	conflicts int
+	replaced  int
+}
+
+// Walk source against the open database, passing each conflict to
+// onConflict, and unless dryRun write the keys the policy takes
+func mergeDatabase(source database, policy string, dryRun bool, onConflict func(keyDiff)) (mergeResult, error) {
+	var result mergeResult
+	var diffs diffSpill
+	defer diffs.close()
+	var spillErr error
+	err := diffRange(db, source, namespaceRange(), func(d keyDiff) bool {
+		switch d.kind {
+		case '+':
+			result.added++
+		case '~':
+			result.conflicts++
+			onConflict(d)
+		default:
+			return true // Only here: left alone
+		}
+		spillErr = diffs.add(d)
+		return spillErr == nil
+	})
+	if err == nil {
+		err = spillErr
+	}
+	if err != nil || dryRun || (policy == "fail" && result.conflicts > 0) {
+		return result, err
+	}
+
+	batch := new(leveldb.Batch)
+	var writeErr error
+	err = diffs.each(func(d keyDiff) bool {
+		if d.kind == '~' && policy != "overwrite" {
+			return true
+		}
+		value, err := source.Get(d.key, nil)
+		if err != nil {
+			writeErr = fmt.Errorf("reading %s: %w", mixedContentDisplay(d.key), err)
+			return false
+		}
+		batch.Put(d.key, value)
+		if d.kind == '~' {
+			result.replaced++
+		}
+		if batch.Len() >= copyBatchSize {
+			writeErr = db.Write(batch, nil)
+			batch.Reset()
+		}
+		return writeErr == nil
+	})
+	if err == nil {
+		err = writeErr
+	}
+	if err == nil && batch.Len() > 0 {
+		err = db.Write(batch, nil)
+	}
+	if err == nil {
+		valueLRU.clear()
+	}
+	return result, err
+}
+
+func cmdMerge(args []string) int {
+	fs := flag.NewFlagSet("merge", flag.ExitOnError)
+	policy := fs.String("on-conflict", "fail", "What to do with keys whose values differ: skip (keep this database's), overwrite (take the source's) or fail (write nothing)")
+	dryRun := fs.Bool("dry-run", false, "Only report the keys that would be added and the conflicts")
+	values := fs.Bool("values", false, "Also print both values of each conflict")
+	fs.Parse(args)
+	if fs.NArg() != 1 || !mergePolicies[*policy] {
+		return commandError("merge")
+	}
+	if !*dryRun && readOnly {
+		fmt.Fprintln(os.Stderr, "Database is open read-only")
+		return 2
+	}
+	if indexedDB {
+		fmt.Fprintln(os.Stderr, "Error: merge compares keys in byte order and cannot be combined with -indexeddb")
+		return 2
+	}
+	if sameFile(fs.Arg(0), dbPath) {
+		fmt.Fprintln(os.Stderr, "Error: the source is the open database")
+		return 2
+	}
+
+	opened, copied, cleanup, err := openReplicationSource(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening source: %v\n", err)
+		return 2
+	}
+	defer cleanup()
+	if copied {
+		fmt.Fprintf(os.Stderr, "%s is locked; merging from a copy\n", filepath.Base(fs.Arg(0)))
+	}
+	source := singleDB{opened}
+
+	out := bufio.NewWriter(os.Stdout)
+	result, err := mergeDatabase(source, *policy, *dryRun, func(d keyDiff) {
+		fmt.Fprintln(out, formatKeyDiff(source, d, *values))
+	})
+	out.Flush()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+
+	switch {
+	case *dryRun:
+		taken := "kept as they are"
+		if *policy == "overwrite" {
+			taken = "overwritten"
+		} else if *policy == "fail" && result.conflicts > 0 {
+			taken = "would stop the merge"
+		}
+		fmt.Printf("Would add %d keys; %d conflicts, %s\n", result.added, result.conflicts, taken)
+	case *policy == "fail" && result.conflicts > 0:
+		fmt.Printf("%d conflicts, nothing written; merge again with -on-conflict skip or overwrite\n", result.conflicts)
+	default:
+		fmt.Printf("Added %d keys, overwrote %d and kept %d conflicting ones\n",
+			result.added, result.replaced, result.conflicts-result.replaced)
+		return 0
+	}
+	if result.conflicts > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+)
+
+// Three-way merge of two databases that drifted from the same seed: the
+// open database (ours), another database (theirs) and an export or backup
+// of the seed (the base). Keys changed on one side only merge on their
+// own; keys changed differently on both sides are conflicts, listed in the
+// merge plan and resolved by hand in the viewer (conflicts.go).
+
+// One side's version of a key; Value is nil when Found is false. Byte
+// slices are stored in plans as base64 by encoding/json.
+type mergeVersion struct {
+	Found bool   `json:"found"`
+	Value []byte `json:"value_b64,omitempty"`
+}
+
+// A key whose versions differ between the sides
+type mergeEntry struct {
+	Key    string       `json:"key"` // Key bytes as a JSON string; KeyB64 is exact
+	KeyB64 []byte       `json:"key_b64"`
+	Base   mergeVersion `json:"base"`
+	Ours   mergeVersion `json:"ours"`
+	Theirs mergeVersion `json:"theirs"`
+}
+
+func (e *mergeEntry) key() []byte { return e.KeyB64 }
+
+type mergePlan struct {
+	Created   time.Time    `json:"created"`
+	Base      string       `json:"base"`
+	Ours      string       `json:"ours"`
+	Theirs    string       `json:"theirs"`
+	KeptOurs  int          `json:"kept_ours"`    // Changed only in ours
+	Unchanged int          `json:"unchanged"`    // Same in ours and theirs
+	Auto      []mergeEntry `json:"auto"`         // Changed only in theirs: apply theirs to ours
+	Conflicts []mergeEntry `json:"conflicts"`    // Changed differently on both sides
+	Applied   bool         `json:"auto_applied"` // Auto changes written to ours
+}
+
+func sameVersion(a, b mergeVersion) bool {
+	return a.Found == b.Found && bytes.Equal(a.Value, b.Value)
+}
+
+// Next key of an iterator that is still positioned, or nil
+func iterKey(iter iterator.Iterator, ok bool) []byte {
+	if !ok {
+		return nil
+	}
+	return iter.Key()
+}
+
+// Walk the base records and both databases in key order and classify every key
+func planThreeWayMerge(basePath string, base []archiveRecord, theirsPath string, theirs keySource) (*mergePlan, error) {
+	plan := &mergePlan{Created: time.Now(), Base: basePath, Ours: dbPath, Theirs: theirsPath}
+	// Exports need not be in key order; a key written twice keeps its last value
+	sort.SliceStable(base, func(i, j int) bool { return bytes.Compare(base[i].key, base[j].key) < 0 })
+	for i := len(base) - 1; i > 0; i-- {
+		if bytes.Equal(base[i-1].key, base[i].key) {
+			base = append(base[:i-1], base[i:]...)
+		}
+	}
+	ours, other := db.NewIterator(nil, scanReadOptions), theirs.NewIterator(nil, scanReadOptions)
+	defer ours.Release()
+	defer other.Release()
+	hasOurs, hasTheirs := ours.Next(), other.Next()
+	for len(base) > 0 || hasOurs || hasTheirs {
+		// The smallest key any side is positioned at
+		var key []byte
+		for _, k := range [][]byte{iterKey(ours, hasOurs), iterKey(other, hasTheirs)} {
+			if k != nil && (key == nil || bytes.Compare(k, key) < 0) {
+				key = k
+			}
+		}
+		if len(base) > 0 && (key == nil || bytes.Compare(base[0].key, key) < 0) {
+			key = base[0].key
+		}
+		key = append([]byte{}, key...)
+
+		entry := mergeEntry{Key: string(key), KeyB64: key}
+		if len(base) > 0 && bytes.Equal(base[0].key, key) {
+			entry.Base = mergeVersion{true, base[0].value}
+			base = base[1:]
+		}
+		if hasOurs && bytes.Equal(ours.Key(), key) {
+			entry.Ours = mergeVersion{true, append([]byte{}, ours.Value()...)}
+			hasOurs = ours.Next()
+		}
+		if hasTheirs && bytes.Equal(other.Key(), key) {
+			scanRate.wait(other.Key(), other.Value())
+			entry.Theirs = mergeVersion{true, append([]byte{}, other.Value()...)}
+			hasTheirs = other.Next()
+		}
+
+		switch {
+		case sameVersion(entry.Ours, entry.Theirs):
+			plan.Unchanged++
+		case sameVersion(entry.Ours, entry.Base):
+			plan.Auto = append(plan.Auto, entry)
+		case sameVersion(entry.Theirs, entry.Base):
+			plan.KeptOurs++
+		default:
+			plan.Conflicts = append(plan.Conflicts, entry)
+		}
+	}
+	if err := ours.Error(); err != nil {
+		return nil, err
+	}
+	return plan, other.Error()
+}
+
+// Write the picked version of each entry to the open database in one batch
+func applyMergeEntries(entries []mergeEntry, pick func(*mergeEntry) mergeVersion) (int, error) {
+	batch := new(leveldb.Batch)
+	for i := range entries {
+		version := pick(&entries[i])
+		if version.Found {
+			batch.Put(entries[i].key(), version.Value)
+		} else {
+			batch.Delete(entries[i].key())
+		}
+		valueLRU.remove(entries[i].key())
+	}
+	if batch.Len() == 0 {
+		return 0, nil
+	}
+	if err := db.Write(batch, nil); err != nil {
+		return 0, err
+	}
+	repinSnapshot()
+	return batch.Len(), nil
+}
+
+func writeMergePlan(plan *mergePlan, dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("creating directory: %w", err)
+	}
+	path := filepath.Join(dir, "merge_plan_"+time.Now().Format(exportTimeLayout)+".json")
+	return path, saveMergePlan(plan, path)
+}
+
+// Write plan to path, replacing the file
+func saveMergePlan(plan *mergePlan, path string) error {
+	data, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func readMergePlan(path string) (*mergePlan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var plan mergePlan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &plan, nil
+}
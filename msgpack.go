@@ -0,0 +1,272 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const msgpackMaxDepth = 64
+
+// Reader over one MessagePack-encoded value
+type msgpackReader struct {
+	buf []byte
+	pos int
+}
+
+var errMsgpackTruncated = errors.New("truncated MessagePack data")
+
+func (r *msgpackReader) take(n int) ([]byte, error) {
+	if n < 0 || n > len(r.buf)-r.pos {
+		return nil, errMsgpackTruncated
+	}
+	b := r.buf[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+// Big-endian unsigned integer of size bytes
+func (r *msgpackReader) uint(size int) (uint64, error) {
+	b, err := r.take(size)
+	if err != nil {
+		return 0, err
+	}
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v, nil
+}
+
+// Pretty-prints MessagePack values as JSON-like text; the value view's "msgpack" format
+type msgpackFormatter struct{}
+
+func (msgpackFormatter) format(value []byte) string {
+	text, err := decodeMsgpack(value)
+	if err != nil {
+		return fmt.Sprintf("(not MessagePack: %v)\n\n%s", err, mixedContentDisplay(value))
+	}
+	return text
+}
+
+// Render value, which must hold exactly one MessagePack object
+func decodeMsgpack(value []byte) (string, error) {
+	r := &msgpackReader{buf: value}
+	var out strings.Builder
+	if err := r.render(&out, "", 0); err != nil {
+		return "", err
+	}
+	if r.pos != len(value) {
+		return "", fmt.Errorf("%d bytes after the value", len(value)-r.pos)
+	}
+	return out.String(), nil
+}
+
+// Whether value looks like a MessagePack map or array: binary, starting
+// with a map or array header and parsing to the last byte. Scalars and
+// text are too ambiguous to detect.
+func looksLikeMsgpack(value []byte) bool {
+	if len(value) < 2 || isPrintableText(value) {
+		return false
+	}
+	switch b := value[0]; {
+	case b >= 0x80 && b <= 0x9f, b >= 0xdc && b <= 0xdf:
+	default:
+		return false
+	}
+	_, err := decodeMsgpack(value)
+	return err == nil
+}
+
+// Write the next object, indenting nested maps and arrays like JSON
+func (r *msgpackReader) render(out *strings.Builder, indent string, depth int) error {
+	if depth > msgpackMaxDepth {
+		return errors.New("nesting too deep")
+	}
+	head, err := r.take(1)
+	if err != nil {
+		return err
+	}
+	b := head[0]
+	switch {
+	case b <= 0x7f: // Positive fixint
+		out.WriteString(strconv.Itoa(int(b)))
+		return nil
+	case b >= 0xe0: // Negative fixint
+		out.WriteString(strconv.Itoa(int(int8(b))))
+		return nil
+	case b <= 0x8f:
+		return r.renderMap(out, int(b&0x0f), indent, depth)
+	case b <= 0x9f:
+		return r.renderArray(out, int(b&0x0f), indent, depth)
+	case b <= 0xbf:
+		return r.renderString(out, int(b&0x1f))
+	}
+
+	switch b {
+	case 0xc0:
+		out.WriteString("null")
+	case 0xc2:
+		out.WriteString("false")
+	case 0xc3:
+		out.WriteString("true")
+	case 0xc4, 0xc5, 0xc6: // bin 8/16/32
+		n, err := r.uint(1 << (b - 0xc4))
+		if err != nil {
+			return err
+		}
+		data, err := r.take(int(n))
+		if err != nil {
+			return err
+		}
+		out.WriteString("[b64:" + base64.RawStdEncoding.EncodeToString(data) + "]")
+	case 0xc7, 0xc8, 0xc9: // ext 8/16/32
+		n, err := r.uint(1 << (b - 0xc7))
+		if err != nil {
+			return err
+		}
+		return r.renderExt(out, int(n))
+	case 0xca:
+		v, err := r.uint(4)
+		if err != nil {
+			return err
+		}
+		out.WriteString(strconv.FormatFloat(float64(math.Float32frombits(uint32(v))), 'g', -1, 32))
+	case 0xcb:
+		v, err := r.uint(8)
+		if err != nil {
+			return err
+		}
+		out.WriteString(strconv.FormatFloat(math.Float64frombits(v), 'g', -1, 64))
+	case 0xcc, 0xcd, 0xce, 0xcf: // uint 8/16/32/64
+		v, err := r.uint(1 << (b - 0xcc))
+		if err != nil {
+			return err
+		}
+		out.WriteString(strconv.FormatUint(v, 10))
+	case 0xd0, 0xd1, 0xd2, 0xd3: // int 8/16/32/64
+		size := 1 << (b - 0xd0)
+		v, err := r.uint(size)
+		if err != nil {
+			return err
+		}
+		shift := 64 - 8*size // Sign-extend
+		out.WriteString(strconv.FormatInt(int64(v<<shift)>>shift, 10))
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8: // fixext 1/2/4/8/16
+		return r.renderExt(out, 1<<(b-0xd4))
+	case 0xd9, 0xda, 0xdb: // str 8/16/32
+		n, err := r.uint(1 << (b - 0xd9))
+		if err != nil {
+			return err
+		}
+		return r.renderString(out, int(n))
+	case 0xdc, 0xdd: // array 16/32
+		n, err := r.uint(2 << (b - 0xdc))
+		if err != nil {
+			return err
+		}
+		return r.renderArray(out, int(n), indent, depth)
+	case 0xde, 0xdf: // map 16/32
+		n, err := r.uint(2 << (b - 0xde))
+		if err != nil {
+			return err
+		}
+		return r.renderMap(out, int(n), indent, depth)
+	default:
+		return fmt.Errorf("invalid type byte 0x%02x", b)
+	}
+	return nil
+}
+
+func (r *msgpackReader) renderString(out *strings.Builder, n int) error {
+	data, err := r.take(n)
+	if err != nil {
+		return err
+	}
+	out.WriteString(quoteJSONString(string(data)))
+	return nil
+}
+
+// Extension of n data bytes; timestamps (type -1) are shown as times
+func (r *msgpackReader) renderExt(out *strings.Builder, n int) error {
+	head, err := r.take(1)
+	if err != nil {
+		return err
+	}
+	data, err := r.take(n)
+	if err != nil {
+		return err
+	}
+	extType := int8(head[0])
+	if extType == -1 {
+		var t time.Time
+		switch n {
+		case 4:
+			t = time.Unix(int64(binary.BigEndian.Uint32(data)), 0)
+		case 8:
+			v := binary.BigEndian.Uint64(data)
+			t = time.Unix(int64(v&(1<<34-1)), int64(v>>34))
+		case 12:
+			t = time.Unix(int64(binary.BigEndian.Uint64(data[4:])), int64(binary.BigEndian.Uint32(data)))
+		}
+		if !t.IsZero() {
+			out.WriteString(quoteJSONString(t.UTC().Format(time.RFC3339Nano)))
+			return nil
+		}
+	}
+	fmt.Fprintf(out, "ext(%d, [b64:%s])", extType, base64.RawStdEncoding.EncodeToString(data))
+	return nil
+}
+
+func (r *msgpackReader) renderArray(out *strings.Builder, n int, indent string, depth int) error {
+	if n > len(r.buf)-r.pos { // Every element takes at least one byte
+		return errMsgpackTruncated
+	}
+	if n == 0 {
+		out.WriteString("[]")
+		return nil
+	}
+	out.WriteString("[")
+	for i := 0; i < n; i++ {
+		out.WriteString("\n" + indent + "  ")
+		if err := r.render(out, indent+"  ", depth+1); err != nil {
+			return err
+		}
+		if i < n-1 {
+			out.WriteString(",")
+		}
+	}
+	out.WriteString("\n" + indent + "]")
+	return nil
+}
+
+func (r *msgpackReader) renderMap(out *strings.Builder, n int, indent string, depth int) error {
+	if 2*n > len(r.buf)-r.pos {
+		return errMsgpackTruncated
+	}
+	if n == 0 {
+		out.WriteString("{}")
+		return nil
+	}
+	out.WriteString("{")
+	for i := 0; i < n; i++ {
+		out.WriteString("\n" + indent + "  ")
+		if err := r.render(out, indent+"  ", depth+1); err != nil { // Keys are usually strings but may be anything
+			return err
+		}
+		out.WriteString(": ")
+		if err := r.render(out, indent+"  ", depth+1); err != nil {
+			return err
+		}
+		if i < n-1 {
+			out.WriteString(",")
+		}
+	}
+	out.WriteString("\n" + indent + "}")
+	return nil
+}
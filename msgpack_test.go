@@ -0,0 +1,104 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDecodeMsgpack(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{"positive fixint", "\x05", "5"},
+		{"negative fixint", "\xff", "-1"},
+		{"nil and booleans", "\x93\xc0\xc2\xc3", "[\n  null,\n  false,\n  true\n]"},
+		{"uint64", "\xcf\xff\xff\xff\xff\xff\xff\xff\xff", "18446744073709551615"},
+		{"int8", "\xd0\x80", "-128"},
+		{"int16", "\xd1\xff\x00", "-256"},
+		{"int64", "\xd3\xff\xff\xff\xff\xff\xff\xff\xfe", "-2"},
+		{"float32", "\xca\x3f\xc0\x00\x00", "1.5"},
+		{"float64", "\xcb\x40\x09\x21\xfb\x54\x44\x2d\x18", "3.141592653589793"},
+		{"fixstr", "\xa3abc", `"abc"`},
+		{"str8 with quote", "\xd9\x03a\"b", `"a\"b"`},
+		{"bin", "\xc4\x03\x00\x01\x02", "[b64:AAEC]"},
+		{"empty array and map", "\x92\x90\x80", "[\n  [],\n  {}\n]"},
+		{"map", "\x82\xa1a\x01\xa1b\x91\x02", "{\n  \"a\": 1,\n  \"b\": [\n    2\n  ]\n}"},
+		{"non-string key", "\x81\x01\xa1x", "{\n  1: \"x\"\n}"},
+		{"array16", "\xdc\x00\x01\x07", "[\n  7\n]"},
+		{"map32", "\xdf\x00\x00\x00\x01\x01\x02", "{\n  1: 2\n}"},
+		{"timestamp32", "\xd6\xff\x00\x00\x00\x00", `"1970-01-01T00:00:00Z"`},
+		{"timestamp64", "\xd7\xff\x00\x00\x00\x04\x00\x00\x00\x01", `"1970-01-01T00:00:01.000000001Z"`},
+		{"timestamp96", "\xc7\x0c\xff\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x3c", `"1970-01-01T00:01:00Z"`},
+		{"other extension", "\xd4\x05\x2a", "ext(5, [b64:Kg])"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeMsgpack([]byte(tt.value))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("decodeMsgpack(%x) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeMsgpackMalformed(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{"empty", "", "truncated"},
+		{"reserved type byte", "\xc1", "invalid type byte 0xc1"},
+		{"truncated uint", "\xcd\x01", "truncated"},
+		{"truncated string", "\xa5ab", "truncated"},
+		{"huge str32", "\xdb\xff\xff\xff\xff", "truncated"},
+		{"huge bin32", "\xc6\xff\xff\xff\xffab", "truncated"},
+		{"huge array32", "\xdd\xff\xff\xff\xff\x01", "truncated"},
+		{"huge map32", "\xdf\x7f\xff\xff\xff\x01\x01", "truncated"},
+		{"array short of elements", "\x93\x01\x02", "truncated"},
+		{"map missing value", "\x81\xa1a", "truncated"},
+		{"truncated extension", "\xd8\x01\x00", "truncated"},
+		{"trailing bytes", "\x01\x02", "1 bytes after the value"},
+		{"nesting too deep", strings.Repeat("\x91", msgpackMaxDepth+2) + "\x01", "too deep"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeMsgpack([]byte(tt.value))
+			if err == nil {
+				t.Fatalf("decodeMsgpack(%x) = %q, want an error containing %q", tt.value, got, tt.want)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error %q, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLooksLikeMsgpack(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  bool
+	}{
+		{"map", "\x81\xa1a\x01", true},
+		{"array", "\x92\x01\x02", true},
+		{"array16", "\xdc\x00\x01\x07", true},
+		{"scalar", "\xcd\x01\x02", false},
+		{"text", "hello", false},
+		{"too short", "\x90", false},
+		{"truncated map", "\x82\xa1a\x01", false},
+		{"trailing bytes", "\x91\x01\x02", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := looksLikeMsgpack([]byte(tt.value)); got != tt.want {
+				t.Errorf("looksLikeMsgpack(%x) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
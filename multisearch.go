@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+// Matches of one query in one database
+type searchResult struct {
+	database string
+	keys     [][]byte
+	more     bool // The limit was reached before the scan finished
+	err      error
+}
+
+// A database taking part in a multi-database search
+type searchTarget struct {
+	name string
+	src  keySource
+}
+
+// Run query against every target concurrently; results come back in target order
+func searchDatabases(targets []searchTarget, query string, limit int) []searchResult {
+	results := make([]searchResult, len(targets))
+	filter := newKeyFilter(query)
+
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		go func(i int, target searchTarget) {
+			defer wg.Done()
+			result := searchResult{database: target.name}
+			iter := target.src.NewIterator(searchRange(query), scanReadOptions)
+			for iter.Next() {
+				scanRate.wait(iter.Key(), iter.Value())
+				if !filter(iter.Key(), iter.Value()) {
+					continue
+				}
+				if limit > 0 && len(result.keys) == limit {
+					result.more = true
+					break
+				}
+				result.keys = append(result.keys, append([]byte{}, iter.Key()...))
+			}
+			result.err = iter.Error()
+			iter.Release()
+			results[i] = result
+		}(i, target)
+	}
+	wg.Wait()
+	return results
+}
+
+// Open extra databases read-only for a search; the caller closes them
+func openSearchTargets(paths []string) ([]searchTarget, []*leveldb.DB, error) {
+	var targets []searchTarget
+	var opened []*leveldb.DB
+	for _, path := range paths {
+		other, err := leveldb.OpenFile(path, &opt.Options{ReadOnly: true})
+		if err != nil {
+			for _, o := range opened {
+				o.Close()
+			}
+			return nil, nil, err
+		}
+		opened = append(opened, other)
+		targets = append(targets, searchTarget{name: path, src: other})
+	}
+	return targets, opened, nil
+}
+
+// Matches listed per database by the viewer's global search
+const globalSearchLimit = 200
+
+// ?: ask for a query and run it against every open tab
+func showGlobalSearchDialog() {
+	if len(tabs) < 2 {
+		setStatus("[yellow]Only one database is open; give -db more than once to search several, or use / to search this one")
+		return
+	}
+	input := newDialogInput(" Search all open databases: ")
+	input.SetText(currentPrefix)
+	input.SetDoneFunc(func(key tcell.Key) {
+		closeDialog("globalsearch")
+		if key != tcell.KeyEnter || strings.TrimSpace(input.GetText()) == "" {
+			return
+		}
+		searchOpenTabs(input.GetText())
+	})
+	showDialog("globalsearch", input, 70, 3)
+}
+
+// Search every tab in the background, each through the snapshot it browses
+func searchOpenTabs(query string) {
+	targets := make([]searchTarget, len(tabs))
+	for i, t := range tabs {
+		var src keySource = t.db
+		switch {
+		case i == activeTab:
+			src = browseReader()
+		case t.snap != nil:
+			src = t.snap
+		}
+		targets[i] = searchTarget{name: tabName(t), src: src}
+	}
+	enqueueTask(fmt.Sprintf("Search %d databases", len(targets)), func(progress func(string)) (string, error) {
+		results := searchDatabases(targets, query, globalSearchLimit)
+		found := 0
+		for _, result := range results {
+			found += len(result.keys)
+		}
+		app.QueueUpdateDraw(func() { showGlobalSearchResults(query, results) })
+		return fmt.Sprintf("Found %d keys in %d databases", found, len(results)), nil
+	})
+}
+
+// Results grouped under a header per database; Enter opens the key in its tab
+func showGlobalSearchResults(query string, results []searchResult) {
+	list := tview.NewList().SetWrapAround(false).ShowSecondaryText(false)
+	list.SetBorder(true).SetTitle(fmt.Sprintf(" Search %s in all databases (Enter: open, Esc: close) ", sanitizeForDisplay(query)))
+	list.SetTitleAlign(tview.AlignLeft)
+	list.SetTitleColor(tcell.ColorYellow)
+	list.SetBackgroundColor(tcell.ColorReset)
+	list.SetSelectedBackgroundColor(tcell.ColorWhite)
+	list.SetHighlightFullLine(true)
+
+	for i, result := range results {
+		header := fmt.Sprintf("[yellow::b]%s[-::-] ", sanitizeForDisplay(result.database))
+		switch {
+		case result.err != nil:
+			header += fmt.Sprintf("[red]error: %s[-]", tview.Escape(result.err.Error()))
+		case result.more:
+			header += fmt.Sprintf("[gray]first %d matches[-]", len(result.keys))
+		default:
+			header += fmt.Sprintf("[gray]%d matches[-]", len(result.keys))
+		}
+		list.AddItem(header, "", 0, nil)
+		for _, key := range result.keys {
+			tab, key := i, key
+			list.AddItem("  "+displayKey(key), "", 0, func() {
+				closeDialog("globalsearch")
+				openInTab(tab, query, key)
+			})
+		}
+	}
+	list.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyEsc {
+			closeDialog("globalsearch")
+			return nil
+		}
+		return event
+	})
+	showDialog("globalsearch", list, 100, 24)
+}
+
+// Switch to tab and select key there, among the keys matching query
+func openInTab(tab int, query string, key []byte) {
+	if tab >= len(tabs) {
+		return
+	}
+	if tab != activeTab {
+		switchTab(tab)
+		if tab != activeTab { // Refused, e.g. with staged changes
+			return
+		}
+	}
+	currentPrefix = query
+	searchBox.SetChangedFunc(nil) // seekToKey lists the matches from key on
+	searchBox.SetText(query)
+	searchBox.SetChangedFunc(onSearchChanged)
+	if err := seekToKey(key); err != nil {
+		setStatus(fmt.Sprintf("[red]Error: %v", err))
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Some databases emulate column families by starting every key with a
+// byte naming its family. Scoping the viewer to one such namespace lists,
+// searches, counts and exports only its keys, and iterators only visit
+// its key range.
+
+var namespace []byte // -namespace, or picked with %: key prefix the viewer is scoped to, nil for every key
+
+// A namespace found by sampling the database's first key bytes
+type namespaceInfo struct {
+	prefix []byte
+	sample []byte // First key of the namespace
+	size   int64  // Approximate bytes on disk
+}
+
+// Key range of the namespace, nil when the viewer is not scoped
+func namespaceRange() *util.Range {
+	if namespace == nil {
+		return nil
+	}
+	return util.BytesPrefix(namespace)
+}
+
+// Restricts iterators over the whole keyspace to the namespace
+type namespaceSource struct{ keySource }
+
+func (s namespaceSource) NewIterator(slice *util.Range, ro *opt.ReadOptions) iterator.Iterator {
+	if slice == nil {
+		slice = namespaceRange()
+	}
+	return s.keySource.NewIterator(slice, ro)
+}
+
+// Find the first key bytes in use by seeking to each of them
+func detectNamespaces() ([]namespaceInfo, error) {
+	iter := db.NewIterator(nil, scanReadOptions)
+	defer iter.Release()
+	var found []namespaceInfo
+	for b := 0; b < 256; b++ {
+		if !iter.Seek([]byte{byte(b)}) {
+			break
+		}
+		first := iter.Key()[0]
+		ns := namespaceInfo{prefix: []byte{first}, sample: append([]byte{}, iter.Key()...)}
+		if sizes, err := db.SizeOf([]util.Range{*util.BytesPrefix(ns.prefix)}); err == nil {
+			ns.size = sizes.Sum()
+		}
+		found = append(found, ns)
+		b = int(first) // Skip the bytes no key starts with
+	}
+	return found, iter.Error()
+}
+
+// Namespace as text when it is printable, else as hex
+func namespaceLabel(prefix []byte) string {
+	if isPrintableText(prefix) {
+		return displayKey(prefix)
+	}
+	return "0x" + hex.EncodeToString(prefix)
+}
+
+// Like newKeyFilter, but only keys of the namespace match
+func listFilter(search string) keyFilter {
+	filter := newKeyFilter(search)
+	if namespace == nil {
+		return filter
+	}
+	prefix := namespace
+	return func(key, value []byte) bool { return bytes.HasPrefix(key, prefix) && filter(key, value) }
+}
+
+// Scope the viewer to prefix, or to every key when it is nil
+func setNamespace(prefix []byte) {
+	namespace = prefix
+	currentPrefix = ""
+	searchBox.SetText("")
+	numericSort, numericIndex = "", nil // Built over the previous namespace
+	loadInitialKeys()
+	if prefix == nil {
+		setStatus("[green]Showing every key")
+		return
+	}
+	setStatus(fmt.Sprintf("[green]Scoped to namespace %s", namespaceLabel(prefix)))
+}
+
+// Sample the namespaces in the background, then let the user pick one
+func showNamespacePicker() {
+	enqueueTask("Detect namespaces", func(progress func(string)) (string, error) {
+		found, err := detectNamespaces()
+		if err != nil {
+			return "", err
+		}
+		app.QueueUpdateDraw(func() { showNamespaceList(found) })
+		return fmt.Sprintf("Found %d namespaces", len(found)), nil
+	})
+}
+
+func showNamespaceList(found []namespaceInfo) {
+	list := tview.NewList().SetWrapAround(false).ShowSecondaryText(false)
+	list.SetBorder(true).SetTitle(" Namespace (first key byte; Enter: scope, Esc: close) ")
+	list.SetTitleAlign(tview.AlignLeft)
+	list.SetTitleColor(tcell.ColorYellow)
+	list.SetBackgroundColor(tcell.ColorReset)
+	list.SetSelectedBackgroundColor(tcell.ColorWhite)
+	list.SetHighlightFullLine(true)
+
+	list.AddItem("All keys", "", 0, func() {
+		closeDialog("namespace")
+		setNamespace(nil)
+	})
+	for _, ns := range found {
+		ns := ns
+		label := fmt.Sprintf("%-6s [gray]~%d KB, first key %s[-]", namespaceLabel(ns.prefix), (ns.size+1023)/1024, displayKey(ns.sample))
+		list.AddItem(label, "", 0, func() {
+			closeDialog("namespace")
+			setNamespace(ns.prefix)
+		})
+		if bytes.Equal(ns.prefix, namespace) {
+			list.SetCurrentItem(list.GetItemCount() - 1)
+		}
+	}
+	list.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyEsc {
+			closeDialog("namespace")
+			return nil
+		}
+		return event
+	})
+	showDialog("namespace", list, 90, min(len(found)+3, 24))
+}
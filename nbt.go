@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Little-endian NBT, as Minecraft Bedrock stores entities, block entities
+// and players, shown in SNBT style: numbers carry their type's suffix
+// (1b, 2s, 3L, 1.5f, 2.0d) and arrays their element type ([I; 1, 2]).
+
+const nbtMaxDepth = 64
+
+var errNBTTruncated = errors.New("truncated NBT")
+
+type nbtReader struct{ buf []byte }
+
+func (r *nbtReader) take(n int) ([]byte, error) {
+	if n < 0 || n > len(r.buf) {
+		return nil, errNBTTruncated
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b, nil
+}
+
+func (r *nbtReader) int(size int) (int64, error) {
+	b, err := r.take(size)
+	if err != nil {
+		return 0, err
+	}
+	switch size {
+	case 1:
+		return int64(int8(b[0])), nil
+	case 2:
+		return int64(int16(binary.LittleEndian.Uint16(b))), nil
+	case 4:
+		return int64(int32(binary.LittleEndian.Uint32(b))), nil
+	}
+	return int64(binary.LittleEndian.Uint64(b)), nil
+}
+
+func (r *nbtReader) string() (string, error) {
+	b, err := r.take(2)
+	if err != nil {
+		return "", err
+	}
+	s, err := r.take(int(binary.LittleEndian.Uint16(b)))
+	return string(s), err
+}
+
+// A value is one or more named root compounds, as block entity records
+// hold one per block entity of the chunk
+func decodeNBTValue(value []byte) (string, bool) {
+	r := &nbtReader{value}
+	var out strings.Builder
+	for len(r.buf) > 0 {
+		if out.Len() > 0 {
+			out.WriteString("\n")
+		}
+		tag, err := r.take(1)
+		if err != nil || tag[0] != 10 {
+			return "", false
+		}
+		name, err := r.string()
+		if err != nil {
+			return "", false
+		}
+		if name != "" {
+			out.WriteString(quoteJSONString(name) + ": ")
+		}
+		if err := r.render(&out, 10, "", 0); err != nil {
+			return "", false
+		}
+	}
+	return out.String(), out.Len() > 0
+}
+
+func (r *nbtReader) render(out *strings.Builder, tag byte, indent string, depth int) error {
+	if depth > nbtMaxDepth {
+		return errors.New("NBT nesting too deep")
+	}
+	switch tag {
+	case 1, 2, 3, 4:
+		size := map[byte]int{1: 1, 2: 2, 3: 4, 4: 8}[tag]
+		v, err := r.int(size)
+		if err != nil {
+			return err
+		}
+		out.WriteString(strconv.FormatInt(v, 10) + map[byte]string{1: "b", 2: "s", 3: "", 4: "L"}[tag])
+	case 5:
+		v, err := r.int(4)
+		if err != nil {
+			return err
+		}
+		out.WriteString(strconv.FormatFloat(float64(math.Float32frombits(uint32(v))), 'g', -1, 32) + "f")
+	case 6:
+		v, err := r.int(8)
+		if err != nil {
+			return err
+		}
+		out.WriteString(strconv.FormatFloat(math.Float64frombits(uint64(v)), 'g', -1, 64) + "d")
+	case 8:
+		s, err := r.string()
+		if err != nil {
+			return err
+		}
+		out.WriteString(quoteJSONString(s))
+	case 7, 11, 12:
+		return r.renderArray(out, tag)
+	case 9:
+		return r.renderList(out, indent, depth)
+	case 10:
+		return r.renderCompound(out, indent, depth)
+	default:
+		return fmt.Errorf("unknown NBT tag %d", tag)
+	}
+	return nil
+}
+
+// Byte, int and long arrays fit on one line
+func (r *nbtReader) renderArray(out *strings.Builder, tag byte) error {
+	n, err := r.int(4)
+	if err != nil {
+		return err
+	}
+	size := map[byte]int{7: 1, 11: 4, 12: 8}[tag]
+	if n < 0 || n*int64(size) > int64(len(r.buf)) {
+		return errNBTTruncated
+	}
+	out.WriteString("[" + map[byte]string{7: "B", 11: "I", 12: "L"}[tag] + ";")
+	for i := int64(0); i < n; i++ {
+		v, _ := r.int(size)
+		if i > 0 {
+			out.WriteString(",")
+		}
+		out.WriteString(" " + strconv.FormatInt(v, 10))
+	}
+	out.WriteString("]")
+	return nil
+}
+
+func (r *nbtReader) renderList(out *strings.Builder, indent string, depth int) error {
+	tag, err := r.take(1)
+	if err != nil {
+		return err
+	}
+	n, err := r.int(4)
+	if err != nil {
+		return err
+	}
+	if n < 0 || n > int64(len(r.buf)) { // Elements take at least a byte each
+		return errNBTTruncated
+	}
+	if n == 0 {
+		out.WriteString("[]")
+		return nil
+	}
+	out.WriteString("[")
+	for i := int64(0); i < n; i++ {
+		if i > 0 {
+			out.WriteString(",")
+		}
+		out.WriteString("\n" + indent + "  ")
+		if err := r.render(out, tag[0], indent+"  ", depth+1); err != nil {
+			return err
+		}
+	}
+	out.WriteString("\n" + indent + "]")
+	return nil
+}
+
+// Named tags up to the end tag
+func (r *nbtReader) renderCompound(out *strings.Builder, indent string, depth int) error {
+	out.WriteString("{")
+	count := 0
+	for {
+		tag, err := r.take(1)
+		if err != nil {
+			return err
+		}
+		if tag[0] == 0 {
+			break
+		}
+		name, err := r.string()
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			out.WriteString(",")
+		}
+		out.WriteString("\n" + indent + "  " + quoteJSONString(name) + ": ")
+		if err := r.render(out, tag[0], indent+"  ", depth+1); err != nil {
+			return err
+		}
+		count++
+	}
+	if count > 0 {
+		out.WriteString("\n" + indent)
+	}
+	out.WriteString("}")
+	return nil
+}
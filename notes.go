@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// Free-text annotation on a key, shared through a sidecar file next to the database
+type keyNote struct {
+	Key     []byte    `json:"key"` // base64, so binary keys survive
+	Text    string    `json:"text"`
+	Author  string    `json:"author"`
+	Updated time.Time `json:"updated"`
+}
+
+var (
+	notesMu sync.Mutex
+	notes   = make(map[string]keyNote) // By key; read by searches off the UI goroutine
+)
+
+// Sidecar next to the database directory, so the database itself is never written to
+func notesPath() string {
+	if shardPattern != "" {
+		return filepath.Join(filepath.Dir(shardPattern), safeFileName(filepath.Base(shardPattern))+".notes.json")
+	}
+	return filepath.Clean(dbPath) + ".notes.json"
+}
+
+func readNotesFile() (map[string]keyNote, error) {
+	loaded := make(map[string]keyNote)
+	data, err := os.ReadFile(notesPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return loaded, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var list []keyNote
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", notesPath(), err)
+	}
+	for _, note := range list {
+		loaded[string(note.Key)] = note
+	}
+	return loaded, nil
+}
+
+// Load the notes for the open database
+func loadNotes() error {
+	loaded, err := readNotesFile()
+	if err != nil {
+		return err
+	}
+	notesMu.Lock()
+	notes = loaded
+	notesMu.Unlock()
+	return nil
+}
+
+// Set or, with empty text, remove the note on key. The file is re-read first
+// so notes written by other people in the meantime are kept.
+func setNote(key []byte, text string) error {
+	notesMu.Lock()
+	defer notesMu.Unlock()
+
+	current, err := readNotesFile()
+	if err != nil {
+		return err
+	}
+	if text == "" {
+		delete(current, string(key))
+	} else {
+		current[string(key)] = keyNote{Key: key, Text: text, Author: noteAuthor(), Updated: time.Now()}
+	}
+
+	list := make([]keyNote, 0, len(current))
+	for _, note := range current {
+		list = append(list, note)
+	}
+	sort.Slice(list, func(i, j int) bool { return string(list[i].Key) < string(list[j].Key) })
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Replace atomically so a concurrent reader never sees a partial file
+	tmp := notesPath() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, notesPath()); err != nil {
+		return err
+	}
+	notes = current
+	return nil
+}
+
+func noteFor(key []byte) (keyNote, bool) {
+	notesMu.Lock()
+	defer notesMu.Unlock()
+	note, ok := notes[string(key)]
+	return note, ok
+}
+
+// Case-insensitive match against the note on key, used by the search
+func noteMatches(key []byte, searchLower string) bool {
+	note, ok := noteFor(key)
+	return ok && strings.Contains(strings.ToLower(note.Text), searchLower)
+}
+
+func noteMatchesRegexp(key []byte, re *regexp.Regexp) bool {
+	note, ok := noteFor(key)
+	return ok && re.MatchString(note.Text)
+}
+
+func noteAuthor() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+// Note lines for the value header
+func noteHeader(key []byte) string {
+	note, ok := noteFor(key)
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("\n[yellow]Note[-] (%s, %s): %s", tview.Escape(note.Author),
+		note.Updated.Format("2006-01-02 15:04"), sanitizeForDisplay(note.Text))
+}
+
+// Edit the note on the selected key; clearing the text removes it
+func showNoteDialog() {
+	currentIndex := keyList.GetCurrentItem()
+	if currentIndex < 0 || currentIndex >= len(displayedKeys) {
+		setStatus("[red]Invalid selection")
+		return
+	}
+	key := displayedKeys[currentIndex]
+
+	input := newDialogInput(" Note: ")
+	if note, ok := noteFor(key); ok {
+		input.SetText(note.Text)
+	}
+	input.SetBorder(true).SetTitle(fmt.Sprintf(" Note on %s (empty removes) ", displayKey(key)))
+	input.SetTitleAlign(tview.AlignLeft)
+	input.SetTitleColor(tcell.ColorYellow)
+
+	input.SetDoneFunc(func(k tcell.Key) {
+		if k == tcell.KeyEsc {
+			closeDialog("note")
+			return
+		}
+		if k != tcell.KeyEnter {
+			return
+		}
+		if err := setNote(key, strings.TrimSpace(input.GetText())); err != nil {
+			setStatus(fmt.Sprintf("[red]Error saving note: %v", err))
+			return
+		}
+		closeDialog("note")
+		refreshListItem(currentIndex)
+		showKeyValue(key)
+		setStatus("[green]Note saved")
+	})
+
+	showDialog("note", input, 80, 3)
+}
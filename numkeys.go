@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/memdb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Integer keys stored little-endian sort in byte order by their lowest byte
+// first, so 256 lists before 1. Keys can be shown as numbers (key renderings
+// uint-le and uint-be) and listed in numeric order from a temporary index.
+
+// Unsigned integer a key holds: the whole key when it is 1, 2, 4 or 8 binary
+// bytes, or the 8 or 4 binary bytes after a printable prefix
+func keyNumber(key []byte, bigEndian bool) (prefix []byte, n uint64, ok bool) {
+	var field []byte
+	for _, size := range []int{8, 4} {
+		if len(key) > size && !isPrintableText(key[len(key)-size:]) && isPrintableText(key[:len(key)-size]) {
+			prefix, field = key[:len(key)-size], key[len(key)-size:]
+			break
+		}
+	}
+	if field == nil {
+		if isPrintableText(key) {
+			return nil, 0, false
+		}
+		switch len(key) {
+		case 1, 2, 4, 8:
+			field = key
+		default:
+			return nil, 0, false
+		}
+	}
+	for i := range field {
+		b := field[i]
+		if !bigEndian {
+			b = field[len(field)-1-i]
+		}
+		n = n<<8 | uint64(b)
+	}
+	return prefix, n, true
+}
+
+// Key as its prefix followed by #number, or as raw text when it holds no number
+func formatNumericKey(key []byte, bigEndian bool) string {
+	prefix, n, ok := keyNumber(key, bigEndian)
+	if !ok {
+		return sanitizeForDisplay(string(key))
+	}
+	return sanitizeForDisplay(string(prefix)) + "#" + strconv.FormatUint(n, 10)
+}
+
+// Orders keys by prefix, then numerically; keys without a number follow the
+// numbered keys sharing their bytes as prefix, in byte order
+type numericComparer struct{ bigEndian bool }
+
+func (c numericComparer) Compare(a, b []byte) int {
+	prefixA, na, okA := keyNumber(a, c.bigEndian)
+	prefixB, nb, okB := keyNumber(b, c.bigEndian)
+	if !okA {
+		prefixA = a
+	}
+	if !okB {
+		prefixB = b
+	}
+	if cmp := bytes.Compare(prefixA, prefixB); cmp != 0 {
+		return cmp
+	}
+	switch {
+	case okA != okB:
+		if okA {
+			return -1
+		}
+		return 1
+	case na < nb:
+		return -1
+	case na > nb:
+		return 1
+	}
+	return bytes.Compare(a, b)
+}
+
+var (
+	numericSort  = ""      // "", or the byte order "le" or "be" the key list is sorted by
+	numericIndex *memdb.DB // Keys in numeric order, built when numeric sorting is turned on
+)
+
+// Where the key list pages for search come from: the database, narrowed to
+// the range the search can match in, or the numeric index
+func listSource(search string) keySource {
+	if numericIndex != nil {
+		return indexSource{numericIndex} // Numeric order; a key range does not apply
+	}
+	if rng := searchRange(search); rng != nil {
+		return rangeSource{browseReader(), intersectRanges(namespaceRange(), rng)}
+	}
+	if namespace != nil {
+		return namespaceSource{browseReader()}
+	}
+	return browseReader()
+}
+
+// Lists the keys of the numeric index with their current values from the
+// database; keys deleted since the index was built are skipped
+type indexSource struct{ index *memdb.DB }
+
+func (s indexSource) NewIterator(slice *util.Range, ro *opt.ReadOptions) iterator.Iterator {
+	return &indexIterator{Iterator: s.index.NewIterator(slice), ro: ro}
+}
+
+type indexIterator struct {
+	iterator.Iterator
+	ro    *opt.ReadOptions
+	value []byte
+	err   error
+}
+
+// Load the value of the current key, moving on with step while it is gone
+func (i *indexIterator) settle(ok bool, step func() bool) bool {
+	for ; ok; ok = step() {
+		value, err := browseReader().Get(i.Iterator.Key(), i.ro)
+		if errors.Is(err, leveldb.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			i.err = err
+			return false
+		}
+		i.value = value
+		return true
+	}
+	return false
+}
+
+func (i *indexIterator) First() bool          { return i.settle(i.Iterator.First(), i.Iterator.Next) }
+func (i *indexIterator) Last() bool           { return i.settle(i.Iterator.Last(), i.Iterator.Prev) }
+func (i *indexIterator) Seek(key []byte) bool { return i.settle(i.Iterator.Seek(key), i.Iterator.Next) }
+func (i *indexIterator) Next() bool           { return i.settle(i.Iterator.Next(), i.Iterator.Next) }
+func (i *indexIterator) Prev() bool           { return i.settle(i.Iterator.Prev(), i.Iterator.Prev) }
+func (i *indexIterator) Value() []byte        { return i.value }
+
+func (i *indexIterator) Error() error {
+	if i.err != nil {
+		return i.err
+	}
+	return i.Iterator.Error()
+}
+
+// Cycle the key list between byte order and numeric order of little-endian
+// and big-endian keys. The index is built in the background from the keys
+// present at that moment.
+func cycleNumericSort() {
+	next := map[string]string{"": "le", "le": "be", "be": ""}[numericSort]
+	if next == "" {
+		numericSort, numericIndex = "", nil
+		loadInitialKeys()
+		setStatus("[green]Keys listed in byte order")
+		return
+	}
+	bigEndian := next == "be"
+	enqueueTask(fmt.Sprintf("Sort keys numerically (%s)", next), func(progress func(string)) (string, error) {
+		index, err := buildNumericIndex(bigEndian, progress)
+		if err != nil {
+			return "", err
+		}
+		app.QueueUpdateDraw(func() {
+			numericSort, numericIndex = next, index
+			loadInitialKeys()
+		})
+		return fmt.Sprintf("Listing %d keys in numeric order (%s)", index.Len(), next), nil
+	})
+}
+
+func buildNumericIndex(bigEndian bool, progress func(string)) (*memdb.DB, error) {
+	index := memdb.New(numericComparer{bigEndian}, 0)
+	iter := browseReader().NewIterator(namespaceRange(), scanReadOptions)
+	defer iter.Release()
+	for iter.Next() {
+		scanRate.wait(iter.Key(), iter.Value())
+		index.Put(iter.Key(), nil)
+		if index.Len()%100000 == 0 {
+			progress(fmt.Sprintf("%d keys indexed", index.Len()))
+		}
+	}
+	return index, iter.Error()
+}
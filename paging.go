@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Where paged keys come from. *leveldb.DB satisfies it; tests can inject a fake.
+type keySource interface {
+	NewIterator(slice *util.Range, ro *opt.ReadOptions) iterator.Iterator
+}
+
+// Decides whether a key is listed, given its value for queries
+type keyFilter func(key, value []byte) bool
+
+// Case-insensitive substring search in keys and their notes; an empty search matches everything.
+// Hex (0x...) and base64 (b64:...) searches match the raw bytes of keys exactly.
+// A UUID or ULID matches keys holding it in any of its forms. re:<expression>
+// matches a regular expression against the key bytes and notes; an invalid one matches nothing.
+// ^<key> matches the keys starting with the key, typed as in the seek dialog.
+// A query (see query.go) matches the keys and values it describes.
+func newKeyFilter(search string) keyFilter {
+	if isQuery(search) {
+		return queryKeyFilter(search)
+	}
+	if search == "" {
+		return func(key, _ []byte) bool { return true }
+	}
+	if text, ok := strings.CutPrefix(search, "^"); ok {
+		prefix, _, err := parsePartialKeyInput(text)
+		if err != nil {
+			return func(key, _ []byte) bool { return false }
+		}
+		return func(key, _ []byte) bool { return bytes.HasPrefix(key, prefix) }
+	}
+	if re, ok, err := searchRegexp(search); ok {
+		if err != nil {
+			return func(key, _ []byte) bool { return false }
+		}
+		if searchRange(search) != nil {
+			return func(key, _ []byte) bool { return re.Match(key) } // Anchored: scans only read the keys under its prefix
+		}
+		return func(key, _ []byte) bool { return re.Match(key) || noteMatchesRegexp(key, re) }
+	}
+	if filter, ok := idKeyFilter(search); ok {
+		return filter
+	}
+	raw, isRaw, err := parsePartialKeyInput(search)
+	if isRaw {
+		if err != nil {
+			return func(key, _ []byte) bool { return false }
+		}
+		return func(key, _ []byte) bool { return bytes.Contains(key, raw) }
+	}
+	search = string(raw)
+	searchLower := strings.ToLower(search)
+	return func(key, _ []byte) bool {
+		return strings.Contains(strings.ToLower(string(key)), searchLower) || noteMatches(key, searchLower)
+	}
+}
+
+// The compiled expression of a re: search; ok is false for other searches
+func searchRegexp(search string) (re *regexp.Regexp, ok bool, err error) {
+	pattern, ok := strings.CutPrefix(search, "re:")
+	if !ok {
+		return nil, false, nil
+	}
+	if re, err = regexp.Compile(pattern); err != nil {
+		return nil, true, fmt.Errorf("search %s: %w", search, err)
+	}
+	return re, true, nil
+}
+
+// Why search cannot match anything, for reporting before a scan; nil when it can
+func checkSearch(search string) error {
+	if isQuery(search) {
+		_, err := parseQuery(search)
+		return err
+	}
+	if text, ok := strings.CutPrefix(search, "^"); ok {
+		_, _, err := parsePartialKeyInput(text)
+		return err
+	}
+	_, _, err := searchRegexp(search)
+	return err
+}
+
+// The key range every match of search lies in, so scans seek to it instead
+// of reading every key: the keys under the prefix of a ^ search, or of the
+// literal text a re: expression starts with after ^, or of a query's key
+// comparisons. nil for other searches.
+func searchRange(search string) *util.Range {
+	if isQuery(search) {
+		if q, err := parseQuery(search); err == nil {
+			return q.keyRange()
+		}
+		return nil
+	}
+	if text, ok := strings.CutPrefix(search, "^"); ok {
+		if prefix, _, err := parsePartialKeyInput(text); err == nil && len(prefix) > 0 {
+			return util.BytesPrefix(prefix)
+		}
+		return nil
+	}
+	pattern, ok := strings.CutPrefix(search, "re:")
+	if !ok {
+		return nil
+	}
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil || re.Op != syntax.OpConcat || len(re.Sub) < 2 {
+		return nil
+	}
+	begin, literal := re.Sub[0], re.Sub[1]
+	if begin.Op != syntax.OpBeginText || literal.Op != syntax.OpLiteral || literal.Flags&syntax.FoldCase != 0 {
+		return nil // Not anchored at the start, or case-insensitive
+	}
+	return util.BytesPrefix([]byte(string(literal.Rune)))
+}
+
+// Where a and b overlap; nil stands for every key
+func intersectRanges(a, b *util.Range) *util.Range {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	r := &util.Range{Start: a.Start, Limit: a.Limit}
+	if bytes.Compare(b.Start, r.Start) > 0 {
+		r.Start = b.Start
+	}
+	if r.Limit == nil || b.Limit != nil && bytes.Compare(b.Limit, r.Limit) < 0 {
+		r.Limit = b.Limit
+	}
+	return r
+}
+
+// Limits the iterators of a source to a key range
+type rangeSource struct {
+	keySource
+	rng *util.Range
+}
+
+func (s rangeSource) NewIterator(slice *util.Range, ro *opt.ReadOptions) iterator.Iterator {
+	return s.keySource.NewIterator(intersectRanges(slice, s.rng), ro)
+}
+
+// Collect up to limit keys accepted by filter, starting after the given key
+// (or at the beginning when after is nil). Soft-deleted keys are skipped
+// unless they are being shown. more reports whether the
+// iterator has keys left, not whether any of them match.
+func scanPage(src keySource, filter keyFilter, after []byte, limit int) (keys [][]byte, more bool, err error) {
+	iter := src.NewIterator(nil, nil)
+	defer iter.Release()
+
+	ok := iter.First()
+	if after != nil {
+		ok = iter.Seek(after)
+		if ok && bytes.Equal(iter.Key(), after) {
+			ok = iter.Next()
+		}
+	}
+
+	keys = [][]byte{}
+	for ; ok && len(keys) < limit; ok = iter.Next() {
+		scanRate.wait(iter.Key(), iter.Value())
+		if key := iter.Key(); filter(key, iter.Value()) && noteSoftDeleted(key, iter.Value()) {
+			keys = append(keys, append([]byte{}, key...))
+		}
+	}
+	return keys, ok, iter.Error()
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/syndtr/goleveldb/leveldb/comparer"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/memdb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// An in-memory keySource that counts the iterators it hands out and releases
+type fakeSource struct {
+	mem      *memdb.DB
+	open     int
+	released int
+}
+
+func newFakeSource(t *testing.T, pairs ...string) *fakeSource {
+	t.Helper()
+	if len(pairs)%2 != 0 {
+		t.Fatal("newFakeSource wants key, value pairs")
+	}
+	src := &fakeSource{mem: memdb.New(comparer.DefaultComparer, 0)}
+	for i := 0; i < len(pairs); i += 2 {
+		if err := src.mem.Put([]byte(pairs[i]), []byte(pairs[i+1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return src
+}
+
+func (s *fakeSource) NewIterator(slice *util.Range, _ *opt.ReadOptions) iterator.Iterator {
+	s.open++
+	iter := s.mem.NewIterator(slice)
+	iter.SetReleaser(countRelease{&s.released})
+	return iter
+}
+
+type countRelease struct{ n *int }
+
+func (r countRelease) Release() { *r.n++ }
+
+func keyStrings(keys [][]byte) []string {
+	out := make([]string, len(keys))
+	for i, key := range keys {
+		out[i] = string(key)
+	}
+	return out
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+var pagingPairs = []string{
+	"a", "1",
+	"b", "",
+	"c", "3",
+	"user:1", `{"status":"active"}`,
+	"user:2", `{"status":"gone"}`,
+	"user:3", `{"status":"active"}`,
+	"\x00\xff", "\xfe",
+}
+
+func TestScanPage(t *testing.T) {
+	tests := []struct {
+		name     string
+		pairs    []string
+		search   string
+		after    string
+		hasAfter bool
+		limit    int
+		want     []string
+		wantMore bool
+	}{
+		{name: "empty source", limit: 10, want: []string{}},
+		{name: "all", pairs: pagingPairs, limit: 10, want: []string{"\x00\xff", "a", "b", "c", "user:1", "user:2", "user:3"}},
+		{name: "first page", pairs: pagingPairs, limit: 3, want: []string{"\x00\xff", "a", "b"}, wantMore: true},
+		{name: "exact fit", pairs: pagingPairs, limit: 7, want: []string{"\x00\xff", "a", "b", "c", "user:1", "user:2", "user:3"}},
+		{name: "after present key", pairs: pagingPairs, after: "b", hasAfter: true, limit: 2, want: []string{"c", "user:1"}, wantMore: true},
+		{name: "after absent key", pairs: pagingPairs, after: "bb", hasAfter: true, limit: 10, want: []string{"c", "user:1", "user:2", "user:3"}},
+		{name: "after last key", pairs: pagingPairs, after: "user:3", hasAfter: true, limit: 10, want: []string{}},
+		{name: "after past end", pairs: pagingPairs, after: "zzz", hasAfter: true, limit: 10, want: []string{}},
+		{name: "empty after key", pairs: pagingPairs, after: "", hasAfter: true, limit: 2, want: []string{"\x00\xff", "a"}, wantMore: true},
+		{name: "substring", pairs: pagingPairs, search: "USER", limit: 10, want: []string{"user:1", "user:2", "user:3"}},
+		{name: "prefix", pairs: pagingPairs, search: "^user:", limit: 2, want: []string{"user:1", "user:2"}, wantMore: true},
+		{name: "regexp", pairs: pagingPairs, search: "re:^user:[13]$", limit: 10, want: []string{"user:1", "user:3"}},
+		{name: "invalid regexp", pairs: pagingPairs, search: "re:(", limit: 10, want: []string{}},
+		{name: "hex", pairs: pagingPairs, search: "0x00ff", limit: 10, want: []string{"\x00\xff"}},
+		{name: "query on value", pairs: pagingPairs, search: `value.json.status == active`, limit: 10, want: []string{"user:1", "user:3"}},
+		{name: "query on empty value", pairs: pagingPairs, search: `size == 0`, limit: 10, want: []string{"b"}},
+		{name: "filtered page", pairs: pagingPairs, search: "^user:", after: "user:1", hasAfter: true, limit: 1, want: []string{"user:2"}, wantMore: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := newFakeSource(t, tt.pairs...)
+			var after []byte
+			if tt.hasAfter {
+				after = []byte(tt.after)
+			}
+			keys, more, err := scanPage(src, newKeyFilter(tt.search), after, tt.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := keyStrings(keys); !equalStrings(got, tt.want) {
+				t.Errorf("keys = %q, want %q", got, tt.want)
+			}
+			if more != tt.wantMore {
+				t.Errorf("more = %v, want %v", more, tt.wantMore)
+			}
+			if src.open != 1 || src.released != 1 {
+				t.Errorf("opened %d iterators and released %d, want 1 and 1", src.open, src.released)
+			}
+		})
+	}
+}
+
+// Pages fetched one after another list every key once
+func TestScanPageWalk(t *testing.T) {
+	src := newFakeSource(t, pagingPairs...)
+	var all []string
+	var after []byte
+	for page := 0; ; page++ {
+		if page > len(pagingPairs) {
+			t.Fatal("paging does not end")
+		}
+		keys, more, err := scanPage(src, newKeyFilter(""), after, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		all = append(all, keyStrings(keys)...)
+		if !more {
+			break
+		}
+		after = keys[len(keys)-1]
+	}
+	want := []string{"\x00\xff", "a", "b", "c", "user:1", "user:2", "user:3"}
+	if !equalStrings(all, want) {
+		t.Errorf("walked %q, want %q", all, want)
+	}
+}
+
+// Returned keys do not alias the iterator's buffers
+func TestScanPageCopiesKeys(t *testing.T) {
+	src := newFakeSource(t, "k1", "", "k2", "")
+	keys, _, err := scanPage(src, newKeyFilter(""), nil, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys[0][0] = 'x'
+	again, _, err := scanPage(src, newKeyFilter(""), nil, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(again[0], []byte("k1")) {
+		t.Errorf("first key is %q after changing a returned key, want \"k1\"", again[0])
+	}
+}
@@ -0,0 +1,627 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	protoDescPath string     // Compiled FileDescriptorSet from -proto-desc
+	protoTypes    stringList // -proto-type values: pkg.Message, or prefix=pkg.Message
+	protoMappings []protoMapping
+)
+
+// Values of keys starting with prefix are decoded as message; longest prefix wins
+type protoMapping struct {
+	prefix  []byte
+	message *protoMessage
+}
+
+// Field types from descriptor.proto's FieldDescriptorProto.Type
+const (
+	protoTypeDouble   = 1
+	protoTypeFloat    = 2
+	protoTypeInt64    = 3
+	protoTypeUint64   = 4
+	protoTypeInt32    = 5
+	protoTypeFixed64  = 6
+	protoTypeFixed32  = 7
+	protoTypeBool     = 8
+	protoTypeString   = 9
+	protoTypeGroup    = 10
+	protoTypeMessage  = 11
+	protoTypeBytes    = 12
+	protoTypeUint32   = 13
+	protoTypeEnum     = 14
+	protoTypeSfixed32 = 15
+	protoTypeSfixed64 = 16
+	protoTypeSint32   = 17
+	protoTypeSint64   = 18
+)
+
+// Wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireStart   = 3
+	wireEnd     = 4
+	wireFixed32 = 5
+)
+
+type protoField struct {
+	name     string
+	number   int
+	kind     int
+	typeName string // Fully-qualified message or enum name, without the leading dot
+}
+
+type protoMessage struct {
+	name   string
+	fields map[int]*protoField
+}
+
+type protoEnum struct {
+	name   string
+	values map[int32]string
+}
+
+// Message and enum types of a FileDescriptorSet, by fully-qualified name
+type protoRegistry struct {
+	messages map[string]*protoMessage
+	enums    map[string]*protoEnum
+}
+
+var protoTypeRegistry *protoRegistry
+
+// Reader over protobuf wire format
+type protoReader struct {
+	buf []byte
+	pos int
+}
+
+var errProtoTruncated = errors.New("truncated protobuf data")
+
+func (r *protoReader) done() bool { return r.pos >= len(r.buf) }
+
+func (r *protoReader) varint() (uint64, error) {
+	v, n := binary.Uvarint(r.buf[r.pos:])
+	if n <= 0 {
+		return 0, errProtoTruncated
+	}
+	r.pos += n
+	return v, nil
+}
+
+// Field number and wire type of the next field
+func (r *protoReader) tag() (int, int, error) {
+	v, err := r.varint()
+	if err != nil {
+		return 0, 0, err
+	}
+	if v>>3 == 0 || v>>3 > math.MaxInt32 {
+		return 0, 0, fmt.Errorf("invalid field number %d", v>>3)
+	}
+	return int(v >> 3), int(v & 7), nil
+}
+
+func (r *protoReader) fixed(size int) (uint64, error) {
+	if len(r.buf)-r.pos < size {
+		return 0, errProtoTruncated
+	}
+	var v uint64
+	if size == 8 {
+		v = binary.LittleEndian.Uint64(r.buf[r.pos:])
+	} else {
+		v = uint64(binary.LittleEndian.Uint32(r.buf[r.pos:]))
+	}
+	r.pos += size
+	return v, nil
+}
+
+func (r *protoReader) bytes() ([]byte, error) {
+	n, err := r.varint()
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(len(r.buf)-r.pos) {
+		return nil, errProtoTruncated
+	}
+	b := r.buf[r.pos : r.pos+int(n)]
+	r.pos += int(n)
+	return b, nil
+}
+
+// Skip a field's value; groups are skipped up to their end tag
+func (r *protoReader) skip(wire int) error {
+	var err error
+	switch wire {
+	case wireVarint:
+		_, err = r.varint()
+	case wireFixed64:
+		_, err = r.fixed(8)
+	case wireBytes:
+		_, err = r.bytes()
+	case wireFixed32:
+		_, err = r.fixed(4)
+	case wireStart:
+		for {
+			_, inner, err := r.tag()
+			if err != nil {
+				return err
+			}
+			if inner == wireEnd {
+				return nil
+			}
+			if err := r.skip(inner); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("invalid wire type %d", wire)
+	}
+	return err
+}
+
+// Read a compiled descriptor set, as written by protoc --descriptor_set_out
+func loadProtoRegistry(path string) (*protoRegistry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	reg := &protoRegistry{messages: make(map[string]*protoMessage), enums: make(map[string]*protoEnum)}
+	r := &protoReader{buf: data}
+	for !r.done() {
+		num, wire, err := r.tag()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if num != 1 || wire != wireBytes { // FileDescriptorSet.file
+			if err := r.skip(wire); err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			continue
+		}
+		file, err := r.bytes()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if err := reg.addFile(file); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	if len(reg.messages) == 0 {
+		return nil, fmt.Errorf("%s: no message types; is it a FileDescriptorSet?", path)
+	}
+	return reg, nil
+}
+
+// Call fn with the number and contents of every length-delimited field of msg
+func eachProtoBytes(msg []byte, fn func(num int, data []byte) error) error {
+	r := &protoReader{buf: msg}
+	for !r.done() {
+		num, wire, err := r.tag()
+		if err != nil {
+			return err
+		}
+		if wire != wireBytes {
+			if err := r.skip(wire); err != nil {
+				return err
+			}
+			continue
+		}
+		data, err := r.bytes()
+		if err != nil {
+			return err
+		}
+		if err := fn(num, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Varint fields of msg by number; the last occurrence wins
+func protoVarints(msg []byte) (map[int]uint64, error) {
+	values := make(map[int]uint64)
+	r := &protoReader{buf: msg}
+	for !r.done() {
+		num, wire, err := r.tag()
+		if err != nil {
+			return nil, err
+		}
+		if wire != wireVarint {
+			if err := r.skip(wire); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if values[num], err = r.varint(); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// FileDescriptorProto: package (2), message_type (4), enum_type (5)
+func (reg *protoRegistry) addFile(file []byte) error {
+	var pkg string
+	eachProtoBytes(file, func(num int, data []byte) error {
+		if num == 2 {
+			pkg = string(data)
+		}
+		return nil
+	})
+	return eachProtoBytes(file, func(num int, data []byte) error {
+		switch num {
+		case 4:
+			return reg.addMessage(pkg, data)
+		case 5:
+			return reg.addEnum(pkg, data)
+		}
+		return nil
+	})
+}
+
+func qualifiedName(scope, name string) string {
+	if scope == "" {
+		return name
+	}
+	return scope + "." + name
+}
+
+// DescriptorProto: name (1), field (2), nested_type (3), enum_type (4)
+func (reg *protoRegistry) addMessage(scope string, desc []byte) error {
+	msg := &protoMessage{fields: make(map[int]*protoField)}
+	eachProtoBytes(desc, func(num int, data []byte) error {
+		if num == 1 {
+			msg.name = qualifiedName(scope, string(data))
+		}
+		return nil
+	})
+	reg.messages[msg.name] = msg
+	return eachProtoBytes(desc, func(num int, data []byte) error {
+		switch num {
+		case 2:
+			field, err := parseProtoField(data)
+			if err != nil {
+				return fmt.Errorf("%s: %w", msg.name, err)
+			}
+			msg.fields[field.number] = field
+		case 3:
+			return reg.addMessage(msg.name, data)
+		case 4:
+			return reg.addEnum(msg.name, data)
+		}
+		return nil
+	})
+}
+
+// FieldDescriptorProto: name (1), number (3), type (5), type_name (6)
+func parseProtoField(desc []byte) (*protoField, error) {
+	field := &protoField{}
+	eachProtoBytes(desc, func(num int, data []byte) error {
+		switch num {
+		case 1:
+			field.name = string(data)
+		case 6:
+			field.typeName = strings.TrimPrefix(string(data), ".")
+		}
+		return nil
+	})
+	varints, err := protoVarints(desc)
+	if err != nil {
+		return nil, err
+	}
+	field.number, field.kind = int(varints[3]), int(varints[5])
+	return field, nil
+}
+
+// EnumDescriptorProto: name (1), value (2) holding EnumValueDescriptorProto name (1) and number (2)
+func (reg *protoRegistry) addEnum(scope string, desc []byte) error {
+	enum := &protoEnum{values: make(map[int32]string)}
+	err := eachProtoBytes(desc, func(num int, data []byte) error {
+		switch num {
+		case 1:
+			enum.name = qualifiedName(scope, string(data))
+		case 2:
+			var name string
+			eachProtoBytes(data, func(num int, data []byte) error {
+				if num == 1 {
+					name = string(data)
+				}
+				return nil
+			})
+			varints, err := protoVarints(data)
+			if err != nil {
+				return err
+			}
+			enum.values[int32(varints[2])] = name
+		}
+		return nil
+	})
+	reg.enums[enum.name] = enum
+	return err
+}
+
+// The "protobuf" section of the config file
+type protobufConfig struct {
+	DescriptorSet string             `json:"descriptor_set"` // Like -proto-desc; relative to the config file
+	Types         []protoTypeMapping `json:"types"`          // Like -proto-type
+}
+
+type protoTypeMapping struct {
+	Prefix  string `json:"prefix"` // Key prefix (0x hex and b64: allowed); empty maps every key
+	Message string `json:"message"`
+}
+
+// Load the descriptor set and resolve every message mapping against it.
+// -proto-desc replaces the config file's descriptor set, and -proto-type
+// mappings come before the config file's, winning for the same prefix.
+func setupProtoTypes() error {
+	mappings := make([]protoTypeMapping, 0, len(protoTypes)+len(cfg.Protobuf.Types))
+	for _, spec := range protoTypes {
+		prefix, name := "", spec
+		if i := strings.LastIndex(spec, "="); i >= 0 {
+			prefix, name = spec[:i], spec[i+1:]
+		}
+		mappings = append(mappings, protoTypeMapping{Prefix: prefix, Message: name})
+	}
+	mappings = append(mappings, cfg.Protobuf.Types...)
+
+	path := protoDescPath
+	if path == "" {
+		path = cfg.Protobuf.DescriptorSet
+	}
+	if path == "" {
+		if len(mappings) > 0 {
+			return errors.New("protobuf message types need a descriptor set (-proto-desc or protobuf.descriptor_set in the config file)")
+		}
+		return nil
+	}
+	if len(mappings) == 0 && !decoderMappingsUse("protobuf") {
+		return errors.New("a protobuf descriptor set needs at least one message type (-proto-type, protobuf.types or a protobuf: decoder mapping in the config file)")
+	}
+	reg, err := loadProtoRegistry(path)
+	if err != nil {
+		return err
+	}
+	protoTypeRegistry = reg
+	for _, m := range mappings {
+		prefix, _, err := parseKeyInput(m.Prefix)
+		if err != nil {
+			return fmt.Errorf("protobuf type %s: %w", m.Message, err)
+		}
+		msg, ok := reg.messages[strings.TrimPrefix(m.Message, ".")]
+		if !ok {
+			return fmt.Errorf("message type %q is not in %s", m.Message, path)
+		}
+		protoMappings = append(protoMappings, protoMapping{prefix: prefix, message: msg})
+	}
+	sort.SliceStable(protoMappings, func(i, j int) bool {
+		return len(protoMappings[i].prefix) > len(protoMappings[j].prefix)
+	})
+	return nil
+}
+
+const protoTypeCacheSize = 4096
+
+var (
+	protoTypeCache   = make(map[string]*protoMessage) // Resolved message type (or nil) by key
+	protoTypeCacheMu sync.Mutex
+)
+
+// Message type mapped to key, or nil. Recently looked-up keys are cached,
+// since every render of a value asks again.
+func protoTypeFor(key []byte) *protoMessage {
+	if len(protoMappings) == 0 {
+		return nil
+	}
+	protoTypeCacheMu.Lock()
+	defer protoTypeCacheMu.Unlock()
+	if msg, ok := protoTypeCache[string(key)]; ok {
+		return msg
+	}
+	var msg *protoMessage
+	for _, m := range protoMappings {
+		if bytes.HasPrefix(key, m.prefix) {
+			msg = m.message
+			break
+		}
+	}
+	if len(protoTypeCache) >= protoTypeCacheSize {
+		clear(protoTypeCache)
+	}
+	protoTypeCache[string(key)] = msg
+	return msg
+}
+
+// Text-format rendering of value if key is mapped to a message type; values
+// that do not decode as their type, and binary values of unmapped keys, are
+// tried as raw wire format
+func decodeProtoValue(key, value []byte) (string, bool) {
+	msg := protoTypeFor(key)
+	if msg == nil {
+		return decodeRawProto(value)
+	}
+	return decodeProtoAs(msg, value)
+}
+
+// Text-format rendering of value as msg, or as raw wire format under a
+// "# Not a valid" line when it does not decode as msg
+func decodeProtoAs(msg *protoMessage, value []byte) (string, bool) {
+	var out strings.Builder
+	if err := protoTypeRegistry.render(&out, msg, value, 0); err != nil {
+		raw, ok := decodeRawProto(value)
+		if !ok {
+			return "", false
+		}
+		return fmt.Sprintf("# Not a valid %s (%v); raw wire format:\n%s", msg.name, err, raw), true
+	}
+	return strings.TrimSuffix(out.String(), "\n"), true
+}
+
+const protoMaxDepth = 64
+
+// Write data decoded as msg in protobuf text format, one field per line
+func (reg *protoRegistry) render(out *strings.Builder, msg *protoMessage, data []byte, depth int) error {
+	if depth > protoMaxDepth {
+		return errors.New("message nesting too deep")
+	}
+	indent := strings.Repeat("  ", depth)
+	r := &protoReader{buf: data}
+	for !r.done() {
+		num, wire, err := r.tag()
+		if err != nil {
+			return err
+		}
+		field := msg.fields[num]
+		if field == nil {
+			if err := renderRawField(out, r, num, wire, depth); err != nil { // Shown by number, as protoc does
+				return err
+			}
+			continue
+		}
+
+		if wire == wireBytes {
+			data, err := r.bytes()
+			if err != nil {
+				return err
+			}
+			switch field.kind {
+			case protoTypeString:
+				fmt.Fprintf(out, "%s%s: %s\n", indent, field.name, strconv.Quote(string(data)))
+			case protoTypeBytes:
+				fmt.Fprintf(out, "%s%s: %s\n", indent, field.name, quoteProtoBytes(data))
+			case protoTypeMessage:
+				nested := reg.messages[field.typeName]
+				if nested == nil {
+					return fmt.Errorf("message type %s is not in the descriptor set", field.typeName)
+				}
+				fmt.Fprintf(out, "%s%s {\n", indent, field.name)
+				if err := reg.render(out, nested, data, depth+1); err != nil {
+					return err
+				}
+				fmt.Fprintf(out, "%s}\n", indent)
+			default: // Packed repeated scalars
+				packed := &protoReader{buf: data}
+				for !packed.done() {
+					text, err := reg.scalar(field, packed, packedWireType(field.kind))
+					if err != nil {
+						return err
+					}
+					fmt.Fprintf(out, "%s%s: %s\n", indent, field.name, text)
+				}
+			}
+			continue
+		}
+
+		if wire == wireStart || wire == wireEnd {
+			return fmt.Errorf("field %s uses groups, which are not supported", field.name)
+		}
+		text, err := reg.scalar(field, r, wire)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%s%s: %s\n", indent, field.name, text)
+	}
+	return nil
+}
+
+// Wire type of each element of a packed field of the given type
+func packedWireType(kind int) int {
+	switch kind {
+	case protoTypeDouble, protoTypeFixed64, protoTypeSfixed64:
+		return wireFixed64
+	case protoTypeFloat, protoTypeFixed32, protoTypeSfixed32:
+		return wireFixed32
+	}
+	return wireVarint
+}
+
+// Read one scalar of field's type, failing if the wire type does not match it
+func (reg *protoRegistry) scalar(field *protoField, r *protoReader, wire int) (string, error) {
+	if want := packedWireType(field.kind); wire != want || field.kind == protoTypeString || field.kind == protoTypeBytes || field.kind == protoTypeMessage || field.kind == protoTypeGroup {
+		return "", fmt.Errorf("field %s: wire type %d does not match its type", field.name, wire)
+	}
+	switch wire {
+	case wireFixed64:
+		v, err := r.fixed(8)
+		if err != nil {
+			return "", err
+		}
+		switch field.kind {
+		case protoTypeDouble:
+			return strconv.FormatFloat(math.Float64frombits(v), 'g', -1, 64), nil
+		case protoTypeSfixed64:
+			return strconv.FormatInt(int64(v), 10), nil
+		}
+		return strconv.FormatUint(v, 10), nil
+	case wireFixed32:
+		v, err := r.fixed(4)
+		if err != nil {
+			return "", err
+		}
+		switch field.kind {
+		case protoTypeFloat:
+			return strconv.FormatFloat(float64(math.Float32frombits(uint32(v))), 'g', -1, 32), nil
+		case protoTypeSfixed32:
+			return strconv.FormatInt(int64(int32(v)), 10), nil
+		}
+		return strconv.FormatUint(v, 10), nil
+	}
+
+	v, err := r.varint()
+	if err != nil {
+		return "", err
+	}
+	switch field.kind {
+	case protoTypeInt64:
+		return strconv.FormatInt(int64(v), 10), nil
+	case protoTypeInt32:
+		return strconv.FormatInt(int64(int32(v)), 10), nil
+	case protoTypeUint32:
+		return strconv.FormatUint(uint64(uint32(v)), 10), nil
+	case protoTypeBool:
+		return strconv.FormatBool(v != 0), nil
+	case protoTypeSint32, protoTypeSint64:
+		return strconv.FormatInt(int64(v>>1)^-int64(v&1), 10), nil
+	case protoTypeEnum:
+		if enum := reg.enums[field.typeName]; enum != nil {
+			if name, ok := enum.values[int32(v)]; ok {
+				return name, nil
+			}
+		}
+		return strconv.FormatInt(int64(int32(v)), 10), nil
+	}
+	return strconv.FormatUint(v, 10), nil
+}
+
+// Quoted bytes with non-printable bytes as octal escapes, as in protobuf text format
+func quoteProtoBytes(data []byte) string {
+	var out strings.Builder
+	out.WriteByte('"')
+	for _, b := range data {
+		switch {
+		case b == '"' || b == '\\':
+			out.WriteByte('\\')
+			out.WriteByte(b)
+		case b == '\n':
+			out.WriteString(`\n`)
+		case b >= 0x20 && b < 0x7f:
+			out.WriteByte(b)
+		default:
+			fmt.Fprintf(&out, "\\%03o", b)
+		}
+	}
+	out.WriteByte('"')
+	return out.String()
+}
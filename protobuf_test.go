@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Wire-format builders for test messages
+func pbTag(num, wire int) []byte { return binary.AppendUvarint(nil, uint64(num)<<3|uint64(wire)) }
+
+func pbVarint(num int, v uint64) []byte {
+	return binary.AppendUvarint(pbTag(num, wireVarint), v)
+}
+
+func pbBytes(num int, data ...[]byte) []byte {
+	var body []byte
+	for _, d := range data {
+		body = append(body, d...)
+	}
+	return append(binary.AppendUvarint(pbTag(num, wireBytes), uint64(len(body))), body...)
+}
+
+func pbString(num int, s string) []byte { return pbBytes(num, []byte(s)) }
+
+func cat(parts ...[]byte) []byte {
+	var out []byte
+	for _, p := range parts {
+		out = append(out, p...)
+	}
+	return out
+}
+
+// A test.User message with a field of most types, a nested test.Address,
+// itself (for nesting) and a message type missing from the registry
+func testProtoRegistry() *protoRegistry {
+	return &protoRegistry{
+		messages: map[string]*protoMessage{
+			"test.User": {name: "test.User", fields: map[int]*protoField{
+				1:  {name: "name", number: 1, kind: protoTypeString},
+				2:  {name: "id", number: 2, kind: protoTypeInt32},
+				3:  {name: "score", number: 3, kind: protoTypeDouble},
+				4:  {name: "tags", number: 4, kind: protoTypeSint32},
+				5:  {name: "kind", number: 5, kind: protoTypeEnum, typeName: "test.Kind"},
+				6:  {name: "avatar", number: 6, kind: protoTypeBytes},
+				7:  {name: "address", number: 7, kind: protoTypeMessage, typeName: "test.Address"},
+				8:  {name: "big", number: 8, kind: protoTypeSint64},
+				9:  {name: "ok", number: 9, kind: protoTypeBool},
+				10: {name: "ratio", number: 10, kind: protoTypeFloat},
+				11: {name: "self", number: 11, kind: protoTypeMessage, typeName: "test.User"},
+				12: {name: "missing", number: 12, kind: protoTypeMessage, typeName: "test.Gone"},
+			}},
+			"test.Address": {name: "test.Address", fields: map[int]*protoField{
+				1: {name: "city", number: 1, kind: protoTypeString},
+			}},
+		},
+		enums: map[string]*protoEnum{
+			"test.Kind": {name: "test.Kind", values: map[int32]string{0: "UNKNOWN", 1: "ADMIN"}},
+		},
+	}
+}
+
+func TestProtoRender(t *testing.T) {
+	double := binary.LittleEndian.AppendUint64(pbTag(3, wireFixed64), 0x3ff8000000000000) // 1.5
+	float := binary.LittleEndian.AppendUint32(pbTag(10, wireFixed32), 0x40200000)         // 2.5
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"empty", nil, ""},
+		{"string and int", cat(pbString(1, "ada"), pbVarint(2, 42)), "name: \"ada\"\nid: 42"},
+		{"negative int32", pbVarint(2, 0xffffffffffffffff), "id: -1"},
+		{"double and float", cat(double, float), "score: 1.5\nratio: 2.5"},
+		{"packed sint32", pbBytes(4, []byte{0x02, 0x03, 0x04}), "tags: 1\ntags: -2\ntags: 2"},
+		{"unpacked sint32", cat(pbVarint(4, 1), pbVarint(4, 3)), "tags: -1\ntags: -2"},
+		{"enum", cat(pbVarint(5, 1), pbVarint(5, 7)), "kind: ADMIN\nkind: 7"},
+		{"bytes", pbBytes(6, []byte{0x00, 'a', '"', 0xff}), `avatar: "\000a\"\377"`},
+		{"nested", pbBytes(7, pbString(1, "Oslo")), "address {\n  city: \"Oslo\"\n}"},
+		{"sint64 and bool", cat(pbVarint(8, 199), pbVarint(9, 1)), "big: -100\nok: true"},
+		{"unknown field", cat(pbVarint(99, 5), pbString(1, "x")), "99: 5\nname: \"x\""},
+	}
+	reg := testProtoRegistry()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			if err := reg.render(&out, reg.messages["test.User"], tt.data, 0); err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.TrimSuffix(out.String(), "\n"); got != tt.want {
+				t.Errorf("render = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProtoRenderMalformed(t *testing.T) {
+	deep := pbString(1, "x")
+	for i := 0; i <= protoMaxDepth+1; i++ {
+		deep = pbBytes(11, deep)
+	}
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"truncated varint", []byte{0x10, 0x80}, "truncated"},
+		{"truncated tag", []byte{0x80}, "truncated"},
+		{"field number zero", []byte{0x00, 0x01}, "invalid field number"},
+		{"length past end", []byte{0x0a, 0x05, 'a'}, "truncated"},
+		{"huge length", append([]byte{0x0a}, binary.AppendUvarint(nil, 1<<63)...), "truncated"},
+		{"truncated fixed64", append(pbTag(3, wireFixed64), 1, 2, 3), "truncated"},
+		{"wire type mismatch", pbVarint(1, 5), "does not match"},
+		{"fixed where varint belongs", binary.LittleEndian.AppendUint32(pbTag(2, wireFixed32), 1), "does not match"},
+		{"group", pbTag(2, wireStart), "groups"},
+		{"invalid wire type", pbTag(2, 6), "does not match"},
+		{"missing nested type", pbBytes(12), "not in the descriptor set"},
+		{"bad nested message", pbBytes(7, []byte{0x0a, 0x09}), "truncated"},
+		{"truncated packed", pbBytes(4, []byte{0x80}), "truncated"},
+		{"nesting too deep", deep, "too deep"},
+	}
+	reg := testProtoRegistry()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			err := reg.render(&out, reg.messages["test.User"], tt.data, 0)
+			if err == nil {
+				t.Fatalf("rendered %x as %q, want an error containing %q", tt.data, out.String(), tt.want)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error %q, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// A value that does not decode as its type falls back to raw wire format
+func TestDecodeProtoAsFallback(t *testing.T) {
+	saved := protoTypeRegistry
+	protoTypeRegistry = testProtoRegistry()
+	defer func() { protoTypeRegistry = saved }()
+
+	msg := protoTypeRegistry.messages["test.User"]
+	got, ok := decodeProtoAs(msg, pbVarint(1, 5))
+	if !ok || !strings.HasPrefix(got, "# Not a valid test.User") || !strings.HasSuffix(got, "1: 5") {
+		t.Errorf("decodeProtoAs = %q, %v, want a raw fallback", got, ok)
+	}
+	if _, ok := decodeProtoAs(msg, []byte{0x0a, 0x09}); ok {
+		t.Error("decodeProtoAs decoded a truncated message")
+	}
+}
+
+func TestLoadProtoRegistry(t *testing.T) {
+	field := func(name string, number, kind int, typeName string) []byte {
+		f := cat(pbString(1, name), pbVarint(3, uint64(number)), pbVarint(5, uint64(kind)))
+		if typeName != "" {
+			f = append(f, pbString(6, typeName)...)
+		}
+		return f
+	}
+	enum := pbBytes(5, pbString(1, "Kind"), pbBytes(2, pbString(1, "UNKNOWN"), pbVarint(2, 0)), pbBytes(2, pbString(1, "ADMIN"), pbVarint(2, 1)))
+	user := pbBytes(4,
+		pbString(1, "User"),
+		pbBytes(2, field("name", 1, protoTypeString, "")),
+		pbBytes(2, field("kind", 2, protoTypeEnum, ".test.Kind")),
+		pbBytes(3, pbString(1, "Inner"), pbBytes(2, field("x", 1, protoTypeInt64, ""))),
+	)
+	file := pbBytes(1, pbString(1, "test.proto"), pbString(2, "test"), enum, user)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr string
+	}{
+		{"descriptor set", file, ""},
+		{"other fields skipped", cat(pbVarint(7, 1), file), ""},
+		{"empty", nil, "no message types"},
+		{"not a descriptor set", []byte("hello, world"), "invalid wire type"},
+		{"truncated", file[:len(file)-3], "truncated"},
+		{"bad field", pbBytes(1, pbBytes(4, pbString(1, "M"), pbBytes(2, []byte{0x18, 0x80}))), "M: truncated"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "desc.pb")
+			if err := os.WriteFile(path, tt.data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			reg, err := loadProtoRegistry(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			msg := reg.messages["test.User"]
+			if msg == nil || reg.messages["test.User.Inner"] == nil {
+				t.Fatalf("messages %v, want test.User and test.User.Inner", reg.messages)
+			}
+			if f := msg.fields[2]; f == nil || f.name != "kind" || f.kind != protoTypeEnum || f.typeName != "test.Kind" {
+				t.Errorf("field 2 = %+v, want kind of enum test.Kind", f)
+			}
+			if e := reg.enums["test.Kind"]; e == nil || e.values[1] != "ADMIN" {
+				t.Errorf("enum test.Kind = %+v, want 1 named ADMIN", e)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const protoMaxFieldNumber = 1<<29 - 1
+
+// Best-effort decode of binary data as protobuf wire format without a schema,
+// like protoc --decode_raw: field numbers, with length-delimited fields shown
+// as text, nested messages or bytes. Fails unless all of value parses.
+func decodeRawProto(value []byte) (string, bool) {
+	if len(value) == 0 || isPrintableText(value) {
+		return "", false
+	}
+	var out strings.Builder
+	if err := renderRawFields(&out, &protoReader{buf: value}, 0, 0); err != nil {
+		return "", false
+	}
+	return strings.TrimSuffix(out.String(), "\n"), true
+}
+
+// Valid UTF-8 without control characters other than line breaks and tabs
+func isPrintableText(data []byte) bool {
+	if !utf8.Valid(data) {
+		return false
+	}
+	return !bytes.ContainsFunc(data, func(r rune) bool {
+		return unicode.IsControl(r) && r != '\n' && r != '\r' && r != '\t'
+	})
+}
+
+// Render fields until the data ends, or until the end tag of group endGroup when it is not 0
+func renderRawFields(out *strings.Builder, r *protoReader, depth, endGroup int) error {
+	if depth > protoMaxDepth {
+		return errors.New("message nesting too deep")
+	}
+	for !r.done() {
+		num, wire, err := r.tag()
+		if err != nil {
+			return err
+		}
+		if wire == wireEnd {
+			if num != endGroup {
+				return fmt.Errorf("unexpected end of group %d", num)
+			}
+			return nil
+		}
+		if err := renderRawField(out, r, num, wire, depth); err != nil {
+			return err
+		}
+	}
+	if endGroup != 0 {
+		return errProtoTruncated
+	}
+	return nil
+}
+
+// One field shown by number, its value interpreted from the wire type alone
+func renderRawField(out *strings.Builder, r *protoReader, num, wire, depth int) error {
+	if num > protoMaxFieldNumber {
+		return fmt.Errorf("invalid field number %d", num)
+	}
+	indent := strings.Repeat("  ", depth)
+	switch wire {
+	case wireVarint:
+		v, err := r.varint()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%s%d: %d\n", indent, num, v)
+	case wireFixed64:
+		v, err := r.fixed(8)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%s%d: 0x%016x\n", indent, num, v)
+	case wireFixed32:
+		v, err := r.fixed(4)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%s%d: 0x%08x\n", indent, num, v)
+	case wireBytes:
+		data, err := r.bytes()
+		if err != nil {
+			return err
+		}
+		if len(data) == 0 || isPrintableText(data) {
+			fmt.Fprintf(out, "%s%d: %s\n", indent, num, strconv.Quote(string(data)))
+			return nil
+		}
+		var nested strings.Builder
+		if err := renderRawFields(&nested, &protoReader{buf: data}, depth+1, 0); err == nil {
+			fmt.Fprintf(out, "%s%d {\n%s%s}\n", indent, num, nested.String(), indent)
+			return nil
+		}
+		fmt.Fprintf(out, "%s%d: %s\n", indent, num, quoteProtoBytes(data))
+	case wireStart:
+		fmt.Fprintf(out, "%s%d {\n", indent, num)
+		if err := renderRawFields(out, r, depth+1, num); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%s}\n", indent)
+	default:
+		return fmt.Errorf("invalid wire type %d", wire)
+	}
+	return nil
+}
@@ -0,0 +1,461 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Queries: a search starting with a field and an operator, e.g.
+//
+//	key~"^user:" AND value.json.status == "active" AND size > 1KB
+//
+// is evaluated against each key and its value while scanning, instead of
+// matched as text. Comparisons of key, value, note, size (of the value),
+// time (of the key, as the timeline reads it) and value.json.<path> combine
+// with AND, OR, NOT and parentheses. Operators are == (or =), !=, <, <=, >,
+// >=, ~ (matches a regular expression) and !~. Text goes in double quotes
+// unless it is a single word.
+
+var queryOperators = map[string]bool{"==": true, "=": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true, "~": true, "!~": true}
+
+// Searches that are queries rather than text
+var queryStartPattern = regexp.MustCompile(`^\s*(\(|(?i:not)\s|(key|value|note|size|time|value\.json[^\s=!<>~]*)\s*(==|!=|<=|>=|!~|=|<|>|~))`)
+
+func isQuery(search string) bool {
+	return queryStartPattern.MatchString(search)
+}
+
+type queryToken struct {
+	text   string
+	quoted bool // A "..." string; text is what it unquotes to
+	pos    int  // Byte offset in the query, for errors
+}
+
+// Split a query into words, quoted strings, operators and parentheses
+func tokenizeQuery(text string) ([]queryToken, error) {
+	var tokens []queryToken
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, queryToken{text: string(c), pos: i})
+			i++
+		case c == '"':
+			end := i + 1
+			for end < len(text) && text[end] != '"' {
+				if text[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(text) {
+				return nil, fmt.Errorf("query: unterminated string at %d", i+1)
+			}
+			s, err := strconv.Unquote(text[i : end+1])
+			if err != nil {
+				return nil, fmt.Errorf("query: bad string %s", text[i:end+1])
+			}
+			tokens = append(tokens, queryToken{text: s, quoted: true, pos: i})
+			i = end + 1
+		case strings.ContainsRune("=!<>~", rune(c)):
+			op := string(c)
+			if i+1 < len(text) && (text[i+1] == '=' || c == '!' && text[i+1] == '~') {
+				op = text[i : i+2]
+			}
+			tokens = append(tokens, queryToken{text: op, pos: i})
+			i += len(op)
+		default:
+			end := i
+			for end < len(text) && !strings.ContainsRune(" \t\n()\"=!<>~", rune(text[end])) {
+				end++
+			}
+			tokens = append(tokens, queryToken{text: text[i:end], pos: i})
+			i = end
+		}
+	}
+	return tokens, nil
+}
+
+// A node of a parsed query: and, or, not, or a comparison
+type queryNode struct {
+	op       string // "and", "or", "not" or the comparison operator
+	children []*queryNode
+
+	field string   // key, value, note, size, time or json
+	path  []string // Of a json field
+	lit   queryToken
+	bytes []byte         // Literal as a key or value
+	num   float64        // Literal as a number, for size and json fields
+	isNum bool           // lit is a number
+	when  time.Time      // Literal of a time field
+	re    *regexp.Regexp // Of ~ and !~
+}
+
+type queryParser struct {
+	tokens []queryToken
+	next   int
+}
+
+func (p *queryParser) peek() (queryToken, bool) {
+	if p.next >= len(p.tokens) {
+		return queryToken{}, false
+	}
+	return p.tokens[p.next], true
+}
+
+// Whether the next token is the keyword (AND, OR or NOT, in any case); consumes it if so
+func (p *queryParser) keyword(word string) bool {
+	t, ok := p.peek()
+	if ok && !t.quoted && strings.EqualFold(t.text, word) {
+		p.next++
+		return true
+	}
+	return false
+}
+
+func parseQuery(text string) (*queryNode, error) {
+	tokens, err := tokenizeQuery(text)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{tokens: tokens}
+	node, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if t, ok := p.peek(); ok {
+		return nil, fmt.Errorf("query: unexpected %q at %d", t.text, t.pos+1)
+	}
+	return node, nil
+}
+
+func (p *queryParser) or() (*queryNode, error) {
+	node, err := p.and()
+	for err == nil && p.keyword("or") {
+		var right *queryNode
+		if right, err = p.and(); err == nil {
+			node = &queryNode{op: "or", children: []*queryNode{node, right}}
+		}
+	}
+	return node, err
+}
+
+func (p *queryParser) and() (*queryNode, error) {
+	node, err := p.not()
+	for err == nil && p.keyword("and") {
+		var right *queryNode
+		if right, err = p.not(); err == nil {
+			node = &queryNode{op: "and", children: []*queryNode{node, right}}
+		}
+	}
+	return node, err
+}
+
+func (p *queryParser) not() (*queryNode, error) {
+	if p.keyword("not") {
+		node, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return &queryNode{op: "not", children: []*queryNode{node}}, nil
+	}
+	open, ok := p.peek()
+	if ok && !open.quoted && open.text == "(" {
+		p.next++
+		node, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if t, ok := p.peek(); !ok || t.quoted || t.text != ")" {
+			return nil, fmt.Errorf("query: missing ) for the ( at %d", open.pos+1)
+		}
+		p.next++
+		return node, nil
+	}
+	return p.comparison()
+}
+
+func (p *queryParser) comparison() (*queryNode, error) {
+	field, ok := p.peek()
+	if !ok {
+		return nil, fmt.Errorf("query: ends where a comparison should follow")
+	}
+	p.next++
+	node := &queryNode{field: field.text}
+	switch {
+	case field.quoted:
+		return nil, fmt.Errorf("query: want a field at %d, not a string", field.pos+1)
+	case field.text == "value.json":
+		node.field = "json"
+	case strings.HasPrefix(field.text, "value.json."):
+		node.field, node.path = "json", strings.Split(strings.TrimPrefix(field.text, "value.json."), ".")
+	case field.text != "key" && field.text != "value" && field.text != "note" && field.text != "size" && field.text != "time":
+		return nil, fmt.Errorf("query: unknown field %q at %d, want key, value, value.json.<path>, note, size or time", field.text, field.pos+1)
+	}
+
+	op, ok := p.peek()
+	if !ok || op.quoted || !queryOperators[op.text] {
+		return nil, fmt.Errorf("query: want an operator (==, !=, <, <=, >, >=, ~ or !~) after %s", field.text)
+	}
+	p.next++
+	node.op = op.text
+	if node.op == "=" {
+		node.op = "=="
+	}
+
+	lit, ok := p.peek()
+	if !ok || !lit.quoted && (lit.text == "(" || lit.text == ")" || strings.ContainsAny(lit.text, "=!<>~")) {
+		return nil, fmt.Errorf("query: want a value after %s %s", field.text, op.text)
+	}
+	p.next++
+	node.lit = lit
+	return node, node.compileLiteral()
+}
+
+// Interpret the literal for the node's field and operator
+func (n *queryNode) compileLiteral() error {
+	text := n.lit.text
+	if n.op == "~" || n.op == "!~" {
+		re, err := regexp.Compile(text)
+		if err != nil {
+			return fmt.Errorf("query: %s %s: %w", n.field, n.op, err)
+		}
+		n.re = re
+		return nil
+	}
+	switch n.field {
+	case "key":
+		key, _, err := parseKeyInput(text)
+		if err != nil {
+			return fmt.Errorf("query: key %s: %w", n.op, err)
+		}
+		n.bytes = key
+	case "value", "note":
+		n.bytes = []byte(text)
+	case "size":
+		size, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			var s byteSize
+			if err := s.Set(text); err != nil {
+				return fmt.Errorf("query: size: %w", err)
+			}
+			size = int64(s)
+		}
+		n.num, n.isNum = float64(size), true
+	case "time":
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04", "2006-01-02 15:04", "2006-01-02"} {
+			if t, err := time.Parse(layout, text); err == nil {
+				n.when = t
+				return nil
+			}
+		}
+		return fmt.Errorf("query: bad time %q, want RFC 3339 or e.g. 2024-05-01 13:45", text)
+	case "json":
+		if !n.lit.quoted {
+			if f, err := strconv.ParseFloat(text, 64); err == nil {
+				n.num, n.isNum = f, true
+			}
+		}
+	}
+	return nil
+}
+
+// One key and value being matched; the value's JSON is decoded once, when a comparison first needs it
+type queryRow struct {
+	key, value []byte
+	doc        any
+	decoded    bool
+	valid      bool
+}
+
+func (r *queryRow) json() (any, bool) {
+	if !r.decoded {
+		r.decoded = true
+		r.valid = json.Unmarshal(r.value, &r.doc) == nil
+	}
+	return r.doc, r.valid
+}
+
+func (n *queryNode) match(row *queryRow) bool {
+	switch n.op {
+	case "and":
+		return n.children[0].match(row) && n.children[1].match(row)
+	case "or":
+		return n.children[0].match(row) || n.children[1].match(row)
+	case "not":
+		return !n.children[0].match(row)
+	}
+
+	switch n.field {
+	case "key":
+		return n.compareBytes(row.key)
+	case "value":
+		return n.compareBytes(row.value)
+	case "note":
+		note, _ := noteFor(row.key)
+		return n.compareBytes([]byte(note.Text))
+	case "size":
+		return n.compareOrder(compareNumbers(float64(len(row.value)), n.num))
+	case "time":
+		t, ok := keyTime(row.key)
+		if !ok {
+			return n.op == "!=" || n.op == "!~"
+		}
+		if n.re != nil {
+			return n.re.MatchString(t.Format(time.RFC3339Nano)) == (n.op == "~")
+		}
+		return n.compareOrder(t.Compare(n.when))
+	}
+
+	doc, ok := row.json()
+	if !ok {
+		return n.op == "!=" || n.op == "!~"
+	}
+	v, found := jsonAtPath(doc, n.path)
+	return n.compareJSON(v, found)
+}
+
+// Whether the result of comparing the field with the literal (-1, 0 or 1) satisfies the operator
+func (n *queryNode) compareOrder(c int) bool {
+	switch n.op {
+	case "==":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
+
+func (n *queryNode) compareBytes(data []byte) bool {
+	if n.re != nil {
+		return n.re.Match(data) == (n.op == "~")
+	}
+	return n.compareOrder(bytes.Compare(data, n.bytes))
+}
+
+func compareNumbers(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// Compare a JSON value with the literal: numbers with numbers, strings with
+// text, and true, false and null with those words. A missing path only
+// equals null; comparisons of other kinds are false but for !=.
+func (n *queryNode) compareJSON(v any, found bool) bool {
+	if n.re != nil {
+		if !found {
+			return n.op == "!~"
+		}
+		text, ok := v.(string)
+		if !ok {
+			encoded, _ := json.Marshal(v)
+			text = string(encoded)
+		}
+		return n.re.MatchString(text) == (n.op == "~")
+	}
+	if !n.lit.quoted && (n.lit.text == "null" || n.lit.text == "true" || n.lit.text == "false") {
+		if n.op != "==" && n.op != "!=" {
+			return false
+		}
+		equal := v == nil && n.lit.text == "null"
+		if b, ok := v.(bool); ok && found {
+			equal = strconv.FormatBool(b) == n.lit.text
+		}
+		return equal == (n.op == "==")
+	}
+	switch v := v.(type) {
+	case float64:
+		if n.isNum {
+			return n.compareOrder(compareNumbers(v, n.num))
+		}
+	case string:
+		if !n.isNum {
+			return n.compareOrder(strings.Compare(v, n.lit.text))
+		}
+	}
+	return n.op == "!="
+}
+
+// The element of doc at path: object members by name, array elements by index
+func jsonAtPath(doc any, path []string) (any, bool) {
+	for _, step := range path {
+		switch node := doc.(type) {
+		case map[string]any:
+			v, ok := node[step]
+			if !ok {
+				return nil, false
+			}
+			doc = v
+		case []any:
+			i, err := strconv.Atoi(step)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			doc = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+// The key range every match lies in, from the key comparisons that must
+// hold: anchored key~"^..." and key ==, <, <=, >, >= under AND. nil when
+// matches may be anywhere.
+func (n *queryNode) keyRange() *util.Range {
+	switch {
+	case n.op == "and":
+		a, b := n.children[0].keyRange(), n.children[1].keyRange()
+		return intersectRanges(a, b)
+	case n.field != "key":
+		return nil
+	}
+	// The smallest key after k
+	after := func(k []byte) []byte { return append(append([]byte{}, k...), 0) }
+	switch n.op {
+	case "~":
+		return searchRange("re:" + n.lit.text)
+	case "==":
+		return &util.Range{Start: n.bytes, Limit: after(n.bytes)}
+	case ">":
+		return &util.Range{Start: after(n.bytes)}
+	case ">=":
+		return &util.Range{Start: n.bytes}
+	case "<":
+		return &util.Range{Limit: n.bytes}
+	case "<=":
+		return &util.Range{Limit: after(n.bytes)}
+	}
+	return nil
+}
+
+// Key filter of a query; one that does not parse matches nothing
+func queryKeyFilter(search string) keyFilter {
+	q, err := parseQuery(search)
+	if err != nil {
+		return func(key, value []byte) bool { return false }
+	}
+	return func(key, value []byte) bool { return q.match(&queryRow{key: key, value: value}) }
+}
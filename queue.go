@@ -0,0 +1,226 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Task lifecycle states
+const (
+	taskQueued  = "queued"
+	taskRunning = "running"
+	taskDone    = "done"
+	taskFailed  = "failed"
+)
+
+// Heavy operation executed by the background queue. run reports progress
+// through the callback and returns a short summary for the status bar.
+type task struct {
+	id     int
+	name   string
+	state  string
+	detail string
+	run    func(progress func(string)) (string, error)
+}
+
+var (
+	taskQueue  = make(chan *task, 64) // Pending tasks, executed one at a time
+	tasks      []*task                // Every task submitted this session, for the queue panel
+	tasksMu    sync.Mutex
+	nextTaskID = 1
+	showQueue  = false // Show/hide queue panel
+)
+
+// Add a task to the queue; it runs after every task submitted before it
+func enqueueTask(name string, run func(progress func(string)) (string, error)) {
+	tasksMu.Lock()
+	t := &task{id: nextTaskID, name: name, state: taskQueued, run: run}
+	nextTaskID++
+	tasks = append(tasks, t)
+	pending := 0
+	for _, other := range tasks {
+		if other.state == taskQueued || other.state == taskRunning {
+			pending++
+		}
+	}
+	tasksMu.Unlock()
+
+	select {
+	case taskQueue <- t:
+	default:
+		setTaskState(t, taskFailed, "queue is full")
+		setStatus("[red]Task queue is full, try again later")
+		return
+	}
+
+	if pending > 1 {
+		setStatus(fmt.Sprintf("[yellow]Queued %s (%d pending)", name, pending))
+	} else {
+		setStatus(fmt.Sprintf("[yellow]Started %s", name))
+	}
+	refreshQueueView()
+}
+
+// Execute queued tasks sequentially; started once from main
+func runTaskQueue() {
+	for t := range taskQueue {
+		if shuttingDown.Load() {
+			setTaskState(t, taskFailed, "cancelled by shutdown")
+			continue
+		}
+		setTaskState(t, taskRunning, "")
+		app.QueueUpdateDraw(refreshQueueView)
+
+		summary, err := t.run(func(detail string) {
+			setTaskState(t, taskRunning, detail)
+			app.QueueUpdateDraw(refreshQueueView)
+		})
+
+		if err != nil {
+			setTaskState(t, taskFailed, err.Error())
+			app.QueueUpdateDraw(func() {
+				setStatus(fmt.Sprintf("[red]%s failed: %v", t.name, err))
+				refreshQueueView()
+			})
+			continue
+		}
+
+		setTaskState(t, taskDone, summary)
+		app.QueueUpdateDraw(func() {
+			setStatus("[green]" + summary)
+			refreshQueueView()
+		})
+	}
+}
+
+func setTaskState(t *task, state, detail string) {
+	tasksMu.Lock()
+	defer tasksMu.Unlock()
+	t.state = state
+	t.detail = detail
+}
+
+// Redraw the queue panel from the task list
+func refreshQueueView() {
+	tasksMu.Lock()
+	defer tasksMu.Unlock()
+
+	if len(tasks) == 0 {
+		queueView.SetText("[white]No tasks yet")
+		return
+	}
+
+	var text strings.Builder
+	for _, t := range tasks {
+		color := "white"
+		switch t.state {
+		case taskRunning:
+			color = "yellow"
+		case taskDone:
+			color = "green"
+		case taskFailed:
+			color = "red"
+		}
+		fmt.Fprintf(&text, "[%s]#%d %-8s[-] %s", color, t.id, t.state, t.name)
+		if t.detail != "" {
+			fmt.Fprintf(&text, ": %s", t.detail)
+		}
+		text.WriteString("\n")
+	}
+	queueView.SetText(text.String())
+	queueView.ScrollToEnd()
+}
+
+// Count keys matching the current search filter
+func countKeys() {
+	search := currentPrefix
+	recordAction("count", nil, search)
+	enqueueTask("Count keys", func(progress func(string)) (string, error) {
+		return countMatching(search, progress)
+	})
+}
+
+func countMatching(search string, progress func(string)) (string, error) {
+	iter := browseReader().NewIterator(intersectRanges(namespaceRange(), searchRange(search)), scanReadOptions)
+	defer iter.Release()
+
+	filter := newKeyFilter(search)
+	count, scanned := 0, 0
+	for iter.Next() {
+		if err := interrupted(); err != nil {
+			return "", err
+		}
+		scanRate.wait(iter.Key(), iter.Value())
+		scanned++
+		if filter(iter.Key(), iter.Value()) {
+			count++
+		}
+		if scanned%100000 == 0 {
+			progress(fmt.Sprintf("%d scanned", scanned))
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return "", err
+	}
+
+	if search == "" && namespace != nil {
+		return fmt.Sprintf("%d keys in namespace %s", count, namespaceLabel(namespace)), nil
+	}
+	if search == "" {
+		return fmt.Sprintf("%d keys in database", count), nil
+	}
+	return fmt.Sprintf("%d of %d keys match %q", count, scanned, search), nil
+}
+
+// Read every entry with strict checksum verification
+func verifyDatabase() {
+	recordAction("verify", nil, "")
+	enqueueTask("Verify database", verifyEntries)
+}
+
+func verifyEntries(progress func(string)) (string, error) {
+	iter := db.NewIterator(nil, &opt.ReadOptions{DontFillCache: scanReadOptions.DontFillCache, Strict: opt.StrictAll})
+	defer iter.Release()
+
+	count := 0
+	var bytesRead int64
+	for iter.Next() {
+		if err := interrupted(); err != nil {
+			return "", err
+		}
+		scanRate.wait(iter.Key(), iter.Value())
+		count++
+		bytesRead += int64(len(iter.Key()) + len(iter.Value()))
+		if count%100000 == 0 {
+			progress(fmt.Sprintf("%d entries verified", count))
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return "", fmt.Errorf("after %d entries: %w", count, err)
+	}
+	return fmt.Sprintf("Verified %d entries (%d bytes), no errors", count, bytesRead), nil
+}
+
+// Compact the whole key range
+func compactDatabase() {
+	if refuseWrite() {
+		return
+	}
+	recordAction("compact", nil, "")
+	enqueueTask("Compact database", compactAll)
+}
+
+func compactAll(progress func(string)) (string, error) {
+	if readOnly {
+		return "", errReadOnly
+	}
+	progress("compacting")
+	if err := db.CompactRange(util.Range{}); err != nil {
+		return "", err
+	}
+	return "Compaction finished", nil
+}
@@ -0,0 +1,15 @@
+package main
+
+import "errors"
+
+var readOnly bool // From -read-only: the database is opened with opt.ReadOnly and nothing is written to it
+
+var errReadOnly = errors.New("database is open read-only")
+
+// Refuse a mutating command in read-only mode, saying why in the status bar
+func refuseWrite() bool {
+	if readOnly {
+		setStatus("[red]Database is open read-only (-read-only)")
+	}
+	return readOnly
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+// Read options of the whole-database passes (exports, searches, counts,
+// diffs, verifies). By default they bypass the block cache, so a scan does
+// not push out the blocks of the keys being browsed, or those of the app
+// sharing the machine's memory; -dont-fill-cache=false lets them fill it,
+// and -strict-reads makes them fail on corrupt blocks instead of skipping.
+
+var scanReadOptions = &opt.ReadOptions{DontFillCache: true}
+
+// Settings of the "reads" section of the config file; the flags override them
+type readsConfig struct {
+	DontFillCache *bool  `json:"dont_fill_cache"`
+	Strict        string `json:"strict"` // As -strict-reads
+}
+
+var (
+	dontFillCacheFlag optionalBool
+	strictReadsFlag   string
+)
+
+// A bool flag that remembers whether it was given
+type optionalBool struct {
+	value, set bool
+}
+
+func (b *optionalBool) Set(value string) error {
+	v, err := strconv.ParseBool(value)
+	if err != nil {
+		return err
+	}
+	b.value, b.set = v, true
+	return nil
+}
+
+func (b *optionalBool) String() string {
+	if b == nil || !b.set {
+		return ""
+	}
+	return strconv.FormatBool(b.value)
+}
+
+func (b *optionalBool) IsBoolFlag() bool { return true }
+
+// Read strictness levels by name
+var strictLevels = map[string]opt.Strict{
+	"none":     opt.NoStrict,
+	"checksum": opt.StrictBlockChecksum, // Verify the checksum of every block read
+	"reader":   opt.StrictReader,        // Stop at a corrupt block instead of skipping it
+	"all":      opt.StrictBlockChecksum | opt.StrictReader,
+}
+
+// Parse a comma-separated list of strictness levels
+func parseStrictReads(spec string) (opt.Strict, error) {
+	var strict opt.Strict
+	for _, name := range strings.Split(spec, ",") {
+		level, ok := strictLevels[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return 0, fmt.Errorf("unknown read strictness %q, want none, checksum, reader or all", name)
+		}
+		strict |= level
+	}
+	return strict, nil
+}
+
+// Set the scan read options from the flags, or the config where a flag is not given
+func setupReadOptions() error {
+	if dontFillCacheFlag.set {
+		scanReadOptions.DontFillCache = dontFillCacheFlag.value
+	} else if cfg.Reads.DontFillCache != nil {
+		scanReadOptions.DontFillCache = *cfg.Reads.DontFillCache
+	}
+	spec := strictReadsFlag
+	if spec == "" {
+		spec = cfg.Reads.Strict
+	}
+	if spec == "" {
+		return nil
+	}
+	strict, err := parseStrictReads(spec)
+	if err != nil {
+		return err
+	}
+	scanReadOptions.Strict = strict
+	return nil
+}
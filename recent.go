@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// Databases opened in the viewer, newest first, kept in recent.json in the
+// config directory. Launched without -db, the viewer starts on a list of
+// them with a path input instead of failing.
+
+const maxRecentDatabases = 20
+
+type recentDatabase struct {
+	Path   string    `json:"path"`
+	Mode   string    `json:"mode,omitempty"` // "indexeddb", "bedrock" or "ipfs" when opened in that mode
+	Opened time.Time `json:"opened"`
+}
+
+func recentDatabasesPath() string {
+	dir := configDir()
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, "recent.json")
+}
+
+// The remembered databases; a missing or unreadable file is an empty list
+func loadRecentDatabases() []recentDatabase {
+	path := recentDatabasesPath()
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var recent []recentDatabase
+	if json.Unmarshal(data, &recent) != nil {
+		return nil
+	}
+	return recent
+}
+
+func saveRecentDatabases(recent []recentDatabase) error {
+	path := recentDatabasesPath()
+	if path == "" {
+		return fmt.Errorf("no user config directory for the recent databases")
+	}
+	data, err := json.MarshalIndent(recent, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// The mode flag the database was opened with
+func openMode() string {
+	switch {
+	case indexedDB:
+		return "indexeddb"
+	case bedrockWorld:
+		return "bedrock"
+	case ipfsMode:
+		return "ipfs"
+	}
+	return ""
+}
+
+func setOpenMode(mode string) {
+	indexedDB = mode == "indexeddb"
+	bedrockWorld = mode == "bedrock"
+	ipfsMode = mode == "ipfs"
+}
+
+// Move path to the top of the recent databases
+func rememberDatabase(path string) error {
+	if absPath, err := filepath.Abs(path); err == nil {
+		path = absPath
+	}
+	recent := []recentDatabase{{Path: path, Mode: openMode(), Opened: time.Now()}}
+	for _, r := range loadRecentDatabases() {
+		if r.Path != path && len(recent) < maxRecentDatabases {
+			recent = append(recent, r)
+		}
+	}
+	return saveRecentDatabases(recent)
+}
+
+// Start screen: pick a recent database or type a path, setting the mode it
+// was opened with; "" when the user quit
+func pickRecentDatabase() (string, error) {
+	recent := loadRecentDatabases()
+	picker := tview.NewApplication()
+	picked := ""
+
+	list := tview.NewList().SetWrapAround(false).ShowSecondaryText(false)
+	list.SetBorder(true)
+	list.SetTitleAlign(tview.AlignLeft)
+	list.SetTitleColor(tcell.ColorYellow)
+	list.SetBackgroundColor(tcell.ColorReset)
+	list.SetSelectedBackgroundColor(tcell.ColorWhite)
+	list.SetHighlightFullLine(true)
+
+	input := newDialogInput(" Path: ")
+	input.SetBorder(true).SetTitle(" Open a database (Enter: open, Tab: recent list, Esc: quit) ")
+	input.SetTitleAlign(tview.AlignLeft)
+	input.SetTitleColor(tcell.ColorYellow)
+
+	fill := func() {
+		list.Clear()
+		list.SetTitle(fmt.Sprintf(" Recent databases: %d (Enter: open, Delete: forget, Tab: path input, Esc: quit) ", len(recent)))
+		for _, r := range recent {
+			r := r
+			label := sanitizeForDisplay(r.Path)
+			if r.Mode != "" {
+				label += " [yellow](" + r.Mode + ")[-]"
+			}
+			label += " [gray]opened " + r.Opened.Format("2006-01-02 15:04") + "[-]"
+			if _, err := os.Stat(r.Path); err != nil {
+				label += " [red](missing)[-]"
+			}
+			list.AddItem(label, "", 0, func() {
+				picked = r.Path
+				setOpenMode(r.Mode)
+				picker.Stop()
+			})
+		}
+	}
+	fill()
+
+	input.SetDoneFunc(func(key tcell.Key) {
+		switch key {
+		case tcell.KeyEnter:
+			path := strings.TrimSpace(input.GetText())
+			if home, err := os.UserHomeDir(); err == nil && strings.HasPrefix(path, "~"+string(filepath.Separator)) {
+				path = filepath.Join(home, path[2:])
+			}
+			if path != "" {
+				picked = path
+				picker.Stop()
+			}
+		case tcell.KeyEsc:
+			picker.Stop()
+		case tcell.KeyTab, tcell.KeyBacktab:
+			if len(recent) > 0 {
+				picker.SetFocus(list)
+			}
+		}
+	})
+	list.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch {
+		case event.Key() == tcell.KeyEsc || event.Rune() == 'q':
+			picker.Stop()
+			return nil
+		case event.Key() == tcell.KeyTab || event.Key() == tcell.KeyBacktab:
+			picker.SetFocus(input)
+			return nil
+		case event.Key() == tcell.KeyDelete:
+			if i := list.GetCurrentItem(); i >= 0 && i < len(recent) {
+				recent = append(recent[:i], recent[i+1:]...)
+				saveRecentDatabases(recent)
+				fill()
+				list.SetCurrentItem(min(i, len(recent)-1))
+				if len(recent) == 0 {
+					picker.SetFocus(input)
+				}
+			}
+			return nil
+		}
+		return event
+	})
+
+	layout := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(list, 0, 1, len(recent) > 0).
+		AddItem(input, 3, 0, len(recent) == 0)
+	if err := picker.SetRoot(layout, true).Run(); err != nil {
+		return "", err
+	}
+	return picked, nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// Some applications append several records to one value, each behind its
+// length. The "records" value format splits such a value and shows every
+// record decoded on its own by the decoder chain.
+
+// Ways of writing a record's length, tried in order
+var recordPrefixes = []struct {
+	name string
+	read func(data []byte) (length uint64, size int)
+}{
+	{"uint32-be", func(data []byte) (uint64, int) {
+		if len(data) < 4 {
+			return 0, 0
+		}
+		return uint64(binary.BigEndian.Uint32(data)), 4
+	}},
+	{"uint32-le", func(data []byte) (uint64, int) {
+		if len(data) < 4 {
+			return 0, 0
+		}
+		return uint64(binary.LittleEndian.Uint32(data)), 4
+	}},
+	{"varint", func(data []byte) (uint64, int) {
+		n, size := binary.Uvarint(data)
+		if size < 0 {
+			size = 0
+		}
+		return n, size
+	}},
+	{"uint16-be", func(data []byte) (uint64, int) {
+		if len(data) < 2 {
+			return 0, 0
+		}
+		return uint64(binary.BigEndian.Uint16(data)), 2
+	}},
+	{"uint16-le", func(data []byte) (uint64, int) {
+		if len(data) < 2 {
+			return 0, 0
+		}
+		return uint64(binary.LittleEndian.Uint16(data)), 2
+	}},
+}
+
+// Split value into the records of the first length prefix that covers it
+// exactly; prefix is "" when none does
+func splitRecords(value []byte) (records [][]byte, prefix string) {
+	for _, p := range recordPrefixes {
+		records = records[:0]
+		rest := value
+		for len(rest) > 0 {
+			n, size := p.read(rest)
+			if size == 0 || n > uint64(len(rest)-size) {
+				break
+			}
+			records = append(records, rest[size:size+int(n)])
+			rest = rest[size+int(n):]
+		}
+		if len(rest) == 0 && len(records) > 0 {
+			return records, p.name
+		}
+	}
+	return nil, ""
+}
+
+// Lists the length-prefixed records of a value; the value view's "records" format
+type recordsFormatter struct{}
+
+func (f recordsFormatter) format(value []byte) string { return f.formatKey(nil, value) }
+
+// Records decoded as values of key, so key mappings of the decoder chain apply
+func (recordsFormatter) formatKey(key, value []byte) string {
+	records, prefix := splitRecords(value)
+	if prefix == "" {
+		return fmt.Sprintf("(not length-prefixed records)\n\n%s", mixedContentDisplay(value))
+	}
+	var out strings.Builder
+	fmt.Fprintf(&out, "// %d records with %s length prefixes", len(records), prefix)
+	for i, record := range records {
+		fmt.Fprintf(&out, "\n[%d] %d bytes:", i, len(record))
+		if len(record) == 0 {
+			continue
+		}
+		if data, _, ok := decompressValue(record); ok {
+			record = data
+		}
+		text, _, _ := decodeWithChain(key, record) // Not the key's mapping, which may be this format
+		out.WriteString("\n  " + strings.ReplaceAll(text, "\n", "\n  "))
+	}
+	return out.String()
+}
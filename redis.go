@@ -0,0 +1,625 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// What a Redis file turned into: string keys to write or delete, plus what was left out
+type redisStats struct {
+	strings int            // String keys imported
+	deletes int            // Keys deleted by DEL/UNLINK in an append-only file
+	expired int            // Keys whose TTL had passed when the dump was read
+	skipped map[string]int // Other value types and commands, by name
+}
+
+func (s *redisStats) skip(what string) {
+	if s.skipped == nil {
+		s.skipped = make(map[string]int)
+	}
+	s.skipped[what]++
+}
+
+// "3 list, 1 hash"
+func (s *redisStats) skippedSummary() string {
+	names := make([]string, 0, len(s.skipped))
+	for name := range s.skipped {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("%d %s", s.skipped[name], name)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Receives the string keys of a Redis file in order; value is nil for deletes
+type redisSink func(redisDB int, key, value []byte) error
+
+// Read a Redis RDB dump, or an append-only file (with or without an RDB preamble)
+func readRedisFile(path string, keepExpired bool, stats *redisStats, sink redisSink) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	r := bufio.NewReaderSize(file, 64*1024)
+	magic, err := r.Peek(5)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if string(magic) == "REDIS" {
+		rdb := &rdbReader{r: r, keepExpired: keepExpired, stats: stats, sink: sink}
+		if err := rdb.read(); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	// An append-only file, or the commands after an AOF's RDB preamble
+	aof := &aofReader{r: r, stats: stats, sink: sink}
+	if err := aof.read(); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// RDB value types, from Redis's rdb.h
+var rdbTypeNames = map[byte]string{
+	1: "list", 2: "set", 3: "zset", 4: "hash", 5: "zset", 6: "module", 7: "module",
+	9: "hash", 10: "list", 11: "set", 12: "zset", 13: "hash", 14: "list", 15: "stream",
+	16: "hash", 17: "zset", 18: "list", 19: "stream", 20: "set", 21: "stream",
+}
+
+type rdbReader struct {
+	r           *bufio.Reader
+	keepExpired bool
+	stats       *redisStats
+	sink        redisSink
+	db          int
+}
+
+func (d *rdbReader) read() error {
+	header := make([]byte, 9)
+	if _, err := io.ReadFull(d.r, header); err != nil {
+		return fmt.Errorf("reading RDB header: %w", err)
+	}
+	version, err := strconv.Atoi(string(header[5:]))
+	if err != nil {
+		return fmt.Errorf("bad RDB header %q", header)
+	}
+
+	now := time.Now().UnixMilli()
+	expireAt := int64(-1)
+	for {
+		opcode, err := d.r.ReadByte()
+		if err != nil {
+			return fmt.Errorf("reading RDB: %w", err)
+		}
+		switch opcode {
+		case 0xFF: // EOF, followed by a checksum from version 5
+			if version >= 5 {
+				_, err = io.ReadFull(d.r, make([]byte, 8))
+			}
+			return err
+		case 0xFE: // SELECTDB
+			n, err := d.length()
+			if err != nil {
+				return err
+			}
+			d.db = int(n)
+		case 0xFD: // EXPIRETIME, seconds
+			var b [4]byte
+			if _, err := io.ReadFull(d.r, b[:]); err != nil {
+				return err
+			}
+			expireAt = int64(binary.LittleEndian.Uint32(b[:])) * 1000
+		case 0xFC: // EXPIRETIME_MS
+			var b [8]byte
+			if _, err := io.ReadFull(d.r, b[:]); err != nil {
+				return err
+			}
+			expireAt = int64(binary.LittleEndian.Uint64(b[:]))
+		case 0xFB: // RESIZEDB: hash table sizes
+			if err := d.skipLengths(2); err != nil {
+				return err
+			}
+		case 0xFA: // AUX field
+			if err := d.skipStrings(2); err != nil {
+				return err
+			}
+		case 0xF9: // FREQ
+			if _, err := d.r.ReadByte(); err != nil {
+				return err
+			}
+		case 0xF8: // IDLE
+			if err := d.skipLengths(1); err != nil {
+				return err
+			}
+		case 0xF5: // FUNCTION2: a function library's code
+			if err := d.skipStrings(1); err != nil {
+				return err
+			}
+		case 0xF4: // SLOT_INFO
+			if err := d.skipLengths(3); err != nil {
+				return err
+			}
+		case 0xF7: // MODULE_AUX
+			return errors.New("module data cannot be read without the module")
+		default:
+			key, err := d.str()
+			if err != nil {
+				return err
+			}
+			if opcode != 0 {
+				if err := d.skipValue(opcode); err != nil {
+					return fmt.Errorf("key %q: %w", key, err)
+				}
+				d.stats.skip(rdbTypeNames[opcode])
+			} else {
+				value, err := d.str()
+				if err != nil {
+					return fmt.Errorf("key %q: %w", key, err)
+				}
+				if expireAt >= 0 && expireAt <= now && !d.keepExpired {
+					d.stats.expired++
+				} else if err := d.sink(d.db, key, value); err != nil {
+					return err
+				}
+			}
+			expireAt = -1
+		}
+	}
+}
+
+// Length encoding; encoded is set for the special string encodings (11xxxxxx)
+func (d *rdbReader) lengthOrEncoding() (n uint64, encoded bool, err error) {
+	b, err := d.r.ReadByte()
+	if err != nil {
+		return 0, false, err
+	}
+	switch b >> 6 {
+	case 0:
+		return uint64(b & 0x3f), false, nil
+	case 1:
+		next, err := d.r.ReadByte()
+		return uint64(b&0x3f)<<8 | uint64(next), false, err
+	case 2:
+		var buf [8]byte
+		switch b {
+		case 0x80:
+			_, err = io.ReadFull(d.r, buf[:4])
+			return uint64(binary.BigEndian.Uint32(buf[:4])), false, err
+		case 0x81:
+			_, err = io.ReadFull(d.r, buf[:])
+			return binary.BigEndian.Uint64(buf[:]), false, err
+		}
+		return 0, false, fmt.Errorf("unknown length encoding %#x", b)
+	}
+	return uint64(b & 0x3f), true, nil
+}
+
+func (d *rdbReader) length() (uint64, error) {
+	n, encoded, err := d.lengthOrEncoding()
+	if err == nil && encoded {
+		err = errors.New("unexpected string encoding where a length belongs")
+	}
+	return n, err
+}
+
+// String in any of its encodings: raw, integer or LZF-compressed
+func (d *rdbReader) str() ([]byte, error) {
+	n, encoded, err := d.lengthOrEncoding()
+	if err != nil {
+		return nil, err
+	}
+	if !encoded {
+		return d.raw(n)
+	}
+	var buf [4]byte
+	switch n {
+	case 0:
+		b, err := d.r.ReadByte()
+		return []byte(strconv.Itoa(int(int8(b)))), err
+	case 1:
+		_, err := io.ReadFull(d.r, buf[:2])
+		return []byte(strconv.Itoa(int(int16(binary.LittleEndian.Uint16(buf[:2]))))), err
+	case 2:
+		_, err := io.ReadFull(d.r, buf[:])
+		return []byte(strconv.Itoa(int(int32(binary.LittleEndian.Uint32(buf[:]))))), err
+	case 3:
+		compressed, err := d.length()
+		if err != nil {
+			return nil, err
+		}
+		size, err := d.length()
+		if err != nil {
+			return nil, err
+		}
+		if compressed > maxDecompressedBytes || size > maxDecompressedBytes || size > lzfMaxRatio*compressed {
+			return nil, fmt.Errorf("LZF string claims %d bytes from %d compressed", size, compressed)
+		}
+		data, err := d.raw(compressed)
+		if err != nil {
+			return nil, err
+		}
+		return lzfDecompress(data, int(size))
+	}
+	return nil, fmt.Errorf("unknown string encoding %d", n)
+}
+
+func (d *rdbReader) raw(n uint64) ([]byte, error) {
+	if n > maxDecompressedBytes {
+		return nil, fmt.Errorf("string of %d bytes is too long", n)
+	}
+	return readUpTo(d.r, int64(n))
+}
+
+// Read n bytes, growing the buffer as they arrive rather than trusting a
+// length from the file; fewer is io.ErrUnexpectedEOF
+func readUpTo(r io.Reader, n int64) ([]byte, error) {
+	buf, err := io.ReadAll(io.LimitReader(r, n))
+	if err == nil && int64(len(buf)) < n {
+		err = io.ErrUnexpectedEOF
+	}
+	return buf, err
+}
+
+func (d *rdbReader) skipLengths(n int) error {
+	for ; n > 0; n-- {
+		if _, err := d.length(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *rdbReader) skipStrings(n uint64) error {
+	for ; n > 0; n-- {
+		if _, err := d.str(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *rdbReader) skipBytes(n int) error {
+	_, err := d.r.Discard(n)
+	return err
+}
+
+// Read past a value that is not a plain string
+func (d *rdbReader) skipValue(valueType byte) error {
+	switch valueType {
+	case 1, 2: // list, set
+		n, err := d.length()
+		if err != nil {
+			return err
+		}
+		return d.skipStrings(n)
+	case 3: // zset: member and string-encoded score
+		n, err := d.length()
+		if err != nil {
+			return err
+		}
+		for ; n > 0; n-- {
+			if err := d.skipStrings(1); err != nil {
+				return err
+			}
+			size, err := d.r.ReadByte()
+			if err != nil {
+				return err
+			}
+			if size < 253 { // 253-255 stand for NaN and infinities
+				if err := d.skipBytes(int(size)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	case 4: // hash
+		n, err := d.length()
+		if err != nil {
+			return err
+		}
+		return d.skipStrings(2 * n)
+	case 5: // zset with binary scores
+		n, err := d.length()
+		if err != nil {
+			return err
+		}
+		for ; n > 0; n-- {
+			if err := d.skipStrings(1); err != nil {
+				return err
+			}
+			if err := d.skipBytes(8); err != nil {
+				return err
+			}
+		}
+		return nil
+	case 9, 10, 11, 12, 13, 16, 17, 20: // Encoded as one blob
+		return d.skipStrings(1)
+	case 14: // quicklist of ziplists
+		n, err := d.length()
+		if err != nil {
+			return err
+		}
+		return d.skipStrings(n)
+	case 18: // quicklist of listpacks, each with a container type
+		n, err := d.length()
+		if err != nil {
+			return err
+		}
+		for ; n > 0; n-- {
+			if err := d.skipLengths(1); err != nil {
+				return err
+			}
+			if err := d.skipStrings(1); err != nil {
+				return err
+			}
+		}
+		return nil
+	case 15, 19, 21:
+		return d.skipStream(valueType)
+	}
+	return fmt.Errorf("cannot skip value type %d (%s); the dump needs a Redis module or a newer format", valueType, rdbTypeNames[valueType])
+}
+
+// Streams: listpack nodes, metadata, consumer groups with their pending entries and consumers
+func (d *rdbReader) skipStream(valueType byte) error {
+	nodes, err := d.length()
+	if err != nil {
+		return err
+	}
+	if err := d.skipStrings(2 * nodes); err != nil {
+		return err
+	}
+	meta := 3 // Length and last ID
+	if valueType >= 19 {
+		meta += 5 // First ID, max deleted ID, entries added
+	}
+	if err := d.skipLengths(meta); err != nil {
+		return err
+	}
+
+	groups, err := d.length()
+	if err != nil {
+		return err
+	}
+	for ; groups > 0; groups-- {
+		if err := d.skipStrings(1); err != nil {
+			return err
+		}
+		fields := 2 // Last delivered ID
+		if valueType >= 19 {
+			fields++ // Entries read
+		}
+		if err := d.skipLengths(fields); err != nil {
+			return err
+		}
+		pending, err := d.length()
+		if err != nil {
+			return err
+		}
+		for ; pending > 0; pending-- {
+			// Entry ID and delivery time, then the delivery count
+			if err := d.skipBytes(16 + 8); err != nil {
+				return err
+			}
+			if err := d.skipLengths(1); err != nil {
+				return err
+			}
+		}
+		consumers, err := d.length()
+		if err != nil {
+			return err
+		}
+		for ; consumers > 0; consumers-- {
+			if err := d.skipStrings(1); err != nil {
+				return err
+			}
+			times := 8 // Seen time
+			if valueType >= 21 {
+				times += 8 // Active time
+			}
+			if err := d.skipBytes(times); err != nil {
+				return err
+			}
+			owned, err := d.length()
+			if err != nil {
+				return err
+			}
+			if err := d.skipBytes(int(owned) * 16); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// A back reference of 3 bytes copies at most 264, so no LZF data expands further
+const lzfMaxRatio = 88
+
+// LZF as used by Redis for compressed strings
+func lzfDecompress(in []byte, size int) ([]byte, error) {
+	if size < 0 || size > maxDecompressedBytes || size > lzfMaxRatio*len(in) {
+		return nil, fmt.Errorf("LZF data cannot decompress to %d bytes", size)
+	}
+	out := make([]byte, 0, size)
+	for i := 0; i < len(in); {
+		ctrl := int(in[i])
+		i++
+		if ctrl < 32 {
+			// Literal run of ctrl+1 bytes
+			n := ctrl + 1
+			if i+n > len(in) {
+				return nil, errors.New("corrupt LZF data")
+			}
+			if len(out)+n > size {
+				return nil, fmt.Errorf("LZF data decompresses past %d bytes", size)
+			}
+			out = append(out, in[i:i+n]...)
+			i += n
+			continue
+		}
+		// Back reference
+		n := ctrl >> 5
+		if n == 7 {
+			if i >= len(in) {
+				return nil, errors.New("corrupt LZF data")
+			}
+			n += int(in[i])
+			i++
+		}
+		n += 2
+		if i >= len(in) {
+			return nil, errors.New("corrupt LZF data")
+		}
+		ref := len(out) - (ctrl&0x1f)<<8 - int(in[i]) - 1
+		i++
+		if ref < 0 {
+			return nil, errors.New("corrupt LZF data")
+		}
+		if len(out)+n > size {
+			return nil, fmt.Errorf("LZF data decompresses past %d bytes", size)
+		}
+		for j := 0; j < n; j++ {
+			out = append(out, out[ref+j])
+		}
+	}
+	if len(out) != size {
+		return nil, fmt.Errorf("LZF data decompressed to %d bytes, want %d", len(out), size)
+	}
+	return out, nil
+}
+
+// SET command in RESP, the format of append-only files and of redis-cli --pipe input
+func respSet(key, value []byte) []byte {
+	record := make([]byte, 0, len(key)+len(value)+40)
+	record = append(record, "*3\r\n$3\r\nSET\r\n"...)
+	for _, arg := range [][]byte{key, value} {
+		record = append(record, '$')
+		record = strconv.AppendInt(record, int64(len(arg)), 10)
+		record = append(record, "\r\n"...)
+		record = append(record, arg...)
+		record = append(record, "\r\n"...)
+	}
+	return record
+}
+
+// Commands of an append-only file, in RESP
+type aofReader struct {
+	r     *bufio.Reader
+	stats *redisStats
+	sink  redisSink
+	db    int
+}
+
+func (a *aofReader) read() error {
+	for {
+		args, err := a.command()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(args) == 0 {
+			continue
+		}
+		if err := a.apply(strings.ToUpper(string(args[0])), args[1:]); err != nil {
+			return err
+		}
+	}
+}
+
+// One "*<n>" array of "$<len>" bulk strings
+func (a *aofReader) command() ([][]byte, error) {
+	line, err := a.line()
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, nil
+	}
+	if line[0] != '*' {
+		return nil, fmt.Errorf("expected a RESP array, got %q", line)
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("bad RESP array header %q", line)
+	}
+	var args [][]byte // Grown as the arguments arrive, whatever the header claims
+	for i := 0; i < n; i++ {
+		header, err := a.line()
+		if err != nil {
+			return nil, noEOF(err)
+		}
+		size, err := strconv.Atoi(strings.TrimPrefix(header, "$"))
+		if !strings.HasPrefix(header, "$") || err != nil || size < 0 || size > maxDecompressedBytes {
+			return nil, fmt.Errorf("bad RESP bulk string header %q", header)
+		}
+		arg, err := readUpTo(a.r, int64(size)+2)
+		if err != nil {
+			return nil, noEOF(err)
+		}
+		args = append(args, arg[:size])
+	}
+	return args, nil
+}
+
+func (a *aofReader) line() (string, error) {
+	line, err := a.r.ReadString('\n')
+	if err == io.EOF && line != "" {
+		return "", io.ErrUnexpectedEOF
+	}
+	return strings.TrimRight(line, "\r\n"), err
+}
+
+// A truncated command is an error, not the end of the file
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func (a *aofReader) apply(command string, args [][]byte) error {
+	switch {
+	case command == "SELECT" && len(args) == 1:
+		db, err := strconv.Atoi(string(args[0]))
+		if err != nil {
+			return fmt.Errorf("bad SELECT %q", args[0])
+		}
+		a.db = db
+	case (command == "SET" || command == "SETNX" || command == "GETSET") && len(args) >= 2:
+		return a.sink(a.db, args[0], args[1])
+	case (command == "SETEX" || command == "PSETEX") && len(args) == 3:
+		return a.sink(a.db, args[0], args[2])
+	case (command == "MSET" || command == "MSETNX") && len(args)%2 == 0:
+		for i := 0; i < len(args); i += 2 {
+			if err := a.sink(a.db, args[i], args[i+1]); err != nil {
+				return err
+			}
+		}
+	case command == "DEL" || command == "UNLINK":
+		for _, key := range args {
+			if err := a.sink(a.db, key, nil); err != nil {
+				return err
+			}
+		}
+	case command == "MULTI" || command == "EXEC":
+		// Transactions are replayed command by command
+	default:
+		a.stats.skip(command)
+	}
+	return nil
+}
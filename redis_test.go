@@ -0,0 +1,143 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Import data from a Redis file written to a temporary directory, as "db:key=value" lines
+func readRedisString(t *testing.T, data string) ([]string, *redisStats, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "dump")
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	stats := &redisStats{}
+	err := readRedisFile(path, false, stats, func(redisDB int, key, value []byte) error {
+		if value == nil {
+			got = append(got, string(rune('0'+redisDB))+":del "+string(key))
+		} else {
+			got = append(got, string(rune('0'+redisDB))+":"+string(key)+"="+string(value))
+		}
+		return nil
+	})
+	return got, stats, err
+}
+
+const rdbChecksum = "\xff\x00\x00\x00\x00\x00\x00\x00\x00"
+
+func TestReadRedisFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    []string
+		skipped string
+	}{
+		{"empty rdb", "REDIS0009" + rdbChecksum, nil, ""},
+		{"string", "REDIS0009\x00\x01k\x01v" + rdbChecksum, []string{"0:k=v"}, ""},
+		{"integer encodings", "REDIS0009\x00\x01a\xc0\xff\x00\x01b\xc1\x10\x27\x00\x01c\xc2\x00\x00\x00\x80" + rdbChecksum,
+			[]string{"0:a=-1", "0:b=10000", "0:c=-2147483648"}, ""},
+		{"lzf", "REDIS0009\x00\x01k\xc3\x05\x0a\x00a\xe0\x00\x00" + rdbChecksum, []string{"0:k=aaaaaaaaaa"}, ""},
+		{"select and aux", "REDIS0009\xfa\x09redis-ver\x057.2.0\xfe\x02\xfb\x01\x00\x00\x01k\x01v" + rdbChecksum, []string{"2:k=v"}, ""},
+		{"expired", "REDIS0009\xfc\x01\x00\x00\x00\x00\x00\x00\x00\x00\x01k\x01v\x00\x01l\x01w" + rdbChecksum, []string{"0:l=w"}, ""},
+		{"list skipped", "REDIS0009\x01\x01l\x02\x01a\x01b\x00\x01k\x01v" + rdbChecksum, []string{"0:k=v"}, "1 list"},
+		{"old version without checksum", "REDIS0004\x00\x01k\x01v\xff", []string{"0:k=v"}, ""},
+		{"aof", "*2\r\n$6\r\nSELECT\r\n$1\r\n1\r\n*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$1\r\nv\r\n*2\r\n$3\r\nDEL\r\n$1\r\nk\r\n*2\r\n$4\r\nINCR\r\n$1\r\nn\r\n",
+			[]string{"1:k=v", "1:del k"}, "1 INCR"},
+		{"aof with rdb preamble", "REDIS0009\x00\x01a\x011" + rdbChecksum + "*3\r\n$3\r\nSET\r\n$1\r\nb\r\n$1\r\n2\r\n",
+			[]string{"0:a=1", "0:b=2"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, stats, err := readRedisString(t, tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !equalStrings(got, tt.want) {
+				t.Errorf("keys = %q, want %q", got, tt.want)
+			}
+			if summary := stats.skippedSummary(); summary != tt.skipped {
+				t.Errorf("skipped %q, want %q", summary, tt.skipped)
+			}
+		})
+	}
+}
+
+// Truncated and hostile files fail with an error instead of panicking or
+// allocating what their lengths claim
+func TestReadRedisFileMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"truncated header", "REDIS00", "RDB header"},
+		{"bad version", "REDISxxxx" + rdbChecksum, "bad RDB header"},
+		{"missing eof", "REDIS0009\x00\x01k\x01v", "reading RDB"},
+		{"truncated key", "REDIS0009\x00\x05ab", "unexpected EOF"},
+		{"truncated value", "REDIS0009\x00\x01k\x40\x10ab", "unexpected EOF"},
+		{"huge lzf size", "REDIS0009\x00\x01k\xc3\x01\x81\xff\xff\xff\xff\xff\xff\xff\xff\x00\xff", "LZF string claims"},
+		{"lzf size beyond ratio", "REDIS0009\x00\x01k\xc3\x01\x80\x00\x01\x00\x00\x00" + rdbChecksum, "LZF string claims"},
+		{"huge lzf input", "REDIS0009\x00\x01k\xc3\x81\xff\xff\xff\xff\xff\xff\xff\xff\x01\x00", "LZF string claims"},
+		{"huge string", "REDIS0009\x00\x01k\x81\xff\xff\xff\xff\xff\xff\xff\xff", "too long"},
+		{"string longer than file", "REDIS0009\x00\x01k\x80\x01\x00\x00\x00abc", "unexpected EOF"},
+		{"lzf wrong size", "REDIS0009\x00\x01k\xc3\x05\x0b\x00a\xe0\x00\x00" + rdbChecksum, "want 11"},
+		{"lzf back reference before start", "REDIS0009\x00\x01k\xc3\x03\x05\x20\x00\x00" + rdbChecksum, "corrupt LZF"},
+		{"unknown length encoding", "REDIS0009\x00\x01k\x82" + rdbChecksum, "unknown length encoding"},
+		{"module aux", "REDIS0009\xf7", "module data"},
+		{"unknown value type", "REDIS0009\x63\x01k" + rdbChecksum, "cannot skip value type"},
+		{"aof not resp", "SET k v\r\n", "expected a RESP array"},
+		{"aof huge array", "*9223372036854775807\r\n", "unexpected EOF"},
+		{"aof huge bulk string", "*1\r\n$9223372036854775805\r\n", "bad RESP bulk string header"},
+		{"aof negative bulk string", "*1\r\n$-1\r\n", "bad RESP bulk string header"},
+		{"aof bulk string longer than file", "*1\r\n$100\r\nabc\r\n", "unexpected EOF"},
+		{"aof truncated command", "*3\r\n$3\r\nSET\r\n", "unexpected EOF"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := readRedisString(t, tt.data)
+			if err == nil {
+				t.Fatalf("read %q without error, want one containing %q", tt.data, tt.want)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error %q, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLZFDecompress(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		size    int
+		want    string
+		wantErr bool
+	}{
+		{"literal", "\x02abc", 3, "abc", false},
+		{"short back reference", "\x00a\x20\x00", 4, "aaaa", false},
+		{"long back reference", "\x00a\xe0\x00\x00", 10, "aaaaaaaaaa", false},
+		{"empty", "", 0, "", false},
+		{"literal past input", "\x05ab", 6, "", true},
+		{"missing offset", "\x00a\x20", 4, "", true},
+		{"missing length", "\x00a\xe0", 10, "", true},
+		{"reference before start", "\x20\x00", 3, "", true},
+		{"output past size", "\x00a\xe0\x00\x00", 5, "", true},
+		{"negative size", "\x00a", -1, "", true},
+		{"size beyond ratio", "\x00a", 1000, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := lzfDecompress([]byte(tt.in), tt.size)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("lzfDecompress(%q, %d) error = %v, want error %v", tt.in, tt.size, err, tt.wantErr)
+			}
+			if string(got) != tt.want {
+				t.Errorf("lzfDecompress(%q, %d) = %q, want %q", tt.in, tt.size, got, tt.want)
+			}
+		})
+	}
+}
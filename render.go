@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/rivo/tview"
+)
+
+// Limits that keep hostile or huge values from hanging or corrupting the terminal
+const (
+	maxLineRunes   = 2000    // Longer lines are cut with a marker
+	maxRenderBytes = 1 << 20 // Text beyond this is not rendered at all
+	maxCombining   = 4       // Combining marks kept per base character
+)
+
+// Make text safe for a dynamic-color view: strip terminal escape sequences,
+// replace control and bidi characters, tame combining-mark floods, cap line
+// length and total size, and escape tview color tags.
+func sanitizeForDisplay(text string) string {
+	text = stripTerminalEscapes(text)
+
+	var out strings.Builder
+	lineRunes, combining := 0, 0
+	lineCut := false
+	// Ranging over the string already turns invalid UTF-8 into U+FFFD
+	for i, r := range text {
+		if out.Len() >= maxRenderBytes {
+			fmt.Fprintf(&out, "\n… %d more bytes not shown", len(text)-i)
+			break
+		}
+
+		if r == '\n' {
+			out.WriteByte('\n')
+			lineRunes, combining, lineCut = 0, 0, false
+			continue
+		}
+		if lineCut {
+			continue
+		}
+		if lineRunes >= maxLineRunes {
+			out.WriteString(" … (line truncated)")
+			lineCut = true
+			continue
+		}
+
+		switch {
+		case r == '\t':
+		case unicode.In(r, unicode.Mn, unicode.Me):
+			combining++
+			if combining > maxCombining {
+				continue
+			}
+		case unicode.IsControl(r) || unicode.Is(unicode.Bidi_Control, r):
+			r = unicode.ReplacementChar
+			combining = 0
+		default:
+			combining = 0
+		}
+
+		out.WriteRune(r)
+		lineRunes++
+	}
+
+	return tview.Escape(out.String())
+}
+
+// How keys are shown, cycled with y. hex and base64 use the 0x and b64:
+// forms accepted by the search box, so a shown key can be searched for.
+// uint-le and uint-be show the integer a key ends in as #number.
+var keyRenderings = []string{"raw", "escaped", "hex", "base64", "uint-le", "uint-be", "tree"}
+
+var keyRendering = 0 // Index into keyRenderings
+
+// Single-line, display-safe rendering of a key for lists, titles and status messages
+func displayKey(key []byte) string {
+	switch keyRenderings[keyRendering] {
+	case "escaped":
+		quoted := strconv.Quote(string(key))
+		return sanitizeForDisplay(quoted[1 : len(quoted)-1])
+	case "hex":
+		return "0x" + hex.EncodeToString(key)
+	case "base64":
+		return "b64:" + base64.StdEncoding.EncodeToString(key)
+	case "uint-le", "uint-be":
+		return formatNumericKey(key, keyRenderings[keyRendering] == "uint-be")
+	}
+	if indexedDB {
+		if text, ok := formatIDBKey(key); ok {
+			return sanitizeForDisplay(text)
+		}
+	}
+	if bedrockWorld {
+		if text, ok := formatBedrockKey(key); ok {
+			return sanitizeForDisplay(text)
+		}
+	}
+	if gethMode {
+		if text, ok := formatGethKey(key); ok {
+			return sanitizeForDisplay(text)
+		}
+	}
+	if ipfsMode {
+		if text, ok := formatIPFSKey(key); ok {
+			return sanitizeForDisplay(text)
+		}
+	}
+	if decoded, ok := decodeKey(key); ok {
+		return sanitizeForDisplay(decoded)
+	}
+	if head, id, ok := splitTrailingID(key); ok {
+		return sanitizeForDisplay(string(head)) + formatID(id)
+	}
+	return sanitizeForDisplay(strings.NewReplacer("\r", "↵", "\n", "↵").Replace(string(key)))
+}
+
+// Text of row i of the key list; in the tree rendering, a key fitting a key
+// decoder is shown as a branch of the key above it when they share parts
+func listKeyText(i int) string {
+	key := displayedKeys[i]
+	if keyRenderings[keyRendering] == "tree" && i > 0 {
+		if text, ok := treeKeyText(displayedKeys[i-1], key); ok {
+			return sanitizeForDisplay(text)
+		}
+	}
+	return displayKey(key)
+}
+
+func setKeyRendering(name string) error {
+	for i, rendering := range keyRenderings {
+		if rendering == name {
+			keyRendering = i
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown key rendering %q, want one of %s", name, strings.Join(keyRenderings, ", "))
+}
+
+func setKeyRenderingAndRedraw(name string) error {
+	if err := setKeyRendering(name); err != nil {
+		return err
+	}
+	rebuildKeyList(keyList.GetCurrentItem())
+	refreshPendingView()
+	return nil
+}
+
+// Show keys in the next rendering everywhere: list, value header, panels
+func cycleKeyRendering() {
+	keyRendering = (keyRendering + 1) % len(keyRenderings)
+	rebuildKeyList(keyList.GetCurrentItem())
+	refreshPendingView()
+	setStatus(fmt.Sprintf("[green]Key rendering: %s", keyRenderings[keyRendering]))
+}
+
+// Remove ANSI/VT escape sequences (CSI, OSC, DCS and friends, in both 7-bit and C1 form)
+func stripTerminalEscapes(text string) string {
+	if !strings.ContainsAny(text, "\x1b\u009b\u009d\u0090\u0098\u009e\u009f") {
+		return text
+	}
+
+	var out strings.Builder
+	runes := []rune(text)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		kind := rune(0)
+		switch r {
+		case 0x1b:
+			if i+1 >= len(runes) {
+				continue
+			}
+			i++
+			switch runes[i] {
+			case '[':
+				kind = '['
+			case ']', 'P', 'X', '^', '_':
+				kind = ']'
+			default:
+				// Two-character escape such as ESC c (full reset)
+				continue
+			}
+		case 0x9b:
+			kind = '['
+		case 0x9d, 0x90, 0x98, 0x9e, 0x9f:
+			kind = ']'
+		default:
+			out.WriteRune(r)
+			continue
+		}
+
+		if kind == '[' {
+			// CSI: parameter and intermediate bytes, then one final byte in 0x40-0x7e
+			for i+1 < len(runes) {
+				i++
+				if runes[i] >= 0x40 && runes[i] <= 0x7e {
+					break
+				}
+			}
+			continue
+		}
+
+		// String sequence: terminated by BEL, ST (ESC \) or C1 ST
+		for i+1 < len(runes) {
+			i++
+			if runes[i] == 0x07 || runes[i] == 0x9c {
+				break
+			}
+			if runes[i] == 0x1b && i+1 < len(runes) && runes[i+1] == '\\' {
+				i++
+				break
+			}
+		}
+	}
+	return out.String()
+}
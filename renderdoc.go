@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// The render command writes one key's value, decoded and annotated as the
+// value view shows it, to a standalone HTML or Markdown file for tickets
+// and wikis. The view's color tags become styled spans in HTML and are
+// dropped in Markdown.
+
+// Text escaped by tview.Escape ("[x[]" shows as "[x]") or a style tag such as [red], [-] or [::b]
+var viewTagPattern = regexp.MustCompile(`(\[[a-zA-Z0-9_,;: \-\."#]+\[*)\[\]|\[([a-zA-Z]+|#[0-9a-fA-F]{6}|-)?(?::([a-zA-Z]+|#[0-9a-fA-F]{6}|-)?(?::([lbiudrs]+|-)?)?)?\]`)
+
+// Colors of the view's tags on the document's dark background
+var viewTagColors = map[string]string{
+	"white": "#ffffff", "gray": "#8a8a8a", "grey": "#8a8a8a", "red": "#ff5f5f", "green": "#5fd75f",
+	"yellow": "#ffd75f", "blue": "#5f87ff", "cyan": "#5fd7d7", "orange": "#ffaf5f", "purple": "#d75fd7",
+}
+
+// Split tagged view text into its runs of text, calling fn with each run
+// and the foreground color ("" for the default) and boldness it is shown in
+func walkViewText(text string, fn func(run, color string, bold bool)) {
+	color, bold := "", false
+	for len(text) > 0 {
+		loc := viewTagPattern.FindStringSubmatchIndex(text)
+		if loc == nil {
+			fn(text, color, bold)
+			return
+		}
+		if loc[0] > 0 {
+			fn(text[:loc[0]], color, bold)
+		}
+		match := text[loc[0]:loc[1]]
+		switch {
+		case loc[2] >= 0: // Escaped brackets
+			fn(text[loc[2]:loc[3]]+"]", color, bold)
+		case match == "[]":
+			fn(match, color, bold)
+		default:
+			if loc[4] >= 0 {
+				color = text[loc[4]:loc[5]]
+			}
+			if loc[8] >= 0 {
+				bold = strings.Contains(text[loc[8]:loc[9]], "b")
+			}
+		}
+		text = text[loc[1]:]
+	}
+}
+
+// View text without its tags
+func plainViewText(text string) string {
+	var out strings.Builder
+	walkViewText(text, func(run, _ string, _ bool) { out.WriteString(run) })
+	return out.String()
+}
+
+// View text as HTML, its tags turned into styled spans
+func htmlViewText(text string) string {
+	var out strings.Builder
+	walkViewText(text, func(run, color string, bold bool) {
+		var style string
+		if hex, ok := viewTagColors[color]; ok {
+			style = "color:" + hex + ";"
+		} else if strings.HasPrefix(color, "#") {
+			style = "color:" + color + ";"
+		}
+		if bold {
+			style += "font-weight:bold;"
+		}
+		if style == "" {
+			out.WriteString(html.EscapeString(run))
+			return
+		}
+		fmt.Fprintf(&out, "<span style=\"%s\">%s</span>", style, html.EscapeString(run))
+	})
+	return out.String()
+}
+
+// Header and value of key as the value view shows them, without paging
+func renderKeyValue(key []byte) (header, value string, err error) {
+	data, err := getValue(key)
+	if err != nil {
+		return "", "", err
+	}
+	header = valueHeader(key, data)
+	if len(data) == 0 {
+		return header, "(empty)", nil
+	}
+	for _, note := range bitFieldHeaderNotes(key, data) {
+		header += "\n" + note
+	}
+	pageSize := valuePageSize
+	valuePageSize = 0
+	defer func() { valuePageSize = pageSize }()
+	header, value = decodeForView(key, data, header)
+	return header, sanitizeForDisplay(value), nil
+}
+
+// Fence language of the decoded value, for highlighting by wikis
+func markdownValueLanguage() string {
+	switch viewDecoder {
+	case "json", "msgpack", "cbor", "bson", "protobuf", "avro", "v8":
+		return "json"
+	}
+	return ""
+}
+
+func markdownValueDocument(key []byte, header, value string) string {
+	var out strings.Builder
+	fmt.Fprintf(&out, "# `%s`\n\n", strings.ReplaceAll(mixedContentDisplay(key), "`", "'"))
+	fmt.Fprintf(&out, "Database `%s`, rendered %s.\n\n", dbPath, time.Now().Format("2006-01-02 15:04"))
+	for _, line := range strings.Split(plainViewText(header), "\n") {
+		fmt.Fprintf(&out, "- %s\n", line)
+	}
+	value = plainViewText(value)
+	fence := codeFence(value)
+	fmt.Fprintf(&out, "\n%s%s\n%s\n%s\n", fence, markdownValueLanguage(), value, fence)
+	return out.String()
+}
+
+func htmlValueDocument(key []byte, header, value string) string {
+	var out strings.Builder
+	title := html.EscapeString(mixedContentDisplay(key))
+	fmt.Fprintf(&out, "<!DOCTYPE html>\n<html><head><meta charset=\"utf-8\"><title>%s</title>\n", title)
+	out.WriteString("<style>body{font-family:sans-serif;max-width:60em;margin:auto}" +
+		"pre{background:#1c1c1c;color:#d0d0d0;padding:.5em;overflow-x:auto}</style>\n</head><body>\n")
+	fmt.Fprintf(&out, "<h1><code>%s</code></h1>\n<p>Database <code>%s</code>, rendered %s.</p>\n",
+		title, html.EscapeString(dbPath), time.Now().Format("2006-01-02 15:04"))
+	fmt.Fprintf(&out, "<pre>%s\n\n%s</pre>\n", htmlViewText(header), htmlViewText("[white]Value[::-]: "+value))
+	out.WriteString("</body></html>\n")
+	return out.String()
+}
+
+// Write key's rendered value as Markdown ("md") or HTML ("html") into dir
+func writeValueDocument(key []byte, format, dir string) (string, error) {
+	if format != "md" && format != "html" {
+		return "", fmt.Errorf("unknown render format %q, want md or html", format)
+	}
+	header, value, err := renderKeyValue(key)
+	if err != nil {
+		return "", err
+	}
+
+	content := markdownValueDocument(key, header, value)
+	if format == "html" {
+		content = htmlValueDocument(key, header, value)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("creating directory: %w", err)
+	}
+	path := filepath.Join(dir, "render_"+time.Now().Format(exportTimeLayout)+"."+format)
+	return path, os.WriteFile(path, []byte(content), 0644)
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+// Keeping an inspection copy in sync with a live database: every round
+// reads a snapshot of the source (a copy of its files when a running app
+// holds its lock), diffs it against the target like the diff command and
+// writes the differences to the target, so the target ends up equal to
+// the source as of the snapshot.
+
+const replicationBatch = 1000 // Changes written to the target per batch
+
+// What one round applied to the target
+type replicationRound struct {
+	started time.Time // When the source was read; the target matches it as of then
+	puts    int
+	deletes int
+	took    time.Duration
+	copied  bool // The source was locked and read from a copy
+}
+
+// Newest modification time among the files of dir
+func newestModification(dir string) time.Time {
+	var newest time.Time
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return newest
+	}
+	for _, entry := range entries {
+		if info, err := entry.Info(); err == nil && info.Mode().IsRegular() && info.ModTime().After(newest) {
+			newest = info.ModTime()
+		}
+	}
+	return newest
+}
+
+// Open the source read-only, or a temporary copy of it when another process
+// holds its lock; cleanup closes it and removes the copy
+func openReplicationSource(path string) (*leveldb.DB, bool, func(), error) {
+	options := &opt.Options{ReadOnly: true}
+	source, err := leveldb.OpenFile(path, options)
+	if err == nil {
+		return source, false, func() { source.Close() }, nil
+	}
+	if !isLockError(err) {
+		return nil, false, nil, err
+	}
+	tmp, err := copyDatabaseDir(path)
+	if err != nil {
+		return nil, false, nil, err
+	}
+	if source, err = leveldb.OpenFile(tmp, options); err != nil {
+		os.RemoveAll(tmp)
+		return nil, false, nil, err
+	}
+	return source, true, func() { source.Close(); os.RemoveAll(tmp) }, nil
+}
+
+// Make target equal to the current state of the database at source
+func replicateOnce(source string, target database, fast bool, workers int) (replicationRound, error) {
+	round := replicationRound{started: time.Now()}
+	opened, copied, cleanup, err := openReplicationSource(source)
+	if err != nil {
+		return round, err
+	}
+	defer cleanup()
+	round.copied = copied
+	src := singleDB{opened}
+
+	var diffs diffSpill // Spills to disk past the -max-memory share
+	defer diffs.close()
+	if fast {
+		var boundaries [][]byte
+		var found []keyDiff
+		if boundaries, err = diffBoundaries(src, workers*8); err == nil {
+			found, err = parallelDiff(src, target, boundaries, workers, 0, func(int, int, int) {})
+		}
+		diffs.held, diffs.count = found, len(found)
+	} else {
+		var spillErr error
+		err = diffRange(src, target, nil, func(d keyDiff) bool {
+			spillErr = diffs.add(d)
+			return spillErr == nil
+		})
+		if err == nil {
+			err = spillErr
+		}
+	}
+	if err != nil {
+		return round, err
+	}
+
+	batch := new(leveldb.Batch)
+	var applyErr error
+	err = diffs.each(func(d keyDiff) bool {
+		if d.kind == '+' { // Only in the target: deleted from the source
+			batch.Delete(d.key)
+			round.deletes++
+		} else {
+			value, err := src.Get(d.key, nil)
+			if err != nil {
+				applyErr = fmt.Errorf("reading %s: %w", mixedContentDisplay(d.key), err)
+				return false
+			}
+			batch.Put(d.key, value)
+			round.puts++
+		}
+		if batch.Len() >= replicationBatch {
+			applyErr = target.Write(batch, nil)
+			batch.Reset()
+		}
+		return applyErr == nil
+	})
+	if err == nil {
+		err = applyErr
+	}
+	if err == nil && batch.Len() > 0 {
+		err = target.Write(batch, nil)
+	}
+	if err != nil {
+		return round, err
+	}
+	round.took = time.Since(round.started)
+	return round, nil
+}
+
+func cmdReplicate(args []string) int {
+	fs := flag.NewFlagSet("replicate", flag.ExitOnError)
+	interval := fs.Duration("interval", 5*time.Second, "Time between rounds")
+	once := fs.Bool("once", false, "Run one round and exit")
+	fast := fs.Bool("fast", false, "Find changes by hashing ranges in parallel, as diff -fast does")
+	workers := fs.Int("workers", runtime.NumCPU(), "Ranges hashed at once with -fast")
+	fs.Parse(args)
+	if fs.NArg() != 1 || *interval <= 0 || *workers < 1 {
+		return commandError("replicate")
+	}
+	if shardPattern != "" || indexedDB || bedrockWorld {
+		fmt.Fprintln(os.Stderr, "Error: replicate reads the -db directory itself and cannot be combined with -shards, -indexeddb or -bedrock")
+		return 2
+	}
+	source, err := filepath.Abs(dbPath)
+	if err != nil {
+		source = dbPath
+	}
+	targetPath, err := filepath.Abs(fs.Arg(0))
+	if err != nil {
+		targetPath = fs.Arg(0)
+	}
+	if targetPath == source {
+		fmt.Fprintln(os.Stderr, "Error: the target is the source database")
+		return 2
+	}
+
+	opened, err := leveldb.OpenFile(targetPath, nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening target: %v\n", err)
+		return 2
+	}
+	target := singleDB{opened}
+	defer target.Close()
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	for {
+		round, err := replicateOnce(source, target, *fast, *workers)
+		stamp := time.Now().Format(time.DateTime)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s round failed: %v\n", stamp, err)
+			if *once {
+				return 2
+			}
+		} else {
+			lag := "in sync"
+			if newestModification(source).After(round.started) {
+				lag = fmt.Sprintf("%s behind", time.Since(round.started).Round(time.Millisecond))
+			}
+			from := ""
+			if round.copied {
+				from = " (from a copy, the source is locked)"
+			}
+			fmt.Printf("%s applied %d puts and %d deletes in %s%s; target %s\n",
+				stamp, round.puts, round.deletes, round.took.Round(time.Millisecond), from, lag)
+			if *once {
+				return 0
+			}
+		}
+		select {
+		case <-time.After(*interval):
+		case <-interrupt:
+			return 0
+		}
+	}
+}
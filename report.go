@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// One key in a findings report
+type finding struct {
+	key      []byte
+	value    string // Formatted current value
+	found    bool
+	note     *keyNote
+	diffFrom string // Export the diff is against; empty when there is no diff
+	diff     []diffOp
+}
+
+// Bookmarked keys: every key with a note plus the keys marked in the list
+func bookmarkedKeys() [][]byte {
+	seen := make(map[string]bool)
+	notesMu.Lock()
+	for key := range notes {
+		seen[key] = true
+	}
+	notesMu.Unlock()
+	for key := range markedKeys {
+		seen[key] = true
+	}
+
+	keys := make([][]byte, 0, len(seen))
+	for key := range seen {
+		keys = append(keys, []byte(key))
+	}
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i], keys[j]) < 0 })
+	return keys
+}
+
+// Gather values, notes and the change since the newest export that has each key
+func collectFindings(keys [][]byte) ([]finding, error) {
+	findings := make([]finding, 0, len(keys))
+	for _, key := range keys {
+		versions, err := collectKeyVersions(key)
+		if err != nil {
+			return nil, err
+		}
+		f := finding{key: key, value: versions[0].value, found: versions[0].found}
+		if note, ok := noteFor(key); ok {
+			f.note = &note
+		}
+		for _, version := range versions[1:] {
+			if !version.found {
+				continue
+			}
+			if version.value != f.value {
+				f.diffFrom = version.label
+				f.diff = diffLines(strings.Split(version.value, "\n"), strings.Split(f.value, "\n"))
+			}
+			break
+		}
+		findings = append(findings, f)
+	}
+	return findings, nil
+}
+
+func markdownReport(findings []finding) string {
+	var out strings.Builder
+	fmt.Fprintf(&out, "# Findings: %s\n\n", filepath.Base(dbPath))
+	fmt.Fprintf(&out, "Database `%s`, generated %s, %d keys.\n", dbPath, time.Now().Format("2006-01-02 15:04"), len(findings))
+
+	for _, f := range findings {
+		fmt.Fprintf(&out, "\n## `%s`\n\n", strings.ReplaceAll(mixedContentDisplay(f.key), "`", "'"))
+		if f.note != nil {
+			fmt.Fprintf(&out, "> %s\n>\n> — %s, %s\n\n", strings.ReplaceAll(f.note.Text, "\n", "\n> "),
+				f.note.Author, f.note.Updated.Format("2006-01-02 15:04"))
+		}
+		if !f.found {
+			out.WriteString("Key not found in the database.\n")
+		} else {
+			fence := codeFence(f.value)
+			fmt.Fprintf(&out, "%s\n%s\n%s\n", fence, f.value, fence)
+		}
+		if f.diff != nil {
+			var diff strings.Builder
+			for _, op := range f.diff {
+				fmt.Fprintf(&diff, "%c%s\n", op.kind, op.text)
+			}
+			fence := codeFence(diff.String())
+			fmt.Fprintf(&out, "\nChanged since the export of %s:\n\n%sdiff\n%s%s\n", f.diffFrom, fence, diff.String(), fence)
+		}
+	}
+	return out.String()
+}
+
+// Backtick fence longer than any backtick run inside text
+func codeFence(text string) string {
+	longest, run := 0, 0
+	for _, r := range text {
+		if r == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	return strings.Repeat("`", max(3, longest+1))
+}
+
+func htmlReport(findings []finding) string {
+	var out strings.Builder
+	title := html.EscapeString("Findings: " + filepath.Base(dbPath))
+	fmt.Fprintf(&out, "<!DOCTYPE html>\n<html><head><meta charset=\"utf-8\"><title>%s</title>\n", title)
+	out.WriteString("<style>body{font-family:sans-serif;max-width:60em;margin:auto}pre{background:#f4f4f4;padding:.5em;overflow-x:auto}" +
+		"blockquote{border-left:3px solid #cc0;margin-left:0;padding-left:1em}.del{color:#b00}.add{color:#070}</style>\n</head><body>\n")
+	fmt.Fprintf(&out, "<h1>%s</h1>\n<p>Database <code>%s</code>, generated %s, %d keys.</p>\n",
+		title, html.EscapeString(dbPath), time.Now().Format("2006-01-02 15:04"), len(findings))
+
+	for _, f := range findings {
+		fmt.Fprintf(&out, "<h2><code>%s</code></h2>\n", html.EscapeString(mixedContentDisplay(f.key)))
+		if f.note != nil {
+			fmt.Fprintf(&out, "<blockquote>%s<br>— %s, %s</blockquote>\n",
+				strings.ReplaceAll(html.EscapeString(f.note.Text), "\n", "<br>"),
+				html.EscapeString(f.note.Author), f.note.Updated.Format("2006-01-02 15:04"))
+		}
+		if !f.found {
+			out.WriteString("<p>Key not found in the database.</p>\n")
+		} else {
+			fmt.Fprintf(&out, "<pre>%s</pre>\n", html.EscapeString(f.value))
+		}
+		if f.diff != nil {
+			fmt.Fprintf(&out, "<p>Changed since the export of %s:</p>\n<pre>", f.diffFrom)
+			for _, op := range f.diff {
+				line := html.EscapeString(string(op.kind) + op.text)
+				switch op.kind {
+				case '-':
+					fmt.Fprintf(&out, "<span class=\"del\">%s</span>\n", line)
+				case '+':
+					fmt.Fprintf(&out, "<span class=\"add\">%s</span>\n", line)
+				default:
+					out.WriteString(line + "\n")
+				}
+			}
+			out.WriteString("</pre>\n")
+		}
+	}
+	out.WriteString("</body></html>\n")
+	return out.String()
+}
+
+// Write a findings report for keys as Markdown ("md") or HTML ("html") into dir
+func writeFindingsReport(keys [][]byte, format, dir string) (string, error) {
+	if format != "md" && format != "html" {
+		return "", fmt.Errorf("unknown report format %q, want md or html", format)
+	}
+	findings, err := collectFindings(keys)
+	if err != nil {
+		return "", err
+	}
+
+	content := markdownReport(findings)
+	if format == "html" {
+		content = htmlReport(findings)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("creating directory: %w", err)
+	}
+	path := filepath.Join(dir, "findings_"+time.Now().Format(exportTimeLayout)+"."+format)
+	return path, os.WriteFile(path, []byte(content), 0644)
+}
+
+// Write a Markdown findings report of the bookmarked keys from the viewer
+func exportFindingsReport() {
+	if refuseHostAccess() {
+		return
+	}
+	keys := bookmarkedKeys()
+	if len(keys) == 0 {
+		setStatus("[yellow]No bookmarked keys; add notes with n or mark keys with space")
+		return
+	}
+	enqueueTask("Findings report", func(progress func(string)) (string, error) {
+		progress(fmt.Sprintf("%d keys", len(keys)))
+		path, err := writeFindingsReport(keys, "md", dumpDir)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Wrote report of %d keys to %s", len(keys), path), nil
+	})
+}
@@ -0,0 +1,612 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Key/value pair read back from a backup or export
+type archiveRecord struct {
+	key   []byte
+	value []byte
+}
+
+// Archive record compared with the open database: '+' new, '~' changed, '=' unchanged
+type restoreChange struct {
+	archiveRecord
+	currentSize int // Bytes of the value in the database, for changed and unchanged records
+	state       byte
+}
+
+// Call fn with every record accepted by keep of a backup database directory,
+// a text, NDJSON, dedup or RESP export, or the manifest of a sharded export,
+// one at a time. Text exports store formatted values, so their bytes are
+// reconstructed on a best-effort basis; NDJSON and RESP exports carry the
+// exact bytes. Backups and single exports come in key order, prefix shards
+// one after another.
+func scanArchive(path string, keep func(key []byte) bool, fn func(record archiveRecord) error) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	if info.IsDir() {
+		backup, err := leveldb.OpenFile(path, &opt.Options{ReadOnly: true})
+		if err != nil {
+			return err
+		}
+		defer backup.Close()
+
+		iter := backup.NewIterator(nil, nil)
+		defer iter.Release()
+		for iter.Next() {
+			if !keep(iter.Key()) {
+				continue
+			}
+			record := archiveRecord{
+				key:   append([]byte{}, iter.Key()...),
+				value: append([]byte{}, iter.Value()...),
+			}
+			if err := fn(record); err != nil {
+				return err
+			}
+		}
+		return iter.Error()
+	}
+
+	files := []string{path}
+	if strings.HasSuffix(path, ".manifest.json") {
+		if files, err = manifestFiles(path); err != nil {
+			return err
+		}
+	}
+	for _, file := range files {
+		var fnErr error
+		err := scanArchiveFile(file, func(key, value []byte) bool {
+			if keep(key) {
+				fnErr = fn(archiveRecord{key: key, value: value})
+			}
+			return fnErr == nil
+		})
+		if err != nil {
+			return err
+		}
+		if fnErr != nil {
+			return fnErr
+		}
+	}
+	return nil
+}
+
+// Read every record accepted by keep into memory, in key order; for the
+// restore view and three-way merges, which need them all at once
+func readArchive(path string, keep func(key []byte) bool) ([]archiveRecord, error) {
+	var records []archiveRecord
+	err := scanArchive(path, keep, func(record archiveRecord) error {
+		records = append(records, record)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Prefix shards are not globally ordered
+	sort.Slice(records, func(i, j int) bool { return bytes.Compare(records[i].key, records[j].key) < 0 })
+	return records, nil
+}
+
+// Call fn with the key and value of every record of one export file until it
+// returns false. Text exports give their values back as parseDisplayedValue reads them.
+func scanArchiveFile(file string, fn func(key, value []byte) bool) error {
+	switch {
+	case strings.HasSuffix(file, ".csv"):
+		return fmt.Errorf("%s: CSV exports cannot be restored, use text or NDJSON", file)
+	case strings.HasSuffix(file, ".ndjson"):
+		return scanNDJSONExport(file, fn)
+	case strings.HasSuffix(file, ".dedup"):
+		return scanDedupExport(file, fn)
+	case strings.HasSuffix(file, ".resp"):
+		stop := errors.New("stop")
+		err := readRedisFile(file, true, &redisStats{}, func(_ int, key, value []byte) error {
+			if value != nil && !fn(key, value) {
+				return stop
+			}
+			return nil
+		})
+		if err == stop {
+			return nil
+		}
+		return err
+	}
+	return scanTextExport(file, func(key, value string) bool {
+		return fn([]byte(key), parseDisplayedValue(value))
+	})
+}
+
+// Walk the records of a text export in order; fn returns false to stop early
+func scanTextExport(path string, fn func(key, value string) bool) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	separator := strings.Repeat("-", 80)
+	reader := bufio.NewReader(file)
+
+	inRecord := false
+	var key string
+	var value []string
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+
+		switch {
+		case !inRecord && strings.HasPrefix(line, "Key: "):
+			inRecord = true
+			key = strings.TrimPrefix(line, "Key: ")
+			value = value[:0]
+		case inRecord && line == separator:
+			// Drop the "Value: " prefix and the blank lines around the value
+			text := strings.Join(value, "\n")
+			text = strings.TrimPrefix(strings.TrimPrefix(text, "\n"), "Value: ")
+			inRecord = false
+			if !fn(key, strings.TrimSuffix(text, "\n")) {
+				return nil
+			}
+		case inRecord:
+			value = append(value, line)
+		}
+
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+// Shard files listed in an export manifest, resolved relative to it
+func manifestFiles(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var manifest exportManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("reading manifest: %w", err)
+	}
+	files := make([]string, 0, len(manifest.Shards))
+	for _, shard := range manifest.Shards {
+		files = append(files, filepath.Join(filepath.Dir(path), shard.File))
+	}
+	return files, nil
+}
+
+// Undo formatValue as far as possible: compact pretty-printed JSON and decode [b64:...] runs
+func parseDisplayedValue(text string) []byte {
+	if json.Valid([]byte(text)) {
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, []byte(text)); err == nil {
+			return compact.Bytes()
+		}
+	}
+	return decodeBinaryRuns(text)
+}
+
+// Turn the [b64:...] runs written by mixedContentDisplay back into bytes
+func decodeBinaryRuns(text string) []byte {
+	var value []byte
+	for {
+		start := strings.Index(text, "[b64:")
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(text[start:], ']')
+		if end < 0 {
+			break
+		}
+		decoded, err := base64.RawStdEncoding.DecodeString(text[start+5 : start+end])
+		if err != nil {
+			// Literal text that merely looks like a binary run
+			value = append(value, text[:start+end+1]...)
+		} else {
+			value = append(value, text[:start]...)
+			value = append(value, decoded...)
+		}
+		text = text[start+end+1:]
+	}
+	return append(value, text...)
+}
+
+// Compare an archive record with the current database contents
+func compareRecord(record archiveRecord) (restoreChange, error) {
+	change := restoreChange{archiveRecord: record, state: '+'}
+	current, err := db.Get(record.key, nil)
+	switch {
+	case err == leveldb.ErrNotFound:
+	case err != nil:
+		return change, err
+	case bytes.Equal(current, record.value):
+		change.currentSize, change.state = len(current), '='
+	default:
+		change.currentSize, change.state = len(current), '~'
+	}
+	return change, nil
+}
+
+// Compare archive records with the current database contents
+func planRestore(records []archiveRecord) ([]restoreChange, error) {
+	changes := make([]restoreChange, 0, len(records))
+	for _, record := range records {
+		change, err := compareRecord(record)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+// Writes new and changed records in batches of copyBatchSize
+type restoreWriter struct {
+	batch   leveldb.Batch
+	written int
+}
+
+func (w *restoreWriter) put(change restoreChange) error {
+	if change.state == '=' {
+		return nil
+	}
+	w.batch.Put(change.key, change.value)
+	valueLRU.remove(change.key)
+	if w.batch.Len() >= copyBatchSize {
+		return w.flush()
+	}
+	return nil
+}
+
+func (w *restoreWriter) flush() error {
+	if w.batch.Len() == 0 {
+		return nil
+	}
+	if err := db.Write(&w.batch, nil); err != nil {
+		return err
+	}
+	w.written += w.batch.Len()
+	w.batch.Reset()
+	return nil
+}
+
+// Write new and changed records in batches, returning how many were written
+func applyRestore(changes []restoreChange) (int, error) {
+	var w restoreWriter
+	for _, change := range changes {
+		if err := w.put(change); err != nil {
+			return w.written, err
+		}
+	}
+	err := w.flush()
+	return w.written, err
+}
+
+// Stream the records accepted by keep from an archive, comparing each with
+// the database and passing it to report; unless dryRun, new and changed
+// records are written in batches as they come. Returns how many were written.
+func restoreArchive(path string, keep func(key []byte) bool, dryRun bool, report func(change restoreChange)) (int, error) {
+	var w restoreWriter
+	err := scanArchive(path, keep, func(record archiveRecord) error {
+		if err := interrupted(); err != nil {
+			return err
+		}
+		change, err := compareRecord(record)
+		if err != nil {
+			return err
+		}
+		report(change)
+		if dryRun {
+			return nil
+		}
+		return w.put(change)
+	})
+	if err == nil {
+		err = w.flush()
+	}
+	return w.written, err
+}
+
+// Number of records a sharded export's manifest says it holds; false for other archives
+func manifestKeyCount(path string) (int, bool) {
+	if !strings.HasSuffix(path, ".manifest.json") {
+		return 0, false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, false
+	}
+	var manifest exportManifest
+	if json.Unmarshal(data, &manifest) != nil {
+		return 0, false
+	}
+	return manifest.Keys, true
+}
+
+// Read the archive's records accepted by keep again and compare them with
+// the keys the database holds in the restored range: all of it with all,
+// otherwise the given keys and the keys under the given prefixes
+func verifyRestore(from string, keep func(key []byte) bool, keys, prefixes []string, all bool) (*verifyReport, error) {
+	archive := func(fn func(key, value []byte) error) error {
+		return scanArchive(from, keep, func(record archiveRecord) error {
+			return fn(record.key, record.value)
+		})
+	}
+	restored := func(fn func(key, value []byte) error) error {
+		walkRange := func(r *util.Range) error {
+			iter := db.NewIterator(r, scanReadOptions)
+			defer iter.Release()
+			for iter.Next() {
+				scanRate.wait(iter.Key(), iter.Value())
+				if err := fn(iter.Key(), iter.Value()); err != nil {
+					return err
+				}
+			}
+			return iter.Error()
+		}
+		if all {
+			return walkRange(nil)
+		}
+		// Overlapping selectors list a key twice, which the copy side's digest map absorbs
+		for _, prefix := range prefixes {
+			if err := walkRange(util.BytesPrefix([]byte(prefix))); err != nil {
+				return err
+			}
+		}
+		for _, key := range keys {
+			value, err := db.Get([]byte(key), nil)
+			if err == leveldb.ErrNotFound {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if err := fn([]byte(key), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return verifyCopy(from, dbPath, archive, restored)
+}
+
+// Keep keys equal to one of keys or starting with one of prefixes
+func selectorFilter(keys, prefixes []string) func(key []byte) bool {
+	return func(key []byte) bool {
+		for _, k := range keys {
+			if string(key) == k {
+				return true
+			}
+		}
+		for _, p := range prefixes {
+			if bytes.HasPrefix(key, []byte(p)) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Newest export in the dump directory, used to prefill the restore dialog
+func latestExport() string {
+	files, _ := filepath.Glob(filepath.Join(dumpDir, "all_keys_*"))
+	latest := ""
+	for _, file := range files {
+		if strings.HasSuffix(file, ".txt") || strings.HasSuffix(file, ".ndjson") || strings.HasSuffix(file, ".dedup") || strings.HasSuffix(file, ".manifest.json") {
+			// Timestamped names sort chronologically
+			if file > latest {
+				latest = file
+			}
+		}
+	}
+	return latest
+}
+
+// Ask for an archive path, then open the selective restore view
+func showRestoreDialog() {
+	if refuseHostAccess() {
+		return
+	}
+	input := newDialogInput(" Archive: ")
+	input.SetText(latestExport())
+	input.SetBorder(true).SetTitle(" Restore from backup or export ")
+	input.SetTitleAlign(tview.AlignLeft)
+	input.SetTitleColor(tcell.ColorYellow)
+
+	input.SetDoneFunc(func(key tcell.Key) {
+		if key == tcell.KeyEsc {
+			closeDialog("restore-path")
+			return
+		}
+		if key != tcell.KeyEnter {
+			return
+		}
+
+		recordAction("restore", nil, input.GetText())
+		records, err := readArchive(input.GetText(), func([]byte) bool { return true })
+		if err != nil {
+			setStatus(fmt.Sprintf("[red]Error reading archive: %v", err))
+			return
+		}
+		changes, err := planRestore(records)
+		if err != nil {
+			setStatus(fmt.Sprintf("[red]Error: %v", err))
+			return
+		}
+		closeDialog("restore-path")
+		showRestoreView(changes)
+	})
+
+	showDialog("restore-path", input, 80, 3)
+}
+
+// List archive records with their state; pick keys or prefixes and write them back
+func showRestoreView(changes []restoreChange) {
+	selected := make([]bool, len(changes))
+
+	list := tview.NewList().SetWrapAround(false).ShowSecondaryText(false)
+	list.SetBorder(true)
+	list.SetTitleAlign(tview.AlignLeft)
+	list.SetTitleColor(tcell.ColorYellow)
+	list.SetBackgroundColor(tcell.ColorReset)
+	list.SetSelectedBackgroundColor(tcell.ColorWhite)
+	list.SetHighlightFullLine(true)
+
+	preview := tview.NewTextView()
+	preview.SetDynamicColors(true).SetBorder(true).SetTitle(" Current vs archive ")
+	preview.SetTitleColor(tcell.ColorYellow)
+	preview.SetTitleAlign(tview.AlignLeft)
+	preview.SetScrollable(true)
+	preview.SetBackgroundColor(tcell.ColorReset)
+	preview.SetTextColor(tcell.ColorWhite)
+
+	prefixInput := newDialogInput(" Select prefix: ")
+
+	itemText := func(i int) string {
+		mark := "[ ]"
+		if selected[i] {
+			mark = "[x[]"
+		}
+		color := map[byte]string{'+': "green", '~': "yellow", '=': "white"}[changes[i].state]
+		return fmt.Sprintf("%s [%s]%c[-] %s", mark, color, changes[i].state, displayKey(changes[i].key))
+	}
+	updateTitle := func() {
+		count := 0
+		for _, s := range selected {
+			if s {
+				count++
+			}
+		}
+		list.SetTitle(fmt.Sprintf(" Restore: %d records, %d selected (space: toggle, /: prefix, w: write, Esc: close) ", len(changes), count))
+	}
+	for i := range changes {
+		list.AddItem(itemText(i), "", 0, nil)
+	}
+	updateTitle()
+
+	showPreview := func(index int) {
+		if index < 0 || index >= len(changes) {
+			return
+		}
+		change := changes[index]
+		if change.state == '+' {
+			preview.SetText("[green]New key[-]\n\n" + sanitizeForDisplay(formatValue(change.value)))
+			return
+		}
+		var text strings.Builder
+		current, err := db.Get(change.key, nil)
+		if err != nil && err != leveldb.ErrNotFound {
+			preview.SetText(fmt.Sprintf("[red]Error: %v[-]", err))
+			return
+		}
+		for _, op := range diffLines(strings.Split(formatValue(current), "\n"), strings.Split(formatValue(change.value), "\n")) {
+			line := sanitizeForDisplay(op.text)
+			switch op.kind {
+			case '-':
+				text.WriteString("[red]- " + line + "[-]\n")
+			case '+':
+				text.WriteString("[green]+ " + line + "[-]\n")
+			default:
+				text.WriteString("  " + line + "\n")
+			}
+		}
+		preview.SetText(text.String()).ScrollToBeginning()
+	}
+	list.SetChangedFunc(func(index int, mainText string, secondaryText string, shortcut rune) {
+		showPreview(index)
+	})
+
+	layout := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(tview.NewFlex().
+			AddItem(list, 0, 1, true).
+			AddItem(preview, 0, 1, false), 0, 1, true)
+
+	closeRestore := func() {
+		pages.RemovePage("restore")
+		app.SetFocus(keyList)
+	}
+
+	prefixInput.SetDoneFunc(func(key tcell.Key) {
+		if key == tcell.KeyEnter && prefixInput.GetText() != "" {
+			prefix := []byte(prefixInput.GetText())
+			for i := range changes {
+				if bytes.HasPrefix(changes[i].key, prefix) {
+					selected[i] = true
+					list.SetItemText(i, itemText(i), "")
+				}
+			}
+			updateTitle()
+		}
+		layout.RemoveItem(prefixInput)
+		app.SetFocus(list)
+	})
+
+	list.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch {
+		case event.Key() == tcell.KeyEsc:
+			closeRestore()
+			return nil
+		case event.Rune() == ' ':
+			i := list.GetCurrentItem()
+			if i >= 0 && i < len(changes) {
+				selected[i] = !selected[i]
+				list.SetItemText(i, itemText(i), "")
+				updateTitle()
+			}
+			return nil
+		case event.Rune() == '/':
+			prefixInput.SetText("")
+			layout.AddItem(prefixInput, 1, 0, false)
+			app.SetFocus(prefixInput)
+			return nil
+		case event.Rune() == 'w' || event.Rune() == 'W':
+			if refuseWrite() {
+				return nil
+			}
+			var picked []restoreChange
+			for i, s := range selected {
+				if s {
+					picked = append(picked, changes[i])
+				}
+			}
+			written, err := applyRestore(picked)
+			repinSnapshot() // Batches written before an error show too
+			if err != nil {
+				setStatus(fmt.Sprintf("[red]Error restoring: %v", err))
+				return nil
+			}
+			closeRestore()
+			loadInitialKeys()
+			setStatus(fmt.Sprintf("[green]Restored %d keys (%d unchanged skipped)", written, len(picked)-written))
+			return nil
+		}
+		return event
+	})
+
+	pages.AddPage("restore", layout, true, true)
+	app.SetFocus(list)
+	showPreview(0)
+}
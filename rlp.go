@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// RLP, Ethereum's encoding of nested byte strings and lists. Structures
+// are rendered JSON-style with the field names of a schema: byte strings
+// as 0x hex, and fields of kind uint as decimal numbers.
+
+const rlpMaxDepth = 64
+
+var errRLPTruncated = errors.New("truncated RLP")
+
+type rlpItem struct {
+	isList bool
+	data   []byte    // Contents of a byte string
+	items  []rlpItem // Elements of a list
+}
+
+// Parse one item, returning the bytes after it
+func parseRLP(b []byte, depth int) (item rlpItem, rest []byte, err error) {
+	if depth > rlpMaxDepth {
+		return item, nil, errors.New("RLP nesting too deep")
+	}
+	if len(b) == 0 {
+		return item, nil, errRLPTruncated
+	}
+	prefix := b[0]
+	var size uint64
+	offset := 1
+	switch {
+	case prefix < 0x80:
+		return rlpItem{data: b[:1]}, b[1:], nil
+	case prefix < 0xb8:
+		size = uint64(prefix - 0x80)
+	case prefix < 0xc0, prefix >= 0xf8:
+		n := int(prefix - 0xb7)
+		if prefix >= 0xf8 {
+			n = int(prefix - 0xf7)
+		}
+		if len(b) < 1+n || b[1] == 0 {
+			return item, nil, errors.New("bad RLP length")
+		}
+		for _, c := range b[1 : 1+n] {
+			size = size<<8 | uint64(c)
+		}
+		offset += n
+	default:
+		size = uint64(prefix - 0xc0)
+	}
+	if size > uint64(len(b)-offset) {
+		return item, nil, errRLPTruncated
+	}
+	content, rest := b[offset:offset+int(size)], b[offset+int(size):]
+	if prefix < 0xc0 {
+		return rlpItem{data: content}, rest, nil
+	}
+	item.isList = true
+	for len(content) > 0 {
+		var element rlpItem
+		if element, content, err = parseRLP(content, depth+1); err != nil {
+			return item, nil, err
+		}
+		item.items = append(item.items, element)
+	}
+	return item, rest, nil
+}
+
+// Parse b as exactly one item
+func parseRLPValue(b []byte) (rlpItem, error) {
+	item, rest, err := parseRLP(b, 0)
+	if err == nil && len(rest) > 0 {
+		err = fmt.Errorf("%d bytes after the RLP value", len(rest))
+	}
+	return item, err
+}
+
+// Render item as kind: a schema of rlpSchemas, "[]<kind>" for a list of
+// them, "uint", or "" for any item
+func renderRLP(out *strings.Builder, item rlpItem, kind, indent string) {
+	if elementKind, ok := strings.CutPrefix(kind, "[]"); ok && item.isList {
+		renderRLPList(out, item.items, elementKind, indent)
+		return
+	}
+	if kind == "tx" {
+		renderRLPTransaction(out, item, indent)
+		return
+	}
+	if fields, ok := rlpSchemas[kind]; ok && item.isList {
+		renderRLPStruct(out, item.items, fields, indent)
+		return
+	}
+	switch {
+	case item.isList:
+		renderRLPList(out, item.items, "", indent)
+	case kind == "uint" && len(item.data) > 0:
+		out.WriteString(new(big.Int).SetBytes(item.data).String())
+	case kind == "uint":
+		out.WriteString("0")
+	default:
+		out.WriteString(`"0x` + hex.EncodeToString(item.data) + `"`)
+	}
+}
+
+func renderRLPList(out *strings.Builder, items []rlpItem, kind, indent string) {
+	if len(items) == 0 {
+		out.WriteString("[]")
+		return
+	}
+	out.WriteString("[")
+	for i, item := range items {
+		if i > 0 {
+			out.WriteString(",")
+		}
+		out.WriteString("\n" + indent + "  ")
+		renderRLP(out, item, kind, indent+"  ")
+	}
+	out.WriteString("\n" + indent + "]")
+}
+
+// Fields are "name" or "name:kind"; elements past the schema are named by index
+func renderRLPStruct(out *strings.Builder, items []rlpItem, fields []string, indent string) {
+	out.WriteString("{")
+	for i, item := range items {
+		name, kind := fmt.Sprint(i), ""
+		if i < len(fields) {
+			name, kind, _ = strings.Cut(fields[i], ":")
+		}
+		if i > 0 {
+			out.WriteString(",")
+		}
+		out.WriteString("\n" + indent + "  " + quoteJSONString(name) + ": ")
+		renderRLP(out, item, kind, indent+"  ")
+	}
+	if len(items) > 0 {
+		out.WriteString("\n" + indent)
+	}
+	out.WriteString("}")
+}
+
+// Legacy transactions are lists; typed ones (EIP-2718) are byte strings
+// holding the type and then the transaction's list
+func renderRLPTransaction(out *strings.Builder, item rlpItem, indent string) {
+	if item.isList {
+		renderRLPStruct(out, item.items, rlpSchemas["tx0"], indent)
+		return
+	}
+	if len(item.data) > 0 {
+		fields, known := rlpSchemas[fmt.Sprintf("tx%d", item.data[0])]
+		if inner, err := parseRLPValue(item.data[1:]); known && err == nil && inner.isList {
+			out.WriteString(fmt.Sprintf("{\n%s  \"type\": %d,\n%s  \"tx\": ", indent, item.data[0], indent))
+			renderRLPStruct(out, inner.items, fields, indent+"  ")
+			out.WriteString("\n" + indent + "}")
+			return
+		}
+	}
+	renderRLP(out, item, "", indent)
+}
+
+var rlpSchemas = map[string][]string{
+	"header": {"parentHash", "uncleHash", "coinbase", "stateRoot", "txHash", "receiptHash", "bloom", "difficulty:uint", "number:uint",
+		"gasLimit:uint", "gasUsed:uint", "time:uint", "extra", "mixDigest", "nonce", "baseFee:uint", "withdrawalsHash",
+		"blobGasUsed:uint", "excessBlobGas:uint", "parentBeaconRoot", "requestsHash"},
+	"body":       {"transactions:[]tx", "uncles:[]header", "withdrawals:[]withdrawal"},
+	"receipt":    {"status", "cumulativeGasUsed:uint", "logs:[]log"},
+	"log":        {"address", "topics", "data"},
+	"withdrawal": {"index:uint", "validator:uint", "address", "amount:uint"},
+	"account":    {"nonce:uint", "balance:uint", "storageRoot", "codeHash"},
+	"access":     {"address", "storageKeys"},
+	"auth":       {"chainId:uint", "address", "nonce:uint", "yParity:uint", "r", "s"},
+
+	// Transactions by type
+	"tx0": {"nonce:uint", "gasPrice:uint", "gas:uint", "to", "value:uint", "data", "v:uint", "r", "s"},
+	"tx1": {"chainId:uint", "nonce:uint", "gasPrice:uint", "gas:uint", "to", "value:uint", "data", "accessList:[]access", "yParity:uint", "r", "s"},
+	"tx2": {"chainId:uint", "nonce:uint", "maxPriorityFeePerGas:uint", "maxFeePerGas:uint", "gas:uint", "to", "value:uint", "data",
+		"accessList:[]access", "yParity:uint", "r", "s"},
+	"tx3": {"chainId:uint", "nonce:uint", "maxPriorityFeePerGas:uint", "maxFeePerGas:uint", "gas:uint", "to", "value:uint", "data",
+		"accessList:[]access", "maxFeePerBlobGas:uint", "blobVersionedHashes", "yParity:uint", "r", "s"},
+	"tx4": {"chainId:uint", "nonce:uint", "maxPriorityFeePerGas:uint", "maxFeePerGas:uint", "gas:uint", "to", "value:uint", "data",
+		"accessList:[]access", "authorizationList:[]auth", "yParity:uint", "r", "s"},
+}
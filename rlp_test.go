@@ -0,0 +1,88 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderRLP(t *testing.T) {
+	long := strings.Repeat("a", 60)
+	tests := []struct {
+		name  string
+		value string
+		kind  string
+		want  string
+	}{
+		{"single byte", "\x7f", "", `"0x7f"`},
+		{"empty string", "\x80", "", `"0x"`},
+		{"short string", "\x83dog", "", `"0x646f67"`},
+		{"long string", "\xb8\x3c" + long, "", `"0x` + strings.Repeat("61", 60) + `"`},
+		{"empty list", "\xc0", "", "[]"},
+		{"nested list", "\xc4\x01\xc2\x02\x03", "", "[\n  \"0x01\",\n  [\n    \"0x02\",\n    \"0x03\"\n  ]\n]"},
+		{"long list", "\xf8\x3e\xb8\x3c" + long, "", "[\n  \"0x" + strings.Repeat("61", 60) + "\"\n]"},
+		{"uint", "\x82\x01\x00", "uint", "256"},
+		{"zero uint", "\x80", "uint", "0"},
+		{"big uint", "\x89\x01\x00\x00\x00\x00\x00\x00\x00\x00", "uint", "18446744073709551616"},
+		{"list of uints", "\xc3\x01\x02\x80", "[]uint", "[\n  1,\n  2,\n  0\n]"},
+		{"account", "\xc4\x05\x0a\x80\x80", "account", "{\n  \"nonce\": 5,\n  \"balance\": 10,\n  \"storageRoot\": \"0x\",\n  \"codeHash\": \"0x\"\n}"},
+		{"fields past the schema", "\xc3\x01\x02\x03", "log", "{\n  \"address\": \"0x01\",\n  \"topics\": \"0x02\",\n  \"data\": \"0x03\"\n}"},
+		{"more fields than the schema", "\xc5\x01\x02\x03\x04\x05", "account", "{\n  \"nonce\": 1,\n  \"balance\": 2,\n  \"storageRoot\": \"0x03\",\n  \"codeHash\": \"0x04\",\n  \"4\": \"0x05\"\n}"},
+		{"schema on a string", "\x81\x99", "account", `"0x99"`},
+		{"legacy transaction", "\xc9\x01\x02\x03\x80\x04\x80\x1b\x05\x06", "tx",
+			"{\n  \"nonce\": 1,\n  \"gasPrice\": 2,\n  \"gas\": 3,\n  \"to\": \"0x\",\n  \"value\": 4,\n  \"data\": \"0x\",\n  \"v\": 27,\n  \"r\": \"0x05\",\n  \"s\": \"0x06\"\n}"},
+		{"typed transaction", "\x84\x02\xc2\x01\x07", "tx", "{\n  \"type\": 2,\n  \"tx\": {\n    \"chainId\": 1,\n    \"nonce\": 7\n  }\n}"},
+		{"unknown transaction type", "\x83\x09\xc1\x01", "tx", `"0x09c101"`},
+		{"typed transaction not a list", "\x82\x02\x01", "tx", `"0x0201"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item, err := parseRLPValue([]byte(tt.value))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var out strings.Builder
+			renderRLP(&out, item, tt.kind, "")
+			if got := out.String(); got != tt.want {
+				t.Errorf("renderRLP(%x, %q) = %q, want %q", tt.value, tt.kind, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRLPMalformed(t *testing.T) {
+	deep := "\x01"
+	for i := 0; i <= rlpMaxDepth; i++ {
+		if len(deep) < 56 {
+			deep = string([]byte{byte(0xc0 + len(deep))}) + deep
+		} else {
+			deep = string([]byte{0xf8, byte(len(deep))}) + deep
+		}
+	}
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{"empty", "", "truncated"},
+		{"string past end", "\x83do", "truncated"},
+		{"list past end", "\xc3\x01\x02", "truncated"},
+		{"element past list end", "\xc2\x83do", "truncated"},
+		{"missing length bytes", "\xb9\x01", "bad RLP length"},
+		{"length with leading zero", "\xb9\x00\x3c" + strings.Repeat("a", 60), "bad RLP length"},
+		{"huge length", "\xbf\xff\xff\xff\xff\xff\xff\xff\xff", "truncated"},
+		{"huge list length", "\xff\x7f\xff\xff\xff\xff\xff\xff\xff\xc0", "truncated"},
+		{"trailing bytes", "\x01\x02", "1 bytes after the RLP value"},
+		{"nesting too deep", deep, "too deep"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseRLPValue([]byte(tt.value))
+			if err == nil {
+				t.Fatalf("parsed %x, want an error containing %q", tt.value, tt.want)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error %q, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// Chrome and Electron profiles hold dozens of LevelDB databases (Local
+// Storage, IndexedDB, Session Storage, extension state...). -scan-dir
+// finds every database under a directory and lets the user pick one
+// before the viewer opens it.
+
+var scanDir string // -scan-dir
+
+// A database found under the scanned directory
+type foundDatabase struct {
+	path     string
+	size     int64     // Bytes of its files
+	modified time.Time // Newest file
+}
+
+// A directory is a LevelDB database when its CURRENT file names a manifest
+func isLevelDBDir(dir string) bool {
+	current, err := os.ReadFile(filepath.Join(dir, "CURRENT"))
+	return err == nil && strings.HasPrefix(string(current), "MANIFEST-")
+}
+
+// Walk root for databases, skipping directories that cannot be read
+func findDatabases(root string) ([]foundDatabase, error) {
+	var found []foundDatabase
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			return filepath.SkipDir
+		}
+		if !d.IsDir() || !isLevelDBDir(path) {
+			return nil
+		}
+		candidate := foundDatabase{path: path}
+		if entries, err := os.ReadDir(path); err == nil {
+			for _, entry := range entries {
+				if info, err := entry.Info(); err == nil && info.Mode().IsRegular() {
+					candidate.size += info.Size()
+					if info.ModTime().After(candidate.modified) {
+						candidate.modified = info.ModTime()
+					}
+				}
+			}
+		}
+		found = append(found, candidate)
+		return filepath.SkipDir // Databases do not nest
+	})
+	sort.Slice(found, func(i, j int) bool { return found[i].path < found[j].path })
+	return found, err
+}
+
+// What a database probably is, from the directory names Chromium uses
+func databaseKind(path string) string {
+	slashed := filepath.ToSlash(path)
+	switch {
+	case strings.HasSuffix(slashed, ".indexeddb.leveldb"):
+		return "IndexedDB"
+	case strings.Contains(slashed, "/Local Storage/"):
+		return "Local Storage"
+	case strings.Contains(slashed, "/Session Storage"):
+		return "Session Storage"
+	case strings.Contains(slashed, "/Local Extension Settings/"), strings.Contains(slashed, "/Sync Extension Settings/"):
+		return "extension storage"
+	}
+	return ""
+}
+
+// Find the databases under root and let the user pick one in a list;
+// "" when none was picked
+func pickDatabase(root string) (string, error) {
+	fmt.Fprintf(os.Stderr, "Scanning %s for LevelDB databases...\n", root)
+	found, err := findDatabases(root)
+	if err != nil {
+		return "", err
+	}
+	switch len(found) {
+	case 0:
+		return "", fmt.Errorf("no LevelDB databases found under %s", root)
+	case 1:
+		return found[0].path, nil
+	}
+
+	picker := tview.NewApplication()
+	picked := ""
+	list := tview.NewList().SetWrapAround(false).ShowSecondaryText(false)
+	list.SetBorder(true).SetTitle(fmt.Sprintf(" %d databases in %s (Enter: open, Esc: quit) ", len(found), root))
+	list.SetTitleAlign(tview.AlignLeft)
+	list.SetTitleColor(tcell.ColorYellow)
+	list.SetBackgroundColor(tcell.ColorReset)
+	list.SetSelectedBackgroundColor(tcell.ColorWhite)
+	list.SetHighlightFullLine(true)
+	for _, candidate := range found {
+		candidate := candidate
+		name, err := filepath.Rel(root, candidate.path)
+		if err != nil {
+			name = candidate.path
+		}
+		label := sanitizeForDisplay(name)
+		if kind := databaseKind(candidate.path); kind != "" {
+			label += " [yellow](" + kind + ")[-]"
+		}
+		label += fmt.Sprintf(" [gray]%d KB, modified %s[-]", (candidate.size+1023)/1024, candidate.modified.Format("2006-01-02 15:04"))
+		list.AddItem(label, "", 0, func() {
+			picked = candidate.path
+			picker.Stop()
+		})
+	}
+	list.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyEsc || event.Rune() == 'q' {
+			picker.Stop()
+			return nil
+		}
+		return event
+	})
+	if err := picker.SetRoot(list, true).Run(); err != nil {
+		return "", err
+	}
+	return picked, nil
+}
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// A recurring job from the "schedule" section of the config file
+type scheduledJob struct {
+	Cron   string `json:"cron"`   // "m h dom mon dow", or @hourly, @daily, @weekly, @every <duration>
+	Job    string `json:"job"`    // "export" or "stats"
+	Format string `json:"format"` // Export format, default ndjson
+	Search string `json:"search"` // Only export keys matching this search
+	Dir    string `json:"dir"`    // Output directory, default the dump directory
+	Keep   int    `json:"keep"`   // Outputs of this job kept in Dir; 0 keeps all
+}
+
+// When a job runs: fixed interval or a cron field match
+type schedule struct {
+	every                         time.Duration
+	minute, hour, dom, month, dow uint64 // Bit sets of allowed values
+}
+
+func parseSchedule(spec string) (*schedule, error) {
+	switch spec {
+	case "@hourly":
+		spec = "0 * * * *"
+	case "@daily", "@midnight":
+		spec = "0 0 * * *"
+	case "@weekly":
+		spec = "0 0 * * 0"
+	}
+	if rest, ok := strings.CutPrefix(spec, "@every "); ok {
+		every, err := time.ParseDuration(strings.TrimSpace(rest))
+		if err != nil || every < time.Minute {
+			return nil, fmt.Errorf("bad interval in %q: want a duration of at least 1m", spec)
+		}
+		return &schedule{every: every}, nil
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("bad schedule %q: want 5 cron fields or @hourly, @daily, @weekly, @every <duration>", spec)
+	}
+	s := &schedule{}
+	bounds := [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+	sets := [5]*uint64{&s.minute, &s.hour, &s.dom, &s.month, &s.dow}
+	for i, field := range fields {
+		set, err := parseCronField(field, bounds[i][0], bounds[i][1])
+		if err != nil {
+			return nil, fmt.Errorf("bad schedule %q: %w", spec, err)
+		}
+		*sets[i] = set
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1 // 7 is Sunday too
+	}
+	return s, nil
+}
+
+// One cron field: *, n, a-b, lists of those, each with an optional /step
+func parseCronField(field string, low, high int) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepPart); err != nil || step < 1 {
+				return 0, fmt.Errorf("bad step in %q", part)
+			}
+		}
+		from, to := low, high
+		if rangePart != "*" {
+			first, last, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if from, err = strconv.Atoi(first); err != nil {
+				return 0, fmt.Errorf("bad value in %q", part)
+			}
+			to = from
+			if isRange {
+				if to, err = strconv.Atoi(last); err != nil {
+					return 0, fmt.Errorf("bad range in %q", part)
+				}
+			} else if hasStep {
+				to = high
+			}
+		}
+		if from < low || to > high || from > to {
+			return 0, fmt.Errorf("%q is outside %d-%d", part, low, high)
+		}
+		for v := from; v <= to; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+// First run time strictly after t
+func (s *schedule) next(t time.Time) time.Time {
+	if s.every > 0 {
+		return t.Add(s.every)
+	}
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0) // Only impossible dates such as Feb 30 never match
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = t.Truncate(time.Hour).Add(time.Hour)
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return limit
+}
+
+// Day of month and day of week combine as in cron: either matches unless one is *
+func (s *schedule) dayMatches(t time.Time) bool {
+	const allDays, allWeekdays = uint64(0xFFFFFFFE), uint64(0xFF)
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	switch {
+	case s.dom == allDays:
+		return dow
+	case s.dow == allWeekdays:
+		return dom
+	}
+	return dom || dow
+}
+
+// Point-in-time statistics of the database, written by stats jobs
+type statsSnapshot struct {
+	Created    time.Time      `json:"created"`
+	Database   string         `json:"database"`
+	Keys       int            `json:"keys"`
+	KeyBytes   int64          `json:"key_bytes"`
+	ValueBytes int64          `json:"value_bytes"`
+	MaxValue   int            `json:"max_value_bytes"`
+	Prefixes   map[string]int `json:"prefixes"` // Key count per prefix, as grouped in the write heatmap
+	LevelDB    string         `json:"leveldb_stats,omitempty"`
+}
+
+func takeStatsSnapshot() (*statsSnapshot, error) {
+	snap := &statsSnapshot{Created: time.Now(), Database: dbPath, Prefixes: make(map[string]int)}
+	iter := db.NewIterator(nil, scanReadOptions)
+	defer iter.Release()
+	for iter.Next() {
+		scanRate.wait(iter.Key(), iter.Value())
+		snap.Keys++
+		snap.KeyBytes += int64(len(iter.Key()))
+		snap.ValueBytes += int64(len(iter.Value()))
+		snap.MaxValue = max(snap.MaxValue, len(iter.Value()))
+		snap.Prefixes[heatPrefix(iter.Key())]++
+	}
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+	snap.LevelDB, _ = db.GetProperty("leveldb.stats")
+	return snap, nil
+}
+
+// Run one job now; returns a one-line summary
+func (j scheduledJob) run(progress func(string)) (string, error) {
+	dir := j.Dir
+	if dir == "" {
+		dir = dumpDir
+	}
+	var summary string
+	switch j.Job {
+	case "export":
+		format := j.Format
+		if format == "" {
+			format = "ndjson"
+		}
+		path, count, err := exportDatabase(exportOptions{dir: dir, format: format, search: j.Search, csv: cfg.Export.CSV}, progress)
+		if err != nil {
+			return "", err
+		}
+		summary = fmt.Sprintf("Exported %d keys to %s", count, path)
+	case "stats":
+		snap, err := takeStatsSnapshot()
+		if err != nil {
+			return "", err
+		}
+		data, err := json.MarshalIndent(snap, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return "", err
+		}
+		path := filepath.Join(dir, "stats_"+time.Now().Format(exportTimeLayout)+".json")
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			return "", err
+		}
+		summary = fmt.Sprintf("Wrote stats of %d keys to %s", snap.Keys, path)
+	}
+	if removed, err := j.prune(dir); err != nil {
+		return "", fmt.Errorf("%s; pruning old outputs: %w", summary, err)
+	} else if removed > 0 {
+		summary += fmt.Sprintf(", removed %d old", removed)
+	}
+	return summary, nil
+}
+
+// Remove all but the newest Keep outputs of this job. Outputs are grouped by
+// the timestamp in their names, so a sharded export counts once.
+func (j scheduledJob) prune(dir string) (int, error) {
+	if j.Keep <= 0 {
+		return 0, nil
+	}
+	prefix := "stats_"
+	if j.Job == "export" {
+		prefix = "all_keys_"
+		if j.Search != "" {
+			prefix = "search_keys_"
+		}
+	}
+	files, err := filepath.Glob(filepath.Join(dir, prefix+"*"))
+	if err != nil {
+		return 0, err
+	}
+	groups := make(map[string][]string)
+	for _, file := range files {
+		name := strings.TrimPrefix(filepath.Base(file), prefix)
+		if len(name) < len(exportTimeLayout) {
+			continue
+		}
+		stamp := name[:len(exportTimeLayout)]
+		if _, err := time.Parse(exportTimeLayout, stamp); err == nil {
+			groups[stamp] = append(groups[stamp], file)
+		}
+	}
+	stamps := make([]string, 0, len(groups))
+	for stamp := range groups {
+		stamps = append(stamps, stamp)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(stamps)))
+
+	removed := 0
+	for _, stamp := range stamps[min(j.Keep, len(stamps)):] {
+		for _, file := range groups[stamp] {
+			if err := os.Remove(file); err != nil {
+				return removed, err
+			}
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// Check every configured job before anything starts
+func parseScheduledJobs(jobs []scheduledJob) ([]*schedule, error) {
+	schedules := make([]*schedule, len(jobs))
+	for i, job := range jobs {
+		if job.Job != "export" && job.Job != "stats" {
+			return nil, fmt.Errorf("schedule %d: unknown job %q, want export or stats", i+1, job.Job)
+		}
+		s, err := parseSchedule(job.Cron)
+		if err != nil {
+			return nil, fmt.Errorf("schedule %d: %w", i+1, err)
+		}
+		schedules[i] = s
+	}
+	return schedules, nil
+}
+
+// Call start for each configured job whenever it is due, until stop is closed.
+// start must not block; the viewer queues the job, the schedule command runs it in turn.
+func runScheduler(jobs []scheduledJob, schedules []*schedule, start func(job scheduledJob), stop <-chan struct{}) {
+	now := time.Now()
+	due := make([]time.Time, len(jobs))
+	for i, s := range schedules {
+		due[i] = s.next(now)
+	}
+	for {
+		soonest := 0
+		for i := range due {
+			if due[i].Before(due[soonest]) {
+				soonest = i
+			}
+		}
+		timer := time.NewTimer(time.Until(due[soonest]))
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		start(jobs[soonest])
+		due[soonest] = schedules[soonest].next(time.Now())
+	}
+}
+
+// Queue configured jobs in the viewer's task queue while it runs
+func startScheduledJobs() {
+	if len(cfg.Schedule) == 0 {
+		return
+	}
+	schedules, _ := parseScheduledJobs(cfg.Schedule) // Checked when the config was loaded
+	go runScheduler(cfg.Schedule, schedules, func(job scheduledJob) {
+		enqueueTask("scheduled "+job.Job, job.run)
+	}, nil)
+}
+
+// Run the configured jobs without the viewer until interrupted
+func cmdSchedule(args []string) int {
+	fs := flag.NewFlagSet("schedule", flag.ExitOnError)
+	now := fs.Bool("now", false, "Run every job once at startup as well")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		return commandError("schedule")
+	}
+	if len(cfg.Schedule) == 0 {
+		fmt.Fprintln(os.Stderr, "No jobs configured; add a \"schedule\" list to the config file")
+		return 2
+	}
+	schedules, _ := parseScheduledJobs(cfg.Schedule)
+
+	runJob := func(job scheduledJob) {
+		summary, err := job.run(func(string) {})
+		stamp := time.Now().Format(time.DateTime)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s %s failed: %v\n", stamp, job.Job, err)
+			return
+		}
+		fmt.Printf("%s %s\n", stamp, summary)
+	}
+	for i, job := range cfg.Schedule {
+		fmt.Printf("%s (%s), next at %s\n", job.Job, job.Cron, schedules[i].next(time.Now()).Format(time.DateTime))
+		if *now {
+			runJob(job)
+		}
+	}
+
+	// Jobs run one at a time in the order they come due, like the viewer's queue
+	due := make(chan scheduledJob, len(cfg.Schedule))
+	stop := make(chan struct{})
+	go runScheduler(cfg.Schedule, schedules, func(job scheduledJob) {
+		select {
+		case due <- job:
+		default: // The backlog is full; skip this run rather than block
+		}
+	}, stop)
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	for {
+		select {
+		case job := <-due:
+			runJob(job)
+		case <-interrupt:
+			close(stop)
+			return 0
+		}
+	}
+}
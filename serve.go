@@ -0,0 +1,574 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// The serve command: a JSON API over the open database for dashboards and
+// scripts. Every request authenticates with a bearer token or basic auth,
+// or with the session cookie POST /api/login hands out; sessions end after
+// -idle-timeout without requests. Each endpoint needs a capability (see
+// apicaps.go), checked per request against the credential and, for writes,
+// the database being writable. -tls-cert and -tls-key serve HTTPS.
+
+const (
+	sessionCookie  = "ldbv_session"
+	maxServeKeys   = 1000     // Keys listed per request at most
+	maxServedValue = 64 << 20 // Largest value a PUT accepts
+)
+
+// Who a request authenticated as
+type serveCredential struct {
+	name string
+	caps capabilities
+}
+
+// A login kept alive by its requests
+type serveSession struct {
+	cred     *serveCredential
+	lastSeen time.Time
+	view     sessionView // Guarded by the server's mu
+}
+
+type apiServer struct {
+	tokens      map[string]*serveCredential // Bearer tokens
+	passwords   map[string]string           // Basic auth user: password
+	users       map[string]*serveCredential // Basic auth user: credential
+	idleTimeout time.Duration               // Sessions end after this long without requests
+	secure      bool                        // Served over TLS: session cookies are Secure
+	mu          sync.Mutex                  // Guards sessions
+	sessions    map[string]*serveSession    // By cookie value
+	reads       *readLayer                  // Snapshot every read goes to
+	exports     *exportJobs                 // Exports run on the server, downloaded when done
+}
+
+func newAPIServer(idleTimeout time.Duration, secure bool) *apiServer {
+	return &apiServer{
+		tokens:      make(map[string]*serveCredential),
+		passwords:   make(map[string]string),
+		users:       make(map[string]*serveCredential),
+		idleTimeout: idleTimeout,
+		secure:      secure,
+		sessions:    make(map[string]*serveSession),
+	}
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func sameSecret(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// Credential of the request's bearer token or basic auth, nil when it has neither
+func (s *apiServer) credentials(r *http.Request) (*serveCredential, error) {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		for known, cred := range s.tokens {
+			if sameSecret(strings.TrimSpace(token), known) {
+				return cred, nil
+			}
+		}
+		return nil, errors.New("invalid token")
+	}
+	if user, password, ok := r.BasicAuth(); ok {
+		want, known := s.passwords[user]
+		if !known || !sameSecret(password, want) {
+			return nil, errors.New("invalid user or password")
+		}
+		return s.users[user], nil
+	}
+	return nil, nil
+}
+
+// Credential the request authenticated with: its session, token or basic auth
+func (s *apiServer) authenticate(r *http.Request) (*serveCredential, error) {
+	if cookie, err := r.Cookie(sessionCookie); err == nil {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		session, ok := s.sessions[cookie.Value]
+		switch {
+		case !ok:
+			return nil, errors.New("unknown session, log in again")
+		case time.Since(session.lastSeen) > s.idleTimeout:
+			delete(s.sessions, cookie.Value)
+			return nil, errors.New("session expired after being idle, log in again")
+		}
+		session.lastSeen = time.Now()
+		return session.cred, nil
+	}
+	cred, err := s.credentials(r)
+	if err == nil && cred == nil {
+		err = errors.New("authentication required")
+	}
+	return cred, err
+}
+
+// Drop the sessions idle for longer than the timeout, every minute
+func (s *apiServer) expireSessions(stop <-chan struct{}) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			for id, session := range s.sessions {
+				if time.Since(session.lastSeen) > s.idleTimeout {
+					delete(s.sessions, id)
+				}
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func apiError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+// Wrap h so it only runs for authenticated requests whose credential has the capability need
+func (s *apiServer) handle(need capabilities, h func(w http.ResponseWriter, r *http.Request, cred *serveCredential)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cred, err := s.authenticate(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="leveldb-viewer"`)
+			apiError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		if cred.allowed()&need != need {
+			message := fmt.Sprintf("%s lacks the %s capability", cred.name, strings.Join(need.names(), ", "))
+			if readOnly && need&capWrite != 0 {
+				message = "the database is open read-only"
+			}
+			apiError(w, http.StatusForbidden, message)
+			return
+		}
+		h(w, r, cred)
+	}
+}
+
+func (s *apiServer) routes() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/login", s.login)
+	mux.HandleFunc("POST /api/logout", s.logout)
+	mux.HandleFunc("GET /api/session", s.handle(0, s.getSession))
+	mux.HandleFunc("PUT /api/session", s.handle(0, s.updateSession))
+	mux.HandleFunc("GET /api/session/keys", s.handle(capRead, s.sessionKeys))
+	mux.HandleFunc("GET /api/info", s.handle(0, s.info))
+	mux.HandleFunc("GET /api/keys", s.handle(capRead, s.listKeys))
+	mux.HandleFunc("GET /api/value", s.handle(capRead, s.getValue))
+	mux.HandleFunc("PUT /api/value", s.handle(capWrite, s.putValue))
+	mux.HandleFunc("DELETE /api/value", s.handle(capWrite, s.deleteValue))
+	mux.HandleFunc("GET /api/export", s.handle(capExport, s.exportNDJSON))
+	mux.HandleFunc("POST /api/exports", s.handle(capExport, s.startExport))
+	mux.HandleFunc("GET /api/exports", s.handle(capExport, s.listExports))
+	mux.HandleFunc("GET /api/exports/{id}", s.handle(capExport, s.getExport))
+	mux.HandleFunc("GET /api/exports/{id}/download", s.handle(capExport, s.downloadExport))
+	mux.HandleFunc("DELETE /api/exports/{id}", s.handle(capExport, s.deleteExport))
+	mux.HandleFunc("POST /api/compact", s.handle(capAdmin, s.compact))
+	mux.HandleFunc("GET /api/stats", s.handle(capAdmin, s.stats))
+	return mux
+}
+
+// Start a session for the token or basic auth credentials of the request
+func (s *apiServer) login(w http.ResponseWriter, r *http.Request) {
+	cred, err := s.credentials(r)
+	if err == nil && cred == nil {
+		err = errors.New("log in with a bearer token or basic auth")
+	}
+	if err != nil {
+		apiError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	id, err := randomToken()
+	if err != nil {
+		apiError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.mu.Lock()
+	s.sessions[id] = &serveSession{cred: cred, lastSeen: time.Now()}
+	s.mu.Unlock()
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    id,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   s.secure,
+		SameSite: http.SameSiteStrictMode,
+	})
+	writeJSON(w, http.StatusOK, map[string]any{
+		"user":                 cred.name,
+		"capabilities":         cred.allowed().names(),
+		"idle_timeout_seconds": int(s.idleTimeout.Seconds()),
+	})
+}
+
+func (s *apiServer) logout(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(sessionCookie); err == nil {
+		s.mu.Lock()
+		delete(s.sessions, cookie.Value)
+		s.mu.Unlock()
+	}
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Path: "/", MaxAge: -1})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *apiServer) info(w http.ResponseWriter, r *http.Request, cred *serveCredential) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"database":       dbPath,
+		"user":           cred.name,
+		"capabilities":   cred.allowed().names(),
+		"snapshot_taken": s.reads.taken().Format(time.RFC3339),
+		"version":        currentBuild().Version,
+	})
+}
+
+// Key named by the key (text, or 0x... hex as in the viewer) or key_b64 query parameter
+func requestKey(r *http.Request) ([]byte, error) {
+	query := r.URL.Query()
+	if encoded := query.Get("key_b64"); encoded != "" {
+		return base64.StdEncoding.DecodeString(encoded)
+	}
+	if text := query.Get("key"); text != "" {
+		key, _, err := parseKeyInput(text)
+		return key, err
+	}
+	return nil, errors.New("key or key_b64 is required")
+}
+
+// One key of a listing: a best-effort text rendering and the exact bytes
+type servedKey struct {
+	Key    string `json:"key"`
+	KeyB64 string `json:"key_b64"`
+	bytes  []byte
+}
+
+// The limit parameter of a listing, 100 when not given
+func requestLimit(r *http.Request) (int, error) {
+	text := r.URL.Query().Get("limit")
+	if text == "" {
+		return 100, nil
+	}
+	n, err := strconv.Atoi(text)
+	if err != nil || n < 1 {
+		return 0, errors.New("limit must be a positive number")
+	}
+	return min(n, maxServeKeys), nil
+}
+
+// Up to limit keys of the shared snapshot under prefix and matching search,
+// starting after the key after; more tells whether further keys follow
+func (s *apiServer) keyPage(prefix, search string, after []byte, limit int) ([]servedKey, bool, error) {
+	var rng *util.Range
+	if prefix != "" {
+		rng = util.BytesPrefix([]byte(prefix))
+	}
+	rng = intersectRanges(rng, searchRange(search))
+	filter := newKeyFilter(search)
+	shared := s.reads.acquire()
+	defer s.reads.release(shared)
+	iter := shared.snap.NewIterator(rng, nil)
+	defer iter.Release()
+	ok := iter.First()
+	if len(after) > 0 {
+		if ok = iter.Seek(after); ok && bytes.Equal(iter.Key(), after) {
+			ok = iter.Next()
+		}
+	}
+	keys := []servedKey{}
+	for ; ok && len(keys) < limit; ok = iter.Next() {
+		if filter(iter.Key(), iter.Value()) {
+			key := append([]byte{}, iter.Key()...)
+			keys = append(keys, servedKey{mixedContentDisplay(key), base64.StdEncoding.EncodeToString(key), key})
+		}
+	}
+	return keys, ok, iter.Error()
+}
+
+// Keys in order, optionally under prefix and matching search, starting
+// after the key_b64 of after; next is the after of the following page
+func (s *apiServer) listKeys(w http.ResponseWriter, r *http.Request, cred *serveCredential) {
+	query := r.URL.Query()
+	limit, err := requestLimit(r)
+	if err != nil {
+		apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	after, err := base64.StdEncoding.DecodeString(query.Get("after"))
+	if err != nil {
+		apiError(w, http.StatusBadRequest, "after: "+err.Error())
+		return
+	}
+
+	if err := checkSearch(query.Get("search")); err != nil {
+		apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	keys, ok, err := s.keyPage(query.Get("prefix"), query.Get("search"), after, limit)
+	if err != nil {
+		apiError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	result := map[string]any{"keys": keys, "more": ok}
+	if ok && len(keys) > 0 {
+		result["next"] = keys[len(keys)-1].KeyB64
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (s *apiServer) getValue(w http.ResponseWriter, r *http.Request, cred *serveCredential) {
+	key, err := requestKey(r)
+	if err != nil {
+		apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	shared := s.reads.acquire()
+	value, err := shared.snap.Get(key, nil)
+	s.reads.release(shared)
+	if err == leveldb.ErrNotFound {
+		apiError(w, http.StatusNotFound, "key not found")
+		return
+	}
+	if err != nil {
+		apiError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, mgetResult{
+		Key:      mixedContentDisplay(key),
+		KeyB64:   base64.StdEncoding.EncodeToString(key),
+		Found:    true,
+		Size:     len(value),
+		Value:    mixedContentDisplay(value),
+		ValueB64: base64.StdEncoding.EncodeToString(value),
+	})
+}
+
+// Store the request body as the key's value
+func (s *apiServer) putValue(w http.ResponseWriter, r *http.Request, cred *serveCredential) {
+	key, err := requestKey(r)
+	if err != nil {
+		apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	value, err := io.ReadAll(io.LimitReader(r.Body, maxServedValue+1))
+	if err != nil {
+		apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(value) > maxServedValue {
+		apiError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("values are limited to %d bytes", maxServedValue))
+		return
+	}
+	if err := db.Put(key, value, nil); err != nil {
+		apiError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.afterWrite()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *apiServer) deleteValue(w http.ResponseWriter, r *http.Request, cred *serveCredential) {
+	key, err := requestKey(r)
+	if err != nil {
+		apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	batch := new(leveldb.Batch)
+	batch.Delete(key)
+	if err := db.Write(batch, nil); err != nil {
+		apiError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.afterWrite()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Whether addr only listens on the loopback interface
+func loopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func cmdServe(args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("addr", "127.0.0.1:8080", "Address to listen on")
+	token := fs.String("token", os.Getenv("LEVELDB_VIEWER_TOKEN"), "Bearer token with full access (default $LEVELDB_VIEWER_TOKEN)")
+	readToken := fs.String("read-token", "", "Bearer token that can only read")
+	tokenFile := fs.String("token-file", "", "JSON file of tokens and their capabilities: [{\"name\", \"token\", \"capabilities\": [\"read\", \"export\", \"write\", \"admin\"]}]")
+	basicAuth := fs.String("basic-auth", "", "user:password[:capabilities] accepted with basic auth, with every capability unless listed (e.g. bob:secret:read,export)")
+	tlsCert := fs.String("tls-cert", "", "TLS certificate file; serves HTTPS together with -tls-key")
+	tlsKey := fs.String("tls-key", "", "TLS private key file")
+	idleTimeout := fs.Duration("idle-timeout", 15*time.Minute, "End login sessions after this long without requests")
+	exportDir := fs.String("export-dir", "", "Directory export jobs write their files to (default a temporary directory)")
+	exportKeep := fs.Duration("export-keep", 24*time.Hour, "Delete the file of an export job this long after it finished")
+	tui := fs.Bool("tui", false, "Also run the viewer itself, shown in the browser at /tui through a terminal emulator")
+	hostAccess := fs.Bool("tui-host-access", false, "Let the -tui viewer run commands (value filters, the clipboard) and read and write files on this host (dumps, exports, reports, workspaces, restores, diffs against a path)")
+	xtermCDN := fs.String("xterm-cdn", "https://cdn.jsdelivr.net/npm", "Where the /tui page loads xterm.js from, for hosting it yourself")
+	fs.Parse(args)
+	if fs.NArg() != 0 || *idleTimeout <= 0 || *exportKeep <= 0 || (*tlsCert == "") != (*tlsKey == "") {
+		return commandError("serve")
+	}
+
+	s := newAPIServer(*idleTimeout, *tlsCert != "")
+	var err error
+	if *token != "" {
+		s.tokens[*token] = &serveCredential{name: "token", caps: capAll}
+	}
+	if *readToken != "" {
+		s.tokens[*readToken] = &serveCredential{name: "read-token", caps: capRead}
+	}
+	if *tokenFile != "" {
+		if err := loadTokenFile(s, *tokenFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 2
+		}
+	}
+	if *basicAuth != "" {
+		user, rest, _ := strings.Cut(*basicAuth, ":")
+		password, capList, hasCaps := strings.Cut(rest, ":")
+		if user == "" || password == "" {
+			fmt.Fprintln(os.Stderr, "Error: -basic-auth wants user:password or user:password:capabilities")
+			return 2
+		}
+		caps := capAll
+		if hasCaps {
+			var err error
+			if caps, err = parseCapabilities(capList); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: -basic-auth: %v\n", err)
+				return 2
+			}
+		}
+		s.passwords[user] = password
+		s.users[user] = &serveCredential{name: user, caps: caps}
+	}
+	if len(s.tokens) == 0 && len(s.users) == 0 {
+		generated, err := randomToken()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 2
+		}
+		s.tokens[generated] = &serveCredential{name: "token", caps: capAll}
+		fmt.Fprintf(os.Stderr, "No -token or -basic-auth given; requests need: Authorization: Bearer %s\n", generated)
+	}
+	if *tlsCert == "" && !loopbackAddr(*addr) {
+		fmt.Fprintln(os.Stderr, "Warning: serving without TLS on a non-loopback address sends credentials in clear text; give -tls-cert and -tls-key")
+	}
+
+	tempExports := *exportDir == ""
+	if tempExports {
+		if *exportDir, err = os.MkdirTemp("", "leveldb-viewer-exports-"); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 2
+		}
+	}
+	if s.reads, err = newReadLayer(); err != nil {
+		if tempExports {
+			os.RemoveAll(*exportDir)
+		}
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	s.exports = newExportJobs(*exportDir, *exportKeep)
+
+	stop := make(chan struct{})
+	go s.expireSessions(stop)
+	go s.exports.expire(stop)
+	cleanup := func() {
+		close(stop)
+		s.exports.close()
+		if tempExports {
+			os.RemoveAll(*exportDir)
+		}
+		s.reads.close()
+	}
+
+	mux := s.routes()
+	server := &http.Server{Addr: *addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	shutdown := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	}
+	scheme := "http"
+	if *tlsCert != "" {
+		scheme = "https"
+	}
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		cleanup()
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	serve := func() error {
+		if *tlsCert != "" {
+			return server.ServeTLS(listener, *tlsCert, *tlsKey)
+		}
+		return server.Serve(listener)
+	}
+
+	if *tui {
+		// The viewer runs in main on the first browser's screen; the server
+		// goes on in the background until it quits
+		tuiHostAccess = *hostAccess
+		webTerm = newWebTerminal(s, *xtermCDN, func() {
+			shutdown()
+			cleanup()
+		})
+		webTerm.register(mux)
+		go func() {
+			if err := serve(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			}
+		}()
+		fmt.Fprintf(os.Stderr, "Serving %s at %s://%s/api/; open %s://%s/tui for the viewer\n", dbPath, scheme, *addr, scheme, *addr)
+		return continueToViewer
+	}
+	defer cleanup()
+	handleShutdownSignals(shutdown)
+	fmt.Fprintf(os.Stderr, "Serving %s at %s://%s/api/\n", dbPath, scheme, *addr)
+
+	if err := serve(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	return 0
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// One recorded step of an investigation: what was done, not which keys were pressed
+type sessionAction struct {
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`            // search, select, view, pin, unpin, dump, export, count, verify, compact, exists, history, restore, edit, delete
+	Key    *string   `json:"key,omitempty"`     // Key acted on, when it is valid UTF-8
+	KeyB64 *string   `json:"key_b64,omitempty"` // Otherwise the key in base64
+	Arg    string    `json:"arg,omitempty"`     // Search text or archive path
+}
+
+// Session file written by -record and read by the replay command
+type sessionLog struct {
+	Database string          `json:"database"`
+	Started  time.Time       `json:"started"`
+	Actions  []sessionAction `json:"actions"`
+}
+
+var (
+	sessionMu   sync.Mutex
+	sessionFile string      // Empty when not recording
+	session     *sessionLog // Rewritten to sessionFile after every action
+)
+
+func startRecording(path string) error {
+	sessionFile = path
+	session = &sessionLog{Database: dbPath, Started: time.Now()}
+	return saveSession()
+}
+
+// Append an action to the session being recorded; a no-op without -record.
+// Consecutive selections are collapsed into the last one so scrolling
+// through the list does not flood the log.
+func recordAction(action string, key []byte, arg string) {
+	sessionMu.Lock()
+	defer sessionMu.Unlock()
+	if session == nil {
+		return
+	}
+
+	entry := sessionAction{Time: time.Now(), Action: action, Arg: arg}
+	if key != nil {
+		if utf8.Valid(key) {
+			text := string(key)
+			entry.Key = &text
+		} else {
+			encoded := base64.StdEncoding.EncodeToString(key)
+			entry.KeyB64 = &encoded
+		}
+	}
+
+	actions := session.Actions
+	if action == "select" && len(actions) > 0 && actions[len(actions)-1].Action == "select" {
+		actions[len(actions)-1] = entry
+	} else {
+		session.Actions = append(actions, entry)
+	}
+	if err := saveSession(); err != nil {
+		setStatus(fmt.Sprintf("[red]Error recording session: %v", err))
+	}
+}
+
+func saveSession() error {
+	data, err := json.MarshalIndent(session, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(sessionFile, data, 0644)
+}
+
+// Key of a recorded action, or nil when it has none
+func (a sessionAction) key() ([]byte, error) {
+	switch {
+	case a.KeyB64 != nil:
+		return base64.StdEncoding.DecodeString(*a.KeyB64)
+	case a.Key != nil:
+		return []byte(*a.Key), nil
+	}
+	return nil, nil
+}
+
+func loadSession(path string) (*sessionLog, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var recorded sessionLog
+	if err := json.Unmarshal(data, &recorded); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return &recorded, nil
+}
+
+// Re-run recorded actions against the open database, writing a transcript to out.
+// Interactive-only steps (history, restore, edit, delete) are listed but skipped. Returns the
+// number of actions that failed.
+func replaySession(recorded *sessionLog, out io.Writer) int {
+	failed := 0
+	var pinned []byte
+
+	for i, action := range recorded.Actions {
+		key, err := action.key()
+		if err != nil {
+			fmt.Fprintf(out, "#%d %s: bad key: %v\n", i+1, action.Action, err)
+			failed++
+			continue
+		}
+		fmt.Fprintf(out, "#%d %s", i+1, action.Action)
+		if key != nil {
+			fmt.Fprintf(out, " %s", displayKey(key))
+		}
+		if action.Arg != "" {
+			fmt.Fprintf(out, " %q", action.Arg)
+		}
+		fmt.Fprintln(out)
+
+		result, err := replayAction(action, key, &pinned)
+		if err != nil {
+			fmt.Fprintf(out, "   error: %v\n", err)
+			failed++
+			continue
+		}
+		if result != "" {
+			fmt.Fprintf(out, "   %s\n", strings.ReplaceAll(result, "\n", "\n   "))
+		}
+	}
+	return failed
+}
+
+func replayAction(action sessionAction, key []byte, pinned *[]byte) (string, error) {
+	noProgress := func(string) {}
+
+	switch action.Action {
+	case "search":
+		keys, more, err := scanFirstPage(action.Arg)
+		if err != nil {
+			return "", err
+		}
+		if more {
+			return fmt.Sprintf("%d keys on the first page, more follow", len(keys)), nil
+		}
+		return fmt.Sprintf("%d keys match", len(keys)), nil
+	case "select", "view":
+		value, err := db.Get(key, nil)
+		if err != nil {
+			return "", err
+		}
+		if *pinned == nil {
+			return formatValue(value), nil
+		}
+		pinnedValue, err := db.Get(*pinned, nil)
+		if err != nil {
+			return "", fmt.Errorf("pinned key: %w", err)
+		}
+		var diff strings.Builder
+		for _, op := range diffLines(strings.Split(formatValue(pinnedValue), "\n"), strings.Split(formatValue(value), "\n")) {
+			fmt.Fprintf(&diff, "%c %s\n", op.kind, op.text)
+		}
+		return strings.TrimSuffix(diff.String(), "\n"), nil
+	case "pin":
+		*pinned = key
+		return "", nil
+	case "unpin":
+		*pinned = nil
+		return "", nil
+	case "dump":
+		path, err := dumpKey(key)
+		if err != nil {
+			return "", err
+		}
+		return "dumped to " + path, nil
+	case "export", "export-search":
+		format, search := action.Arg, ""
+		if action.Action == "export-search" {
+			format, search, _ = strings.Cut(action.Arg, ":")
+		}
+		opts := exportOptions{dir: dumpDir, format: format, csv: cfg.Export.CSV, search: search}
+		path, count, err := exportDatabase(opts, noProgress)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("exported %d keys to %s", count, path), nil
+	case "count":
+		return countMatching(action.Arg, noProgress)
+	case "verify":
+		return verifyEntries(noProgress)
+	case "compact":
+		return compactAll(noProgress)
+	case "exists":
+		found, size, err := probeKey(key)
+		if err != nil {
+			return "", err
+		}
+		if !found {
+			return "not found", nil
+		}
+		return fmt.Sprintf("found, value is %d bytes", size), nil
+	case "history", "restore", "edit", "delete", "follow":
+		return "skipped, interactive only", nil
+	}
+	return "", fmt.Errorf("unknown action %q", action.Action)
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/comparer"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+var shardPattern string // From -shards: glob of the shard directories
+
+// Sibling databases (db-000 … db-031) of an application that partitions its
+// data, read as one ordered keyspace. The partitioning function is unknown,
+// so a shard set is always read-only.
+type shardSet struct {
+	names  []string // Directory names, shown as shard labels
+	shards []*leveldb.DB
+}
+
+// Open every directory matching pattern read-only, in name order
+func openShardSet(pattern string) (*shardSet, error) {
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(matches)
+
+	set := &shardSet{}
+	for _, path := range matches {
+		if info, err := os.Stat(path); err != nil || !info.IsDir() {
+			continue
+		}
+		shard, err := leveldb.OpenFile(path, &opt.Options{ReadOnly: true})
+		if err != nil {
+			set.Close()
+			return nil, fmt.Errorf("opening shard %s: %w", path, err)
+		}
+		set.names = append(set.names, filepath.Base(path))
+		set.shards = append(set.shards, shard)
+	}
+	if len(set.shards) == 0 {
+		return nil, fmt.Errorf("no database directories match %s", pattern)
+	}
+	return set, nil
+}
+
+// Merged iteration over every shard in key order. A key present in several
+// shards is returned once per shard.
+func (s *shardSet) NewIterator(slice *util.Range, ro *opt.ReadOptions) iterator.Iterator {
+	iters := make([]iterator.Iterator, len(s.shards))
+	for i, shard := range s.shards {
+		iters[i] = shard.NewIterator(slice, ro)
+	}
+	return iterator.NewMergedIterator(iters, comparer.DefaultComparer, true)
+}
+
+// Value from the first shard, in name order, that holds key
+func (s *shardSet) Get(key []byte, ro *opt.ReadOptions) ([]byte, error) {
+	for _, shard := range s.shards {
+		value, err := shard.Get(key, ro)
+		if err != leveldb.ErrNotFound {
+			return value, err
+		}
+	}
+	return nil, leveldb.ErrNotFound
+}
+
+func (s *shardSet) Put(key, value []byte, wo *opt.WriteOptions) error      { return errReadOnly }
+func (s *shardSet) Write(batch *leveldb.Batch, wo *opt.WriteOptions) error { return errReadOnly }
+func (s *shardSet) CompactRange(r util.Range) error                        { return errReadOnly }
+
+func (s *shardSet) SizeOf(ranges []util.Range) (leveldb.Sizes, error) {
+	total := make(leveldb.Sizes, len(ranges))
+	for _, shard := range s.shards {
+		sizes, err := shard.SizeOf(ranges)
+		if err != nil {
+			return nil, err
+		}
+		for i, size := range sizes {
+			total[i] += size
+		}
+	}
+	return total, nil
+}
+
+// Property of every shard, each under a line naming the shard
+func (s *shardSet) GetProperty(name string) (string, error) {
+	var out strings.Builder
+	for i, shard := range s.shards {
+		value, err := shard.GetProperty(name)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", s.names[i], err)
+		}
+		fmt.Fprintf(&out, "=== %s ===\n%s\n", s.names[i], value)
+	}
+	return out.String(), nil
+}
+
+func (s *shardSet) Close() error {
+	var firstErr error
+	for _, shard := range s.shards {
+		if err := shard.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Snapshots of every shard taken one after another; each shard is consistent on its own
+func (s *shardSet) snapshot() (snapshotReader, error) {
+	snaps := make(shardSnapshot, 0, len(s.shards))
+	for _, shard := range s.shards {
+		snap, err := shard.GetSnapshot()
+		if err != nil {
+			snaps.Release()
+			return nil, err
+		}
+		snaps = append(snaps, snap)
+	}
+	return snaps, nil
+}
+
+type shardSnapshot []*leveldb.Snapshot
+
+func (s shardSnapshot) Get(key []byte, ro *opt.ReadOptions) ([]byte, error) {
+	for _, snap := range s {
+		value, err := snap.Get(key, ro)
+		if err != leveldb.ErrNotFound {
+			return value, err
+		}
+	}
+	return nil, leveldb.ErrNotFound
+}
+
+// Merged iteration over the snapshot of every shard, as shardSet.NewIterator
+func (s shardSnapshot) NewIterator(slice *util.Range, ro *opt.ReadOptions) iterator.Iterator {
+	iters := make([]iterator.Iterator, len(s))
+	for i, snap := range s {
+		iters[i] = snap.NewIterator(slice, ro)
+	}
+	return iterator.NewMergedIterator(iters, comparer.DefaultComparer, true)
+}
+
+func (s shardSnapshot) Release() {
+	for _, snap := range s {
+		snap.Release()
+	}
+}
+
+// Names of the shards holding key; nil when the database is not a shard set
+func shardsOf(key []byte) []string {
+	set, ok := db.(*shardSet)
+	if !ok {
+		return nil
+	}
+	var names []string
+	for i, shard := range set.shards {
+		if found, err := shard.Has(key, nil); err == nil && found {
+			names = append(names, set.names[i])
+		}
+	}
+	return names
+}
+
+// " (db-003)" after a key in the list, naming the shards that hold it
+func shardLabel(key []byte) string {
+	names := shardsOf(key)
+	if len(names) == 0 {
+		return ""
+	}
+	return " [blue](" + strings.Join(names, ",") + ")[-]"
+}
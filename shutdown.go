@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Shutting down cleanly on SIGINT, SIGTERM or SIGHUP (a closed terminal).
+// The signal stops the UI, which gives the terminal back; background tasks
+// stop at their next key, removing the files of an unfinished export, and
+// the databases are closed by main's deferred calls as on a normal quit.
+// A second signal exits at once.
+
+var (
+	shuttingDown   atomic.Bool // Set on a signal or quit; long loops stop when they see it
+	errInterrupted = errors.New("interrupted by shutdown")
+)
+
+// errInterrupted once shutdown has begun, for long loops to return
+func interrupted() error {
+	if shuttingDown.Load() {
+		return errInterrupted
+	}
+	return nil
+}
+
+// Begin the shutdown and call stop on the first signal; exit on the second
+func handleShutdownSignals(stop func()) {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		<-signals
+		shuttingDown.Store(true)
+		stop()
+		<-signals
+		os.Exit(130)
+	}()
+}
+
+// Whether a background task is running now
+func taskIsRunning() bool {
+	tasksMu.Lock()
+	defer tasksMu.Unlock()
+	for _, t := range tasks {
+		if t.state == taskRunning {
+			return true
+		}
+	}
+	return false
+}
+
+// Wait until no background task is running, at most timeout; false when one still is
+func waitForTasks(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		if !taskIsRunning() {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
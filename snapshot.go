@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Browsing one snapshot: the key list and the values shown are read from a
+// snapshot of the database taken when it is opened, so pages continue where
+// the last one stopped and a value matches the list it was picked from,
+// whatever another process writes meanwhile. ~ takes a fresh snapshot; the
+// viewer's own writes take one too, so they show at once. Each tab keeps
+// the snapshot of its database.
+
+var (
+	browseMu     sync.Mutex
+	browseSnap   snapshotReader // nil when not pinned, as in commands
+	browseSnapAt time.Time
+)
+
+// What the key list and value lookups read: the pinned snapshot, or the
+// database itself when there is none
+func browseReader() snapshotReader {
+	browseMu.Lock()
+	defer browseMu.Unlock()
+	if browseSnap == nil {
+		return liveReader{db}
+	}
+	return browseSnap
+}
+
+// The open database read directly, for when no snapshot is pinned
+type liveReader struct{ database }
+
+func (liveReader) Release() {}
+
+// Pin a snapshot of the open database, releasing the one pinned before
+func pinSnapshot() error {
+	snap, err := db.snapshot()
+	if err != nil {
+		return err
+	}
+	if old := swapSnapshot(snap); old != nil {
+		old.Release()
+	}
+	return nil
+}
+
+// Pin snap and return the snapshot pinned before, for the caller to release
+func swapSnapshot(snap snapshotReader) snapshotReader {
+	browseMu.Lock()
+	old := browseSnap
+	browseSnap, browseSnapAt = snap, time.Now()
+	browseMu.Unlock()
+	valueLRU.clear() // Cached values may be older than the new snapshot
+	return old
+}
+
+// Take a fresh snapshot after the viewer wrote to the database; nothing when
+// none is pinned. On failure the list keeps reading the old one.
+func repinSnapshot() {
+	browseMu.Lock()
+	pinned := browseSnap != nil
+	browseMu.Unlock()
+	if !pinned {
+		return
+	}
+	if err := pinSnapshot(); err != nil {
+		setStatus(fmt.Sprintf("[red]Error taking a snapshot: %v", err))
+	}
+}
+
+// ~: show the database as it is now, keeping the selected key when it is on the first page
+func refreshSnapshot() {
+	if len(pendingChanges) > 0 {
+		setStatus("[red]Commit or discard the staged changes before refreshing")
+		return
+	}
+	if err := pinSnapshot(); err != nil {
+		setStatus(fmt.Sprintf("[red]Error: %v", err))
+		return
+	}
+	selected := currentKey
+	loadInitialKeys()
+	for i, key := range displayedKeys {
+		if selected != nil && bytes.Equal(key, selected) {
+			keyList.SetCurrentItem(i)
+			break
+		}
+	}
+	updateStatusBar()
+	setStatus(fmt.Sprintf("[green]Refreshed: %d keys on the first page as of %s", len(displayedKeys), browseSnapAt.Format("15:04:05")))
+}
+
+// Hand the pinned snapshot to t when switching away from its tab
+func stashSnapshot(t *dbTab) {
+	browseMu.Lock()
+	t.snap, t.snapAt = browseSnap, browseSnapAt
+	browseSnap = nil
+	browseMu.Unlock()
+}
+
+// Pin the snapshot t kept, or a new one when it has none
+func restoreSnapshot(t *dbTab) error {
+	if t.snap == nil {
+		return pinSnapshot()
+	}
+	browseMu.Lock()
+	browseSnap, browseSnapAt = t.snap, t.snapAt
+	browseMu.Unlock()
+	t.snap = nil
+	valueLRU.clear()
+	return nil
+}
+
+// Release the pinned snapshot and those of the other tabs, before the databases close
+func releaseSnapshots() {
+	browseMu.Lock()
+	if browseSnap != nil {
+		browseSnap.Release()
+		browseSnap = nil
+	}
+	browseMu.Unlock()
+	for _, t := range tabs {
+		if t.snap != nil {
+			t.snap.Release()
+			t.snap = nil
+		}
+	}
+}
+
+// Snapshot time appended to the status bar
+func snapshotLabel() string {
+	browseMu.Lock()
+	defer browseMu.Unlock()
+	if browseSnap == nil {
+		return ""
+	}
+	label := fmt.Sprintf(" | [gray]as of %s ([white]~[gray]: refresh)", browseSnapAt.Format("15:04:05"))
+	if watchInterval > 0 {
+		label += ", watching every " + watchInterval.String()
+	}
+	return label + "[-]"
+}
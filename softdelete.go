@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// How the application marks a key as deleted without removing it
+type softDeleteConfig struct {
+	EmptyValue bool   `json:"empty_value"` // An empty value is a tombstone
+	Field      string `json:"field"`       // A top-level JSON field such as "deleted" or "deleted_at" that is set (not null, false, 0 or "")
+}
+
+var (
+	showSoftDeleted = false // Toggled with s; tombstones are hidden by default
+
+	// Tombstones among the listed keys, greyed out when shown. Filled by scans
+	// that may run off the UI goroutine.
+	softDeletedMu   sync.Mutex
+	softDeletedKeys = make(map[string]bool)
+)
+
+func softDeleteEnabled() bool {
+	return cfg.SoftDelete.EmptyValue || cfg.SoftDelete.Field != ""
+}
+
+// Report whether value matches the configured tombstone convention
+func isSoftDeleted(value []byte) bool {
+	convention := cfg.SoftDelete
+	if convention.EmptyValue && len(value) == 0 {
+		return true
+	}
+	if convention.Field == "" || !bytes.Contains(value, []byte(`"`+convention.Field+`"`)) {
+		return false
+	}
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal(value, &doc); err != nil {
+		return false
+	}
+	switch v := doc[convention.Field].(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		return v != ""
+	}
+	return true
+}
+
+// Track whether a listed key is a tombstone; returns false when it should be left out of the list
+func noteSoftDeleted(key, value []byte) bool {
+	if !softDeleteEnabled() {
+		return true
+	}
+	deleted := isSoftDeleted(value)
+	softDeletedMu.Lock()
+	defer softDeletedMu.Unlock()
+	if deleted {
+		softDeletedKeys[string(key)] = true
+	} else {
+		delete(softDeletedKeys, string(key))
+	}
+	return !deleted || showSoftDeleted
+}
+
+func isListedSoftDeleted(key []byte) bool {
+	softDeletedMu.Lock()
+	defer softDeletedMu.Unlock()
+	return softDeletedKeys[string(key)]
+}
+
+// Show or hide tombstones and reload the key list
+func toggleSoftDeleted() {
+	if !softDeleteEnabled() {
+		setStatus("[yellow]No soft-delete convention configured (soft_delete in the config file)")
+		return
+	}
+	showSoftDeleted = !showSoftDeleted
+	loadInitialKeys()
+	if showSoftDeleted {
+		setStatus("[green]Showing soft-deleted keys")
+	} else {
+		setStatus(fmt.Sprintf("[green]Hiding soft-deleted keys (%s)", softDeleteDescription()))
+	}
+}
+
+func softDeleteDescription() string {
+	switch convention := cfg.SoftDelete; {
+	case convention.EmptyValue && convention.Field != "":
+		return fmt.Sprintf("empty or %q set", convention.Field)
+	case convention.EmptyValue:
+		return "empty values"
+	default:
+		return fmt.Sprintf("%q set", convention.Field)
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// Edit, delete or insert waiting to be committed
+type pendingChange struct {
+	key    []byte
+	value  []byte // New value; nil for deletes
+	delete bool
+	insert bool // The key did not exist when the change was staged
+}
+
+var (
+	stagingMode    = false // Toggled with b; edits, deletes and inserts are staged instead of written
+	pendingChanges []pendingChange
+	pendingView    *tview.TextView // Panel listing staged changes while staging
+)
+
+func pendingFor(key []byte) *pendingChange {
+	for i := range pendingChanges {
+		if bytes.Equal(pendingChanges[i].key, key) {
+			return &pendingChanges[i]
+		}
+	}
+	return nil
+}
+
+// Stage a put, replacing any earlier change to the same key
+func stagePut(key, value []byte) {
+	if change := pendingFor(key); change != nil {
+		change.value, change.delete = value, false
+	} else {
+		found, _, _ := probeKey(key)
+		pendingChanges = append(pendingChanges, pendingChange{key: key, value: value, insert: !found})
+	}
+	refreshPendingView()
+}
+
+// Stage a delete; deleting a staged insert just drops it
+func stageDelete(key []byte) {
+	change := pendingFor(key)
+	switch {
+	case change == nil:
+		pendingChanges = append(pendingChanges, pendingChange{key: key, delete: true})
+	case change.insert:
+		dropPending(key)
+	default:
+		change.value, change.delete = nil, true
+	}
+	refreshPendingView()
+}
+
+func dropPending(key []byte) {
+	for i := range pendingChanges {
+		if bytes.Equal(pendingChanges[i].key, key) {
+			pendingChanges = append(pendingChanges[:i], pendingChanges[i+1:]...)
+			return
+		}
+	}
+}
+
+// Marker shown before a key in the list: + insert, ~ edit, - delete
+func pendingMarker(key []byte) string {
+	change := pendingFor(key)
+	switch {
+	case change == nil:
+		return ""
+	case change.delete:
+		return "[red]-[-] "
+	case change.insert:
+		return "[green]+[-] "
+	}
+	return "[yellow]~[-] "
+}
+
+func refreshPendingView() {
+	if pendingView == nil {
+		return
+	}
+	var text strings.Builder
+	if len(pendingChanges) == 0 {
+		text.WriteString("[gray]No staged changes. e edits, x deletes and o inserts are staged until b commits or discards them.")
+	}
+	for _, change := range pendingChanges {
+		switch {
+		case change.delete:
+			fmt.Fprintf(&text, "[red]-[-] %s\n", displayKey(change.key))
+		case change.insert:
+			fmt.Fprintf(&text, "[green]+[-] %s (%d bytes)\n", displayKey(change.key), len(change.value))
+		default:
+			fmt.Fprintf(&text, "[yellow]~[-] %s (%d bytes)\n", displayKey(change.key), len(change.value))
+		}
+	}
+	pendingView.SetTitle(fmt.Sprintf(" Staged changes (%d) ", len(pendingChanges)))
+	pendingView.SetText(text.String())
+}
+
+// Start staging, or when already staging ask whether to commit or discard
+func toggleStaging() {
+	if refuseWrite() {
+		return
+	}
+	if !stagingMode {
+		stagingMode = true
+		mainLayout.AddItem(pendingView, 8, 0, false)
+		refreshPendingView()
+		setStatus("[green]Staging changes; press b to commit or discard")
+		return
+	}
+
+	if len(pendingChanges) == 0 {
+		stopStaging()
+		setStatus("[green]Staging off")
+		return
+	}
+
+	modal := tview.NewModal().
+		SetText(fmt.Sprintf("%d staged changes", len(pendingChanges))).
+		AddButtons([]string{"Commit", "Discard", "Keep staging"}).
+		SetDoneFunc(func(index int, label string) {
+			closeDialog("staging")
+			switch label {
+			case "Commit":
+				count, err := commitPending()
+				if err != nil {
+					setStatus(fmt.Sprintf("[red]Error committing: %v", err))
+					return
+				}
+				stopStaging()
+				setStatus(fmt.Sprintf("[green]Committed %d changes in one batch", count))
+			case "Discard":
+				count := len(pendingChanges)
+				discardPending()
+				stopStaging()
+				setStatus(fmt.Sprintf("[green]Discarded %d changes", count))
+			}
+		})
+	modal.SetFocus(2)
+	pages.AddPage("staging", modal, true, true)
+	app.SetFocus(modal)
+}
+
+func stopStaging() {
+	stagingMode = false
+	mainLayout.RemoveItem(pendingView)
+}
+
+// Write every staged change atomically with one leveldb.Batch
+func commitPending() (int, error) {
+	batch := new(leveldb.Batch)
+	var deleted [][]byte
+	for _, change := range pendingChanges {
+		if change.delete {
+			batch.Delete(change.key)
+			deleted = append(deleted, change.key)
+		} else {
+			batch.Put(change.key, change.value)
+		}
+	}
+	if err := db.Write(batch, nil); err != nil {
+		return 0, err
+	}
+
+	count := len(pendingChanges)
+	for _, change := range pendingChanges {
+		valueLRU.remove(change.key)
+		if !change.delete {
+			noteSoftDeleted(change.key, change.value)
+		}
+	}
+	pendingChanges = nil
+	repinSnapshot()
+	refreshPendingView()
+	removeFromKeyList(deleted)
+	return count, nil
+}
+
+// Forget staged changes, taking staged inserts back out of the key list
+func discardPending() {
+	var inserted [][]byte
+	for _, change := range pendingChanges {
+		if change.insert {
+			inserted = append(inserted, change.key)
+		}
+	}
+	pendingChanges = nil
+	refreshPendingView()
+	removeFromKeyList(inserted)
+}
+
+// Value to show for key: the staged one if there is a staged put
+func stagedValue(key []byte) ([]byte, bool) {
+	if change := pendingFor(key); change != nil && !change.delete {
+		return change.value, true
+	}
+	return nil, false
+}
+
+// Ask for a new key, prefilled with key when given, and its value; staged while
+// staging, written directly otherwise. [b64:...] runs in either field are
+// decoded, so binary data can be entered.
+func showInsertDialog(key []byte) {
+	if refuseWrite() {
+		return
+	}
+	var keyText, valueText string
+	if key != nil {
+		keyText = mixedContentDisplay(key)
+	}
+	form := tview.NewForm()
+	form.AddInputField("Key", keyText, 60, nil, func(text string) { keyText = text })
+	form.AddTextArea("Value", "", 60, 6, 0, func(text string) { valueText = text })
+	form.AddButton("Save", func() {
+		if keyText == "" {
+			setStatus("[red]Key is empty")
+			return
+		}
+		key, value := decodeBinaryRuns(keyText), decodeBinaryRuns(valueText)
+		if stagingMode {
+			stagePut(key, value)
+		} else if err := db.Put(key, value, nil); err != nil {
+			setStatus(fmt.Sprintf("[red]Error writing value: %v", err))
+			return
+		} else {
+			valueLRU.remove(key)
+			repinSnapshot()
+		}
+		closeDialog("insert")
+		insertIntoKeyList(key, value)
+		if stagingMode {
+			setStatus(fmt.Sprintf("[green]Staged %s", displayKey(key)))
+		} else {
+			setStatus(fmt.Sprintf("[green]Wrote %s", displayKey(key)))
+		}
+	})
+	form.AddButton("Cancel", func() { closeDialog("insert") })
+	form.SetCancelFunc(func() { closeDialog("insert") })
+	form.SetBorder(true).SetTitle(" Insert key ")
+	form.SetTitleAlign(tview.AlignLeft)
+	form.SetTitleColor(tcell.ColorYellow)
+	form.SetBackgroundColor(tcell.ColorReset)
+
+	showDialog("insert", form, 76, 14)
+}
+
+// Show a new key in the list at its sorted position if it falls within the loaded range
+func insertIntoKeyList(key, value []byte) {
+	index := sort.Search(len(displayedKeys), func(i int) bool { return bytes.Compare(displayedKeys[i], key) >= 0 })
+	if index < len(displayedKeys) && bytes.Equal(displayedKeys[index], key) {
+		rebuildKeyList(index)
+		return
+	}
+	if index == len(displayedKeys) && hasMoreKeys || !listFilter(currentPrefix)(key, value) {
+		return
+	}
+	displayedKeys = append(displayedKeys[:index], append([][]byte{key}, displayedKeys[index:]...)...)
+	rebuildKeyList(index)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// Commands accepted by -cmd, e.g. -cmd 'seek user:42; open-value; format hex'
+var startupCommands = map[string]func(arg string) error{
+	"seek":       seekToTyped,
+	"search":     func(arg string) error { searchBox.SetText(arg); return nil },
+	"open-value": func(string) error { showSelectedKeyValue(); return nil },
+	"format":     setViewFormat,
+	"keys":       setKeyRenderingAndRedraw,
+	"pin":        func(string) error { togglePinnedKey(); return nil },
+	"dump":       func(string) error { dumpCurrentKey(); return nil },
+	"conflicts":  showMergePlan,
+	"diff":       startDatabaseDiff,
+}
+
+var startupScript string // From -cmd, run once the first page of keys is shown
+
+// Check the script before the UI starts so typos fail on the command line
+func parseStartupScript(script string) ([][2]string, error) {
+	var steps [][2]string
+	for _, part := range strings.Split(script, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, arg, _ := strings.Cut(part, " ")
+		if _, ok := startupCommands[name]; !ok {
+			return nil, fmt.Errorf("unknown -cmd command %q", name)
+		}
+		steps = append(steps, [2]string{name, strings.TrimSpace(arg)})
+	}
+	return steps, nil
+}
+
+// Run the -cmd script on the UI goroutine, stopping at the first error
+func runStartupScript() {
+	steps, _ := parseStartupScript(startupScript)
+	startupScript = ""
+	for _, step := range steps {
+		if err := startupCommands[step[0]](step[1]); err != nil {
+			setStatus(fmt.Sprintf("[red]Error in -cmd %s: %v", step[0], err))
+			return
+		}
+	}
+}
+
+// seek for a typed key, which may be given as 0x hex or b64: base64
+func seekToTyped(arg string) error {
+	if arg == "" {
+		return fmt.Errorf("missing key")
+	}
+	key, _, err := parseKeyInput(arg)
+	if err != nil {
+		return err
+	}
+	return seekToKey(key)
+}
+
+// Show the page of keys starting at key (or the next key after it) and select it
+func seekToKey(key []byte) error {
+	filter := listFilter(currentPrefix)
+	keys, more, err := scanPage(listSource(currentPrefix), filter, key, pageSize)
+	if err != nil {
+		return err
+	}
+	value, err := browseReader().Get(key, nil)
+	if err != nil && err != leveldb.ErrNotFound {
+		return err
+	}
+	found := err == nil
+	if found && filter(key, value) {
+		keys = append([][]byte{key}, keys...)
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("no keys at or after %s", displayKey(key))
+	}
+
+	showInitialKeys(keys, more, nil)
+	keyList.SetCurrentItem(0)
+	currentKey = keys[0]
+	showKeyValue(currentKey)
+	if !found {
+		setStatus(fmt.Sprintf("[yellow]%s not found, showing the next key", displayKey(key)))
+	}
+	return nil
+}
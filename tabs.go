@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rivo/tview"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+// Several databases open at once, one per tab: -db given more than once.
+// The viewer shows one at a time; switching with < and > swaps the open
+// database and restores the search, loaded keys, marks, selection and
+// scroll position it had. A key pinned in one tab stays pinned in the others, so
+// the same key can be compared between, say, a staging and a production copy.
+
+var extraDBPaths []string // -db given after the first, opened in further tabs
+
+// -db: the first path is the database, any further ones open in tabs
+type dbPathFlag struct{}
+
+func (dbPathFlag) String() string { return dbPath }
+
+func (dbPathFlag) Set(path string) error {
+	if dbPath == "" {
+		dbPath = path
+	} else {
+		extraDBPaths = append(extraDBPaths, path)
+	}
+	return nil
+}
+
+// A database open in a tab and the viewer state it had when last shown
+type dbTab struct {
+	path     string
+	db       database
+	readOnly bool
+	tempDir  string // Where an archive was extracted to, removed on close
+
+	search   string
+	keys     [][]byte // Loaded pages of keys
+	more     bool
+	item     int // Selected row of the key list
+	offset   int // First row shown
+	key      []byte
+	row, col int             // Value view scroll position
+	marked   map[string]bool // Keys marked with space
+	snap     snapshotReader  // Snapshot the tab was browsing, pinned again when it is shown
+	snapAt   time.Time
+}
+
+var (
+	tabs      []*dbTab
+	activeTab int
+	tabBar    *tview.TextView // Tab names above the key list, shown with more than one tab
+)
+
+// Open the databases of the further -db flags next to the one already open
+func openTabs() error {
+	tabs = []*dbTab{{path: dbPath, db: db, readOnly: readOnly}}
+	for _, path := range extraDBPaths {
+		if isBundle(path) {
+			opened, tmp, err := openBundle(path, budgetOptions(&opt.Options{ReadOnly: true}))
+			if err != nil {
+				closeTabs()
+				return err
+			}
+			tabs = append(tabs, &dbTab{path: path, db: opened, readOnly: true, tempDir: tmp})
+			continue
+		}
+		opened, err := leveldb.OpenFile(path, budgetOptions(&opt.Options{ReadOnly: readOnly}))
+		if err != nil {
+			closeTabs()
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		tabs = append(tabs, &dbTab{path: path, db: singleDB{opened}, readOnly: readOnly})
+	}
+	return nil
+}
+
+// Close the databases of every tab but the first, which main closes
+func closeTabs() {
+	for _, t := range tabs[1:] {
+		t.db.Close()
+		if t.tempDir != "" {
+			os.RemoveAll(t.tempDir)
+		}
+	}
+}
+
+// Name of a tab: its directory name, or the whole path when another tab has the same name
+func tabName(t *dbTab) string {
+	name := filepath.Base(t.path)
+	for _, other := range tabs {
+		if other != t && filepath.Base(other.path) == name {
+			return t.path
+		}
+	}
+	return name
+}
+
+// Name of the tab holding d, "" when it is not open in a tab
+func tabNameOf(d database) string {
+	for _, t := range tabs {
+		if t.db == d {
+			return tabName(t)
+		}
+	}
+	return ""
+}
+
+func newTabBar() *tview.TextView {
+	tabBar = tview.NewTextView().SetDynamicColors(true).SetWrap(false)
+	updateTabBar()
+	return tabBar
+}
+
+func updateTabBar() {
+	if tabBar == nil {
+		return
+	}
+	var text strings.Builder
+	for i, t := range tabs {
+		label := fmt.Sprintf(" %d: %s ", i+1, sanitizeForDisplay(tabName(t)))
+		if i == activeTab {
+			text.WriteString("[black:yellow]" + label + "[-:-]")
+		} else {
+			text.WriteString("[white]" + label + "[-]")
+		}
+		text.WriteString(" ")
+	}
+	text.WriteString("[gray](<, >: switch)[-]")
+	tabBar.SetText(text.String())
+}
+
+// Show the tab step tabs away from the current one, wrapping around
+func cycleTab(step int) {
+	if len(tabs) < 2 {
+		setStatus("[yellow]Only one database is open; give -db more than once to open several")
+		return
+	}
+	switchTab((activeTab + step + len(tabs)) % len(tabs))
+}
+
+func switchTab(to int) {
+	if len(pendingChanges) > 0 {
+		setStatus("[red]Commit or discard the staged changes before switching databases")
+		return
+	}
+
+	t := tabs[activeTab]
+	t.readOnly = readOnly
+	t.search, t.keys, t.more, t.key = currentPrefix, displayedKeys, hasMoreKeys, currentKey
+	t.item = keyList.GetCurrentItem()
+	t.offset, _ = keyList.GetOffset()
+	t.row, t.col = valueView.GetScrollOffset()
+	t.marked = markedKeys
+	stashSnapshot(t)
+
+	activeTab = to
+	t = tabs[to]
+	db, dbPath, readOnly = t.db, t.path, t.readOnly
+	clear(watchMarks) // They were found in the other database
+	if err := restoreSnapshot(t); err != nil {
+		setStatus(fmt.Sprintf("[red]Error: %v", err))
+	}
+	markedKeys = t.marked
+	if markedKeys == nil {
+		markedKeys = make(map[string]bool)
+	}
+	if err := loadNotes(); err != nil {
+		setStatus(fmt.Sprintf("[red]Error: %v", err))
+	}
+
+	currentPrefix = t.search
+	searchBox.SetChangedFunc(nil) // The saved keys are shown instead of searching again
+	searchBox.SetText(t.search)
+	searchBox.SetChangedFunc(onSearchChanged)
+	if t.keys == nil {
+		loadInitialKeys()
+	} else {
+		showInitialKeys(t.keys, t.more, nil)
+		keyList.SetCurrentItem(t.item)
+		keyList.SetOffset(t.offset, 0)
+	}
+	currentKey = t.key
+	if currentKey == nil && len(displayedKeys) > 0 {
+		currentKey = displayedKeys[0]
+	}
+	if currentKey != nil {
+		showKeyValue(currentKey)
+		valueView.ScrollTo(t.row, t.col)
+		pinnedView.ScrollTo(t.row, t.col)
+	} else {
+		valueView.Clear()
+	}
+
+	updateTabBar()
+	updateStatusBar()
+	setStatus(fmt.Sprintf("[green]Switched to %s", tview.Escape(t.path)))
+}
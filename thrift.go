@@ -0,0 +1,376 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const thriftMaxDepth = 64
+
+var errThriftTruncated = errors.New("truncated Thrift data")
+
+// Pretty-prints a Thrift struct written with the binary or the compact
+// protocol; the value view's "thrift" format. Without the IDL fields are
+// shown by their ids.
+type thriftFormatter struct{}
+
+func (thriftFormatter) format(value []byte) string {
+	text, err := decodeThrift(value, false)
+	if err == nil {
+		return "// binary protocol\n" + text
+	}
+	text, compactErr := decodeThrift(value, true)
+	if compactErr == nil {
+		return "// compact protocol\n" + text
+	}
+	return fmt.Sprintf("(not Thrift: binary protocol: %v; compact protocol: %v)\n\n%s", err, compactErr, mixedContentDisplay(value))
+}
+
+// Render value, which must hold exactly one struct
+func decodeThrift(value []byte, compact bool) (string, error) {
+	r := &thriftReader{buf: value, compact: compact}
+	var out strings.Builder
+	if err := r.renderStruct(&out, "", 0); err != nil {
+		return "", err
+	}
+	if r.pos != len(value) {
+		return "", fmt.Errorf("%d bytes after the struct", len(value)-r.pos)
+	}
+	return out.String(), nil
+}
+
+// Reader over binary or compact protocol data; types are kept as the binary
+// protocol numbers, compact ones are translated on reading
+type thriftReader struct {
+	buf     []byte
+	pos     int
+	compact bool
+}
+
+const (
+	thriftBool   = 2
+	thriftByte   = 3
+	thriftDouble = 4
+	thriftI16    = 6
+	thriftI32    = 8
+	thriftI64    = 10
+	thriftBinary = 11
+	thriftStruct = 12
+	thriftMap    = 13
+	thriftSet    = 14
+	thriftList   = 15
+	thriftUUID   = 16
+)
+
+// Compact protocol type numbers to binary protocol ones; 1 and 2 are bools
+// that also carry the value in a field header
+var thriftCompactTypes = map[byte]byte{
+	1: thriftBool, 2: thriftBool, 3: thriftByte, 4: thriftI16, 5: thriftI32, 6: thriftI64, 7: thriftDouble,
+	8: thriftBinary, 9: thriftList, 10: thriftSet, 11: thriftMap, 12: thriftStruct, 13: thriftUUID,
+}
+
+func (r *thriftReader) take(n int64) ([]byte, error) {
+	if n < 0 || n > int64(len(r.buf)-r.pos) {
+		return nil, errThriftTruncated
+	}
+	b := r.buf[r.pos : r.pos+int(n)]
+	r.pos += int(n)
+	return b, nil
+}
+
+func (r *thriftReader) uvarint() (uint64, error) {
+	v, n := binary.Uvarint(r.buf[r.pos:])
+	if n <= 0 {
+		return 0, errThriftTruncated
+	}
+	r.pos += n
+	return v, nil
+}
+
+// Compact protocol zigzag varint
+func (r *thriftReader) varint() (int64, error) {
+	v, err := r.uvarint()
+	return int64(v>>1) ^ -int64(v&1), err
+}
+
+// Big-endian integer of size bytes in the binary protocol
+func (r *thriftReader) fixed(size int64) (int64, error) {
+	b, err := r.take(size)
+	if err != nil {
+		return 0, err
+	}
+	switch size {
+	case 2:
+		return int64(int16(binary.BigEndian.Uint16(b))), nil
+	case 4:
+		return int64(int32(binary.BigEndian.Uint32(b))), nil
+	}
+	return int64(binary.BigEndian.Uint64(b)), nil
+}
+
+func (r *thriftReader) typ(b byte) (byte, error) {
+	if !r.compact {
+		if b < thriftBool || b > thriftUUID || b == 5 || b == 7 || b == 9 {
+			return 0, fmt.Errorf("unknown type %d", b)
+		}
+		return b, nil
+	}
+	t, ok := thriftCompactTypes[b]
+	if !ok {
+		return 0, fmt.Errorf("unknown type %d", b)
+	}
+	return t, nil
+}
+
+// Element count of a list, set or map
+func (r *thriftReader) size() (int64, error) {
+	var n int64
+	if r.compact {
+		v, err := r.uvarint()
+		if err != nil {
+			return 0, err
+		}
+		n = int64(v)
+	} else {
+		v, err := r.fixed(4)
+		if err != nil {
+			return 0, err
+		}
+		n = v
+	}
+	if n < 0 || n > int64(len(r.buf)-r.pos) { // Elements take at least a byte each
+		return 0, fmt.Errorf("bad element count %d", n)
+	}
+	return n, nil
+}
+
+func (r *thriftReader) renderStruct(out *strings.Builder, indent string, depth int) error {
+	if depth > thriftMaxDepth {
+		return errors.New("nesting too deep")
+	}
+	var lastID int64
+	count := 0
+	out.WriteString("{")
+	for {
+		header, err := r.take(1)
+		if err != nil {
+			return err
+		}
+		if header[0] == 0 { // Stop field
+			break
+		}
+		var typ byte
+		var id int64
+		if r.compact {
+			if typ, err = r.typ(header[0] & 0x0f); err != nil {
+				return err
+			}
+			if delta := int64(header[0] >> 4); delta != 0 {
+				id = lastID + delta
+			} else if id, err = r.varint(); err != nil {
+				return err
+			}
+			lastID = id
+		} else {
+			if typ, err = r.typ(header[0]); err != nil {
+				return err
+			}
+			if id, err = r.fixed(2); err != nil {
+				return err
+			}
+		}
+		if count > 0 {
+			out.WriteString(",")
+		}
+		out.WriteString("\n" + indent + "  " + strconv.FormatInt(id, 10) + ": ")
+		if r.compact && typ == thriftBool { // The value is in the field header
+			out.WriteString(strconv.FormatBool(header[0]&0x0f == 1))
+		} else if err := r.render(out, typ, indent+"  ", depth+1); err != nil {
+			return fmt.Errorf("field %d: %w", id, err)
+		}
+		count++
+	}
+	if count > 0 {
+		out.WriteString("\n" + indent)
+	}
+	out.WriteString("}")
+	return nil
+}
+
+func (r *thriftReader) render(out *strings.Builder, typ byte, indent string, depth int) error {
+	if depth > thriftMaxDepth {
+		return errors.New("nesting too deep")
+	}
+	switch typ {
+	case thriftBool, thriftByte:
+		b, err := r.take(1)
+		if err != nil {
+			return err
+		}
+		if typ == thriftBool {
+			out.WriteString(strconv.FormatBool(b[0] == 1))
+		} else {
+			out.WriteString(strconv.Itoa(int(int8(b[0]))))
+		}
+	case thriftI16, thriftI32, thriftI64:
+		var v int64
+		var err error
+		if r.compact {
+			v, err = r.varint()
+		} else {
+			v, err = r.fixed(map[byte]int64{thriftI16: 2, thriftI32: 4, thriftI64: 8}[typ])
+		}
+		if err != nil {
+			return err
+		}
+		out.WriteString(strconv.FormatInt(v, 10))
+	case thriftDouble:
+		b, err := r.take(8)
+		if err != nil {
+			return err
+		}
+		bits := binary.BigEndian.Uint64(b)
+		if r.compact {
+			bits = binary.LittleEndian.Uint64(b)
+		}
+		out.WriteString(strconv.FormatFloat(math.Float64frombits(bits), 'g', -1, 64))
+	case thriftBinary:
+		n, err := r.size()
+		if err != nil {
+			return err
+		}
+		b, err := r.take(n)
+		if err != nil {
+			return err
+		}
+		if isPrintableText(b) || len(b) == 0 {
+			out.WriteString(quoteJSONString(string(b)))
+		} else {
+			out.WriteString("[b64:" + base64.RawStdEncoding.EncodeToString(b) + "]")
+		}
+	case thriftUUID:
+		b, err := r.take(16)
+		if err != nil {
+			return err
+		}
+		out.WriteString(quoteJSONString(formatUUID(b)))
+	case thriftStruct:
+		return r.renderStruct(out, indent, depth)
+	case thriftList, thriftSet:
+		return r.renderList(out, indent, depth)
+	case thriftMap:
+		return r.renderMap(out, indent, depth)
+	}
+	return nil
+}
+
+// List or set header: element type and count
+func (r *thriftReader) renderList(out *strings.Builder, indent string, depth int) error {
+	var elem byte
+	var n int64
+	if r.compact {
+		header, err := r.take(1)
+		if err != nil {
+			return err
+		}
+		if elem, err = r.typ(header[0] & 0x0f); err != nil {
+			return err
+		}
+		if n = int64(header[0] >> 4); n == 15 {
+			if n, err = r.size(); err != nil {
+				return err
+			}
+		}
+	} else {
+		header, err := r.take(1)
+		if err != nil {
+			return err
+		}
+		if elem, err = r.typ(header[0]); err != nil {
+			return err
+		}
+		if n, err = r.size(); err != nil {
+			return err
+		}
+	}
+	if n == 0 {
+		out.WriteString("[]")
+		return nil
+	}
+	out.WriteString("[")
+	for i := int64(0); i < n; i++ {
+		if i > 0 {
+			out.WriteString(",")
+		}
+		out.WriteString("\n" + indent + "  ")
+		if err := r.render(out, elem, indent+"  ", depth+1); err != nil {
+			return err
+		}
+	}
+	out.WriteString("\n" + indent + "]")
+	return nil
+}
+
+// Map header: key and value types and count; an empty compact map has no types
+func (r *thriftReader) renderMap(out *strings.Builder, indent string, depth int) error {
+	var keyType, valueType byte
+	var n int64
+	var err error
+	if r.compact {
+		if n, err = r.size(); err != nil || n == 0 {
+			if err == nil {
+				out.WriteString("{}")
+			}
+			return err
+		}
+		header, err := r.take(1)
+		if err != nil {
+			return err
+		}
+		if keyType, err = r.typ(header[0] >> 4); err != nil {
+			return err
+		}
+		if valueType, err = r.typ(header[0] & 0x0f); err != nil {
+			return err
+		}
+	} else {
+		header, err := r.take(2)
+		if err != nil {
+			return err
+		}
+		if keyType, err = r.typ(header[0]); err != nil {
+			return err
+		}
+		if valueType, err = r.typ(header[1]); err != nil {
+			return err
+		}
+		if n, err = r.size(); err != nil {
+			return err
+		}
+	}
+	if n == 0 {
+		out.WriteString("{}")
+		return nil
+	}
+	out.WriteString("{")
+	for i := int64(0); i < n; i++ {
+		if i > 0 {
+			out.WriteString(",")
+		}
+		out.WriteString("\n" + indent + "  ")
+		if err := r.render(out, keyType, indent+"  ", depth+1); err != nil {
+			return err
+		}
+		out.WriteString(": ")
+		if err := r.render(out, valueType, indent+"  ", depth+1); err != nil {
+			return err
+		}
+	}
+	out.WriteString("\n" + indent + "}")
+	return nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDecodeThrift(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		compact bool
+		want    string
+	}{
+		{"empty struct", "\x00", false, "{}"},
+		{"binary i32 and string", "\x08\x00\x01\x00\x00\x00\x2a\x0b\x00\x02\x00\x00\x00\x02hi\x00", false,
+			"{\n  1: 42,\n  2: \"hi\"\n}"},
+		{"binary bool, byte, i16, i64", "\x02\x00\x01\x01\x03\x00\x02\xff\x06\x00\x03\xff\xfe\x0a\x00\x04\x00\x00\x00\x00\x00\x00\x01\x00\x00", false,
+			"{\n  1: true,\n  2: -1,\n  3: -2,\n  4: 256\n}"},
+		{"binary double", "\x04\x00\x01\x3f\xf8\x00\x00\x00\x00\x00\x00\x00", false, "{\n  1: 1.5\n}"},
+		{"binary bytes", "\x0b\x00\x01\x00\x00\x00\x02\x00\xff\x00", false, "{\n  1: [b64:AP8]\n}"},
+		{"binary list", "\x0f\x00\x01\x08\x00\x00\x00\x02\x00\x00\x00\x01\x00\x00\x00\x02\x00", false, "{\n  1: [\n    1,\n    2\n  ]\n}"},
+		{"binary empty set", "\x0e\x00\x01\x08\x00\x00\x00\x00\x00", false, "{\n  1: []\n}"},
+		{"binary map", "\x0d\x00\x01\x0b\x08\x00\x00\x00\x01\x00\x00\x00\x01a\x00\x00\x00\x07\x00", false, "{\n  1: {\n    \"a\": 7\n  }\n}"},
+		{"binary nested struct", "\x0c\x00\x01\x08\x00\x01\x00\x00\x00\x05\x00\x00", false, "{\n  1: {\n    1: 5\n  }\n}"},
+		{"binary uuid", "\x10\x00\x01\x12\x34\x56\x78\x9a\xbc\xde\xf0\x12\x34\x56\x78\x9a\xbc\xde\xf0\x00", false,
+			"{\n  1: \"12345678-9abc-def0-1234-56789abcdef0\"\n}"},
+		{"compact i32 and string", "\x15\x54\x18\x02hi\x00", true, "{\n  1: 42,\n  2: \"hi\"\n}"},
+		{"compact bools in header", "\x11\x12\x00", true, "{\n  1: true,\n  2: false\n}"},
+		{"compact long field id", "\x05\xc8\x01\x02\x00", true, "{\n  100: 1\n}"},
+		{"compact negative i64", "\x16\x03\x00", true, "{\n  1: -2\n}"},
+		{"compact double", "\x17\x00\x00\x00\x00\x00\x00\xf8\x3f\x00", true, "{\n  1: 1.5\n}"},
+		{"compact list", "\x19\x25\x02\x04\x00", true, "{\n  1: [\n    1,\n    2\n  ]\n}"},
+		{"compact long list", "\x19\xf3\x10" + strings.Repeat("\x07", 16) + "\x00", true,
+			"{\n  1: [" + strings.Repeat("\n    7,", 15) + "\n    7\n  ]\n}"},
+		{"compact empty map", "\x1b\x00\x00", true, "{\n  1: {}\n}"},
+		{"compact map", "\x1b\x01\x85\x01a\x0e\x00", true, "{\n  1: {\n    \"a\": 7\n  }\n}"},
+		{"compact nested struct", "\x1c\x15\x0a\x00\x00", true, "{\n  1: {\n    1: 5\n  }\n}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeThrift([]byte(tt.value), tt.compact)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("decodeThrift(%x, %v) = %q, want %q", tt.value, tt.compact, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeThriftMalformed(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		compact bool
+		want    string
+	}{
+		{"empty", "", false, "truncated"},
+		{"missing stop", "\x08\x00\x01\x00\x00\x00\x2a", false, "truncated"},
+		{"unknown type", "\x05\x00\x01\x00", false, "unknown type 5"},
+		{"truncated field id", "\x08\x00", false, "truncated"},
+		{"truncated i64", "\x0a\x00\x01\x00\x00", false, "field 1: truncated"},
+		{"negative string length", "\x0b\x00\x01\xff\xff\xff\xff\x00", false, "bad element count -1"},
+		{"huge list", "\x0f\x00\x01\x08\x7f\xff\xff\xff\x00", false, "bad element count 2147483647"},
+		{"list of unknown type", "\x0f\x00\x01\x09\x00\x00\x00\x01\x00", false, "unknown type 9"},
+		{"truncated map header", "\x0d\x00\x01\x0b", false, "truncated"},
+		{"trailing bytes", "\x00\x00", false, "1 bytes after the struct"},
+		{"compact unknown type", "\x1e\x00", true, "unknown type 14"},
+		{"compact truncated varint", "\x15\x80", true, "truncated"},
+		{"compact huge string", "\x18\xff\xff\xff\xff\x0f", true, "bad element count"},
+		{"compact huge map", "\x1b\xff\xff\xff\xff\x0f\x55", true, "bad element count"},
+		{"compact map of unknown type", "\x1b\x01\xe5\x00", true, "unknown type 14"},
+		{"nesting too deep", strings.Repeat("\x0c\x00\x01", thriftMaxDepth+2) + strings.Repeat("\x00", thriftMaxDepth+3), false, "too deep"},
+		{"compact nesting too deep", strings.Repeat("\x1c", thriftMaxDepth+2) + strings.Repeat("\x00", thriftMaxDepth+3), true, "too deep"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeThrift([]byte(tt.value), tt.compact)
+			if err == nil {
+				t.Fatalf("decodeThrift(%x, %v) = %q, want an error containing %q", tt.value, tt.compact, got, tt.want)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error %q, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestThriftFormatter(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{"binary", "\x08\x00\x01\x00\x00\x00\x2a\x00", "// binary protocol\n"},
+		{"compact", "\x15\x54\x00", "// compact protocol\n"},
+		{"neither", "hello", "(not Thrift: binary protocol: "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (thriftFormatter{}).format([]byte(tt.value)); !strings.HasPrefix(got, tt.want) {
+				t.Errorf("format(%x) = %q, want it to start with %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
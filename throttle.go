@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Token bucket shared by every long scan (exports, verifies, searches), so
+// running the viewer next to live traffic does not saturate disk I/O.
+// Set from -scan-rate; the zero value does not limit anything.
+type scanLimiter struct {
+	mu        sync.Mutex
+	perSecond float64 // Keys or bytes per second; 0 means unlimited
+	byBytes   bool
+	spec      string
+	available float64
+	last      time.Time
+}
+
+var scanRate scanLimiter
+
+// Parse "5000" or "5000/s" (keys per second) or "10MB/s", "512KB/s", "1GB/s" (bytes per second)
+func (l *scanLimiter) Set(value string) error {
+	spec := strings.TrimSuffix(strings.TrimSpace(value), "/s")
+	number, multiplier := spec, 1.0
+	byBytes := false
+	upper := strings.ToUpper(spec)
+	for _, unit := range []struct {
+		suffix string
+		scale  float64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(upper, unit.suffix) {
+			number, multiplier, byBytes = spec[:len(spec)-len(unit.suffix)], unit.scale, true
+			break
+		}
+	}
+
+	rate, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+	if err != nil || rate <= 0 {
+		return fmt.Errorf("invalid scan rate %q, want e.g. 5000/s or 10MB/s", value)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.perSecond, l.byBytes, l.spec = rate*multiplier, byBytes, value
+	l.available, l.last = 0, time.Now()
+	return nil
+}
+
+func (l *scanLimiter) String() string {
+	return l.spec
+}
+
+// Account for one entry read by a scan, sleeping when the budget is used up
+func (l *scanLimiter) wait(key, value []byte) {
+	l.mu.Lock()
+	if l.perSecond == 0 {
+		l.mu.Unlock()
+		return
+	}
+
+	now := time.Now()
+	// Refill for the elapsed time, allowing at most one second of burst
+	l.available += now.Sub(l.last).Seconds() * l.perSecond
+	if l.available > l.perSecond {
+		l.available = l.perSecond
+	}
+	l.last = now
+
+	cost := 1.0
+	if l.byBytes {
+		cost = float64(len(key) + len(value))
+	}
+	l.available -= cost
+	delay := time.Duration(-l.available / l.perSecond * float64(time.Second))
+	l.mu.Unlock()
+
+	// Sleep off the debt in coarse steps rather than once per key
+	if delay > 10*time.Millisecond {
+		time.Sleep(delay)
+	}
+}
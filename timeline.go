@@ -0,0 +1,358 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// Key counts over time: for keys that carry when they were written, the
+// timeline command (and * in the viewer) buckets the matching keys per
+// hour, day, week or month and draws a bar per bucket. A key's time comes
+// from the first timestamp part of a key decoder that fits it, a trailing
+// ULID or UUIDv7, an ISO date in the key text (2024-05-01, 2024-05-01T13:45)
+// or a Unix time of 10, 13, 16 or 19 digits (seconds to nanoseconds).
+
+const (
+	timelineAutoBuckets = 60   // Auto picks the finest bucket giving at most this many bars
+	timelineMaxBuckets  = 1000 // Bars drawn at most
+	timelineWidth       = 50   // Characters of the longest bar
+)
+
+var timelineBuckets = []string{"hour", "day", "week", "month"}
+
+// ISO date with an optional time of day, not inside a longer number
+var isoDatePattern = regexp.MustCompile(`(?:^|[^0-9])(\d{4})-(\d{2})-(\d{2})(?:[T _](\d{2}):(\d{2})(?::(\d{2}))?)?`)
+
+// Runs of digits, checked for a plausible Unix time
+var digitRunPattern = regexp.MustCompile(`[0-9]+`)
+
+// Unix times before or after these are taken as other numbers
+var (
+	unixTimeFrom = time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+	unixTimeTo   = time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// Time a key was written, by the conventions above
+func keyTime(key []byte) (time.Time, bool) {
+	for _, d := range keyDecoders {
+		if !bytes.HasPrefix(key, d.prefix) {
+			continue
+		}
+		values, ok := d.decode(key[len(d.prefix):])
+		if !ok {
+			continue
+		}
+		for i, part := range d.parts {
+			if part.Type != "timestamp" {
+				continue
+			}
+			if t, err := time.Parse(time.RFC3339Nano, values[i]); err == nil {
+				return t, true
+			}
+		}
+	}
+	if id, ulid, ok := trailingID(key); ok {
+		if t, ok := idTimestamp(id, ulid); ok {
+			return t, true
+		}
+	}
+	if !isPrintableText(key) {
+		return time.Time{}, false
+	}
+	if t, ok := textTime(string(key)); ok {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// ISO date or Unix time in a text key
+func textTime(text string) (time.Time, bool) {
+	if m := isoDatePattern.FindStringSubmatch(text); m != nil {
+		field := func(s string) int { n, _ := strconv.Atoi(s); return n }
+		year, month, day := field(m[1]), field(m[2]), field(m[3])
+		t := time.Date(year, time.Month(month), day, field(m[4]), field(m[5]), field(m[6]), 0, time.UTC)
+		if month >= 1 && month <= 12 && t.Day() == day {
+			return t, true
+		}
+	}
+	for _, run := range digitRunPattern.FindAllString(text, -1) {
+		ticks, err := strconv.ParseInt(run, 10, 64)
+		if err != nil {
+			continue
+		}
+		var t time.Time
+		switch len(run) {
+		case 10:
+			t = time.Unix(ticks, 0)
+		case 13:
+			t = time.UnixMilli(ticks)
+		case 16:
+			t = time.UnixMicro(ticks)
+		case 19:
+			t = time.Unix(0, ticks)
+		default:
+			continue
+		}
+		t = t.UTC()
+		if t.After(unixTimeFrom) && t.Before(unixTimeTo) {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// Start of the bucket holding t
+func bucketStart(t time.Time, bucket string) time.Time {
+	switch bucket {
+	case "hour":
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
+	case "day":
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	case "week": // Weeks start on Monday
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	default:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+	}
+}
+
+func nextBucket(t time.Time, bucket string) time.Time {
+	switch bucket {
+	case "hour":
+		return t.Add(time.Hour)
+	case "day":
+		return t.AddDate(0, 0, 1)
+	case "week":
+		return t.AddDate(0, 0, 7)
+	default:
+		return t.AddDate(0, 1, 0)
+	}
+}
+
+func bucketLabel(t time.Time, bucket string) string {
+	switch bucket {
+	case "hour":
+		return t.Format("2006-01-02 15:00")
+	case "month":
+		return t.Format("2006-01")
+	default:
+		return t.Format("2006-01-02")
+	}
+}
+
+type timelineBucket struct {
+	start time.Time
+	count int
+}
+
+type timeline struct {
+	bucket  string
+	buckets []timelineBucket // Every bucket from the first key's to the last's, empty ones too
+	dated   int              // Keys with a time
+	undated int              // Matching keys without one
+	first   time.Time
+	last    time.Time
+}
+
+// Bucket the times of the keys matching search; bucket is hour, day, week,
+// month or "" to pick the finest one giving at most timelineAutoBuckets
+func buildTimeline(search, bucket string, location *time.Location, progress func(string)) (*timeline, error) {
+	if err := checkSearch(search); err != nil {
+		return nil, err
+	}
+	iter := browseReader().NewIterator(intersectRanges(namespaceRange(), searchRange(search)), scanReadOptions)
+	defer iter.Release()
+
+	filter := newKeyFilter(search)
+	tl := &timeline{}
+	hours := make(map[time.Time]int) // Keys per hour, bucketed further once the span is known
+	scanned := 0
+	for iter.Next() {
+		if err := interrupted(); err != nil {
+			return nil, err
+		}
+		scanRate.wait(iter.Key(), iter.Value())
+		scanned++
+		if scanned%100000 == 0 {
+			progress(fmt.Sprintf("%d scanned", scanned))
+		}
+		if !filter(iter.Key(), iter.Value()) {
+			continue
+		}
+		t, ok := keyTime(iter.Key())
+		if !ok {
+			tl.undated++
+			continue
+		}
+		t = t.In(location)
+		if tl.dated == 0 || t.Before(tl.first) {
+			tl.first = t
+		}
+		if tl.dated == 0 || t.After(tl.last) {
+			tl.last = t
+		}
+		tl.dated++
+		hours[bucketStart(t, "hour")]++
+	}
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+	if tl.dated == 0 {
+		return tl, nil
+	}
+
+	if bucket == "" {
+		bucket = timelineBuckets[len(timelineBuckets)-1]
+		for _, b := range timelineBuckets {
+			if bucketCount(tl.first, tl.last, b) <= timelineAutoBuckets {
+				bucket = b
+				break
+			}
+		}
+	}
+	if bucketCount(tl.first, tl.last, bucket) > timelineMaxBuckets {
+		return nil, fmt.Errorf("more than %d %ss between %s and %s; use a coarser -bucket", timelineMaxBuckets, bucket, tl.first.Format(time.RFC3339), tl.last.Format(time.RFC3339))
+	}
+	tl.bucket = bucket
+
+	index := make(map[int64]int) // Bucket by the Unix time of its start
+	for t := bucketStart(tl.first, bucket); !t.After(tl.last); t = nextBucket(t, bucket) {
+		index[t.Unix()] = len(tl.buckets)
+		tl.buckets = append(tl.buckets, timelineBucket{start: t})
+	}
+	for hour, count := range hours {
+		tl.buckets[index[bucketStart(hour, bucket).Unix()]].count += count
+	}
+	return tl, nil
+}
+
+// Buckets from the one holding first to the one holding last, counted up to
+// one past timelineMaxBuckets
+func bucketCount(first, last time.Time, bucket string) int {
+	n := 0
+	for t := bucketStart(first, bucket); !t.After(last) && n <= timelineMaxBuckets; t = nextBucket(t, bucket) {
+		n++
+	}
+	return n
+}
+
+// The chart as text, one bar of # per bucket scaled to width
+func (tl *timeline) render(width int) string {
+	var b strings.Builder
+	if tl.dated == 0 {
+		fmt.Fprintf(&b, "None of the %d matching keys has a timestamp\n", tl.undated)
+		return b.String()
+	}
+	fmt.Fprintf(&b, "%d keys per %s from %s to %s", tl.dated, tl.bucket, tl.first.Format("2006-01-02 15:04:05"), tl.last.Format("2006-01-02 15:04:05 MST"))
+	if tl.undated > 0 {
+		fmt.Fprintf(&b, " (%d matching keys without a timestamp left out)", tl.undated)
+	}
+	b.WriteString("\n\n")
+
+	peak := 0
+	for _, bucket := range tl.buckets {
+		peak = max(peak, bucket.count)
+	}
+	digits := len(strconv.Itoa(peak))
+	for _, bucket := range tl.buckets {
+		bar := bucket.count * width / peak
+		if bar == 0 && bucket.count > 0 {
+			bar = 1 // Show that there is something
+		}
+		line := fmt.Sprintf("%s %*d %s", bucketLabel(bucket.start, tl.bucket), digits, bucket.count, strings.Repeat("#", bar))
+		b.WriteString(strings.TrimRight(line, " ") + "\n")
+	}
+	return b.String()
+}
+
+// Parse -bucket: auto or one of timelineBuckets
+func parseTimelineBucket(value string) (string, error) {
+	if value == "auto" {
+		return "", nil
+	}
+	for _, b := range timelineBuckets {
+		if value == b {
+			return b, nil
+		}
+	}
+	return "", fmt.Errorf("unknown bucket %q, want auto, hour, day, week or month", value)
+}
+
+// Chart key counts over time; exits 1 when no matching key has a timestamp
+func cmdTimeline(args []string) int {
+	fs := flag.NewFlagSet("timeline", flag.ExitOnError)
+	bucketFlag := fs.String("bucket", "auto", "Bucket size: auto, hour, day, week or month")
+	width := fs.Int("width", timelineWidth, "Characters of the longest bar")
+	local := fs.Bool("local", false, "Bucket by local time instead of UTC")
+	fs.Parse(args)
+	if fs.NArg() > 1 || *width < 1 {
+		return commandError("timeline")
+	}
+	bucket, err := parseTimelineBucket(*bucketFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	location := time.UTC
+	if *local {
+		location = time.Local
+	}
+
+	tl, err := buildTimeline(fs.Arg(0), bucket, location, func(string) {})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	fmt.Print(tl.render(*width))
+	if tl.dated == 0 {
+		return 1
+	}
+	return 0
+}
+
+// Chart the keys matching the current search in the background, then show it
+func showTimeline() {
+	search := currentPrefix
+	recordAction("timeline", nil, search)
+	enqueueTask("Key timeline", func(progress func(string)) (string, error) {
+		tl, err := buildTimeline(search, "", time.Local, progress)
+		if err != nil {
+			return "", err
+		}
+		app.QueueUpdateDraw(func() { showTimelineView(tl) })
+		if tl.dated == 0 {
+			return "No matching key has a timestamp", nil
+		}
+		return fmt.Sprintf("Charted %d keys per %s", tl.dated, tl.bucket), nil
+	})
+}
+
+func showTimelineView(tl *timeline) {
+	view := tview.NewTextView()
+	view.SetScrollable(true).SetBorder(true)
+	view.SetTitle(" Keys over time (Esc closes) ")
+	view.SetTitleAlign(tview.AlignLeft)
+	view.SetTitleColor(tcell.ColorYellow)
+	view.SetBackgroundColor(tcell.ColorReset)
+	view.SetTextColor(tcell.ColorWhite)
+	view.SetText(tl.render(timelineWidth))
+	view.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyEsc {
+			pages.RemovePage("timeline-view")
+			app.SetFocus(keyList)
+			return nil
+		}
+		return event
+	})
+	pages.AddPage("timeline-view", view, true, true)
+	app.SetFocus(view)
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/storage"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+var traceReadsPath string // From -trace-reads: log file for read-path tracing
+
+// Reads of one table file during a traced operation
+type tableReads struct {
+	reads int
+	bytes int64
+}
+
+// A Get or iteration being traced; collects the table reads made while it runs
+type readTrace struct {
+	tables     map[int64]*tableReads
+	overlapped bool // Another traced operation ran at the same time, so reads may belong to either
+}
+
+// Read-path tracer: table file reads reported by the storage wrapper are
+// attributed to every operation in flight and logged when it finishes
+type readTracer struct {
+	mu     sync.Mutex
+	out    *bufio.Writer
+	file   *os.File
+	active map[*readTrace]bool
+	db     *leveldb.DB
+	levels map[int64]int // Table file number to level, from the sstables property
+}
+
+var tracer *readTracer
+
+// Storage wrapper that reports every read of a table file and goleveldb's own log lines
+type tracingStorage struct {
+	storage.Storage
+}
+
+func (s tracingStorage) Open(fd storage.FileDesc) (storage.Reader, error) {
+	r, err := s.Storage.Open(fd)
+	if err != nil || fd.Type != storage.TypeTable {
+		return r, err
+	}
+	return tracingReader{Reader: r, num: fd.Num}, nil
+}
+
+func (s tracingStorage) Log(str string) {
+	tracer.logf("leveldb: %s", str)
+	s.Storage.Log(str)
+}
+
+type tracingReader struct {
+	storage.Reader
+	num int64
+}
+
+func (r tracingReader) ReadAt(p []byte, off int64) (int, error) {
+	n, err := r.Reader.ReadAt(p, off)
+	tracer.recordRead(r.num, n)
+	return n, err
+}
+
+// Open path with read tracing to logPath. The block cache is disabled so that
+// every block a lookup needs shows up as a table read.
+func openTraced(path, logPath string, o *opt.Options) (*leveldb.DB, error) {
+	file, err := os.OpenFile(logPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("opening trace log: %w", err)
+	}
+	tracer = &readTracer{out: bufio.NewWriter(file), file: file, active: make(map[*readTrace]bool)}
+
+	stor, err := storage.OpenFile(path, o.ReadOnly)
+	if err != nil {
+		tracer.close()
+		return nil, err
+	}
+	o.DisableBlockCache = true
+	opened, err := leveldb.Open(tracingStorage{stor}, o)
+	if err != nil {
+		stor.Close()
+		tracer.close()
+		return nil, err
+	}
+	tracer.db = opened
+	tracer.logf("tracing reads of %s", path)
+	return opened, nil
+}
+
+func (t *readTracer) begin() *readTrace {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	trace := &readTrace{tables: make(map[int64]*tableReads), overlapped: len(t.active) > 0}
+	for other := range t.active {
+		other.overlapped = true
+	}
+	t.active[trace] = true
+	return trace
+}
+
+func (t *readTracer) recordRead(num int64, n int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for trace := range t.active {
+		reads := trace.tables[num]
+		if reads == nil {
+			reads = &tableReads{}
+			trace.tables[num] = reads
+		}
+		reads.reads++
+		reads.bytes += int64(n)
+	}
+}
+
+// Stop collecting for trace and log what it read
+func (t *readTracer) end(trace *readTrace, started time.Time, what string) {
+	t.mu.Lock()
+	delete(t.active, trace)
+	t.mu.Unlock()
+
+	line := fmt.Sprintf("%s %s: %s", what, time.Since(started).Round(time.Microsecond), t.describe(trace))
+	if trace.overlapped {
+		line += " (overlapped other reads)"
+	}
+	t.logf("%s", line)
+}
+
+// "L0 000012.ldb 1 reads 4096 B, L2 000007.ldb ..." in level order
+func (t *readTracer) describe(trace *readTrace) string {
+	if len(trace.tables) == 0 {
+		return "no table reads (memtable, or no table covers the key)"
+	}
+	nums := make([]int64, 0, len(trace.tables))
+	for num := range trace.tables {
+		nums = append(nums, num)
+	}
+	levels := t.tableLevels(nums)
+	sort.Slice(nums, func(i, j int) bool {
+		if levels[nums[i]] != levels[nums[j]] {
+			return levels[nums[i]] < levels[nums[j]]
+		}
+		return nums[i] < nums[j]
+	})
+
+	parts := make([]string, len(nums))
+	for i, num := range nums {
+		level := "L?"
+		if l, ok := levels[num]; ok {
+			level = "L" + strconv.Itoa(l)
+		}
+		reads := trace.tables[num]
+		parts[i] = fmt.Sprintf("%s %06d.ldb %d reads %d B", level, num, reads.reads, reads.bytes)
+	}
+	return fmt.Sprintf("%d tables: %s", len(nums), strings.Join(parts, ", "))
+}
+
+// Levels of the given table files, re-reading the sstables property when one is unknown
+func (t *readTracer) tableLevels(nums []int64) map[int64]int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, num := range nums {
+		if _, ok := t.levels[num]; !ok {
+			t.levels = parseSSTables(t.db)
+			break
+		}
+	}
+	return t.levels
+}
+
+// Table file numbers per level from goleveldb's "leveldb.sstables" property
+func parseSSTables(d *leveldb.DB) map[int64]int {
+	levels := make(map[int64]int)
+	property, err := d.GetProperty("leveldb.sstables")
+	if err != nil {
+		return levels
+	}
+	level := 0
+	for _, line := range strings.Split(property, "\n") {
+		if n, err := fmt.Sscanf(line, "--- level %d ---", &level); n == 1 && err == nil {
+			continue
+		}
+		if num, _, found := strings.Cut(line, ":"); found {
+			if n, err := strconv.ParseInt(num, 10, 64); err == nil {
+				levels[n] = level
+			}
+		}
+	}
+	return levels
+}
+
+func (t *readTracer) logf(format string, args ...any) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fmt.Fprintf(t.out, "%s %s\n", time.Now().Format("15:04:05.000"), fmt.Sprintf(format, args...))
+	t.out.Flush()
+}
+
+func (t *readTracer) close() {
+	t.out.Flush()
+	t.file.Close()
+}
+
+// Database whose Gets and iterations are logged with the table files they read
+type tracedDB struct {
+	singleDB
+}
+
+func (d tracedDB) Get(key []byte, ro *opt.ReadOptions) ([]byte, error) {
+	trace, started := tracer.begin(), time.Now()
+	value, err := d.singleDB.Get(key, ro)
+	result := "found"
+	if err == leveldb.ErrNotFound {
+		result = "not found"
+	} else if err != nil {
+		result = "error: " + err.Error()
+	}
+	tracer.end(trace, started, fmt.Sprintf("get %q %s", key, result))
+	return value, err
+}
+
+func (d tracedDB) NewIterator(slice *util.Range, ro *opt.ReadOptions) iterator.Iterator {
+	what := "iterate all"
+	if slice != nil {
+		what = fmt.Sprintf("iterate [%q, %q)", slice.Start, slice.Limit)
+	}
+	return &tracedIterator{Iterator: d.singleDB.NewIterator(slice, ro), what: what, trace: tracer.begin(), started: time.Now()}
+}
+
+func (d tracedDB) Close() error {
+	err := d.singleDB.Close()
+	tracer.close()
+	return err
+}
+
+// Iterator logging the keys it visited and the tables read when released
+type tracedIterator struct {
+	iterator.Iterator
+	what     string
+	trace    *readTrace
+	started  time.Time
+	keys     int
+	released bool
+}
+
+func (it *tracedIterator) Next() bool {
+	ok := it.Iterator.Next()
+	if ok {
+		it.keys++
+	}
+	return ok
+}
+
+func (it *tracedIterator) Seek(key []byte) bool {
+	if it.keys == 0 {
+		it.what += fmt.Sprintf(" from %q", key)
+	}
+	ok := it.Iterator.Seek(key)
+	if ok {
+		it.keys++
+	}
+	return ok
+}
+
+func (it *tracedIterator) Release() {
+	if !it.released {
+		it.released = true
+		tracer.end(it.trace, it.started, fmt.Sprintf("%s, %d keys", it.what, it.keys))
+	}
+	it.Iterator.Release()
+}
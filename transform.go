@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// Rewrites or drops records on their way into an export
+type recordTransform interface {
+	// Return the record to write, or keep=false to leave it out
+	apply(key, value []byte) (newKey, newValue []byte, keep bool, err error)
+	close() error
+}
+
+// One transformation from the config file
+type transformRule struct {
+	Prefix      string   `json:"prefix"`       // Only keys with this prefix; empty means all
+	Drop        bool     `json:"drop"`         // Leave matching records out entirely
+	StripFields []string `json:"strip_fields"` // Dotted JSON paths removed from JSON values
+	Redact      []string `json:"redact"`       // Regular expressions masked in the value
+	Replacement string   `json:"replacement"`  // Mask for redacted text, default "[REDACTED]"
+	Encoding    string   `json:"encoding"`     // Re-encode the value: base64, hex, json-compact or json-pretty
+}
+
+// Transform rules with their regular expressions compiled
+type ruleTransform struct {
+	rules  []transformRule
+	redact [][]*regexp.Regexp
+}
+
+func newRuleTransform(rules []transformRule) (*ruleTransform, error) {
+	t := &ruleTransform{rules: rules, redact: make([][]*regexp.Regexp, len(rules))}
+	for i, rule := range rules {
+		switch rule.Encoding {
+		case "", "base64", "hex", "json-compact", "json-pretty":
+		default:
+			return nil, fmt.Errorf("transform %d: unknown encoding %q", i+1, rule.Encoding)
+		}
+		for _, pattern := range rule.Redact {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("transform %d: %w", i+1, err)
+			}
+			t.redact[i] = append(t.redact[i], re)
+		}
+	}
+	return t, nil
+}
+
+func (t *ruleTransform) apply(key, value []byte) ([]byte, []byte, bool, error) {
+	for i, rule := range t.rules {
+		if !bytes.HasPrefix(key, []byte(rule.Prefix)) {
+			continue
+		}
+		if rule.Drop {
+			return nil, nil, false, nil
+		}
+
+		if len(rule.StripFields) > 0 && json.Valid(value) {
+			stripped, err := stripJSONFields(value, rule.StripFields)
+			if err != nil {
+				return nil, nil, false, err
+			}
+			value = stripped
+		}
+
+		replacement := rule.Replacement
+		if replacement == "" {
+			replacement = "[REDACTED]"
+		}
+		for _, re := range t.redact[i] {
+			value = re.ReplaceAllLiteral(value, []byte(replacement))
+		}
+
+		switch rule.Encoding {
+		case "base64":
+			value = []byte(base64.StdEncoding.EncodeToString(value))
+		case "hex":
+			value = []byte(hex.EncodeToString(value))
+		case "json-compact", "json-pretty":
+			if json.Valid(value) {
+				var out bytes.Buffer
+				if rule.Encoding == "json-compact" {
+					json.Compact(&out, value)
+				} else {
+					json.Indent(&out, value, "", "  ")
+				}
+				value = out.Bytes()
+			}
+		}
+	}
+	return key, value, true, nil
+}
+
+func (t *ruleTransform) close() error { return nil }
+
+// Remove dotted paths such as "user.password" from a JSON document
+func stripJSONFields(value []byte, paths []string) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(value))
+	decoder.UseNumber() // Keep large integers intact
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	for _, path := range paths {
+		parts := strings.Split(path, ".")
+		node := doc
+		for i, part := range parts {
+			object, ok := node.(map[string]interface{})
+			if !ok {
+				break
+			}
+			if i == len(parts)-1 {
+				delete(object, part)
+			}
+			node = object[part]
+		}
+	}
+	return json.Marshal(doc)
+}
+
+// External filter process. It receives one JSON object per line on stdin,
+// {"key": ..., "key_b64": ..., "value": ..., "value_b64": ...}, and must answer
+// each with one line: an object with key/value (or key_b64/value_b64) to write,
+// or {"drop": true} to leave the record out.
+type commandTransform struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+}
+
+// Wire format between the exporter and the filter command
+type transformMessage struct {
+	Key      *string `json:"key,omitempty"`
+	KeyB64   *string `json:"key_b64,omitempty"`
+	Value    *string `json:"value,omitempty"`
+	ValueB64 *string `json:"value_b64,omitempty"`
+	Drop     bool    `json:"drop,omitempty"`
+}
+
+func newCommandTransform(command string) (*commandTransform, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("starting transform command: %w", err)
+	}
+	return &commandTransform{cmd: cmd, stdin: stdin, stdout: bufio.NewReader(stdout)}, nil
+}
+
+func (t *commandTransform) apply(key, value []byte) ([]byte, []byte, bool, error) {
+	keyText, valueText := string(key), mixedContentDisplay(value)
+	keyB64, valueB64 := base64.StdEncoding.EncodeToString(key), base64.StdEncoding.EncodeToString(value)
+	request, err := json.Marshal(transformMessage{Key: &keyText, KeyB64: &keyB64, Value: &valueText, ValueB64: &valueB64})
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if _, err := t.stdin.Write(append(request, '\n')); err != nil {
+		return nil, nil, false, fmt.Errorf("transform command: %w", err)
+	}
+
+	line, err := t.stdout.ReadBytes('\n')
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("transform command closed its output: %w", err)
+	}
+	var reply transformMessage
+	if err := json.Unmarshal(line, &reply); err != nil {
+		return nil, nil, false, fmt.Errorf("transform command: bad reply %q: %w", strings.TrimSpace(string(line)), err)
+	}
+	if reply.Drop {
+		return nil, nil, false, nil
+	}
+
+	newKey, err := messageBytes(reply.Key, reply.KeyB64, key)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	newValue, err := messageBytes(reply.Value, reply.ValueB64, value)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	return newKey, newValue, true, nil
+}
+
+// Pick the base64 form over the text form; fall back to the original when neither is present
+func messageBytes(text, b64 *string, original []byte) ([]byte, error) {
+	switch {
+	case b64 != nil:
+		return base64.StdEncoding.DecodeString(*b64)
+	case text != nil:
+		return []byte(*text), nil
+	}
+	return original, nil
+}
+
+func (t *commandTransform) close() error {
+	t.stdin.Close()
+	return t.cmd.Wait()
+}
+
+// Transforms applied one after another
+type transformChain []recordTransform
+
+func (c transformChain) apply(key, value []byte) ([]byte, []byte, bool, error) {
+	for _, t := range c {
+		var keep bool
+		var err error
+		if key, value, keep, err = t.apply(key, value); err != nil || !keep {
+			return nil, nil, false, err
+		}
+	}
+	return key, value, true, nil
+}
+
+func (c transformChain) close() error {
+	var errs []error
+	for _, t := range c {
+		errs = append(errs, t.close())
+	}
+	return errors.Join(errs...)
+}
+
+// Build the export transform from the config plus an optional command override; nil when there is nothing to do
+func newExportTransform(command string) (recordTransform, error) {
+	var chain transformChain
+	if len(cfg.Export.Transforms) > 0 {
+		rules, err := newRuleTransform(cfg.Export.Transforms)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, rules)
+	}
+	if command == "" {
+		command = cfg.Export.Command
+	}
+	if command != "" {
+		external, err := newCommandTransform(command)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, external)
+	}
+	if len(chain) == 0 {
+		return nil, nil
+	}
+	return chain, nil
+}
@@ -0,0 +1,538 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/golang/snappy"
+)
+
+// Values serialized with V8's ValueSerializer, as Chromium stores them in
+// IndexedDB: objects, arrays, maps, sets, dates, strings, numbers, BigInts
+// and typed arrays are shown JavaScript-style. Blink host objects (Blobs,
+// Files, ImageData) are not decoded.
+
+const v8MaxDepth = 64
+
+var errV8Truncated = errors.New("truncated V8 data")
+
+type v8Reader struct {
+	buf     []byte
+	pos     int
+	version uint64 // Of V8's format, from the header
+}
+
+// Names of the typed array kinds of ArrayBufferView tags
+var v8ViewTypes = map[byte]string{
+	'b': "Int8Array", 'B': "Uint8Array", 'C': "Uint8ClampedArray", 'w': "Int16Array", 'W': "Uint16Array",
+	'd': "Int32Array", 'D': "Uint32Array", 'h': "Float16Array", 'f': "Float32Array", 'F': "Float64Array",
+	'q': "BigInt64Array", 'Q': "BigUint64Array", '?': "DataView",
+}
+
+// Error prototypes of error tags
+var v8ErrorTypes = map[byte]string{'E': "EvalError", 'R': "RangeError", 'F': "ReferenceError", 'S': "SyntaxError", 'T': "TypeError", 'U': "URIError"}
+
+// Render a serialized value. Chromium's IndexedDB wrapping (values moved
+// to a blob file or compressed with Snappy) and Blink's envelope around
+// V8's header are unwrapped first.
+func decodeV8Value(data []byte) (string, error) {
+	if len(data) >= 3 && data[0] == 0xff && data[1] == 0x11 {
+		switch data[2] {
+		case 1:
+			size, n := binary.Uvarint(data[3:])
+			if n <= 0 {
+				return "", errV8Truncated
+			}
+			return fmt.Sprintf("(value stored in a blob file, %d bytes)", size), nil
+		case 2:
+			n, err := snappy.DecodedLen(data[3:])
+			if err != nil {
+				return "", err
+			}
+			if n > maxDecompressedBytes || n > 32*len(data) { // No Snappy tag expands more than 64/3 times
+				return "", fmt.Errorf("Snappy data claims %d bytes", n)
+			}
+			if data, err = snappy.Decode(nil, data[3:]); err != nil {
+				return "", err
+			}
+		}
+	}
+	r := &v8Reader{buf: data}
+	if r.pos >= len(r.buf) || r.buf[r.pos] != 0xff {
+		return "", errors.New("no V8 header")
+	}
+	for r.pos < len(r.buf) && r.buf[r.pos] == 0xff { // Blink's version, then V8's
+		r.pos++
+		version, err := r.varint()
+		if err != nil {
+			return "", err
+		}
+		r.version = version
+		if r.pos < len(r.buf) && r.buf[r.pos] == 0xfe { // Blink's trailer offset and size
+			if _, err := r.take(13); err != nil {
+				return "", err
+			}
+		}
+	}
+	var out strings.Builder
+	if err := r.render(&out, "", 0); err != nil {
+		return "", err
+	}
+	for ; r.pos < len(r.buf); r.pos++ {
+		if r.buf[r.pos] != 0 {
+			return "", fmt.Errorf("%d bytes after the value", len(r.buf)-r.pos)
+		}
+	}
+	return out.String(), nil
+}
+
+func (r *v8Reader) take(n uint64) ([]byte, error) {
+	if n > uint64(len(r.buf)-r.pos) {
+		return nil, errV8Truncated
+	}
+	b := r.buf[r.pos : r.pos+int(n)]
+	r.pos += int(n)
+	return b, nil
+}
+
+func (r *v8Reader) varint() (uint64, error) {
+	v, n := binary.Uvarint(r.buf[r.pos:])
+	if n <= 0 {
+		return 0, errV8Truncated
+	}
+	r.pos += n
+	return v, nil
+}
+
+func (r *v8Reader) double() (float64, error) {
+	b, err := r.take(8)
+	if err != nil {
+		return 0, err
+	}
+	return math.Float64frombits(binary.LittleEndian.Uint64(b)), nil
+}
+
+// Next tag, skipping padding
+func (r *v8Reader) tag() (byte, error) {
+	for r.pos < len(r.buf) && r.buf[r.pos] == 0 {
+		r.pos++
+	}
+	if r.pos >= len(r.buf) {
+		return 0, errV8Truncated
+	}
+	r.pos++
+	return r.buf[r.pos-1], nil
+}
+
+// Tag of the next value without reading it
+func (r *v8Reader) peek() (byte, error) {
+	tag, err := r.tag()
+	if err == nil {
+		r.pos--
+	}
+	return tag, err
+}
+
+// Body of a one-byte, two-byte or UTF-8 string after its tag
+func (r *v8Reader) stringBody(tag byte) (string, error) {
+	n, err := r.varint()
+	if err != nil {
+		return "", err
+	}
+	b, err := r.take(n)
+	if err != nil {
+		return "", err
+	}
+	switch tag {
+	case '"': // Latin-1
+		runes := make([]rune, len(b))
+		for i, c := range b {
+			runes[i] = rune(c)
+		}
+		return string(runes), nil
+	case 'c': // UTF-16LE
+		units := make([]uint16, len(b)/2)
+		for i := range units {
+			units[i] = binary.LittleEndian.Uint16(b[2*i:])
+		}
+		return string(utf16.Decode(units)), nil
+	}
+	return string(b), nil
+}
+
+// A string value, tag included, as inside String objects and RegExps
+func (r *v8Reader) string() (string, error) {
+	tag, err := r.tag()
+	if err != nil {
+		return "", err
+	}
+	if tag != '"' && tag != 'c' && tag != 'S' {
+		return "", fmt.Errorf("expected a string, found tag %q", tag)
+	}
+	return r.stringBody(tag)
+}
+
+func (r *v8Reader) bigint() (string, error) {
+	bitfield, err := r.varint()
+	if err != nil {
+		return "", err
+	}
+	digits, err := r.take(bitfield >> 1)
+	if err != nil {
+		return "", err
+	}
+	reversed := make([]byte, len(digits)) // Little-endian digits
+	for i, d := range digits {
+		reversed[len(digits)-1-i] = d
+	}
+	v := new(big.Int).SetBytes(reversed)
+	if bitfield&1 != 0 {
+		v.Neg(v)
+	}
+	return v.String() + "n", nil
+}
+
+func (r *v8Reader) render(out *strings.Builder, indent string, depth int) error {
+	if depth > v8MaxDepth {
+		return errors.New("nesting too deep")
+	}
+	tag, err := r.tag()
+	if err != nil {
+		return err
+	}
+	switch tag {
+	case '_':
+		out.WriteString("undefined")
+	case '0':
+		out.WriteString("null")
+	case 'T', 'F':
+		out.WriteString(strconv.FormatBool(tag == 'T'))
+	case '-': // Hole in a dense array
+		out.WriteString("<empty>")
+	case 'I':
+		v, err := r.varint()
+		if err != nil {
+			return err
+		}
+		out.WriteString(strconv.FormatInt(int64(v>>1)^-int64(v&1), 10))
+	case 'U':
+		v, err := r.varint()
+		if err != nil {
+			return err
+		}
+		out.WriteString(strconv.FormatUint(v, 10))
+	case 'N', 'D', 'n':
+		v, err := r.double()
+		if err != nil {
+			return err
+		}
+		switch tag {
+		case 'D':
+			fmt.Fprintf(out, "Date(%s)", time.UnixMilli(int64(v)).UTC().Format(time.RFC3339Nano))
+		case 'n':
+			fmt.Fprintf(out, "Number(%s)", strconv.FormatFloat(v, 'g', -1, 64))
+		default:
+			out.WriteString(strconv.FormatFloat(v, 'g', -1, 64))
+		}
+	case 'Z', 'z':
+		s, err := r.bigint()
+		if err != nil {
+			return err
+		}
+		if tag == 'z' {
+			s = "Object(" + s + ")"
+		}
+		out.WriteString(s)
+	case '"', 'c', 'S':
+		s, err := r.stringBody(tag)
+		if err != nil {
+			return err
+		}
+		out.WriteString(quoteJSONString(s))
+	case 'y', 'x':
+		fmt.Fprintf(out, "Boolean(%t)", tag == 'y')
+	case 's':
+		s, err := r.string()
+		if err != nil {
+			return err
+		}
+		out.WriteString("String(" + quoteJSONString(s) + ")")
+	case 'R':
+		source, err := r.string()
+		if err != nil {
+			return err
+		}
+		flags, err := r.varint()
+		if err != nil {
+			return err
+		}
+		out.WriteString("/" + source + "/" + v8RegExpFlags(flags))
+	case '^':
+		id, err := r.varint()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "<reference to object #%d>", id)
+	case 'o':
+		return r.renderProperties(out, "", '{', indent, depth)
+	case 'A':
+		return r.renderDenseArray(out, indent, depth)
+	case 'a':
+		length, err := r.varint()
+		if err != nil {
+			return err
+		}
+		return r.renderProperties(out, fmt.Sprintf("Array(%d) ", length), '@', indent, depth)
+	case ';', '\'':
+		return r.renderCollection(out, tag, indent, depth)
+	case 'B', '~':
+		return r.renderArrayBuffer(out, tag)
+	case 'r':
+		return r.renderError(out, depth)
+	case '?': // Object count check
+		if _, err := r.varint(); err != nil {
+			return err
+		}
+		return r.render(out, indent, depth+1)
+	case '\\':
+		return errors.New("Blink host objects (Blob, File, ImageData...) are not supported")
+	default:
+		return fmt.Errorf("unknown tag %q", tag)
+	}
+	return nil
+}
+
+func v8RegExpFlags(flags uint64) string {
+	var s strings.Builder
+	for i, f := range "gimuysvd" { // Bit order of V8's JSRegExp::Flags
+		if flags&(1<<i) != 0 {
+			s.WriteRune(f)
+		}
+	}
+	return s.String()
+}
+
+// Key/value pairs up to the end tag, followed by the property count (and
+// the length, for sparse arrays)
+func (r *v8Reader) renderProperties(out *strings.Builder, label string, end byte, indent string, depth int) error {
+	out.WriteString(label + "{")
+	count := 0
+	for {
+		tag, err := r.peek()
+		if err != nil {
+			return err
+		}
+		if tag == end {
+			r.pos++
+			break
+		}
+		if count > 0 {
+			out.WriteString(",")
+		}
+		out.WriteString("\n" + indent + "  ")
+		if err := r.renderKey(out, indent, depth); err != nil {
+			return err
+		}
+		out.WriteString(": ")
+		if err := r.render(out, indent+"  ", depth+1); err != nil {
+			return err
+		}
+		count++
+	}
+	if _, err := r.varint(); err != nil {
+		return err
+	}
+	if end == '@' {
+		if _, err := r.varint(); err != nil {
+			return err
+		}
+	}
+	if count > 0 {
+		out.WriteString("\n" + indent)
+	}
+	out.WriteString("}")
+	return nil
+}
+
+// Property names are strings or numbers; numbers are quoted like JSON keys
+func (r *v8Reader) renderKey(out *strings.Builder, indent string, depth int) error {
+	var key strings.Builder
+	if err := r.render(&key, indent, depth+1); err != nil {
+		return err
+	}
+	if s := key.String(); strings.HasPrefix(s, `"`) {
+		out.WriteString(s)
+	} else {
+		out.WriteString(quoteJSONString(s))
+	}
+	return nil
+}
+
+// Elements, then any extra properties up to the end tag and the property
+// count and length
+func (r *v8Reader) renderDenseArray(out *strings.Builder, indent string, depth int) error {
+	length, err := r.varint()
+	if err != nil {
+		return err
+	}
+	if length > uint64(len(r.buf)-r.pos) { // Elements take at least a byte each
+		return errV8Truncated
+	}
+	out.WriteString("[")
+	for i := uint64(0); i < length; i++ {
+		if i > 0 {
+			out.WriteString(",")
+		}
+		out.WriteString("\n" + indent + "  ")
+		if err := r.render(out, indent+"  ", depth+1); err != nil {
+			return err
+		}
+	}
+	var extra strings.Builder
+	if err := r.renderProperties(&extra, "", '$', indent, depth); err != nil {
+		return err
+	}
+	if _, err := r.varint(); err != nil {
+		return err
+	}
+	if length > 0 {
+		out.WriteString("\n" + indent)
+	}
+	out.WriteString("]")
+	if extra.String() != "{}" {
+		out.WriteString(" " + extra.String())
+	}
+	return nil
+}
+
+// Map entries or Set members up to the end tag and their count
+func (r *v8Reader) renderCollection(out *strings.Builder, tag byte, indent string, depth int) error {
+	end, label := byte(':'), "Map {"
+	if tag == '\'' {
+		end, label = ',', "Set ["
+	}
+	out.WriteString(label)
+	count := 0
+	for {
+		next, err := r.peek()
+		if err != nil {
+			return err
+		}
+		if next == end {
+			r.pos++
+			break
+		}
+		if count > 0 {
+			out.WriteString(",")
+		}
+		out.WriteString("\n" + indent + "  ")
+		if err := r.render(out, indent+"  ", depth+1); err != nil {
+			return err
+		}
+		if tag == ';' {
+			out.WriteString(" => ")
+			if err := r.render(out, indent+"  ", depth+1); err != nil {
+				return err
+			}
+		}
+		count++
+	}
+	if _, err := r.varint(); err != nil {
+		return err
+	}
+	if count > 0 {
+		out.WriteString("\n" + indent)
+	}
+	if tag == ';' {
+		out.WriteString("}")
+	} else {
+		out.WriteString("]")
+	}
+	return nil
+}
+
+// An ArrayBuffer, shown through the typed array or DataView that follows it if any
+func (r *v8Reader) renderArrayBuffer(out *strings.Builder, tag byte) error {
+	n, err := r.varint()
+	if err != nil {
+		return err
+	}
+	if tag == '~' { // Resizable: maximum length
+		if _, err := r.varint(); err != nil {
+			return err
+		}
+	}
+	data, err := r.take(n)
+	if err != nil {
+		return err
+	}
+	if r.pos >= len(r.buf) || r.buf[r.pos] != 'V' {
+		out.WriteString("ArrayBuffer([b64:" + base64.RawStdEncoding.EncodeToString(data) + "])")
+		return nil
+	}
+	r.pos++
+	sub, err := r.take(1)
+	if err != nil {
+		return err
+	}
+	offset, err := r.varint()
+	if err != nil {
+		return err
+	}
+	length, err := r.varint()
+	if err != nil {
+		return err
+	}
+	if r.version >= 14 { // Flags
+		if _, err := r.varint(); err != nil {
+			return err
+		}
+	}
+	name, ok := v8ViewTypes[sub[0]]
+	if !ok || offset > uint64(len(data)) || length > uint64(len(data))-offset {
+		return fmt.Errorf("bad array buffer view %q", sub[0])
+	}
+	out.WriteString(name + "([b64:" + base64.RawStdEncoding.EncodeToString(data[offset:offset+length]) + "])")
+	return nil
+}
+
+// Error prototype, message, stack and cause up to the end tag
+func (r *v8Reader) renderError(out *strings.Builder, depth int) error {
+	name, message := "Error", ""
+	for {
+		tag, err := r.tag()
+		if err != nil {
+			return err
+		}
+		switch {
+		case tag == '.':
+			fmt.Fprintf(out, "%s(%s)", name, quoteJSONString(message))
+			return nil
+		case v8ErrorTypes[tag] != "":
+			name = v8ErrorTypes[tag]
+		case tag == 'm':
+			if message, err = r.string(); err != nil {
+				return err
+			}
+		case tag == 's':
+			if _, err := r.string(); err != nil {
+				return err
+			}
+		case tag == 'c':
+			var cause strings.Builder
+			if err := r.render(&cause, "", depth+1); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unknown error tag %q", tag)
+		}
+	}
+}
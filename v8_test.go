@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/golang/snappy"
+)
+
+// V8 serialization header for format version 15
+const v8Header = "\xff\x0f"
+
+func v8Double(v float64) string {
+	return string(binary.LittleEndian.AppendUint64(nil, math.Float64bits(v)))
+}
+
+func TestDecodeV8Value(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{"undefined", v8Header + "_", "undefined"},
+		{"null and booleans", v8Header + "A\x030TF$\x00\x03", "[\n  null,\n  true,\n  false\n]"},
+		{"int32", v8Header + "I\x54", "42"},
+		{"negative int32", v8Header + "I\x03", "-2"},
+		{"uint32", v8Header + "U\x80\x01", "128"},
+		{"double", v8Header + "N" + v8Double(1.5), "1.5"},
+		{"date", v8Header + "D" + v8Double(1500), "Date(1970-01-01T00:00:01.5Z)"},
+		{"number object", v8Header + "n" + v8Double(-3), "Number(-3)"},
+		{"bigint", v8Header + "Z\x10\x01\x00\x00\x00\x00\x00\x00\x00", "1n"},
+		{"negative bigint", v8Header + "Z\x13" + strings.Repeat("\x00", 8) + "\x01", "-18446744073709551616n"},
+		{"latin-1 string", v8Header + "\"\x04caf\xe9", `"café"`},
+		{"two-byte string", v8Header + "c\x04a\x00\xac\x20", `"a€"`},
+		{"utf-8 string", v8Header + "S\x03\xe2\x82\xac", `"€"`},
+		{"boolean and string objects", v8Header + "A\x02ys\"\x01x$\x00\x02", "[\n  Boolean(true),\n  String(\"x\")\n]"},
+		{"regexp", v8Header + "R\"\x02ab\x03", "/ab/gi"},
+		{"object", v8Header + "o\"\x01aI\x02I\x02\"\x01b{\x02", "{\n  \"a\": 1,\n  \"1\": \"b\"\n}"},
+		{"empty object", v8Header + "o{\x00", "{}"},
+		{"dense array with hole", v8Header + "A\x02I\x02-$\x00\x02", "[\n  1,\n  <empty>\n]"},
+		{"dense array with property", v8Header + "A\x01I\x02\"\x01kT$\x01\x01", "[\n  1\n] {\n  \"k\": true\n}"},
+		{"sparse array", v8Header + "a\x03I\x02I\x08@\x01\x03", "Array(3) {\n  \"1\": 4\n}"},
+		{"map", v8Header + ";I\x02\"\x01x:\x02", "Map {\n  1 => \"x\"\n}"},
+		{"set", v8Header + "'I\x02I\x04,\x02", "Set [\n  1,\n  2\n]"},
+		{"object reference", v8Header + "A\x02o{\x00^\x01$\x00\x02", "[\n  {},\n  <reference to object #1>\n]"},
+		{"array buffer", v8Header + "B\x02\x01\x02", "ArrayBuffer([b64:AQI])"},
+		{"typed array", v8Header + "B\x04\x01\x02\x03\x04VB\x01\x02\x00", "Uint8Array([b64:AgM])"},
+		{"typed array before version 14", "\xff\x0dB\x02\x01\x02Vw\x00\x02", "Int16Array([b64:AQI])"},
+		{"error", v8Header + "rRm\"\x03bad.", `RangeError("bad")`},
+		{"error with stack and cause", v8Header + "rm\"\x01xs\"\x01sc_.", `Error("x")`},
+		{"object count check", v8Header + "?\x01_", "undefined"},
+		{"padding", v8Header + "\x00\x00I\x54\x00\x00", "42"},
+		{"blink envelope", "\xff\x14\xff\x0fI\x54", "42"},
+		{"blink trailer offset", "\xff\x15\xfe" + strings.Repeat("\x00", 12) + "\xff\x0fI\x54", "42"},
+		{"indexeddb blob", "\xff\x11\x01\x80\x01", "(value stored in a blob file, 128 bytes)"},
+		{"indexeddb snappy", "\xff\x11\x02" + string(snappy.Encode(nil, []byte(v8Header+"I\x54"))), "42"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeV8Value([]byte(tt.value))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("decodeV8Value(%x) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeV8ValueMalformed(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{"empty", "", "no V8 header"},
+		{"no header", "I\x54", "no V8 header"},
+		{"truncated version", "\xff\x80", "truncated"},
+		{"header only", v8Header, "truncated"},
+		{"truncated trailer offset", "\xff\x15\xfe\x00", "truncated"},
+		{"unknown tag", v8Header + "Q", "unknown tag 'Q'"},
+		{"host object", v8Header + "\\", "Blink host objects"},
+		{"truncated double", v8Header + "N\x00\x00", "truncated"},
+		{"string past end", v8Header + "\"\x05ab", "truncated"},
+		{"huge string", v8Header + "S\xff\xff\xff\xff\xff\xff\xff\xff\x7f", "truncated"},
+		{"huge bigint", v8Header + "Z\xff\xff\xff\xff\x0f", "truncated"},
+		{"huge dense array", v8Header + "A\xff\xff\xff\xff\x0f", "truncated"},
+		{"unterminated object", v8Header + "o\"\x01aI\x02", "truncated"},
+		{"unterminated map", v8Header + ";I\x02", "truncated"},
+		{"object without count", v8Header + "o{", "truncated"},
+		{"regexp without string", v8Header + "RI\x02\x00", "expected a string"},
+		{"bad view type", v8Header + "B\x02\x01\x02VX\x00\x01\x00", "bad array buffer view 'X'"},
+		{"view past buffer", v8Header + "B\x02\x01\x02VB\x01\x05\x00", "bad array buffer view 'B'"},
+		{"unknown error tag", v8Header + "rX", "unknown error tag 'X'"},
+		{"unterminated error", v8Header + "rm\"\x01x", "truncated"},
+		{"trailing bytes", v8Header + "I\x02\x01", "1 bytes after the value"},
+		{"nesting too deep", v8Header + strings.Repeat("A\x01", v8MaxDepth+2) + "_" + strings.Repeat("$\x00\x01", v8MaxDepth+2), "too deep"},
+		{"count checks too deep", v8Header + strings.Repeat("?\x00", v8MaxDepth+2) + "_", "too deep"},
+		{"error causes too deep", v8Header + strings.Repeat("rc", v8MaxDepth+2) + "_" + strings.Repeat(".", v8MaxDepth+2), "too deep"},
+		{"truncated blob size", "\xff\x11\x01\x80", "truncated"},
+		{"snappy claiming too much", "\xff\x11\x02\x80\x80\x80\x80\x08\x00", "Snappy data claims"},
+		{"corrupt snappy", "\xff\x11\x02\x05\xff", "snappy"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeV8Value([]byte(tt.value))
+			if err == nil {
+				t.Fatalf("decodeV8Value(%x) = %q, want an error containing %q", tt.value, got, tt.want)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error %q, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+const valueFilterTimeout = 10 * time.Second
+
+var valueFilter string // -value-filter: shell command the shown value is piped through, "" for none
+
+// Pipe a stored value through command and return what it writes to stdout.
+// The key is passed in LEVELDB_VIEWER_KEY_B64, and as text in
+// LEVELDB_VIEWER_KEY when it is printable.
+func runValueFilter(command string, key, value []byte) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), valueFilterTimeout)
+	defer cancel()
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	cmd.Env = append(os.Environ(), "LEVELDB_VIEWER_KEY_B64="+base64.StdEncoding.EncodeToString(key))
+	if isPrintableText(key) && !bytes.ContainsAny(key, "\r\n") {
+		cmd.Env = append(cmd.Env, "LEVELDB_VIEWER_KEY="+string(key))
+	}
+	cmd.Stdin = bytes.NewReader(value)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	cmd.WaitDelay = time.Second // Don't wait on children of the shell still holding its output
+
+	err := cmd.Run()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return "", fmt.Errorf("value filter timed out after %v", valueFilterTimeout)
+	}
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("value filter: %w: %s", err, msg)
+		}
+		return "", fmt.Errorf("value filter: %w", err)
+	}
+	return strings.TrimSuffix(stdout.String(), "\n"), nil
+}
+
+// Show key's stored value piped through the value filter once the command
+// finishes, unless another key was selected meanwhile
+func showFilteredValue(key, value []byte, header string) {
+	command := valueFilter
+	header += fmt.Sprintf("\n[gray](filtered through %s; ! changes the filter)[-]", sanitizeForDisplay(command))
+	valueView.SetText(header + "\n\n[gray]Running the value filter...[-]")
+	go func() {
+		out, err := runValueFilter(command, key, value)
+		app.QueueUpdateDraw(func() {
+			if !bytes.Equal(currentKey, key) || valueFilter != command || pinnedKey != nil {
+				return
+			}
+			if err != nil {
+				valueView.SetText(fmt.Sprintf("%s\n\n[red]Error: %s", header, sanitizeForDisplay(err.Error())))
+				return
+			}
+			valueView.SetText(fmt.Sprintf("%s\n\n[white]Value[::-]: %s", header, sanitizeForDisplay(out)))
+		})
+	}()
+}
+
+// Prompt for the value filter command; an empty command turns filtering off
+func showValueFilterDialog() {
+	if refuseHostAccess() {
+		return
+	}
+	input := newDialogInput(" Command: ")
+	input.SetText(valueFilter)
+	input.SetBorder(true).SetTitle(" Value filter (stdin: raw value, empty to turn off) ")
+	input.SetTitleAlign(tview.AlignLeft)
+	input.SetTitleColor(tcell.ColorYellow)
+	input.SetDoneFunc(func(key tcell.Key) {
+		if key == tcell.KeyEsc {
+			closeDialog("valuefilter")
+			return
+		}
+		if key != tcell.KeyEnter {
+			return
+		}
+		closeDialog("valuefilter")
+		valueFilter = strings.TrimSpace(input.GetText())
+		if currentKey != nil {
+			showKeyValue(currentKey)
+		}
+		if valueFilter == "" {
+			setStatus("[green]Value filter off")
+		} else {
+			setStatus(fmt.Sprintf("[green]Value filter: %s", sanitizeForDisplay(valueFilter)))
+		}
+	})
+	showDialog("valuefilter", input, 80, 3)
+}
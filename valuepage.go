@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+var (
+	valuePageSize  = 100 // Elements per page from -value-page; 0 shows everything
+	valuePage      int   // Page of the shown value, from 0
+	valuePageKey   []byte
+	valuePageCount int // Pages of the shown value; 0 when it fits on one
+)
+
+// Top-level elements of a long value from its rendering by decoder: the
+// items of a JSON array, or the fields of a decoded protobuf message (one per
+// element of a repeated field). open and close wrap a page of them.
+func valueElements(decoder, text string) (elements []string, open, close string) {
+	kind, _, _ := strings.Cut(decoder, ":") // Mapped decoders name their type after a colon
+	switch kind {
+	case "protobuf":
+		for _, line := range strings.Split(text, "\n") {
+			if len(elements) == 0 || !(strings.HasPrefix(line, " ") || line == "}") {
+				elements = append(elements, line)
+			} else {
+				elements[len(elements)-1] += "\n" + line
+			}
+		}
+		return elements, "", ""
+	case "json", "localstorage":
+	default:
+		return nil, "", ""
+	}
+
+	value := []byte(text)
+	if trimmed := bytes.TrimSpace(value); len(trimmed) == 0 || trimmed[0] != '[' {
+		return nil, "", ""
+	}
+	var items []json.RawMessage
+	if err := json.Unmarshal(value, &items); err != nil {
+		return nil, "", ""
+	}
+	elements = make([]string, len(items))
+	for i, item := range items {
+		var pretty bytes.Buffer
+		if err := json.Indent(&pretty, item, "  ", "  "); err != nil {
+			return nil, "", ""
+		}
+		elements[i] = "  " + pretty.String()
+	}
+	return elements, "[", "]"
+}
+
+// Value view text for key in the chosen rendering. In auto format, values
+// with more than valuePageSize elements show only the current page, and
+// the returned line says which; viewDecoder is set to the decoder used.
+func formatPageForView(key, value []byte) (text, pageLine string) {
+	if !bytes.Equal(key, valuePageKey) {
+		valuePageKey, valuePage = append([]byte{}, key...), 0
+	}
+	valuePageCount, viewDecoder, viewConfidence = 0, "", 0
+	if viewFormats[viewFormat].formatter != nil {
+		return formatForView(key, value), ""
+	}
+	text, viewDecoder, viewConfidence = decodeValue(key, value)
+	if valuePageSize <= 0 {
+		return text, ""
+	}
+	elements, open, close := valueElements(viewDecoder, text)
+	if len(elements) <= valuePageSize {
+		return text, ""
+	}
+
+	valuePageCount = (len(elements) + valuePageSize - 1) / valuePageSize
+	valuePage = min(valuePage, valuePageCount-1)
+	first := valuePage * valuePageSize
+	last := min(first+valuePageSize, len(elements))
+
+	var out strings.Builder
+	if open != "" {
+		out.WriteString(open + "\n")
+	}
+	if first > 0 {
+		fmt.Fprintf(&out, "  … %d earlier\n", first)
+	}
+	for i := first; i < last; i++ {
+		out.WriteString(elements[i])
+		if open != "" && i < len(elements)-1 {
+			out.WriteString(",")
+		}
+		out.WriteString("\n")
+	}
+	if last < len(elements) {
+		fmt.Fprintf(&out, "  … %d more\n", len(elements)-last)
+	}
+	out.WriteString(close)
+
+	pageLine = fmt.Sprintf("[yellow]Elements %d-%d of %d[-] [gray](page %d/%d, [ and ] turn pages)[-]",
+		first+1, last, len(elements), valuePage+1, valuePageCount)
+	return strings.TrimSuffix(out.String(), "\n"), pageLine
+}
+
+// Show the previous (-1) or next (+1) page of a paginated value
+func turnValuePage(delta int) {
+	if valuePageCount == 0 || currentKey == nil {
+		return
+	}
+	page := max(0, min(valuePage+delta, valuePageCount-1))
+	if page == valuePage {
+		return
+	}
+	valuePage = page
+	showKeyValue(currentKey)
+	valueView.ScrollToBeginning()
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+const maxReportedKeys = 1000 // Keys listed per mismatch category in a verification report
+
+// Outcome of comparing a copy against its source
+type verifyReport struct {
+	Created      time.Time `json:"created"`
+	Source       string    `json:"source"`
+	Copy         string    `json:"copy"`
+	SourceKeys   int       `json:"source_keys"`
+	CopyKeys     int       `json:"copy_keys"`
+	Matched      int       `json:"matched"`
+	Missing      []string  `json:"missing,omitempty"`   // In the source but not in the copy
+	Extra        []string  `json:"extra,omitempty"`     // In the copy but not in the source
+	Different    []string  `json:"different,omitempty"` // Present in both with different values
+	MissingCount int       `json:"missing_count"`
+	ExtraCount   int       `json:"extra_count"`
+	DiffCount    int       `json:"different_count"`
+	SourceDigest string    `json:"source_digest"` // SHA-256 over every key and value digest, in key order
+	CopyDigest   string    `json:"copy_digest"`
+}
+
+func (r *verifyReport) ok() bool {
+	return r.MissingCount == 0 && r.ExtraCount == 0 && r.DiffCount == 0
+}
+
+func (r *verifyReport) summary() string {
+	if r.ok() {
+		return fmt.Sprintf("Verified %d keys, digests match (%s)", r.Matched, r.SourceDigest[:16])
+	}
+	return fmt.Sprintf("Verification FAILED: %d missing, %d extra, %d different of %d keys",
+		r.MissingCount, r.ExtraCount, r.DiffCount, r.SourceKeys)
+}
+
+// Record enumerator for one side of a verification
+type recordWalker func(fn func(key, value []byte) error) error
+
+// Re-read both sides and compare per-key value digests. Both sides are held
+// in memory as digests only, so either can be listed in any order.
+func verifyCopy(sourceName, copyName string, source, copy recordWalker) (*verifyReport, error) {
+	report := &verifyReport{Created: time.Now(), Source: sourceName, Copy: copyName}
+
+	copied := make(map[string][sha256.Size]byte)
+	err := copy(func(key, value []byte) error {
+		copied[string(key)] = sha256.Sum256(value)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading copy: %w", err)
+	}
+	report.CopyKeys = len(copied)
+
+	seen := make(map[string][sha256.Size]byte, len(copied))
+	err = source(func(key, value []byte) error {
+		report.SourceKeys++
+		digest := sha256.Sum256(value)
+
+		other, ok := copied[string(key)]
+		switch {
+		case !ok:
+			report.MissingCount++
+			report.Missing = appendCapped(report.Missing, key)
+		case other != digest:
+			report.DiffCount++
+			report.Different = appendCapped(report.Different, key)
+		default:
+			report.Matched++
+		}
+		seen[string(key)] = digest
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading source: %w", err)
+	}
+
+	for _, key := range sortedDigestKeys(copied) {
+		if _, ok := seen[key]; !ok {
+			report.ExtraCount++
+			report.Extra = appendCapped(report.Extra, []byte(key))
+		}
+	}
+	report.SourceDigest = digestInKeyOrder(seen)
+	report.CopyDigest = digestInKeyOrder(copied)
+	return report, nil
+}
+
+func sortedDigestKeys(digests map[string][sha256.Size]byte) []string {
+	keys := make([]string, 0, len(digests))
+	for key := range digests {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// SHA-256 over every key and its value digest, in key order
+func digestInKeyOrder(digests map[string][sha256.Size]byte) string {
+	h := sha256.New()
+	for _, key := range sortedDigestKeys(digests) {
+		digest := digests[key]
+		h.Write([]byte(key))
+		h.Write(digest[:])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func appendCapped(list []string, key []byte) []string {
+	if len(list) >= maxReportedKeys {
+		return list
+	}
+	return append(list, string(key))
+}
+
+// Write the report as JSON next to the copy, returning its path
+func writeVerifyReport(report *verifyReport, copyPath string) (string, error) {
+	base := strings.TrimSuffix(copyPath, filepath.Ext(copyPath))
+	if strings.HasSuffix(copyPath, ".manifest.json") {
+		base = strings.TrimSuffix(copyPath, ".manifest.json")
+	}
+	path := strings.TrimSuffix(base, string(os.PathSeparator)) + ".verify.json"
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return path, os.WriteFile(path, data, 0644)
+}
+
+// Compare an export (file or manifest) against the database, as the export would render it today
+func verifyExport(path string, opts exportOptions) (*verifyReport, error) {
+	if opts.format == "csv" {
+		return nil, fmt.Errorf("CSV exports cannot be verified, use text or NDJSON")
+	}
+	files := []string{path}
+	if strings.HasSuffix(path, ".manifest.json") {
+		var err error
+		if files, err = manifestFiles(path); err != nil {
+			return nil, err
+		}
+	}
+
+	source := func(fn func(key, value []byte) error) error {
+		var transform recordTransform
+		if !opts.noTransform {
+			var err error
+			if transform, err = newExportTransform(opts.transformCommand); err != nil {
+				return err
+			}
+			if transform != nil {
+				defer transform.close()
+			}
+		}
+
+		filter := newKeyFilter(opts.search)
+		var r *util.Range
+		if opts.prefix != nil {
+			r = util.BytesPrefix(opts.prefix)
+		}
+		iter := db.NewIterator(intersectRanges(r, searchRange(opts.search)), scanReadOptions)
+		defer iter.Release()
+		for iter.Next() {
+			key, value := iter.Key(), iter.Value()
+			scanRate.wait(key, value)
+			if !filter(key, value) {
+				continue
+			}
+			if transform != nil {
+				var keep bool
+				var err error
+				if key, value, keep, err = transform.apply(key, value); err != nil {
+					return err
+				}
+				if !keep {
+					continue
+				}
+			}
+			if opts.format == "text" || opts.format == "" {
+				// Text exports hold the formatted value
+				value = []byte(formatValue(value))
+			}
+			if err := fn(key, value); err != nil {
+				return err
+			}
+		}
+		return iter.Error()
+	}
+
+	copy := func(fn func(key, value []byte) error) error {
+		for _, file := range files {
+			var walkErr error
+			var err error
+			if strings.HasSuffix(file, ".ndjson") || strings.HasSuffix(file, ".dedup") {
+				scan := scanNDJSONExport
+				if strings.HasSuffix(file, ".dedup") {
+					scan = scanDedupExport
+				}
+				err = scan(file, func(key, value []byte) bool {
+					walkErr = fn(key, value)
+					return walkErr == nil
+				})
+			} else if strings.HasSuffix(file, ".resp") {
+				err = readRedisFile(file, true, &redisStats{}, func(_ int, key, value []byte) error {
+					return fn(key, value)
+				})
+			} else {
+				err = scanTextExport(file, func(key, value string) bool {
+					walkErr = fn([]byte(key), []byte(value))
+					return walkErr == nil
+				})
+			}
+			if err != nil {
+				return err
+			}
+			if walkErr != nil {
+				return walkErr
+			}
+		}
+		return nil
+	}
+
+	return verifyCopy(dbPath, path, source, copy)
+}
@@ -0,0 +1,422 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Which build this is, and updating it in place: the tool is usually
+// copied onto a remote host where no package manager keeps it current, so
+// self-update asks the GitHub releases API for the latest release, downloads
+// the asset built for this OS and architecture, checks it against the
+// release's checksums and swaps it for the running binary.
+
+// Set by release builds and packagers: go build -ldflags "-X main.version=v1.4.0"
+var version = ""
+
+// Where self-update looks for releases, as owner/name
+const releaseRepo = "solessfir/leveldb-viewer"
+
+type buildInfo struct {
+	Version  string `json:"version"`
+	Commit   string `json:"commit,omitempty"`
+	Time     string `json:"time,omitempty"` // Commit time
+	Modified bool   `json:"modified,omitempty"`
+	Go       string `json:"go"`
+	Platform string `json:"platform"`
+}
+
+// The version set at link time, else the module version go install
+// recorded, else "dev"; plus the commit the Go toolchain stamped
+func currentBuild() buildInfo {
+	b := buildInfo{Version: version, Go: runtime.Version(), Platform: runtime.GOOS + "/" + runtime.GOARCH}
+	info, ok := debug.ReadBuildInfo()
+	if ok && b.Version == "" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		b.Version = info.Main.Version
+	}
+	if b.Version == "" {
+		b.Version = "dev"
+	}
+	if ok {
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				b.Commit = setting.Value
+			case "vcs.time":
+				b.Time = setting.Value
+			case "vcs.modified":
+				b.Modified = setting.Value == "true"
+			}
+		}
+	}
+	return b
+}
+
+func (b buildInfo) String() string {
+	text := "leveldb-viewer " + b.Version
+	if b.Commit != "" {
+		text += fmt.Sprintf(" (commit %.12s", b.Commit)
+		if b.Time != "" {
+			text += ", " + b.Time
+		}
+		if b.Modified {
+			text += ", modified"
+		}
+		text += ")"
+	}
+	return text + ", " + b.Go + " " + b.Platform
+}
+
+func cmdVersion(args []string) int {
+	fs := flag.NewFlagSet("version", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "Print the build information as JSON")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		return commandError("version")
+	}
+	if *asJSON {
+		out, _ := json.MarshalIndent(currentBuild(), "", "  ")
+		fmt.Println(string(out))
+		return 0
+	}
+	fmt.Println(currentBuild())
+	return 0
+}
+
+// What the releases API tells about a release
+type release struct {
+	Tag       string         `json:"tag_name"`
+	URL       string         `json:"html_url"`
+	Published time.Time      `json:"published_at"`
+	Assets    []releaseAsset `json:"assets"`
+}
+
+type releaseAsset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+	Size int64  `json:"size"`
+}
+
+func cmdSelfUpdate(args []string) int {
+	fs := flag.NewFlagSet("self-update", flag.ExitOnError)
+	check := fs.Bool("check", false, "Only tell whether a newer release exists; exit 1 if so")
+	tag := fs.String("version", "", "Install this release tag instead of the latest, e.g. v1.3.0")
+	force := fs.Bool("force", false, "Install even when this build is as new, has no version, or the release lists no checksum for the download")
+	repo := fs.String("repo", releaseRepo, "GitHub repository the releases come from, as owner/name")
+	api := fs.String("api", "https://api.github.com", "Releases API base URL, for GitHub Enterprise or a mirror")
+	sendToken := fs.Bool("send-token", false, "Send $GITHUB_TOKEN to an -api host other than api.github.com")
+	fs.Parse(args)
+	if fs.NArg() != 0 || !strings.Contains(*repo, "/") {
+		return commandError("self-update")
+	}
+
+	current := currentBuild().Version
+	rel, err := fetchRelease(strings.TrimSuffix(*api, "/"), *repo, *tag, *sendToken)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	newer := current == "dev" || versionLess(current, rel.Tag)
+	switch {
+	case *check && newer:
+		fmt.Printf("%s is available (this is %s): %s\n", rel.Tag, current, rel.URL)
+		return 1
+	case *check:
+		fmt.Printf("%s is the latest release; this is %s\n", rel.Tag, current)
+		return 0
+	case current == "dev" && !*force:
+		fmt.Fprintf(os.Stderr, "This build has no version, so it cannot tell whether %s is newer; -force installs it anyway\n", rel.Tag)
+		return 2
+	case !newer && *tag == "" && !*force:
+		fmt.Printf("Already up to date (%s)\n", current)
+		return 0
+	}
+
+	asset, err := pickAsset(rel.Assets)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s: %v\n", rel.Tag, err)
+		return 2
+	}
+	fmt.Fprintf(os.Stderr, "Downloading %s (%s)\n", asset.Name, formatBytes(asset.Size))
+	data, err := download(asset.URL)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	if err := verifyAsset(rel.Assets, asset.Name, data, *force); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	binary, err := extractBinary(asset.Name, data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s: %v\n", asset.Name, err)
+		return 2
+	}
+	target, err := replaceExecutable(binary)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	fmt.Printf("Updated %s from %s to %s\n", target, current, rel.Tag)
+	return 0
+}
+
+// The release with tag, or the latest one; $GITHUB_TOKEN goes only to
+// api.github.com unless anyHost is set
+func fetchRelease(api, repo, tag string, anyHost bool) (*release, error) {
+	endpoint := api + "/repos/" + repo + "/releases/latest"
+	if tag != "" {
+		endpoint = api + "/repos/" + repo + "/releases/tags/" + tag
+	}
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" && tokenAllowed(req.URL, anyHost) {
+		req.Header.Set("Authorization", "Bearer "+token) // Avoids the anonymous rate limit
+	}
+	resp, err := updateClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("asking for the release: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound && tag != "" {
+		return nil, fmt.Errorf("%s has no release %s", repo, tag)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%s has no releases", repo)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("asking for the release: %s", resp.Status)
+	}
+	var rel release
+	if err := json.NewDecoder(resp.Body).Decode(&rel); err != nil {
+		return nil, fmt.Errorf("reading the release: %w", err)
+	}
+	return &rel, nil
+}
+
+// Whether the token may be sent to u: always over HTTPS, and to a host
+// other than GitHub's own API only when asked for
+func tokenAllowed(u *url.URL, anyHost bool) bool {
+	return u.Scheme == "https" && (anyHost || strings.EqualFold(u.Hostname(), "api.github.com") && u.Port() == "")
+}
+
+var updateClient = &http.Client{Timeout: 10 * time.Minute}
+
+func download(url string) ([]byte, error) {
+	resp, err := updateClient.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("downloading: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("downloading %s: %s", url, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// The asset built for this OS and architecture: its name holds both, e.g.
+// leveldb-viewer_1.3.0_linux_amd64.tar.gz or leveldb-viewer-windows-amd64.exe
+func pickAsset(assets []releaseAsset) (releaseAsset, error) {
+	arches := map[string][]string{"amd64": {"amd64", "x86_64"}, "arm64": {"arm64", "aarch64"}, "386": {"386", "i386"}}[runtime.GOARCH]
+	if arches == nil {
+		arches = []string{runtime.GOARCH}
+	}
+	for _, asset := range assets {
+		name := strings.ToLower(asset.Name)
+		if isChecksumFile(name) || !strings.Contains(name, runtime.GOOS) {
+			continue
+		}
+		for _, arch := range arches {
+			if strings.Contains(name, arch) {
+				return asset, nil
+			}
+		}
+	}
+	return releaseAsset{}, fmt.Errorf("no download for %s/%s", runtime.GOOS, runtime.GOARCH)
+}
+
+func isChecksumFile(name string) bool {
+	return strings.Contains(name, "checksums") || strings.HasSuffix(name, ".sha256")
+}
+
+// Check data against the release's checksum file (GoReleaser's checksums.txt
+// or <asset>.sha256); a release that lists no checksum for it is refused
+// unless force is set
+func verifyAsset(assets []releaseAsset, name string, data []byte, force bool) error {
+	sum := sha256.Sum256(data)
+	digest := hex.EncodeToString(sum[:])
+	for _, asset := range assets {
+		lower := strings.ToLower(asset.Name)
+		if !strings.Contains(lower, "checksums") && lower != strings.ToLower(name)+".sha256" {
+			continue
+		}
+		list, err := download(asset.URL)
+		if err != nil {
+			return fmt.Errorf("checksums: %w", err)
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(list))
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) == 0 || len(fields) > 1 && strings.TrimPrefix(fields[1], "*") != name {
+				continue
+			}
+			if !strings.EqualFold(fields[0], digest) {
+				return fmt.Errorf("%s does not match its SHA-256 in %s; not installing it", name, asset.Name)
+			}
+			return nil
+		}
+	}
+	if !force {
+		return fmt.Errorf("the release lists no checksum for %s, so it cannot be verified; -force installs it anyway", name)
+	}
+	fmt.Fprintf(os.Stderr, "Warning: the release lists no checksum for %s; installing it unverified (-force)\n", name)
+	return nil
+}
+
+// The executable in a .tar.gz or .zip asset, or the asset itself
+func extractBinary(name string, data []byte) ([]byte, error) {
+	exe := "leveldb-viewer"
+	if runtime.GOOS == "windows" {
+		exe += ".exe"
+	}
+	switch {
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		tr := tar.NewReader(gz)
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			if header.Typeflag == tar.TypeReg && path.Base(header.Name) == exe {
+				return io.ReadAll(tr)
+			}
+		}
+	case strings.HasSuffix(name, ".zip"):
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range zr.File {
+			if path.Base(file.Name) != exe {
+				continue
+			}
+			r, err := file.Open()
+			if err != nil {
+				return nil, err
+			}
+			defer r.Close()
+			return io.ReadAll(r)
+		}
+	default:
+		return data, nil
+	}
+	return nil, fmt.Errorf("holds no %s", exe)
+}
+
+// Swap binary in for the running executable; the old one is renamed aside
+// first, which Windows allows while it runs, and removed where it can be
+func replaceExecutable(binary []byte) (string, error) {
+	target, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	if target, err = filepath.EvalSymlinks(target); err != nil {
+		return "", err
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".leveldb-viewer-update-*")
+	if err != nil {
+		return "", fmt.Errorf("writing next to %s: %w", target, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(binary); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()|0111); err != nil {
+		return "", err
+	}
+
+	old := target + ".old"
+	os.Remove(old) // Left by an update on Windows
+	if err := os.Rename(target, old); err != nil {
+		return "", fmt.Errorf("moving the old binary aside: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		os.Rename(old, target)
+		return "", fmt.Errorf("installing the new binary: %w", err)
+	}
+	os.Remove(old) // Fails on Windows while it runs; removed by the next update
+	return target, nil
+}
+
+// Whether version a is older than b, comparing the dotted numbers of
+// v1.2.3 forms; a release without a pre-release suffix is newer than one with
+func versionLess(a, b string) bool {
+	parse := func(v string) ([]int, string) {
+		v = strings.TrimPrefix(v, "v")
+		v, pre, _ := strings.Cut(v, "-")
+		var parts []int
+		for _, field := range strings.Split(v, ".") {
+			n, err := strconv.Atoi(field)
+			if err != nil {
+				break
+			}
+			parts = append(parts, n)
+		}
+		return parts, pre
+	}
+	pa, preA := parse(a)
+	pb, preB := parse(b)
+	for i := 0; i < max(len(pa), len(pb)); i++ {
+		var x, y int
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+		if x != y {
+			return x < y
+		}
+	}
+	if preA != preB {
+		return preA != "" && (preB == "" || preA < preB)
+	}
+	return false
+}
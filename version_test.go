@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestTokenAllowed(t *testing.T) {
+	tests := []struct {
+		api     string
+		anyHost bool
+		want    bool
+	}{
+		{"https://api.github.com/repos/a/b/releases/latest", false, true},
+		{"https://API.GitHub.com/repos/a/b/releases/latest", false, true},
+		{"http://api.github.com/repos/a/b/releases/latest", false, false},
+		{"https://api.github.com:8443/repos/a/b/releases/latest", false, false},
+		{"https://api.github.com.example.org/repos/a/b/releases/latest", false, false},
+		{"https://github.example.org/api/v3/repos/a/b/releases/latest", false, false},
+		{"https://github.example.org/api/v3/repos/a/b/releases/latest", true, true},
+		{"http://github.example.org/api/v3/repos/a/b/releases/latest", true, false},
+	}
+	for _, tt := range tests {
+		u, err := url.Parse(tt.api)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := tokenAllowed(u, tt.anyHost); got != tt.want {
+			t.Errorf("tokenAllowed(%s, %v) = %v, want %v", tt.api, tt.anyHost, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/rivo/tview"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+// Watching the database: -watch polls its directory, and when its files
+// changed the viewer takes a new snapshot, reloads the loaded keys and the
+// value shown, and marks the keys added, changed or removed since the last
+// refresh. Removed keys stay listed, struck through, until the next one.
+// A temporary copy of a locked database is copied again from the original,
+// so the writes of the app holding it show up as it flushes them to disk.
+// The changes found are fed to the write heatmap too.
+
+const defaultWatchInterval = 2 * time.Second
+
+var (
+	watchInterval time.Duration             // -watch; 0 when not watching
+	openOptions   *opt.Options              // Options the database was opened with, for opening a fresh copy
+	watchSeen     = make(map[string]uint64) // Signature of each watched directory when last refreshed
+	watchMarks    = make(map[string]byte)   // '+', '~' or '-' for the keys the last refresh found changed
+	watchBusy     bool                      // A fresh copy is being made
+)
+
+// -watch alone polls every 2s; -watch=500ms sets the interval
+type watchFlag struct{}
+
+func (watchFlag) String() string {
+	if watchInterval == 0 {
+		return ""
+	}
+	return watchInterval.String()
+}
+
+func (watchFlag) Set(value string) error {
+	if on, err := strconv.ParseBool(value); err == nil {
+		watchInterval = 0
+		if on {
+			watchInterval = defaultWatchInterval
+		}
+		return nil
+	}
+	interval, err := time.ParseDuration(value)
+	if err != nil || interval < 100*time.Millisecond {
+		return fmt.Errorf("want an interval of at least 100ms, e.g. -watch=1s")
+	}
+	watchInterval = interval
+	return nil
+}
+
+func (watchFlag) IsBoolFlag() bool { return true }
+
+// Hash of the names, sizes and modification times of the files in dir; the
+// lock and the info log change without the data changing
+func dirSignature(dir string) (uint64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	h := fnv.New64a()
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || name == "LOCK" || name == "LOG" || name == "LOG.old" {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue // Deleted by a compaction since the listing
+		}
+		fmt.Fprintf(h, "%s %d %d\n", name, info.Size(), info.ModTime().UnixNano())
+	}
+	return h.Sum64(), nil
+}
+
+// Start polling the open database's directory; nothing without -watch
+func startWatch() {
+	if watchInterval == 0 {
+		return
+	}
+	if sig, err := dirSignature(dbPath); err == nil {
+		watchSeen[dbPath] = sig
+	}
+	go func() {
+		ticker := time.NewTicker(watchInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if shuttingDown.Load() {
+				return
+			}
+			app.QueueUpdateDraw(watchTick)
+		}
+	}()
+}
+
+// Refresh when the directory of the shown database changed since the last refresh
+func watchTick() {
+	if watchBusy || len(pendingChanges) > 0 {
+		return // Staged changes are committed or discarded first
+	}
+	path := dbPath
+	sig, err := dirSignature(path)
+	if err != nil || sig == watchSeen[path] {
+		return
+	}
+	if activeTab != 0 || tempCopy == "" {
+		watchSeen[path] = sig
+		applyWatch(nil, "")
+		return
+	}
+	if taskIsRunning() {
+		return // The copy a task reads is not swapped under it
+	}
+
+	watchBusy = true
+	go func() {
+		fresh, dir, err := openFreshCopy(path)
+		app.QueueUpdateDraw(func() {
+			watchBusy = false
+			if err != nil {
+				setStatus(fmt.Sprintf("[red]Error copying %s again: %v", tview.Escape(path), err))
+				return
+			}
+			if activeTab != 0 || taskIsRunning() || shuttingDown.Load() {
+				fresh.Close()
+				os.RemoveAll(dir)
+				return
+			}
+			watchSeen[path] = sig
+			applyWatch(fresh, dir)
+		})
+	}()
+}
+
+// Copy the locked database at path again, the way it was copied at open, and open the copy
+func openFreshCopy(path string) (database, string, error) {
+	var dir string
+	var err error
+	if bedrockWorld {
+		dir, err = copyBedrockWorld(path)
+	} else {
+		dir, err = copyDatabaseDir(path)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	opened, err := leveldb.OpenFile(dir, openOptions)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, "", err
+	}
+	return singleDB{opened}, dir, nil
+}
+
+// Pin a new snapshot, of fresh in place of the open copy when given, and
+// reload the loaded keys marking what changed since the old snapshot
+func applyWatch(fresh database, dir string) {
+	var oldDB database
+	var oldCopy string
+	if fresh != nil {
+		oldDB, oldCopy = db, tempCopy
+		db, tempCopy = fresh, dir
+		tabs[activeTab].db = db
+	}
+	snap, err := db.snapshot()
+	if err != nil {
+		if fresh != nil {
+			db, tempCopy = oldDB, oldCopy
+			tabs[activeTab].db = db
+			fresh.Close()
+			os.RemoveAll(dir)
+		}
+		setStatus(fmt.Sprintf("[red]Error taking a snapshot: %v", err))
+		return
+	}
+	old := swapSnapshot(snap)
+	defer func() {
+		if old != nil {
+			old.Release()
+		}
+		if oldDB != nil {
+			oldDB.Close()
+			os.RemoveAll(oldCopy)
+		}
+	}()
+
+	keys, more, err := scanPage(listSource(currentPrefix), listFilter(currentPrefix), nil, max(len(displayedKeys), pageSize))
+	if err != nil {
+		setStatus(fmt.Sprintf("[red]Error: %v", err))
+		return
+	}
+	marks := make(map[string]byte)
+	listed := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		listed[string(key)] = true
+		if old == nil {
+			continue
+		}
+		before, err := old.Get(key, nil)
+		switch {
+		case errors.Is(err, leveldb.ErrNotFound):
+			marks[string(key)] = '+'
+		case err != nil:
+		default:
+			if now, err := snap.Get(key, nil); err == nil && !bytes.Equal(before, now) {
+				marks[string(key)] = '~'
+			}
+		}
+	}
+
+	// Keys gone from the database keep their place before the listed key that followed them
+	var removed [][]byte
+	removedBefore := make(map[string][][]byte)
+	for _, key := range displayedKeys {
+		if listed[string(key)] {
+			if len(removed) > 0 {
+				removedBefore[string(key)], removed = removed, nil
+			}
+			continue
+		}
+		if watchMarks[string(key)] == '-' {
+			continue // Shown as removed since the refresh before
+		}
+		if _, err := snap.Get(key, nil); !errors.Is(err, leveldb.ErrNotFound) {
+			continue // Still there, only moved past the loaded pages
+		}
+		marks[string(key)] = '-'
+		removed = append(removed, key)
+	}
+	var merged [][]byte
+	for _, key := range keys {
+		merged = append(merged, removedBefore[string(key)]...)
+		merged = append(merged, key)
+	}
+	merged = append(merged, removed...)
+
+	if len(marks) > 0 {
+		watchMarks = marks
+	}
+	for key, kind := range marks {
+		heat.record([]byte(key), kind == '-')
+	}
+	showWatchedKeys(merged, more)
+	if len(marks) > 0 {
+		setStatus(watchSummary(marks))
+	}
+}
+
+// Replace the key list with keys, keeping the selected key and the scroll position
+func showWatchedKeys(keys [][]byte, more bool) {
+	offset, _ := keyList.GetOffset()
+	selected := keyList.GetCurrentItem()
+	for i, key := range keys {
+		if currentKey != nil && bytes.Equal(key, currentKey) {
+			selected = i
+			break
+		}
+	}
+	displayedKeys, hasMoreKeys = keys, more
+	keyList.Clear()
+	for i := range keys {
+		keyList.AddItem(listItemText(i), "", 0, nil)
+	}
+	if len(keys) > 0 {
+		keyList.SetCurrentItem(min(selected, len(keys)-1))
+		keyList.SetOffset(offset, 0)
+		currentKey = keys[keyList.GetCurrentItem()]
+		showKeyValue(currentKey)
+	}
+	updateKeyListTitle()
+	updateStatusBar()
+}
+
+func watchSummary(marks map[string]byte) string {
+	var added, changed, removed int
+	for _, kind := range marks {
+		switch kind {
+		case '+':
+			added++
+		case '~':
+			changed++
+		case '-':
+			removed++
+		}
+	}
+	return fmt.Sprintf("[green]%s: %d added, %d changed, %d removed among the loaded keys",
+		time.Now().Format("15:04:05"), added, changed, removed)
+}
+
+// Label after a key in the list for what the last refresh found
+func watchLabel(key []byte) string {
+	switch watchMarks[string(key)] {
+	case '+':
+		return " [green](added)[-]"
+	case '~':
+		return " [yellow](changed)[-]"
+	case '-':
+		return " [red](removed)[-]"
+	}
+	return ""
+}
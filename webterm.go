@@ -0,0 +1,511 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/gdamore/tcell/v2/terminfo"
+)
+
+// serve -tui: the viewer itself in the browser, for when the database sits
+// on a host nobody can SSH to. The /tui page runs xterm.js and talks to the
+// viewer over a WebSocket; the viewer draws to that connection as it would
+// to a terminal. There is one viewer: a second browser takes it over from
+// the first, and q quits it together with the server. The WebSocket needs
+// the same credentials as the API, with every capability but write on a
+// read-only database. Those capabilities cover the database, not the host:
+// unless serve -tui-host-access is given, the browser viewer cannot run
+// commands (value filters, the clipboard) or read and write files on the
+// server (dumps, exports, reports, workspaces, export history, restores,
+// diffs against another path).
+
+const (
+	wsGUID       = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11" // RFC 6455
+	wsMaxMessage = 1 << 20
+
+	wsText   = 0x1
+	wsBinary = 0x2
+	wsClose  = 0x8
+	wsPing   = 0x9
+	wsPong   = 0xa
+)
+
+var (
+	webTerm       *webTerminal // Set by serve -tui
+	tuiHostAccess bool         // serve -tui-host-access
+)
+
+// Whether an action that runs a command or reads or writes files on the host
+// is refused, because the viewer runs in a browser without -tui-host-access
+func refuseHostAccess() bool {
+	if webTerm == nil || tuiHostAccess {
+		return false
+	}
+	setStatus("[red]Not available in the browser viewer: it runs commands or uses files on the server (serve -tui-host-access allows it)")
+	return true
+}
+
+// A server side WebSocket connection
+type wsConn struct {
+	conn net.Conn
+	in   *bufio.Reader
+	mu   sync.Mutex // Serializes writes
+}
+
+// Take over the connection of a WebSocket handshake request
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request) (*wsConn, error) {
+	if !headerContains(r.Header, "Connection", "upgrade") || !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		return nil, errors.New("not a WebSocket handshake")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" || r.Header.Get("Sec-WebSocket-Version") != "13" {
+		return nil, errors.New("unsupported WebSocket version")
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, errors.New("the connection cannot be taken over")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{}) // The server's header timeout no longer applies
+	sum := sha1.Sum([]byte(key + wsGUID))
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+		base64.StdEncoding.EncodeToString(sum[:]))
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &wsConn{conn: conn, in: rw.Reader}, nil
+}
+
+// Whether a comma separated header lists token
+func headerContains(h http.Header, name, token string) bool {
+	for _, value := range h.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// The next text or binary message, answering pings on the way
+func (c *wsConn) readMessage() (byte, []byte, error) {
+	var opcode byte
+	var message []byte
+	for {
+		var head [2]byte
+		if _, err := io.ReadFull(c.in, head[:]); err != nil {
+			return 0, nil, err
+		}
+		fin, op := head[0]&0x80 != 0, head[0]&0x0f
+		if head[1]&0x80 == 0 {
+			return 0, nil, errors.New("unmasked frame from the browser")
+		}
+		size := uint64(head[1] & 0x7f)
+		switch size {
+		case 126:
+			var ext [2]byte
+			if _, err := io.ReadFull(c.in, ext[:]); err != nil {
+				return 0, nil, err
+			}
+			size = uint64(binary.BigEndian.Uint16(ext[:]))
+		case 127:
+			var ext [8]byte
+			if _, err := io.ReadFull(c.in, ext[:]); err != nil {
+				return 0, nil, err
+			}
+			size = binary.BigEndian.Uint64(ext[:])
+		}
+		if size > wsMaxMessage || uint64(len(message))+size > wsMaxMessage {
+			return 0, nil, errors.New("message too large")
+		}
+		var mask [4]byte
+		if _, err := io.ReadFull(c.in, mask[:]); err != nil {
+			return 0, nil, err
+		}
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(c.in, payload); err != nil {
+			return 0, nil, err
+		}
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+
+		switch op {
+		case wsClose:
+			c.writeFrame(wsClose, nil)
+			return 0, nil, io.EOF
+		case wsPing:
+			c.writeFrame(wsPong, payload)
+			continue
+		case wsPong:
+			continue
+		case 0: // Continuation
+			message = append(message, payload...)
+		default:
+			opcode, message = op, payload
+		}
+		if fin {
+			return opcode, message, nil
+		}
+	}
+}
+
+func (c *wsConn) writeFrame(opcode byte, data []byte) error {
+	header := []byte{0x80 | opcode}
+	switch size := len(data); {
+	case size < 126:
+		header = append(header, byte(size))
+	case size <= 0xffff:
+		header = append(header, 126)
+		header = binary.BigEndian.AppendUint16(header, uint16(size))
+	default:
+		header = append(header, 127)
+		header = binary.BigEndian.AppendUint64(header, uint64(size))
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := c.conn.Write(header); err != nil {
+		return err
+	}
+	_, err := c.conn.Write(data)
+	return err
+}
+
+func (c *wsConn) close() error {
+	return c.conn.Close()
+}
+
+// The terminal a browser connection stands for, as tcell sees it
+type webTTY struct {
+	conn    *wsConn
+	input   chan []byte
+	wake    chan struct{}
+	sized   chan struct{} // Closed at the browser's first size
+	closed  chan struct{}
+	once    sync.Once
+	mu      sync.Mutex // Guards size, resized and known
+	size    tcell.WindowSize
+	resized func()
+	known   bool
+	pending []byte // Input read from the browser but not yet by tcell
+}
+
+func newWebTTY(conn *wsConn) *webTTY {
+	return &webTTY{
+		conn:   conn,
+		input:  make(chan []byte),
+		wake:   make(chan struct{}, 1),
+		sized:  make(chan struct{}),
+		closed: make(chan struct{}),
+		size:   tcell.WindowSize{Width: 80, Height: 24},
+	}
+}
+
+func (t *webTTY) Start() error { return nil }
+func (t *webTTY) Stop() error  { return nil }
+
+// Let a blocked Read return, as tcell expects when it stops reading
+func (t *webTTY) Drain() error {
+	select {
+	case t.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (t *webTTY) NotifyResize(cb func()) {
+	t.mu.Lock()
+	t.resized = cb
+	t.mu.Unlock()
+}
+
+func (t *webTTY) WindowSize() (tcell.WindowSize, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.size, nil
+}
+
+// Input typed in the browser. When the browser went away, Read waits for
+// the next one to take over rather than ending the viewer.
+func (t *webTTY) Read(p []byte) (int, error) {
+	if len(t.pending) == 0 {
+		select {
+		case t.pending = <-t.input:
+		case <-t.wake:
+			return 0, nil
+		case <-t.closed:
+			return 0, io.EOF
+		}
+	}
+	n := copy(p, t.pending)
+	t.pending = t.pending[n:]
+	return n, nil
+}
+
+// Output for the browser; dropped once it went away
+func (t *webTTY) Write(p []byte) (int, error) {
+	t.conn.writeFrame(wsBinary, p)
+	return len(p), nil
+}
+
+func (t *webTTY) Close() error {
+	t.once.Do(func() {
+		close(t.closed)
+		t.conn.close()
+	})
+	return nil
+}
+
+// Pass the browser's messages on: "0" and input typed, or "1" and the
+// terminal's size as {"cols", "rows"}
+func (t *webTTY) pump() {
+	defer t.conn.close()
+	for {
+		opcode, message, err := t.conn.readMessage()
+		if err != nil {
+			return
+		}
+		if opcode != wsText || len(message) == 0 {
+			continue
+		}
+		switch message[0] {
+		case '0':
+			select {
+			case t.input <- message[1:]:
+			case <-t.closed:
+				return
+			}
+		case '1':
+			var size struct{ Cols, Rows int }
+			if json.Unmarshal(message[1:], &size) != nil || size.Cols <= 0 || size.Rows <= 0 {
+				continue
+			}
+			t.mu.Lock()
+			t.size = tcell.WindowSize{Width: size.Cols, Height: size.Rows}
+			first := !t.known
+			t.known = true
+			resized := t.resized
+			t.mu.Unlock()
+			if first {
+				close(t.sized)
+			}
+			if resized != nil {
+				resized()
+			}
+		}
+	}
+}
+
+type webTerminal struct {
+	api      *apiServer
+	cdn      string
+	first    chan tcell.Screen // The first browser's screen, for main to run the viewer on
+	stopHTTP func()            // Stops the server and releases what it holds
+
+	mu      sync.Mutex
+	started bool
+	current *webTTY
+}
+
+func newWebTerminal(api *apiServer, cdn string, stopHTTP func()) *webTerminal {
+	return &webTerminal{api: api, cdn: strings.TrimSuffix(cdn, "/"), first: make(chan tcell.Screen, 1), stopHTTP: stopHTTP}
+}
+
+// Once the viewer quit: detach the browser and stop the server
+func (wt *webTerminal) shutdown() {
+	wt.mu.Lock()
+	if wt.current != nil {
+		wt.current.conn.writeFrame(wsBinary, []byte("\r\n\x1b[0m[The viewer quit]\r\n"))
+		wt.current.Close()
+	}
+	wt.mu.Unlock()
+	wt.stopHTTP()
+}
+
+func (wt *webTerminal) register(mux *http.ServeMux) {
+	need := capRead | capExport | capAdmin
+	if !readOnly {
+		need |= capWrite
+	}
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/tui", http.StatusFound)
+	})
+	mux.HandleFunc("GET /tui", wt.page)
+	mux.HandleFunc("GET /tui/ws", wt.api.handle(need, wt.connect))
+}
+
+// Wait for the first browser to connect; errInterrupted when the server is stopped first
+func (wt *webTerminal) firstScreen() (tcell.Screen, error) {
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case screen := <-wt.first:
+			return screen, nil
+		case <-ticker.C:
+			if err := interrupted(); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// Attach a browser to the viewer, taking it over from the one attached before
+func (wt *webTerminal) connect(w http.ResponseWriter, r *http.Request, cred *serveCredential) {
+	if !sameOrigin(r) {
+		apiError(w, http.StatusForbidden, "the page connecting is from another site")
+		return
+	}
+	if shuttingDown.Load() {
+		apiError(w, http.StatusServiceUnavailable, "the viewer quit")
+		return
+	}
+	conn, err := upgradeWebSocket(w, r)
+	if err != nil {
+		apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	tty := newWebTTY(conn)
+	go tty.pump()
+	select {
+	case <-tty.sized:
+	case <-time.After(2 * time.Second): // Draw at 80x24 until it tells
+	}
+
+	ti, err := terminfo.LookupTerminfo("xterm-256color")
+	var screen tcell.Screen
+	if err == nil {
+		screen, err = tcell.NewTerminfoScreenFromTtyTerminfo(tty, ti)
+	}
+	if err != nil {
+		tty.conn.writeFrame(wsBinary, []byte("Error: "+err.Error()+"\r\n"))
+		tty.Close()
+		return
+	}
+
+	wt.mu.Lock()
+	old, first := wt.current, !wt.started
+	wt.current, wt.started = tty, true
+	wt.mu.Unlock()
+	if first {
+		wt.first <- screen
+		return
+	}
+	app.SetScreen(screen)
+	if old != nil {
+		old.conn.writeFrame(wsBinary, []byte("\r\n\x1b[0m[The viewer was taken over by "+cred.name+" in another browser]\r\n"))
+		old.Close()
+	}
+}
+
+// Whether a browser request comes from a page of this server; cookies go
+// along with WebSocket handshakes from any site
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true // Not a browser
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+func (wt *webTerminal) page(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	fmt.Fprintf(w, webTerminalPage, wt.cdn)
+}
+
+// The /tui page; %[1]s is where xterm.js is loaded from
+const webTerminalPage = `<!doctype html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>leveldb-viewer</title>
+<link rel="stylesheet" href="%[1]s/@xterm/xterm@5.5.0/css/xterm.css">
+<script src="%[1]s/@xterm/xterm@5.5.0/lib/xterm.js"></script>
+<script src="%[1]s/@xterm/addon-fit@0.10.0/lib/addon-fit.js"></script>
+<style>
+html, body { margin: 0; height: 100%%; background: #000; color: #ccc; font-family: sans-serif; }
+#term { height: 100%%; }
+#login { position: fixed; top: 30%%; left: 50%%; transform: translateX(-50%%); background: #222; padding: 1.5em; border: 1px solid #555; }
+#login input { display: block; margin: 0.3em 0 0.8em; width: 20em; }
+#error { color: #f66; }
+</style>
+</head>
+<body>
+<div id="term"></div>
+<form id="login" hidden>
+  <div>Token<input id="token" type="password" autocomplete="off"></div>
+  <div>or user<input id="user" autocomplete="username"></div>
+  <div>and password<input id="password" type="password" autocomplete="current-password"></div>
+  <button>Log in</button> <span id="error"></span>
+</form>
+<script>
+const term = new Terminal({cursorBlink: true});
+const fit = new FitAddon.FitAddon();
+term.loadAddon(fit);
+term.open(document.getElementById('term'));
+fit.fit();
+
+let ws = null;
+function send(message) {
+  if (ws && ws.readyState === WebSocket.OPEN) ws.send(message);
+}
+function sendSize() {
+  send('1' + JSON.stringify({cols: term.cols, rows: term.rows}));
+}
+term.onData(data => send('0' + data));
+window.addEventListener('resize', () => { fit.fit(); sendSize(); });
+
+function connect() {
+  let opened = false;
+  ws = new WebSocket((location.protocol === 'https:' ? 'wss://' : 'ws://') + location.host + '/tui/ws');
+  ws.binaryType = 'arraybuffer';
+  ws.onopen = () => { opened = true; sendSize(); term.focus(); };
+  ws.onmessage = event => term.write(new Uint8Array(event.data));
+  ws.onclose = () => {
+    if (!opened) {
+      document.getElementById('login').hidden = false;
+      return;
+    }
+    term.write('\r\n\x1b[0m[Disconnected; reload the page to attach again]\r\n');
+  };
+}
+
+document.getElementById('login').onsubmit = async event => {
+  event.preventDefault();
+  const token = document.getElementById('token').value;
+  const user = document.getElementById('user').value;
+  const password = document.getElementById('password').value;
+  const auth = token ? 'Bearer ' + token : 'Basic ' + btoa(user + ':' + password);
+  const response = await fetch('/api/login', {method: 'POST', headers: {Authorization: auth}});
+  if (!response.ok) {
+    document.getElementById('error').textContent = (await response.json()).error || response.statusText;
+    return;
+  }
+  document.getElementById('login').hidden = true;
+  connect();
+};
+connect();
+</script>
+</body>
+</html>
+`
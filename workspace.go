@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// Saved viewer state, reopened with -workspace <name>. Keys are stored as
+// base64 so binary keys survive the round trip.
+type workspace struct {
+	Saved     time.Time `json:"saved"`
+	Database  string    `json:"database"`
+	Search    string    `json:"search,omitempty"`
+	Selected  []byte    `json:"selected,omitempty"`
+	Pinned    []byte    `json:"pinned,omitempty"`
+	Format    string    `json:"format,omitempty"`
+	Keys      string    `json:"keys,omitempty"` // Key rendering
+	ShowQueue bool      `json:"show_queue,omitempty"`
+	ShowHelp  bool      `json:"show_help,omitempty"`
+}
+
+var (
+	workspaceName string     // From -workspace; saved again on quit
+	openWorkspace *workspace // Loaded at startup, applied once the first page is shown
+)
+
+func workspacePath(name string) (string, error) {
+	dir := configDir()
+	if dir == "" {
+		return "", errors.New("no user config directory for workspaces")
+	}
+	if name == "" || safeFileName(name) != name || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("invalid workspace name %q", name)
+	}
+	return filepath.Join(dir, "workspaces", name+".json"), nil
+}
+
+// Read a saved workspace; a workspace that was never saved is returned as nil
+func loadWorkspace(name string) (*workspace, error) {
+	path, err := workspacePath(name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var ws workspace
+	if err := json.Unmarshal(data, &ws); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return &ws, nil
+}
+
+// Capture the current viewer state under name
+func saveWorkspace(name string) error {
+	path, err := workspacePath(name)
+	if err != nil {
+		return err
+	}
+	absPath, err := filepath.Abs(dbPath)
+	if err != nil {
+		absPath = dbPath
+	}
+	ws := workspace{
+		Saved:     time.Now(),
+		Database:  absPath,
+		Search:    currentPrefix,
+		Selected:  currentKey,
+		Pinned:    pinnedKey,
+		Format:    viewFormats[viewFormat].name,
+		Keys:      keyRenderings[keyRendering],
+		ShowQueue: showQueue,
+		ShowHelp:  showHelp,
+	}
+	data, err := json.MarshalIndent(ws, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// Restore the loaded workspace on the UI goroutine
+func applyWorkspace() {
+	ws := openWorkspace
+	openWorkspace = nil
+	if ws == nil {
+		return
+	}
+
+	if ws.Search != "" {
+		searchBox.SetText(ws.Search)
+	}
+	if ws.Format != "" {
+		setViewFormat(ws.Format)
+	}
+	if ws.Keys != "" {
+		setKeyRenderingAndRedraw(ws.Keys)
+	}
+	if ws.ShowQueue != showQueue {
+		toggleQueuePanel()
+	}
+	if ws.ShowHelp != showHelp {
+		toggleHelpWindow()
+	}
+	if ws.Pinned != nil {
+		pinKey(ws.Pinned)
+	}
+	if ws.Selected != nil {
+		if err := seekToKey(ws.Selected); err != nil {
+			setStatus(fmt.Sprintf("[red]Error restoring workspace: %v", err))
+			return
+		}
+	}
+	setStatus(fmt.Sprintf("[green]Opened workspace %s", tview.Escape(workspaceName)))
+}
+
+// Ask for a name and save the current state as a workspace
+func showSaveWorkspaceDialog() {
+	if refuseHostAccess() {
+		return
+	}
+	input := newDialogInput(" Name: ")
+	input.SetText(workspaceName)
+	input.SetBorder(true).SetTitle(" Save workspace ")
+	input.SetTitleAlign(tview.AlignLeft)
+	input.SetTitleColor(tcell.ColorYellow)
+
+	input.SetDoneFunc(func(key tcell.Key) {
+		if key == tcell.KeyEsc {
+			closeDialog("workspace")
+			return
+		}
+		if key != tcell.KeyEnter || input.GetText() == "" {
+			return
+		}
+		name := input.GetText()
+		if err := saveWorkspace(name); err != nil {
+			setStatus(fmt.Sprintf("[red]Error saving workspace: %v", err))
+			return
+		}
+		workspaceName = name
+		closeDialog("workspace")
+		setStatus(fmt.Sprintf("[green]Saved workspace %s", tview.Escape(name)))
+	})
+
+	showDialog("workspace", input, 50, 3)
+}